@@ -19,13 +19,32 @@ if ! command -v protoc-gen-go &> /dev/null; then
     go install google.golang.org/protobuf/cmd/protoc-gen-go@latest
 fi
 
+# Check if protoc-gen-go-grpc is installed
+if ! command -v protoc-gen-go-grpc &> /dev/null; then
+    echo "Installing protoc-gen-go-grpc..."
+    go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+fi
+
 # Generate Go protobuf code
 echo "→ Generating Go protobuf code..."
 mkdir -p src/server/internal/protos/orders
 protoc --go_out=src/server/internal/protos/orders \
     --go_opt=paths=source_relative \
     --proto_path=src/protos \
-    src/protos/order.proto
+    src/protos/order.proto \
+    src/protos/trade.proto
+mkdir -p src/server/internal/protos/positions
+protoc --go_out=src/server/internal/protos/positions \
+    --go_opt=paths=source_relative \
+    --proto_path=src/protos \
+    src/protos/positions.proto
+mkdir -p src/server/internal/protos/strategy
+protoc --go_out=src/server/internal/protos/strategy \
+    --go_opt=paths=source_relative \
+    --go-grpc_out=src/server/internal/protos/strategy \
+    --go-grpc_opt=paths=source_relative \
+    --proto_path=src/protos \
+    src/protos/strategy.proto
 
 echo "✓ Go protobuf code generated"
 
@@ -34,7 +53,17 @@ echo "→ Generating Python protobuf code..."
 mkdir -p src/strategy-env/desk_client
 protoc --python_out=src/strategy-env/desk_client \
     --proto_path=src/protos \
-    src/protos/order.proto
+    src/protos/order.proto \
+    src/protos/trade.proto
+# The gRPC stub needs grpcio-tools; its import of strategy_pb2 is made
+# relative so it works inside the desk_client package
+python3 -m grpc_tools.protoc \
+    --python_out=src/strategy-env/desk_client \
+    --grpc_python_out=src/strategy-env/desk_client \
+    --proto_path=src/protos \
+    src/protos/strategy.proto
+sed -i.bak 's/^import strategy_pb2 as/from . import strategy_pb2 as/' src/strategy-env/desk_client/strategy_pb2_grpc.py
+rm -f src/strategy-env/desk_client/strategy_pb2_grpc.py.bak
 
 echo "✓ Python protobuf code generated"
 echo "✓ All protobuf code generated successfully"
@@ -68,6 +68,6 @@ echo ""
 echo "  2. Start the server:"
 echo "     ./scripts/run_server.sh"
 echo ""
-echo "  3. Deploy strategies:"
-echo "     ./scripts/deploy_strategies.sh start"
+echo "  3. Start strategies:"
+echo "     POST /strategies/{id}/start (see src/server/README.md)"
 echo ""
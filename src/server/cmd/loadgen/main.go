@@ -0,0 +1,323 @@
+// Command loadgen soak-tests the desk by placing synthetic orders at a fixed
+// rate and reporting latency percentiles and error rates.
+//
+// Orders are attributed to variant B of an A/B experiment, which the desk
+// routes to the simulator, so load never reaches Alpaca. Unless -strategy
+// names an existing variant B strategy, loadgen registers a throwaway pair
+// of strategies and an experiment for the run and stops the experiment
+// afterwards.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	orderprotos "desk/internal/protos/orders"
+)
+
+type config struct {
+	url          string
+	userID       string
+	strategyID   int64
+	rate         float64
+	duration     time.Duration
+	concurrency  int
+	symbols      []string
+	maxP99       time.Duration
+	maxErrorRate float64
+}
+
+// stats accumulates request outcomes
+type stats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	codes     map[int]int
+	failed    int // transport errors
+	dropped   int // ticks skipped because every worker was busy
+}
+
+func (s *stats) record(latency time.Duration, code int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+	s.codes[code]++
+}
+
+func main() {
+	var cfg config
+	var symbols string
+	flag.StringVar(&cfg.url, "url", "http://localhost:8080", "desk server URL")
+	flag.StringVar(&cfg.userID, "user", "loadgen", "user ID orders are placed as")
+	flag.Int64Var(&cfg.strategyID, "strategy", 0, "existing variant B strategy to attribute orders to (default: create an experiment)")
+	flag.Float64Var(&cfg.rate, "rate", 50, "orders per second")
+	flag.DurationVar(&cfg.duration, "duration", time.Minute, "how long to generate load")
+	flag.IntVar(&cfg.concurrency, "concurrency", 64, "maximum requests in flight")
+	flag.StringVar(&symbols, "symbols", "AAPL,MSFT,SPY,QQQ", "comma-separated symbols to trade")
+	flag.DurationVar(&cfg.maxP99, "max-p99", 0, "exit non-zero if p99 latency exceeds this (0 = no limit)")
+	flag.Float64Var(&cfg.maxErrorRate, "max-error-rate", 0, "exit non-zero if the error rate exceeds this fraction (0 = no limit)")
+	flag.Parse()
+
+	for _, s := range strings.Split(symbols, ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			cfg.symbols = append(cfg.symbols, s)
+		}
+	}
+	if cfg.rate <= 0 || cfg.concurrency <= 0 || len(cfg.symbols) == 0 {
+		log.Fatalf("rate, concurrency and symbols must be positive/non-empty")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	if cfg.strategyID == 0 {
+		strategyID, stop, err := setupExperiment(client, cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up simulator routing: %v", err)
+		}
+		defer stop()
+		cfg.strategyID = strategyID
+	}
+
+	log.Printf("Placing %.0f orders/s for %s against %s (strategy %d, simulator)",
+		cfg.rate, cfg.duration, cfg.url, cfg.strategyID)
+	s := run(client, cfg)
+
+	ok := report(s, cfg)
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// run places orders at the configured rate until the duration elapses. It
+// is open loop: requests are started on schedule regardless of how long
+// earlier ones take, so a slow server shows up as latency rather than as a
+// lower request rate.
+func run(client *http.Client, cfg config) *stats {
+	s := &stats{codes: make(map[int]int)}
+	slots := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+
+	interval := time.Duration(float64(time.Second) / cfg.rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+	deadline := time.After(cfg.duration)
+
+	for n := 0; ; n++ {
+		select {
+		case <-deadline:
+			wg.Wait()
+			return s
+		case <-progress.C:
+			s.mu.Lock()
+			log.Printf("... %d completed, %d failed, %d dropped", len(s.latencies), s.failed, s.dropped)
+			s.mu.Unlock()
+		case <-ticker.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				s.mu.Lock()
+				s.dropped++
+				s.mu.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				latency, code, err := placeOrder(client, cfg, syntheticOrder(cfg, n))
+				s.record(latency, code, err)
+			}(n)
+		}
+	}
+}
+
+// syntheticOrder alternates buys and sells of one share across the symbols
+// so positions stay flat
+func syntheticOrder(cfg config, n int) *orderprotos.OrderRequest {
+	side := "buy"
+	if (n/len(cfg.symbols))%2 == 1 {
+		side = "sell"
+	}
+	return &orderprotos.OrderRequest{
+		Symbol:      cfg.symbols[n%len(cfg.symbols)],
+		Qty:         "1",
+		Side:        side,
+		OrderType:   "market",
+		TimeInForce: "day",
+	}
+}
+
+func placeOrder(client *http.Client, cfg config, order *orderprotos.OrderRequest) (time.Duration, int, error) {
+	body, err := proto.Marshal(order)
+	if err != nil {
+		return 0, 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.url+"/order", bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-User-ID", cfg.userID)
+	req.Header.Set("X-Strategy-ID", strconv.FormatInt(cfg.strategyID, 10))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return time.Since(start), resp.StatusCode, nil
+}
+
+// setupExperiment registers two strategies and an experiment between them so
+// orders from variant B are routed to the simulator. The returned function
+// stops the experiment.
+func setupExperiment(client *http.Client, cfg config) (int64, func(), error) {
+	suffix := time.Now().UTC().Format("20060102T150405")
+
+	var ids [2]int64
+	for i, variant := range []string{"a", "b"} {
+		var strategy struct {
+			ID int64 `json:"id"`
+		}
+		if err := postJSON(client, cfg, "/strategies", map[string]string{
+			"name":      fmt.Sprintf("loadgen-%s-%s", variant, suffix),
+			"file_path": "loadgen",
+		}, &strategy); err != nil {
+			return 0, nil, err
+		}
+		ids[i] = strategy.ID
+	}
+
+	var experiment struct {
+		ID int64 `json:"id"`
+	}
+	if err := postJSON(client, cfg, "/experiments", map[string]any{
+		"name":          "loadgen-" + suffix,
+		"strategy_a_id": ids[0],
+		"strategy_b_id": ids[1],
+	}, &experiment); err != nil {
+		return 0, nil, err
+	}
+
+	stop := func() {
+		path := fmt.Sprintf("/experiments/%d/stop", experiment.ID)
+		if err := postJSON(client, cfg, path, nil, nil); err != nil {
+			log.Printf("Failed to stop experiment %d: %v", experiment.ID, err)
+		}
+	}
+	return ids[1], stop, nil
+}
+
+func postJSON(client *http.Client, cfg config, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-ID", cfg.userID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("POST %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// report prints the run's summary and reports whether it met the
+// configured thresholds
+func report(s *stats, cfg config) bool {
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+
+	completed := len(s.latencies)
+	errors := s.failed
+	for code, n := range s.codes {
+		if code != http.StatusCreated {
+			errors += n
+		}
+	}
+	attempted := completed + s.failed
+	errorRate := 0.0
+	if attempted > 0 {
+		errorRate = float64(errors) / float64(attempted)
+	}
+
+	fmt.Printf("\nRequests:   %d attempted, %d dropped (concurrency limit)\n", attempted, s.dropped)
+	fmt.Printf("Throughput: %.1f/s\n", float64(attempted)/cfg.duration.Seconds())
+	fmt.Printf("Errors:     %d (%.2f%%), %d transport failures\n", errors, 100*errorRate, s.failed)
+
+	codes := make([]int, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Printf("  HTTP %d:  %d\n", code, s.codes[code])
+	}
+
+	var p99 time.Duration
+	if completed > 0 {
+		p99 = percentile(s.latencies, 0.99)
+		fmt.Printf("Latency:    p50=%s p95=%s p99=%s max=%s\n",
+			percentile(s.latencies, 0.50), percentile(s.latencies, 0.95), p99, s.latencies[completed-1])
+	}
+
+	ok := true
+	if cfg.maxP99 > 0 && p99 > cfg.maxP99 {
+		fmt.Printf("FAIL: p99 latency %s exceeds %s\n", p99, cfg.maxP99)
+		ok = false
+	}
+	if cfg.maxErrorRate > 0 && errorRate > cfg.maxErrorRate {
+		fmt.Printf("FAIL: error rate %.4f exceeds %.4f\n", errorRate, cfg.maxErrorRate)
+		ok = false
+	}
+	return ok
+}
+
+// percentile returns the q-th quantile of sorted latencies
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"desk/internal/clock"
+	"desk/internal/lifecycle"
+	"desk/internal/marks"
+	"desk/internal/stream"
+	"desk/internal/tradeupdates"
+)
+
+// startedAt is when the server process started
+var startedAt = time.Now()
+
+type memoryStatus struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	LastGCPause    string `json:"last_gc_pause"`
+}
+
+type databaseStatus struct {
+	OpenConnections int    `json:"open_connections"`
+	InUse           int    `json:"in_use"`
+	Idle            int    `json:"idle"`
+	WaitCount       int64  `json:"wait_count"`
+	WaitDuration    string `json:"wait_duration"`
+}
+
+type priceStatus struct {
+	Tracked    int                `json:"tracked_symbols"`
+	Watched    int                `json:"watched_symbols"`
+	StaleAfter string             `json:"stale_after"`
+	Stale      []marks.StalePrice `json:"stale"`
+}
+
+type queueStatus struct {
+	RunningStrategies     int `json:"running_strategies"`
+	PendingStrategyLogs   int `json:"pending_strategy_log_lines"`
+	ScheduledConditionals int `json:"scheduled_conditional_orders"`
+}
+
+// debugStatus summarizes the server's runtime state for diagnosing
+// slowdowns
+type debugStatus struct {
+	StartedAt    time.Time               `json:"started_at"`
+	Uptime       string                  `json:"uptime"`
+	GoVersion    string                  `json:"go_version"`
+	Goroutines   int                     `json:"goroutines"`
+	GOMAXPROCS   int                     `json:"gomaxprocs"`
+	Memory       memoryStatus            `json:"memory"`
+	Database     databaseStatus          `json:"database"`
+	Queues       queueStatus             `json:"queues"`
+	Prices       priceStatus             `json:"prices"`
+	Clock        clock.Status            `json:"clock"`
+	Streams      map[string]stream.Stats `json:"streams"`
+	Websockets   socketStats             `json:"websockets"`
+	TradeUpdates tradeupdates.Stats      `json:"trade_updates"`
+	Components   []lifecycle.Status      `json:"components"`
+}
+
+func (app *Application) debugStatus() debugStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	db := app.db.Stats()
+	running, pendingLines := app.runner.Processes()
+
+	return debugStatus{
+		StartedAt:  startedAt.UTC(),
+		Uptime:     time.Since(startedAt).Round(time.Second).String(),
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Memory: memoryStatus{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+			LastGCPause:    time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+		},
+		Database: databaseStatus{
+			OpenConnections: db.OpenConnections,
+			InUse:           db.InUse,
+			Idle:            db.Idle,
+			WaitCount:       db.WaitCount,
+			WaitDuration:    db.WaitDuration.String(),
+		},
+		Queues: queueStatus{
+			RunningStrategies:     running,
+			PendingStrategyLogs:   pendingLines,
+			ScheduledConditionals: app.conditionalOrders.Scheduled(),
+		},
+		Prices: priceStatus{
+			Tracked:    app.marks.Tracked(),
+			Watched:    app.marks.Watched(),
+			StaleAfter: app.marks.StaleAfter().String(),
+			Stale:      app.marks.StalePrices(),
+		},
+		Clock: app.clockChecker.Status(),
+		Streams: map[string]stream.Stats{
+			"risk":            app.riskSnapshots.StreamStats(),
+			"news":            app.news.StreamStats(),
+			"blotter":         app.blotter.StreamStats(),
+			"positions":       app.positionFeed.StreamStats(),
+			"strategy_logs":   app.runner.StreamStats(),
+			"strategy_events": app.events.StreamStats(),
+		},
+		Websockets:   app.sockets.stats(),
+		TradeUpdates: app.tradeUpdates.Stats(),
+		Components:   app.components.Status(),
+	}
+}
+
+// handleDebugStatus serves GET /debug/status on the admin port
+func (app *Application) handleDebugStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, app.debugStatus())
+}
+
+// handleBrokerLatency serves GET /admin/latency: each broker endpoint's
+// latency over the last ?window= (default 15m, at most an hour)
+func (app *Application) handleBrokerLatency(w http.ResponseWriter, r *http.Request) {
+	window := 15 * time.Minute
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute || d > time.Hour {
+			http.Error(w, "Bad request: window must be a duration from 1m to 1h", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	writeJSON(w, http.StatusOK, app.brokerLatency.Stats(window))
+}
+
+// adminHandler serves pprof, expvar, the debug status, configuration
+// reloads, the SQL console, archive analytics, research and audit exports,
+// checklist runs,
+// member onboarding and deactivation, clearing strategy kills, trade
+// disputes, model portfolios, backups, integrity checks, broker latency,
+// open order reconciliation, hedges and cash sweeps on the admin port,
+// behind a bearer token
+func (app *Application) adminHandler(token string) http.Handler {
+	expvar.Publish("desk", expvar.Func(func() any { return app.debugStatus() }))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/status", app.handleDebugStatus)
+	mux.HandleFunc("POST /admin/reload", app.handleReload)
+	mux.HandleFunc("POST /admin/sql", app.handleConsoleQuery)
+	mux.HandleFunc("POST /admin/analytics/query", app.handleAnalyticsQuery)
+	mux.HandleFunc("POST /admin/reports/weekly", app.handleSendWeeklyReports)
+	mux.HandleFunc("GET /admin/research/trades", app.handleResearchExport)
+	mux.HandleFunc("POST /admin/research/trades", app.handleStoreResearchExport)
+	mux.HandleFunc("GET /admin/audit/orders", app.handleAuditExport)
+	mux.HandleFunc("POST /admin/audit/orders", app.handleStoreAuditExport)
+	mux.HandleFunc("POST /admin/checklists/{name}", app.handleRunChecklist)
+	mux.HandleFunc("POST /admin/users", app.handleOnboardUser)
+	mux.HandleFunc("GET /admin/users/{id}", app.handleGetMember)
+	mux.HandleFunc("PUT /admin/users/{id}/limits", app.handleSetMemberLimits)
+	mux.HandleFunc("POST /admin/users/{id}/keys", app.handleCreateAPIKey)
+	mux.HandleFunc("DELETE /admin/users/{id}/keys/{key}", app.handleRevokeAPIKey)
+	mux.HandleFunc("GET /admin/users/deleted", app.handleListDeletedUsers)
+	mux.HandleFunc("GET /admin/strategies/killed", app.handleListKilledStrategies)
+	mux.HandleFunc("DELETE /admin/strategies/{id}/kill", app.handleClearKill)
+	mux.HandleFunc("GET /admin/disputes", app.handleAdminListDisputes)
+	mux.HandleFunc("POST /admin/models", app.handleCreateModel)
+	mux.HandleFunc("PUT /admin/models/{name}", app.handleUpdateModel)
+	mux.HandleFunc("DELETE /admin/models/{name}", app.handleDeleteModel)
+	mux.HandleFunc("POST /admin/disputes/{id}/resolve", app.handleResolveDispute)
+	mux.HandleFunc("DELETE /admin/users/{id}", app.handleDeleteUser)
+	mux.HandleFunc("POST /admin/users/{id}/restore", app.handleRestoreUser)
+	mux.HandleFunc("POST /admin/backup", app.handleBackup)
+	mux.HandleFunc("GET /admin/fsck", app.handleFsck)
+	mux.HandleFunc("POST /admin/fsck", app.handleFsckRepair)
+	mux.HandleFunc("GET /admin/latency", app.handleBrokerLatency)
+	mux.HandleFunc("GET /admin/orders/open", app.handleAdminOpenOrders)
+	mux.HandleFunc("POST /admin/hedges/{benchmark}", app.handleExecuteHedge)
+	mux.HandleFunc("POST /admin/cash/sweep", app.handleExecuteSweep)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/database"
+	"desk/internal/symbols"
+)
+
+type setAliasRequest struct {
+	Symbol string `json:"symbol"`
+}
+
+// loadAliases reads the symbol aliases stored in the database
+func loadAliases(db *database.DB) (*symbols.Aliases, error) {
+	stored, err := db.GetSymbolAliases()
+	if err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]string, len(stored))
+	for _, a := range stored {
+		aliases[a.Alias] = a.Symbol
+	}
+	return symbols.NewAliases(aliases), nil
+}
+
+// handleListAliases lists the symbol aliases
+func (app *Application) handleListAliases(w http.ResponseWriter, r *http.Request) {
+	stored, err := app.db.GetSymbolAliases()
+	if err != nil {
+		log.Printf("Failed to load symbol aliases: %v", err)
+		http.Error(w, "Failed to load symbol aliases", http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		stored = []database.SymbolAlias{}
+	}
+
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// handleSetAlias makes {alias} resolve to another symbol in orders and symbol
+// lists. Both are normalized first. Aliases don't chain: the target can't be
+// an alias itself.
+func (app *Application) handleSetAlias(w http.ResponseWriter, r *http.Request) {
+	var req setAliasRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	alias := symbols.Normalize(r.PathValue("alias"))
+	symbol := symbols.Normalize(req.Symbol)
+	if alias == "" || symbol == "" {
+		http.Error(w, "Bad request: alias and symbol are required", http.StatusBadRequest)
+		return
+	}
+	if alias == symbol {
+		http.Error(w, "Bad request: "+r.PathValue("alias")+" already normalizes to "+symbol, http.StatusBadRequest)
+		return
+	}
+	if target, ok := app.aliases.Target(symbol); ok {
+		http.Error(w, "Bad request: "+symbol+" is itself an alias for "+target, http.StatusBadRequest)
+		return
+	}
+	if app.aliases.IsTarget(alias) {
+		http.Error(w, "Bad request: other aliases resolve to "+alias, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.db.SetSymbolAlias(alias, symbol); err != nil {
+		log.Printf("Failed to store symbol alias: %v", err)
+		http.Error(w, "Failed to store symbol alias", http.StatusInternalServerError)
+		return
+	}
+	app.aliases.Set(alias, symbol)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) handleDeleteAlias(w http.ResponseWriter, r *http.Request) {
+	alias := symbols.Normalize(r.PathValue("alias"))
+	found, err := app.db.DeleteSymbolAlias(alias)
+	if err != nil {
+		log.Printf("Failed to delete symbol alias: %v", err)
+		http.Error(w, "Failed to delete symbol alias", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Symbol alias not found", http.StatusNotFound)
+		return
+	}
+	app.aliases.Delete(alias)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"desk/internal/analytics"
+)
+
+// handleAnalyticsQuery serves POST /admin/analytics/query on the admin
+// port, running the body's sql with DuckDB against a read-only snapshot of
+// the archive in the object store rather than the desk database. It takes
+// the console's limit, offset and format=csv parameters.
+func (app *Application) handleAnalyticsQuery(w http.ResponseWriter, r *http.Request) {
+	var req consoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.SQL) == "" {
+		http.Error(w, "Bad request: sql is required", http.StatusBadRequest)
+		return
+	}
+	offset, limit, ok := consolePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), consoleQueryTimeout)
+	defer cancel()
+
+	log.Printf("Analytics query (offset=%d, limit=%d): %s", offset, limit, req.SQL)
+	result, err := app.analytics.Query(ctx, req.SQL, offset, limit)
+	if err != nil {
+		switch {
+		// DuckDB reports an interrupted query, not the context's error
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			http.Error(w, "Query timed out", http.StatusGatewayTimeout)
+		case errors.Is(err, analytics.ErrSnapshot):
+			log.Printf("Failed to load analytics snapshot: %v", err)
+			http.Error(w, "Failed to load archive: "+err.Error(), http.StatusInternalServerError)
+		default:
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	writeQueryResult(w, r, result)
+}
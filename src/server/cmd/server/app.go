@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	alpacaapi "github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+
+	"desk/internal/capture"
+	"desk/internal/clock"
+	"desk/internal/confirm"
+	"desk/internal/database"
+	"desk/internal/events"
+	"desk/internal/lifecycle"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/pnl"
+	"desk/internal/risk"
+	"desk/internal/symbols"
+	"desk/internal/tenants"
+)
+
+// Broker is a brokerage account as the desk uses it. *alpaca.Client is
+// one; tests use a fake.
+type Broker interface {
+	PlaceOrder(order *orders.Order) (*alpacaapi.Order, error)
+	GetOrder(orderID string) (*alpacaapi.Order, error)
+	CancelOrder(orderID string) error
+	ReplaceOrder(orderID string, req alpacaapi.ReplaceOrderRequest) (*alpacaapi.Order, error)
+	OpenOrders() ([]alpacaapi.Order, error)
+	OrdersSince(after time.Time) ([]alpacaapi.Order, error)
+	Account() (*alpacaapi.Account, error)
+	Positions() ([]alpacaapi.Position, error)
+	Dividends(date time.Time) ([]alpacaapi.AccountActivity, error)
+	StreamTradeUpdates(ctx context.Context, since time.Time, handler func(alpacaapi.TradeUpdate)) error
+}
+
+// Dependencies are what an Application is built on. Broker and DB are
+// required; Clock defaults to the system clock and Notifier to the log.
+type Dependencies struct {
+	// Broker is the desk's account
+	Broker Broker
+	// Chapters are the accounts of chapters that trade in their own, by
+	// chapter ID, and Tenants the chapters; both are nil without chapters
+	Chapters map[string]Broker
+	Tenants  *tenants.Registry
+	// DB is the desk database; tests use a scratch one
+	DB *database.DB
+	// Clock dates trades and the orders pre-trade rules see
+	Clock clock.Clock
+	// Notifier receives desk notifications. Users' own channels are added
+	// from their preferences.
+	Notifier notify.Notifier
+}
+
+// newApplication builds an Application that can take orders through
+// POST /order and serve the endpoints that only read the database. The
+// subsystems behind the rest of the API (marks, risk snapshots, the
+// strategy runner and so on) are set on it by main.
+func newApplication(deps Dependencies) *Application {
+	if deps.Clock == nil {
+		deps.Clock = clock.System
+	}
+	if deps.Notifier == nil {
+		deps.Notifier = notify.Log{}
+	}
+	notifier := notify.NewSwitch(deps.Notifier)
+
+	return &Application{
+		brokers: &brokers{
+			host:     deps.Broker,
+			chapters: deps.Chapters,
+			registry: deps.Tenants,
+			db:       deps.DB,
+		},
+		tenants:         deps.Tenants,
+		clock:           deps.Clock,
+		notifier:        notifier,
+		userNotifier:    notify.NewUsers(notifier, preferenceChannels(deps.DB)),
+		aliases:         symbols.NewAliases(nil),
+		preTrade:        risk.NewRules(),
+		nonces:          risk.NewNonces(),
+		tickets:         confirm.NewStore(30 * time.Second),
+		captures:        capture.NewRecorder(deps.DB, 7*24*time.Hour, 16<<10),
+		dailyAggregates: pnl.NewDailyRecorder(deps.DB),
+		events:          events.NewBus(),
+		sockets:         newSockets(socketConfig{}, nil),
+		components:      lifecycle.New(10 * time.Second),
+		db:              deps.DB,
+	}
+}
+
+// router builds the API's handler. The API has its own mux so nothing
+// registered on http.DefaultServeMux (such as pprof) is exposed on it.
+func (app *Application) router() http.Handler {
+	mux := http.NewServeMux()
+	routes := app.routes()
+	for _, rt := range routes {
+		mux.HandleFunc(rt.pattern, rt.handler)
+	}
+	mux.HandleFunc("GET /openapi.json", handleOpenAPI(openAPI(routes)))
+	mux.HandleFunc("GET /docs", handleSwaggerUI)
+	mux.HandleFunc("GET /protos/descriptors", handleProtoDescriptors)
+	mux.HandleFunc("GET /readyz", app.handleReadyz)
+
+	// Keys are checked inside the chapter's scope, so a key can't be used
+	// with another chapter's token
+	handler := app.apiKeyHandler(mux)
+	if app.tenants != nil {
+		return app.tenantHandler(handler)
+	}
+	return handler
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	alpacaapi "github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+	"google.golang.org/protobuf/proto"
+
+	"desk/internal/alpaca"
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/fixture"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+	"desk/internal/risk"
+)
+
+// fakeBroker accepts orders as new, or rejects them all with reject
+type fakeBroker struct {
+	mu     sync.Mutex
+	placed []orders.Order
+	reject error
+}
+
+func (b *fakeBroker) PlaceOrder(order *orders.Order) (*alpacaapi.Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reject != nil {
+		return nil, b.reject
+	}
+	b.placed = append(b.placed, *order)
+	qty := order.Qty
+	return &alpacaapi.Order{
+		ID:            fmt.Sprintf("fake-%d", len(b.placed)),
+		ClientOrderID: order.ClientOrderID,
+		Symbol:        order.Symbol,
+		Qty:           &qty,
+		Side:          alpacaapi.Side(order.Side),
+		Type:          alpacaapi.OrderType(order.Type),
+		TimeInForce:   alpacaapi.TimeInForce(order.TimeInForce),
+		LimitPrice:    order.LimitPrice,
+		StopPrice:     order.StopPrice,
+		Status:        "new",
+	}, nil
+}
+
+func (b *fakeBroker) orders() []orders.Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]orders.Order(nil), b.placed...)
+}
+
+var errFakeBroker = errors.New("not supported by the fake broker")
+
+func (b *fakeBroker) GetOrder(string) (*alpacaapi.Order, error) { return nil, errFakeBroker }
+func (b *fakeBroker) CancelOrder(string) error                  { return errFakeBroker }
+func (b *fakeBroker) ReplaceOrder(string, alpacaapi.ReplaceOrderRequest) (*alpacaapi.Order, error) {
+	return nil, errFakeBroker
+}
+func (b *fakeBroker) OpenOrders() ([]alpacaapi.Order, error)                   { return nil, nil }
+func (b *fakeBroker) OrdersSince(time.Time) ([]alpacaapi.Order, error)         { return nil, nil }
+func (b *fakeBroker) Account() (*alpacaapi.Account, error)                     { return nil, errFakeBroker }
+func (b *fakeBroker) Positions() ([]alpacaapi.Position, error)                 { return nil, nil }
+func (b *fakeBroker) Dividends(time.Time) ([]alpacaapi.AccountActivity, error) { return nil, nil }
+func (b *fakeBroker) StreamTradeUpdates(ctx context.Context, _ time.Time, _ func(alpacaapi.TradeUpdate)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// fakeNotifier keeps the notifications sent
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []notify.Notification
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, note notify.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, note)
+	return nil
+}
+
+func (n *fakeNotifier) titles() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var titles []string
+	for _, note := range n.sent {
+		titles = append(titles, note.Title)
+	}
+	return titles
+}
+
+// testDesk is the API served over HTTP against fakes and a scratch database
+type testDesk struct {
+	app      *Application
+	server   *httptest.Server
+	broker   *fakeBroker
+	notifier *fakeNotifier
+	clock    *clock.Virtual
+}
+
+func newTestDesk(t *testing.T) *testDesk {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "desk.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	d := &testDesk{
+		broker:   &fakeBroker{},
+		notifier: &fakeNotifier{},
+		clock:    clock.NewVirtual(time.Date(2026, 3, 2, 15, 30, 0, 0, time.UTC)),
+	}
+	d.app = newApplication(Dependencies{Broker: d.broker, DB: db, Clock: d.clock, Notifier: d.notifier})
+	d.server = httptest.NewServer(d.app.router())
+	t.Cleanup(d.server.Close)
+	return d
+}
+
+// order posts an order as user alice, with headers added to the request,
+// and returns the response's status code and OrderResponse
+func (d *testDesk) order(t *testing.T, req *orderprotos.OrderRequest, headers map[string]string) (*http.Response, *orderprotos.OrderResponse) {
+	t.Helper()
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.NewRequest(http.MethodPost, d.server.URL+"/order", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set("X-User-ID", "alice")
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	resp, err := d.server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out orderprotos.OrderResponse
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode order response %q: %v", data, err)
+	}
+	return resp, &out
+}
+
+// trades lists alice's trades, newest first
+func (d *testDesk) trades(t *testing.T) []*orderprotos.TradeRecord {
+	t.Helper()
+	r, err := http.NewRequest(http.MethodGet, d.server.URL+"/trades", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-User-ID", "alice")
+	resp, err := d.server.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /trades: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page orderprotos.TradePage
+	if err := proto.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	return page.Trades
+}
+
+func limitOrder() *orderprotos.OrderRequest {
+	return &orderprotos.OrderRequest{
+		Symbol:      "aapl",
+		Qty:         "10",
+		Side:        "buy",
+		OrderType:   "limit",
+		TimeInForce: "day",
+		LimitPrice:  "187.25",
+	}
+}
+
+func TestOrderPlaced(t *testing.T) {
+	d := newTestDesk(t)
+
+	resp, out := d.order(t, limitOrder(), nil)
+	if resp.StatusCode != http.StatusCreated || out.Status != "success" {
+		t.Fatalf("got %s %q: %s, want 201 success", resp.Status, out.Status, out.Message)
+	}
+	if out.OrderId != "fake-1" || out.Symbol != "AAPL" || out.OrderStatus != "new" || out.ClientOrderId == "" {
+		t.Errorf("response = %v", out)
+	}
+
+	placed := d.broker.orders()
+	if len(placed) != 1 {
+		t.Fatalf("broker got %d orders, want 1", len(placed))
+	}
+	if o := placed[0]; o.Symbol != "AAPL" || o.Qty.String() != "10" || o.LimitPrice.String() != "187.25" || o.ClientOrderID != out.ClientOrderId {
+		t.Errorf("broker got %+v", o)
+	}
+
+	trades := d.trades(t)
+	if len(trades) != 1 {
+		t.Fatalf("got %d trades, want 1", len(trades))
+	}
+	trade := trades[0]
+	if trade.OrderId != "fake-1" || trade.OrderStatus != "new" || trade.Venue != database.VenueAlpaca {
+		t.Errorf("trade = %v", trade)
+	}
+	// Trades are dated by the application's clock
+	if submitted, err := time.Parse(time.RFC3339Nano, trade.SubmittedAt); err != nil || !submitted.Equal(d.clock.Now()) {
+		t.Errorf("submitted_at = %s, want %s", trade.SubmittedAt, d.clock.Now().Format(time.RFC3339))
+	}
+	if len(d.notifier.titles()) != 0 {
+		t.Errorf("notified %v for an accepted order", d.notifier.titles())
+	}
+}
+
+func TestOrderInvalid(t *testing.T) {
+	d := newTestDesk(t)
+
+	order := limitOrder()
+	order.Qty = "-5"
+	resp, out := d.order(t, order, nil)
+	if resp.StatusCode != http.StatusBadRequest || out.Status != "error" {
+		t.Fatalf("got %s %q, want 400 error", resp.Status, out.Status)
+	}
+	if n := len(d.broker.orders()); n != 0 {
+		t.Errorf("broker got %d orders", n)
+	}
+	if n := len(d.trades(t)); n != 0 {
+		t.Errorf("logged %d trades for an invalid order", n)
+	}
+}
+
+func TestOrderRejectedByBroker(t *testing.T) {
+	d := newTestDesk(t)
+	d.broker.reject = errors.New("insufficient buying power")
+
+	resp, out := d.order(t, limitOrder(), nil)
+	if resp.StatusCode != http.StatusInternalServerError || out.Status != "error" {
+		t.Fatalf("got %s %q, want 500 error", resp.Status, out.Status)
+	}
+	if !strings.Contains(out.Message, "insufficient buying power") {
+		t.Errorf("message = %q", out.Message)
+	}
+
+	trades := d.trades(t)
+	if len(trades) != 1 {
+		t.Fatalf("got %d trades, want the rejected one", len(trades))
+	}
+	if trades[0].OrderStatus != orders.StatusRejected || trades[0].ErrorMessage != "insufficient buying power" {
+		t.Errorf("trade = %v", trades[0])
+	}
+}
+
+func TestOrderBlockedByRisk(t *testing.T) {
+	d := newTestDesk(t)
+	d.app.preTrade.Replace(risk.NewClientClockRule(time.Minute, d.app.nonces))
+	clientTime := func(age time.Duration) string {
+		return strconv.FormatInt(d.clock.Now().Add(-age).UnixMilli(), 10)
+	}
+
+	// Stale by the application's clock, whatever the wall clock says
+	resp, out := d.order(t, limitOrder(), map[string]string{"X-Client-Timestamp": clientTime(2 * time.Minute)})
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("X-Reject-Code") != risk.CodeStaleOrder {
+		t.Fatalf("got %s %s: %s, want 403 %s", resp.Status, resp.Header.Get("X-Reject-Code"), out.Message, risk.CodeStaleOrder)
+	}
+	if n := len(d.broker.orders()); n != 0 {
+		t.Errorf("broker got %d orders for a blocked one", n)
+	}
+	if titles := d.notifier.titles(); len(titles) != 1 || titles[0] != "Order blocked" {
+		t.Errorf("notified %v, want Order blocked", titles)
+	}
+
+	// A fresh order passes, and resending it is blocked
+	headers := map[string]string{"X-Client-Timestamp": clientTime(time.Second), "X-Client-Nonce": "n-1"}
+	if resp, out := d.order(t, limitOrder(), headers); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("got %s: %s, want 201", resp.Status, out.Message)
+	}
+	if resp, _ := d.order(t, limitOrder(), headers); resp.Header.Get("X-Reject-Code") != risk.CodeReusedNonce {
+		t.Errorf("resent order got %s %s, want 403 %s", resp.Status, resp.Header.Get("X-Reject-Code"), risk.CodeReusedNonce)
+	}
+	if n := len(d.broker.orders()); n != 1 {
+		t.Errorf("broker got %d orders, want 1", n)
+	}
+
+	// Blocked orders are logged as rejected trades
+	var rejected int
+	for _, trade := range d.trades(t) {
+		if trade.OrderStatus == orders.StatusRejected {
+			rejected++
+		}
+	}
+	if rejected != 2 {
+		t.Errorf("got %d rejected trades, want 2", rejected)
+	}
+}
+
+func TestOrderSource(t *testing.T) {
+	d := newTestDesk(t)
+	rules := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rules, []byte(`[{"name": "webhook-size", "expr": "order.source != 'webhook' || order.qty <= 5"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defs, err := risk.LoadCustomRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.app.preTrade.Replace(risk.NewCustomRule(defs[0], risk.CustomSources{Hits: d.app.db}))
+
+	// Orders without a strategy are manual unless they say otherwise
+	if resp, out := d.order(t, limitOrder(), nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("manual order got %s: %s, want 201", resp.Status, out.Message)
+	}
+	if resp, _ := d.order(t, limitOrder(), map[string]string{"X-Order-Source": "algo"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("order claiming the algo source got %s, want 400", resp.Status)
+	}
+
+	// Risk rules can hold webhook orders to their own limits
+	webhook := map[string]string{"X-Order-Source": orders.SourceWebhook}
+	if resp, out := d.order(t, limitOrder(), webhook); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("oversized webhook order got %s: %s, want 403", resp.Status, out.Message)
+	}
+	small := limitOrder()
+	small.Qty = "5"
+	if resp, out := d.order(t, small, webhook); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("webhook order got %s: %s, want 201", resp.Status, out.Message)
+	}
+
+	var sources []string
+	for _, trade := range d.trades(t) {
+		sources = append(sources, trade.Source)
+	}
+	if want := []string{"webhook", "webhook", "manual"}; !slices.Equal(sources, want) {
+		t.Errorf("trade sources = %v, want %v", sources, want)
+	}
+
+	// The desk can send orders from a source through tickets
+	d.app.confirmSources = map[string]bool{orders.SourceWebhook: true}
+	if resp, _ := d.order(t, small, webhook); resp.StatusCode != http.StatusPreconditionRequired || resp.Header.Get("X-Reject-Code") != "CONFIRMATION_REQUIRED" {
+		t.Errorf("webhook order needing confirmation got %s %s, want 428 CONFIRMATION_REQUIRED", resp.Status, resp.Header.Get("X-Reject-Code"))
+	}
+	if resp, _ := d.order(t, small, nil); resp.StatusCode != http.StatusCreated {
+		t.Errorf("manual order got %s, want 201", resp.Status)
+	}
+}
+
+func TestTradeDispute(t *testing.T) {
+	d := newTestDesk(t)
+	if resp, out := d.order(t, limitOrder(), nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("order got %s: %s, want 201", resp.Status, out.Message)
+	}
+	trade := d.trades(t)[0]
+	dispute := func() *http.Response {
+		r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/trades/%d/disputes", d.server.URL, trade.Id), strings.NewReader(`{"reason": "fat finger"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("X-User-ID", "alice")
+		resp, err := d.server.Client().Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Only fills can be disputed
+	if resp := dispute(); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("dispute of an unfilled trade got %s, want 400", resp.Status)
+	}
+	price := decimal.RequireFromString("187.25")
+	filledAt := time.Date(2026, 3, 2, 15, 31, 0, 0, time.UTC)
+	if err := d.app.db.UpdateTradeStatus(trade.OrderId, "filled", decimal.NewFromInt(10), &price, &filledAt); err != nil {
+		t.Fatal(err)
+	}
+	if resp := dispute(); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("dispute got %s, want 201", resp.Status)
+	}
+	if resp := dispute(); resp.StatusCode != http.StatusConflict {
+		t.Errorf("second dispute got %s, want 409", resp.Status)
+	}
+	if got := d.trades(t)[0].Dispute; got != database.DisputeOpen {
+		t.Errorf("blotter dispute = %q, want open", got)
+	}
+
+	// Upholding it books the adjustment on the session the trade filled in
+	admin := d.app.adminHandler("secret")
+	disputes, err := d.app.db.GetDisputes("alice", database.DisputeOpen)
+	if err != nil || len(disputes) != 1 {
+		t.Fatalf("open disputes = %v, %v", disputes, err)
+	}
+	r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/disputes/%d/resolve", disputes[0].ID), strings.NewReader(`{"status": "upheld", "adjustment": "-40"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve got %d: %s, want 200", w.Code, w.Body)
+	}
+	if got := d.trades(t)[0].Dispute; got != database.DisputeUpheld {
+		t.Errorf("blotter dispute = %q, want upheld", got)
+	}
+	adjustments, err := d.app.db.GetDisputeAdjustments("2026-03-02", "2026-03-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adjustments) != 1 || !adjustments[0].Adjustment.Equal(decimal.NewFromInt(-40)) || adjustments[0].Symbol != "AAPL" {
+		t.Errorf("adjustments = %+v, want AAPL -40", adjustments)
+	}
+	if !slices.Contains(d.notifier.titles(), "Trade disputed") {
+		t.Errorf("notifications = %v, want Trade disputed", d.notifier.titles())
+	}
+}
+
+// TestOrderThroughFixture places orders through the Alpaca client against
+// the recorded Alpaca fixture rather than the fake broker
+func TestOrderThroughFixture(t *testing.T) {
+	d := newTestDesk(t)
+	alpacaFixture, err := fixture.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(alpacaFixture)
+	t.Cleanup(server.Close)
+	client, err := alpaca.NewClient("key", "secret", server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.app.brokers.host = client
+
+	// A market order fills at the recorded price
+	market := limitOrder()
+	market.OrderType, market.LimitPrice = "market", ""
+	resp, out := d.order(t, market, nil)
+	if resp.StatusCode != http.StatusCreated || out.OrderStatus != "filled" || out.FilledQty != "10" {
+		t.Fatalf("got %s %q: %s, want 201 filled", resp.Status, out.OrderStatus, out.Message)
+	}
+
+	// Alpaca's rejection is the desk's
+	sc, err := fixture.Named("reject-orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpacaFixture.Inject(sc)
+	resp, out = d.order(t, limitOrder(), nil)
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(out.Message, "insufficient buying power") {
+		t.Fatalf("got %s: %s, want 500 insufficient buying power", resp.Status, out.Message)
+	}
+
+	trades := d.trades(t)
+	if len(trades) != 2 {
+		t.Fatalf("got %d trades, want 2", len(trades))
+	}
+	if trades[0].OrderStatus != orders.StatusRejected || trades[1].OrderStatus != "filled" {
+		t.Errorf("trades = %v, want the rejected one and the filled one", trades)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/arrowipc"
+	"desk/internal/database"
+)
+
+// wantsArrow reports whether the caller asked for an Arrow IPC stream, with
+// ?format=arrow or an Accept: application/vnd.apache.arrow.stream header
+func wantsArrow(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "arrow" || strings.Contains(r.Header.Get("Accept"), arrowipc.ContentType)
+}
+
+// writeArrow writes columns as an Arrow IPC stream
+func writeArrow(w http.ResponseWriter, columns ...arrowipc.Column) {
+	w.Header().Set("Content-Type", arrowipc.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := arrowipc.Write(w, columns...); err != nil {
+		log.Printf("Failed to write Arrow response: %v", err)
+	}
+}
+
+// decimalFloat converts a decimal for an Arrow float column. Notebooks work
+// in floats anyway; the JSON and protobuf responses keep exact decimals.
+func decimalFloat(d *decimal.Decimal) *float64 {
+	if d == nil {
+		return nil
+	}
+	f := d.InexactFloat64()
+	return &f
+}
+
+// tradeColumns lays trades out as Arrow columns
+func tradeColumns(trades []database.Trade) []arrowipc.Column {
+	n := len(trades)
+	id, strategyID, strategyVersion := make([]*int64, n), make([]*int64, n), make([]*int64, n)
+	clientOrderID, hedgeRule, source := make([]*string, n), make([]*string, n), make([]*string, n)
+	extendedHours, session := make([]bool, n), make([]*string, n)
+	orderID, symbol, side, orderType, tif := make([]*string, n), make([]*string, n), make([]*string, n), make([]*string, n), make([]*string, n)
+	status, venue, errorMessage := make([]*string, n), make([]*string, n), make([]*string, n)
+	qty, filledQty, limitPrice, stopPrice, filledAvgPrice := make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n)
+	submittedAt, filledAt := make([]*time.Time, n), make([]*time.Time, n)
+	receivedAt, sentAt, ackedAt := make([]*time.Time, n), make([]*time.Time, n), make([]*time.Time, n)
+	for i := range trades {
+		t := &trades[i]
+		id[i], strategyID[i], strategyVersion[i] = &t.ID, t.StrategyID, t.StrategyVersion
+		clientOrderID[i] = &t.ClientOrderID
+		if t.HedgeRule != "" {
+			hedgeRule[i] = &t.HedgeRule
+		}
+		if t.Source != "" {
+			source[i] = &t.Source
+		}
+		extendedHours[i] = t.ExtendedHours
+		sessionName := tradeSession(t)
+		session[i] = &sessionName
+		orderID[i], symbol[i], side[i], orderType[i], tif[i] = &t.OrderID, &t.Symbol, &t.Side, &t.OrderType, &t.TimeInForce
+		status[i], venue[i], errorMessage[i] = &t.OrderStatus, &t.Venue, t.ErrorMessage
+		qty[i], filledQty[i] = decimalFloat(&t.Qty), decimalFloat(&t.FilledQty)
+		limitPrice[i], stopPrice[i], filledAvgPrice[i] = decimalFloat(t.LimitPrice), decimalFloat(t.StopPrice), decimalFloat(t.FilledAvgPrice)
+		submittedAt[i], filledAt[i] = &t.SubmittedAt, t.FilledAt
+		receivedAt[i], sentAt[i], ackedAt[i] = t.ReceivedAt, t.SentAt, t.AckedAt
+	}
+	return []arrowipc.Column{
+		arrowipc.Int64("id", id),
+		arrowipc.String("order_id", orderID),
+		arrowipc.String("client_order_id", clientOrderID),
+		arrowipc.Int64("strategy_id", strategyID),
+		arrowipc.Int64("strategy_version", strategyVersion),
+		arrowipc.String("symbol", symbol),
+		arrowipc.String("side", side),
+		arrowipc.Float64("qty", qty),
+		arrowipc.String("order_type", orderType),
+		arrowipc.String("time_in_force", tif),
+		arrowipc.Bool("extended_hours", extendedHours),
+		arrowipc.Float64("limit_price", limitPrice),
+		arrowipc.Float64("stop_price", stopPrice),
+		arrowipc.Float64("filled_qty", filledQty),
+		arrowipc.Float64("filled_avg_price", filledAvgPrice),
+		arrowipc.String("order_status", status),
+		arrowipc.Timestamp("submitted_at", submittedAt),
+		arrowipc.Timestamp("filled_at", filledAt),
+		arrowipc.String("session", session),
+		arrowipc.String("venue", venue),
+		arrowipc.String("hedge_rule", hedgeRule),
+		arrowipc.String("source", source),
+		arrowipc.String("error_message", errorMessage),
+		arrowipc.Timestamp("received_at", receivedAt),
+		arrowipc.Timestamp("sent_at", sentAt),
+		arrowipc.Timestamp("acked_at", ackedAt),
+	}
+}
+
+// markColumns lays persisted position marks out as Arrow columns
+func markColumns(marks []database.PositionMark) []arrowipc.Column {
+	n := len(marks)
+	markedAt := make([]*time.Time, n)
+	strategyID := make([]*int64, n)
+	symbol := make([]*string, n)
+	qty, avgCost, price, marketValue, unrealizedPL := make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n)
+	for i := range marks {
+		m := &marks[i]
+		markedAt[i], strategyID[i], symbol[i] = &m.MarkedAt, &m.StrategyID, &m.Symbol
+		qty[i], avgCost[i], price[i] = decimalFloat(&m.Qty), decimalFloat(&m.AvgCost), decimalFloat(&m.Price)
+		marketValue[i], unrealizedPL[i] = decimalFloat(&m.MarketValue), decimalFloat(&m.UnrealizedPL)
+	}
+	return []arrowipc.Column{
+		arrowipc.Timestamp("marked_at", markedAt),
+		arrowipc.Int64("strategy_id", strategyID),
+		arrowipc.String("symbol", symbol),
+		arrowipc.Float64("qty", qty),
+		arrowipc.Float64("avg_cost", avgCost),
+		arrowipc.Float64("price", price),
+		arrowipc.Float64("market_value", marketValue),
+		arrowipc.Float64("unrealized_pl", unrealizedPL),
+	}
+}
+
+// barColumns lays bars out as Arrow columns
+func barColumns(bars []marketdata.Bar) []arrowipc.Column {
+	n := len(bars)
+	ts := make([]*time.Time, n)
+	open, high, low, closes, vwap := make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n)
+	volume, tradeCount := make([]*int64, n), make([]*int64, n)
+	for i := range bars {
+		b := &bars[i]
+		v, c := int64(b.Volume), int64(b.TradeCount)
+		ts[i], volume[i], tradeCount[i] = &b.Timestamp, &v, &c
+		open[i], high[i], low[i], closes[i], vwap[i] = &b.Open, &b.High, &b.Low, &b.Close, &b.VWAP
+	}
+	return []arrowipc.Column{
+		arrowipc.Timestamp("timestamp", ts),
+		arrowipc.Float64("open", open),
+		arrowipc.Float64("high", high),
+		arrowipc.Float64("low", low),
+		arrowipc.Float64("close", closes),
+		arrowipc.Int64("volume", volume),
+		arrowipc.Int64("trade_count", tradeCount),
+		arrowipc.Float64("vwap", vwap),
+	}
+}
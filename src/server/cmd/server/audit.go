@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"desk/internal/audit"
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// auditExport writes the lifecycle of every order submitted in the sessions
+// from to to as an audit CSV, returning the number of events written
+func auditExport(db *database.DB, w io.Writer, from, to string) (int, error) {
+	start, end, err := sessionRange(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	trades, err := db.GetTradesSubmittedBetween(start, end)
+	if err != nil {
+		return 0, err
+	}
+	events, err := db.GetOrderEventsSubmittedBetween(start, end)
+	if err != nil {
+		return 0, err
+	}
+	return audit.Export(w, trades, events)
+}
+
+// sessionRange turns inclusive session dates into the times from the start
+// of the first to the end of the last in exchange time. from defaults to
+// the first trade and to to today.
+func sessionRange(from, to string) (time.Time, time.Time, error) {
+	start := time.Unix(0, 0)
+	if from != "" {
+		d, err := time.ParseInLocation("2006-01-02", from, market.Exchange)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid date %q", errBadExportRange, from)
+		}
+		start = d
+	}
+	if to == "" {
+		to = market.SessionDate(time.Now())
+	}
+	d, err := time.ParseInLocation("2006-01-02", to, market.Exchange)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: invalid date %q", errBadExportRange, to)
+	}
+	return start, d.AddDate(0, 0, 1), nil
+}
+
+// runExportAudit writes an order audit export without starting the server:
+// export-audit [-from DATE] [-to DATE] [-o FILE]. It returns the process
+// exit code.
+func runExportAudit(args []string) int {
+	flags := flag.NewFlagSet("export-audit", flag.ContinueOnError)
+	from := flags.String("from", "", "first session date, YYYY-MM-DD (default: the first trade)")
+	to := flags.String("to", "", "last session date, YYYY-MM-DD (default: today)")
+	path := flags.String("o", "", "file to write the CSV export to (default: stdout)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Keep stdout for the export
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./trading_desk.db"
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	out := io.Writer(os.Stdout)
+	if *path != "" {
+		f, err := os.Create(*path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *path, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	n, err := auditExport(db, out, *from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export order audit: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d order events\n", n)
+	return 0
+}
+
+// exportAudit runs an audit export for the request's from and to query
+// parameters into a buffer. It writes the error response if it fails.
+func (app *Application) exportAudit(w http.ResponseWriter, r *http.Request) (*bytes.Buffer, int, bool) {
+	query := r.URL.Query()
+
+	var buf bytes.Buffer
+	n, err := auditExport(app.db, &buf, query.Get("from"), query.Get("to"))
+	if errors.Is(err, errBadExportRange) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	if err != nil {
+		log.Printf("Failed to export order audit: %v", err)
+		http.Error(w, "Failed to export order audit: "+err.Error(), http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return &buf, n, true
+}
+
+// handleAuditExport serves the order audit export as CSV on the admin port.
+// Query parameters: from and to (session dates, YYYY-MM-DD).
+func (app *Application) handleAuditExport(w http.ResponseWriter, r *http.Request) {
+	buf, n, ok := app.exportAudit(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Exported %d order events for audit", n)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="order-audit.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+type storedAudit struct {
+	Key    string `json:"key"`
+	Events int    `json:"events"`
+}
+
+// handleStoreAuditExport writes the order audit export to the object store
+// under exports/audit/ rather than returning it
+func (app *Application) handleStoreAuditExport(w http.ResponseWriter, r *http.Request) {
+	buf, n, ok := app.exportAudit(w, r)
+	if !ok {
+		return
+	}
+
+	key := "exports/audit/orders-" + time.Now().UTC().Format("20060102T150405Z") + ".csv"
+	if err := app.store.Put(r.Context(), key, buf.Bytes()); err != nil {
+		log.Printf("Failed to store order audit export: %v", err)
+		http.Error(w, "Failed to store export: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Stored %d order events for audit at %s", n, key)
+	writeJSON(w, http.StatusCreated, storedAudit{Key: key, Events: n})
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"desk/internal/backtest"
+	"desk/internal/database"
+)
+
+// maxComparedRuns caps how many runs one comparison takes
+const maxComparedRuns = 10
+
+// backtestDiff is what changed from one stored run to another
+type backtestDiff struct {
+	From database.BacktestRun `json:"from"`
+	To   database.BacktestRun `json:"to"`
+	// SameConfig is true when both runs have the same config hash, so only
+	// their dates (or the data behind them) differ
+	SameConfig bool `json:"same_config"`
+	SameData   bool `json:"same_data"`
+	// Params and Config list each changed value as [from, to]; nested
+	// settings are named with dots, e.g. walk_forward.in_sample
+	Params  map[string][2]any      `json:"params"`
+	Config  map[string][2]any      `json:"config"`
+	Metrics []backtest.MetricDelta `json:"metrics"`
+}
+
+// backtestComparison sets several stored runs side by side
+type backtestComparison struct {
+	Runs []database.BacktestRun `json:"runs"`
+	// Best is the ID of the run that did best on each metric with a better
+	// direction
+	Best map[string]int64 `json:"best"`
+	// Equity is each run's equity curve by run ID, over the closes every
+	// run traded and rebased to 1, empty if they share fewer than two
+	Equity map[string][]backtest.Point `json:"equity"`
+}
+
+// handleBacktestRuns lists the caller's stored backtest runs, newest first,
+// optionally only those of a ?strategy=, ?symbol= or ?config_hash=
+func (app *Application) handleBacktestRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, ok := queryInt(w, r, "limit", 100, 1, 1000)
+	if !ok {
+		return
+	}
+
+	runs, err := app.db.GetBacktestRuns(requestUserID(r), database.BacktestRunQuery{
+		Strategy:   query.Get("strategy"),
+		Symbol:     app.aliases.Resolve(query.Get("symbol")),
+		ConfigHash: query.Get("config_hash"),
+		Limit:      limit,
+	})
+	if err != nil {
+		log.Printf("Failed to list backtest runs: %v", err)
+		http.Error(w, "Failed to list backtest runs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleGetBacktestRun returns a stored run with its equity curve
+func (app *Application) handleGetBacktestRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := app.ownedBacktestRun(w, r, "id")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleDeleteBacktestRun deletes a stored run
+func (app *Application) handleDeleteBacktestRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := app.ownedBacktestRun(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := app.db.DeleteBacktestRun(run.ID); err != nil {
+		log.Printf("Failed to delete backtest run: %v", err)
+		http.Error(w, "Failed to delete backtest run", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDiffBacktestRuns reports what changed from run {id} to run {other}:
+// parameters, settings, dates and each metric
+func (app *Application) handleDiffBacktestRuns(w http.ResponseWriter, r *http.Request) {
+	from, ok := app.ownedBacktestRun(w, r, "id")
+	if !ok {
+		return
+	}
+	to, ok := app.ownedBacktestRun(w, r, "other")
+	if !ok {
+		return
+	}
+
+	var fromMetrics, toMetrics backtest.Metrics
+	if err := decodeRunMetrics(from, &fromMetrics); err != nil {
+		writeRunDecodeError(w, err)
+		return
+	}
+	if err := decodeRunMetrics(to, &toMetrics); err != nil {
+		writeRunDecodeError(w, err)
+		return
+	}
+	params, err := diffJSON(from.Params, to.Params)
+	if err != nil {
+		writeRunDecodeError(w, err)
+		return
+	}
+	config, err := diffJSON(from.Config, to.Config)
+	if err != nil {
+		writeRunDecodeError(w, err)
+		return
+	}
+
+	from.Equity, from.Detail, to.Equity, to.Detail = nil, nil, nil, nil
+	writeJSON(w, http.StatusOK, backtestDiff{
+		From:       *from,
+		To:         *to,
+		SameConfig: from.ConfigHash == to.ConfigHash,
+		SameData:   from.Symbol == to.Symbol && from.DataStart.Equal(to.DataStart) && from.DataEnd.Equal(to.DataEnd),
+		Params:     params,
+		Config:     config,
+		Metrics:    backtest.DiffMetrics(fromMetrics, toMetrics),
+	})
+}
+
+// handleCompareBacktestRuns sets the runs in ?ids= side by side with the
+// best on each metric and their equity curves on a common scale
+func (app *Application) handleCompareBacktestRuns(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	for _, v := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad request: invalid run ID "+v, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) < 2 || len(ids) > maxComparedRuns {
+		http.Error(w, fmt.Sprintf("Bad request: ids must list between 2 and %d runs", maxComparedRuns), http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	resp := backtestComparison{Runs: make([]database.BacktestRun, len(ids)), Best: make(map[string]int64), Equity: make(map[string][]backtest.Point)}
+	metrics := make([]backtest.Metrics, len(ids))
+	curves := make([][]backtest.Point, len(ids))
+	for i, id := range ids {
+		run, err := app.db.GetBacktestRun(id)
+		if err != nil || run.UserID != userID {
+			http.Error(w, fmt.Sprintf("Backtest run %d not found", id), http.StatusNotFound)
+			return
+		}
+		if err := decodeRunMetrics(run, &metrics[i]); err != nil {
+			writeRunDecodeError(w, err)
+			return
+		}
+		if err := json.Unmarshal(run.Equity, &curves[i]); err != nil {
+			writeRunDecodeError(w, fmt.Errorf("run %d equity: %w", run.ID, err))
+			return
+		}
+		run.Equity, run.Detail = nil, nil
+		resp.Runs[i] = *run
+	}
+
+	for metric, i := range backtest.Best(metrics) {
+		resp.Best[metric] = ids[i]
+	}
+	for i, curve := range backtest.Rebase(curves) {
+		resp.Equity[strconv.FormatInt(ids[i], 10)] = curve
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleBacktestSweeps lists the caller's stored sweeps, newest first,
+// without their reports
+func (app *Application) handleBacktestSweeps(w http.ResponseWriter, r *http.Request) {
+	limit, ok := queryInt(w, r, "limit", 100, 1, 1000)
+	if !ok {
+		return
+	}
+	sweeps, err := app.db.GetBacktestSweeps(requestUserID(r), limit)
+	if err != nil {
+		log.Printf("Failed to list backtest sweeps: %v", err)
+		http.Error(w, "Failed to list backtest sweeps", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, sweeps)
+}
+
+// handleGetBacktestSweep returns a stored sweep with its report
+func (app *Application) handleGetBacktestSweep(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid sweep ID", http.StatusBadRequest)
+		return
+	}
+	sweep, err := app.db.GetBacktestSweep(id)
+	if err != nil || sweep.UserID != requestUserID(r) {
+		http.Error(w, "Sweep not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, sweep)
+}
+
+// ownedBacktestRun loads the run in the named path parameter if it is the
+// caller's, writing an error response if it isn't
+func (app *Application) ownedBacktestRun(w http.ResponseWriter, r *http.Request, name string) (*database.BacktestRun, bool) {
+	id, ok := pathID(r, name)
+	if !ok {
+		http.Error(w, "Bad request: invalid backtest run ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	run, err := app.db.GetBacktestRun(id)
+	if err != nil || run.UserID != requestUserID(r) {
+		http.Error(w, "Backtest run not found", http.StatusNotFound)
+		return nil, false
+	}
+	return run, true
+}
+
+func decodeRunMetrics(run *database.BacktestRun, m *backtest.Metrics) error {
+	if err := json.Unmarshal(run.Metrics, m); err != nil {
+		return fmt.Errorf("run %d metrics: %w", run.ID, err)
+	}
+	return nil
+}
+
+func writeRunDecodeError(w http.ResponseWriter, err error) {
+	log.Printf("Failed to decode stored backtest run: %v", err)
+	http.Error(w, "Failed to read backtest run", http.StatusInternalServerError)
+}
+
+// diffJSON returns the values that differ between two JSON objects, nested
+// objects flattened into dotted names; a value only one side has is null on
+// the other
+func diffJSON(a, b json.RawMessage) (map[string][2]any, error) {
+	flatA, flatB := make(map[string]any), make(map[string]any)
+	for _, side := range []struct {
+		raw  json.RawMessage
+		flat map[string]any
+	}{{a, flatA}, {b, flatB}} {
+		var v map[string]any
+		if err := json.Unmarshal(side.raw, &v); err != nil {
+			return nil, err
+		}
+		flatten("", v, side.flat)
+	}
+
+	out := make(map[string][2]any)
+	for name, va := range flatA {
+		if vb, ok := flatB[name]; !ok || !reflect.DeepEqual(va, vb) {
+			out[name] = [2]any{va, flatB[name]}
+		}
+	}
+	for name, vb := range flatB {
+		if _, ok := flatA[name]; !ok {
+			out[name] = [2]any{nil, vb}
+		}
+	}
+	return out, nil
+}
+
+func flatten(prefix string, v map[string]any, out map[string]any) {
+	for name, value := range v {
+		if nested, ok := value.(map[string]any); ok {
+			flatten(prefix+name+".", nested, out)
+			continue
+		}
+		out[prefix+name] = value
+	}
+}
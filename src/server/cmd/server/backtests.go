@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+
+	"desk/internal/backtest"
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+const (
+	// defaultBacktestYears is how far back a backtest starts if it isn't
+	// given a start date
+	defaultBacktestYears = 5
+	defaultCapital       = 100000
+	maxCostBps           = 1000
+)
+
+// backtestRequest runs a built-in strategy on a symbol's daily bars between
+// two dates
+type backtestRequest struct {
+	Symbol   string          `json:"symbol"`
+	Strategy string          `json:"strategy"`
+	Params   backtest.Params `json:"params"`
+	// Start and End are session dates, YYYY-MM-DD
+	Start   string   `json:"start"`
+	End     string   `json:"end"`
+	Capital *float64 `json:"capital"`
+	CostBps float64  `json:"cost_bps"`
+	// Fill works orders through the bars' volume instead of filling them
+	// at the close
+	Fill *backtest.FillModel `json:"fill"`
+	// Note is stored with the run, e.g. what changed since the last one
+	Note string `json:"note"`
+}
+
+type backtestResponse struct {
+	// RunID is the stored run, left out if it couldn't be stored
+	RunID      int64  `json:"run_id,omitempty"`
+	ConfigHash string `json:"config_hash"`
+	*backtest.Result
+}
+
+type walkForwardResponse struct {
+	RunID      int64  `json:"run_id,omitempty"`
+	ConfigHash string `json:"config_hash"`
+	*backtest.WalkForwardReport
+}
+
+// walkForwardSettings are what a walk-forward run is stored as having run
+// with besides its fixed parameters
+type walkForwardSettings struct {
+	backtest.Config
+	WalkForward backtest.WalkForwardConfig `json:"walk_forward"`
+}
+
+// walkForwardDetail is what a stored walk-forward run keeps besides its
+// out-of-sample metrics and equity curve
+type walkForwardDetail struct {
+	Candidates   int               `json:"candidates"`
+	Windows      []backtest.Window `json:"windows"`
+	Efficiency   *float64          `json:"efficiency,omitempty"`
+	ParamChanges int               `json:"param_changes"`
+}
+
+// walkForwardRequest runs a walk-forward evaluation; Params are held fixed
+// and Grid is fit in every in-sample window
+type walkForwardRequest struct {
+	backtestRequest
+	InSampleDays    int                  `json:"in_sample_days"`
+	OutOfSampleDays int                  `json:"out_of_sample_days"`
+	Anchored        bool                 `json:"anchored"`
+	Objective       string               `json:"objective"`
+	Grid            map[string][]float64 `json:"grid"`
+}
+
+// sweepRequest backtests every combination of Grid's values; Params are
+// held fixed
+type sweepRequest struct {
+	backtestRequest
+	Grid      map[string][]float64 `json:"grid"`
+	Objective string               `json:"objective"`
+	// Workers defaults to, and may not exceed, BACKTEST_WORKERS
+	Workers int `json:"workers"`
+	Top     int `json:"top"`
+}
+
+type sweepResponse struct {
+	// SweepID is the stored sweep, left out if it couldn't be stored
+	SweepID int64 `json:"sweep_id,omitempty"`
+	*backtest.SweepReport
+}
+
+// handleBacktestStrategies lists the built-in strategies and their
+// parameters
+func (app *Application) handleBacktestStrategies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, backtest.Strategies())
+}
+
+// handleBacktest runs one backtest
+func (app *Application) handleBacktest(w http.ResponseWriter, r *http.Request) {
+	var req backtestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	strategy, cfg, bars, ok := app.backtestInputs(w, &req)
+	if !ok {
+		return
+	}
+
+	result, err := backtest.Run(req.Symbol, bars, strategy, req.Params, cfg)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := backtestResponse{
+		ConfigHash: backtest.ConfigHash(database.BacktestSingle, result.Strategy, result.Symbol, result.Params, cfg),
+		Result:     result,
+	}
+	resp.RunID = app.saveBacktestRun(&database.BacktestRun{
+		UserID:     requestUserID(r),
+		Kind:       database.BacktestSingle,
+		Strategy:   result.Strategy,
+		Symbol:     result.Symbol,
+		ConfigHash: resp.ConfigHash,
+		DataStart:  result.Metrics.Start,
+		DataEnd:    result.Metrics.End,
+		Note:       req.Note,
+	}, result.Params, cfg, result.Metrics, result.Equity, nil)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleWalkForward fits a strategy's parameters over rolling in-sample
+// windows and reports how each fit did on the window after it
+func (app *Application) handleWalkForward(w http.ResponseWriter, r *http.Request) {
+	var req walkForwardRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.InSampleDays == 0 {
+		req.InSampleDays = 252
+	}
+	if req.OutOfSampleDays == 0 {
+		req.OutOfSampleDays = 63
+	}
+	if len(req.Grid) == 0 {
+		http.Error(w, "Bad request: grid is required", http.StatusBadRequest)
+		return
+	}
+	strategy, cfg, bars, ok := app.backtestInputs(w, &req.backtestRequest)
+	if !ok {
+		return
+	}
+
+	report, err := backtest.WalkForward(req.Symbol, bars, strategy, req.Params, backtest.WalkForwardConfig{
+		InSample:    req.InSampleDays,
+		OutOfSample: req.OutOfSampleDays,
+		Anchored:    req.Anchored,
+		Objective:   req.Objective,
+		Grid:        req.Grid,
+	}, cfg)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings := walkForwardSettings{Config: cfg, WalkForward: report.WalkForward}
+	resp := walkForwardResponse{
+		ConfigHash:        backtest.ConfigHash(database.BacktestWalkForward, report.Strategy, report.Symbol, req.Params, settings),
+		WalkForwardReport: report,
+	}
+	resp.RunID = app.saveBacktestRun(&database.BacktestRun{
+		UserID:     requestUserID(r),
+		Kind:       database.BacktestWalkForward,
+		Strategy:   report.Strategy,
+		Symbol:     report.Symbol,
+		ConfigHash: resp.ConfigHash,
+		DataStart:  report.OutOfSample.Start,
+		DataEnd:    report.OutOfSample.End,
+		Note:       req.Note,
+	}, req.Params, settings, report.OutOfSample, report.Equity, walkForwardDetail{
+		Candidates:   report.Candidates,
+		Windows:      report.Windows,
+		Efficiency:   report.Efficiency,
+		ParamChanges: report.ParamChanges,
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleSweep backtests a strategy over a grid of parameters, storing each
+// configuration as a run and the ranking as a sweep
+func (app *Application) handleSweep(w http.ResponseWriter, r *http.Request) {
+	var req sweepRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Workers == 0 {
+		req.Workers = app.backtestWorkers
+	}
+	if req.Workers < 1 || req.Workers > app.backtestWorkers {
+		http.Error(w, fmt.Sprintf("Bad request: workers must be between 1 and %d", app.backtestWorkers), http.StatusBadRequest)
+		return
+	}
+	if req.Top < 0 {
+		http.Error(w, "Bad request: top must not be negative", http.StatusBadRequest)
+		return
+	}
+	if len(req.Grid) == 0 {
+		http.Error(w, "Bad request: grid is required", http.StatusBadRequest)
+		return
+	}
+	strategy, cfg, bars, ok := app.backtestInputs(w, &req.backtestRequest)
+	if !ok {
+		return
+	}
+
+	report, err := backtest.Sweep(r.Context(), req.Symbol, bars, strategy, req.Params, backtest.SweepConfig{
+		Grid:      req.Grid,
+		Objective: req.Objective,
+		Workers:   req.Workers,
+		Top:       req.Top,
+	}, cfg)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Best shares its runs with Runs, so their IDs show in both
+	userID := requestUserID(r)
+	for i := range report.Runs {
+		run := &report.Runs[i]
+		result := run.Result
+		run.RunID = app.saveBacktestRun(&database.BacktestRun{
+			UserID:     userID,
+			Kind:       database.BacktestSingle,
+			Strategy:   result.Strategy,
+			Symbol:     result.Symbol,
+			ConfigHash: backtest.ConfigHash(database.BacktestSingle, result.Strategy, result.Symbol, result.Params, cfg),
+			DataStart:  result.Metrics.Start,
+			DataEnd:    result.Metrics.End,
+			Note:       req.Note,
+		}, result.Params, cfg, result.Metrics, result.Equity, nil)
+	}
+
+	resp := sweepResponse{SweepReport: report}
+	if b, err := json.Marshal(report); err != nil {
+		log.Printf("Failed to encode backtest sweep: %v", err)
+	} else if resp.SweepID, err = app.db.CreateBacktestSweep(&database.BacktestSweep{
+		UserID:   userID,
+		Strategy: report.Strategy,
+		Symbol:   report.Symbol,
+		Runs:     len(report.Runs),
+		Report:   b,
+	}); err != nil {
+		log.Printf("Failed to store backtest sweep: %v", err)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// saveBacktestRun stores a run with its parameters, settings, metrics,
+// equity curve and detail (nil for none) encoded, and returns its ID. A run
+// that can't be stored is logged and still returned to the caller, with no
+// ID.
+func (app *Application) saveBacktestRun(run *database.BacktestRun, params backtest.Params, settings, metrics, equity, detail any) int64 {
+	var err error
+	for _, field := range []struct {
+		dst *json.RawMessage
+		v   any
+	}{{&run.Params, params}, {&run.Config, settings}, {&run.Metrics, metrics}, {&run.Equity, equity}, {&run.Detail, detail}} {
+		if field.v == nil {
+			continue
+		}
+		if *field.dst, err = json.Marshal(field.v); err != nil {
+			log.Printf("Failed to encode backtest run: %v", err)
+			return 0
+		}
+	}
+	id, err := app.db.CreateBacktestRun(run)
+	if err != nil {
+		log.Printf("Failed to store backtest run: %v", err)
+		return 0
+	}
+	return id
+}
+
+// backtestInputs validates the common fields of a backtest request and
+// loads its bars from the backtest market data provider, writing an error
+// response if it can't
+func (app *Application) backtestInputs(w http.ResponseWriter, req *backtestRequest) (backtest.Strategy, backtest.Config, []marketdata.Bar, bool) {
+	var cfg backtest.Config
+	strategy, ok := backtest.Lookup(req.Strategy)
+	if !ok {
+		http.Error(w, "Bad request: unknown strategy "+req.Strategy, http.StatusBadRequest)
+		return strategy, cfg, nil, false
+	}
+	req.Symbol = app.aliases.Resolve(req.Symbol)
+	if req.Symbol == "" {
+		http.Error(w, "Bad request: symbol is required", http.StatusBadRequest)
+		return strategy, cfg, nil, false
+	}
+	if req.Params == nil {
+		req.Params = backtest.Params{}
+	}
+
+	cfg.Capital, cfg.CostBps = defaultCapital, req.CostBps
+	if req.Capital != nil {
+		cfg.Capital = *req.Capital
+	}
+	if cfg.Capital <= 0 {
+		http.Error(w, "Bad request: capital must be positive", http.StatusBadRequest)
+		return strategy, cfg, nil, false
+	}
+	if cfg.CostBps < 0 || cfg.CostBps > maxCostBps {
+		http.Error(w, "Bad request: cost_bps must be between 0 and 1000", http.StatusBadRequest)
+		return strategy, cfg, nil, false
+	}
+	if req.Fill != nil {
+		fill, err := req.Fill.Resolve()
+		if err != nil {
+			http.Error(w, "Bad request: fill: "+err.Error(), http.StatusBadRequest)
+			return strategy, cfg, nil, false
+		}
+		cfg.Fill = &fill
+	}
+
+	end := time.Now()
+	start := end.AddDate(-defaultBacktestYears, 0, 0)
+	for _, d := range []struct {
+		value string
+		t     *time.Time
+	}{{req.Start, &start}, {req.End, &end}} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseInLocation("2006-01-02", d.value, market.Exchange)
+		if err != nil {
+			http.Error(w, "Bad request: dates must be YYYY-MM-DD", http.StatusBadRequest)
+			return strategy, cfg, nil, false
+		}
+		*d.t = parsed
+	}
+	if !start.Before(end) {
+		http.Error(w, "Bad request: start must be before end", http.StatusBadRequest)
+		return strategy, cfg, nil, false
+	}
+
+	bars, err := app.marketData.Backtest.Bars(req.Symbol, "1Day", start, end, maxBarLimit)
+	if err != nil {
+		log.Printf("Failed to get bars for backtest of %s: %v", req.Symbol, err)
+		http.Error(w, "Failed to get bars", http.StatusBadGateway)
+		return strategy, cfg, nil, false
+	}
+	return strategy, cfg, bars, true
+}
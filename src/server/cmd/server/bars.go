@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"desk/internal/market"
+	"desk/internal/mktdata"
+)
+
+const (
+	defaultBarLimit = 10000
+	maxBarLimit     = 100000
+)
+
+// bar is one OHLCV bar in a JSON response
+type bar struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Volume     uint64    `json:"volume"`
+	TradeCount uint64    `json:"trade_count"`
+	VWAP       float64   `json:"vwap"`
+}
+
+// handleBars returns historical bars of a symbol, as JSON or, for notebooks,
+// as an Arrow IPC stream. Query parameters: timeframe (1Min, 1Hour or 1Day,
+// the default), start (default 30 days ago), end (default now) and limit.
+func (app *Application) handleBars(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	symbol := app.aliases.Resolve(r.PathValue("symbol"))
+
+	timeframe := query.Get("timeframe")
+	if timeframe == "" {
+		timeframe = "1Day"
+	}
+	if !mktdata.SupportedTimeframe(timeframe) {
+		http.Error(w, "Bad request: timeframe must be 1Min, 1Hour or 1Day", http.StatusBadRequest)
+		return
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -30)
+	for name, t := range map[string]*time.Time{"start": &start, "end": &end} {
+		if v := query.Get(name); v != "" {
+			parsed, err := market.ParseTime(v)
+			if err != nil {
+				http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	limit := defaultBarLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxBarLimit)
+	}
+
+	bars, err := app.marketData.Backtest.Bars(symbol, timeframe, start, end, limit)
+	if err != nil {
+		log.Printf("Failed to get bars for %s: %v", symbol, err)
+		http.Error(w, "Failed to get bars", http.StatusBadGateway)
+		return
+	}
+
+	if wantsArrow(r) {
+		writeArrow(w, barColumns(bars)...)
+		return
+	}
+	resp := make([]bar, len(bars))
+	for i, b := range bars {
+		resp[i] = bar{
+			Timestamp:  b.Timestamp,
+			Open:       b.Open,
+			High:       b.High,
+			Low:        b.Low,
+			Close:      b.Close,
+			Volume:     b.Volume,
+			TradeCount: b.TradeCount,
+			VWAP:       b.VWAP,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"desk/internal/database"
+	"desk/internal/orders"
+	"desk/internal/symbols"
+	"desk/internal/tenants"
+)
+
+const (
+	defaultBlotterRows = 100
+	maxBlotterRows     = 500
+)
+
+// blotterSnapshot replaces the client's blotter with the latest rows
+// matching its filter, newest first. Seq is the last update it includes.
+type blotterSnapshot struct {
+	Type   string                 `json:"type"`
+	Seq    uint64                 `json:"seq"`
+	Filter database.BlotterFilter `json:"filter"`
+	Trades []json.RawMessage      `json:"trades"`
+}
+
+// blotterTrade is a new or updated row, which replaces any row with its ID
+type blotterTrade struct {
+	Type  string          `json:"type"`
+	Seq   uint64          `json:"seq"`
+	Trade json.RawMessage `json:"trade"`
+}
+
+// blotterError answers a filter the client can't use
+type blotterError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// blotterRow encodes a trade as GET /trades does with Accept:
+// application/json
+func blotterRow(t database.Trade) (json.RawMessage, error) {
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(tradeRecord(t))
+}
+
+// blotterScope resolves a filter's user: the caller's trades by default,
+// "*" for every user's, or a named user's. Only the host chapter may look
+// beyond the caller's own trades.
+func blotterScope(r *http.Request, f database.BlotterFilter) (database.BlotterFilter, error) {
+	caller := requestUserID(r)
+	switch f.UserID {
+	case "":
+		f.UserID = caller
+	case "*":
+		f.UserID = ""
+	default:
+		f.UserID = qualifyUserID(tenants.FromContext(r.Context()), f.UserID)
+	}
+	if f.UserID != caller && !requestHost(r) {
+		return f, errors.New("only the host chapter may watch other users' trades")
+	}
+	if f.Source != "" && !orders.ValidSource(f.Source) {
+		return f, fmt.Errorf("unknown source %q", f.Source)
+	}
+	f.Symbol = symbols.Normalize(f.Symbol)
+	return f, nil
+}
+
+// handleBlotterStream streams the trade blotter over a websocket: a
+// snapshot of the latest rows matching the filter, then every new trade and
+// status change that matches as it happens. The filter comes from the user,
+// strategy_id, symbol and source query parameters; the client can replace it
+// by sending a filter as JSON, and gets a new snapshot. A client that falls
+// behind is sent a fresh snapshot instead of the updates it missed.
+func (app *Application) handleBlotterStream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.BlotterFilter{UserID: query.Get("user"), Symbol: query.Get("symbol"), Source: query.Get("source")}
+	if filter.Source != "" && !orders.ValidSource(filter.Source) {
+		http.Error(w, "Bad request: source must be one of "+strings.Join(orders.Sources(), ", "), http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("strategy_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad request: invalid strategy_id", http.StatusBadRequest)
+			return
+		}
+		filter.StrategyID = &id
+	}
+	limit := defaultBlotterRows
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxBlotterRows {
+			http.Error(w, fmt.Sprintf("Bad request: limit must be between 1 and %d", maxBlotterRows), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	filter, err := blotterScope(r, filter)
+	if err != nil {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	conn, ok := app.sockets.accept(w, r, "blotter")
+	if !ok {
+		return
+	}
+	defer conn.close()
+
+	// Read filters until the client goes away, which ends the stream
+	filters := make(chan database.BlotterFilter)
+	go func() {
+		defer conn.cancel()
+		for {
+			var f database.BlotterFilter
+			if err := conn.readJSON(&f); err != nil {
+				return
+			}
+			select {
+			case filters <- f:
+			case <-conn.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := conn.writeJSON
+	snapshot := func(seq uint64) error {
+		trades, err := app.db.GetBlotterTrades(filter, limit)
+		if err != nil {
+			return err
+		}
+		msg := blotterSnapshot{Type: "snapshot", Seq: seq, Filter: filter, Trades: make([]json.RawMessage, 0, len(trades))}
+		for _, t := range trades {
+			row, err := blotterRow(t)
+			if err != nil {
+				return err
+			}
+			msg.Trades = append(msg.Trades, row)
+		}
+		return send(msg)
+	}
+
+	updates, last, unsubscribe := app.blotter.Subscribe()
+	defer unsubscribe()
+	if err := snapshot(last); err != nil {
+		log.Printf("Failed to send blotter snapshot: %v", err)
+		return
+	}
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+
+		case f := <-filters:
+			next, err := blotterScope(r, f)
+			switch {
+			case err != nil:
+				err = send(blotterError{Type: "error", Error: err.Error()})
+			case !conn.resubscribe():
+				// The filter in force stays in force
+				err = send(blotterError{Type: "error", Error: fmt.Sprintf("too many filter changes: at most %d a minute", app.sockets.config.MaxResubscribes)})
+			default:
+				filter = next
+				err = snapshot(last)
+			}
+			if err != nil {
+				return
+			}
+
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			if u.Seq != last+1 {
+				// Updates were dropped; the snapshot has them all
+				last = u.Seq
+				if err := snapshot(last); err != nil {
+					return
+				}
+				continue
+			}
+			last = u.Seq
+			if !filter.Matches(u.Trade) {
+				continue
+			}
+			row, err := blotterRow(u.Trade)
+			if err == nil {
+				err = send(blotterTrade{Type: "trade", Seq: u.Seq, Trade: row})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// handleEarningsCalendar returns upcoming earnings reports. Query parameters:
+// from and to (YYYY-MM-DD exchange dates, inclusive; default today through
+// the next 7 days) and symbols (comma-separated; default all) or watchlist
+// (a watchlist ID).
+func (app *Application) handleEarningsCalendar(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	now := time.Now()
+	from := query.Get("from")
+	if from == "" {
+		from = market.SessionDate(now)
+	}
+	to := query.Get("to")
+	if to == "" {
+		to = market.SessionDate(now.AddDate(0, 0, 7))
+	}
+	start, err := time.ParseInLocation("2006-01-02", from, market.Exchange)
+	if err != nil {
+		http.Error(w, "Bad request: dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, market.Exchange)
+	if err != nil {
+		http.Error(w, "Bad request: dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	symbols, ok := app.requestSymbols(w, r)
+	if !ok {
+		return
+	}
+
+	// to is inclusive, so include every report on that day
+	events, err := app.db.GetEarningsEvents(start, end.AddDate(0, 0, 1).Add(-time.Nanosecond), symbols)
+	if err != nil {
+		log.Printf("Failed to load earnings calendar: %v", err)
+		http.Error(w, "Failed to load earnings calendar", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []database.EarningsEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"desk/internal/capture"
+	orderprotos "desk/internal/protos/orders"
+)
+
+// captureFailure records the request of an order that failed as a rejected
+// trade, when order capture is on
+func (app *Application) captureFailure(req capture.Request, userID string, err error) {
+	tradeID, ok := rejectedTradeID(err)
+	if !ok || !app.captures.Enabled() {
+		return
+	}
+	app.captures.Record(tradeID, userID, req, err)
+}
+
+// requestCapture describes an API request for capture, with body as its
+// JSON payload
+func requestCapture(r *http.Request, body []byte) capture.Request {
+	return capture.Request{Method: r.Method, Path: r.URL.RequestURI(), Header: r.Header, Body: body}
+}
+
+// jsonBody encodes v as a captured request body
+func jsonBody(v any) []byte {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode captured request: %v", err)
+	}
+	return body
+}
+
+// orderRequestJSON returns an order request body as JSON, converting binary
+// protobuf to its JSON mapping
+func orderRequestJSON(r *http.Request, body []byte) []byte {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return body
+	}
+	var req orderprotos.OrderRequest
+	if err := unmarshalProto(r, body, &req); err != nil {
+		return body
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(&req)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// handleGetOrderCapture returns the captured request and broker response of
+// one of the caller's failed orders, by trade ID
+func (app *Application) handleGetOrderCapture(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid trade ID", http.StatusBadRequest)
+		return
+	}
+
+	c, err := app.db.GetOrderCapture(id, time.Now())
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && c.UserID != requestUserID(r)) {
+		http.Error(w, "No capture for this trade", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load order capture: %v", err)
+		http.Error(w, "Failed to load order capture", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
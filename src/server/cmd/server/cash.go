@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"desk/internal/capture"
+	"desk/internal/cashsweep"
+	"desk/internal/checklist"
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/orders"
+)
+
+// errNoCashRules is returned when sweeping without cash rules
+var errNoCashRules = errors.New("no cash rules are set")
+
+// cashChecklist applies the cash rules lead before every close
+func (app *Application) cashChecklist(lead time.Duration) *checklist.Checklist {
+	return &checklist.Checklist{
+		Name:  "cash",
+		Title: "Cash sweep",
+		At: func(date string) (time.Time, error) {
+			closeAt, err := market.SessionClose(date)
+			return closeAt.Add(-lead), err
+		},
+		Steps: []checklist.Step{
+			{Name: "cash rules", Run: app.checkCash},
+		},
+	}
+}
+
+// cashSettings returns the cash rules and action in force
+func (app *Application) cashSettings() (cashsweep.Rules, string) {
+	app.cashMu.RLock()
+	defer app.cashMu.RUnlock()
+	return app.cashRules, app.cashAction
+}
+
+// planSweep applies rules to the desk account's cash, with the fund the
+// sweep book holds. Chapters trading in their own account aren't swept.
+func (app *Application) planSweep(rules cashsweep.Rules) (*cashsweep.Sweep, error) {
+	account, err := app.brokers.host.Account()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account: %w", err)
+	}
+	held, err := app.db.GetPositionQty(app.cashUser, 0, rules.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	// A missing price is reported on the sweep
+	price, err := app.marks.LatestPrice(rules.Symbol)
+	if err != nil {
+		log.Printf("Failed to price %s for the cash sweep: %v", rules.Symbol, err)
+	}
+	return cashsweep.Plan(rules, account.Cash, account.Equity, held, price), nil
+}
+
+// placeSweep places a due sweep as a market order of the sweep book,
+// recording the trade or why it wasn't placed on the sweep
+func (app *Application) placeSweep(sweep *cashsweep.Sweep) *database.Trade {
+	if !market.InSession(app.clock.Now()) {
+		sweep.Error = "sweeps are only placed in the regular session"
+		return nil
+	}
+	order := &orders.Order{
+		Symbol:      sweep.Symbol,
+		AssetClass:  orders.AssetClassEquity,
+		Side:        sweep.Side,
+		Type:        "market",
+		TimeInForce: "day",
+		Qty:         sweep.Qty,
+		Source:      orders.SourceSweep,
+	}
+	trade, _, err := app.submitOrder(app.cashUser, nil, order)
+	if err != nil {
+		app.captureFailure(capture.Request{Path: "(cash sweep)", Body: jsonBody(order)}, app.cashUser, err)
+		sweep.Error = "failed to place sweep: " + err.Error()
+		return nil
+	}
+	log.Printf("Placed cash sweep for %s: %s %s %s as order %s", sweep.Rule, sweep.Side, sweep.Qty, sweep.Symbol, trade.OrderID)
+	return trade
+}
+
+// sweep applies the cash rules and, when execute is set, places the sweep
+// they call for. It notifies a sweep proposed, placed or failed.
+func (app *Application) sweep(ctx context.Context, execute bool) (*cashsweep.Sweep, *database.Trade, error) {
+	rules, _ := app.cashSettings()
+	if !rules.Enabled() {
+		return nil, nil, errNoCashRules
+	}
+	sweep, err := app.planSweep(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sweep.Due() {
+		if sweep.Error != "" {
+			notify.Send(ctx, app.notifier, notify.LevelWarning, "Cash sweep not possible", sweep.Describe())
+		}
+		return sweep, nil, nil
+	}
+
+	if !execute {
+		notify.Send(ctx, app.notifier, notify.LevelInfo, "Cash sweep proposed", sweep.Describe())
+		return sweep, nil, nil
+	}
+	trade := app.placeSweep(sweep)
+	if trade == nil {
+		notify.Send(ctx, app.notifier, notify.LevelError, "Cash sweep not placed", sweep.Describe())
+		return sweep, nil, nil
+	}
+	notify.Send(ctx, app.notifier, notify.LevelInfo, "Cash sweep placed",
+		fmt.Sprintf("%s, placed as order %s", sweep.Describe(), trade.OrderID))
+	return sweep, trade, nil
+}
+
+// checkCash is the cash checklist's step. Under the propose action a sweep
+// is only notified; under execute it is placed, and failing to place it
+// fails the step.
+func (app *Application) checkCash(ctx context.Context, date string) (string, error) {
+	_, action := app.cashSettings()
+	sweep, trade, err := app.sweep(ctx, action == cashsweep.ActionExecute)
+	if errors.Is(err, errNoCashRules) {
+		return "", checklist.Skip("no cash rules are set")
+	}
+	if err != nil {
+		return "", err
+	}
+	if sweep.Due() && action == cashsweep.ActionExecute && trade == nil {
+		return "", errors.New(sweep.Describe())
+	}
+	summary := sweep.Describe()
+	if trade != nil {
+		summary += ", order " + trade.OrderID
+	} else if sweep.Due() {
+		summary += ", proposed"
+	}
+	return summary, nil
+}
+
+// cashResponse is the cash rules in force and what they call for now
+type cashResponse struct {
+	Rules  cashsweep.Rules  `json:"rules"`
+	Action string           `json:"action"`
+	User   string           `json:"user"`
+	Sweep  *cashsweep.Sweep `json:"sweep,omitempty"`
+	// OrderID and TradeID are set once a sweep is placed
+	OrderID string `json:"order_id,omitempty"`
+	TradeID int64  `json:"trade_id,omitempty"`
+}
+
+// handleCash returns the cash rules and the sweep they call for now,
+// without placing it
+func (app *Application) handleCash(w http.ResponseWriter, r *http.Request) {
+	rules, action := app.cashSettings()
+	resp := cashResponse{Rules: rules, Action: action, User: app.cashUser}
+	if rules.Enabled() {
+		sweep, err := app.planSweep(rules)
+		if err != nil {
+			log.Printf("Failed to apply cash rules: %v", err)
+			http.Error(w, "Failed to apply cash rules", http.StatusBadGateway)
+			return
+		}
+		resp.Sweep = sweep
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleExecuteSweep serves POST /admin/cash/sweep on the admin port: it
+// applies the cash rules now and places the sweep they call for, whatever
+// CASH_SWEEP_ACTION says
+func (app *Application) handleExecuteSweep(w http.ResponseWriter, r *http.Request) {
+	rules, action := app.cashSettings()
+	sweep, trade, err := app.sweep(r.Context(), true)
+	if errors.Is(err, errNoCashRules) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to apply cash rules: %v", err)
+		http.Error(w, "Failed to apply cash rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := cashResponse{Rules: rules, Action: action, User: app.cashUser, Sweep: sweep}
+	if trade != nil {
+		resp.OrderID, resp.TradeID = trade.OrderID, trade.ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"desk/internal/archive"
+	"desk/internal/checklist"
+	"desk/internal/market"
+	"desk/internal/risk"
+	"desk/internal/sweeper"
+	"desk/internal/tca"
+)
+
+// feedCheckSymbol is the symbol whose latest trade shows the data feed is up
+const feedCheckSymbol = "SPY"
+
+// feedMaxAge is how old the latest trade in feedCheckSymbol may be before the
+// open: long enough to span a holiday weekend
+const feedMaxAge = 4 * 24 * time.Hour
+
+// openChecklist checks, lead before every open, that the desk can trade:
+// the broker accepts its credentials, market data is flowing, its book
+// matches the broker's and the configured risk limits are the ones in force.
+// It then warms the quotes of up to warmupMax symbols active strategies are
+// likely to trade.
+func (app *Application) openChecklist(lead time.Duration, warmupMax int) *checklist.Checklist {
+	return &checklist.Checklist{
+		Name:  "open",
+		Title: "Pre-open checklist",
+		At: func(date string) (time.Time, error) {
+			open, err := market.SessionOpen(date)
+			return open.Add(-lead), err
+		},
+		Steps: []checklist.Step{
+			{Name: "credentials", Run: app.checkCredentials},
+			{Name: "data feed", Run: app.checkDataFeed},
+			{Name: "reconciliation", Run: app.checkReconciliation},
+			{Name: "risk limits", Run: app.checkRiskLimits},
+			{Name: "quote warm-up", Run: func(ctx context.Context, date string) (string, error) {
+				return app.rewarmQuotes(warmupMax)
+			}},
+		},
+	}
+}
+
+// closeChecklist settles the session delay after every close, in order:
+// the DAY order sweep records final fills and expiries, carry is charged on
+// the settled positions, the day's dividends are booked to the books holding
+// them, positions are marked at the close, and the reports, archive and
+// backup that read them follow
+func (app *Application) closeChecklist(delay time.Duration, days *sweeper.DaySweeper, archiver *archive.Archiver, backupDaily bool) *checklist.Checklist {
+	return &checklist.Checklist{
+		Name:  "close",
+		Title: "Post-close checklist",
+		At: func(date string) (time.Time, error) {
+			closeAt, err := market.SessionClose(date)
+			return closeAt.Add(delay), err
+		},
+		Steps: []checklist.Step{
+			{Name: "DAY order sweep", Run: func(ctx context.Context, date string) (string, error) {
+				result, err := days.Sweep(ctx, date)
+				if err != nil {
+					return "", err
+				}
+				summary := fmt.Sprintf("checked %d, updated %d, expired %d, still open %d",
+					result.Checked, result.Updated, result.Expired, result.StillOpen)
+				if result.Failed > 0 {
+					return "", fmt.Errorf("%s; %d could not be reconciled", summary, result.Failed)
+				}
+				return summary, nil
+			}},
+			{Name: "carry accrual", Run: func(ctx context.Context, date string) (string, error) {
+				result, err := app.carry.Accrue(ctx, date)
+				if err != nil {
+					return "", err
+				}
+				summary := fmt.Sprintf("%d books, borrow fees %s, margin interest %s",
+					result.Books, result.BorrowFees.StringFixed(2), result.MarginInterest.StringFixed(2))
+				if result.Failed > 0 {
+					return "", fmt.Errorf("%s; %d books failed", summary, result.Failed)
+				}
+				return summary, nil
+			}},
+			{Name: "dividend import", Run: func(ctx context.Context, date string) (string, error) {
+				result, err := app.dividends.Import(ctx, date)
+				if err != nil {
+					return "", err
+				}
+				summary := fmt.Sprintf("%d payments to %d books, %s", result.Payments, result.Books, result.Amount.StringFixed(2))
+				if len(result.Unallocated) > 0 {
+					return "", fmt.Errorf("%s; no book holds %s", summary, strings.Join(result.Unallocated, ", "))
+				}
+				if result.Failed > 0 {
+					return "", fmt.Errorf("%s; %d could not be recorded", summary, result.Failed)
+				}
+				return summary, nil
+			}},
+			{Name: "position snapshot", Run: func(ctx context.Context, date string) (string, error) {
+				n, err := app.marks.Snapshot()
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("stored %d position marks", n), nil
+			}},
+			{Name: "weekly reports", Run: func(ctx context.Context, date string) (string, error) {
+				if d, _ := time.Parse("2006-01-02", date); d.Weekday() != time.Friday {
+					return "", checklist.Skip("reports are sent after Friday's close")
+				}
+				if err := app.weeklyReports.Distribute(ctx, date); err != nil {
+					return "", err
+				}
+				return "sent", nil
+			}},
+			{Name: "mark archival", Run: func(ctx context.Context, date string) (string, error) {
+				if archiver == nil {
+					return "", checklist.Skip("ARCHIVE_MARKS is off")
+				}
+				n, err := archiver.Archive(ctx)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("archived %d sessions", n), nil
+			}},
+			{Name: "backup", Run: func(ctx context.Context, date string) (string, error) {
+				if !backupDaily {
+					return "", checklist.Skip("BACKUP_DAILY is off")
+				}
+				key, err := app.backups.Backup(ctx)
+				if err != nil {
+					return "", err
+				}
+				return "stored " + key, nil
+			}},
+		},
+	}
+}
+
+// maintenanceChecklist maintains the database delay after every close, when
+// nothing trades: it caches the session's minute bars for trade cost
+// analysis, refreshes the query planner's statistics, and rebuilds the file
+// once deletes such as mark archival have left more than vacuumFree of it
+// free
+func (app *Application) maintenanceChecklist(delay time.Duration, vacuumFree float64) *checklist.Checklist {
+	return &checklist.Checklist{
+		Name:  "maintenance",
+		Title: "Database maintenance",
+		At: func(date string) (time.Time, error) {
+			closeAt, err := market.SessionClose(date)
+			return closeAt.Add(delay), err
+		},
+		Steps: []checklist.Step{
+			{Name: "minute bars", Run: func(ctx context.Context, date string) (string, error) {
+				n, err := app.tca.Warm(ctx, date)
+				if errors.Is(err, tca.ErrSessionOpen) {
+					return "", checklist.Skip("after-hours trading isn't over")
+				}
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("cached minute bars of %d symbols", n), nil
+			}},
+			{Name: "analyze", Run: func(ctx context.Context, date string) (string, error) {
+				if err := app.db.Analyze(ctx); err != nil {
+					return "", err
+				}
+				return "refreshed query planner statistics", nil
+			}},
+			{Name: "vacuum", Run: func(ctx context.Context, date string) (string, error) {
+				// VACUUM locks the whole file; a run on demand mustn't do
+				// that to a trading session
+				if market.InSession(time.Now()) {
+					return "", checklist.Skip("the market is open")
+				}
+				stats, err := app.db.SpaceStats(ctx)
+				if err != nil {
+					return "", err
+				}
+				if free := stats.FreeFraction(); free < vacuumFree || stats.FreePages == 0 {
+					return "", checklist.Skip("%.1f%% of %s free, under %.1f%%",
+						free*100, megabytes(stats.Bytes()), vacuumFree*100)
+				}
+				before, after, err := app.db.Vacuum(ctx)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("reclaimed %s, from %s to %s",
+					megabytes(before.Bytes()-after.Bytes()), megabytes(before.Bytes()), megabytes(after.Bytes())), nil
+			}},
+		},
+	}
+}
+
+// megabytes formats a size in bytes for a step's detail
+func megabytes(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// checkCredentials checks the broker accepts the credentials of the desk's
+// account, and of every chapter's own, and that each account can trade
+func (app *Application) checkCredentials(ctx context.Context, date string) (string, error) {
+	accounts := app.brokers.accounts()
+	var found, problems []string
+	for _, chapter := range slices.Sorted(maps.Keys(accounts)) {
+		detail, err := checkAccount(accounts[chapter])
+		if chapter != "" {
+			detail = "chapter " + chapter + ": " + detail
+		}
+		if err != nil {
+			if chapter != "" {
+				err = fmt.Errorf("chapter %s: %w", chapter, err)
+			}
+			problems = append(problems, err.Error())
+			continue
+		}
+		found = append(found, detail)
+	}
+	if len(problems) > 0 {
+		return "", errors.New(strings.Join(problems, "; "))
+	}
+	return strings.Join(found, "; "), nil
+}
+
+// checkAccount checks one account can trade
+func checkAccount(client Broker) (string, error) {
+	account, err := client.Account()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case account.Status != "ACTIVE":
+		return "", fmt.Errorf("account %s is %s", account.AccountNumber, account.Status)
+	case account.AccountBlocked:
+		return "", fmt.Errorf("account %s is blocked", account.AccountNumber)
+	case account.TradingBlocked, account.TradeSuspendedByUser:
+		return "", fmt.Errorf("trading is blocked on account %s", account.AccountNumber)
+	}
+	return fmt.Sprintf("account %s active, buying power %s", account.AccountNumber, account.BuyingPower.StringFixed(2)), nil
+}
+
+// checkDataFeed checks market data is flowing by the age of the latest trade
+// in a liquid symbol
+func (app *Application) checkDataFeed(ctx context.Context, date string) (string, error) {
+	price, tradedAt, err := app.marketData.Live.LatestTrade(feedCheckSymbol)
+	if err != nil {
+		return "", err
+	}
+	if age := time.Since(tradedAt); age > feedMaxAge {
+		return "", fmt.Errorf("latest %s trade is %s old", feedCheckSymbol, age.Round(time.Minute))
+	}
+	return fmt.Sprintf("%s last traded at %s at %s", feedCheckSymbol, price, tradedAt.UTC().Format(time.RFC3339)), nil
+}
+
+// rewarmQuotes re-reads active strategies' symbols, which may have changed
+// since startup, and marks them before the open
+func (app *Application) rewarmQuotes(maxSymbols int) (string, error) {
+	if maxSymbols == 0 {
+		return "", checklist.Skip("quote warm-up is disabled")
+	}
+	n, err := warmQuotes(app.db, app.aliases, app.marks, maxSymbols)
+	if err != nil {
+		return "", err
+	}
+	if err := app.marks.Refresh(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("watching %d strategy symbols, %d symbols now marked", n, app.marks.Tracked()), nil
+}
+
+// checkReconciliation checks the desk's open orders match the broker's, in
+// every account (see openOrders): DAY orders from earlier sessions should
+// have been settled by the close sweep, every order the desk has open should
+// be open at the broker with the same fills, and the broker should have no
+// open orders the desk doesn't know about
+func (app *Application) checkReconciliation(ctx context.Context, date string) (string, error) {
+	open, err := market.SessionOpen(date)
+	if err != nil {
+		return "", err
+	}
+	book, err := app.openOrders(app.brokers.accounts())
+	if err != nil {
+		return "", err
+	}
+
+	var staleDay, differs, missing, unknown []string
+	for _, o := range book.Orders {
+		switch {
+		case o.DeskStatus != "" && o.TimeInForce == "day" && o.SubmittedAt.Before(open):
+			staleDay = append(staleDay, o.OrderID)
+		case o.State == openDiffers:
+			differs = append(differs, o.OrderID)
+		case o.State == openMissingAtBroker:
+			missing = append(missing, o.OrderID)
+		case o.State == openUnknownToDesk:
+			unknown = append(unknown, o.OrderID)
+		}
+	}
+
+	var problems []string
+	if len(staleDay) > 0 {
+		problems = append(problems, fmt.Sprintf("%d DAY orders from earlier sessions still open in the book (%s)", len(staleDay), strings.Join(staleDay, ", ")))
+	}
+	if len(differs) > 0 {
+		problems = append(problems, fmt.Sprintf("%d orders have a different status or fills at the broker (%s)", len(differs), strings.Join(differs, ", ")))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%d orders open in the book are not open at the broker (%s)", len(missing), strings.Join(missing, ", ")))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, fmt.Sprintf("%d orders open at the broker are not in the book (%s)", len(unknown), strings.Join(unknown, ", ")))
+	}
+	if len(problems) > 0 {
+		return "", errors.New(strings.Join(problems, "; "))
+	}
+	return fmt.Sprintf("%d open orders match the broker", book.Matched), nil
+}
+
+// checkRiskLimits checks the configuration still loads and that the risk
+// limits in force are the configured ones, so an edit that was never
+// reloaded, or can't be, shows up before the open rather than at a breach
+func (app *Application) checkRiskLimits(ctx context.Context, date string) (string, error) {
+	_, getenv, err := app.readConfig()
+	if err != nil {
+		return "", err
+	}
+	s, err := loadSettings(getenv)
+	if err != nil {
+		return "", fmt.Errorf("configuration doesn't load: %w", err)
+	}
+
+	limit := app.riskSnapshots.DrawdownLimit()
+	if !s.drawdownLimit.Equal(limit) {
+		return "", fmt.Errorf("MAX_DRAWDOWN_PCT is %s in the configuration but %s is in force; reload", s.drawdownLimit, limit)
+	}
+	if leverage := app.riskSnapshots.LeverageLimit(); !s.leverageLimit.Equal(leverage) {
+		return "", fmt.Errorf("MAX_LEVERAGE is %s in the configuration but %s is in force; reload", s.leverageLimit, leverage)
+	}
+	if overnight, _ := app.overnightSettings(); !overnight.MaxGross.Equal(s.overnight.MaxGross) || !overnight.MaxLeverage.Equal(s.overnight.MaxLeverage) {
+		return "", errors.New("overnight limits in the configuration differ from those in force; reload")
+	}
+	if c := app.concentrationLimits(); !c.User.Equal(s.concentration.User) || !c.Desk.Equal(s.concentration.Desk) {
+		return "", errors.New("concentration limits in the configuration differ from those in force; reload")
+	}
+	greeks := app.greeks.Limits()
+	if !greeks.Delta.Equal(s.greekLimits.Delta) || !greeks.Gamma.Equal(s.greekLimits.Gamma) ||
+		!greeks.Theta.Equal(s.greekLimits.Theta) || !greeks.Vega.Equal(s.greekLimits.Vega) {
+		return "", errors.New("greek limits in the configuration differ from those in force; reload")
+	}
+	app.customRulesMu.RLock()
+	custom := app.customRules
+	app.customRulesMu.RUnlock()
+	if !slices.EqualFunc(custom, s.customRules, func(a, b risk.CustomRuleDef) bool {
+		return a.Name == b.Name && a.Expr == b.Expr && a.Action == b.Action && a.Message == b.Message
+	}) {
+		return "", errors.New("custom rules in RISK_RULES_FILE differ from those in force; reload")
+	}
+
+	rules := app.preTrade.Names()
+	if len(rules) == 0 {
+		rules = []string{"none"}
+	}
+	return fmt.Sprintf("drawdown limit %s, pre-trade rules: %s", limit, strings.Join(rules, ", ")), nil
+}
+
+// handleGetChecklists returns the latest run of each checklist for the
+// dashboard, or of each for the session ?date=
+func (app *Application) handleGetChecklists(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			http.Error(w, "Bad request: invalid date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	runs, err := app.db.GetLatestChecklistRuns(date)
+	if err != nil {
+		log.Printf("Failed to load checklist runs: %v", err)
+		http.Error(w, "Failed to load checklist runs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleRunChecklist serves POST /admin/checklists/{name} on the admin port:
+// it runs a checklist now for the session ?date= (default today) and returns
+// the run
+func (app *Application) handleRunChecklist(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = market.SessionDate(time.Now())
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "Bad request: invalid date", http.StatusBadRequest)
+		return
+	}
+
+	run, err := app.checklists.Run(r.Context(), r.PathValue("name"), date)
+	if errors.Is(err, checklist.ErrUnknown) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, checklist.ErrRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to run checklist: %v", err)
+		http.Error(w, "Failed to run checklist: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/database"
+	"desk/internal/risk"
+)
+
+// concentrationLimits returns the concentration limits in force
+func (app *Application) concentrationLimits() risk.ConcentrationLimits {
+	app.concentrationMu.RLock()
+	defer app.concentrationMu.RUnlock()
+	return app.concentration
+}
+
+// handleConcentration returns each of the caller's symbols as a share of
+// their capital, against the per-user concentration limit
+func (app *Application) handleConcentration(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	capital, err := app.capital(userID)
+	if err != nil {
+		log.Printf("Failed to get capital for concentration: %v", err)
+		http.Error(w, "Failed to load account", http.StatusBadGateway)
+		return
+	}
+
+	report := risk.Concentration(app.marks.Positions(userID), capital, app.concentrationLimits().User)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleDeskConcentration returns each symbol the desk account holds as a
+// share of its equity, against the desk concentration limit
+func (app *Application) handleDeskConcentration(w http.ResponseWriter, r *http.Request) {
+	snap := app.riskSnapshots.Latest()
+	if snap == nil {
+		http.Error(w, "No risk snapshot available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	var positions []database.PositionMark
+	for _, p := range app.marks.Positions("") {
+		if !app.brokers.ownAccount(p.UserID) {
+			positions = append(positions, p)
+		}
+	}
+	report := risk.Concentration(positions, snap.Equity, app.concentrationLimits().Desk)
+	writeJSON(w, http.StatusOK, report)
+}
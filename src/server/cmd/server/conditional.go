@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/conditional"
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+)
+
+type triggerRequest struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Period    int    `json:"period"`
+	Timeframe string `json:"timeframe"`
+	At        string `json:"at"`
+}
+
+type createConditionalOrderRequest struct {
+	Symbol      string         `json:"symbol"`
+	Side        string         `json:"side"`
+	Qty         string         `json:"qty"`
+	OrderType   string         `json:"order_type"`
+	TimeInForce string         `json:"time_in_force"`
+	LimitPrice  string         `json:"limit_price"`
+	StopPrice   string         `json:"stop_price"`
+	Trigger     triggerRequest `json:"trigger"`
+}
+
+// handleCreateConditionalOrder registers an order that the desk submits once
+// its trigger fires. The order is validated exactly like POST /order.
+func (app *Application) handleCreateConditionalOrder(w http.ResponseWriter, r *http.Request) {
+	var req createConditionalOrderRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+
+	orderReq := &orderprotos.OrderRequest{
+		Symbol:      app.aliases.Resolve(req.Symbol),
+		Side:        req.Side,
+		Qty:         req.Qty,
+		OrderType:   req.OrderType,
+		TimeInForce: req.TimeInForce,
+		LimitPrice:  req.LimitPrice,
+		StopPrice:   req.StopPrice,
+	}
+	if err := app.applyOrderDefaults(requestUserID(r), orderReq); err != nil {
+		log.Printf("Failed to load preferences: %v", err)
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	order, err := orders.FromRequest(orderReq, app.instruments)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var triggerValue decimal.Decimal
+	if req.Trigger.Value != "" {
+		if triggerValue, err = decimal.NewFromString(req.Trigger.Value); err != nil {
+			http.Error(w, "Bad request: invalid trigger value", http.StatusBadRequest)
+			return
+		}
+	}
+	var triggerAt *time.Time
+	if req.Trigger.At != "" {
+		at, err := market.ParseTime(req.Trigger.At)
+		if err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		triggerAt = &at
+	}
+
+	co := &database.ConditionalOrder{
+		UserID:       requestUserID(r),
+		StrategyID:   strategyID,
+		Symbol:       order.Symbol,
+		Side:         order.Side,
+		Qty:          order.Qty,
+		OrderType:    order.Type,
+		TimeInForce:  order.TimeInForce,
+		LimitPrice:   order.LimitPrice,
+		StopPrice:    order.StopPrice,
+		TriggerType:  req.Trigger.Type,
+		TriggerValue: triggerValue,
+		RSIPeriod:    req.Trigger.Period,
+		Timeframe:    req.Trigger.Timeframe,
+		TriggerAt:    triggerAt,
+		Status:       database.ConditionalPending,
+		CreatedAt:    time.Now(),
+	}
+	if err := conditional.ValidateTrigger(co); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := app.db.CreateConditionalOrder(co)
+	if err != nil {
+		log.Printf("Failed to create conditional order: %v", err)
+		http.Error(w, "Failed to create conditional order", http.StatusInternalServerError)
+		return
+	}
+	co.ID = id
+	app.conditionalOrders.Schedule(*co)
+
+	writeJSON(w, http.StatusCreated, co)
+}
+
+// handleListConditionalOrders lists the caller's conditional orders, newest
+// first, optionally filtered by ?status= and ?trigger_type= (e.g.
+// status=pending&trigger_type=at_time for pending timed orders)
+func (app *Application) handleListConditionalOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	list, err := app.db.GetConditionalOrdersByUser(requestUserID(r), query.Get("status"), query.Get("trigger_type"))
+	if err != nil {
+		log.Printf("Failed to load conditional orders: %v", err)
+		http.Error(w, "Failed to load conditional orders", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []database.ConditionalOrder{}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleCancelConditionalOrder cancels one of the caller's pending
+// conditional orders
+func (app *Application) handleCancelConditionalOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid conditional order ID", http.StatusBadRequest)
+		return
+	}
+
+	canceled, err := app.db.CancelConditionalOrder(id, requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to cancel conditional order: %v", err)
+		http.Error(w, "Failed to cancel conditional order", http.StatusInternalServerError)
+		return
+	}
+	if !canceled {
+		http.Error(w, "No pending conditional order with that ID", http.StatusNotFound)
+		return
+	}
+	app.conditionalOrders.Unschedule(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
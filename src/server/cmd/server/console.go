@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"desk/internal/database"
+)
+
+const (
+	defaultConsolePageSize = 100
+	maxConsolePageSize     = 10000
+	consoleQueryTimeout    = 30 * time.Second
+)
+
+type consoleRequest struct {
+	SQL string `json:"sql"`
+}
+
+// handleConsoleQuery serves POST /admin/sql on the admin port, running the
+// body's sql against the desk database. Query parameters: limit (default
+// 100, max 10000), offset, format=csv, and write=true to run on the
+// read-write connection when ADMIN_SQL_WRITE is enabled.
+func (app *Application) handleConsoleQuery(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var req consoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.SQL) == "" {
+		http.Error(w, "Bad request: sql is required", http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, ok := consolePage(w, r)
+	if !ok {
+		return
+	}
+
+	write := query.Get("write") == "true"
+	if write && !app.consoleWrites {
+		http.Error(w, "Writes are disabled (set ADMIN_SQL_WRITE=true)", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), consoleQueryTimeout)
+	defer cancel()
+
+	log.Printf("Admin console query (write=%t, offset=%d, limit=%d): %s", write, offset, limit, req.SQL)
+	result, err := app.db.RunQuery(ctx, req.SQL, offset, limit, write)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Query timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeQueryResult(w, r, result)
+}
+
+// consolePage reads the limit and offset parameters of a console query,
+// writing the error if they're invalid
+func consolePage(w http.ResponseWriter, r *http.Request) (offset, limit int, ok bool) {
+	query := r.URL.Query()
+	limit = defaultConsolePageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad request: invalid limit", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = min(n, maxConsolePageSize)
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Bad request: invalid offset", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return offset, limit, true
+}
+
+// writeQueryResult writes a console query's result as JSON, or as CSV with
+// format=csv or an Accept: text/csv header
+func writeQueryResult(w http.ResponseWriter, r *http.Request, result *database.QueryResult) {
+	if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	if result.NextOffset != nil {
+		w.Header().Set("X-Next-Offset", strconv.Itoa(*result.NextOffset))
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(result.Columns)
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case nil:
+				record[i] = ""
+			case time.Time:
+				record[i] = v.Format(time.RFC3339Nano)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		out.Write(record)
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("Failed to write CSV response: %v", err)
+	}
+}
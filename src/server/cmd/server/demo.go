@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"desk/internal/fixture"
+)
+
+// startDemo serves the Alpaca fixture on addr, with scenarios applied, and
+// returns its URL. It is started before the broker connects rather than as
+// a component, and serves until the process exits.
+func startDemo(addr string, scenarios []fixture.Scenario) (string, error) {
+	server, err := fixture.New()
+	if err != nil {
+		return "", err
+	}
+	for _, sc := range scenarios {
+		server.Inject(sc)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		if err := http.Serve(listener, server); err != nil {
+			log.Printf("Alpaca fixture stopped: %v", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/artifacts"
+	"desk/internal/database"
+)
+
+// createGitStrategy registers a strategy from a git repository. The ref
+// (default HEAD) is fetched before the strategy is created, so a bad URL or
+// ref registers nothing, and is installed as the strategy's first version.
+func (app *Application) createGitStrategy(w http.ResponseWriter, r *http.Request, req createStrategyRequest) {
+	if req.Name == "" {
+		http.Error(w, "Bad request: name is required", http.StatusBadRequest)
+		return
+	}
+	if req.GitRef == "" {
+		req.GitRef = "HEAD"
+	}
+
+	sha, archive, err := app.deployer.Fetch(r.Context(), req.GitURL, req.GitRef)
+	if err != nil {
+		log.Printf("Failed to fetch strategy from git: %v", err)
+		http.Error(w, "Failed to fetch strategy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	userID := requestUserID(r)
+	id, err := app.db.CreateStrategy(&database.Strategy{
+		UserID:   userID,
+		Name:     req.Name,
+		FilePath: artifacts.Entrypoint,
+		Status:   "active",
+		GitURL:   &req.GitURL,
+		GitRef:   &req.GitRef,
+	})
+	if err != nil {
+		log.Printf("Failed to create strategy: %v", err)
+		http.Error(w, "Failed to create strategy", http.StatusConflict)
+		return
+	}
+
+	strategy, err := app.db.GetStrategyByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load strategy", http.StatusInternalServerError)
+		return
+	}
+	deployment, err := app.deployer.Install(r.Context(), strategy, req.GitRef, sha, archive, userID)
+	if err != nil {
+		log.Printf("Failed to install strategy %d: %v", id, err)
+		http.Error(w, "Failed to install strategy", http.StatusInternalServerError)
+		return
+	}
+	if deployment.Status != database.DeployDeployed {
+		writeJSON(w, http.StatusUnprocessableEntity, deployment)
+		return
+	}
+
+	created, err := app.db.GetStrategyByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load strategy", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+type deployRequest struct {
+	Ref string `json:"ref"`
+}
+
+// handleDeployStrategy deploys a git ref (default: the last deployed ref,
+// picking up new commits) of a strategy registered from git. The response
+// is the recorded deployment: 200 when it was deployed, 409 when the new
+// version did not stay up, 422 when the commit is not a valid strategy
+// bundle and 502 when the ref could not be fetched.
+func (app *Application) handleDeployStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+	if strategy.GitURL == nil {
+		http.Error(w, "Bad request: strategy is not registered from git", http.StatusBadRequest)
+		return
+	}
+
+	var req deployRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Ref == "" && strategy.GitRef != nil {
+		req.Ref = *strategy.GitRef
+	}
+	if req.Ref == "" {
+		req.Ref = "HEAD"
+	}
+
+	deployment, err := app.deployer.Deploy(r.Context(), strategy, req.Ref, requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to deploy strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to deploy strategy", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case deployment.Status == database.DeployRolledBack:
+		status = http.StatusConflict
+	case deployment.Status == database.DeployFailed && deployment.CommitSHA == nil:
+		status = http.StatusBadGateway
+	case deployment.Status == database.DeployFailed && deployment.Version == nil:
+		status = http.StatusUnprocessableEntity
+	case deployment.Status == database.DeployFailed:
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, deployment)
+}
+
+func (app *Application) handleListDeployments(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	deployments, err := app.db.GetDeployments(strategy.ID)
+	if err != nil {
+		log.Printf("Failed to load deployments: %v", err)
+		http.Error(w, "Failed to load deployments", http.StatusInternalServerError)
+		return
+	}
+	if deployments == nil {
+		deployments = []database.Deployment{}
+	}
+
+	writeJSON(w, http.StatusOK, deployments)
+}
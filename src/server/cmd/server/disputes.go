@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/notify"
+)
+
+// disputeRequest is the body of POST /trades/{id}/disputes
+type disputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// resolveDisputeRequest is the body of POST /admin/disputes/{id}/resolve
+type resolveDisputeRequest struct {
+	// Status is upheld or rejected
+	Status string `json:"status"`
+	Note   string `json:"note"`
+	// Adjustment is the P&L the erroneous fill caused, negative for a loss,
+	// taken out of the book's performance by an upheld dispute
+	Adjustment decimal.Decimal `json:"adjustment"`
+	// TradeDate is the session the adjustment is booked on, by default the
+	// session the trade filled in
+	TradeDate string `json:"trade_date"`
+}
+
+// validDisputeStatus reports whether status is empty, for any status, or a
+// dispute status
+func validDisputeStatus(status string) bool {
+	switch status {
+	case "", database.DisputeOpen, database.DisputeUpheld, database.DisputeRejected:
+		return true
+	}
+	return false
+}
+
+// handleOpenDispute flags one of the caller's filled trades as erroneous.
+// The trade is left as it was logged; an admin resolves the dispute.
+func (app *Application) handleOpenDispute(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid trade ID", http.StatusBadRequest)
+		return
+	}
+	var req disputeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "Bad request: reason is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	trades, err := app.db.GetTradesByIDs([]int64{id})
+	if err != nil {
+		log.Printf("Failed to load trade %d: %v", id, err)
+		http.Error(w, "Failed to load trade", http.StatusInternalServerError)
+		return
+	}
+	if len(trades) == 0 || trades[0].UserID != userID {
+		http.Error(w, "Trade not found", http.StatusNotFound)
+		return
+	}
+	if !trades[0].FilledQty.IsPositive() {
+		http.Error(w, "Bad request: only filled trades can be disputed", http.StatusBadRequest)
+		return
+	}
+
+	d := database.Dispute{TradeID: id, UserID: userID, Reason: req.Reason, OpenedAt: time.Now()}
+	if err := app.db.OpenDispute(&d); errors.Is(err, database.ErrDisputeExists) {
+		http.Error(w, "Trade is already disputed", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Failed to open dispute of trade %d: %v", id, err)
+		http.Error(w, "Failed to open dispute", http.StatusInternalServerError)
+		return
+	}
+	t := trades[0]
+	notify.Send(context.Background(), app.notifier, notify.LevelWarning, "Trade disputed",
+		fmt.Sprintf("%s disputed trade %d (%s %s %s): %s", userID, id, t.Side, t.FilledQty, t.Symbol, req.Reason))
+	writeJSON(w, http.StatusCreated, d)
+}
+
+// handleListDisputes lists the caller's disputes, newest first, optionally
+// in one status
+func (app *Application) handleListDisputes(w http.ResponseWriter, r *http.Request) {
+	app.listDisputes(w, r, requestUserID(r))
+}
+
+// handleAdminListDisputes lists every member's disputes on the admin port,
+// newest first, optionally in one status
+func (app *Application) handleAdminListDisputes(w http.ResponseWriter, r *http.Request) {
+	app.listDisputes(w, r, "")
+}
+
+func (app *Application) listDisputes(w http.ResponseWriter, r *http.Request, userID string) {
+	status := r.URL.Query().Get("status")
+	if !validDisputeStatus(status) {
+		http.Error(w, "Bad request: status must be open, upheld or rejected", http.StatusBadRequest)
+		return
+	}
+	disputes, err := app.db.GetDisputes(userID, status)
+	if err != nil {
+		log.Printf("Failed to load disputes: %v", err)
+		http.Error(w, "Failed to load disputes", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, disputes)
+}
+
+// handleResolveDispute upholds or rejects an open dispute on the admin port.
+// An upheld dispute takes its trade out of performance stats and books the
+// adjustment against its session; the trade itself is never changed.
+func (app *Application) handleResolveDispute(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid dispute ID", http.StatusBadRequest)
+		return
+	}
+	var req resolveDisputeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Status != database.DisputeUpheld && req.Status != database.DisputeRejected {
+		http.Error(w, "Bad request: status must be upheld or rejected", http.StatusBadRequest)
+		return
+	}
+	if req.TradeDate != "" {
+		if _, err := time.Parse("2006-01-02", req.TradeDate); err != nil {
+			http.Error(w, "Bad request: trade_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	d, err := app.db.GetDispute(id)
+	if err != nil {
+		log.Printf("Failed to load dispute %d: %v", id, err)
+		http.Error(w, "Failed to load dispute", http.StatusInternalServerError)
+		return
+	}
+	if d == nil || d.Status != database.DisputeOpen {
+		http.Error(w, "No open dispute with this ID", http.StatusNotFound)
+		return
+	}
+	if req.Status == database.DisputeUpheld && req.TradeDate == "" {
+		trades, err := app.db.GetTradesByIDs([]int64{d.TradeID})
+		if err != nil || len(trades) == 0 {
+			log.Printf("Failed to load disputed trade %d: %v", d.TradeID, err)
+			http.Error(w, "Failed to load disputed trade", http.StatusInternalServerError)
+			return
+		}
+		filled := trades[0].SubmittedAt
+		if trades[0].FilledAt != nil {
+			filled = *trades[0].FilledAt
+		}
+		req.TradeDate = market.SessionDate(filled)
+	}
+
+	resolved, err := app.db.ResolveDispute(id, req.Status, req.Note, req.Adjustment, req.TradeDate, time.Now())
+	if err != nil {
+		log.Printf("Failed to resolve dispute %d: %v", id, err)
+		http.Error(w, "Failed to resolve dispute", http.StatusInternalServerError)
+		return
+	}
+	if resolved == nil {
+		http.Error(w, "No open dispute with this ID", http.StatusNotFound)
+		return
+	}
+
+	msg := fmt.Sprintf("Your dispute of trade %d was %s", resolved.TradeID, resolved.Status)
+	if resolved.Status == database.DisputeUpheld {
+		msg += fmt.Sprintf("; it no longer counts toward performance, with %s adjusted on %s", resolved.Adjustment, *resolved.TradeDate)
+	}
+	if req.Note != "" {
+		msg += ": " + req.Note
+	}
+	notify.SendUser(context.Background(), app.userNotifier, resolved.UserID, notify.LevelInfo, "Dispute "+resolved.Status, msg)
+	writeJSON(w, http.StatusOK, resolved)
+}
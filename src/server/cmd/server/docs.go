@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"desk/internal/openapi"
+	orderprotos "desk/internal/protos/orders"
+	positionprotos "desk/internal/protos/positions"
+	strategyprotos "desk/internal/protos/strategy"
+)
+
+// swaggerUIPage renders /openapi.json with Swagger UI, loaded from a CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Trading Desk API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// handleOpenAPI serves the OpenAPI document, encoded once at startup
+func handleOpenAPI(doc *openapi.Document) http.HandlerFunc {
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		log.Fatalf("Failed to encode OpenAPI document: %v", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+// handleSwaggerUI serves an interactive view of the OpenAPI document
+func handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+// protoFiles are the desk's compiled .proto files
+var protoFiles = []protoreflect.FileDescriptor{
+	orderprotos.File_order_proto,
+	orderprotos.File_trade_proto,
+	positionprotos.File_positions_proto,
+	strategyprotos.File_strategy_proto,
+}
+
+// descriptorSet returns files and everything they import as a
+// FileDescriptorSet, dependencies first, like protoc --include_imports
+func descriptorSet(files []protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range files {
+		add(fd)
+	}
+	return set
+}
+
+// handleProtoDescriptors serves the compiled FileDescriptorSet of the desk's
+// protobuf messages, so clients can generate or reflect message types
+// without the .proto files. It is binary protobuf unless JSON is asked for.
+func handleProtoDescriptors(w http.ResponseWriter, r *http.Request) {
+	writeProto(w, r, http.StatusOK, descriptorSet(protoFiles))
+}
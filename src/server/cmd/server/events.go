@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"desk/internal/lifecycle"
+	"desk/internal/tenants"
+)
+
+// grpcServer makes a component of a gRPC server listening on addr. Event
+// streams don't end on their own, so stopping closes them rather than
+// waiting; strategies reconnect.
+func grpcServer(name, addr string, srv *grpc.Server, dependsOn ...string) lifecycle.Component {
+	var listener net.Listener
+	return lifecycle.Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(ctx context.Context) error {
+			var err error
+			listener, err = (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+			return err
+		},
+		Run: func(ctx context.Context) error {
+			return srv.Serve(listener)
+		},
+		Stop: func(context.Context) error {
+			srv.Stop()
+			return nil
+		},
+	}
+}
+
+// identifyEventsCaller identifies a strategy event subscription from its gRPC
+// metadata the way requestUserID and requestStrategyID identify an HTTP
+// request, requiring a chapter token when the desk has chapters
+func (app *Application) identifyEventsCaller(ctx context.Context) (string, int64, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	userID := first("x-user-id")
+	if userID == "" {
+		userID = "default_user"
+	}
+	var chapter *tenants.Chapter
+	if app.tenants != nil {
+		token, ok := strings.CutPrefix(first("authorization"), "Bearer ")
+		if !ok {
+			return "", 0, errors.New("chapter token required")
+		}
+		if chapter, ok = app.tenants.Authenticate(token); !ok {
+			return "", 0, errors.New("unknown chapter token")
+		}
+		if strings.Contains(userID, ":") && !chapter.Owns(userID) {
+			return "", 0, errors.New("user belongs to another chapter")
+		}
+	}
+
+	var strategyID int64
+	if v := first("x-strategy-id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", 0, errors.New("invalid x-strategy-id")
+		}
+		strategyID = id
+	}
+	return qualifyUserID(chapter, userID), strategyID, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/pnl"
+)
+
+type createExperimentRequest struct {
+	Name        string `json:"name"`
+	StrategyAID int64  `json:"strategy_a_id"`
+	StrategyBID int64  `json:"strategy_b_id"`
+}
+
+// variantReport summarizes one side of an experiment
+type variantReport struct {
+	StrategyID   int64           `json:"strategy_id"`
+	Venue        string          `json:"venue"`
+	Orders       int             `json:"orders"`
+	Rejected     int             `json:"rejected"`
+	Fills        int             `json:"fills"`
+	Turnover     decimal.Decimal `json:"turnover"`
+	RealizedPL   decimal.Decimal `json:"realized_pl"`
+	UnrealizedPL decimal.Decimal `json:"unrealized_pl"`
+	TotalPL      decimal.Decimal `json:"total_pl"`
+}
+
+type experimentReport struct {
+	Experiment *database.Experiment `json:"experiment"`
+	VariantA   variantReport        `json:"variant_a"`
+	VariantB   variantReport        `json:"variant_b"`
+	// PLDifference is variant B's total P&L minus variant A's
+	PLDifference decimal.Decimal `json:"pl_difference"`
+}
+
+func (app *Application) handleCreateExperiment(w http.ResponseWriter, r *http.Request) {
+	var req createExperimentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || req.StrategyAID == 0 || req.StrategyBID == 0 {
+		http.Error(w, "Bad request: name, strategy_a_id and strategy_b_id are required", http.StatusBadRequest)
+		return
+	}
+	if req.StrategyAID == req.StrategyBID {
+		http.Error(w, "Bad request: variants must be different strategies", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	for _, id := range []int64{req.StrategyAID, req.StrategyBID} {
+		strategy, err := app.db.GetStrategyByID(id)
+		if err != nil {
+			http.Error(w, "Bad request: unknown strategy", http.StatusBadRequest)
+			return
+		}
+		if strategy.UserID != userID {
+			http.Error(w, "Forbidden: strategy belongs to another user", http.StatusForbidden)
+			return
+		}
+	}
+
+	exp := &database.Experiment{
+		UserID:      userID,
+		Name:        req.Name,
+		StrategyAID: req.StrategyAID,
+		StrategyBID: req.StrategyBID,
+	}
+	id, err := app.db.CreateExperiment(exp)
+	if err != nil {
+		log.Printf("Failed to create experiment: %v", err)
+		http.Error(w, "Failed to create experiment", http.StatusConflict)
+		return
+	}
+
+	created, err := app.db.GetExperimentByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load experiment", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// ownedExperiment loads the experiment named by the {id} path value, writing
+// an error response unless the caller owns it
+func (app *Application) ownedExperiment(w http.ResponseWriter, r *http.Request) (*database.Experiment, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid experiment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	exp, err := app.db.GetExperimentByID(id)
+	if err != nil {
+		http.Error(w, "Experiment not found", http.StatusNotFound)
+		return nil, false
+	}
+	if exp.UserID != requestUserID(r) {
+		http.Error(w, "Only the owner can manage an experiment", http.StatusForbidden)
+		return nil, false
+	}
+	return exp, true
+}
+
+func (app *Application) handleStopExperiment(w http.ResponseWriter, r *http.Request) {
+	exp, ok := app.ownedExperiment(w, r)
+	if !ok {
+		return
+	}
+	id := exp.ID
+
+	if err := app.db.StopExperiment(id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	exp, err := app.db.GetExperimentByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load experiment", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, exp)
+}
+
+func (app *Application) handleExperimentReport(w http.ResponseWriter, r *http.Request) {
+	exp, ok := app.ownedExperiment(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	report := experimentReport{Experiment: exp}
+	report.VariantA, err = app.buildVariantReport(exp, exp.StrategyAID)
+	if err != nil {
+		log.Printf("Failed to build experiment report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+	report.VariantB, err = app.buildVariantReport(exp, exp.StrategyBID)
+	if err != nil {
+		log.Printf("Failed to build experiment report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+	report.PLDifference = report.VariantB.TotalPL.Sub(report.VariantA.TotalPL)
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// buildVariantReport computes fills, turnover and P&L for a variant's trades
+// since the experiment started. Open positions are marked at the latest price.
+func (app *Application) buildVariantReport(exp *database.Experiment, strategyID int64) (variantReport, error) {
+	trades, err := app.db.GetTradesByStrategy(strategyID, exp.CreatedAt)
+	if err != nil {
+		return variantReport{}, err
+	}
+
+	report := variantReport{
+		StrategyID: strategyID,
+		Venue:      database.VenueAlpaca,
+		Orders:     len(trades),
+	}
+	if strategyID == exp.StrategyBID {
+		report.Venue = database.VenueSimulator
+	}
+	for _, t := range trades {
+		if t.OrderStatus == "rejected" {
+			report.Rejected++
+		}
+	}
+
+	ledger := pnl.LedgerFromTrades(trades)
+	marks := make(map[string]decimal.Decimal)
+	for _, symbol := range ledger.OpenSymbols() {
+		price, err := app.marks.LatestPrice(symbol)
+		if err != nil {
+			log.Printf("Failed to mark %s for experiment %d: %v", symbol, exp.ID, err)
+			continue
+		}
+		marks[symbol] = price
+	}
+
+	report.Fills = ledger.Fills
+	report.Turnover = ledger.Turnover
+	report.RealizedPL = ledger.Realized
+	report.UnrealizedPL = ledger.Unrealized(marks)
+	report.TotalPL = report.RealizedPL.Add(report.UnrealizedPL)
+
+	return report, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"desk/internal/database"
+)
+
+// runFsck checks the database's integrity without starting the server:
+// fsck [-fix] [-json]. -fix applies the fixes of fixable issues. It returns
+// 1 if errors remain, so it can gate a deploy or a restore.
+func runFsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "apply the fix of every fixable issue")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Keep stdout for the report
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./trading_desk.db"
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	var report *database.IntegrityReport
+	if *fix {
+		report, err = db.RepairIntegrity()
+	} else {
+		report, err = db.CheckIntegrity()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check database integrity: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printIntegrityReport(os.Stdout, report)
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Severity == database.SeverityError && !issue.Fixed {
+			return 1
+		}
+	}
+	return 0
+}
+
+// printIntegrityReport writes a report one issue per line, with the fix
+// underneath
+func printIntegrityReport(w io.Writer, report *database.IntegrityReport) {
+	for _, issue := range report.Issues {
+		where := issue.Table
+		if issue.RowID != 0 {
+			where = fmt.Sprintf("%s #%d", issue.Table, issue.RowID)
+		}
+		fmt.Fprintf(w, "%-7s  %-11s  %s: %s\n", issue.Severity, issue.Check, where, issue.Detail)
+		switch {
+		case issue.Fixed:
+			fmt.Fprintln(w, "         fixed")
+		case issue.Fix != nil:
+			fmt.Fprintln(w, "         fixable with -fix")
+		}
+	}
+	fmt.Fprintf(w, "%d errors, %d warnings, %d fixable, %d fixed\n",
+		report.Errors, report.Warnings, report.Fixable, report.Fixed)
+}
+
+// handleFsck checks the database's integrity on the admin port
+func (app *Application) handleFsck(w http.ResponseWriter, r *http.Request) {
+	report, err := app.db.CheckIntegrity()
+	if err != nil {
+		log.Printf("Failed to check database integrity: %v", err)
+		http.Error(w, "Failed to check database integrity", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleFsckRepair checks the database's integrity on the admin port and
+// applies the fix of every fixable issue
+func (app *Application) handleFsckRepair(w http.ResponseWriter, r *http.Request) {
+	report, err := app.db.RepairIntegrity()
+	if err != nil {
+		log.Printf("Failed to repair database integrity: %v", err)
+		http.Error(w, "Failed to repair database integrity", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/orders"
+	"desk/internal/pnl"
+	orderprotos "desk/internal/protos/orders"
+)
+
+// maxBasketLegs caps how many orders one basket submits
+const maxBasketLegs = 50
+
+type createGroupRequest struct {
+	Name     string  `json:"name"`
+	Kind     string  `json:"kind"`
+	TradeIDs []int64 `json:"trade_ids"`
+}
+
+type groupTradesRequest struct {
+	TradeIDs []int64 `json:"trade_ids"`
+}
+
+type basketLeg struct {
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	Qty         string `json:"qty"`
+	OrderType   string `json:"order_type"`
+	TimeInForce string `json:"time_in_force"`
+	LimitPrice  string `json:"limit_price"`
+	StopPrice   string `json:"stop_price"`
+
+	ExtendedHours bool `json:"extended_hours"`
+}
+
+type basketRequest struct {
+	Name string      `json:"name"`
+	Kind string      `json:"kind"`
+	Legs []basketLeg `json:"legs"`
+}
+
+// basketLegResult is the outcome of one basket leg
+type basketLegResult struct {
+	Symbol  string `json:"symbol"`
+	Status  string `json:"status"`
+	OrderID string `json:"order_id,omitempty"`
+	TradeID int64  `json:"trade_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type basketResponse struct {
+	Group *database.PositionGroup `json:"group"`
+	Legs  []basketLegResult       `json:"legs"`
+}
+
+// groupLeg is a group's net holding in one symbol
+type groupLeg struct {
+	Symbol       string           `json:"symbol"`
+	Qty          decimal.Decimal  `json:"qty"`
+	AvgCost      decimal.Decimal  `json:"avg_cost"`
+	Mark         *decimal.Decimal `json:"mark,omitempty"`
+	MarketValue  decimal.Decimal  `json:"market_value"`
+	RealizedPL   decimal.Decimal  `json:"realized_pl"`
+	UnrealizedPL decimal.Decimal  `json:"unrealized_pl"`
+}
+
+// groupReport is a position group's combined P&L and exposure. Exposures
+// are at the latest price; legs that couldn't be marked count at cost.
+type groupReport struct {
+	Group         *database.PositionGroup `json:"group"`
+	Legs          []groupLeg              `json:"legs"`
+	Fills         int                     `json:"fills"`
+	RealizedPL    decimal.Decimal         `json:"realized_pl"`
+	UnrealizedPL  decimal.Decimal         `json:"unrealized_pl"`
+	TotalPL       decimal.Decimal         `json:"total_pl"`
+	LongExposure  decimal.Decimal         `json:"long_exposure"`
+	ShortExposure decimal.Decimal         `json:"short_exposure"`
+	GrossExposure decimal.Decimal         `json:"gross_exposure"`
+	NetExposure   decimal.Decimal         `json:"net_exposure"`
+}
+
+// ownedGroup loads the position group in the {id} path parameter, writing an
+// error response unless it belongs to the caller
+func (app *Application) ownedGroup(w http.ResponseWriter, r *http.Request) (*database.PositionGroup, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	g, err := app.db.GetPositionGroup(id)
+	if err != nil || g.UserID != requestUserID(r) {
+		http.Error(w, "Position group not found", http.StatusNotFound)
+		return nil, false
+	}
+	return g, true
+}
+
+// writeGroupTradesError responds to a failure adding trades to a group
+func writeGroupTradesError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrUnknownTrade) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Failed to add position group trades: %v", err)
+	http.Error(w, "Failed to add trades", http.StatusInternalServerError)
+}
+
+// handleCreateGroup groups existing trades of the caller's
+func (app *Application) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req createGroupRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Bad request: name is required", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = database.GroupOther
+	}
+	if !database.ValidGroupKind(req.Kind) {
+		http.Error(w, "Bad request: kind must be pair, spread, hedge, basket or other", http.StatusBadRequest)
+		return
+	}
+
+	g := &database.PositionGroup{
+		UserID:   requestUserID(r),
+		Name:     req.Name,
+		Kind:     req.Kind,
+		TradeIDs: req.TradeIDs,
+	}
+	id, err := app.db.CreatePositionGroup(g)
+	if err != nil {
+		writeGroupTradesError(w, err)
+		return
+	}
+
+	created, err := app.db.GetPositionGroup(id)
+	if err != nil {
+		http.Error(w, "Failed to load position group", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (app *Application) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := app.db.GetPositionGroups(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load position groups: %v", err)
+		http.Error(w, "Failed to load position groups", http.StatusInternalServerError)
+		return
+	}
+	if groups == nil {
+		groups = []database.PositionGroup{}
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// handleGroupReport reports a group's combined P&L and exposure
+func (app *Application) handleGroupReport(w http.ResponseWriter, r *http.Request) {
+	g, ok := app.ownedGroup(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := app.buildGroupReport(g)
+	if err != nil {
+		log.Printf("Failed to build position group report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// buildGroupReport books the group's fills at average cost per symbol and
+// marks open legs at the latest price
+func (app *Application) buildGroupReport(g *database.PositionGroup) (*groupReport, error) {
+	trades, err := app.db.GetGroupTrades(g.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := make(map[string]*pnl.Holding)
+	realized := make(map[string]decimal.Decimal)
+	report := &groupReport{Group: g, Legs: []groupLeg{}}
+	for _, t := range trades {
+		f, ok := pnl.FillFromTrade(t)
+		if !ok {
+			continue
+		}
+		h, ok := holdings[f.Symbol]
+		if !ok {
+			h = &pnl.Holding{}
+			holdings[f.Symbol] = h
+		}
+		realized[f.Symbol] = realized[f.Symbol].Add(h.Apply(f.Side, f.Qty, f.Price))
+		report.Fills++
+	}
+
+	for symbol, h := range holdings {
+		leg := groupLeg{
+			Symbol:      symbol,
+			Qty:         h.Qty,
+			AvgCost:     h.AvgCost,
+			MarketValue: h.Qty.Mul(h.AvgCost),
+			RealizedPL:  realized[symbol],
+		}
+		if !h.Qty.IsZero() {
+			price, err := app.marks.LatestPrice(symbol)
+			if err != nil {
+				log.Printf("Failed to mark %s for position group %d: %v", symbol, g.ID, err)
+			} else {
+				leg.Mark = &price
+				leg.MarketValue = h.Qty.Mul(price)
+				leg.UnrealizedPL = price.Sub(h.AvgCost).Mul(h.Qty)
+			}
+		}
+
+		report.RealizedPL = report.RealizedPL.Add(leg.RealizedPL)
+		report.UnrealizedPL = report.UnrealizedPL.Add(leg.UnrealizedPL)
+		if leg.MarketValue.IsPositive() {
+			report.LongExposure = report.LongExposure.Add(leg.MarketValue)
+		} else {
+			report.ShortExposure = report.ShortExposure.Sub(leg.MarketValue)
+		}
+		report.Legs = append(report.Legs, leg)
+	}
+	sort.Slice(report.Legs, func(i, j int) bool { return report.Legs[i].Symbol < report.Legs[j].Symbol })
+
+	report.TotalPL = report.RealizedPL.Add(report.UnrealizedPL)
+	report.GrossExposure = report.LongExposure.Add(report.ShortExposure)
+	report.NetExposure = report.LongExposure.Sub(report.ShortExposure)
+	return report, nil
+}
+
+// handleAddGroupTrades adds trades of the caller's to one of their groups
+func (app *Application) handleAddGroupTrades(w http.ResponseWriter, r *http.Request) {
+	g, ok := app.ownedGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var req groupTradesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.TradeIDs) == 0 {
+		http.Error(w, "Bad request: trade_ids are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.db.AddPositionGroupTrades(g, req.TradeIDs); err != nil {
+		writeGroupTradesError(w, err)
+		return
+	}
+
+	updated, err := app.db.GetPositionGroup(g.ID)
+	if err != nil {
+		http.Error(w, "Failed to load position group", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (app *Application) handleRemoveGroupTrade(w http.ResponseWriter, r *http.Request) {
+	g, ok := app.ownedGroup(w, r)
+	if !ok {
+		return
+	}
+	tradeID, ok := pathID(r, "trade_id")
+	if !ok {
+		http.Error(w, "Bad request: invalid trade ID", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := app.db.RemovePositionGroupTrade(g.ID, tradeID)
+	if err != nil {
+		log.Printf("Failed to remove position group trade: %v", err)
+		http.Error(w, "Failed to remove trade", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Trade not in position group", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := app.ownedGroup(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.db.DeletePositionGroup(g.ID); err != nil {
+		log.Printf("Failed to delete position group: %v", err)
+		http.Error(w, "Failed to delete position group", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleBasketOrder submits several orders together and groups the ones that
+// were placed. Every leg is validated before any is submitted; legs are then
+// placed one at a time, so a leg blocked by risk or the broker doesn't stop
+// the rest.
+func (app *Application) handleBasketOrder(w http.ResponseWriter, r *http.Request) {
+	receivedAt := clock.Now()
+	var req basketRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Legs) == 0 || len(req.Legs) > maxBasketLegs {
+		http.Error(w, "Bad request: a basket needs between 1 and 50 legs", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = database.GroupBasket
+	}
+	if !database.ValidGroupKind(req.Kind) {
+		http.Error(w, "Bad request: kind must be pair, spread, hedge, basket or other", http.StatusBadRequest)
+		return
+	}
+
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+	source, err := requestOrderSource(r, strategyID)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID := requestUserID(r)
+
+	legs := make([]*orders.Order, len(req.Legs))
+	for i, leg := range req.Legs {
+		legReq := &orderprotos.OrderRequest{
+			Symbol:      app.aliases.Resolve(leg.Symbol),
+			Side:        leg.Side,
+			Qty:         leg.Qty,
+			OrderType:   leg.OrderType,
+			TimeInForce: leg.TimeInForce,
+			LimitPrice:  leg.LimitPrice,
+			StopPrice:   leg.StopPrice,
+
+			ExtendedHours: leg.ExtendedHours,
+		}
+		if err := app.applyOrderDefaults(userID, legReq); err != nil {
+			log.Printf("Failed to load preferences: %v", err)
+			http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+			return
+		}
+		legs[i], err = orders.FromRequest(legReq, app.instruments)
+		if err != nil {
+			http.Error(w, "Bad request: leg "+leg.Symbol+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		legs[i].ReceivedAt = receivedAt
+		legs[i].Source = source
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		symbols := make([]string, len(legs))
+		for i, leg := range legs {
+			symbols[i] = leg.Symbol
+		}
+		req.Name = strings.Join(symbols, "/")
+	}
+
+	bodies := make([]any, len(req.Legs))
+	for i := range req.Legs {
+		bodies[i] = req.Legs[i]
+	}
+	resp, placed := app.placeBasket(r, userID, strategyID, req.Name, req.Kind, legs, bodies)
+	if !placed {
+		writeJSON(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// placeBasket submits legs one at a time, so a leg blocked by risk or the
+// broker doesn't stop the rest, and groups the trades of those placed as a
+// position group. bodies are what each leg's request looked like, captured
+// if it fails. It reports whether any leg was placed.
+func (app *Application) placeBasket(r *http.Request, userID string, strategyID *int64, name, kind string, legs []*orders.Order, bodies []any) (basketResponse, bool) {
+	resp := basketResponse{Legs: make([]basketLegResult, len(legs))}
+	var tradeIDs []int64
+	for i, order := range legs {
+		result := &resp.Legs[i]
+		result.Symbol = order.Symbol
+
+		trade, flags, err := app.submitOrder(userID, strategyID, order)
+		if err != nil {
+			result.Status = "error"
+			result.Message = err.Error()
+			result.TradeID, _ = rejectedTradeID(err)
+			app.captureFailure(requestCapture(r, jsonBody(bodies[i])), userID, err)
+			continue
+		}
+
+		result.Status = "success"
+		result.OrderID = trade.OrderID
+		result.TradeID = trade.ID
+		for _, f := range flags {
+			result.Message += describeFinding(f) + "; "
+		}
+		result.Message = strings.TrimSuffix(result.Message, "; ")
+		if trade.ID != 0 {
+			tradeIDs = append(tradeIDs, trade.ID)
+		}
+	}
+	if len(tradeIDs) == 0 {
+		return resp, false
+	}
+
+	id, err := app.db.CreatePositionGroup(&database.PositionGroup{
+		UserID:   userID,
+		Name:     name,
+		Kind:     kind,
+		TradeIDs: tradeIDs,
+	})
+	if err != nil {
+		log.Printf("Failed to group basket orders: %v", err)
+	} else if resp.Group, err = app.db.GetPositionGroup(id); err != nil {
+		log.Printf("Failed to load position group: %v", err)
+	}
+	return resp, true
+}
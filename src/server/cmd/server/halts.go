@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"desk/internal/halts"
+)
+
+// handleHalts lists the symbols currently halted on the data feed with their
+// last LULD bands, optionally only those in ?symbols=
+func (app *Application) handleHalts(w http.ResponseWriter, r *http.Request) {
+	if app.halts == nil {
+		http.Error(w, "Halt monitoring is not enabled (set HALT_FEED)", http.StatusServiceUnavailable)
+		return
+	}
+
+	symbols := querySymbols(r)
+	for i, s := range symbols {
+		symbols[i] = app.aliases.Resolve(s)
+	}
+
+	list := []halts.Halt{}
+	for _, h := range app.halts.Halts() {
+		if len(symbols) == 0 || slices.Contains(symbols, h.Symbol) {
+			list = append(list, h)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
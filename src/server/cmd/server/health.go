@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"desk/internal/lifecycle"
+	"desk/internal/marks"
+)
+
+// Readiness states
+const (
+	statusReady       = "ready"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+)
+
+type readinessCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readiness reports whether the server can take orders. Stale prices,
+// clock drift and a failed subsystem degrade it without taking it out of
+// service: a halted symbol shouldn't stop trading in the rest, drift only
+// makes latency figures untrustworthy, and most subsystems (news, the
+// time-series export) aren't on the order path.
+type readiness struct {
+	Status      string             `json:"status"`
+	Database    readinessCheck     `json:"database"`
+	Prices      readinessCheck     `json:"prices"`
+	Clock       readinessCheck     `json:"clock"`
+	Subsystems  readinessCheck     `json:"subsystems"`
+	StalePrices []marks.StalePrice `json:"stale_prices"`
+}
+
+// handleReadyz serves GET /readyz: 200 when ready or degraded, 503 when the
+// database can't be reached or the server is shutting down
+func (app *Application) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	ready := readiness{
+		Status:      statusReady,
+		Database:    readinessCheck{Status: statusReady},
+		Prices:      readinessCheck{Status: statusReady},
+		Clock:       readinessCheck{Status: statusReady},
+		Subsystems:  readinessCheck{Status: statusReady},
+		StalePrices: app.marks.StalePrices(),
+	}
+	if len(ready.StalePrices) > 0 {
+		ready.Prices.Status = statusDegraded
+		ready.Status = statusDegraded
+	}
+	if warnings := app.clockChecker.Status().Warnings; len(warnings) > 0 {
+		ready.Clock = readinessCheck{Status: statusDegraded, Error: strings.Join(warnings, "; ")}
+		ready.Status = statusDegraded
+	}
+
+	var failed []string
+	for _, c := range app.components.Status() {
+		if c.State == lifecycle.StateFailed {
+			failed = append(failed, c.Name+": "+c.Error)
+		}
+	}
+	if len(failed) > 0 {
+		ready.Subsystems = readinessCheck{Status: statusDegraded, Error: strings.Join(failed, "; ")}
+		ready.Status = statusDegraded
+	}
+
+	status := http.StatusOK
+	if app.components.Stopping() {
+		// Take the server out of the load balancer while it drains
+		ready.Subsystems = readinessCheck{Status: statusUnavailable, Error: "shutting down"}
+		ready.Status = statusUnavailable
+		status = http.StatusServiceUnavailable
+	}
+	if err := app.db.Ping(ctx); err != nil {
+		ready.Database = readinessCheck{Status: statusUnavailable, Error: err.Error()}
+		ready.Status = statusUnavailable
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, ready)
+}
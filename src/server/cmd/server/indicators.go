@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/indicators"
+	"desk/internal/mktdata"
+)
+
+// maxIndicatorSymbols caps how many symbols one indicator request computes,
+// since each needs its own bars request
+const maxIndicatorSymbols = 100
+
+// rsiHistory is how many bars beyond the period are fetched so Wilder
+// smoothing has settled
+const rsiHistory = 100
+
+type indicatorValue struct {
+	Symbol string           `json:"symbol"`
+	Value  *decimal.Decimal `json:"value,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// handleRSI computes RSI for a universe of symbols given by ?symbols= or
+// ?watchlist=, with optional period (default 14) and timeframe (1Min, 1Hour
+// or 1Day; default 1Day)
+func (app *Application) handleRSI(w http.ResponseWriter, r *http.Request) {
+	symbols, ok := app.requestSymbols(w, r)
+	if !ok {
+		return
+	}
+	if len(symbols) == 0 {
+		http.Error(w, "Bad request: symbols or watchlist is required", http.StatusBadRequest)
+		return
+	}
+	if len(symbols) > maxIndicatorSymbols {
+		http.Error(w, "Bad request: too many symbols", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	period := 14
+	if v := query.Get("period"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 || n > 200 {
+			http.Error(w, "Bad request: period must be between 2 and 200", http.StatusBadRequest)
+			return
+		}
+		period = n
+	}
+	timeframe := query.Get("timeframe")
+	if timeframe == "" {
+		timeframe = "1Day"
+	}
+	if !mktdata.SupportedTimeframe(timeframe) {
+		http.Error(w, "Bad request: timeframe must be 1Min, 1Hour or 1Day", http.StatusBadRequest)
+		return
+	}
+
+	values := make([]indicatorValue, len(symbols))
+	for i, symbol := range symbols {
+		values[i].Symbol = symbol
+		closes, err := app.marketData.Dashboard.RecentCloses(symbol, timeframe, period+rsiHistory)
+		if err != nil {
+			values[i].Error = err.Error()
+			continue
+		}
+		rsi, err := indicators.RSI(closes, period)
+		if err != nil {
+			values[i].Error = err.Error()
+			continue
+		}
+		values[i].Value = &rsi
+	}
+
+	writeJSON(w, http.StatusOK, values)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handleInstrument returns the rounding and lot size rules orders in a
+// symbol are checked against
+func (app *Application) handleInstrument(w http.ResponseWriter, r *http.Request) {
+	symbol := app.aliases.Resolve(r.PathValue("symbol"))
+	if symbol == "" {
+		http.Error(w, "Bad request: symbol is required", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, app.instruments.Lookup(symbol))
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+const (
+	defaultJournalPageSize = 50
+	maxJournalPageSize     = 500
+)
+
+type journalEntryRequest struct {
+	SessionDate string  `json:"session_date"`
+	Title       string  `json:"title"`
+	Thesis      string  `json:"thesis"`
+	Outcome     string  `json:"outcome"`
+	Lessons     string  `json:"lessons"`
+	TradeIDs    []int64 `json:"trade_ids"`
+}
+
+type updateJournalEntryRequest struct {
+	SessionDate *string  `json:"session_date"`
+	Title       *string  `json:"title"`
+	Thesis      *string  `json:"thesis"`
+	Outcome     *string  `json:"outcome"`
+	Lessons     *string  `json:"lessons"`
+	TradeIDs    *[]int64 `json:"trade_ids"`
+}
+
+// ownedJournalEntry loads the journal entry in the {id} path parameter,
+// writing an error response unless it belongs to the caller
+func (app *Application) ownedJournalEntry(w http.ResponseWriter, r *http.Request) (*database.JournalEntry, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid journal entry ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	e, err := app.db.GetJournalEntry(id)
+	if err != nil || e.UserID != requestUserID(r) {
+		http.Error(w, "Journal entry not found", http.StatusNotFound)
+		return nil, false
+	}
+	return e, true
+}
+
+// writeJournalError responds to a failure saving a journal entry
+func writeJournalError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrUnknownTrade) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Failed to save journal entry: %v", err)
+	http.Error(w, "Failed to save journal entry", http.StatusInternalServerError)
+}
+
+// validSessionDate reports whether date is a YYYY-MM-DD date
+func validSessionDate(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+// wantsMarkdown reports whether the caller asked for markdown, with
+// ?format=markdown or an Accept: text/markdown header
+func wantsMarkdown(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "markdown" || strings.Contains(r.Header.Get("Accept"), "text/markdown")
+}
+
+// writeMarkdown writes journal entries as one markdown document
+func writeMarkdown(w http.ResponseWriter, entries []database.JournalEntry) {
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprint(w, "\n---\n\n")
+		}
+		fmt.Fprintf(w, "# %s\n\n", e.Title)
+		fmt.Fprintf(w, "Session %s", e.SessionDate)
+		if len(e.TradeIDs) > 0 {
+			ids := make([]string, len(e.TradeIDs))
+			for j, id := range e.TradeIDs {
+				ids[j] = "#" + strconv.FormatInt(id, 10)
+			}
+			fmt.Fprintf(w, " · trades %s", strings.Join(ids, ", "))
+		}
+		fmt.Fprint(w, "\n")
+
+		for _, section := range []struct{ heading, body string }{
+			{"Thesis", e.Thesis},
+			{"Outcome", e.Outcome},
+			{"Lessons", e.Lessons},
+		} {
+			if strings.TrimSpace(section.body) != "" {
+				fmt.Fprintf(w, "\n## %s\n\n%s\n", section.heading, strings.TrimSpace(section.body))
+			}
+		}
+	}
+}
+
+// journalSessionDate picks the session date of a new entry: the date given,
+// else the session of the earliest linked trade, else today's
+func (app *Application) journalSessionDate(userID, date string, tradeIDs []int64) (string, error) {
+	if date != "" {
+		return date, nil
+	}
+	trades, err := app.db.GetUserTrades(userID, tradeIDs)
+	if err != nil {
+		return "", err
+	}
+	if len(trades) > 0 {
+		return market.SessionDate(trades[0].SubmittedAt), nil
+	}
+	return market.SessionDate(time.Now()), nil
+}
+
+// handleCreateJournalEntry writes a journal entry about a day and, optionally,
+// trades of the caller's
+func (app *Application) handleCreateJournalEntry(w http.ResponseWriter, r *http.Request) {
+	var req journalEntryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		http.Error(w, "Bad request: title is required", http.StatusBadRequest)
+		return
+	}
+	if req.SessionDate != "" && !validSessionDate(req.SessionDate) {
+		http.Error(w, "Bad request: session_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	date, err := app.journalSessionDate(userID, req.SessionDate, req.TradeIDs)
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+
+	id, err := app.db.CreateJournalEntry(&database.JournalEntry{
+		UserID:      userID,
+		SessionDate: date,
+		Title:       req.Title,
+		Thesis:      req.Thesis,
+		Outcome:     req.Outcome,
+		Lessons:     req.Lessons,
+		TradeIDs:    req.TradeIDs,
+	})
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+
+	created, err := app.db.GetJournalEntry(id)
+	if err != nil {
+		http.Error(w, "Failed to load journal entry", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// handleListJournal lists and searches the caller's journal, newest session
+// first. Query parameters: q (text search), trade_id, from and to (session
+// dates, inclusive), limit and format=markdown.
+func (app *Application) handleListJournal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := database.JournalQuery{
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+		Search: strings.TrimSpace(query.Get("q")),
+		Limit:  defaultJournalPageSize,
+	}
+	for _, d := range []string{q.From, q.To} {
+		if d != "" && !validSessionDate(d) {
+			http.Error(w, "Bad request: from and to must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("trade_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Bad request: invalid trade_id", http.StatusBadRequest)
+			return
+		}
+		q.TradeID = id
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = min(n, maxJournalPageSize)
+	}
+
+	entries, err := app.db.GetJournalEntries(requestUserID(r), q)
+	if err != nil {
+		log.Printf("Failed to load journal entries: %v", err)
+		http.Error(w, "Failed to load journal", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []database.JournalEntry{}
+	}
+
+	if wantsMarkdown(r) {
+		writeMarkdown(w, entries)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (app *Application) handleGetJournalEntry(w http.ResponseWriter, r *http.Request) {
+	e, ok := app.ownedJournalEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if wantsMarkdown(r) {
+		writeMarkdown(w, []database.JournalEntry{*e})
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// handleUpdateJournalEntry edits an entry; fields left out are unchanged and
+// trade_ids, if given, replaces the linked trades
+func (app *Application) handleUpdateJournalEntry(w http.ResponseWriter, r *http.Request) {
+	e, ok := app.ownedJournalEntry(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateJournalEntryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.SessionDate != nil {
+		if !validSessionDate(*req.SessionDate) {
+			http.Error(w, "Bad request: session_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		e.SessionDate = *req.SessionDate
+	}
+	if req.Title != nil {
+		e.Title = strings.TrimSpace(*req.Title)
+		if e.Title == "" {
+			http.Error(w, "Bad request: title cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Thesis != nil {
+		e.Thesis = *req.Thesis
+	}
+	if req.Outcome != nil {
+		e.Outcome = *req.Outcome
+	}
+	if req.Lessons != nil {
+		e.Lessons = *req.Lessons
+	}
+	if req.TradeIDs != nil {
+		e.TradeIDs = *req.TradeIDs
+	}
+
+	if err := app.db.UpdateJournalEntry(e); err != nil {
+		writeJournalError(w, err)
+		return
+	}
+
+	updated, err := app.db.GetJournalEntry(e.ID)
+	if err != nil {
+		http.Error(w, "Failed to load journal entry", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (app *Application) handleDeleteJournalEntry(w http.ResponseWriter, r *http.Request) {
+	e, ok := app.ownedJournalEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.db.DeleteJournalEntry(e.ID); err != nil {
+		log.Printf("Failed to delete journal entry: %v", err)
+		http.Error(w, "Failed to delete journal entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
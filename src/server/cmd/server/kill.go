@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/runner"
+)
+
+// killRequest is the optional body of POST /strategies/{id}/kill
+type killRequest struct {
+	Reason string `json:"reason"`
+	// Flatten closes the strategy's positions with market orders once its
+	// orders are canceled
+	Flatten bool `json:"flatten"`
+}
+
+// killedOrder is what became of one of a killed strategy's open orders
+type killedOrder struct {
+	TradeID int64  `json:"trade_id"`
+	OrderID string `json:"order_id"`
+	Symbol  string `json:"symbol"`
+	// Status is pending_cancel once the broker has been asked to cancel,
+	// canceled for a simulated order, or error
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type killResponse struct {
+	Strategy *database.Strategy `json:"strategy"`
+	// AlreadyKilled is set when the switch had been thrown before; the
+	// orders and positions are dealt with again all the same
+	AlreadyKilled bool `json:"already_killed"`
+	// Stopped reports whether a running process was stopped
+	Stopped             bool          `json:"stopped"`
+	ConditionalCanceled int64         `json:"conditional_canceled"`
+	Canceled            []killedOrder `json:"canceled"`
+	// Flatten is the outcome of the orders closing the strategy's
+	// positions, when asked for
+	Flatten *basketResponse `json:"flatten,omitempty"`
+}
+
+// handleKillStrategy throws one of the caller's strategies' kill switch. In
+// order, so nothing slips in between: the strategy is locked from starting
+// and from opening positions, its process is stopped, its pending
+// conditional and open orders are canceled and, with flatten, its positions
+// are closed at market. It stays locked until an admin clears it with
+// DELETE /admin/strategies/{id}/kill. Kills are made one at a time.
+func (app *Application) handleKillStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+	var req killRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "killed by " + requestUserID(r)
+	}
+
+	app.killMu.Lock()
+	defer app.killMu.Unlock()
+
+	// The lock comes first: the runner won't start a killed strategy, and
+	// its opening orders are blocked
+	killed, conditional, err := app.db.KillStrategy(strategy.ID, req.Reason, time.Now())
+	if err != nil {
+		log.Printf("Failed to kill strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to kill strategy", http.StatusInternalServerError)
+		return
+	}
+	resp := killResponse{AlreadyKilled: !killed, ConditionalCanceled: conditional, Canceled: []killedOrder{}}
+
+	switch err := app.runner.Stop(strategy.ID); {
+	case err == nil:
+		resp.Stopped = true
+	case !errors.Is(err, runner.ErrNotRunning):
+		// The lock holds, so it can't be restarted; cancel its orders anyway
+		log.Printf("Failed to stop killed strategy %d: %v", strategy.ID, err)
+	}
+
+	if resp.Canceled, err = app.cancelStrategyOrders(strategy.ID); err != nil {
+		log.Printf("Failed to cancel orders of killed strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Strategy killed but its orders could not be listed", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Flatten {
+		flatten, err := app.flattenStrategy(r, strategy)
+		if err != nil {
+			log.Printf("Failed to flatten killed strategy %d: %v", strategy.ID, err)
+			http.Error(w, "Strategy killed but its positions could not be loaded", http.StatusInternalServerError)
+			return
+		}
+		resp.Flatten = &flatten
+	}
+
+	if resp.Strategy, err = app.db.GetStrategyByID(strategy.ID); err != nil {
+		http.Error(w, "Failed to load strategy", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Killed strategy %d for user=%s: stopped=%t canceled=%d conditional=%d flatten=%t",
+		strategy.ID, strategy.UserID, resp.Stopped, len(resp.Canceled), conditional, req.Flatten)
+	notify.Send(context.Background(), app.notifier, notify.LevelWarning, "Strategy killed",
+		fmt.Sprintf("%s killed strategy %q (%d): %s. %s", requestUserID(r), strategy.Name, strategy.ID, req.Reason, describeKill(&resp)))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cancelStrategyOrders cancels every open order attributed to a strategy.
+// The broker cancels asynchronously, so its orders are left pending_cancel
+// for the trade update stream to settle; simulated orders only rest in the
+// book and are canceled there.
+func (app *Application) cancelStrategyOrders(strategyID int64) ([]killedOrder, error) {
+	open, err := app.db.GetOpenTrades("", clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	canceled := []killedOrder{}
+	for _, t := range open {
+		if t.StrategyID == nil || *t.StrategyID != strategyID || t.OrderID == "" {
+			continue
+		}
+		result := killedOrder{TradeID: t.ID, OrderID: t.OrderID, Symbol: t.Symbol, Status: orders.StatusPendingCancel}
+		if t.Venue == database.VenueSimulator {
+			result.Status = orders.StatusCanceled
+		} else if err := app.brokers.CancelOrder(t.OrderID); err != nil {
+			result.Status = "error"
+			result.Message = err.Error()
+			canceled = append(canceled, result)
+			continue
+		}
+		if err := app.db.UpdateTradeStatus(t.OrderID, result.Status, t.FilledQty, t.FilledAvgPrice, t.FilledAt); err != nil {
+			log.Printf("Failed to record cancel of order %s: %v", t.OrderID, err)
+		}
+		canceled = append(canceled, result)
+	}
+	return canceled, nil
+}
+
+// flattenStrategy closes a strategy's positions with market orders, placed
+// as a basket. The orders only reduce positions, so the kill doesn't block
+// them.
+func (app *Application) flattenStrategy(r *http.Request, strategy *database.Strategy) (basketResponse, error) {
+	positions, err := app.db.GetBookPositionCosts(database.CashBook{UserID: strategy.UserID, StrategyID: strategy.ID})
+	if err != nil {
+		return basketResponse{}, err
+	}
+	var legs []*orders.Order
+	var bodies []any
+	receivedAt := clock.Now()
+	for _, p := range positions {
+		side := "sell"
+		if p.Qty.IsNegative() {
+			side = "buy"
+		}
+		assetClass := orders.AssetClassOf(p.Symbol)
+		// Crypto orders can't be day orders
+		tif := "day"
+		if assetClass == orders.AssetClassCrypto {
+			tif = "gtc"
+		}
+		order := &orders.Order{
+			Symbol:      p.Symbol,
+			AssetClass:  assetClass,
+			Side:        side,
+			Type:        "market",
+			TimeInForce: tif,
+			Qty:         p.Qty.Abs(),
+			ReceivedAt:  receivedAt,
+			Source:      orders.SourceAlgo,
+		}
+		legs = append(legs, order)
+		bodies = append(bodies, order)
+	}
+	if len(legs) == 0 {
+		return basketResponse{Legs: []basketLegResult{}}, nil
+	}
+	resp, _ := app.placeBasket(r, strategy.UserID, &strategy.ID, "kill", database.GroupBasket, legs, bodies)
+	return resp, nil
+}
+
+// describeKill summarizes what a kill did
+func describeKill(resp *killResponse) string {
+	var parts []string
+	if resp.Stopped {
+		parts = append(parts, "process stopped")
+	}
+	failed := 0
+	for _, o := range resp.Canceled {
+		if o.Status == "error" {
+			failed++
+		}
+	}
+	parts = append(parts, fmt.Sprintf("%d orders canceled", len(resp.Canceled)-failed))
+	if failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d cancels failed", failed))
+	}
+	if resp.ConditionalCanceled > 0 {
+		parts = append(parts, fmt.Sprintf("%d conditional orders canceled", resp.ConditionalCanceled))
+	}
+	if resp.Flatten != nil {
+		placed := 0
+		for _, leg := range resp.Flatten.Legs {
+			if leg.Status == "success" {
+				placed++
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d of %d closing orders placed", placed, len(resp.Flatten.Legs)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// handleListKilledStrategies lists the killed strategies on the admin port
+func (app *Application) handleListKilledStrategies(w http.ResponseWriter, r *http.Request) {
+	strategies, err := app.db.GetKilledStrategies()
+	if err != nil {
+		log.Printf("Failed to load killed strategies: %v", err)
+		http.Error(w, "Failed to load killed strategies", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, strategies)
+}
+
+// handleClearKill clears a strategy's kill switch on the admin port. It
+// stays stopped; its owner starts it again.
+func (app *Application) handleClearKill(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid strategy ID", http.StatusBadRequest)
+		return
+	}
+	cleared, err := app.db.ClearStrategyKill(id)
+	if err != nil {
+		log.Printf("Failed to clear kill of strategy %d: %v", id, err)
+		http.Error(w, "Failed to clear kill", http.StatusInternalServerError)
+		return
+	}
+	if !cleared {
+		http.Error(w, "Strategy is not killed", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
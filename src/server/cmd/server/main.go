@@ -1,153 +1,363 @@
 package main
 
 import (
-	"io"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"google.golang.org/protobuf/proto"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 
 	"desk/internal/alpaca"
+	"desk/internal/analytics"
+	"desk/internal/archive"
+	"desk/internal/artifacts"
+	"desk/internal/backup"
+	"desk/internal/blotter"
+	"desk/internal/calendar"
+	"desk/internal/capture"
+	"desk/internal/carry"
+	"desk/internal/cashsweep"
+	"desk/internal/chaos"
+	"desk/internal/checklist"
+	"desk/internal/clock"
+	"desk/internal/conditional"
+	"desk/internal/config"
+	"desk/internal/confirm"
 	"desk/internal/database"
+	"desk/internal/deploy"
+	"desk/internal/dividends"
+	"desk/internal/events"
+	"desk/internal/fixture"
+	"desk/internal/halts"
+	"desk/internal/hedge"
+	"desk/internal/instruments"
+	"desk/internal/latency"
+	"desk/internal/lifecycle"
+	"desk/internal/marks"
+	"desk/internal/mktdata"
+	"desk/internal/netting"
+	"desk/internal/news"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/pnl"
+	"desk/internal/positions"
 	orderprotos "desk/internal/protos/orders"
+	"desk/internal/reports"
+	"desk/internal/risk"
+	"desk/internal/runner"
+	"desk/internal/screener"
+	"desk/internal/secrets"
+	"desk/internal/simulator"
+	"desk/internal/storage"
+	"desk/internal/sweeper"
+	"desk/internal/symbols"
+	"desk/internal/tca"
+	"desk/internal/tenants"
+	"desk/internal/tradeupdates"
+	"desk/internal/tsdb"
+	"desk/internal/watchlist"
 )
 
 type Application struct {
-	alpacaClient *alpaca.Client
-	db           *database.DB
+	brokers           *brokers
+	tenants           *tenants.Registry
+	marketData        *mktdata.Selection
+	brokerLatency     *latency.Recorder
+	simulator         *simulator.Simulator
+	marks             *marks.Engine
+	riskSnapshots     *risk.Snapshotter
+	greeks            *risk.GreeksMonitor
+	halts             *halts.Monitor
+	dailyAggregates   *pnl.DailyRecorder
+	gtcOrders         *sweeper.GTCManager
+	tradeUpdates      *tradeupdates.Consumer
+	carry             *carry.Accruer
+	dividends         *dividends.Importer
+	weeklyReports     *reports.Generator
+	public            *publicPerformance
+	backups           *backup.Manager
+	conditionalOrders *conditional.Engine
+	hedger            *hedge.Hedger
+	exposureAlerts    *notify.Alerter
+	netting           *netting.Netter
+	clock             clock.Clock
+	clockChecker      *clock.Checker
+	checklists        *checklist.Runner
+	captures          *capture.Recorder
+	nonces            *risk.Nonces
+	tickets           *confirm.Store
+	killMu            sync.Mutex
+	onboarding        onboardingDefaults
+	timeInForces      orders.TimeInForceDefaults
+	news              *news.Relay
+	blotter           *blotter.Feed
+	positionFeed      *positions.Feed
+	sockets           *sockets
+	components        *lifecycle.Manager
+	watchlistSync     *watchlist.Syncer
+	screener          *screener.Screener
+	tca               *tca.Analyzer
+	runner            *runner.Runner
+	runnerConfig      runner.Config
+	artifacts         *artifacts.Manager
+	artifactMaxBytes  int64
+	backtestWorkers   int
+	events            *events.Bus
+	deployer          *deploy.Deployer
+	secrets           *secrets.Box
+	chaos             *chaos.Injector
+	universesMu       sync.RWMutex
+	universes         map[string][]string
+	allocationsMu     sync.RWMutex
+	allocations       map[string]decimal.Decimal
+	overnightMu       sync.RWMutex
+	overnightLimits   risk.OvernightLimits
+	overnightAction   string
+	overnightLead     time.Duration
+	cashMu            sync.RWMutex
+	cashRules         cashsweep.Rules
+	cashAction        string
+	cashUser          string
+	concentrationMu   sync.RWMutex
+	concentration     risk.ConcentrationLimits
+	customRulesMu     sync.RWMutex
+	customRules       []risk.CustomRuleDef
+	confirmSourcesMu  sync.RWMutex
+	confirmSources    map[string]bool
+	volumes           *risk.AverageVolumes
+	aliases           *symbols.Aliases
+	instruments       *instruments.Registry
+	preTrade          *risk.Rules
+	notifier          *notify.Switch
+	userNotifier      *notify.Users
+	configFile        *config.File
+	store             storage.Store
+	consoleWrites     bool
+	analytics         *analytics.Engine
+	db                *database.DB
 }
 
 func (app *Application) handleOrder(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
+	receivedAt := app.clock.Now()
+	body, release, err := readBody(r)
 	if err != nil {
 		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
 		return
 	}
+	defer release()
 
 	var orderReq orderprotos.OrderRequest
-	if err := proto.Unmarshal(body, &orderReq); err != nil {
+	if err := unmarshalProto(r, body, &orderReq); err != nil {
 		http.Error(w, "Bad request: Failed to unmarshal protobuf", http.StatusBadRequest)
 		return
 	}
 
-	// Extract user ID from request header (for now, use a default or header value)
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		userID = "default_user" // Default for testing
+	userID := requestUserID(r)
+
+	// Optional strategy attribution
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+	source, err := requestOrderSource(r, strategyID)
+	if err != nil {
+		writeOrderError(w, r, http.StatusBadRequest, &orderReq, err)
+		return
+	}
+	// The desk may require orders from some sources to go through tickets
+	if app.confirmSource(source) {
+		w.Header().Set("X-Reject-Code", "CONFIRMATION_REQUIRED")
+		writeOrderError(w, r, http.StatusPreconditionRequired, &orderReq, fmt.Errorf("confirmation required: %s orders are placed with POST /orders/tickets and confirmed", source))
+		return
 	}
 
 	log.Printf("Received order request: User=%s Symbol=%s Qty=%s Side=%s Type=%s",
 		userID, orderReq.GetSymbol(), orderReq.GetQty(), orderReq.GetSide(), orderReq.GetOrderType())
 
-	placedOrder, err := app.alpacaClient.PlaceOrder(&orderReq)
+	// Trade aliases under the symbol they stand for, so one instrument isn't
+	// split across symbols in trades and positions
+	orderReq.Symbol = app.aliases.Resolve(orderReq.GetSymbol())
+
+	// Manual orders, and orders that leave their type or time in force to
+	// the user's defaults, need the user's preferences; read them once
+	if source == orders.SourceManual || needsOrderDefaults(&orderReq) {
+		prefs, err := app.db.GetPreferences(userID)
+		if err != nil {
+			log.Printf("Failed to load preferences of user=%s: %v", userID, err)
+			writeOrderError(w, r, http.StatusInternalServerError, &orderReq, err)
+			return
+		}
+
+		// Users who confirm their orders place manual ones through tickets
+		if source == orders.SourceManual && prefs.ConfirmOrders {
+			w.Header().Set("X-Reject-Code", "CONFIRMATION_REQUIRED")
+			writeOrderError(w, r, http.StatusPreconditionRequired, &orderReq, errConfirmationRequired)
+			return
+		}
+		fillOrderDefaults(prefs, app.timeInForces, &orderReq)
+	}
+
+	// Reject malformed orders before they reach a broker
+	order, err := orders.FromRequest(&orderReq, app.instruments)
 	if err != nil {
-		log.Printf("Failed to place order: %v", err)
-
-		// Log failed trade to database
-		errMsg := err.Error()
-		trade := &database.Trade{
-			UserID:       userID,
-			OrderID:      "", // No order ID for failed orders
-			Symbol:       orderReq.GetSymbol(),
-			Qty:          orderReq.GetQty(),
-			Side:         orderReq.GetSide(),
-			OrderType:    orderReq.GetOrderType(),
-			TimeInForce:  orderReq.GetTimeInForce(),
-			OrderStatus:  "rejected",
-			SubmittedAt:  time.Now(),
-			ErrorMessage: &errMsg,
-		}
-		if limitPrice := orderReq.GetLimitPrice(); limitPrice != "" {
-			trade.LimitPrice = &limitPrice
-		}
-		if stopPrice := orderReq.GetStopPrice(); stopPrice != "" {
-			trade.StopPrice = &stopPrice
-		}
-
-		if _, dbErr := app.db.LogTrade(trade); dbErr != nil {
-			log.Printf("Failed to log rejected trade to database: %v", dbErr)
-		}
-
-		// Create error response
-		errorResp := &orderprotos.OrderResponse{
-			Status:  "error",
-			Message: err.Error(),
-			Symbol:  orderReq.GetSymbol(),
-			Qty:     orderReq.GetQty(),
-			Side:    orderReq.GetSide(),
-		}
-
-		respBytes, _ := proto.Marshal(errorResp)
-		w.Header().Set("Content-Type", "application/x-protobuf")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(respBytes)
+		log.Printf("Rejected invalid order from user=%s: %v", userID, err)
+		writeOrderError(w, r, http.StatusBadRequest, &orderReq, err)
+		return
+	}
+	order.ReceivedAt = receivedAt
+	order.Source = source
+	if order.ClientTime, order.Nonce, err = requestClientClock(r); err != nil {
+		log.Printf("Rejected order from user=%s: %v", userID, err)
+		writeOrderError(w, r, http.StatusBadRequest, &orderReq, err)
 		return
 	}
 
-	log.Printf("Successfully placed order - ID: %s, Status: %s", placedOrder.ID, placedOrder.Status)
-
-	// Log successful trade to database
-	filledAvgPrice := placedOrder.FilledAvgPrice.String()
-	trade := &database.Trade{
-		UserID:         userID,
-		OrderID:        placedOrder.ID,
-		Symbol:         placedOrder.Symbol,
-		Qty:            placedOrder.Qty.String(),
-		Side:           string(placedOrder.Side),
-		OrderType:      string(placedOrder.Type),
-		TimeInForce:    string(placedOrder.TimeInForce),
-		FilledQty:      placedOrder.FilledQty.String(),
-		FilledAvgPrice: &filledAvgPrice,
-		OrderStatus:    string(placedOrder.Status),
-		SubmittedAt:    time.Now(),
+	// Compute the quantity of orders that state a sizing mode instead
+	if order.Sizing != nil {
+		if err := app.sizeOrder(userID, order); err != nil {
+			status := http.StatusInternalServerError
+			var invalid *orders.ValidationError
+			if errors.As(err, &invalid) {
+				status = http.StatusBadRequest
+			}
+			log.Printf("Failed to size order from user=%s: %v", userID, err)
+			writeOrderError(w, r, status, &orderReq, err)
+			return
+		}
+		log.Printf("Sized order from user=%s by %s %s: %s %s", userID, order.Sizing.Mode, order.Sizing.Fraction, order.Qty, order.Symbol)
+		orderReq.Qty = order.Qty.String()
 	}
-	if limitPrice := orderReq.GetLimitPrice(); limitPrice != "" {
-		trade.LimitPrice = &limitPrice
+
+	// Hold strategies' market orders to net them against each other
+	if app.nettable(userID, strategyID, order) {
+		app.queueSignal(w, r, body, userID, *strategyID, order, &orderReq)
+		return
 	}
-	if stopPrice := orderReq.GetStopPrice(); stopPrice != "" {
-		trade.StopPrice = &stopPrice
+
+	trade, flags, err := app.submitOrder(userID, strategyID, order)
+	if err != nil {
+		app.captureFailure(requestCapture(r, orderRequestJSON(r, body)), userID, err)
+		status := http.StatusInternalServerError
+		var blocked *risk.BlockedError
+		if errors.As(err, &blocked) {
+			status = http.StatusForbidden
+		}
+		writeOrderError(w, r, status, &orderReq, err)
+		return
 	}
 
-	if _, err := app.db.LogTrade(trade); err != nil {
-		log.Printf("Failed to log trade to database: %v", err)
+	message := "Order placed successfully"
+	if order.Sizing != nil {
+		message += fmt.Sprintf("; sized to %s by %s", order.Qty, order.Sizing.Mode)
+	}
+	for _, f := range flags {
+		message += "; " + describeFinding(f)
 	}
 
 	// Create success response
 	successResp := &orderprotos.OrderResponse{
-		Status:      "success",
-		OrderId:     placedOrder.ID,
-		Message:     "Order placed successfully",
-		Symbol:      placedOrder.Symbol,
-		Qty:         placedOrder.Qty.String(),
-		Side:        string(placedOrder.Side),
-		FilledQty:   placedOrder.FilledQty.String(),
-		OrderStatus: string(placedOrder.Status),
+		Status:        "success",
+		OrderId:       trade.OrderID,
+		Message:       message,
+		Symbol:        trade.Symbol,
+		Qty:           trade.Qty.String(),
+		Side:          trade.Side,
+		FilledQty:     trade.FilledQty.String(),
+		OrderStatus:   trade.OrderStatus,
+		ClientOrderId: trade.ClientOrderID,
 	}
 
-	respBytes, err := proto.Marshal(successResp)
-	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-		return
+	writeProto(w, r, http.StatusCreated, successResp)
+}
+
+// writeOrderError responds to a failed order request with an error OrderResponse
+func writeOrderError(w http.ResponseWriter, r *http.Request, status int, orderReq *orderprotos.OrderRequest, err error) {
+	var blocked *risk.BlockedError
+	if errors.As(err, &blocked) && blocked.Code() != "" {
+		w.Header().Set("X-Reject-Code", blocked.Code())
+	}
+
+	errorResp := &orderprotos.OrderResponse{
+		Status:  "error",
+		Message: err.Error(),
+		Symbol:  orderReq.GetSymbol(),
+		Qty:     orderReq.GetQty(),
+		Side:    orderReq.GetSide(),
 	}
 
-	w.Header().Set("Content-Type", "application/x-protobuf")
-	w.WriteHeader(http.StatusCreated)
-	w.Write(respBytes)
+	writeProto(w, r, status, errorResp)
 }
 
 func main() {
+	// "validate" checks the deployment and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Stdout))
+	}
+	// "export-research" writes an anonymized trade dataset and exits
+	if len(os.Args) > 1 && os.Args[1] == "export-research" {
+		os.Exit(runExportResearch(os.Args[2:]))
+	}
+	// "export-audit" writes the order audit export and exits
+	if len(os.Args) > 1 && os.Args[1] == "export-audit" {
+		os.Exit(runExportAudit(os.Args[2:]))
+	}
+	// "fsck" checks the database's integrity, optionally fixing it, and exits
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		os.Exit(runFsck(os.Args[2:]))
+	}
+
+	// Settings in CONFIG_FILE override the environment and can be reloaded
+	// with SIGHUP or POST /admin/reload
+	var configFile *config.File
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		var err error
+		if configFile, err = config.Load(path); err != nil {
+			log.Fatalf("Invalid CONFIG_FILE: %v", err)
+		}
+	}
+
 	apiKey := os.Getenv("APCA_API_KEY_ID")
 	apiSecret := os.Getenv("APCA_API_SECRET_KEY")
 	baseURL := os.Getenv("APCA_API_BASE_URL")
 	dbPath := os.Getenv("DB_PATH")
 
+	// Demo mode trades against a local Alpaca fixture instead of Alpaca, so
+	// the desk runs end to end offline without an account
+	var dataURL string
+	if os.Getenv("DEMO_MODE") == "true" {
+		scenarios, err := fixture.ParseScenarios(os.Getenv("DEMO_SCENARIOS"))
+		if err != nil {
+			log.Fatalf("Invalid DEMO_SCENARIOS: %v", err)
+		}
+		demoPort := os.Getenv("DEMO_PORT")
+		if demoPort == "" {
+			demoPort = "0"
+		}
+		fixtureURL, err := startDemo("127.0.0.1:"+demoPort, scenarios)
+		if err != nil {
+			log.Fatalf("Failed to start the Alpaca fixture: %v", err)
+		}
+		apiKey, apiSecret = "demo", "demo"
+		baseURL, dataURL = fixtureURL, fixtureURL
+		if dbPath == "" {
+			dbPath = "./demo_desk.db"
+		}
+		log.Printf("WARNING: demo mode, trading against the Alpaca fixture at %s", fixtureURL)
+	}
+
 	if apiKey == "" || apiSecret == "" {
 		log.Fatal("Error: APCA_API_KEY_ID and APCA_API_SECRET_KEY must be set in environment.")
 	}
@@ -163,39 +373,1091 @@ func main() {
 		dbPath = "./trading_desk.db"
 	}
 
+	// Time every request to Alpaca, per endpoint, against its SLO
+	brokerSLOs, err := latency.ParseSLOs(os.Getenv("BROKER_LATENCY_SLO"))
+	if err != nil {
+		log.Fatalf("Invalid BROKER_LATENCY_SLO: %v", err)
+	}
+	sloMinutes := 5
+	if v := os.Getenv("BROKER_LATENCY_SLO_MINUTES"); v != "" {
+		if sloMinutes, err = strconv.Atoi(v); err != nil || sloMinutes < 1 {
+			log.Fatalf("Invalid BROKER_LATENCY_SLO_MINUTES: %q", v)
+		}
+	}
+	brokerLatency := latency.NewRecorder(brokerSLOs)
+
 	// Initialize Alpaca client
-	client, err := alpaca.NewClient(apiKey, apiSecret, baseURL)
+	client, err := alpaca.NewClient(apiKey, apiSecret, baseURL, brokerLatency.HTTPClient())
 	if err != nil {
 		log.Fatalf("Failed to initialize Alpaca client: %v", err)
 	}
 
+	// Initialize market data: Alpaca's client serves streams and news, and
+	// each use of prices and bars takes them from its chosen provider
+	dataClient := alpaca.NewDataClient(apiKey, apiSecret, dataURL, brokerLatency.HTTPClient())
+	marketData, err := mktdata.Select(
+		os.Getenv("MARKET_DATA_LIVE"), os.Getenv("MARKET_DATA_BACKTEST"), os.Getenv("MARKET_DATA_DASHBOARD"),
+		mktdata.Config{Alpaca: dataClient, PolygonAPIKey: os.Getenv("POLYGON_API_KEY")},
+	)
+	if err != nil {
+		log.Fatalf("Invalid market data provider: %v", err)
+	}
+	sim := simulator.New(marketData.Live, clock.System)
+
+	// Artifacts, backups, exports and archived marks share one object store,
+	// so the machine's own disk can be disposable
+	store, err := openStore()
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	backupStore := storage.WithPrefix(store, "backups")
+
+	// On a fresh machine, start from the newest backup
+	if v := os.Getenv("RESTORE_FROM_BACKUP"); v != "" {
+		restore, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid RESTORE_FROM_BACKUP: %v", err)
+		}
+		if restore {
+			key, err := backup.Restore(context.Background(), backupStore, dbPath)
+			if err != nil {
+				log.Fatalf("Failed to restore database: %v", err)
+			}
+			if key != "" {
+				log.Printf("Restored database from backups/%s", key)
+			}
+		}
+	}
+
 	// Initialize database
 	db, err := database.NewDB(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
 
-	app := &Application{
-		alpacaClient: client,
-		db:           db,
+	// Publish every trade written to the blotter stream
+	blotterFeed := blotter.NewFeed(db)
+	db.OnTradeChange(blotterFeed.Changed)
+
+	// Optionally share the desk between chapters, each with its own users,
+	// token, limits and possibly Alpaca account
+	var chapters *tenants.Registry
+	if path := os.Getenv("TENANTS_FILE"); path != "" {
+		if chapters, err = tenants.Load(path); err != nil {
+			log.Fatalf("Invalid TENANTS_FILE: %v", err)
+		}
+		log.Printf("Serving %d chapters from %s", len(chapters.Chapters()), path)
+	}
+	chapterAccounts, err := connectChapters(chapters, baseURL, brokerLatency)
+	if err != nil {
+		log.Fatalf("Failed to initialize chapter accounts: %v", err)
 	}
 
-	// Register the handler method
-	http.HandleFunc("/order", app.handleOrder)
+	// The API is built on the broker, database, clock and notifier; the
+	// subsystems behind the rest of it are added as they are wired below
+	app := newApplication(Dependencies{
+		Broker:   client,
+		Chapters: chapterAccounts,
+		Tenants:  chapters,
+		DB:       db,
+		Clock:    clock.System,
+		Notifier: notify.Log{},
+	})
+	accounts := app.brokers
 
+	// Start every subsystem in dependency order once the server is wired,
+	// and stop them in reverse on SIGINT or SIGTERM. Each has
+	// COMPONENT_TIMEOUT to start or stop unless it sets its own, and the
+	// whole shutdown SHUTDOWN_TIMEOUT.
+	componentTimeout := 10 * time.Second
+	shutdownTimeout := 30 * time.Second
+	for name, d := range map[string]*time.Duration{"COMPONENT_TIMEOUT": &componentTimeout, "SHUTDOWN_TIMEOUT": &shutdownTimeout} {
+		if v := os.Getenv(name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil || *d <= 0 {
+				log.Fatalf("Invalid %s: %q", name, v)
+			}
+		}
+	}
+	components := lifecycle.New(componentTimeout)
+	components.Add(lifecycle.Component{
+		Name: "database",
+		Stop: func(context.Context) error { return db.Close() },
+	})
+
+	aliases, err := loadAliases(db)
+	if err != nil {
+		log.Fatalf("Failed to load symbol aliases: %v", err)
+	}
+
+	dailyAggregates := pnl.NewDailyRecorder(db)
+	if err := dailyAggregates.Backfill(); err != nil {
+		log.Fatalf("Failed to backfill daily aggregates: %v", err)
+	}
+
+	// Start periodic risk snapshots for the dashboard
+	snapshotInterval := 5 * time.Second
+	if v := os.Getenv("RISK_SNAPSHOT_INTERVAL"); v != "" {
+		if snapshotInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid RISK_SNAPSHOT_INTERVAL: %v", err)
+		}
+	}
+	// Risk limits, symbol lists and notification settings
+	live, err := loadSettings(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Round and check order quantities and prices to each symbol's lots
+	// and ticks, with the overrides in INSTRUMENTS_FILE
+	instrumentRules := instruments.New(live.instruments)
+
+	components.Add(lifecycle.Component{Name: "blotter", DependsOn: []string{"database"}, Run: lifecycle.Func(blotterFeed.Run)})
+
+	// Mark open positions to the latest prices; unrealized P&L, risk
+	// snapshots, price triggers and carry all read prices through the marks
+	markInterval := 10 * time.Second
+	if v := os.Getenv("MARK_INTERVAL"); v != "" {
+		if markInterval, err = time.ParseDuration(v); err != nil || markInterval <= 0 {
+			log.Fatalf("Invalid MARK_INTERVAL: %q", v)
+		}
+	}
+	markPersistInterval := 5 * time.Minute
+	if v := os.Getenv("MARK_PERSIST_INTERVAL"); v != "" {
+		if markPersistInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid MARK_PERSIST_INTERVAL: %v", err)
+		}
+	}
+	markRetention := 30 * 24 * time.Hour
+	if v := os.Getenv("MARK_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			log.Fatalf("Invalid MARK_RETENTION_DAYS: %q", v)
+		}
+		markRetention = time.Duration(days) * 24 * time.Hour
+	}
+	// Archived marks are moved to the store by the archiver after the close
+	// rather than deleted by the engine as they age out
+	archiveMarks := false
+	if v := os.Getenv("ARCHIVE_MARKS"); v != "" {
+		if archiveMarks, err = strconv.ParseBool(v); err != nil {
+			log.Fatalf("Invalid ARCHIVE_MARKS: %v", err)
+		}
+	}
+	engineRetention := markRetention
+	if archiveMarks {
+		engineRetention = 0
+	}
+	positionMarks := marks.NewEngine(db, marketData.Live, markInterval, markPersistInterval, engineRetention)
+	// Mark active strategies' symbols from the first refresh, and again from
+	// the pre-open checklist, so the first orders find their prices warm
+	warmupMax := 200
+	if v := os.Getenv("WARMUP_MAX_SYMBOLS"); v != "" {
+		if warmupMax, err = strconv.Atoi(v); err != nil || warmupMax < 0 {
+			log.Fatalf("Invalid WARMUP_MAX_SYMBOLS: %q", v)
+		}
+	}
+	if n, err := warmQuotes(db, aliases, positionMarks, warmupMax); err != nil {
+		log.Printf("Failed to warm quotes: %v", err)
+	} else if n > 0 {
+		log.Printf("Warming quotes of %d strategy symbols", n)
+	}
+	components.Add(lifecycle.Component{Name: "marks", DependsOn: []string{"database"}, Run: lifecycle.Func(positionMarks.Run)})
+	prices := markedData{DataClient: dataClient, marks: positionMarks}
+
+	riskSnapshots := risk.NewSnapshotter(client, positionMarks, snapshotInterval, live.drawdownLimit)
+	// Chart leverage by persisting a snapshot's every LEVERAGE_HISTORY_INTERVAL
+	leverageInterval := time.Minute
+	if v := os.Getenv("LEVERAGE_HISTORY_INTERVAL"); v != "" {
+		if leverageInterval, err = time.ParseDuration(v); err != nil || leverageInterval < 0 {
+			log.Fatalf("Invalid LEVERAGE_HISTORY_INTERVAL: %q", v)
+		}
+	}
+	leverageRetention := 90 * 24 * time.Hour
+	if v := os.Getenv("LEVERAGE_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("Invalid LEVERAGE_RETENTION_DAYS: %q", v)
+		}
+		leverageRetention = time.Duration(days) * 24 * time.Hour
+	}
+	if leverageInterval > 0 {
+		riskSnapshots.RecordLeverage(db, leverageInterval, leverageRetention)
+	}
+	components.Add(lifecycle.Component{Name: "risk", DependsOn: []string{"marks"}, Run: lifecycle.Func(riskSnapshots.Run)})
+
+	// Stream positions and risk as a snapshot followed by what changes
+	positionFeed := positions.NewFeed(riskSnapshots)
+	components.Add(lifecycle.Component{Name: "positions", DependsOn: []string{"risk"}, Run: lifecycle.Func(positionFeed.Run)})
+
+	// Price positions for portfolio greeks and the greek limits
+	greeksInterval := 30 * time.Second
+	if v := os.Getenv("GREEKS_INTERVAL"); v != "" {
+		if greeksInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid GREEKS_INTERVAL: %v", err)
+		}
+	}
+	riskFreeRate := 0.04
+	if v := os.Getenv("RISK_FREE_RATE"); v != "" {
+		if riskFreeRate, err = strconv.ParseFloat(v, 64); err != nil {
+			log.Fatalf("Invalid RISK_FREE_RATE: %v", err)
+		}
+	}
+	greeks := risk.NewGreeksMonitor(client, prices, greeksInterval, riskFreeRate)
+	components.Add(lifecycle.Component{Name: "greeks", DependsOn: []string{"marks"}, Run: lifecycle.Func(greeks.Run)})
+
+	// Reconcile DAY orders after every session close
+	notifier := app.notifier
+	// Check exposure, concentration and cash against the alert thresholds
+	// every time positions are marked
+	exposureAlerts := notify.NewAlerter(notifier)
+	components.Add(lifecycle.Component{Name: "alerts", Run: lifecycle.Func(exposureAlerts.Run)})
+	checkAlerts := checkExposure(exposureAlerts, riskSnapshots)
+	positionMarks.OnRefresh(func(marked []database.PositionMark) {
+		checkAlerts(marked)
+		positionFeed.Refreshed(marked)
+	})
+	// Without SLOs there is nothing to check, and Run returns at once
+	if !brokerSLOs.Empty() {
+		components.Add(lifecycle.Component{Name: "broker-latency", Run: lifecycle.Func(func(ctx context.Context) {
+			brokerLatency.Run(ctx, sloMinutes, notifier)
+		})})
+	}
+	// Notifications about one user's orders also go to the user's channels
+	userNotifier := app.userNotifier
+	sweepDelay := 15 * time.Minute
+	if v := os.Getenv("DAY_ORDER_SWEEP_DELAY"); v != "" {
+		if sweepDelay, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid DAY_ORDER_SWEEP_DELAY: %v", err)
+		}
+	}
+
+	// Record order events from every account as they happen, coalescing
+	// bursts of fills into one write per order per window
+	tradeUpdatesWindow := 200 * time.Millisecond
+	if v := os.Getenv("TRADE_UPDATES_BATCH_WINDOW"); v != "" {
+		if tradeUpdatesWindow, err = time.ParseDuration(v); err != nil || tradeUpdatesWindow <= 0 {
+			log.Fatalf("Invalid TRADE_UPDATES_BATCH_WINDOW: %q", v)
+		}
+	}
+	tradeUpdateSources := make(map[string]tradeupdates.Source)
+	for chapter, client := range accounts.accounts() {
+		tradeUpdateSources[chapter] = client
+	}
+	// Orders found at the broker after downtime that the desk never logged
+	// are booked to RECOVERY_USER, in the chapter whose account they're in
+	recoveryUser := "desk"
+	if v := os.Getenv("RECOVERY_USER"); v != "" {
+		recoveryUser = v
+	}
+	recoveryUserOf := func(chapter string) string {
+		if chapters != nil {
+			for _, c := range chapters.Chapters() {
+				if c.ID == chapter {
+					return c.UserID(recoveryUser)
+				}
+			}
+		}
+		return recoveryUser
+	}
+	tradeUpdates := tradeupdates.NewConsumer(tradeUpdateSources, db, dailyAggregates, tradeUpdatesWindow,
+		accounts.accountOf, recoveryUserOf)
+	components.Add(lifecycle.Component{Name: "trade-updates", DependsOn: []string{"database"}, Run: lifecycle.Func(tradeUpdates.Run)})
+
+	daySweeper := sweeper.NewDaySweeper(accounts, db, dailyAggregates, userNotifier)
+
+	// Charge borrow fees and margin interest once the sweep has settled the
+	// session's fills
+	carryAccruer := carry.NewAccruer(db, positionMarks, notifier)
+
+	// Book the dividends paid into each account to the books holding them
+	dividendImporter := dividends.NewImporter(db, func() map[string]dividends.Source {
+		sources := make(map[string]dividends.Source)
+		for chapter, client := range accounts.accounts() {
+			sources[chapter] = client
+		}
+		return sources
+	}, accounts.accountOf, notifier)
+
+	// Send weekly performance reports once Friday's carry is booked
+	weeklyReports := reports.NewGenerator(db, notifier, chapters)
+
+	// Check the desk is fit to trade this long before every open
+	openLead := 30 * time.Minute
+	if v := os.Getenv("OPEN_CHECKLIST_LEAD"); v != "" {
+		if openLead, err = time.ParseDuration(v); err != nil || openLead <= 0 {
+			log.Fatalf("Invalid OPEN_CHECKLIST_LEAD: %q", v)
+		}
+	}
+
+	// Check the gross exposure carried overnight this long before every
+	// close, and hold orders to the overnight limits from then on
+	overnightLead := 15 * time.Minute
+	if v := os.Getenv("OVERNIGHT_CHECK_LEAD"); v != "" {
+		if overnightLead, err = time.ParseDuration(v); err != nil || overnightLead <= 0 {
+			log.Fatalf("Invalid OVERNIGHT_CHECK_LEAD: %q", v)
+		}
+	}
+
+	// Apply the cash rules this long before every close, ahead of the
+	// overnight check, booking sweeps to CASH_SWEEP_USER
+	cashLead := 30 * time.Minute
+	if v := os.Getenv("CASH_SWEEP_LEAD"); v != "" {
+		if cashLead, err = time.ParseDuration(v); err != nil || cashLead <= 0 {
+			log.Fatalf("Invalid CASH_SWEEP_LEAD: %q", v)
+		}
+	}
+	cashUser := "cash"
+	if v := os.Getenv("CASH_SWEEP_USER"); v != "" {
+		cashUser = v
+	}
+
+	// Maintain the database this long after every close, once the close
+	// checklist's archival and backup are long done
+	maintenanceDelay := 6 * time.Hour
+	if v := os.Getenv("MAINTENANCE_DELAY"); v != "" {
+		if maintenanceDelay, err = time.ParseDuration(v); err != nil || maintenanceDelay <= 0 {
+			log.Fatalf("Invalid MAINTENANCE_DELAY: %q", v)
+		}
+	}
+	vacuumFree := 0.1
+	if v := os.Getenv("MAINTENANCE_VACUUM_FREE"); v != "" {
+		if vacuumFree, err = strconv.ParseFloat(v, 64); err != nil || vacuumFree < 0 || vacuumFree > 1 {
+			log.Fatalf("Invalid MAINTENANCE_VACUUM_FREE: %q", v)
+		}
+	}
+
+	// Publish the combined performance of members who opt in
+	public := &publicPerformance{days: 90, minMembers: 3}
+	if v := os.Getenv("PUBLIC_PERFORMANCE_DAYS"); v != "" {
+		if public.days, err = strconv.Atoi(v); err != nil || public.days < 2 {
+			log.Fatalf("Invalid PUBLIC_PERFORMANCE_DAYS: %q", v)
+		}
+	}
+	if v := os.Getenv("PUBLIC_PERFORMANCE_MIN_MEMBERS"); v != "" {
+		if public.minMembers, err = strconv.Atoi(v); err != nil || public.minMembers < 1 {
+			log.Fatalf("Invalid PUBLIC_PERFORMANCE_MIN_MEMBERS: %q", v)
+		}
+	}
+
+	// Back the database up to the store after every close
+	backupKeep := 7
+	if v := os.Getenv("BACKUP_KEEP"); v != "" {
+		if backupKeep, err = strconv.Atoi(v); err != nil || backupKeep < 0 {
+			log.Fatalf("Invalid BACKUP_KEEP: %q", v)
+		}
+	}
+	backups := backup.NewManager(db, backupStore, backupKeep)
+	backupDaily := false
+	if v := os.Getenv("BACKUP_DAILY"); v != "" {
+		if backupDaily, err = strconv.ParseBool(v); err != nil {
+			log.Fatalf("Invalid BACKUP_DAILY: %v", err)
+		}
+	}
+	var archiver *archive.Archiver
+	if archiveMarks {
+		archiver = archive.NewArchiver(db, storage.WithPrefix(store, "archive"), markRetention)
+	}
+
+	// Track resting GTC orders and optionally cancel or reprice stale ones
+	gtcOrders := sweeper.NewGTCManager(accounts, positionMarks, db, dailyAggregates, userNotifier, instrumentRules, live.gtcPolicy)
+	components.Add(lifecycle.Component{Name: "gtc-orders", DependsOn: []string{"database", "marks"}, Run: lifecycle.Func(func(ctx context.Context) {
+		gtcOrders.Run(ctx, 30*time.Minute)
+	})})
+
+	conditionalInterval := 5 * time.Second
+	if v := os.Getenv("CONDITIONAL_POLL_INTERVAL"); v != "" {
+		if conditionalInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid CONDITIONAL_POLL_INTERVAL: %v", err)
+		}
+	}
+
+	// Hedge rules are evaluated against the desk's account and hedges are
+	// booked to HEDGE_USER
+	hedgeInterval := 5 * time.Minute
+	if v := os.Getenv("HEDGE_INTERVAL"); v != "" {
+		if hedgeInterval, err = time.ParseDuration(v); err != nil || hedgeInterval <= 0 {
+			log.Fatalf("Invalid HEDGE_INTERVAL: %q", v)
+		}
+	}
+	hedgeBetaDays := 60
+	if v := os.Getenv("HEDGE_BETA_DAYS"); v != "" {
+		if hedgeBetaDays, err = strconv.Atoi(v); err != nil || hedgeBetaDays < 20 {
+			log.Fatalf("Invalid HEDGE_BETA_DAYS: %q (want at least 20)", v)
+		}
+	}
+	hedgeUser := "desk"
+	if v := os.Getenv("HEDGE_USER"); v != "" {
+		hedgeUser = v
+	}
+
+	// Net strategies' market orders per symbol over a short window; off
+	// unless NETTING_WINDOW is set
+	var nettingWindow time.Duration
+	if v := os.Getenv("NETTING_WINDOW"); v != "" {
+		if nettingWindow, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid NETTING_WINDOW: %v", err)
+		}
+	}
+	nettingFillTimeout := 30 * time.Second
+	if v := os.Getenv("NETTING_FILL_TIMEOUT"); v != "" {
+		if nettingFillTimeout, err = time.ParseDuration(v); err != nil || nettingFillTimeout <= 0 {
+			log.Fatalf("Invalid NETTING_FILL_TIMEOUT: %q", v)
+		}
+	}
+
+	// Check the timestamp clock against NTP and the system clock, warning in
+	// /readyz and by notification when it drifts
+	ntpServer := "pool.ntp.org"
+	if v := os.Getenv("NTP_SERVER"); v == "off" {
+		ntpServer = ""
+	} else if v != "" {
+		ntpServer = v
+	}
+	ntpInterval := 10 * time.Minute
+	if v := os.Getenv("NTP_CHECK_INTERVAL"); v != "" {
+		if ntpInterval, err = time.ParseDuration(v); err != nil || ntpInterval <= 0 {
+			log.Fatalf("Invalid NTP_CHECK_INTERVAL: %q", v)
+		}
+	}
+	clockMaxOffset := 100 * time.Millisecond
+	if v := os.Getenv("CLOCK_MAX_OFFSET"); v != "" {
+		if clockMaxOffset, err = time.ParseDuration(v); err != nil || clockMaxOffset <= 0 {
+			log.Fatalf("Invalid CLOCK_MAX_OFFSET: %q", v)
+		}
+	}
+	clockChecker := clock.NewChecker(ntpServer, ntpInterval, clockMaxOffset, notifier)
+	components.Add(lifecycle.Component{Name: "clock", Run: lifecycle.Func(clockChecker.Run)})
+
+	// Keep the payloads of failed orders for debugging while ORDER_CAPTURE
+	// is on
+	captureTTL := 7 * 24 * time.Hour
+	if v := os.Getenv("ORDER_CAPTURE_TTL"); v != "" {
+		if captureTTL, err = time.ParseDuration(v); err != nil || captureTTL <= 0 {
+			log.Fatalf("Invalid ORDER_CAPTURE_TTL: %q", v)
+		}
+	}
+	captureMaxBytes := 16 << 10
+	if v := os.Getenv("ORDER_CAPTURE_MAX_BYTES"); v != "" {
+		if captureMaxBytes, err = strconv.Atoi(v); err != nil || captureMaxBytes <= 0 {
+			log.Fatalf("Invalid ORDER_CAPTURE_MAX_BYTES: %q", v)
+		}
+	}
+	captures := capture.NewRecorder(db, captureTTL, captureMaxBytes)
+
+	// Manual orders awaiting confirmation are held this long
+	confirmTTL := 30 * time.Second
+	if v := os.Getenv("ORDER_CONFIRM_TTL"); v != "" {
+		if confirmTTL, err = time.ParseDuration(v); err != nil || confirmTTL <= 0 {
+			log.Fatalf("Invalid ORDER_CONFIRM_TTL: %q", v)
+		}
+	}
+	components.Add(lifecycle.Component{Name: "captures", DependsOn: []string{"database"}, Run: lifecycle.Func(func(ctx context.Context) {
+		captures.Run(ctx, time.Hour)
+	})})
+
+	// Orders that leave their time in force to the defaults get these
+	timeInForces := orders.TimeInForceDefaults{}
+	for name, assetClass := range map[string]string{
+		"DEFAULT_TIME_IN_FORCE":        orders.AssetClassEquity,
+		"DEFAULT_CRYPTO_TIME_IN_FORCE": orders.AssetClassCrypto,
+	} {
+		if v := os.Getenv(name); v != "" {
+			if err := timeInForces.Set(assetClass, v); err != nil {
+				log.Fatalf("Invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	// Relay Alpaca news so strategies don't need their own credentials
+	newsInterval := 30 * time.Second
+	if v := os.Getenv("NEWS_POLL_INTERVAL"); v != "" {
+		if newsInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid NEWS_POLL_INTERVAL: %v", err)
+		}
+	}
+	newsRetention := 7 * 24 * time.Hour
+	if v := os.Getenv("NEWS_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			log.Fatalf("Invalid NEWS_RETENTION_DAYS: %q", v)
+		}
+		newsRetention = time.Duration(days) * 24 * time.Hour
+	}
+	newsRelay := news.NewRelay(dataClient, db, newsRetention)
+	components.Add(lifecycle.Component{Name: "news", DependsOn: []string{"database"}, Run: lifecycle.Func(func(ctx context.Context) {
+		newsRelay.Run(ctx, newsInterval)
+	})})
+
+	// Browser dashboards served from another origin need to be allowed to
+	// open the websockets
+	var wsOrigins []string
+	for _, origin := range strings.Split(os.Getenv("WS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			wsOrigins = append(wsOrigins, origin)
+		}
+	}
+	// Ping every websocket, close the ones that stop answering, and limit
+	// how many a user may hold and how often they resubscribe
+	wsConfig := socketConfig{
+		PingInterval:    defaultWSPingInterval,
+		IdleTimeout:     defaultWSIdleTimeout,
+		MaxPerUser:      defaultWSMaxPerUser,
+		MaxResubscribes: defaultWSMaxResubscribes,
+	}
+	for name, d := range map[string]*time.Duration{"WS_PING_INTERVAL": &wsConfig.PingInterval, "WS_IDLE_TIMEOUT": &wsConfig.IdleTimeout} {
+		if v := os.Getenv(name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil || *d < 0 {
+				log.Fatalf("Invalid %s: %q", name, v)
+			}
+		}
+	}
+	for name, n := range map[string]*int{"WS_MAX_CONNECTIONS_PER_USER": &wsConfig.MaxPerUser, "WS_MAX_RESUBSCRIBES": &wsConfig.MaxResubscribes} {
+		if v := os.Getenv(name); v != "" {
+			if *n, err = strconv.Atoi(v); err != nil || *n < 0 {
+				log.Fatalf("Invalid %s: %q", name, v)
+			}
+		}
+	}
+	if wsConfig.IdleTimeout > 0 && wsConfig.IdleTimeout <= wsConfig.PingInterval {
+		log.Fatalf("Invalid WS_IDLE_TIMEOUT: must be longer than WS_PING_INTERVAL")
+	}
+	websockets := newSockets(wsConfig, wsOrigins)
+
+	// Optionally follow trading halts and LULD bands on the data feed to
+	// block orders in halted symbols and warn the users holding them
+	var haltMonitor *halts.Monitor
+	if feed := os.Getenv("HALT_FEED"); feed != "" {
+		if err := feedVar(feed); err != nil {
+			log.Fatalf("Invalid HALT_FEED: %v", err)
+		}
+		haltMonitor = halts.NewMonitor(dataClient, feed, db, notifier)
+		components.Add(lifecycle.Component{Name: "halts", DependsOn: []string{"database"}, Run: lifecycle.Func(haltMonitor.Run)})
+	}
+
+	// Optionally copy market data and position marks to a time-series
+	// database for research, off the trading database
+	if tsdbURL := os.Getenv("TSDB_URL"); tsdbURL != "" {
+		if os.Getenv("TSDB_BUCKET") == "" {
+			log.Fatalf("Invalid TSDB_BUCKET: required when TSDB_URL is set")
+		}
+		flushEvery := 5 * time.Second
+		if v := os.Getenv("TSDB_FLUSH_INTERVAL"); v != "" {
+			if flushEvery, err = time.ParseDuration(v); err != nil || flushEvery <= 0 {
+				log.Fatalf("Invalid TSDB_FLUSH_INTERVAL: %q", v)
+			}
+		}
+		exporter := tsdb.NewExporter(tsdb.NewInflux(tsdb.InfluxConfig{
+			URL:    tsdbURL,
+			Org:    os.Getenv("TSDB_ORG"),
+			Bucket: os.Getenv("TSDB_BUCKET"),
+			Token:  os.Getenv("TSDB_TOKEN"),
+		}), flushEvery)
+		components.Add(lifecycle.Component{Name: "tsdb", Run: lifecycle.Func(exporter.Run)})
+		positionMarks.OnPersist(exporter.Marks)
+
+		var tsdbSymbols []string
+		for _, s := range strings.Split(os.Getenv("TSDB_SYMBOLS"), ",") {
+			if s = symbols.Normalize(s); s != "" {
+				tsdbSymbols = append(tsdbSymbols, s)
+			}
+		}
+		if len(tsdbSymbols) > 0 {
+			feed := os.Getenv("TSDB_FEED")
+			if feed == "" {
+				feed = "iex"
+			} else if err := feedVar(feed); err != nil {
+				log.Fatalf("Invalid TSDB_FEED: %v", err)
+			}
+			quotes := false
+			if v := os.Getenv("TSDB_QUOTES"); v != "" {
+				if quotes, err = strconv.ParseBool(v); err != nil {
+					log.Fatalf("Invalid TSDB_QUOTES: %v", err)
+				}
+			}
+			components.Add(lifecycle.Component{Name: "tsdb-stream", DependsOn: []string{"tsdb"}, Run: lifecycle.Func(func(ctx context.Context) {
+				exporter.Stream(ctx, dataClient, feed, tsdbSymbols, quotes)
+			})})
+		}
+	}
+
+	// Feed event-driven strategies bars and quotes of STRATEGY_EVENTS_SYMBOLS,
+	// their fills and timer ticks over gRPC
+	strategyEvents := events.NewBus()
+	eventsPort := os.Getenv("STRATEGY_EVENTS_PORT")
+	if eventsPort != "" {
+		var eventSymbols []string
+		for _, s := range strings.Split(os.Getenv("STRATEGY_EVENTS_SYMBOLS"), ",") {
+			if s = aliases.Resolve(s); s != "" && !slices.Contains(eventSymbols, s) {
+				eventSymbols = append(eventSymbols, s)
+			}
+		}
+		if len(eventSymbols) > 0 {
+			feed := os.Getenv("STRATEGY_EVENTS_FEED")
+			if feed == "" {
+				feed = "iex"
+			} else if err := feedVar(feed); err != nil {
+				log.Fatalf("Invalid STRATEGY_EVENTS_FEED: %v", err)
+			}
+			quotes := false
+			if v := os.Getenv("STRATEGY_EVENTS_QUOTES"); v != "" {
+				if quotes, err = strconv.ParseBool(v); err != nil {
+					log.Fatalf("Invalid STRATEGY_EVENTS_QUOTES: %v", err)
+				}
+			}
+			components.Add(lifecycle.Component{Name: "events-stream", Run: lifecycle.Func(func(ctx context.Context) {
+				strategyEvents.Stream(ctx, dataClient, feed, eventSymbols, quotes)
+			})})
+		}
+	}
+
+	// Optionally mirror watchlists to Alpaca watchlists on the desk account
+	var watchlistSync *watchlist.Syncer
+	if v := os.Getenv("WATCHLIST_ALPACA_SYNC"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid WATCHLIST_ALPACA_SYNC: %v", err)
+		}
+		if enabled {
+			watchlistSync = watchlist.NewSyncer(client, db)
+			go func() {
+				if err := watchlistSync.PushAll(); err != nil {
+					log.Printf("Failed to sync watchlists to Alpaca: %v", err)
+				}
+			}()
+		}
+	}
+
+	// Screen universes over daily bars cached for SCREEN_CACHE_TTL
+	screenTTL := 15 * time.Minute
+	if v := os.Getenv("SCREEN_CACHE_TTL"); v != "" {
+		if screenTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid SCREEN_CACHE_TTL: %v", err)
+		}
+	}
+
+	// Run registered strategies as child processes and keep their output
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Members onboarded on the admin port get these limits and paper cash
+	// unless told otherwise, and are told to connect to DESK_API_URL
+	onboarding := onboardingDefaults{
+		MaxOrderNotional: decimal.NewFromInt(10000),
+		MaxGrossExposure: decimal.NewFromInt(100000),
+		PaperAllocation:  decimal.NewFromInt(100000),
+		APIURL:           "http://localhost:" + port,
+	}
+	for name, limit := range map[string]*decimal.Decimal{
+		"ONBOARDING_MAX_ORDER_NOTIONAL": &onboarding.MaxOrderNotional,
+		"ONBOARDING_MAX_GROSS_EXPOSURE": &onboarding.MaxGrossExposure,
+		"ONBOARDING_PAPER_ALLOCATION":   &onboarding.PaperAllocation,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := decimal.NewFromString(v)
+			if err != nil || d.IsNegative() {
+				log.Fatalf("Invalid %s: %q", name, v)
+			}
+			*limit = d
+		}
+	}
+	if v := os.Getenv("DESK_API_URL"); v != "" {
+		onboarding.APIURL = strings.TrimRight(v, "/")
+	}
+	runnerConfig := runner.Config{
+		Python:      "python3",
+		ServerURL:   "http://localhost:" + port,
+		LogDir:      "logs/strategies",
+		LogMaxBytes: 10 << 20,
+		LogFiles:    5,
+		LogLines:    1000,
+		Limits: runner.Limits{
+			MaxMemoryBytes: 1024 << 20,
+			MaxCPUPercent:  100,
+			CPUWindow:      time.Minute,
+		},
+	}
+	if v := os.Getenv("STRATEGY_PYTHON"); v != "" {
+		runnerConfig.Python = v
+	}
+	if chapters != nil {
+		runnerConfig.Token = func(userID string) string {
+			if c := chapters.ChapterOf(userID); c != nil {
+				return c.Token
+			}
+			return ""
+		}
+	}
+	if v := os.Getenv("STRATEGY_SERVER_URL"); v != "" {
+		runnerConfig.ServerURL = v
+	}
+	if eventsPort != "" {
+		runnerConfig.EventsAddr = "localhost:" + eventsPort
+	}
+	if v := os.Getenv("STRATEGY_LOG_DIR"); v != "" {
+		runnerConfig.LogDir = v
+	}
+	if v := os.Getenv("STRATEGY_LOG_MAX_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb <= 0 {
+			log.Fatalf("Invalid STRATEGY_LOG_MAX_MB: %q", v)
+		}
+		runnerConfig.LogMaxBytes = int64(mb) << 20
+	}
+	if v := os.Getenv("STRATEGY_LOG_FILES"); v != "" {
+		if runnerConfig.LogFiles, err = strconv.Atoi(v); err != nil || runnerConfig.LogFiles < 0 {
+			log.Fatalf("Invalid STRATEGY_LOG_FILES: %q", v)
+		}
+	}
+	if v := os.Getenv("STRATEGY_LOG_LINES"); v != "" {
+		if runnerConfig.LogLines, err = strconv.Atoi(v); err != nil || runnerConfig.LogLines <= 0 {
+			log.Fatalf("Invalid STRATEGY_LOG_LINES: %q", v)
+		}
+	}
+	if v := os.Getenv("STRATEGY_MAX_MEMORY_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 0 {
+			log.Fatalf("Invalid STRATEGY_MAX_MEMORY_MB: %q", v)
+		}
+		runnerConfig.Limits.MaxMemoryBytes = int64(mb) << 20
+	}
+	if v := os.Getenv("STRATEGY_MAX_CPU_PCT"); v != "" {
+		if runnerConfig.Limits.MaxCPUPercent, err = strconv.ParseFloat(v, 64); err != nil || runnerConfig.Limits.MaxCPUPercent < 0 {
+			log.Fatalf("Invalid STRATEGY_MAX_CPU_PCT: %q", v)
+		}
+	}
+	if v := os.Getenv("STRATEGY_CPU_WINDOW"); v != "" {
+		if runnerConfig.Limits.CPUWindow, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid STRATEGY_CPU_WINDOW: %v", err)
+		}
+	}
+	if v := os.Getenv("STRATEGY_MAX_RUNTIME"); v != "" {
+		if runnerConfig.Limits.MaxRuntime, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid STRATEGY_MAX_RUNTIME: %v", err)
+		}
+	}
+	// Strategies run as their own user, which can't read the desk's
+	// database
+	if v := os.Getenv("STRATEGY_USER"); v != "" {
+		if runnerConfig.Sandbox, err = runner.LookupSandbox(v); err != nil {
+			log.Fatalf("Invalid STRATEGY_USER: %v", err)
+		}
+		if err := runner.Restrict(strings.SplitN(dbPath, "?", 2)[0]); err != nil {
+			log.Fatalf("Failed to restrict database permissions: %v", err)
+		}
+	} else {
+		log.Printf("STRATEGY_USER is not set; runner-managed strategies won't start")
+	}
+
+	// Keep uploaded strategy versions in the object store
+	artifactStore, err := openArtifactStore(store)
+	if err != nil {
+		log.Fatalf("Failed to open artifact storage: %v", err)
+	}
+	workDir := os.Getenv("STRATEGY_WORK_DIR")
+	if workDir == "" {
+		workDir = "work/strategies"
+	}
+	artifactMaxBytes := int64(10 << 20)
+	if v := os.Getenv("STRATEGY_ARTIFACT_MAX_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb <= 0 {
+			log.Fatalf("Invalid STRATEGY_ARTIFACT_MAX_MB: %q", v)
+		}
+		artifactMaxBytes = int64(mb) << 20
+	}
+	strategyArtifacts := artifacts.NewManager(artifactStore, workDir)
+
+	// Parameter sweeps run up to this many backtests at once
+	backtestWorkers := 4
+	if v := os.Getenv("BACKTEST_WORKERS"); v != "" {
+		if backtestWorkers, err = strconv.Atoi(v); err != nil || backtestWorkers < 1 {
+			log.Fatalf("Invalid BACKTEST_WORKERS: %q", v)
+		}
+	}
+
+	// Encrypt per-strategy secrets under a master key; without one, secrets
+	// can't be stored
+	var secretsBox *secrets.Box
+	if v := os.Getenv("STRATEGY_SECRETS_KEY"); v != "" {
+		key, err := secrets.ParseKey(v)
+		if err != nil {
+			log.Fatalf("Invalid STRATEGY_SECRETS_KEY: %v", err)
+		}
+		if secretsBox, err = secrets.NewBox(key); err != nil {
+			log.Fatalf("Invalid STRATEGY_SECRETS_KEY: %v", err)
+		}
+	}
+
+	strategyRunner := runner.NewRunner(db, runnerConfig, strategyArtifacts, secretsBox)
+	// Strategies are stopped one at a time, each with its grace period
+	components.Add(lifecycle.Component{Name: "strategies", DependsOn: []string{"database"}, Run: lifecycle.Func(strategyRunner.Run), Timeout: 30 * time.Second})
+
+	// Deploy strategies registered from git
+	gitDir := os.Getenv("STRATEGY_GIT_DIR")
+	if gitDir == "" {
+		gitDir = "work/git"
+	}
+	healthWindow := 30 * time.Second
+	if v := os.Getenv("STRATEGY_DEPLOY_HEALTH_WINDOW"); v != "" {
+		if healthWindow, err = time.ParseDuration(v); err != nil || healthWindow <= 0 {
+			log.Fatalf("Invalid STRATEGY_DEPLOY_HEALTH_WINDOW: %q", v)
+		}
+	}
+	deployer := deploy.NewDeployer(db, deploy.NewGit(gitDir), strategyArtifacts, strategyRunner, healthWindow)
+
+	// Keep the earnings calendar fresh and optionally guard new openings
+	// ahead of reports
+	var earningsSource calendar.Source
+	if key := os.Getenv("FINNHUB_API_KEY"); key != "" {
+		earningsSource = calendar.NewFinnhub(key)
+	} else if path := os.Getenv("EARNINGS_CALENDAR_FILE"); path != "" {
+		earningsSource = calendar.NewFile(path)
+	}
+	if earningsSource != nil {
+		refresher := calendar.NewRefresher(earningsSource, db, 14*24*time.Hour)
+		components.Add(lifecycle.Component{Name: "calendar", DependsOn: []string{"database"}, Run: lifecycle.Func(func(ctx context.Context) {
+			refresher.Run(ctx, 6*time.Hour)
+		})})
+	}
+
+	if live.earningsRule != "off" && earningsSource == nil {
+		log.Printf("Warning: EARNINGS_RULE is set but no earnings calendar source is configured")
+	}
+
+	// Chaos mode injects broker latency, rejects and partial fills to test
+	// strategies and reconciliation against adverse conditions. It refuses
+	// to run if any account, the desk's or a chapter's, is live.
+	var chaosInjector *chaos.Injector
+	if os.Getenv("CHAOS_MODE") == "true" {
+		if err := chaosPaperOnly(chapters, baseURL, strings.Split(os.Getenv("CHAOS_ALLOW_HOSTS"), ",")); err != nil {
+			log.Fatalf("Invalid CHAOS_MODE: %v", err)
+		}
+		var chaosConfig chaos.Config
+		if v := os.Getenv("CHAOS_LATENCY"); v != "" {
+			if chaosConfig.Latency, err = time.ParseDuration(v); err != nil {
+				log.Fatalf("Invalid CHAOS_LATENCY: %v", err)
+			}
+		}
+		if v := os.Getenv("CHAOS_JITTER"); v != "" {
+			if chaosConfig.Jitter, err = time.ParseDuration(v); err != nil {
+				log.Fatalf("Invalid CHAOS_JITTER: %v", err)
+			}
+		}
+		if v := os.Getenv("CHAOS_REJECT_RATE"); v != "" {
+			if chaosConfig.RejectRate, err = strconv.ParseFloat(v, 64); err != nil || chaosConfig.RejectRate < 0 || chaosConfig.RejectRate > 1 {
+				log.Fatalf("Invalid CHAOS_REJECT_RATE: %q (want 0 to 1)", v)
+			}
+		}
+		if v := os.Getenv("CHAOS_PARTIAL_FILL_RATE"); v != "" {
+			if chaosConfig.PartialFillRate, err = strconv.ParseFloat(v, 64); err != nil || chaosConfig.PartialFillRate < 0 || chaosConfig.PartialFillRate > 1 {
+				log.Fatalf("Invalid CHAOS_PARTIAL_FILL_RATE: %q (want 0 to 1)", v)
+			}
+		}
+		chaosInjector = chaos.New(chaosConfig, time.Now().UnixNano())
+		log.Printf("WARNING: chaos mode enabled (latency=%s jitter=%s reject_rate=%g partial_fill_rate=%g)",
+			chaosConfig.Latency, chaosConfig.Jitter, chaosConfig.RejectRate, chaosConfig.PartialFillRate)
+	}
+
+	// Add the subsystems wired above to the API
+	app.marketData = marketData
+	app.brokerLatency = brokerLatency
+	app.simulator = sim
+	app.marks = positionMarks
+	app.riskSnapshots = riskSnapshots
+	app.greeks = greeks
+	app.halts = haltMonitor
+	app.dailyAggregates = dailyAggregates
+	app.gtcOrders = gtcOrders
+	app.tradeUpdates = tradeUpdates
+	app.carry = carryAccruer
+	app.dividends = dividendImporter
+	app.weeklyReports = weeklyReports
+	app.backups = backups
+	app.public = public
+	app.news = newsRelay
+	app.blotter = blotterFeed
+	app.positionFeed = positionFeed
+	app.sockets = websockets
+	app.watchlistSync = watchlistSync
+	app.screener = screener.NewScreener(marketData.Dashboard, screenTTL)
+	app.tca = tca.New(db, marketData.Backtest)
+	app.runner = strategyRunner
+	app.runnerConfig = runnerConfig
+	app.artifacts = strategyArtifacts
+	app.artifactMaxBytes = artifactMaxBytes
+	app.backtestWorkers = backtestWorkers
+	app.events = strategyEvents
+	app.deployer = deployer
+	app.secrets = secretsBox
+	app.chaos = chaosInjector
+	app.clockChecker = clockChecker
+	app.captures = captures
+	app.aliases = aliases
+	app.instruments = instrumentRules
+	app.volumes = risk.NewAverageVolumes(marketData.Live, 20)
+	app.tickets = confirm.NewStore(confirmTTL)
+	app.onboarding = onboarding
+	app.timeInForces = timeInForces
+	app.exposureAlerts = exposureAlerts
+	app.overnightLead = overnightLead
+	app.cashUser = cashUser
+	app.configFile = configFile
+	app.store = store
+
+	// Submit conditional orders through the same path as POST /order; any
+	// risk flags have already been notified by submitOrder
+	submit := func(userID string, strategyID *int64, order *orders.Order) (*database.Trade, error) {
+		order.Source = orders.SourceScheduler
+		trade, _, err := app.submitOrder(userID, strategyID, order)
+		if err != nil {
+			app.captureFailure(capture.Request{Path: "(conditional order)", Body: jsonBody(order)}, userID, err)
+		}
+		return trade, err
+	}
+	placeHedge := func(order *orders.Order) (*database.Trade, error) {
+		order.Source = orders.SourceAlgo
+		trade, _, err := app.submitOrder(hedgeUser, nil, order)
+		if err != nil {
+			app.captureFailure(capture.Request{Path: "(hedge order)", Body: jsonBody(order)}, hedgeUser, err)
+		}
+		return trade, err
+	}
+	app.hedger = hedge.NewHedger(client, positionMarks, marketData.Live, placeHedge, notifier, hedgeInterval, hedgeBetaDays)
+	components.Add(lifecycle.Component{Name: "hedger", DependsOn: []string{"marks"}, Run: lifecycle.Func(app.hedger.Run)})
+	app.applySettings(live)
+
+	// Reload settings on SIGHUP without dropping stream subscribers
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := app.reload(); err != nil {
+				log.Printf("Failed to reload configuration: %v", err)
+			}
+		}
+	}()
+
+	// Run the open checks, the cash sweep, the end-of-session risk check,
+	// close tasks and database maintenance every session
+	app.checklists = checklist.NewRunner(db, notifier,
+		app.openChecklist(openLead, warmupMax),
+		app.cashChecklist(cashLead),
+		app.overnightChecklist(overnightLead),
+		app.closeChecklist(sweepDelay, daySweeper, archiver, backupDaily),
+		app.maintenanceChecklist(maintenanceDelay, vacuumFree),
+	)
+	components.Add(lifecycle.Component{Name: "checklists", DependsOn: []string{"database", "marks"}, Run: lifecycle.Func(func(ctx context.Context) {
+		app.checklists.Start(ctx)
+		<-ctx.Done()
+	})})
+
+	app.conditionalOrders = conditional.NewEngine(db, prices, submit, userNotifier, conditionalInterval)
+	components.Add(lifecycle.Component{Name: "conditional-orders", DependsOn: []string{"database", "marks"}, Run: lifecycle.Func(app.conditionalOrders.Run)})
+
+	if nettingWindow > 0 {
+		place := chaos.PlaceFunc(client.PlaceOrder)
+		if chaosInjector != nil {
+			place = chaosInjector.Wrap(place)
+		}
+		app.netting = netting.NewNetter(db, netting.PlaceFunc(place), client, prices, notifier, nettingWindow, nettingFillTimeout)
+		app.netting.OnTrade(func(t database.Trade) {
+			if err := dailyAggregates.RecordTrade(t); err != nil {
+				log.Printf("Failed to update daily aggregates: %v", err)
+			}
+			strategyEvents.Fill(t)
+		})
+		if err := app.netting.Recover(); err != nil {
+			log.Printf("Failed to recover netting signals: %v", err)
+		}
+		components.Add(lifecycle.Component{Name: "netting", DependsOn: []string{"database"}, Run: lifecycle.Func(app.netting.Run)})
+		log.Printf("Netting strategy market orders over %s windows", nettingWindow)
+	}
+
 	log.Printf("Starting Quant Club Trading Desk on http://localhost:%s", port)
 	log.Printf("Connected to Alpaca API at %s", baseURL)
 	log.Printf("Database: %s", dbPath)
 	log.Printf("Endpoints:")
-	log.Printf("   POST /order - Place a trading order (protobuf)")
+	for _, rt := range app.routes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		log.Printf("   %-4s %s - %s", method, path, rt.op.Summary)
+	}
+	log.Printf("   GET  /openapi.json - OpenAPI document")
+	log.Printf("   GET  /docs - Swagger UI")
+	log.Printf("   GET  /protos/descriptors - Protobuf FileDescriptorSet")
+	log.Printf("   GET  /readyz - Readiness, including stale prices")
+
+	// Serve pprof, expvar, /debug/status and the SQL console on a separate,
+	// authenticated admin port
+	if adminPort := os.Getenv("ADMIN_PORT"); adminPort != "" {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			log.Fatalf("Invalid ADMIN_TOKEN: required when ADMIN_PORT is set")
+		}
+		if v := os.Getenv("ADMIN_SQL_WRITE"); v != "" {
+			if app.consoleWrites, err = strconv.ParseBool(v); err != nil {
+				log.Fatalf("Invalid ADMIN_SQL_WRITE: %v", err)
+			}
+		}
+		analyticsRefresh := time.Hour
+		if v := os.Getenv("ANALYTICS_REFRESH"); v != "" {
+			if analyticsRefresh, err = time.ParseDuration(v); err != nil || analyticsRefresh < 0 {
+				log.Fatalf("Invalid ANALYTICS_REFRESH: %q", v)
+			}
+		}
+		analyticsDir, err := os.MkdirTemp("", "desk-analytics-")
+		if err != nil {
+			log.Fatalf("Failed to create analytics directory: %v", err)
+		}
+		app.analytics = analytics.NewEngine(store, analyticsDir, analyticsRefresh)
+		components.Add(lifecycle.Component{
+			Name: "analytics",
+			Stop: func(context.Context) error {
+				app.analytics.Close()
+				return os.RemoveAll(analyticsDir)
+			},
+		})
+		components.Add(lifecycle.HTTPServer("admin", &http.Server{Addr: ":" + adminPort, Handler: app.adminHandler(adminToken)}, "database"))
+		log.Printf("Admin diagnostics on http://localhost:%s/debug/status", adminPort)
+	}
+
+	// Serve the public performance page on its own port so it can be
+	// exposed to the internet without the API
+	if publicPort := os.Getenv("PUBLIC_PORT"); publicPort != "" {
+		components.Add(lifecycle.HTTPServer("public", &http.Server{Addr: ":" + publicPort, Handler: app.publicHandler()}, "database"))
+		log.Printf("Public performance page on http://localhost:%s/performance", publicPort)
+	}
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	// Serve the strategy event stream to the runner's strategies
+	if eventsPort != "" {
+		eventServer := grpc.NewServer()
+		events.NewServer(strategyEvents, app.identifyEventsCaller, aliases.Resolve).Register(eventServer)
+		reflection.Register(eventServer)
+		components.Add(grpcServer("events", ":"+eventsPort, eventServer, "strategies"))
+		log.Printf("Strategy events (gRPC) on localhost:%s", eventsPort)
+	}
+
+	// Stopped after the API, so clients are told to reconnect once it has
+	// stopped taking requests
+	components.Add(lifecycle.Component{
+		Name: "websockets",
+		Stop: func(context.Context) error {
+			websockets.closeAll()
+			return nil
+		},
+	})
+	components.Add(lifecycle.HTTPServer("api", &http.Server{Addr: ":" + port, Handler: app.router()}, "database", "websockets"))
+	app.components = components
+
+	if err := components.Start(context.Background()); err != nil {
 		log.Fatalf("Could not start server: %s", err)
 	}
-}
\ No newline at end of file
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	log.Printf("Received %s, shutting down", sig)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	components.Stop(shutdownCtx)
+	log.Printf("Shut down")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/alpaca"
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/marks"
+	"desk/internal/notify"
+	"desk/internal/risk"
+	"desk/internal/symbols"
+)
+
+// universeLookback is how recently an active strategy must have traded a
+// symbol for it to count as part of the strategy's universe
+const universeLookback = 7 * 24 * time.Hour
+
+// markedData serves latest prices from the marking engine and everything
+// else (bars, option quotes) from Alpaca market data
+type markedData struct {
+	*alpaca.DataClient
+	marks *marks.Engine
+}
+
+func (d markedData) LatestPrice(symbol string) (decimal.Decimal, error) {
+	return d.marks.LatestPrice(symbol)
+}
+
+// warmQuotes has the marking engine watch up to maxSymbols of the symbols
+// active strategies are likely to trade, so the session's first orders find
+// a fresh mark rather than waiting on the data provider or tripping the
+// stale-price check. It returns the number watched; zero maxSymbols
+// disables warming.
+func warmQuotes(db *database.DB, aliases *symbols.Aliases, engine *marks.Engine, maxSymbols int) (int, error) {
+	if maxSymbols == 0 {
+		return 0, nil
+	}
+	universe, err := db.GetStrategyUniverse(time.Now().Add(-universeLookback))
+	if err != nil {
+		return 0, err
+	}
+	universe = aliases.ResolveAll(universe)
+	if len(universe) > maxSymbols {
+		log.Printf("Warming the first %d of %d strategy symbols", maxSymbols, len(universe))
+		universe = universe[:maxSymbols]
+	}
+	engine.Watch(universe)
+	return len(universe), nil
+}
+
+// marksResponse is the caller's open positions at their current marks
+type marksResponse struct {
+	Positions    []database.PositionMark `json:"positions"`
+	MarketValue  decimal.Decimal         `json:"market_value"`
+	UnrealizedPL decimal.Decimal         `json:"unrealized_pl"`
+}
+
+// queryStrategyID parses the optional strategy_id query parameter, writing an
+// error response if it is invalid
+func queryStrategyID(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	v := r.URL.Query().Get("strategy_id")
+	if v == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request: invalid strategy_id", http.StatusBadRequest)
+		return nil, false
+	}
+	return &id, true
+}
+
+// handlePositionMarks returns the caller's open positions as last marked,
+// optionally only one strategy's
+func (app *Application) handlePositionMarks(w http.ResponseWriter, r *http.Request) {
+	strategyID, ok := queryStrategyID(w, r)
+	if !ok {
+		return
+	}
+
+	resp := marksResponse{Positions: []database.PositionMark{}}
+	for _, p := range app.marks.Positions(requestUserID(r)) {
+		if strategyID != nil && p.StrategyID != *strategyID {
+			continue
+		}
+		resp.Positions = append(resp.Positions, p)
+		resp.MarketValue = resp.MarketValue.Add(p.MarketValue)
+		resp.UnrealizedPL = resp.UnrealizedPL.Add(p.UnrealizedPL)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleMarkHistory returns the caller's persisted marks between ?from= and
+// ?to= (default the last 24 hours), optionally only for ?strategy_id= and
+// ?symbol=, as JSON or an Arrow IPC stream
+func (app *Application) handleMarkHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			parsed, err := market.ParseTime(v)
+			if err != nil {
+				http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	strategyID, ok := queryStrategyID(w, r)
+	if !ok {
+		return
+	}
+	symbol := query.Get("symbol")
+	if symbol != "" {
+		symbol = app.aliases.Resolve(symbol)
+	}
+
+	history, err := app.db.GetPositionMarks(requestUserID(r), from, to, strategyID, symbol)
+	if err != nil {
+		log.Printf("Failed to load position marks: %v", err)
+		http.Error(w, "Failed to load position marks", http.StatusInternalServerError)
+		return
+	}
+	if wantsArrow(r) {
+		writeArrow(w, markColumns(history)...)
+		return
+	}
+	if history == nil {
+		history = []database.PositionMark{}
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// checkExposure returns a marking engine refresh hook that checks the desk's
+// marked positions against the exposure alert thresholds. Users' positions
+// in a symbol are netted, as they are at the broker; equity and cash come
+// from the latest risk snapshot.
+func checkExposure(alerter *notify.Alerter, snapshots *risk.Snapshotter) func([]database.PositionMark) {
+	return func(positions []database.PositionMark) {
+		net := make(map[string]decimal.Decimal)
+		for _, p := range positions {
+			net[p.Symbol] = net[p.Symbol].Add(p.MarketValue)
+		}
+		e := notify.Exposure{Positions: make(map[string]decimal.Decimal, len(net))}
+		for symbol, value := range net {
+			if value.IsZero() {
+				continue
+			}
+			e.Positions[symbol] = value.Abs()
+			e.GrossExposure = e.GrossExposure.Add(value.Abs())
+		}
+		if snap := snapshots.Latest(); snap != nil {
+			e.Equity, e.Cash = &snap.Equity, &snap.Cash
+		}
+		alerter.Check(e, time.Now())
+	}
+}
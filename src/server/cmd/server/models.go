@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+)
+
+// modelNamePattern is what a model portfolio may be called; the name is
+// its ID in paths
+var modelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// modelRequest is the body of POST /admin/models and PUT
+// /admin/models/{name}, which takes the name from the path
+type modelRequest struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Weights     map[string]decimal.Decimal `json:"weights"`
+}
+
+// modelRebalanceRequest is the body of POST /models/{name}/rebalance
+type modelRebalanceRequest struct {
+	Capital *decimal.Decimal `json:"capital"`
+	Execute bool             `json:"execute"`
+	Name    string           `json:"name"`
+}
+
+// symbolDrift is how far one symbol of a book is from its model weight
+type symbolDrift struct {
+	Symbol       string          `json:"symbol"`
+	TargetWeight decimal.Decimal `json:"target_weight"`
+	Value        decimal.Decimal `json:"value"`
+	Weight       decimal.Decimal `json:"weight"`
+	// Drift is the weight less the target weight, positive when overweight
+	Drift decimal.Decimal `json:"drift"`
+}
+
+// modelDrift compares a book's positions with a model portfolio
+type modelDrift struct {
+	Model   string          `json:"model"`
+	Capital decimal.Decimal `json:"capital"`
+	Symbols []symbolDrift   `json:"symbols"`
+	// MaxDrift is the largest drift of a symbol either way, and Turnover
+	// the sum of them, the share of capital it would take to trade the book
+	// into the model; cash makes up the difference
+	MaxDrift decimal.Decimal `json:"max_drift"`
+	Turnover decimal.Decimal `json:"turnover"`
+}
+
+// modelWithDrift is a model portfolio as GET /models lists it
+type modelWithDrift struct {
+	database.ModelPortfolio
+	Drift *modelDrift `json:"drift,omitempty"`
+}
+
+// modelRequestWeights checks a model's name and weights, writing an error
+// response if they can't be used
+func (app *Application) modelRequestWeights(w http.ResponseWriter, req *modelRequest) bool {
+	if !modelNamePattern.MatchString(req.Name) {
+		http.Error(w, "Bad request: name must be lowercase letters, digits, - and _, up to 64 characters", http.StatusBadRequest)
+		return false
+	}
+	weights, err := app.targetWeights(req.Weights)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	req.Weights = weights
+	return true
+}
+
+// handleCreateModel serves POST /admin/models, defining a model portfolio
+func (app *Application) handleCreateModel(w http.ResponseWriter, r *http.Request) {
+	var req modelRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !app.modelRequestWeights(w, &req) {
+		return
+	}
+	m := database.ModelPortfolio{Name: req.Name, Description: req.Description, Weights: req.Weights}
+	if err := app.db.CreateModel(&m); errors.Is(err, database.ErrModelExists) {
+		http.Error(w, "Model already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Failed to create model %s: %v", req.Name, err)
+		http.Error(w, "Failed to create model", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// handleUpdateModel serves PUT /admin/models/{name}, replacing a model
+// portfolio's description and weights
+func (app *Application) handleUpdateModel(w http.ResponseWriter, r *http.Request) {
+	var req modelRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Name = r.PathValue("name")
+	if !app.modelRequestWeights(w, &req) {
+		return
+	}
+	m := database.ModelPortfolio{Name: req.Name, Description: req.Description, Weights: req.Weights}
+	updated, err := app.db.UpdateModel(&m)
+	if err != nil {
+		log.Printf("Failed to update model %s: %v", req.Name, err)
+		http.Error(w, "Failed to update model", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleDeleteModel serves DELETE /admin/models/{name}
+func (app *Application) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
+	deleted, err := app.db.DeleteModel(r.PathValue("name"))
+	if err != nil {
+		log.Printf("Failed to delete model: %v", err)
+		http.Error(w, "Failed to delete model", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// model loads the model portfolio in the {name} path parameter, writing an
+// error response if there is none
+func (app *Application) model(w http.ResponseWriter, r *http.Request) (*database.ModelPortfolio, bool) {
+	m, err := app.db.GetModel(r.PathValue("name"))
+	if err != nil {
+		log.Printf("Failed to load model: %v", err)
+		http.Error(w, "Failed to load model", http.StatusInternalServerError)
+		return nil, false
+	}
+	if m == nil {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return nil, false
+	}
+	return m, true
+}
+
+// handleListModels lists the model portfolios and, with drift=true, how
+// far the caller's book is from each
+func (app *Application) handleListModels(w http.ResponseWriter, r *http.Request) {
+	withDrift := r.URL.Query().Get("drift") == "true"
+	var capital *decimal.Decimal
+	if withDrift {
+		var ok bool
+		if capital, ok = queryCapital(w, r); !ok {
+			return
+		}
+	}
+	models, err := app.db.GetModels()
+	if err != nil {
+		log.Printf("Failed to load models: %v", err)
+		http.Error(w, "Failed to load models", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]modelWithDrift, len(models))
+	for i, m := range models {
+		resp[i].ModelPortfolio = m
+		if !withDrift {
+			continue
+		}
+		var ok bool
+		if resp[i].Drift, ok = app.modelDrift(w, r, &m, capital); !ok {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGetModel returns a model portfolio
+func (app *Application) handleGetModel(w http.ResponseWriter, r *http.Request) {
+	m, ok := app.model(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleModelDrift compares the caller's book, or a strategy's with
+// X-Strategy-ID, with a model portfolio
+func (app *Application) handleModelDrift(w http.ResponseWriter, r *http.Request) {
+	m, ok := app.model(w, r)
+	if !ok {
+		return
+	}
+	capital, ok := queryCapital(w, r)
+	if !ok {
+		return
+	}
+	drift, ok := app.modelDrift(w, r, m, capital)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, drift)
+}
+
+// handleModelRebalance plans, and optionally places, the orders that take
+// the caller's book to a model portfolio, through POST /rebalance
+func (app *Application) handleModelRebalance(w http.ResponseWriter, r *http.Request) {
+	m, ok := app.model(w, r)
+	if !ok {
+		return
+	}
+	var req modelRebalanceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = "model " + m.Name
+	}
+
+	resp, ok := app.rebalance(w, r, requestUserID(r), strategyID, rebalanceRequest{
+		Weights: m.Weights,
+		Capital: req.Capital,
+		Execute: req.Execute,
+		Name:    req.Name,
+	})
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if resp.Basket != nil {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, resp)
+}
+
+// queryCapital parses the optional capital query parameter, writing an
+// error response if it is invalid
+func queryCapital(w http.ResponseWriter, r *http.Request) (*decimal.Decimal, bool) {
+	v := r.URL.Query().Get("capital")
+	if v == "" {
+		return nil, true
+	}
+	capital, err := decimal.NewFromString(v)
+	if err != nil {
+		http.Error(w, "Bad request: invalid capital", http.StatusBadRequest)
+		return nil, false
+	}
+	return &capital, true
+}
+
+// modelDrift values the book's positions and compares their weights of
+// capital with the model's, symbols outside the model having a target
+// weight of 0. Capital defaults to what the whole book is worth. On failure
+// it writes the error response and returns false.
+func (app *Application) modelDrift(w http.ResponseWriter, r *http.Request, m *database.ModelPortfolio, capital *decimal.Decimal) (*modelDrift, bool) {
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return nil, false
+	}
+	if capital != nil && !capital.IsPositive() {
+		http.Error(w, "Bad request: capital must be positive", http.StatusBadRequest)
+		return nil, false
+	}
+	userID := requestUserID(r)
+	legs, held, ok := app.rebalanceLegs(w, userID, strategyID, m.Weights)
+	if !ok {
+		return nil, false
+	}
+
+	// The book's other positions are in the model at weight 0
+	book := database.CashBook{UserID: userID}
+	if strategyID != nil {
+		book.StrategyID = *strategyID
+	}
+	positions, err := app.db.GetBookPositionCosts(book)
+	if err != nil {
+		log.Printf("Failed to load positions for model drift: %v", err)
+		http.Error(w, "Failed to load positions", http.StatusInternalServerError)
+		return nil, false
+	}
+	for _, p := range positions {
+		if _, ok := m.Weights[p.Symbol]; ok {
+			continue
+		}
+		price, err := app.marks.LatestPrice(p.Symbol)
+		if err != nil {
+			log.Printf("Failed to price %s for model drift: %v", p.Symbol, err)
+			http.Error(w, "No price for "+p.Symbol, http.StatusBadGateway)
+			return nil, false
+		}
+		held = held.Add(p.Qty.Mul(price).Abs())
+		legs = append(legs, rebalanceLeg{Symbol: p.Symbol, Weight: decimal.Zero, Price: price, Position: p.Qty})
+	}
+	if capital == nil {
+		capital = &held
+	}
+
+	drift := &modelDrift{Model: m.Name, Capital: *capital, Symbols: make([]symbolDrift, 0, len(legs))}
+	for _, leg := range legs {
+		d := symbolDrift{Symbol: leg.Symbol, TargetWeight: leg.Weight, Value: leg.Position.Mul(leg.Price).Round(2)}
+		if capital.IsPositive() {
+			d.Weight = d.Value.Div(*capital).Round(4)
+		}
+		d.Drift = d.Weight.Sub(d.TargetWeight)
+		drift.Symbols = append(drift.Symbols, d)
+		drift.Turnover = drift.Turnover.Add(d.Drift.Abs())
+		if d.Drift.Abs().GreaterThan(drift.MaxDrift) {
+			drift.MaxDrift = d.Drift.Abs()
+		}
+	}
+	sort.Slice(drift.Symbols, func(i, j int) bool { return drift.Symbols[i].Symbol < drift.Symbols[j].Symbol })
+	return drift, true
+}
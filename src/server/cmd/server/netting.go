@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/netting"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+	"desk/internal/risk"
+)
+
+// nettable reports whether an order is held for netting: netting is on and
+// it is a market DAY equity order from a strategy trading live in the desk's
+// account. A chapter with its own account can't share the desk's orders,
+// and a member trading on paper has none to share.
+func (app *Application) nettable(userID string, strategyID *int64, order *orders.Order) bool {
+	if app.netting == nil || strategyID == nil || !netting.Eligible(order) || app.brokers.ownAccount(userID) {
+		return false
+	}
+	if app.tradesOnPaper(userID) {
+		return false
+	}
+	simulated, err := app.db.IsSimulatedVariant(*strategyID)
+	if err != nil {
+		log.Printf("Failed to check experiment routing: %v", err)
+	}
+	return !simulated
+}
+
+// queueSignal runs pre-trade risk checks on a strategy's order and holds it
+// for netting. The response is 202 Accepted with a Location of the signal,
+// which records the strategy's fill once its batch is sent. body is the
+// request as received, for capture.
+func (app *Application) queueSignal(w http.ResponseWriter, r *http.Request, body []byte, userID string, strategyID int64, order *orders.Order, orderReq *orderprotos.OrderRequest) {
+	flags, err := app.gatePreTrade(userID, &strategyID, order, database.VenueNetted)
+	if err != nil {
+		app.captureFailure(requestCapture(r, orderRequestJSON(r, body)), userID, err)
+		status := http.StatusInternalServerError
+		var blocked *risk.BlockedError
+		if errors.As(err, &blocked) {
+			status = http.StatusForbidden
+		}
+		writeOrderError(w, r, status, orderReq, err)
+		return
+	}
+
+	signal, sendAt, err := app.netting.Add(database.NettingSignal{
+		UserID:          userID,
+		StrategyID:      strategyID,
+		StrategyVersion: app.strategyVersion(&strategyID),
+		Symbol:          order.Symbol,
+		Side:            order.Side,
+		Qty:             order.Qty,
+		CreatedAt:       order.ReceivedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to queue netting signal from user=%s: %v", userID, err)
+		writeOrderError(w, r, http.StatusServiceUnavailable, orderReq, err)
+		return
+	}
+
+	message := fmt.Sprintf("Held as netting signal %d; netted with other strategies' orders in %s at %s",
+		signal.ID, signal.Symbol, market.ExchangeTime(sendAt).Format("15:04:05.000 MST"))
+	for _, f := range flags {
+		message += "; " + describeFinding(f)
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/netting/signals/%d", signal.ID))
+	writeProto(w, r, http.StatusAccepted, &orderprotos.OrderResponse{
+		Status:      "success",
+		Message:     message,
+		Symbol:      signal.Symbol,
+		Qty:         signal.Qty.String(),
+		Side:        signal.Side,
+		FilledQty:   "0",
+		OrderStatus: database.SignalPending,
+	})
+}
+
+// handleGetNettingSignal returns one of the caller's netting signals with
+// its contribution to its batch
+func (app *Application) handleGetNettingSignal(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid signal ID", http.StatusBadRequest)
+		return
+	}
+
+	signal, err := app.db.GetNettingSignal(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && signal.UserID != requestUserID(r)) {
+		http.Error(w, "Signal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load netting signal: %v", err)
+		http.Error(w, "Failed to load netting signal", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, signal)
+}
+
+// handleGetNettingBatch returns a netted order with every strategy's
+// contribution to it. Only users with a signal in the batch can see it.
+func (app *Application) handleGetNettingBatch(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	batch, err := app.db.GetNettingBatch(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load netting batch: %v", err)
+		http.Error(w, "Failed to load netting batch", http.StatusInternalServerError)
+		return
+	}
+
+	userID := requestUserID(r)
+	for _, s := range batch.Signals {
+		if s.UserID == userID {
+			writeJSON(w, http.StatusOK, batch)
+			return
+		}
+	}
+	http.Error(w, "Batch not found", http.StatusNotFound)
+}
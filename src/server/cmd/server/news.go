@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/news"
+)
+
+// handleNews returns stored headlines, newest first. Query parameters:
+// symbols (comma-separated; default all) or watchlist (a watchlist ID), before (only articles created
+// before this time; default now) and limit (default 50, max 500).
+func (app *Application) handleNews(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	before := time.Now()
+	if v := query.Get("before"); v != "" {
+		t, err := market.ParseTime(v)
+		if err != nil {
+			http.Error(w, "Bad request: invalid before time", http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			http.Error(w, "Bad request: limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	symbols, ok := app.requestSymbols(w, r)
+	if !ok {
+		return
+	}
+
+	articles, err := app.db.GetNewsArticles(symbols, before, limit)
+	if err != nil {
+		log.Printf("Failed to load news: %v", err)
+		http.Error(w, "Failed to load news", http.StatusInternalServerError)
+		return
+	}
+	if articles == nil {
+		articles = []database.NewsArticle{}
+	}
+
+	writeJSON(w, http.StatusOK, articles)
+}
+
+// handleNewsStream streams newly relayed headlines as server-sent events,
+// optionally only those mentioning a symbol in ?symbols= or ?watchlist=
+func (app *Application) handleNewsStream(w http.ResponseWriter, r *http.Request) {
+	symbols, ok := app.requestSymbols(w, r)
+	if !ok {
+		return
+	}
+
+	articles, unsubscribe := app.news.Subscribe()
+	defer unsubscribe()
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case article, ok := <-articles:
+			if !ok {
+				return
+			}
+			if !news.Matches(article, symbols) {
+				continue
+			}
+			if err := writeSSE(w, flusher, "news", article); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/tenants"
+)
+
+// apiKeyPrefix starts every API key the desk issues, so one is recognizable
+// in a config file or a leak scan
+const apiKeyPrefix = "dk_"
+
+// onboardingDefaults are what a member is onboarded with when the request
+// doesn't say. Zero limits are no limit, and a zero allocation trades live.
+type onboardingDefaults struct {
+	MaxOrderNotional decimal.Decimal
+	MaxGrossExposure decimal.Decimal
+	PaperAllocation  decimal.Decimal
+	// APIURL is the address members are told to connect to
+	APIURL string
+}
+
+type onboardRequest struct {
+	UserID               string                         `json:"user_id"`
+	MaxOrderNotional     *decimal.Decimal               `json:"max_order_notional"`
+	MaxGrossExposure     *decimal.Decimal               `json:"max_gross_exposure"`
+	PaperAllocation      *decimal.Decimal               `json:"paper_allocation"`
+	NotificationChannels []database.NotificationChannel `json:"notification_channels"`
+}
+
+// memberLimits is the body of PUT /admin/users/{id}/limits
+type memberLimits struct {
+	MaxOrderNotional decimal.Decimal `json:"max_order_notional"`
+	MaxGrossExposure decimal.Decimal `json:"max_gross_exposure"`
+	PaperAllocation  decimal.Decimal `json:"paper_allocation"`
+}
+
+// connectionDetails is what a new member needs to reach the desk
+type connectionDetails struct {
+	APIURL  string `json:"api_url"`
+	UserID  string `json:"user_id"`
+	Chapter string `json:"chapter,omitempty"`
+	APIKey  string `json:"api_key"`
+}
+
+type onboardResponse struct {
+	Member     *database.Member  `json:"member"`
+	Key        *database.APIKey  `json:"key"`
+	Connection connectionDetails `json:"connection"`
+	// Welcomed reports whether the welcome reached any of the member's own
+	// notification channels
+	Welcomed bool `json:"welcomed"`
+}
+
+type memberResponse struct {
+	Member *database.Member      `json:"member"`
+	Keys   []database.APIKey     `json:"keys"`
+	Prefs  *database.Preferences `json:"preferences"`
+}
+
+type issuedKey struct {
+	Key    *database.APIKey `json:"key"`
+	APIKey string           `json:"api_key"`
+}
+
+// handleOnboardUser serves POST /admin/users on the admin port: it creates
+// the member with their risk limits and paper allocation, issues their
+// first API key, stores the notification channels they gave and sends them
+// a welcome with their connection details. The key is only ever shown in
+// the response and the welcome.
+func (app *Application) handleOnboardUser(w http.ResponseWriter, r *http.Request) {
+	var req onboardRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	member := &database.Member{
+		UserID:           req.UserID,
+		OnboardedAt:      time.Now(),
+		MaxOrderNotional: app.onboarding.MaxOrderNotional,
+		MaxGrossExposure: app.onboarding.MaxGrossExposure,
+		PaperAllocation:  app.onboarding.PaperAllocation,
+	}
+	if req.MaxOrderNotional != nil {
+		member.MaxOrderNotional = *req.MaxOrderNotional
+	}
+	if req.MaxGrossExposure != nil {
+		member.MaxGrossExposure = *req.MaxGrossExposure
+	}
+	if req.PaperAllocation != nil {
+		member.PaperAllocation = *req.PaperAllocation
+	}
+	if err := app.validateMember(member); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePreferences(&preferencesRequest{NotificationChannels: req.NotificationChannels}); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, plain, err := newAPIKey(member.UserID)
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		http.Error(w, "Failed to onboard user", http.StatusInternalServerError)
+		return
+	}
+	if err := app.db.OnboardMember(member, key); errors.Is(err, database.ErrMemberExists) {
+		http.Error(w, "User already exists; a deactivated member is restored instead", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Failed to onboard user %s: %v", member.UserID, err)
+		http.Error(w, "Failed to onboard user", http.StatusInternalServerError)
+		return
+	}
+
+	if len(req.NotificationChannels) > 0 {
+		prefs, err := app.db.GetPreferences(member.UserID)
+		if err == nil {
+			prefs.NotificationChannels = req.NotificationChannels
+			err = app.db.SetPreferences(prefs)
+		}
+		if err != nil {
+			log.Printf("Failed to store notification channels of user %s: %v", member.UserID, err)
+		}
+	}
+
+	conn := connectionDetails{
+		APIURL:  app.onboarding.APIURL,
+		UserID:  member.UserID,
+		Chapter: tenants.ChapterID(member.UserID),
+		APIKey:  plain,
+	}
+	writeJSON(w, http.StatusCreated, onboardResponse{
+		Member:     member,
+		Key:        key,
+		Connection: conn,
+		Welcomed:   app.welcome(member, conn),
+	})
+}
+
+// validateMember checks a member's ID names a user of a known chapter and
+// their limits aren't negative
+func (app *Application) validateMember(m *database.Member) error {
+	if m.UserID == "" || strings.ContainsAny(m.UserID, " \t\r\n") {
+		return errors.New("user_id is required and can't contain whitespace")
+	}
+	if app.tenants != nil && app.tenants.ChapterOf(m.UserID) == nil {
+		return fmt.Errorf("user_id %q names no chapter", m.UserID)
+	}
+	if m.MaxOrderNotional.IsNegative() || m.MaxGrossExposure.IsNegative() || m.PaperAllocation.IsNegative() {
+		return errors.New("limits and paper_allocation can't be negative")
+	}
+	return nil
+}
+
+// welcome tells a new member how to connect, and reports whether it reached
+// any of their own channels. The message has their API key, so it goes
+// only to the member's channels, whatever level they are set to; the desk's
+// notifier is told who joined.
+func (app *Application) welcome(m *database.Member, conn connectionDetails) bool {
+	ctx := context.Background()
+	notify.Send(ctx, app.notifier, notify.LevelInfo, "Member onboarded",
+		fmt.Sprintf("%s joined the desk; %s", m.UserID, describeMember(m)))
+
+	channels, err := preferenceChannels(app.db)(m.UserID)
+	if err != nil {
+		log.Printf("Failed to load channels of user %s: %v", m.UserID, err)
+		return false
+	}
+	n := notify.Notification{
+		Level:   notify.LevelInfo,
+		Title:   "Welcome to the desk",
+		Message: welcomeMessage(m, conn),
+		Time:    time.Now(),
+		UserID:  m.UserID,
+	}
+	welcomed := false
+	for _, c := range channels {
+		if err := c.Notifier.Notify(ctx, n); err != nil {
+			log.Printf("Failed to send welcome to user %s: %v", m.UserID, err)
+			continue
+		}
+		welcomed = true
+	}
+	return welcomed
+}
+
+// describeMember summarizes a member's limits and where their orders go
+func describeMember(m *database.Member) string {
+	limit := func(d decimal.Decimal) string {
+		if d.IsZero() {
+			return "none"
+		}
+		return d.StringFixed(2)
+	}
+	venue := "orders go live"
+	if m.Paper() {
+		venue = fmt.Sprintf("orders go to the simulator with %s of paper cash", m.PaperAllocation.StringFixed(2))
+	}
+	return fmt.Sprintf("%s; order limit %s, gross exposure limit %s", venue, limit(m.MaxOrderNotional), limit(m.MaxGrossExposure))
+}
+
+// welcomeMessage is a new member's connection details
+func welcomeMessage(m *database.Member, conn connectionDetails) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your desk account %s is ready.\n\n", conn.UserID)
+	fmt.Fprintf(&b, "API: %s\n", conn.APIURL)
+	fmt.Fprintf(&b, "API key: %s\n", conn.APIKey)
+	b.WriteString("Send the key as X-API-Key on every request, in place of X-User-ID. It isn't shown again; ask an admin for a new one if it's lost.\n")
+	if conn.Chapter != "" {
+		fmt.Fprintf(&b, "Your chapter is %s: also send its token as Authorization: Bearer <token>.\n", conn.Chapter)
+	}
+	fmt.Fprintf(&b, "\nAccount: %s.\n", describeMember(m))
+	fmt.Fprintf(&b, "\nWith desk_client, set DESK_SERVER_URL=%s and DESK_API_KEY to the key.", conn.APIURL)
+	return b.String()
+}
+
+// newAPIKey generates an API key for userID, returning it to store and in
+// plain text to hand to the member
+func newAPIKey(userID string) (*database.APIKey, string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	plain := apiKeyPrefix + hex.EncodeToString(secret)
+	return &database.APIKey{
+		UserID:    userID,
+		Prefix:    plain[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(plain),
+		CreatedAt: time.Now(),
+	}, plain, nil
+}
+
+// hashAPIKey is how an API key is stored and looked up
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyHandler authenticates requests that send an X-API-Key as the key's
+// user. An unknown or revoked key is refused with 401; a key of a
+// deactivated member, of another chapter's user or sent with another
+// user's X-User-ID with 403. Requests without a key are passed on as they
+// are.
+func (app *Application) apiKeyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := app.db.GetAPIKeyUser(hashAPIKey(key))
+		if err != nil {
+			log.Printf("Failed to authenticate API key: %v", err)
+			http.Error(w, "Failed to authenticate API key", http.StatusInternalServerError)
+			return
+		}
+		if userID == "" {
+			http.Error(w, "Unauthorized: unknown or revoked API key", http.StatusUnauthorized)
+			return
+		}
+		chapter := tenants.FromContext(r.Context())
+		if chapter != nil && !chapter.Owns(userID) {
+			http.Error(w, "Forbidden: API key belongs to another chapter", http.StatusForbidden)
+			return
+		}
+		if named := r.Header.Get("X-User-ID"); named != "" && qualifyUserID(chapter, named) != userID {
+			http.Error(w, "Forbidden: X-User-ID is not the API key's user", http.StatusForbidden)
+			return
+		}
+		if deleted, err := app.db.IsUserDeleted(userID); err != nil {
+			log.Printf("Failed to check user %s: %v", userID, err)
+			http.Error(w, "Failed to authenticate API key", http.StatusInternalServerError)
+			return
+		} else if deleted {
+			http.Error(w, "Forbidden: user has been deactivated", http.StatusForbidden)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set("X-User-ID", userID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tradesOnPaper reports whether userID is a member trading on the
+// simulator with a paper allocation
+func (app *Application) tradesOnPaper(userID string) bool {
+	member, err := app.db.GetMember(userID)
+	if err != nil {
+		log.Printf("Failed to check paper trading of user %s: %v", userID, err)
+		return false
+	}
+	return member != nil && member.Paper()
+}
+
+// handleGetMember serves GET /admin/users/{id}: the member's limits, paper
+// allocation, API keys (without the keys themselves) and preferences
+func (app *Application) handleGetMember(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.member(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	keys, err := app.db.GetAPIKeys(member.UserID)
+	if err != nil {
+		log.Printf("Failed to load API keys of user %s: %v", member.UserID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+	prefs, err := app.db.GetPreferences(member.UserID)
+	if err != nil {
+		log.Printf("Failed to load preferences of user %s: %v", member.UserID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, memberResponse{Member: member, Keys: keys, Prefs: prefs})
+}
+
+// handleSetMemberLimits serves PUT /admin/users/{id}/limits, replacing a
+// member's limits and paper allocation. Setting the allocation to zero
+// moves the member to live trading.
+func (app *Application) handleSetMemberLimits(w http.ResponseWriter, r *http.Request) {
+	var req memberLimits
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	member, ok := app.member(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	member.MaxOrderNotional = req.MaxOrderNotional
+	member.MaxGrossExposure = req.MaxGrossExposure
+	member.PaperAllocation = req.PaperAllocation
+	if err := app.validateMember(member); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := app.db.SetMemberLimits(member); err != nil {
+		log.Printf("Failed to set limits of user %s: %v", member.UserID, err)
+		http.Error(w, "Failed to set limits", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Set limits of user=%s: %s", member.UserID, describeMember(member))
+	writeJSON(w, http.StatusOK, member)
+}
+
+// handleCreateAPIKey serves POST /admin/users/{id}/keys, issuing a member
+// another API key, e.g. to replace a lost one. The key is only shown in the
+// response.
+func (app *Application) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.member(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	key, plain, err := newAPIKey(member.UserID)
+	if err == nil {
+		err = app.db.CreateAPIKey(key)
+	}
+	if err != nil {
+		log.Printf("Failed to issue API key to user %s: %v", member.UserID, err)
+		http.Error(w, "Failed to issue API key", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Issued API key %s to user=%s", key.Prefix, member.UserID)
+	writeJSON(w, http.StatusCreated, issuedKey{Key: key, APIKey: plain})
+}
+
+// handleRevokeAPIKey serves DELETE /admin/users/{id}/keys/{key}, where key
+// is the key's ID
+func (app *Application) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	id, err := strconv.ParseInt(r.PathValue("key"), 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request: invalid key ID", http.StatusBadRequest)
+		return
+	}
+	revoked, err := app.db.RevokeAPIKey(userID, id)
+	if err != nil {
+		log.Printf("Failed to revoke API key %d of user %s: %v", id, userID, err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// member loads an onboarded member, answering 404 if there is none
+func (app *Application) member(w http.ResponseWriter, userID string) (*database.Member, bool) {
+	member, err := app.db.GetMember(userID)
+	if err != nil {
+		log.Printf("Failed to load user %s: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return nil, false
+	}
+	if member == nil {
+		http.Error(w, "User not found or not onboarded", http.StatusNotFound)
+		return nil, false
+	}
+	return member, true
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	alpacaapi "github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+)
+
+// Where an open order was found, and whether the desk and the broker agree
+// on it
+const (
+	openMatched         = "matched"
+	openDiffers         = "differs"
+	openMissingAtBroker = "missing_at_broker"
+	openUnknownToDesk   = "unknown_to_desk"
+)
+
+// openOrder is an order open in the desk's book, at the broker or both.
+// Desk fields are empty for an order the desk doesn't know, and broker
+// fields are from GetOrder for one the broker no longer has open.
+type openOrder struct {
+	State string `json:"state"`
+	// Account is the chapter whose account the order is in, empty for the
+	// desk's
+	Account       string           `json:"account,omitempty"`
+	OrderID       string           `json:"order_id"`
+	ClientOrderID string           `json:"client_order_id,omitempty"`
+	Symbol        string           `json:"symbol"`
+	Side          string           `json:"side"`
+	OrderType     string           `json:"order_type"`
+	TimeInForce   string           `json:"time_in_force"`
+	Qty           decimal.Decimal  `json:"qty"`
+	LimitPrice    *decimal.Decimal `json:"limit_price,omitempty"`
+	StopPrice     *decimal.Decimal `json:"stop_price,omitempty"`
+	SubmittedAt   time.Time        `json:"submitted_at"`
+
+	TradeID         int64            `json:"trade_id,omitempty"`
+	UserID          string           `json:"user_id,omitempty"`
+	StrategyID      *int64           `json:"strategy_id,omitempty"`
+	DeskStatus      string           `json:"desk_status,omitempty"`
+	DeskFilledQty   *decimal.Decimal `json:"desk_filled_qty,omitempty"`
+	BrokerStatus    string           `json:"broker_status,omitempty"`
+	BrokerFilledQty *decimal.Decimal `json:"broker_filled_qty,omitempty"`
+	// Problem says what doesn't match, for every state but matched
+	Problem string `json:"problem,omitempty"`
+}
+
+// openOrderBook is the open orders of one or every account, reconciled
+// between the desk's book and the broker
+type openOrderBook struct {
+	CheckedAt       time.Time   `json:"checked_at"`
+	Matched         int         `json:"matched"`
+	Differs         int         `json:"differs"`
+	MissingAtBroker int         `json:"missing_at_broker"`
+	UnknownToDesk   int         `json:"unknown_to_desk"`
+	Orders          []openOrder `json:"orders"`
+}
+
+// add adds o to the book and counts it by its state
+func (b *openOrderBook) add(o openOrder) {
+	b.Orders = append(b.Orders, o)
+	switch o.State {
+	case openMatched:
+		b.Matched++
+	case openDiffers:
+		b.Differs++
+	case openMissingAtBroker:
+		b.MissingAtBroker++
+	case openUnknownToDesk:
+		b.UnknownToDesk++
+	}
+}
+
+// openOrders reconciles the open orders of the accounts with the desk's
+// book. The broker is asked first, and only trades submitted before are
+// expected at the broker, so an order placed meanwhile doesn't show up as
+// missing. Orders open at the broker that aren't open in the book are looked
+// up in it, so one whose trade is already finished differs rather than being
+// unknown. Orders on the simulator never reach the broker and are left out.
+func (app *Application) openOrders(accounts map[string]Broker) (*openOrderBook, error) {
+	asked := app.clock.Now()
+	atBroker := make(map[string]alpacaapi.Order)
+	accountOf := make(map[string]string)
+	for account, client := range accounts {
+		resting, err := client.OpenOrders()
+		if err != nil {
+			if account != "" {
+				err = fmt.Errorf("chapter %s: %w", account, err)
+			}
+			return nil, err
+		}
+		for _, o := range resting {
+			atBroker[o.ID] = o
+			accountOf[o.ID] = account
+		}
+	}
+	trades, err := app.db.GetOpenTrades("", asked)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &openOrderBook{CheckedAt: app.clock.Now(), Orders: []openOrder{}}
+	inBook := make(map[string]bool, len(trades))
+	for _, t := range trades {
+		account := app.brokers.accountOf(t.UserID)
+		if _, ok := accounts[account]; !ok || t.Venue == database.VenueSimulator {
+			continue
+		}
+		inBook[t.OrderID] = true
+		o := deskOpenOrder(&t, account)
+		if placed, ok := atBroker[t.OrderID]; ok {
+			o.compare(&placed)
+		} else {
+			o.State = openMissingAtBroker
+			o.Problem = "open in the book but not at the broker"
+			// Say what became of it, which is usually an update the desk
+			// missed
+			if placed, err := accounts[account].GetOrder(t.OrderID); err != nil {
+				o.Problem += fmt.Sprintf(" (broker lookup failed: %v)", err)
+			} else {
+				o.withBroker(placed)
+				o.Problem = fmt.Sprintf("open in the book but %s at the broker", placed.Status)
+			}
+		}
+		book.add(o)
+	}
+
+	var unmatched []string
+	for id := range atBroker {
+		if !inBook[id] {
+			unmatched = append(unmatched, id)
+		}
+	}
+	known, err := app.db.GetTradesByOrderIDs(unmatched)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range known {
+		placed := atBroker[t.OrderID]
+		inBook[t.OrderID] = true
+		o := deskOpenOrder(&t, accountOf[t.OrderID])
+		o.compare(&placed)
+		book.add(o)
+	}
+	for _, id := range unmatched {
+		if inBook[id] {
+			continue
+		}
+		placed := atBroker[id]
+		o := openOrder{
+			State:         openUnknownToDesk,
+			Account:       accountOf[id],
+			OrderID:       placed.ID,
+			ClientOrderID: placed.ClientOrderID,
+			Symbol:        placed.Symbol,
+			Side:          string(placed.Side),
+			OrderType:     string(placed.Type),
+			TimeInForce:   string(placed.TimeInForce),
+			LimitPrice:    placed.LimitPrice,
+			StopPrice:     placed.StopPrice,
+			SubmittedAt:   placed.SubmittedAt,
+			Problem:       "open at the broker but not in the book",
+		}
+		if placed.Qty != nil {
+			o.Qty = *placed.Qty
+		}
+		o.withBroker(&placed)
+		book.add(o)
+	}
+	sort.Slice(book.Orders, func(i, j int) bool {
+		return book.Orders[i].SubmittedAt.Before(book.Orders[j].SubmittedAt)
+	})
+	return book, nil
+}
+
+// deskOpenOrder describes an open trade from the desk's book
+func deskOpenOrder(t *database.Trade, account string) openOrder {
+	filled := t.FilledQty
+	return openOrder{
+		Account:       account,
+		OrderID:       t.OrderID,
+		ClientOrderID: t.ClientOrderID,
+		Symbol:        t.Symbol,
+		Side:          t.Side,
+		OrderType:     t.OrderType,
+		TimeInForce:   t.TimeInForce,
+		Qty:           t.Qty,
+		LimitPrice:    t.LimitPrice,
+		StopPrice:     t.StopPrice,
+		SubmittedAt:   t.SubmittedAt,
+		TradeID:       t.ID,
+		UserID:        t.UserID,
+		StrategyID:    t.StrategyID,
+		DeskStatus:    t.OrderStatus,
+		DeskFilledQty: &filled,
+	}
+}
+
+// compare sets the broker's view of an order both have, and whether it
+// matches the desk's
+func (o *openOrder) compare(placed *alpacaapi.Order) {
+	o.withBroker(placed)
+	switch {
+	case !o.DeskFilledQty.Equal(placed.FilledQty):
+		o.State = openDiffers
+		o.Problem = fmt.Sprintf("the desk has %s filled, the broker %s", o.DeskFilledQty, placed.FilledQty)
+	case o.DeskStatus != o.BrokerStatus:
+		o.State = openDiffers
+		o.Problem = fmt.Sprintf("the desk has the order %s, the broker %s", o.DeskStatus, o.BrokerStatus)
+	default:
+		o.State = openMatched
+	}
+}
+
+// withBroker sets the broker's view of the order
+func (o *openOrder) withBroker(placed *alpacaapi.Order) {
+	filled := placed.FilledQty
+	o.BrokerStatus = string(placed.Status)
+	o.BrokerFilledQty = &filled
+}
+
+// handleOpenOrders reconciles the open orders of the caller's account with
+// the book. Orders of other users are left out; orders the desk doesn't
+// know have no user and are always shown.
+func (app *Application) handleOpenOrders(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	account := app.brokers.accountOf(userID)
+	book, err := app.openOrders(map[string]Broker{account: app.brokers.forUser(userID)})
+	if err != nil {
+		log.Printf("Failed to reconcile open orders: %v", err)
+		http.Error(w, "Failed to reconcile open orders", http.StatusBadGateway)
+		return
+	}
+
+	mine := &openOrderBook{CheckedAt: book.CheckedAt, Orders: []openOrder{}}
+	for _, o := range book.Orders {
+		if o.UserID != "" && o.UserID != userID {
+			continue
+		}
+		mine.add(o)
+	}
+	writeJSON(w, http.StatusOK, mine)
+}
+
+// handleAdminOpenOrders reconciles the open orders of every account and
+// user with the book
+func (app *Application) handleAdminOpenOrders(w http.ResponseWriter, r *http.Request) {
+	book, err := app.openOrders(app.brokers.accounts())
+	if err != nil {
+		log.Printf("Failed to reconcile open orders: %v", err)
+		http.Error(w, "Failed to reconcile open orders", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, book)
+}
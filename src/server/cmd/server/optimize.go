@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/optimize"
+	"desk/internal/screener"
+)
+
+// optimizeRequest asks for target weights over the listed symbols, a named
+// universe or a watchlist
+type optimizeRequest struct {
+	Symbols   []string `json:"symbols"`
+	Universe  string   `json:"universe"`
+	Watchlist int64    `json:"watchlist"`
+	Method    string   `json:"method"`
+	// RiskAversion weighs variance against expected return for
+	// mean_variance; it defaults to 3
+	RiskAversion *float64 `json:"risk_aversion"`
+	// MaxWeight caps each symbol's weight; it defaults to 1 (no cap)
+	MaxWeight *float64 `json:"max_weight"`
+	// LookbackDays is how many daily returns to estimate from
+	LookbackDays int `json:"lookback_days"`
+	// Rebalance, if given, also plans (and with execute places) the orders
+	// that take positions to the weights, as POST /rebalance does
+	Rebalance *optimizeRebalance `json:"rebalance"`
+}
+
+type optimizeRebalance struct {
+	Capital *decimal.Decimal `json:"capital"`
+	Execute bool             `json:"execute"`
+	Name    string           `json:"name"`
+}
+
+type optimizeResponse struct {
+	*optimize.Result
+	Rebalance *rebalanceResponse `json:"rebalance,omitempty"`
+}
+
+// defaultLookbackDays is the lookback used when a request doesn't give one
+const defaultLookbackDays = 100
+
+// handleOptimize computes long-only target weights for a universe from the
+// screener's cached daily bars and optionally rebalances to them
+func (app *Application) handleOptimize(w http.ResponseWriter, r *http.Request) {
+	var req optimizeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+
+	opts := optimize.Options{Method: req.Method, RiskAversion: 3, MaxWeight: 1, Lookback: req.LookbackDays}
+	if opts.Method == "" {
+		opts.Method = optimize.MethodMeanVariance
+	}
+	if !optimize.ValidMethod(opts.Method) {
+		http.Error(w, "Bad request: method must be mean_variance, min_variance or risk_parity", http.StatusBadRequest)
+		return
+	}
+	if req.RiskAversion != nil {
+		if *req.RiskAversion <= 0 {
+			http.Error(w, "Bad request: risk_aversion must be positive", http.StatusBadRequest)
+			return
+		}
+		opts.RiskAversion = *req.RiskAversion
+	}
+	if req.MaxWeight != nil {
+		if opts.Method == optimize.MethodRiskParity {
+			http.Error(w, "Bad request: max_weight doesn't apply to risk_parity", http.StatusBadRequest)
+			return
+		}
+		if *req.MaxWeight <= 0 || *req.MaxWeight > 1 {
+			http.Error(w, "Bad request: max_weight must be in (0, 1]", http.StatusBadRequest)
+			return
+		}
+		opts.MaxWeight = *req.MaxWeight
+	}
+	if opts.Lookback == 0 {
+		opts.Lookback = defaultLookbackDays
+	}
+	if opts.Lookback < optimize.MinObservations || opts.Lookback >= screener.HistoryBars {
+		http.Error(w, fmt.Sprintf("Bad request: lookback_days must be between %d and %d", optimize.MinObservations, screener.HistoryBars-1), http.StatusBadRequest)
+		return
+	}
+
+	symbols, err := app.optimizeSymbols(r, req)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bars, err := app.screener.Bars(symbols)
+	if err != nil {
+		log.Printf("Failed to load bars to optimize: %v", err)
+		http.Error(w, "Failed to load market data", http.StatusBadGateway)
+		return
+	}
+	result, err := optimize.Run(bars, symbols, opts)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := optimizeResponse{Result: result}
+	if req.Rebalance == nil {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	rebalance := rebalanceRequest{
+		Weights: make(map[string]decimal.Decimal, len(result.Weights)),
+		Capital: req.Rebalance.Capital,
+		Execute: req.Rebalance.Execute,
+		Name:    req.Rebalance.Name,
+	}
+	// Weights are rounded, so they can sum to a hair over one; the excess
+	// comes off the largest
+	total, top := decimal.Zero, result.Weights[0]
+	for _, weight := range result.Weights {
+		rebalance.Weights[weight.Symbol] = decimal.NewFromFloat(weight.Weight)
+		total = total.Add(rebalance.Weights[weight.Symbol])
+		if weight.Weight > top.Weight {
+			top = weight
+		}
+	}
+	if excess := total.Sub(decimal.NewFromInt(1)); excess.IsPositive() {
+		rebalance.Weights[top.Symbol] = rebalance.Weights[top.Symbol].Sub(excess)
+	}
+	var ok bool
+	if resp.Rebalance, ok = app.rebalance(w, r, requestUserID(r), strategyID, rebalance); !ok {
+		return
+	}
+	status := http.StatusOK
+	if resp.Rebalance.Basket != nil {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, resp)
+}
+
+// optimizeSymbols resolves the universe of an optimize request
+func (app *Application) optimizeSymbols(r *http.Request, req optimizeRequest) ([]string, error) {
+	targets := 0
+	for _, set := range []bool{len(req.Symbols) > 0, req.Universe != "", req.Watchlist != 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return nil, fmt.Errorf("give one of symbols, universe or watchlist")
+	}
+
+	var symbols []string
+	switch {
+	case len(req.Symbols) > 0:
+		symbols = app.aliases.ResolveAll(req.Symbols)
+	case req.Universe != "":
+		universe, ok := app.universe(req.Universe)
+		if !ok {
+			return nil, fmt.Errorf("unknown universe %s", req.Universe)
+		}
+		symbols = app.aliases.ResolveAll(universe)
+	default:
+		wl, err := app.db.GetWatchlist(req.Watchlist)
+		if err != nil || !wl.VisibleTo(requestUserID(r)) {
+			return nil, fmt.Errorf("watchlist %d not found", req.Watchlist)
+		}
+		symbols = app.aliases.ResolveAll(wl.Symbols)
+	}
+	slices.Sort(symbols)
+	if len(symbols) > maxBasketLegs {
+		return nil, fmt.Errorf("at most %d symbols can be optimized", maxBasketLegs)
+	}
+	return symbols, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"desk/internal/alpaca"
+	"desk/internal/database"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+	"desk/internal/risk"
+)
+
+// defaultOrderBudget is the p99 an order may take through the whole
+// pipeline, against a local database and broker. ORDER_LATENCY_BUDGET
+// overrides it, e.g. on slow CI machines.
+const defaultOrderBudget = 10 * time.Millisecond
+
+// budgetOrders is how many orders the budget test times
+const budgetOrders = 2000
+
+// benchOrder is a typical order as a strategy sends it
+var benchOrder = &orderprotos.OrderRequest{
+	Symbol:      "AAPL",
+	Qty:         "10",
+	Side:        "buy",
+	OrderType:   "limit",
+	TimeInForce: "day",
+	LimitPrice:  "187.25",
+}
+
+// benchBroker stands in for Alpaca, accepting every order as new under an
+// order ID of its own
+func benchBroker(tb testing.TB) *alpaca.Client {
+	var orderIDs atomic.Int64
+	order := `{
+		"id": "bench-%d",
+		"client_order_id": "bench",
+		"symbol": "AAPL",
+		"asset_class": "us_equity",
+		"qty": "10",
+		"filled_qty": "0",
+		"side": "buy",
+		"type": "limit",
+		"time_in_force": "day",
+		"limit_price": "187.25",
+		"status": "new",
+		"created_at": "2026-01-05T15:00:00Z",
+		"updated_at": "2026-01-05T15:00:00Z",
+		"submitted_at": "2026-01-05T15:00:00Z"
+	}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v2/account":
+			w.Write([]byte(`{"id": "bench", "status": "ACTIVE", "currency": "USD"}`))
+		case "/v2/orders":
+			fmt.Fprintf(w, order, orderIDs.Add(1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	tb.Cleanup(server.Close)
+
+	client, err := alpaca.NewClient("key", "secret", server.URL, server.Client())
+	if err != nil {
+		tb.Fatalf("connect to broker: %v", err)
+	}
+	return client
+}
+
+// benchApp wires the order pipeline to a scratch database and benchBroker,
+// with the risk rules every order meets
+func benchApp(tb testing.TB) *Application {
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	db, err := database.NewDB(filepath.Join(tb.TempDir(), "desk.db"))
+	if err != nil {
+		tb.Fatalf("open database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	app := newApplication(Dependencies{Broker: benchBroker(tb), DB: db})
+	app.preTrade.Replace(risk.NewDeletedRule(db), risk.NewClientClockRule(time.Minute, app.nonces))
+	return app
+}
+
+// orderRequest builds a POST /order request with a binary protobuf body
+func orderRequest(body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/order", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set("X-User-ID", "bench")
+	return r
+}
+
+func marshalBenchOrder(tb testing.TB) []byte {
+	body, err := proto.Marshal(benchOrder)
+	if err != nil {
+		tb.Fatalf("marshal order: %v", err)
+	}
+	return body
+}
+
+func BenchmarkOrderUnmarshal(b *testing.B) {
+	jsonBody, err := protojson.Marshal(benchOrder)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, c := range []struct {
+		name, contentType string
+		body              []byte
+	}{
+		{"proto", "application/x-protobuf", marshalBenchOrder(b)},
+		{"json", "application/json", jsonBody},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			r := orderRequest(c.body)
+			r.Header.Set("Content-Type", c.contentType)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				var req orderprotos.OrderRequest
+				if err := unmarshalProto(r, c.body, &req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkOrderValidate(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := orders.FromRequest(benchOrder, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOrderRisk(b *testing.B) {
+	app := benchApp(b)
+	order, err := orders.FromRequest(benchOrder, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := app.checkPreTrade("bench", nil, order); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOrderBroker(b *testing.B) {
+	client := benchBroker(b)
+	order, err := orders.FromRequest(benchOrder, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := client.PlaceOrder(order); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOrderLogTrade(b *testing.B) {
+	app := benchApp(b)
+	now := time.Now()
+	trade := database.Trade{
+		UserID:      "bench",
+		Symbol:      "AAPL",
+		Side:        "buy",
+		OrderType:   "limit",
+		TimeInForce: "day",
+		OrderStatus: "new",
+		Venue:       database.VenueAlpaca,
+		ReceivedAt:  &now,
+		SentAt:      &now,
+		AckedAt:     &now,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		t := trade
+		t.OrderID = fmt.Sprintf("bench-%d", i)
+		t.SubmittedAt = time.Now()
+		if _, err := app.db.LogTrade(&t); err != nil {
+			b.Fatal(err)
+		}
+		if err := app.dailyAggregates.RecordTrade(t); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkOrderPipeline times POST /order end to end: unmarshal,
+// validation, risk, the broker and logging the trade
+func BenchmarkOrderPipeline(b *testing.B) {
+	app := benchApp(b)
+	body := marshalBenchOrder(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		w := httptest.NewRecorder()
+		app.handleOrder(w, orderRequest(body))
+		if w.Code != http.StatusCreated {
+			b.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+}
+
+// TestOrderLatencyBudget fails when the pipeline's p99 is over budget
+func TestOrderLatencyBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("times thousands of orders")
+	}
+	budget := defaultOrderBudget
+	if v := os.Getenv("ORDER_LATENCY_BUDGET"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			t.Fatalf("invalid ORDER_LATENCY_BUDGET %q: %v", v, err)
+		}
+		budget = d
+	}
+
+	app := benchApp(t)
+	body := marshalBenchOrder(t)
+	took := make([]time.Duration, budgetOrders)
+	for i := range took {
+		w := httptest.NewRecorder()
+		r := orderRequest(body)
+		start := time.Now()
+		app.handleOrder(w, r)
+		took[i] = time.Since(start)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("order %d: status %d: %s", i, w.Code, w.Body)
+		}
+	}
+
+	// The handler answers even when it fails to log the trade
+	logged, err := app.db.GetBlotterTrades(database.BlotterFilter{UserID: "bench"}, budgetOrders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != budgetOrders {
+		t.Fatalf("logged %d of %d trades", len(logged), budgetOrders)
+	}
+
+	slices.Sort(took)
+	p50, p99 := took[len(took)/2], took[len(took)*99/100]
+	t.Logf("%d orders: p50 %s, p99 %s, max %s", len(took), p50, p99, took[len(took)-1])
+	if p99 > budget {
+		t.Errorf("p99 %s is over the %s budget", p99, budget)
+	}
+}
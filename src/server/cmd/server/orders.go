@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/sweeper"
+)
+
+// handleGTCOrders lists the caller's open GTC orders with their age and
+// distance from the market. With stale=true only orders the stale-order
+// policy would act on are returned.
+func (app *Application) handleGTCOrders(w http.ResponseWriter, r *http.Request) {
+	views, err := app.gtcOrders.Orders(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load GTC orders: %v", err)
+		http.Error(w, "Failed to load GTC orders", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("stale") == "true" {
+		stale := []sweeper.GTCOrder{}
+		for _, v := range views {
+			if v.Stale {
+				stale = append(stale, v)
+			}
+		}
+		views = stale
+	}
+
+	writeJSON(w, http.StatusOK, views)
+}
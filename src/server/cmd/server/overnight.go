@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"desk/internal/checklist"
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/risk"
+)
+
+// overnightChecklist checks, lead before every close, the gross exposure
+// the desk is about to carry overnight against the overnight limits
+func (app *Application) overnightChecklist(lead time.Duration) *checklist.Checklist {
+	return &checklist.Checklist{
+		Name:  "overnight",
+		Title: "End-of-session risk check",
+		At: func(date string) (time.Time, error) {
+			closeAt, err := market.SessionClose(date)
+			return closeAt.Add(-lead), err
+		},
+		Steps: []checklist.Step{
+			{Name: "overnight limits", Run: app.checkOvernight},
+		},
+	}
+}
+
+// overnightSettings returns the overnight limits and action in force
+func (app *Application) overnightSettings() (risk.OvernightLimits, string) {
+	app.overnightMu.RLock()
+	defer app.overnightMu.RUnlock()
+	return app.overnightLimits, app.overnightAction
+}
+
+// overnightReductions returns the reductions that would bring the desk
+// account within the overnight limits. Positions of chapters that trade in
+// their own account aren't in the snapshot's exposure, so aren't cut.
+func (app *Application) overnightReductions(check risk.OvernightCheck) []risk.Reduction {
+	var positions []database.PositionMark
+	for _, p := range app.marks.Positions("") {
+		if !app.brokers.ownAccount(p.UserID) {
+			positions = append(positions, p)
+		}
+	}
+	return risk.OvernightReductions(positions, check.GrossExposure, check.Excess)
+}
+
+// checkOvernight compares the desk's gross exposure with the overnight
+// limits. Under the flag action an excess fails the step, which notifies;
+// under reduce every position is cut in proportion and each cut notified to
+// its owner.
+func (app *Application) checkOvernight(ctx context.Context, date string) (string, error) {
+	limits, action := app.overnightSettings()
+	if !limits.Enabled() {
+		return "", checklist.Skip("no overnight limits are set")
+	}
+	snap := app.riskSnapshots.Latest()
+	if snap == nil {
+		return "", errors.New("no risk snapshot has been taken yet")
+	}
+
+	check := risk.CheckOvernight(snap, limits)
+	summary := fmt.Sprintf("gross exposure %s, %s allowed overnight", check.GrossExposure.StringFixed(2), check.Allowed.StringFixed(2))
+	if !check.Excess.IsPositive() {
+		return summary, nil
+	}
+	if action != risk.OvernightReduce {
+		return "", fmt.Errorf("%s: %s over", summary, check.Excess.StringFixed(2))
+	}
+
+	var placed int
+	var failures []string
+	for _, cut := range app.overnightReductions(check) {
+		var strategyID *int64
+		if cut.StrategyID != 0 {
+			strategyID = &cut.StrategyID
+		}
+		assetClass := orders.AssetClassOf(cut.Symbol)
+		trade, _, err := app.submitOrder(cut.UserID, strategyID, &orders.Order{
+			Symbol:      cut.Symbol,
+			AssetClass:  assetClass,
+			Side:        cut.Side,
+			Type:        "market",
+			TimeInForce: app.timeInForces.For(assetClass),
+			Qty:         cut.Qty,
+			Source:      orders.SourceScheduler,
+		})
+		if err != nil {
+			log.Printf("Failed to place overnight reduction of %s %s for %s: %v", cut.Qty, cut.Symbol, cut.UserID, err)
+			failures = append(failures, fmt.Sprintf("%s %s for %s: %v", cut.Symbol, cut.Qty, cut.UserID, err))
+			continue
+		}
+		placed++
+		notify.SendUser(ctx, app.userNotifier, cut.UserID, notify.LevelWarning, "Overnight reduction",
+			fmt.Sprintf("The desk is %s over its overnight limit: %s %s %s placed as order %s to cut your position",
+				check.Excess.StringFixed(2), cut.Side, cut.Qty, cut.Symbol, trade.OrderID))
+	}
+
+	summary = fmt.Sprintf("%s: %s over, placed %d reductions", summary, check.Excess.StringFixed(2), placed)
+	if len(failures) > 0 {
+		return "", fmt.Errorf("%s; %d failed: %s", summary, len(failures), strings.Join(failures, "; "))
+	}
+	return summary, nil
+}
+
+// overnightResponse is the overnight limits in force and how the desk
+// stands against them now
+type overnightResponse struct {
+	Limits    risk.OvernightLimits `json:"limits"`
+	Action    string               `json:"action"`
+	Check     *risk.OvernightCheck `json:"check,omitempty"`
+	Proposals []risk.Reduction     `json:"proposals"`
+}
+
+// handleOvernight returns the overnight limits and, from the latest risk
+// snapshot, the reductions the end-of-session check would make now
+func (app *Application) handleOvernight(w http.ResponseWriter, r *http.Request) {
+	limits, action := app.overnightSettings()
+	resp := overnightResponse{
+		Limits:    limits,
+		Action:    action,
+		Proposals: []risk.Reduction{},
+	}
+
+	if snap := app.riskSnapshots.Latest(); snap != nil && limits.Enabled() {
+		check := risk.CheckOvernight(snap, limits)
+		resp.Check = &check
+		if cuts := app.overnightReductions(check); cuts != nil {
+			resp.Proposals = cuts
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"desk/internal/database"
+	"desk/internal/positions"
+	positionprotos "desk/internal/protos/positions"
+	"desk/internal/risk"
+	"desk/internal/tenants"
+)
+
+// positionsScope is whose positions a stream carries: one user's, or
+// everyone's if UserID is empty, optionally only one strategy's
+type positionsScope struct {
+	UserID     string
+	StrategyID *int64
+	Risk       bool
+}
+
+func (s positionsScope) matches(key positions.Key) bool {
+	return (s.UserID == "" || key.UserID == s.UserID) &&
+		(s.StrategyID == nil || key.StrategyID == *s.StrategyID)
+}
+
+// positionRecord encodes a marked position for the positions stream
+func positionRecord(p database.PositionMark) *positionprotos.Position {
+	return &positionprotos.Position{
+		UserId:       p.UserID,
+		StrategyId:   p.StrategyID,
+		Symbol:       p.Symbol,
+		Qty:          p.Qty.String(),
+		AvgCost:      p.AvgCost.String(),
+		Price:        p.Price.String(),
+		MarketValue:  p.MarketValue.String(),
+		UnrealizedPl: p.UnrealizedPL.String(),
+		MarkedAt:     p.MarkedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// riskRecord encodes a risk snapshot for the positions stream
+func riskRecord(s *risk.Snapshot) *positionprotos.Risk {
+	return &positionprotos.Risk{
+		Timestamp:        s.Timestamp.UTC().Format(time.RFC3339Nano),
+		Equity:           s.Equity.String(),
+		BuyingPower:      s.BuyingPower.String(),
+		Cash:             s.Cash.String(),
+		LongExposure:     s.LongExposure.String(),
+		ShortExposure:    s.ShortExposure.String(),
+		GrossExposure:    s.GrossExposure.String(),
+		NetExposure:      s.NetExposure.String(),
+		OpenOrders:       int64(s.OpenOrders),
+		PeakEquity:       s.PeakEquity.String(),
+		Drawdown:         s.Drawdown.String(),
+		DrawdownLimit:    s.DrawdownLimit.String(),
+		DrawdownBreached: s.DrawdownBreached,
+		Leverage:         s.Leverage.String(),
+		LeverageLimit:    s.LeverageLimit.String(),
+		LeverageBreached: s.LeverageBreached,
+	}
+}
+
+// positionsSnapshot encodes the part of state in scope
+func positionsSnapshot(state positions.State, scope positionsScope, seq uint64) *positionprotos.PositionsMessage {
+	snap := &positionprotos.PositionsSnapshot{Seq: seq, Positions: []*positionprotos.Position{}}
+	for _, p := range state.Positions {
+		if scope.matches(positions.KeyOf(p)) {
+			snap.Positions = append(snap.Positions, positionRecord(p))
+		}
+	}
+	if scope.Risk && state.Risk != nil {
+		snap.Risk = riskRecord(state.Risk)
+	}
+	return &positionprotos.PositionsMessage{Message: &positionprotos.PositionsMessage_Snapshot{Snapshot: snap}}
+}
+
+// positionsDelta encodes the part of d in scope, or returns nil if none of
+// it is
+func positionsDelta(d positions.Delta, scope positionsScope, seq uint64) *positionprotos.PositionsMessage {
+	delta := &positionprotos.PositionsDelta{Seq: seq}
+	for _, p := range d.Upserted {
+		if scope.matches(positions.KeyOf(p)) {
+			delta.Upserted = append(delta.Upserted, positionRecord(p))
+		}
+	}
+	for _, key := range d.Removed {
+		if scope.matches(key) {
+			delta.Removed = append(delta.Removed, &positionprotos.PositionKey{
+				UserId:     key.UserID,
+				StrategyId: key.StrategyID,
+				Symbol:     key.Symbol,
+			})
+		}
+	}
+	if scope.Risk && d.Risk != nil {
+		delta.Risk = riskRecord(d.Risk)
+	}
+	if len(delta.Upserted) == 0 && len(delta.Removed) == 0 && delta.Risk == nil {
+		return nil
+	}
+	return &positionprotos.PositionsMessage{Message: &positionprotos.PositionsMessage_Delta{Delta: delta}}
+}
+
+// handlePositionsStream streams marked positions, and the desk's risk to
+// the host chapter, over a websocket: a snapshot, then a delta of what
+// changed each time positions are marked or risk is snapshotted. Messages
+// are binary protobuf PositionsMessages, or protojson text with
+// ?format=json. Seq counts the connection's messages; a client that sees a
+// gap sends a PositionsResync and gets a new snapshot. A client that falls
+// behind the desk is sent a new snapshot without asking.
+func (app *Application) handlePositionsStream(w http.ResponseWriter, r *http.Request) {
+	strategyID, ok := queryStrategyID(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	scope := positionsScope{UserID: requestUserID(r), StrategyID: strategyID, Risk: requestHost(r)}
+	switch user := query.Get("user"); user {
+	case "":
+	case "*":
+		scope.UserID = ""
+	default:
+		scope.UserID = qualifyUserID(tenants.FromContext(r.Context()), user)
+	}
+	if scope.UserID != requestUserID(r) && !requestHost(r) {
+		http.Error(w, "Forbidden: only the host chapter may watch other users' positions", http.StatusForbidden)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "proto" && format != "json" {
+		http.Error(w, "Bad request: format must be proto or json", http.StatusBadRequest)
+		return
+	}
+	asJSON := format == "json"
+
+	conn, ok := app.sockets.accept(w, r, "positions")
+	if !ok {
+		return
+	}
+	defer conn.close()
+
+	// Read resync requests until the client goes away, which ends the stream
+	resyncs := make(chan *positionprotos.PositionsResync)
+	go func() {
+		defer conn.cancel()
+		for {
+			_, data, err := conn.read()
+			if err != nil {
+				return
+			}
+			req := &positionprotos.PositionsResync{}
+			if asJSON {
+				err = protojson.Unmarshal(data, req)
+			} else {
+				err = proto.Unmarshal(data, req)
+			}
+			if err != nil {
+				conn.Close(websocket.StatusUnsupportedData, "expected a PositionsResync")
+				return
+			}
+			select {
+			case resyncs <- req:
+			case <-conn.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// seq numbers the messages sent on this connection
+	var seq uint64
+	send := func(msg *positionprotos.PositionsMessage) error {
+		var data []byte
+		var err error
+		typ := websocket.MessageBinary
+		if asJSON {
+			data, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+			typ = websocket.MessageText
+		} else {
+			data, err = proto.Marshal(msg)
+		}
+		if err != nil {
+			return err
+		}
+		return conn.write(typ, data)
+	}
+
+	deltas, state, unsubscribe := app.positionFeed.Subscribe()
+	defer unsubscribe()
+	// last is the feed's seq the client is up to date with
+	last := state.Seq
+	seq++
+	if err := send(positionsSnapshot(state, scope, seq)); err != nil {
+		log.Printf("Failed to send positions snapshot: %v", err)
+		return
+	}
+	resnapshot := func() error {
+		state := app.positionFeed.Snapshot()
+		last = state.Seq
+		seq++
+		return send(positionsSnapshot(state, scope, seq))
+	}
+
+	for {
+		select {
+		case <-conn.ctx.Done():
+			conn.Close(websocket.StatusNormalClosure, "")
+			return
+
+		case req := <-resyncs:
+			if !conn.resubscribe() {
+				// The client can't apply deltas without a snapshot, so it
+				// has to come back later for one
+				conn.Close(websocket.StatusTryAgainLater, "too many resyncs")
+				return
+			}
+			log.Printf("Positions stream resync requested at seq %d of %d", req.LastSeq, seq)
+			if err := resnapshot(); err != nil {
+				return
+			}
+
+		case d, ok := <-deltas:
+			if !ok {
+				return
+			}
+			if d.Seq <= last {
+				// Already in the last snapshot
+				continue
+			}
+			if d.Seq != last+1 {
+				// Deltas were dropped; a snapshot has them all
+				if err := resnapshot(); err != nil {
+					return
+				}
+				continue
+			}
+			last = d.Seq
+			msg := positionsDelta(d, scope, seq+1)
+			if msg == nil {
+				continue
+			}
+			seq++
+			if err := send(msg); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+)
+
+// maxNotificationChannels is the most channels a user can have
+const maxNotificationChannels = 5
+
+type preferencesRequest struct {
+	DefaultOrderType     string                         `json:"default_order_type"`
+	DefaultTimeInForce   string                         `json:"default_time_in_force"`
+	ConfirmOrders        bool                           `json:"confirm_orders"`
+	NotificationChannels []database.NotificationChannel `json:"notification_channels"`
+}
+
+// handleGetPreferences returns the caller's preferences
+func (app *Application) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := app.db.GetPreferences(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load preferences: %v", err)
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// handleSetPreferences replaces the caller's preferences. Fields left out
+// are cleared.
+func (app *Application) handleSetPreferences(w http.ResponseWriter, r *http.Request) {
+	var req preferencesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if err := validatePreferences(&req); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	if err := app.db.SetPreferences(&database.Preferences{
+		UserID:               userID,
+		DefaultOrderType:     req.DefaultOrderType,
+		DefaultTimeInForce:   req.DefaultTimeInForce,
+		ConfirmOrders:        req.ConfirmOrders,
+		NotificationChannels: req.NotificationChannels,
+	}); err != nil {
+		log.Printf("Failed to store preferences: %v", err)
+		http.Error(w, "Failed to store preferences", http.StatusInternalServerError)
+		return
+	}
+
+	prefs, err := app.db.GetPreferences(userID)
+	if err != nil {
+		log.Printf("Failed to load preferences: %v", err)
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// handleDeletePreferences resets the caller's preferences to the defaults
+func (app *Application) handleDeletePreferences(w http.ResponseWriter, r *http.Request) {
+	if err := app.db.DeletePreferences(requestUserID(r)); err != nil {
+		log.Printf("Failed to reset preferences: %v", err)
+		http.Error(w, "Failed to reset preferences", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validatePreferences checks the defaults are ones an order accepts and
+// every channel can be delivered to
+func validatePreferences(req *preferencesRequest) error {
+	if req.DefaultOrderType != "" && !orders.ValidType(req.DefaultOrderType) {
+		return fmt.Errorf("%q is not a supported order type", req.DefaultOrderType)
+	}
+	if req.DefaultTimeInForce != "" && !orders.ValidTimeInForce(req.DefaultTimeInForce) {
+		return fmt.Errorf("%q is not a supported time in force", req.DefaultTimeInForce)
+	}
+	if len(req.NotificationChannels) > maxNotificationChannels {
+		return fmt.Errorf("at most %d notification channels are allowed", maxNotificationChannels)
+	}
+	for _, c := range req.NotificationChannels {
+		if c.Type != database.ChannelWebhook && c.Type != database.ChannelDiscord {
+			return fmt.Errorf("%q is not a notification channel type; use webhook or discord", c.Type)
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%q is not an http(s) URL", c.URL)
+		}
+		if c.MinLevel != "" && !notify.ValidLevel(c.MinLevel) {
+			return fmt.Errorf("min_level %q is not info, warning or error", c.MinLevel)
+		}
+	}
+	return nil
+}
+
+// applyOrderDefaults fills the order type and time in force an order leaves
+// empty from userID's preferences and the server's defaults. Orders that
+// state both don't read them.
+func (app *Application) applyOrderDefaults(userID string, req *orderprotos.OrderRequest) error {
+	if !needsOrderDefaults(req) {
+		return nil
+	}
+	prefs, err := app.db.GetPreferences(userID)
+	if err != nil {
+		return err
+	}
+	fillOrderDefaults(prefs, app.timeInForces, req)
+	return nil
+}
+
+// needsOrderDefaults reports whether an order leaves its type or time in
+// force to the user's defaults
+func needsOrderDefaults(req *orderprotos.OrderRequest) bool {
+	return req.GetOrderType() == "" || req.GetTimeInForce() == ""
+}
+
+// fillOrderDefaults fills the order type and time in force an order leaves
+// empty from prefs. A preferred time in force the order can't use, such as
+// day for crypto or ioc for a stop order, gives way to the server's default
+// for the order's asset class.
+func fillOrderDefaults(prefs *database.Preferences, defaults orders.TimeInForceDefaults, req *orderprotos.OrderRequest) {
+	if req.GetOrderType() == "" {
+		req.OrderType = prefs.DefaultOrderType
+	}
+	if req.GetTimeInForce() == "" {
+		assetClass := orders.AssetClassOf(req.GetSymbol())
+		req.TimeInForce = prefs.DefaultTimeInForce
+		if !orders.TimeInForceAllowed(assetClass, req.GetOrderType(), req.TimeInForce) {
+			req.TimeInForce = defaults.For(assetClass)
+		}
+	}
+}
+
+// preferenceChannels looks up the notification channels users have set in
+// their preferences
+func preferenceChannels(db *database.DB) func(userID string) ([]notify.UserChannel, error) {
+	return func(userID string) ([]notify.UserChannel, error) {
+		prefs, err := db.GetPreferences(userID)
+		if err != nil {
+			return nil, err
+		}
+		channels := make([]notify.UserChannel, 0, len(prefs.NotificationChannels))
+		for _, c := range prefs.NotificationChannels {
+			switch c.Type {
+			case database.ChannelWebhook:
+				channels = append(channels, notify.UserChannel{Notifier: notify.NewWebhook(c.URL), MinLevel: c.MinLevel})
+			case database.ChannelDiscord:
+				channels = append(channels, notify.UserChannel{Notifier: notify.NewDiscord(c.URL), MinLevel: c.MinLevel})
+			}
+		}
+		return channels, nil
+	}
+}
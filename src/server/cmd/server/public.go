@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"desk/internal/reports"
+	"desk/internal/tenants"
+)
+
+// publicCacheTTL is how long the public performance page is served from
+// cache, so an unauthenticated page can't load the database
+const publicCacheTTL = 5 * time.Minute
+
+// publicPerformance configures and caches the public performance page
+type publicPerformance struct {
+	days       int
+	minMembers int
+
+	mu      sync.Mutex
+	page    *reports.Public
+	builtAt time.Time
+}
+
+type publicOptIn struct {
+	OptedIn   bool       `json:"opted_in"`
+	OptedInAt *time.Time `json:"opted_in_at,omitempty"`
+}
+
+// errTooFewMembers is returned while fewer members have opted in than the
+// page needs to stay anonymous
+type errTooFewMembers struct{}
+
+func (errTooFewMembers) Error() string { return "not enough members have opted in" }
+
+// publicPage returns the public performance page, rebuilding it if the
+// cached one is older than publicCacheTTL
+func (app *Application) publicPage() (*reports.Public, error) {
+	p := app.public
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.page != nil && time.Since(p.builtAt) < publicCacheTTL {
+		return p.page, nil
+	}
+
+	opted, err := app.db.GetPublicPerformanceMembers()
+	if err != nil {
+		return nil, err
+	}
+	// The page is the host club's; other chapters can't opt in
+	var members []string
+	for _, m := range opted {
+		if tenants.ChapterID(m) == "" {
+			members = append(members, m)
+		}
+	}
+	if len(members) < p.minMembers {
+		return nil, errTooFewMembers{}
+	}
+
+	page, err := app.weeklyReports.Public(members, p.days)
+	if err != nil {
+		return nil, err
+	}
+	p.page, p.builtAt = page, time.Now()
+	return page, nil
+}
+
+// writePublicError responds to a failure building the public page
+func writePublicError(w http.ResponseWriter, err error) {
+	if _, ok := err.(errTooFewMembers); ok {
+		http.Error(w, "Club performance isn't published yet: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Failed to build public performance: %v", err)
+	http.Error(w, "Failed to load performance", http.StatusInternalServerError)
+}
+
+// handlePublicPerformance serves the embeddable public performance page
+func (app *Application) handlePublicPerformance(w http.ResponseWriter, r *http.Request) {
+	page, err := app.publicPage()
+	if err != nil {
+		writePublicError(w, err)
+		return
+	}
+
+	html, err := reports.RenderPublicHTML(page)
+	if err != nil {
+		log.Printf("Failed to render public performance: %v", err)
+		http.Error(w, "Failed to load performance", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// handlePublicPerformanceJSON serves the public performance page's data for
+// club websites that draw their own chart
+func (app *Application) handlePublicPerformanceJSON(w http.ResponseWriter, r *http.Request) {
+	page, err := app.publicPage()
+	if err != nil {
+		writePublicError(w, err)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, page)
+}
+
+// publicHandler serves only the public performance page, for a listener that
+// can be exposed to the internet without the API behind it
+func (app *Application) publicHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /performance", app.handlePublicPerformance)
+	mux.HandleFunc("GET /performance.json", app.handlePublicPerformanceJSON)
+	return mux
+}
+
+func (app *Application) handleGetPublicOptIn(w http.ResponseWriter, r *http.Request) {
+	at, err := app.db.GetPublicPerformanceOptIn(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load public performance opt-in: %v", err)
+		http.Error(w, "Failed to load opt-in", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, publicOptIn{OptedIn: at != nil, OptedInAt: at})
+}
+
+// handlePublicOptIn includes the caller's books in the public performance
+// page
+func (app *Application) handlePublicOptIn(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	if err := app.db.OptInPublicPerformance(userID); err != nil {
+		log.Printf("Failed to opt in to public performance: %v", err)
+		http.Error(w, "Failed to opt in", http.StatusInternalServerError)
+		return
+	}
+	app.handleGetPublicOptIn(w, r)
+}
+
+// handlePublicOptOut removes the caller's books from the public performance
+// page. The cached page keeps them until it expires.
+func (app *Application) handlePublicOptOut(w http.ResponseWriter, r *http.Request) {
+	if err := app.db.OptOutPublicPerformance(requestUserID(r)); err != nil {
+		log.Printf("Failed to opt out of public performance: %v", err)
+		http.Error(w, "Failed to opt out", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/orders"
+)
+
+// rebalanceRequest asks for the orders that take positions to target
+// weights of capital. Weights are fractions that may sum to less than one,
+// the rest staying in cash; symbols held but not weighted are left alone.
+type rebalanceRequest struct {
+	Weights map[string]decimal.Decimal `json:"weights"`
+	// Capital is what the weights are fractions of; it defaults to the
+	// current value of the positions in the weighted symbols
+	Capital *decimal.Decimal `json:"capital"`
+	// Execute submits the orders as a basket rather than only listing them
+	Execute bool   `json:"execute"`
+	Name    string `json:"name"`
+}
+
+// rebalanceLeg is the order that takes one symbol's position to its target.
+// Side and Qty are empty when the position is already on target.
+type rebalanceLeg struct {
+	Symbol    string          `json:"symbol"`
+	Weight    decimal.Decimal `json:"weight"`
+	Price     decimal.Decimal `json:"price"`
+	Position  decimal.Decimal `json:"position"`
+	TargetQty decimal.Decimal `json:"target_qty"`
+	Side      string          `json:"side,omitempty"`
+	Qty       decimal.Decimal `json:"qty"`
+	Notional  decimal.Decimal `json:"notional"`
+}
+
+type rebalanceResponse struct {
+	Capital decimal.Decimal `json:"capital"`
+	Legs    []rebalanceLeg  `json:"legs"`
+	// Basket is the outcome of the submitted orders, when executed
+	Basket *basketResponse `json:"basket,omitempty"`
+}
+
+// handleRebalance computes, and optionally places, the orders that take the
+// caller's positions to target weights
+func (app *Application) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	var req rebalanceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	strategyID, err := requestStrategyID(r)
+	if err != nil {
+		http.Error(w, "Bad request: invalid X-Strategy-ID", http.StatusBadRequest)
+		return
+	}
+
+	resp, ok := app.rebalance(w, r, requestUserID(r), strategyID, req)
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if resp.Basket != nil {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, resp)
+}
+
+// targetWeights checks weights by symbol, fractions of capital, and
+// returns them by resolved symbol
+func (app *Application) targetWeights(raw map[string]decimal.Decimal) (map[string]decimal.Decimal, error) {
+	if len(raw) == 0 || len(raw) > maxBasketLegs {
+		return nil, fmt.Errorf("weights needs between 1 and %d symbols", maxBasketLegs)
+	}
+	weights := make(map[string]decimal.Decimal, len(raw))
+	total := decimal.Zero
+	for symbol, weight := range raw {
+		if weight.IsNegative() {
+			return nil, fmt.Errorf("weight of %s is negative", symbol)
+		}
+		symbol = app.aliases.Resolve(symbol)
+		weights[symbol] = weights[symbol].Add(weight)
+		total = total.Add(weight)
+	}
+	if total.GreaterThan(decimal.NewFromInt(1)) {
+		return nil, fmt.Errorf("weights sum to %s, more than 1", total)
+	}
+	return weights, nil
+}
+
+// rebalanceLegs prices the book's position in each weighted symbol, the
+// caller's manual book or a strategy's, and returns the legs with what the
+// positions are worth. On failure it writes the error response and returns
+// false.
+func (app *Application) rebalanceLegs(w http.ResponseWriter, userID string, strategyID *int64, weights map[string]decimal.Decimal) ([]rebalanceLeg, decimal.Decimal, bool) {
+	var positionStrategy int64
+	if strategyID != nil {
+		positionStrategy = *strategyID
+	}
+	held := decimal.Zero
+	legs := make([]rebalanceLeg, 0, len(weights))
+	for symbol, weight := range weights {
+		price, err := app.marks.LatestPrice(symbol)
+		if err != nil {
+			log.Printf("Failed to price %s for rebalance: %v", symbol, err)
+			http.Error(w, "No price for "+symbol, http.StatusBadGateway)
+			return nil, decimal.Zero, false
+		}
+		position, err := app.db.GetPositionQty(userID, positionStrategy, symbol)
+		if err != nil {
+			log.Printf("Failed to load position for rebalance: %v", err)
+			http.Error(w, "Failed to load positions", http.StatusInternalServerError)
+			return nil, decimal.Zero, false
+		}
+		held = held.Add(position.Mul(price).Abs())
+		legs = append(legs, rebalanceLeg{Symbol: symbol, Weight: weight, Price: price, Position: position})
+	}
+	return legs, held, true
+}
+
+// rebalance plans the orders of req and, if it asks, submits them as a
+// basket. On failure it writes the error response and returns false.
+func (app *Application) rebalance(w http.ResponseWriter, r *http.Request, userID string, strategyID *int64, req rebalanceRequest) (*rebalanceResponse, bool) {
+	source, err := requestOrderSource(r, strategyID)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	weights, err := app.targetWeights(req.Weights)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Capital != nil && !req.Capital.IsPositive() {
+		http.Error(w, "Bad request: capital must be positive", http.StatusBadRequest)
+		return nil, false
+	}
+
+	legs, held, ok := app.rebalanceLegs(w, userID, strategyID, weights)
+	if !ok {
+		return nil, false
+	}
+
+	capital := held
+	if req.Capital != nil {
+		capital = *req.Capital
+	}
+	if !capital.IsPositive() {
+		http.Error(w, "Bad request: capital is required when none of the symbols is held", http.StatusBadRequest)
+		return nil, false
+	}
+
+	for i := range legs {
+		leg := &legs[i]
+		inst := app.instruments.Lookup(leg.Symbol)
+		leg.TargetQty = inst.RoundQty(leg.Weight.Mul(capital).Div(leg.Price))
+		diff := leg.TargetQty.Sub(leg.Position)
+		leg.Qty = inst.RoundQty(diff.Abs())
+		if leg.Qty.IsZero() {
+			continue
+		}
+		leg.Side = "buy"
+		if diff.IsNegative() {
+			leg.Side = "sell"
+		}
+		leg.Notional = leg.Qty.Mul(leg.Price).Round(2)
+	}
+	// Sells go first so they free up buying power for the buys
+	sort.Slice(legs, func(i, j int) bool {
+		if (legs[i].Side == "sell") != (legs[j].Side == "sell") {
+			return legs[i].Side == "sell"
+		}
+		return legs[i].Symbol < legs[j].Symbol
+	})
+
+	resp := &rebalanceResponse{Capital: capital, Legs: legs}
+	if !req.Execute {
+		return resp, true
+	}
+
+	var basket []*orders.Order
+	var bodies []any
+	receivedAt := clock.Now()
+	for _, leg := range legs {
+		if leg.Side == "" {
+			continue
+		}
+		// Crypto orders can't be day orders
+		tif := "day"
+		if orders.AssetClassOf(leg.Symbol) == orders.AssetClassCrypto {
+			tif = "gtc"
+		}
+		basket = append(basket, &orders.Order{
+			Symbol:      leg.Symbol,
+			AssetClass:  orders.AssetClassOf(leg.Symbol),
+			Side:        leg.Side,
+			Type:        "market",
+			TimeInForce: tif,
+			Qty:         leg.Qty,
+			ReceivedAt:  receivedAt,
+			Source:      source,
+		})
+		bodies = append(bodies, leg)
+	}
+	if len(basket) == 0 {
+		return resp, true
+	}
+	if req.Name == "" {
+		req.Name = "rebalance"
+	}
+	result, _ := app.placeBasket(r, userID, strategyID, req.Name, database.GroupBasket, basket, bodies)
+	resp.Basket = &result
+	return resp, true
+}
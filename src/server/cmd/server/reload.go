@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/carry"
+	"desk/internal/cashsweep"
+	"desk/internal/hedge"
+	"desk/internal/instruments"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/risk"
+	"desk/internal/screener"
+	"desk/internal/sweeper"
+	"desk/internal/symbols"
+)
+
+// reloadableKeys are the variables applied by a reload. Changes to any other
+// variable take effect on the next restart.
+var reloadableKeys = []string{
+	"MAX_DRAWDOWN_PCT",
+	"MAX_LEVERAGE",
+	"OVERNIGHT_MAX_GROSS",
+	"OVERNIGHT_MAX_LEVERAGE",
+	"OVERNIGHT_ACTION",
+	"MAX_USER_CONCENTRATION_PCT",
+	"MAX_DESK_CONCENTRATION_PCT",
+	"CONCENTRATION_ACTION",
+	"RISK_RULES_FILE",
+	"NOTIFY_WEBHOOK_URL",
+	"NOTIFY_DISCORD_URL",
+	"ALERT_MAX_EXPOSURE",
+	"ALERT_MAX_CONCENTRATION_PCT",
+	"ALERT_MIN_CASH",
+	"ALERT_REPEAT",
+	"GTC_STALE_ACTION",
+	"GTC_STALE_DRIFT_PCT",
+	"GTC_STALE_DAYS",
+	"GTC_REPRICE_OFFSET_PCT",
+	"EARNINGS_RULE",
+	"EARNINGS_WINDOW_HOURS",
+	"SCREEN_UNIVERSES_FILE",
+	"INSTRUMENTS_FILE",
+	"BORROW_RATE",
+	"BORROW_RATES",
+	"MARGIN_RATE",
+	"MAX_DELTA",
+	"MAX_GAMMA",
+	"MAX_THETA",
+	"MAX_VEGA",
+	"PRICE_STALE_AFTER",
+	"PRICE_STALE_RULE",
+	"USER_ALLOCATIONS",
+	"ORDER_CAPTURE",
+	"CLIENT_MAX_AGE",
+	"HEDGE_RULES",
+	"HEDGE_ACTION",
+	"CASH_MIN",
+	"CASH_MAX_PCT",
+	"CASH_SWEEP_SYMBOL",
+	"CASH_SWEEP_ACTION",
+	"CONFIRM_ORDER_SOURCES",
+}
+
+// settings is the configuration that can change without a restart: risk
+// limits, symbol lists and notification settings
+type settings struct {
+	drawdownLimit     decimal.Decimal
+	leverageLimit     decimal.Decimal
+	overnight         risk.OvernightLimits
+	overnightAction   string
+	concentration     risk.ConcentrationLimits
+	concentrationRule string
+	customRules       []risk.CustomRuleDef
+	webhookURL        string
+	discordURL        string
+	alerts            notify.Thresholds
+	alertRepeat       time.Duration
+	gtcPolicy         sweeper.GTCPolicy
+	earningsRule      string
+	earningsWindow    time.Duration
+	universes         map[string][]string
+	instruments       map[string]instruments.Override
+	carryRates        carry.Rates
+	greekLimits       risk.GreekLimits
+	staleAfter        time.Duration
+	staleRule         string
+	allocations       map[string]decimal.Decimal
+	orderCapture      bool
+	clientMaxAge      time.Duration
+	hedgePolicy       hedge.Policy
+	cashRules         cashsweep.Rules
+	cashAction        string
+	confirmSources    map[string]bool
+}
+
+// loadSettings parses the reloadable settings from getenv
+func loadSettings(getenv func(string) string) (*settings, error) {
+	s := &settings{
+		drawdownLimit: decimal.NewFromFloat(0.05),
+		webhookURL:    getenv("NOTIFY_WEBHOOK_URL"),
+		discordURL:    getenv("NOTIFY_DISCORD_URL"),
+		alertRepeat:   time.Hour,
+		gtcPolicy: sweeper.GTCPolicy{
+			Action:        sweeper.ActionNone,
+			MaxDrift:      decimal.NewFromFloat(0.05),
+			StaleDays:     5,
+			RepriceOffset: decimal.NewFromFloat(0.001),
+		},
+		earningsRule:      "off",
+		earningsWindow:    24 * time.Hour,
+		staleAfter:        2 * time.Minute,
+		staleRule:         risk.ActionFlag,
+		hedgePolicy:       hedge.Policy{Action: hedge.ActionPropose},
+		cashRules:         cashsweep.Rules{Symbol: cashsweep.DefaultSymbol},
+		cashAction:        cashsweep.ActionPropose,
+		overnightAction:   risk.OvernightFlag,
+		concentrationRule: risk.ActionBlock,
+	}
+
+	var err error
+	if v := getenv("MAX_DRAWDOWN_PCT"); v != "" {
+		if s.drawdownLimit, err = decimal.NewFromString(v); err != nil {
+			return nil, fmt.Errorf("invalid MAX_DRAWDOWN_PCT: %w", err)
+		}
+	}
+	if v := getenv("MAX_LEVERAGE"); v != "" {
+		if s.leverageLimit, err = decimal.NewFromString(v); err != nil || s.leverageLimit.IsNegative() {
+			return nil, fmt.Errorf("invalid MAX_LEVERAGE: %q", v)
+		}
+	}
+	if v := getenv("OVERNIGHT_MAX_GROSS"); v != "" {
+		if s.overnight.MaxGross, err = decimal.NewFromString(v); err != nil || s.overnight.MaxGross.IsNegative() {
+			return nil, fmt.Errorf("invalid OVERNIGHT_MAX_GROSS: %q", v)
+		}
+	}
+	if v := getenv("OVERNIGHT_MAX_LEVERAGE"); v != "" {
+		if s.overnight.MaxLeverage, err = decimal.NewFromString(v); err != nil || s.overnight.MaxLeverage.IsNegative() {
+			return nil, fmt.Errorf("invalid OVERNIGHT_MAX_LEVERAGE: %q", v)
+		}
+	}
+	switch v := getenv("OVERNIGHT_ACTION"); v {
+	case "":
+	case risk.OvernightFlag, risk.OvernightReduce:
+		s.overnightAction = v
+	default:
+		return nil, fmt.Errorf("invalid OVERNIGHT_ACTION: %q (want flag or reduce)", v)
+	}
+	for key, limit := range map[string]*decimal.Decimal{
+		"MAX_USER_CONCENTRATION_PCT": &s.concentration.User,
+		"MAX_DESK_CONCENTRATION_PCT": &s.concentration.Desk,
+	} {
+		if v := getenv(key); v != "" {
+			if *limit, err = decimal.NewFromString(v); err != nil || limit.IsNegative() {
+				return nil, fmt.Errorf("invalid %s: %q", key, v)
+			}
+		}
+	}
+	switch v := getenv("CONCENTRATION_ACTION"); v {
+	case "":
+	case risk.ActionBlock, risk.ActionTrim:
+		s.concentrationRule = v
+	default:
+		return nil, fmt.Errorf("invalid CONCENTRATION_ACTION: %q (want block or trim)", v)
+	}
+	if s.customRules, err = risk.LoadCustomRules(getenv("RISK_RULES_FILE")); err != nil {
+		return nil, fmt.Errorf("invalid RISK_RULES_FILE: %w", err)
+	}
+
+	if v := getenv("ALERT_MAX_EXPOSURE"); v != "" {
+		if s.alerts.MaxExposure, err = decimal.NewFromString(v); err != nil || s.alerts.MaxExposure.IsNegative() {
+			return nil, fmt.Errorf("invalid ALERT_MAX_EXPOSURE: %q", v)
+		}
+	}
+	if v := getenv("ALERT_MAX_CONCENTRATION_PCT"); v != "" {
+		if s.alerts.MaxConcentration, err = decimal.NewFromString(v); err != nil || s.alerts.MaxConcentration.IsNegative() {
+			return nil, fmt.Errorf("invalid ALERT_MAX_CONCENTRATION_PCT: %q", v)
+		}
+	}
+	if v := getenv("ALERT_MIN_CASH"); v != "" {
+		minCash, err := decimal.NewFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ALERT_MIN_CASH: %q", v)
+		}
+		s.alerts.MinCash = &minCash
+	}
+	if v := getenv("ALERT_REPEAT"); v != "" {
+		if s.alertRepeat, err = time.ParseDuration(v); err != nil || s.alertRepeat < 0 {
+			return nil, fmt.Errorf("invalid ALERT_REPEAT: %q", v)
+		}
+	}
+
+	if v := getenv("GTC_STALE_ACTION"); v != "" {
+		if v != sweeper.ActionNone && v != sweeper.ActionCancel && v != sweeper.ActionReprice {
+			return nil, fmt.Errorf("invalid GTC_STALE_ACTION: %q (want none, cancel or reprice)", v)
+		}
+		s.gtcPolicy.Action = v
+	}
+	if v := getenv("GTC_STALE_DRIFT_PCT"); v != "" {
+		if s.gtcPolicy.MaxDrift, err = decimal.NewFromString(v); err != nil {
+			return nil, fmt.Errorf("invalid GTC_STALE_DRIFT_PCT: %w", err)
+		}
+	}
+	if v := getenv("GTC_STALE_DAYS"); v != "" {
+		if s.gtcPolicy.StaleDays, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid GTC_STALE_DAYS: %w", err)
+		}
+	}
+	if v := getenv("GTC_REPRICE_OFFSET_PCT"); v != "" {
+		offset, err := decimal.NewFromString(v)
+		if err != nil || offset.IsNegative() || offset.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			return nil, fmt.Errorf("invalid GTC_REPRICE_OFFSET_PCT: %q (want a fraction from 0 to 1)", v)
+		}
+		s.gtcPolicy.RepriceOffset = offset
+	}
+
+	if v := getenv("EARNINGS_WINDOW_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EARNINGS_WINDOW_HOURS: %w", err)
+		}
+		s.earningsWindow = time.Duration(hours) * time.Hour
+	}
+	switch v := getenv("EARNINGS_RULE"); v {
+	case "", "off":
+	case risk.ActionFlag, risk.ActionBlock:
+		s.earningsRule = v
+	default:
+		return nil, fmt.Errorf("invalid EARNINGS_RULE: %q (want off, flag or block)", v)
+	}
+
+	if s.universes, err = screener.LoadUniverses(getenv("SCREEN_UNIVERSES_FILE")); err != nil {
+		return nil, fmt.Errorf("invalid SCREEN_UNIVERSES_FILE: %w", err)
+	}
+	if s.instruments, err = instruments.Load(getenv("INSTRUMENTS_FILE")); err != nil {
+		return nil, fmt.Errorf("invalid INSTRUMENTS_FILE: %w", err)
+	}
+
+	if v := getenv("BORROW_RATE"); v != "" {
+		if s.carryRates.Borrow, err = decimal.NewFromString(v); err != nil || s.carryRates.Borrow.IsNegative() {
+			return nil, fmt.Errorf("invalid BORROW_RATE: %q", v)
+		}
+	}
+	if s.carryRates.BorrowBySymbol, err = carry.ParseBorrowRates(getenv("BORROW_RATES")); err != nil {
+		return nil, fmt.Errorf("invalid BORROW_RATES: %w", err)
+	}
+	if v := getenv("MARGIN_RATE"); v != "" {
+		if s.carryRates.Margin, err = decimal.NewFromString(v); err != nil || s.carryRates.Margin.IsNegative() {
+			return nil, fmt.Errorf("invalid MARGIN_RATE: %q", v)
+		}
+	}
+
+	if v := getenv("PRICE_STALE_AFTER"); v != "" {
+		if s.staleAfter, err = time.ParseDuration(v); err != nil || s.staleAfter < 0 {
+			return nil, fmt.Errorf("invalid PRICE_STALE_AFTER: %q", v)
+		}
+	}
+	switch v := getenv("PRICE_STALE_RULE"); v {
+	case "":
+	case "off", risk.ActionFlag, risk.ActionBlock:
+		s.staleRule = v
+	default:
+		return nil, fmt.Errorf("invalid PRICE_STALE_RULE: %q (want off, flag or block)", v)
+	}
+
+	if s.allocations, err = parseAllocations(getenv("USER_ALLOCATIONS")); err != nil {
+		return nil, fmt.Errorf("invalid USER_ALLOCATIONS: %w", err)
+	}
+
+	if v := getenv("CLIENT_MAX_AGE"); v != "" {
+		if s.clientMaxAge, err = time.ParseDuration(v); err != nil || s.clientMaxAge < 0 {
+			return nil, fmt.Errorf("invalid CLIENT_MAX_AGE: %q", v)
+		}
+	}
+
+	if v := getenv("ORDER_CAPTURE"); v != "" {
+		if s.orderCapture, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid ORDER_CAPTURE: %q", v)
+		}
+	}
+
+	if s.hedgePolicy.Rules, err = hedge.ParseRules(getenv("HEDGE_RULES")); err != nil {
+		return nil, fmt.Errorf("invalid HEDGE_RULES: %w", err)
+	}
+	switch v := getenv("HEDGE_ACTION"); v {
+	case "":
+	case hedge.ActionPropose, hedge.ActionExecute:
+		s.hedgePolicy.Action = v
+	default:
+		return nil, fmt.Errorf("invalid HEDGE_ACTION: %q (want propose or execute)", v)
+	}
+
+	for key, limit := range map[string]*decimal.Decimal{
+		"CASH_MIN":     &s.cashRules.MinCash,
+		"CASH_MAX_PCT": &s.cashRules.MaxCashPct,
+	} {
+		if v := getenv(key); v != "" {
+			if *limit, err = decimal.NewFromString(v); err != nil || limit.IsNegative() {
+				return nil, fmt.Errorf("invalid %s: %q", key, v)
+			}
+		}
+	}
+	if s.cashRules.MaxCashPct.GreaterThan(decimal.NewFromInt(100)) {
+		return nil, fmt.Errorf("invalid CASH_MAX_PCT: %s (want at most 100)", s.cashRules.MaxCashPct)
+	}
+	if v := getenv("CASH_SWEEP_SYMBOL"); v != "" {
+		if err := cashsweep.ValidSymbol(v); err != nil {
+			return nil, fmt.Errorf("invalid CASH_SWEEP_SYMBOL: %w", err)
+		}
+		s.cashRules.Symbol = symbols.Normalize(v)
+	}
+	switch v := getenv("CASH_SWEEP_ACTION"); v {
+	case "":
+	case cashsweep.ActionPropose, cashsweep.ActionExecute:
+		s.cashAction = v
+	default:
+		return nil, fmt.Errorf("invalid CASH_SWEEP_ACTION: %q (want propose or execute)", v)
+	}
+
+	s.confirmSources = make(map[string]bool)
+	for _, source := range strings.Split(getenv("CONFIRM_ORDER_SOURCES"), ",") {
+		if source = strings.TrimSpace(source); source == "" {
+			continue
+		}
+		if !orders.ClientSource(source) {
+			return nil, fmt.Errorf("invalid CONFIRM_ORDER_SOURCES: %q (want manual, api or webhook)", source)
+		}
+		s.confirmSources[source] = true
+	}
+
+	for key, limit := range map[string]*decimal.Decimal{
+		"MAX_DELTA": &s.greekLimits.Delta,
+		"MAX_GAMMA": &s.greekLimits.Gamma,
+		"MAX_THETA": &s.greekLimits.Theta,
+		"MAX_VEGA":  &s.greekLimits.Vega,
+	} {
+		if v := getenv(key); v != "" {
+			if *limit, err = decimal.NewFromString(v); err != nil || limit.IsNegative() {
+				return nil, fmt.Errorf("invalid %s: %q", key, v)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// applySettings swaps reloadable settings into the running components.
+// Streams and their subscribers are left untouched.
+func (app *Application) applySettings(s *settings) {
+	app.riskSnapshots.SetDrawdownLimit(s.drawdownLimit)
+	app.riskSnapshots.SetLeverageLimit(s.leverageLimit)
+	app.gtcOrders.SetPolicy(s.gtcPolicy)
+	app.carry.SetRates(s.carryRates)
+	app.greeks.SetLimits(s.greekLimits)
+	app.marks.SetStaleAfter(s.staleAfter)
+	app.hedger.SetPolicy(s.hedgePolicy)
+	app.instruments.Set(s.instruments)
+
+	rules := []risk.Rule{risk.NewDeletedRule(app.db), risk.NewMemberRule(app.db, app.marks, app.marks)}
+	if s.clientMaxAge > 0 {
+		rules = append(rules, risk.NewClientClockRule(s.clientMaxAge, app.nonces))
+	}
+	if app.tenants != nil {
+		rules = append(rules, risk.NewChapterRule(app.tenants, app.marks, app.marks))
+	}
+	if app.halts != nil {
+		rules = append(rules, risk.NewHaltRule(app.halts))
+	}
+	if s.earningsRule != "off" {
+		rules = append(rules, risk.NewEarningsRule(app.db, s.earningsWindow, s.earningsRule))
+	}
+	if s.leverageLimit.IsPositive() {
+		rules = append(rules, risk.NewLeverageRule(app.riskSnapshots, app.marks, app.brokers.ownAccount))
+	}
+	if s.overnight.Enabled() {
+		rules = append(rules, risk.NewOvernightRule(app.riskSnapshots, app.marks, s.overnight, app.overnightLead, app.brokers.ownAccount))
+	}
+	if s.concentration.Enabled() {
+		rules = append(rules, risk.NewConcentrationRule(s.concentration, s.concentrationRule, app.marks, app.marks,
+			app.capital, app.riskSnapshots, app.brokers.ownAccount))
+	}
+	if s.greekLimits.Enabled() {
+		rules = append(rules, risk.NewGreekRule(app.greeks))
+	}
+	if s.staleRule != "off" && s.staleAfter > 0 {
+		rules = append(rules, risk.NewStalePriceRule(app.marks, s.staleRule))
+	}
+	for _, def := range s.customRules {
+		rules = append(rules, risk.NewCustomRule(def, risk.CustomSources{
+			Snapshots: app.riskSnapshots,
+			Prices:    app.marks,
+			Volumes:   app.volumes,
+			Capital:   app.capital,
+			Hits:      app.db,
+		}))
+	}
+	app.preTrade.Replace(rules...)
+
+	notifiers := notify.Fanout{notify.Log{}}
+	if s.webhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhook(s.webhookURL))
+	}
+	if s.discordURL != "" {
+		notifiers = append(notifiers, notify.NewDiscord(s.discordURL))
+	}
+	var notifier notify.Notifier = notify.Log{}
+	if len(notifiers) > 1 {
+		notifier = notifiers
+	}
+	app.notifier.Set(notifier)
+	app.exposureAlerts.SetThresholds(s.alerts, s.alertRepeat)
+
+	app.universesMu.Lock()
+	app.universes = s.universes
+	app.universesMu.Unlock()
+
+	app.allocationsMu.Lock()
+	app.allocations = s.allocations
+	app.allocationsMu.Unlock()
+
+	app.overnightMu.Lock()
+	app.overnightLimits, app.overnightAction = s.overnight, s.overnightAction
+	app.overnightMu.Unlock()
+
+	app.cashMu.Lock()
+	app.cashRules, app.cashAction = s.cashRules, s.cashAction
+	app.cashMu.Unlock()
+
+	app.concentrationMu.Lock()
+	app.concentration = s.concentration
+	app.concentrationMu.Unlock()
+
+	app.customRulesMu.Lock()
+	app.customRules = s.customRules
+	app.customRulesMu.Unlock()
+
+	app.confirmSourcesMu.Lock()
+	app.confirmSources = s.confirmSources
+	app.confirmSourcesMu.Unlock()
+
+	app.captures.SetEnabled(s.orderCapture)
+}
+
+// universe returns the symbols of a configured screen universe
+func (app *Application) universe(name string) ([]string, bool) {
+	app.universesMu.RLock()
+	defer app.universesMu.RUnlock()
+	symbols, ok := app.universes[name]
+	return symbols, ok
+}
+
+// confirmSource reports whether orders from source must be confirmed as
+// tickets instead of placed with POST /order
+func (app *Application) confirmSource(source string) bool {
+	app.confirmSourcesMu.RLock()
+	defer app.confirmSourcesMu.RUnlock()
+	return app.confirmSources[source]
+}
+
+// reloadResult reports what a reload changed
+type reloadResult struct {
+	Changed         []string `json:"changed"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// readConfig reads CONFIG_FILE, if set, returning its values and a getenv
+// that looks settings up in them before the environment
+func (app *Application) readConfig() (map[string]string, func(string) string, error) {
+	if app.configFile == nil {
+		return nil, os.Getenv, nil
+	}
+	values, err := app.configFile.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, app.configFile.Getenv(values), nil
+}
+
+// reload re-reads CONFIG_FILE, if set, SCREEN_UNIVERSES_FILE,
+// INSTRUMENTS_FILE and RISK_RULES_FILE and applies the reloadable
+// settings. Nothing is applied if any setting is invalid.
+func (app *Application) reload() (*reloadResult, error) {
+	values, getenv, err := app.readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := loadSettings(getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &reloadResult{Changed: []string{}, RestartRequired: []string{}}
+	if app.configFile != nil {
+		for _, key := range app.configFile.Apply(values) {
+			if slices.Contains(reloadableKeys, key) {
+				result.Changed = append(result.Changed, key)
+			} else {
+				result.RestartRequired = append(result.RestartRequired, key)
+			}
+		}
+	}
+	app.applySettings(s)
+
+	log.Printf("Reloaded configuration (changed: %v)", result.Changed)
+	if len(result.RestartRequired) > 0 {
+		log.Printf("Warning: restart required to apply %v", result.RestartRequired)
+	}
+	return result, nil
+}
+
+// handleReload serves POST /admin/reload on the admin port
+func (app *Application) handleReload(w http.ResponseWriter, r *http.Request) {
+	result, err := app.reload()
+	if err != nil {
+		log.Printf("Failed to reload configuration: %v", err)
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/pnl"
+	"desk/internal/reports"
+	"desk/internal/tenants"
+)
+
+type depositRequest struct {
+	Amount     string `json:"amount"`
+	StrategyID int64  `json:"strategy_id"`
+	Date       string `json:"date"`
+}
+
+// reportRange parses the from and to (YYYY-MM-DD, inclusive; default the
+// last 30 days) and optional strategy_id query parameters of a report,
+// writing an error response if they are invalid
+func reportRange(w http.ResponseWriter, r *http.Request) (from, to string, strategyID *int64, ok bool) {
+	query := r.URL.Query()
+
+	now := time.Now()
+	from = query.Get("from")
+	if from == "" {
+		from = pnl.TradingDay(now.AddDate(0, 0, -30))
+	}
+	to = query.Get("to")
+	if to == "" {
+		to = pnl.TradingDay(now)
+	}
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			http.Error(w, "Bad request: dates must be YYYY-MM-DD", http.StatusBadRequest)
+			return "", "", nil, false
+		}
+	}
+
+	if v := query.Get("strategy_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad request: invalid strategy_id", http.StatusBadRequest)
+			return "", "", nil, false
+		}
+		strategyID = &id
+	}
+	return from, to, strategyID, true
+}
+
+// handleDailyReport returns the caller's daily aggregates. Query parameters:
+// from and to (YYYY-MM-DD, inclusive; default the last 30 days) and an
+// optional strategy_id.
+func (app *Application) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+	from, to, strategyID, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+
+	aggs, err := app.db.GetDailyAggregates(requestUserID(r), from, to, strategyID)
+	if err != nil {
+		log.Printf("Failed to load daily aggregates: %v", err)
+		http.Error(w, "Failed to load report", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, aggs)
+}
+
+// handleCashReport returns the caller's daily cash ledger, with the same
+// query parameters as the daily report
+func (app *Application) handleCashReport(w http.ResponseWriter, r *http.Request) {
+	from, to, strategyID, ok := reportRange(w, r)
+	if !ok {
+		return
+	}
+
+	days, err := app.db.GetDailyCash(requestUserID(r), from, to, strategyID)
+	if err != nil {
+		log.Printf("Failed to load daily cash: %v", err)
+		http.Error(w, "Failed to load report", http.StatusInternalServerError)
+		return
+	}
+	if days == nil {
+		days = []database.DailyCash{}
+	}
+
+	writeJSON(w, http.StatusOK, days)
+}
+
+// handleDeposit records cash deposited into, or with a negative amount
+// withdrawn from, one of the caller's books. Margin interest accrues when a
+// book's balance is negative.
+func (app *Application) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	var req depositRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	amount, err := decimal.NewFromString(req.Amount)
+	if err != nil || amount.IsZero() {
+		http.Error(w, "Bad request: amount must be a non-zero number", http.StatusBadRequest)
+		return
+	}
+	if req.Date == "" {
+		req.Date = pnl.TradingDay(time.Now())
+	} else if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		http.Error(w, "Bad request: date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+	if req.StrategyID != 0 {
+		strategy, err := app.db.GetStrategyByID(req.StrategyID)
+		if err != nil {
+			http.Error(w, "Bad request: unknown strategy", http.StatusBadRequest)
+			return
+		}
+		if strategy.UserID != userID {
+			http.Error(w, "Forbidden: strategy belongs to another user", http.StatusForbidden)
+			return
+		}
+	}
+
+	book := database.CashBook{UserID: userID, StrategyID: req.StrategyID}
+	if err := app.db.RecordDeposit(req.Date, book, amount); err != nil {
+		log.Printf("Failed to record deposit: %v", err)
+		http.Error(w, "Failed to record deposit", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// weeklyDate returns the date query parameter naming a report's week,
+// defaulting to today
+func weeklyDate(r *http.Request) string {
+	if date := r.URL.Query().Get("date"); date != "" {
+		return date
+	}
+	return pnl.TradingDay(time.Now())
+}
+
+// writeWeekly writes a weekly report as JSON, or as HTML with
+// ?format=html or an Accept: text/html header
+func writeWeekly(w http.ResponseWriter, r *http.Request, report *reports.Weekly) {
+	if r.URL.Query().Get("format") != "html" && !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	page, err := reports.RenderHTML(report)
+	if err != nil {
+		log.Printf("Failed to render weekly report: %v", err)
+		http.Error(w, "Failed to render report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(page))
+}
+
+// handleWeeklyReport reports on the caller's books for the week ?date= falls
+// in (default this week)
+func (app *Application) handleWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	date := weeklyDate(r)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "Bad request: date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	report, err := app.weeklyReports.User(requestUserID(r), date)
+	if err != nil {
+		log.Printf("Failed to build weekly report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	writeWeekly(w, r, report)
+}
+
+// handleClubWeeklyReport reports on every user's books combined, or with
+// chapters, every user's in the caller's chapter
+func (app *Application) handleClubWeeklyReport(w http.ResponseWriter, r *http.Request) {
+	date := weeklyDate(r)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "Bad request: date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	report, err := app.weeklyReports.Club(tenants.FromContext(r.Context()), date)
+	if err != nil {
+		log.Printf("Failed to build club weekly report: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	writeWeekly(w, r, report)
+}
+
+// handleSendWeeklyReports sends the weekly reports for the week ?date= falls
+// in now, rather than waiting for Friday's close
+func (app *Application) handleSendWeeklyReports(w http.ResponseWriter, r *http.Request) {
+	date := weeklyDate(r)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "Bad request: date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.weeklyReports.Distribute(r.Context(), date); err != nil {
+		log.Printf("Failed to send weekly reports: %v", err)
+		http.Error(w, "Failed to send reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// explainDate returns the date query parameter of a P&L explain, default
+// today, and the positions to close it with: live marks when it is today
+// and persisted marks otherwise
+func (app *Application) explainDate(w http.ResponseWriter, r *http.Request, userID string) (string, []database.PositionMark, bool) {
+	today := pnl.TradingDay(time.Now())
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = today
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		http.Error(w, "Bad request: date must be YYYY-MM-DD", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if date > today {
+		http.Error(w, "Bad request: date is in the future", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if date != today {
+		return date, nil, true
+	}
+	live := app.marks.Positions(userID)
+	if live == nil {
+		live = []database.PositionMark{}
+	}
+	return date, live, true
+}
+
+// handleExplainReport attributes a day's P&L in the caller's books (?date=,
+// default today; optional strategy_id) to trading, holding, dividends, fees
+// and carry
+func (app *Application) handleExplainReport(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	date, live, ok := app.explainDate(w, r, userID)
+	if !ok {
+		return
+	}
+	var strategyID *int64
+	if v := r.URL.Query().Get("strategy_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Bad request: invalid strategy_id", http.StatusBadRequest)
+			return
+		}
+		strategyID = &id
+	}
+
+	report, err := app.weeklyReports.ExplainUser(userID, date, strategyID, live)
+	if err != nil {
+		log.Printf("Failed to explain P&L: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleClubExplainReport attributes a day's P&L in every user's books, or
+// with chapters, every user's in the caller's chapter
+func (app *Application) handleClubExplainReport(w http.ResponseWriter, r *http.Request) {
+	date, live, ok := app.explainDate(w, r, "")
+	if !ok {
+		return
+	}
+
+	report, err := app.weeklyReports.ExplainClub(tenants.FromContext(r.Context()), date, live)
+	if err != nil {
+		log.Printf("Failed to explain club P&L: %v", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
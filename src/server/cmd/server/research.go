@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/research"
+)
+
+// errBadExportRange is returned for a malformed export date
+var errBadExportRange = errors.New("bad export range")
+
+// researchExport anonymizes the filled trades of sessions from to to with
+// the policy in RESEARCH_EXPORT_POLICY, writing the dataset to w
+func researchExport(db *database.DB, w io.Writer, from, to string) (int, error) {
+	policy, err := research.LoadPolicy(os.Getenv("RESEARCH_EXPORT_POLICY"))
+	if err != nil {
+		return 0, err
+	}
+	anonymizer, err := research.NewAnonymizer(policy, os.Getenv("RESEARCH_EXPORT_KEY"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return 0, fmt.Errorf("%w: invalid date %q", errBadExportRange, d)
+		}
+	}
+	if to == "" {
+		to = market.SessionDate(time.Now())
+	}
+
+	trades, err := db.GetFilledTrades()
+	if err != nil {
+		return 0, err
+	}
+	return anonymizer.Export(w, trades, from, to)
+}
+
+// runExportResearch writes an anonymized trade dataset without starting the
+// server: export-research [-from DATE] [-to DATE] [-o FILE]. It returns the
+// process exit code.
+func runExportResearch(args []string) int {
+	flags := flag.NewFlagSet("export-research", flag.ContinueOnError)
+	from := flags.String("from", "", "first session date, YYYY-MM-DD (default: the first trade)")
+	to := flags.String("to", "", "last session date, YYYY-MM-DD (default: today)")
+	path := flags.String("o", "", "file to write the CSV dataset to (default: stdout)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Keep stdout for the dataset
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./trading_desk.db"
+	}
+	db, err := database.NewDB(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	out := io.Writer(os.Stdout)
+	if *path != "" {
+		f, err := os.Create(*path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *path, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	n, err := researchExport(db, out, *from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export trades: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d trades\n", n)
+	return 0
+}
+
+// exportResearch runs a research export for the request's from and to
+// query parameters into a buffer, so a refused export returns an error
+// rather than a partial CSV. It writes the error response if it fails.
+func (app *Application) exportResearch(w http.ResponseWriter, r *http.Request) (*bytes.Buffer, int, bool) {
+	query := r.URL.Query()
+
+	var buf bytes.Buffer
+	n, err := researchExport(app.db, &buf, query.Get("from"), query.Get("to"))
+	if errors.Is(err, errBadExportRange) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return nil, 0, false
+	}
+	if errors.Is(err, research.ErrTooFewUsers) {
+		http.Error(w, "Export refused: "+err.Error(), http.StatusUnprocessableEntity)
+		return nil, 0, false
+	}
+	if err != nil {
+		log.Printf("Failed to export research trades: %v", err)
+		http.Error(w, "Failed to export trades: "+err.Error(), http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return &buf, n, true
+}
+
+// handleResearchExport serves an anonymized trade dataset as CSV on the admin
+// port. Query parameters: from and to (session dates, YYYY-MM-DD).
+func (app *Application) handleResearchExport(w http.ResponseWriter, r *http.Request) {
+	buf, n, ok := app.exportResearch(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Exported %d anonymized trades for research", n)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="trades.csv"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+type storedExport struct {
+	Key    string `json:"key"`
+	Trades int    `json:"trades"`
+}
+
+// handleStoreResearchExport writes an anonymized trade dataset to the object
+// store under exports/research/ rather than returning it
+func (app *Application) handleStoreResearchExport(w http.ResponseWriter, r *http.Request) {
+	buf, n, ok := app.exportResearch(w, r)
+	if !ok {
+		return
+	}
+
+	key := "exports/research/trades-" + time.Now().UTC().Format("20060102T150405Z") + ".csv"
+	if err := app.store.Put(r.Context(), key, buf.Bytes()); err != nil {
+		log.Printf("Failed to store research export: %v", err)
+		http.Error(w, "Failed to store export: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Stored %d anonymized trades for research at %s", n, key)
+	writeJSON(w, http.StatusCreated, storedExport{Key: key, Trades: n})
+}
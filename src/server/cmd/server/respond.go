@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"desk/internal/orders"
+	"desk/internal/tenants"
+)
+
+// requestUserID extracts the user ID from the request header (for now, use a
+// default or header value)
+func requestUserID(r *http.Request) string {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		userID = "default_user" // Default for testing
+	}
+	return qualifyUserID(tenants.FromContext(r.Context()), userID)
+}
+
+// requestStrategyID parses the optional X-Strategy-ID header attributing an
+// order to a strategy
+func requestStrategyID(r *http.Request) (*int64, error) {
+	header := r.Header.Get("X-Strategy-ID")
+	if header == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// requestOrderSource parses the optional X-Order-Source header naming the
+// channel an order came in through: manual, api or webhook. Orders without
+// it are api orders when a strategy places them, and manual otherwise.
+func requestOrderSource(r *http.Request, strategyID *int64) (string, error) {
+	source := r.Header.Get("X-Order-Source")
+	switch {
+	case source == "" && strategyID != nil:
+		return orders.SourceAPI, nil
+	case source == "":
+		return orders.SourceManual, nil
+	case !orders.ClientSource(source):
+		return "", fmt.Errorf("invalid X-Order-Source %q: want manual, api or webhook", source)
+	}
+	return source, nil
+}
+
+// maxNonceLength caps the X-Client-Nonce header
+const maxNonceLength = 128
+
+// requestClientClock parses the optional X-Client-Timestamp header, the time
+// the client generated an order as Unix milliseconds or RFC 3339, and the
+// X-Client-Nonce header identifying the order
+func requestClientClock(r *http.Request) (*time.Time, string, error) {
+	nonce := r.Header.Get("X-Client-Nonce")
+	if len(nonce) > maxNonceLength {
+		return nil, "", fmt.Errorf("X-Client-Nonce is longer than %d characters", maxNonceLength)
+	}
+
+	header := r.Header.Get("X-Client-Timestamp")
+	if header == "" {
+		return nil, nonce, nil
+	}
+	if ms, err := strconv.ParseInt(header, 10, 64); err == nil {
+		t := time.UnixMilli(ms).UTC()
+		return &t, nonce, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, header)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid X-Client-Timestamp: want Unix milliseconds or RFC 3339")
+	}
+	t = t.UTC()
+	return &t, nonce, nil
+}
+
+// pathID parses a numeric path parameter such as {id}
+func pathID(r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// querySymbols parses the optional comma-separated symbols query parameter
+func querySymbols(r *http.Request) []string {
+	var symbols []string
+	for _, s := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" {
+			symbols = append(symbols, s)
+		}
+	}
+	return symbols
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// maxPooledBuffer is the largest buffer returned to a pool; a rare large
+// request shouldn't pin its memory for good
+const maxPooledBuffer = 64 << 10
+
+// bodyBuffers and protoBuffers recycle request bodies and encoded
+// responses on the order path, which otherwise allocates both per order
+var (
+	bodyBuffers  = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	protoBuffers = sync.Pool{New: func() any { return new([]byte) }}
+)
+
+// readBody reads the request body into a pooled buffer. The body is only
+// valid until release is called, so nothing may keep it past the request.
+func readBody(r *http.Request) (body []byte, release func(), err error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	release = func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bodyBuffers.Put(buf)
+		}
+	}
+	if _, err := io.Copy(buf, r.Body); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return buf.Bytes(), release, nil
+}
+
+// unmarshalProto decodes a request body as binary protobuf, or as JSON when
+// it is sent with Content-Type: application/json. Neither keeps a reference
+// to body.
+func unmarshalProto(r *http.Request, body []byte, msg proto.Message) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return protojson.Unmarshal(body, msg)
+	}
+	return proto.Unmarshal(body, msg)
+}
+
+// writeProto encodes msg as binary protobuf, or as JSON when the client asks
+// for it with an Accept: application/json header
+func writeProto(w http.ResponseWriter, r *http.Request, status int, msg proto.Message) {
+	buf := protoBuffers.Get().(*[]byte)
+	defer func() {
+		if cap(*buf) <= maxPooledBuffer {
+			protoBuffers.Put(buf)
+		}
+	}()
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.MarshalAppend((*buf)[:0], msg)
+		if err != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+			return
+		}
+		*buf = data
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(data)
+		return
+	}
+
+	data, err := proto.MarshalOptions{}.MarshalAppend((*buf)[:0], msg)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	*buf = data
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/hedge"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/risk"
+	"desk/internal/symbols"
+)
+
+// maxScenarioShocks caps how many shocks one scenario applies
+const maxScenarioShocks = 20
+
+// scenarioShock is one shock of a scenario request. It applies to the listed
+// symbols, a named universe or a watchlist, or to every position if none is
+// given.
+type scenarioShock struct {
+	Name      string          `json:"name"`
+	Symbols   []string        `json:"symbols"`
+	Universe  string          `json:"universe"`
+	Watchlist int64           `json:"watchlist"`
+	PricePct  decimal.Decimal `json:"price_pct"`
+}
+
+type scenarioRequest struct {
+	Shocks []scenarioShock `json:"shocks"`
+}
+
+func (app *Application) handleRiskSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap := app.riskSnapshots.Latest()
+	if snap == nil {
+		http.Error(w, "No risk snapshot available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snap)
+}
+
+// leverageResponse is the account's leverage now, the limit in force and
+// its recorded history
+type leverageResponse struct {
+	Leverage decimal.Decimal          `json:"leverage"`
+	Limit    decimal.Decimal          `json:"limit"`
+	Breached bool                     `json:"breached"`
+	History  []database.LeveragePoint `json:"history"`
+}
+
+// handleLeverage returns the account's leverage and its history between
+// from and to, for charting
+func (app *Application) handleLeverage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			parsed, err := market.ParseTime(v)
+			if err != nil {
+				http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	history, err := app.db.GetLeverageHistory(from, to)
+	if err != nil {
+		log.Printf("Failed to load leverage history: %v", err)
+		http.Error(w, "Failed to load leverage history", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []database.LeveragePoint{}
+	}
+
+	resp := leverageResponse{
+		Limit:   app.riskSnapshots.LeverageLimit(),
+		History: history,
+	}
+	if snap := app.riskSnapshots.Latest(); snap != nil {
+		resp.Leverage = snap.Leverage
+		resp.Breached = snap.LeverageBreached
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGreeks returns the latest per-position and portfolio greeks
+func (app *Application) handleGreeks(w http.ResponseWriter, r *http.Request) {
+	report := app.greeks.Latest()
+	if report == nil {
+		http.Error(w, "Greeks have not been computed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleRiskStream streams risk snapshots to the dashboard as server-sent
+// events, starting with the latest snapshot if one exists
+func (app *Application) handleRiskStream(w http.ResponseWriter, r *http.Request) {
+	snapshots, unsubscribe := app.riskSnapshots.Subscribe()
+	defer unsubscribe()
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	if snap := app.riskSnapshots.Latest(); snap != nil {
+		if err := writeSSE(w, flusher, "risk", snap); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case snap, ok := <-snapshots:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, flusher, "risk", snap); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleScenario estimates the P&L of hypothetical price shocks (e.g. the
+// tech universe -5%) on the desk's current positions
+func (app *Application) handleScenario(w http.ResponseWriter, r *http.Request) {
+	var req scenarioRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Shocks) == 0 {
+		http.Error(w, "Bad request: at least one shock is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Shocks) > maxScenarioShocks {
+		http.Error(w, fmt.Sprintf("Bad request: at most %d shocks", maxScenarioShocks), http.StatusBadRequest)
+		return
+	}
+
+	shocks := make([]risk.Shock, len(req.Shocks))
+	for i, sh := range req.Shocks {
+		shock, err := app.resolveShock(r, sh)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Bad request: shock %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		shocks[i] = shock
+	}
+
+	account, err := app.brokers.host.Account()
+	if err != nil {
+		log.Printf("Failed to get account for scenario: %v", err)
+		http.Error(w, "Failed to load account", http.StatusBadGateway)
+		return
+	}
+	positions, err := app.brokers.host.Positions()
+	if err != nil {
+		log.Printf("Failed to get positions for scenario: %v", err)
+		http.Error(w, "Failed to load positions", http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, risk.RunScenario(account.Equity, positions, shocks))
+}
+
+// resolveShock turns a requested shock into the symbols it moves
+func (app *Application) resolveShock(r *http.Request, sh scenarioShock) (risk.Shock, error) {
+	if sh.PricePct.LessThanOrEqual(decimal.NewFromInt(-100)) {
+		return risk.Shock{}, fmt.Errorf("price_pct must be greater than -100")
+	}
+	targets := 0
+	for _, set := range []bool{len(sh.Symbols) > 0, sh.Universe != "", sh.Watchlist != 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return risk.Shock{}, fmt.Errorf("give only one of symbols, universe or watchlist")
+	}
+
+	shock := risk.Shock{Name: sh.Name, PricePct: sh.PricePct}
+	target := "all"
+	switch {
+	case len(sh.Symbols) > 0:
+		shock.Symbols = app.aliases.ResolveAll(sh.Symbols)
+		target = "symbols"
+	case sh.Universe != "":
+		universe, ok := app.universe(sh.Universe)
+		if !ok {
+			return risk.Shock{}, fmt.Errorf("unknown universe %s", sh.Universe)
+		}
+		shock.Symbols = app.aliases.ResolveAll(universe)
+		target = sh.Universe
+	case sh.Watchlist != 0:
+		wl, err := app.db.GetWatchlist(sh.Watchlist)
+		if err != nil || !wl.VisibleTo(requestUserID(r)) {
+			return risk.Shock{}, fmt.Errorf("watchlist %d not found", sh.Watchlist)
+		}
+		shock.Symbols = app.aliases.ResolveAll(wl.Symbols)
+		target = wl.Name
+	}
+	if shock.Name == "" {
+		shock.Name = fmt.Sprintf("%s %s%%", target, sh.PricePct)
+	}
+	return shock, nil
+}
+
+// exposureAlertsResponse is the alert thresholds in force and the breaches
+// as of the last mark
+type exposureAlertsResponse struct {
+	Thresholds notify.Thresholds `json:"thresholds"`
+	Repeat     string            `json:"repeat"`
+	Active     []notify.Alert    `json:"active"`
+}
+
+// handleExposureAlerts returns the exposure alert thresholds and the
+// breaches currently open
+func (app *Application) handleExposureAlerts(w http.ResponseWriter, r *http.Request) {
+	thresholds, repeat := app.exposureAlerts.Thresholds()
+	writeJSON(w, http.StatusOK, exposureAlertsResponse{
+		Thresholds: thresholds,
+		Repeat:     repeat.String(),
+		Active:     app.exposureAlerts.Active(),
+	})
+}
+
+// handleHedges returns the latest evaluation of the hedge rules
+func (app *Application) handleHedges(w http.ResponseWriter, r *http.Request) {
+	report := app.hedger.Latest()
+	if report == nil {
+		http.Error(w, "Hedge rules have not been evaluated yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleExecuteHedge serves POST /admin/hedges/{benchmark} on the admin
+// port: it evaluates the benchmark's rule now and places its hedge if the
+// band is breached, whatever HEDGE_ACTION says
+func (app *Application) handleExecuteHedge(w http.ResponseWriter, r *http.Request) {
+	result, err := app.hedger.Execute(r.Context(), symbols.Normalize(r.PathValue("benchmark")))
+	if errors.Is(err, hedge.ErrNoRule) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to evaluate hedge rule: %v", err)
+		http.Error(w, "Failed to evaluate hedge rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"desk/internal/market"
+	"desk/internal/risk"
+)
+
+// customRule is a custom pre-trade rule and how often it has hit today
+type customRule struct {
+	risk.CustomRuleDef
+	Vars      []string `json:"vars"`
+	HitsToday int      `json:"hits_today"`
+}
+
+// riskRulesResponse is the custom rules in force and the variables their
+// expressions may use, with each variable's type
+type riskRulesResponse struct {
+	Rules     []customRule      `json:"rules"`
+	Variables map[string]string `json:"variables"`
+}
+
+// handleRiskRules returns the custom rules loaded from RISK_RULES_FILE
+func (app *Application) handleRiskRules(w http.ResponseWriter, r *http.Request) {
+	app.customRulesMu.RLock()
+	defs := app.customRules
+	app.customRulesMu.RUnlock()
+
+	// Today starts at midnight exchange time, so pre-market orders count
+	now := market.ExchangeTime(time.Now())
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	hits, err := app.db.GetRuleHits("", midnight, now)
+	if err != nil {
+		log.Printf("Failed to load rule hits: %v", err)
+		http.Error(w, "Failed to load rule hits", http.StatusInternalServerError)
+		return
+	}
+	counts := make(map[string]int)
+	for _, h := range hits {
+		counts[h.Rule]++
+	}
+
+	resp := riskRulesResponse{
+		Rules:     make([]customRule, len(defs)),
+		Variables: make(map[string]string, len(risk.CustomRuleVars)),
+	}
+	for i, def := range defs {
+		resp.Rules[i] = customRule{CustomRuleDef: def, Vars: def.Vars(), HitsToday: counts[def.Name]}
+	}
+	for name, kind := range risk.CustomRuleVars {
+		resp.Variables[name] = kind.String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRiskRuleHits returns custom rule hits between from and to, newest
+// first, optionally of one rule
+func (app *Application) handleRiskRuleHits(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := time.Now()
+	from := to.Add(-7 * 24 * time.Hour)
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			parsed, err := market.ParseTime(v)
+			if err != nil {
+				http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	hits, err := app.db.GetRuleHits(query.Get("rule"), from, to)
+	if err != nil {
+		log.Printf("Failed to load rule hits: %v", err)
+		http.Error(w, "Failed to load rule hits", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, hits)
+}
@@ -0,0 +1,900 @@
+package main
+
+import (
+	"net/http"
+
+	"desk/internal/backtest"
+	"desk/internal/confirm"
+	"desk/internal/database"
+	"desk/internal/halts"
+	"desk/internal/hedge"
+	"desk/internal/instruments"
+	"desk/internal/openapi"
+	orderprotos "desk/internal/protos/orders"
+	positionprotos "desk/internal/protos/positions"
+	"desk/internal/reports"
+	"desk/internal/risk"
+	"desk/internal/sweeper"
+	"desk/internal/taxlots"
+	"desk/internal/tca"
+)
+
+// route is one endpoint of the API. The table of routes registers the
+// handlers, lists them at startup and generates the OpenAPI document.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	op      openapi.Operation
+}
+
+var (
+	userHeader       = openapi.Param{Name: "X-User-ID", Description: "Caller's user ID (default default_user)"}
+	strategyHeader   = openapi.Param{Name: "X-Strategy-ID", Type: "integer", Description: "Strategy the order is attributed to"}
+	clientTimeHeader = openapi.Param{Name: "X-Client-Timestamp", Description: "When the client generated the order, as Unix milliseconds or RFC 3339; checked against CLIENT_MAX_AGE"}
+	nonceHeader      = openapi.Param{Name: "X-Client-Nonce", Description: "Unique ID of the order; with X-Client-Timestamp, a nonce is accepted once"}
+	sourceHeader     = openapi.Param{Name: "X-Order-Source", Description: "Channel the order came in through: manual, api or webhook (default api with X-Strategy-ID, manual without)"}
+
+	symbolsParam   = openapi.Param{Name: "symbols", Description: "Comma-separated symbols"}
+	watchlistParam = openapi.Param{Name: "watchlist", Type: "integer", Description: "Watchlist ID, instead of symbols"}
+)
+
+func (app *Application) routes() []route {
+	return []route{
+		{"POST /order", app.handleOrder, openapi.Operation{
+			Summary: "Place a trading order (protobuf)",
+			Description: "Send and accept application/json to use the JSON mapping of the messages instead of binary protobuf. Rejected orders are also answered with an OrderResponse, whose status is error. " +
+				"Orders in a halted symbol are rejected with 403 and an X-Reject-Code header of HALTED, or LULD_PAUSE for a limit up-limit down pause. " +
+				"With NETTING_WINDOW set, market DAY equity orders from strategies are answered 202 Accepted and held for netting, with a Location of the netting signal. " +
+				"An empty order_type or time_in_force is filled from the caller's preferences (GET /preferences). " +
+				"Manual orders (X-Order-Source manual, the default without X-Strategy-ID) from a caller whose preferences set confirm_orders are rejected with 428 and an X-Reject-Code of CONFIRMATION_REQUIRED; they go through POST /orders/tickets. " +
+				"So are orders from any source listed in CONFIRM_ORDER_SOURCES. " +
+				"With CLIENT_MAX_AGE set, orders whose X-Client-Timestamp is too old or too far ahead are rejected with 403 and an X-Reject-Code of STALE_ORDER or CLIENT_CLOCK_AHEAD, and a reused X-Client-Nonce with REUSED_NONCE.",
+			Headers:   []openapi.Param{userHeader, strategyHeader, sourceHeader, clientTimeHeader, nonceHeader},
+			Request:   &orderprotos.OrderRequest{},
+			Response:  &orderprotos.OrderResponse{},
+			Status:    http.StatusCreated,
+			ProtoJSON: true,
+		}},
+		{"GET /trades", app.handleListTrades, openapi.Operation{
+			Summary: "Page through the trade blotter (protobuf, JSON or Arrow)",
+			Description: "Send Accept: application/vnd.apache.arrow.stream or format=arrow to get the page as an Arrow IPC stream, with pages of up to 10000 trades " +
+				"and the next cursor in the X-Next-Cursor header.",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "limit", Type: "integer", Description: "Page size (default 50, max 500, or 10000 for Arrow)"},
+				{Name: "cursor", Description: "next_cursor from the previous page"},
+				{Name: "include_total", Type: "boolean", Description: "Also count all of the caller's trades"},
+				{Name: "format", Description: "arrow for an Arrow IPC stream"},
+			},
+			Response:  &orderprotos.TradePage{},
+			ProtoJSON: true,
+		}},
+		{"GET /trades/{id}/capture", app.handleGetOrderCapture, openapi.Operation{
+			Summary: "The captured request and broker response of a failed order",
+			Description: "Recorded for orders logged as rejected trades while ORDER_CAPTURE is on, and kept for ORDER_CAPTURE_TTL. " +
+				"Credentials are redacted from headers and bodies, and payloads over ORDER_CAPTURE_MAX_BYTES are cut short (truncated).",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.OrderCapture{},
+		}},
+		{"POST /trades/{id}/disputes", app.handleOpenDispute, openapi.Operation{
+			Summary: "Dispute one of the caller's fills as erroneous",
+			Description: "The trade is never changed. An admin upholds the dispute, taking the trade out of performance stats with an adjustment for the P&L it caused, or rejects it. " +
+				"Answers 409 if the trade already has an open or upheld dispute.",
+			Headers:  []openapi.Param{userHeader},
+			Request:  disputeRequest{},
+			Response: database.Dispute{},
+			Status:   http.StatusCreated,
+		}},
+		{"GET /trades/disputes", app.handleListDisputes, openapi.Operation{
+			Summary:  "List the caller's trade disputes",
+			Headers:  []openapi.Param{userHeader},
+			Query:    []openapi.Param{{Name: "status", Description: "open, upheld or rejected (default all)"}},
+			Response: []database.Dispute{},
+		}},
+		{"POST /journal", app.handleCreateJournalEntry, openapi.Operation{
+			Summary: "Write a trade journal entry",
+			Description: "thesis, outcome and lessons are markdown. session_date defaults to the session of the earliest linked trade, or today. " +
+				"Linked trades show the entry's ID in the blotter's journal_entry_ids.",
+			Headers:  []openapi.Param{userHeader},
+			Request:  journalEntryRequest{},
+			Response: database.JournalEntry{},
+			Status:   http.StatusCreated,
+		}},
+		{"GET /journal", app.handleListJournal, openapi.Operation{
+			Summary:     "List and search the caller's journal",
+			Description: "Send Accept: text/markdown or format=markdown to get the entries as one markdown document.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "q", Description: "Only entries whose title, thesis, outcome or lessons contain this text"},
+				{Name: "trade_id", Type: "integer", Description: "Only entries linked to this trade"},
+				{Name: "from", Description: "First session date, YYYY-MM-DD"},
+				{Name: "to", Description: "Last session date, YYYY-MM-DD"},
+				{Name: "limit", Type: "integer", Description: "Maximum entries (default 50, max 500)"},
+				{Name: "format", Description: "markdown for a markdown document"},
+			},
+			Response: []database.JournalEntry{},
+		}},
+		{"GET /journal/{id}", app.handleGetJournalEntry, openapi.Operation{
+			Summary: "Read a journal entry (JSON or markdown)",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "format", Description: "markdown for a markdown document"},
+			},
+			Response: database.JournalEntry{},
+		}},
+		{"PATCH /journal/{id}", app.handleUpdateJournalEntry, openapi.Operation{
+			Summary:     "Edit a journal entry",
+			Description: "Fields left out are unchanged; trade_ids replaces the linked trades.",
+			Headers:     []openapi.Param{userHeader},
+			Request:     updateJournalEntryRequest{},
+			Response:    database.JournalEntry{},
+		}},
+		{"DELETE /journal/{id}", app.handleDeleteJournalEntry, openapi.Operation{
+			Summary: "Delete a journal entry, keeping its trades",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"GET /calendar/earnings", app.handleEarningsCalendar, openapi.Operation{
+			Summary: "Upcoming earnings reports",
+			Query: []openapi.Param{
+				{Name: "from", Description: "First exchange date, YYYY-MM-DD (default today)"},
+				{Name: "to", Description: "Last exchange date, YYYY-MM-DD (default 7 days out)"},
+				symbolsParam, watchlistParam,
+			},
+			Response: []database.EarningsEvent{},
+		}},
+		{"GET /news", app.handleNews, openapi.Operation{
+			Summary: "Recent news headlines",
+			Query: []openapi.Param{
+				symbolsParam, watchlistParam,
+				{Name: "before", Description: "Only articles created before this RFC 3339 time"},
+				{Name: "limit", Type: "integer", Description: "Maximum articles (default 50, max 500)"},
+			},
+			Response: []database.NewsArticle{},
+		}},
+		{"GET /sizing/{symbol}", app.handleSizing, openapi.Operation{
+			Summary: "Volatility-targeted position size",
+			Description: "Suggests a quantity whose annualized volatility is target_vol of the caller's allocation (USER_ALLOCATIONS, else desk equity, or ?allocation=). " +
+				"vol_qty sizes against realized volatility over window daily returns, atr_qty so a one-ATR day moves the allocation by target_vol/sqrt(252); qty is the smaller.",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "target_vol", Required: true, Description: "Annualized volatility target as a fraction of the allocation, e.g. 0.15"},
+				{Name: "window", Type: "integer", Description: "Daily returns realized volatility is measured over (default 20)"},
+				{Name: "atr_period", Type: "integer", Description: "ATR period in days (default 14)"},
+				{Name: "allocation", Description: "Capital to size against, overriding the caller's allocation"},
+			},
+			Response: sizingSuggestion{},
+		}},
+		{"GET /instruments/{symbol}", app.handleInstrument, openapi.Operation{
+			Summary: "Rounding and lot size rules of a symbol",
+			Description: "The lot an order's qty must be a multiple of, the smallest order, the price tick (zero for the equity schedule: $0.01 at or above $1, $0.0001 below) " +
+				"and whether the symbol trades in fractions, with any override from INSTRUMENTS_FILE. Orders are validated, sized and rebalanced against these.",
+			Response: instruments.Instrument{},
+		}},
+		{"GET /market/halts", app.handleHalts, openapi.Operation{
+			Summary:     "Symbols currently halted",
+			Description: "Halts and LULD pauses reported on HALT_FEED, longest halted first, with each symbol's last limit up-limit down bands. Orders in these symbols are rejected.",
+			Query:       []openapi.Param{symbolsParam},
+			Response:    []halts.Halt{},
+		}},
+		{"GET /market/bars/{symbol}", app.handleBars, openapi.Operation{
+			Summary:     "Historical bars of a symbol (JSON or Arrow)",
+			Description: "Split-adjusted OHLCV bars, oldest first. Send Accept: application/vnd.apache.arrow.stream or format=arrow to get them as an Arrow IPC stream.",
+			Query: []openapi.Param{
+				{Name: "timeframe", Description: "Bar timeframe: 1Min, 1Hour or 1Day (default)"},
+				{Name: "start", Description: "Start time, RFC 3339 or exchange time (default 30 days ago)"},
+				{Name: "end", Description: "End time (default now)"},
+				{Name: "limit", Type: "integer", Description: "Maximum bars (default 10000, max 100000)"},
+				{Name: "format", Description: "arrow for an Arrow IPC stream"},
+			},
+			Response: []bar{},
+		}},
+		{"GET /indicators/rsi", app.handleRSI, openapi.Operation{
+			Summary: "RSI for a symbol list or watchlist",
+			Query: []openapi.Param{
+				symbolsParam, watchlistParam,
+				{Name: "period", Type: "integer", Description: "RSI period (default 14)"},
+				{Name: "timeframe", Description: "Bar timeframe: 1Min, 1Hour or 1Day (default)"},
+			},
+			Response: []indicatorValue{},
+		}},
+		{"GET /backtests/strategies", app.handleBacktestStrategies, openapi.Operation{
+			Summary:  "The built-in strategies backtests can run, with their parameters",
+			Response: []backtest.Strategy{},
+		}},
+		{"POST /backtests", app.handleBacktest, openapi.Operation{
+			Summary:     "Backtest a built-in strategy on a symbol's daily bars",
+			Description: "Bars come from MARKET_DATA_BACKTEST, from start (default five years ago) to end (default today). Positions are decided at each close and held to the next; cost_bps is charged on every change of position. Parameters left out take their defaults. The run is stored (see GET /backtests/runs) and its run_id returned with its config_hash.",
+			Request:     backtestRequest{},
+			Response:    backtestResponse{},
+		}},
+		{"POST /backtests/walk-forward", app.handleWalkForward, openapi.Operation{
+			Summary:     "Walk-forward evaluation of a built-in strategy",
+			Description: "History is split into in-sample windows of in_sample_days bars (default 252), each followed by an out-of-sample window of out_of_sample_days (default 63). Each window fits the grid's parameter values by the objective (sharpe, total_return or return_over_drawdown) in sample and trades the fit out of sample; the out-of-sample windows are stitched into one report. The run is stored with its out-of-sample metrics and equity curve.",
+			Request:     walkForwardRequest{},
+			Response:    walkForwardResponse{},
+		}},
+		{"POST /backtests/sweep", app.handleSweep, openapi.Operation{
+			Summary:     "Backtest a built-in strategy over a grid of parameters",
+			Description: "Every combination of the grid's values (at most 500) is backtested, up to workers at a time (default and most BACKTEST_WORKERS), and ranked by the objective (sharpe, total_return or return_over_drawdown). Each configuration is flagged if its grid neighbors score under half as well, a parameter is at the edge of its grid or it made fewer than 10 trades. Every configuration is stored as a run and the report as a sweep.",
+			Request:     sweepRequest{},
+			Response:    sweepResponse{},
+		}},
+		{"GET /backtests/runs", app.handleBacktestRuns, openapi.Operation{
+			Summary:     "The caller's stored backtest runs, newest first",
+			Description: "Every POST /backtests and POST /backtests/walk-forward run, and every configuration of a POST /backtests/sweep, is stored. Listings leave out equity curves and walk-forward windows.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "strategy", Description: "Only runs of this strategy"},
+				{Name: "symbol", Description: "Only runs on this symbol"},
+				{Name: "config_hash", Description: "Only runs of this configuration"},
+				{Name: "limit", Type: "integer", Description: "At most this many runs (default 100)"},
+			},
+			Response: []database.BacktestRun{},
+		}},
+		{"GET /backtests/runs/{id}", app.handleGetBacktestRun, openapi.Operation{
+			Summary:  "A stored backtest run with its equity curve",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.BacktestRun{},
+		}},
+		{"DELETE /backtests/runs/{id}", app.handleDeleteBacktestRun, openapi.Operation{
+			Summary: "Delete a stored backtest run",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"GET /backtests/runs/{id}/diff/{other}", app.handleDiffBacktestRuns, openapi.Operation{
+			Summary:     "What changed from one stored run to another",
+			Description: "Changed parameters and settings as [from, to], whether the two runs share a configuration and dates, and every metric's change, marked better or worse where the metric has a direction.",
+			Headers:     []openapi.Param{userHeader},
+			Response:    backtestDiff{},
+		}},
+		{"GET /backtests/compare", app.handleCompareBacktestRuns, openapi.Operation{
+			Summary:     "Stored backtest runs side by side",
+			Description: "The runs' metrics, the best run on each metric with a direction, and their equity curves over the closes they all traded, rebased to 1.",
+			Headers:     []openapi.Param{userHeader},
+			Query:       []openapi.Param{{Name: "ids", Description: "Comma-separated run IDs, 2 to 10", Required: true}},
+			Response:    backtestComparison{},
+		}},
+		{"GET /backtests/sweeps", app.handleBacktestSweeps, openapi.Operation{
+			Summary:  "The caller's stored parameter sweeps, newest first, without their reports",
+			Headers:  []openapi.Param{userHeader},
+			Query:    []openapi.Param{{Name: "limit", Type: "integer", Description: "At most this many sweeps (default 100)"}},
+			Response: []database.BacktestSweep{},
+		}},
+		{"GET /backtests/sweeps/{id}", app.handleGetBacktestSweep, openapi.Operation{
+			Summary:  "A stored parameter sweep with its report",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.BacktestSweep{},
+		}},
+		{"GET /screen", app.handleScreen, openapi.Operation{
+			Summary: "Screen a universe on price, volume, change and RSI",
+			Query: []openapi.Param{
+				{Name: "universe", Description: "Named universe, instead of symbols or watchlist"},
+				symbolsParam, watchlistParam,
+				{Name: "filter", Description: "Repeatable filter, e.g. price>=10, avg_volume>1000000, change_pct<-2, rsi<30"},
+			},
+			Response: screenResponse{},
+		}},
+		{"POST /watchlists", app.handleCreateWatchlist, openapi.Operation{
+			Summary:  "Create a watchlist",
+			Headers:  []openapi.Param{userHeader},
+			Request:  createWatchlistRequest{},
+			Response: database.Watchlist{},
+			Status:   http.StatusCreated,
+		}},
+		{"GET /watchlists", app.handleListWatchlists, openapi.Operation{
+			Summary:  "List own and shared watchlists",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.Watchlist{},
+		}},
+		{"GET /watchlists/{id}", app.handleGetWatchlist, openapi.Operation{
+			Summary:  "Get a watchlist",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Watchlist{},
+		}},
+		{"PATCH /watchlists/{id}", app.handleUpdateWatchlist, openapi.Operation{
+			Summary:  "Rename or share a watchlist",
+			Headers:  []openapi.Param{userHeader},
+			Request:  updateWatchlistRequest{},
+			Response: database.Watchlist{},
+		}},
+		{"DELETE /watchlists/{id}", app.handleDeleteWatchlist, openapi.Operation{
+			Summary: "Delete a watchlist",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /watchlists/{id}/symbols", app.handleAddWatchlistSymbols, openapi.Operation{
+			Summary:  "Add symbols to a watchlist",
+			Headers:  []openapi.Param{userHeader},
+			Request:  watchlistSymbolsRequest{},
+			Response: database.Watchlist{},
+		}},
+		{"DELETE /watchlists/{id}/symbols/{symbol}", app.handleRemoveWatchlistSymbol, openapi.Operation{
+			Summary:  "Remove a symbol from a watchlist",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Watchlist{},
+		}},
+		{"GET /orders/gtc", app.handleGTCOrders, openapi.Operation{
+			Summary: "Open GTC orders with age and drift",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "stale", Type: "boolean", Description: "Only orders the stale-order policy would act on"},
+			},
+			Response: []sweeper.GTCOrder{},
+		}},
+		{"GET /orders/open", app.handleOpenOrders, openapi.Operation{
+			Summary: "Open orders reconciled between the book and the broker",
+			Description: "Merges the caller's open trades with a live list of the open orders in their account. Each order's state is matched, differs (another status or filled quantity at the broker), missing_at_broker (with the broker's status from a lookup) or unknown_to_desk. " +
+				"Other users' orders are left out; orders the desk doesn't know are always shown. Answers 502 if the broker can't be reached.",
+			Headers:  []openapi.Param{userHeader},
+			Response: openOrderBook{},
+		}},
+		{"GET /netting/signals/{id}", app.handleGetNettingSignal, openapi.Operation{
+			Summary:     "A strategy order held for netting",
+			Description: "Once its batch is sent, crossed_qty was offset against other strategies' orders, routed_qty went into the net order and filled_qty is what the strategy was booked (trade_id).",
+			Headers:     []openapi.Param{userHeader},
+			Response:    database.NettingSignal{},
+		}},
+		{"GET /netting/batches/{id}", app.handleGetNettingBatch, openapi.Operation{
+			Summary:     "A netted order and each strategy's contribution to it",
+			Description: "Visible to users with a signal in the batch.",
+			Headers:     []openapi.Param{userHeader},
+			Response:    database.NettingBatch{},
+		}},
+		{"POST /orders/conditional", app.handleCreateConditionalOrder, openapi.Operation{
+			Summary:  "Register a conditional order",
+			Headers:  []openapi.Param{userHeader, strategyHeader},
+			Request:  createConditionalOrderRequest{},
+			Response: database.ConditionalOrder{},
+			Status:   http.StatusCreated,
+		}},
+		{"GET /orders/conditional", app.handleListConditionalOrders, openapi.Operation{
+			Summary: "List conditional orders",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "status", Description: "Only orders in this status, e.g. pending"},
+				{Name: "trigger_type", Description: "Only orders with this trigger, e.g. at_time"},
+			},
+			Response: []database.ConditionalOrder{},
+		}},
+		{"DELETE /orders/conditional/{id}", app.handleCancelConditionalOrder, openapi.Operation{
+			Summary: "Cancel a pending conditional order",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /orders/basket", app.handleBasketOrder, openapi.Operation{
+			Summary:     "Submit a basket of orders as one position group",
+			Description: "Every leg is validated before any is submitted, then legs are placed one at a time. The legs that were placed are grouped (kind defaults to basket). Responds 422 if no leg was placed.",
+			Headers:     []openapi.Param{userHeader, strategyHeader, sourceHeader},
+			Request:     basketRequest{},
+			Response:    basketResponse{},
+			Status:      http.StatusCreated,
+		}},
+		{"POST /rebalance", app.handleRebalance, openapi.Operation{
+			Summary:     "Plan or place the orders that take positions to target weights",
+			Description: "Weights are fractions of capital, which defaults to the current value of the positions in the weighted symbols; they may sum to less than 1, the rest staying in cash. Symbols held but not weighted are left alone. Quantities are rounded down to what the asset class trades. With execute, the orders are submitted as a basket of market orders, sells first, and the response is 201.",
+			Headers:     []openapi.Param{userHeader, strategyHeader, sourceHeader},
+			Request:     rebalanceRequest{},
+			Response:    rebalanceResponse{},
+		}},
+		{"POST /optimize", app.handleOptimize, openapi.Operation{
+			Summary:     "Long-only target weights for a universe",
+			Description: "Runs mean_variance (the default), min_variance or risk_parity over daily returns of the listed symbols, a universe or a watchlist, from the screener's cached bars. Symbols with too little history are skipped. With rebalance, the weights are also passed to POST /rebalance and its plan (or placed basket) is returned alongside them.",
+			Headers:     []openapi.Param{userHeader, strategyHeader, sourceHeader},
+			Request:     optimizeRequest{},
+			Response:    optimizeResponse{},
+		}},
+		{"GET /models", app.handleListModels, openapi.Operation{
+			Summary:     "List the model portfolios",
+			Description: "Model portfolios are target weights admins define on the admin port. With drift=true, each comes with the drift of the caller's book, or the strategy's with X-Strategy-ID, as GET /models/{name}/drift reports it.",
+			Headers:     []openapi.Param{userHeader, strategyHeader},
+			Query: []openapi.Param{
+				{Name: "drift", Type: "boolean", Description: "Also compare the caller's book with each model"},
+				{Name: "capital", Description: "What the weights are fractions of (default the value of the positions in the model's symbols)"},
+			},
+			Response: []modelWithDrift{},
+		}},
+		{"GET /models/{name}", app.handleGetModel, openapi.Operation{
+			Summary:  "A model portfolio's target weights",
+			Response: database.ModelPortfolio{},
+		}},
+		{"GET /models/{name}/drift", app.handleModelDrift, openapi.Operation{
+			Summary: "How far the caller's book is from a model portfolio",
+			Description: "Each model symbol's value and weight of capital against its target weight, the largest drift and the turnover a rebalance would trade. " +
+				"The book is the caller's manual positions, or the strategy's with X-Strategy-ID; symbols held but not in the model are left out, as a rebalance leaves them alone.",
+			Headers:  []openapi.Param{userHeader, strategyHeader},
+			Query:    []openapi.Param{{Name: "capital", Description: "What the weights are fractions of (default the value of the positions in the model's symbols)"}},
+			Response: modelDrift{},
+		}},
+		{"POST /models/{name}/rebalance", app.handleModelRebalance, openapi.Operation{
+			Summary:     "Plan or place the orders that take positions to a model portfolio",
+			Description: "POST /rebalance with the model's weights. With execute, the orders are submitted as a basket named after the model and the response is 201.",
+			Headers:     []openapi.Param{userHeader, strategyHeader, sourceHeader},
+			Request:     modelRebalanceRequest{},
+			Response:    rebalanceResponse{},
+		}},
+		{"GET /positions/marks", app.handlePositionMarks, openapi.Operation{
+			Summary:     "The caller's open positions at their current marks",
+			Description: "Positions are marked every MARK_INTERVAL by the marking engine, with market value and unrealized P&L against average cost.",
+			Headers:     []openapi.Param{userHeader},
+			Query:       []openapi.Param{{Name: "strategy_id", Type: "integer", Description: "Only this strategy's positions"}},
+			Response:    marksResponse{},
+		}},
+		{"GET /positions/concentration", app.handleConcentration, openapi.Operation{
+			Summary: "The caller's concentration by symbol",
+			Description: "Each symbol's net market value across the caller's strategies as a share of their capital (USER_ALLOCATIONS, else account equity), most concentrated first, " +
+				"against MAX_USER_CONCENTRATION_PCT.",
+			Headers:  []openapi.Param{userHeader},
+			Response: risk.ConcentrationReport{},
+		}},
+		{"GET /positions/marks/history", app.handleMarkHistory, openapi.Operation{
+			Summary:     "Persisted position marks",
+			Description: "Marks stored every MARK_PERSIST_INTERVAL, oldest first. Send Accept: application/vnd.apache.arrow.stream or format=arrow to get them as an Arrow IPC stream.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "from", Description: "Start time, RFC 3339 or exchange time (default 24 hours ago)"},
+				{Name: "to", Description: "End time (default now)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's positions"},
+				{Name: "symbol", Description: "Only this symbol"},
+				{Name: "format", Description: "arrow for an Arrow IPC stream"},
+			},
+			Response: []database.PositionMark{},
+		}},
+		{"POST /positions/groups", app.handleCreateGroup, openapi.Operation{
+			Summary:     "Group related trades",
+			Description: "kind is pair, spread, hedge, basket or other (default).",
+			Headers:     []openapi.Param{userHeader},
+			Request:     createGroupRequest{},
+			Response:    database.PositionGroup{},
+			Status:      http.StatusCreated,
+		}},
+		{"GET /positions/groups", app.handleListGroups, openapi.Operation{
+			Summary:  "List the caller's position groups",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.PositionGroup{},
+		}},
+		{"GET /positions/groups/{id}", app.handleGroupReport, openapi.Operation{
+			Summary:  "Combined P&L and exposure of a position group",
+			Headers:  []openapi.Param{userHeader},
+			Response: groupReport{},
+		}},
+		{"POST /positions/groups/{id}/trades", app.handleAddGroupTrades, openapi.Operation{
+			Summary:  "Add trades to a position group",
+			Headers:  []openapi.Param{userHeader},
+			Request:  groupTradesRequest{},
+			Response: database.PositionGroup{},
+		}},
+		{"DELETE /positions/groups/{id}/trades/{trade_id}", app.handleRemoveGroupTrade, openapi.Operation{
+			Summary: "Remove a trade from a position group",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"DELETE /positions/groups/{id}", app.handleDeleteGroup, openapi.Operation{
+			Summary: "Delete a position group, keeping its trades",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /strategies", app.handleCreateStrategy, openapi.Operation{
+			Summary:     "Register a strategy",
+			Description: "Registers a script at file_path, or a repository at git_url deployed from git_ref (default HEAD).",
+			Headers:     []openapi.Param{userHeader},
+			Request:     createStrategyRequest{},
+			Response:    database.Strategy{},
+			Status:      http.StatusCreated,
+		}},
+		{"GET /strategies/{id}", app.handleGetStrategy, openapi.Operation{
+			Summary:  "Get a strategy",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Strategy{},
+		}},
+		{"DELETE /strategies/{id}", app.handleDeleteStrategy, openapi.Operation{
+			Summary:     "Delete a strategy, keeping its trades",
+			Description: "Stops the strategy if it is running. Its trades stay attributed to it, and orders attributed to it are blocked with an X-Reject-Code of STRATEGY_DELETED until it is restored.",
+			Headers:     []openapi.Param{userHeader},
+			Status:      http.StatusNoContent,
+		}},
+		{"GET /strategies/deleted", app.handleListDeletedStrategies, openapi.Operation{
+			Summary:  "List the caller's deleted strategies",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.Strategy{},
+		}},
+		{"POST /strategies/{id}/restore", app.handleRestoreStrategy, openapi.Operation{
+			Summary:  "Restore a deleted strategy",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Strategy{},
+		}},
+		{"POST /strategies/{id}/start", app.handleStartStrategy, openapi.Operation{
+			Summary:  "Start a strategy under the runner",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Strategy{},
+		}},
+		{"POST /strategies/{id}/stop", app.handleStopStrategy, openapi.Operation{
+			Summary:  "Stop a runner-managed strategy",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Strategy{},
+		}},
+		{"POST /strategies/{id}/kill", app.handleKillStrategy, openapi.Operation{
+			Summary:     "Kill a strategy",
+			Description: "Locks the strategy from starting and from opening positions, stops its process, cancels its conditional and open orders and, with flatten, closes its positions at market. It stays locked until an admin clears it.",
+			Headers:     []openapi.Param{userHeader},
+			Request:     killRequest{},
+			Response:    killResponse{},
+		}},
+		{"GET /strategies/{id}/logs", app.handleStrategyLogs, openapi.Operation{
+			Summary:     "Tail or follow a strategy's output",
+			Description: "Returns the last lines as JSON, or with follow=true streams them as server-sent `log` events followed by new lines.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "tail", Type: "integer", Description: "Number of lines (default 100)"},
+				{Name: "follow", Type: "boolean", Description: "Stream new lines as server-sent events"},
+			},
+			Response: []database.LogLine{},
+		}},
+		{"POST /strategies/{id}/versions", app.handleUploadStrategyVersion, openapi.Operation{
+			Summary:     "Upload a strategy version",
+			Description: "The body is a single Python script or a tar.gz bundle with strategy.py at its root.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "note", Description: "Describes the version"},
+				{Name: "activate", Type: "boolean", Description: "Make it the version the runner starts"},
+			},
+			Request:     []byte{},
+			RequestType: openapi.Binary,
+			Response:    database.StrategyVersion{},
+			Status:      http.StatusCreated,
+		}},
+		{"GET /strategies/{id}/versions", app.handleListStrategyVersions, openapi.Operation{
+			Summary:  "List a strategy's versions",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.StrategyVersion{},
+		}},
+		{"POST /strategies/{id}/versions/{version}/activate", app.handleActivateStrategyVersion, openapi.Operation{
+			Summary:  "Activate or roll back to a version",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Strategy{},
+		}},
+		{"POST /strategies/{id}/deploy", app.handleDeployStrategy, openapi.Operation{
+			Summary:     "Deploy a git ref of a strategy",
+			Description: "Responds 200 when deployed, 409 when the new version did not stay up and was rolled back, 422 when the commit is not a valid strategy bundle and 502 when the ref could not be fetched. Each carries the recorded deployment.",
+			Headers:     []openapi.Param{userHeader},
+			Request:     deployRequest{},
+			Response:    database.Deployment{},
+		}},
+		{"GET /strategies/{id}/deployments", app.handleListDeployments, openapi.Operation{
+			Summary:  "List a strategy's deployments",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.Deployment{},
+		}},
+		{"GET /strategies/{id}/secrets", app.handleListSecrets, openapi.Operation{
+			Summary:  "List a strategy's secret names",
+			Headers:  []openapi.Param{userHeader},
+			Response: []database.StrategySecret{},
+		}},
+		{"PUT /strategies/{id}/secrets/{name}", app.handleSetSecret, openapi.Operation{
+			Summary: "Set a strategy secret",
+			Headers: []openapi.Param{userHeader},
+			Request: setSecretRequest{},
+			Status:  http.StatusNoContent,
+		}},
+		{"DELETE /strategies/{id}/secrets/{name}", app.handleDeleteSecret, openapi.Operation{
+			Summary: "Delete a strategy secret",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"GET /symbols/aliases", app.handleListAliases, openapi.Operation{
+			Summary:  "List symbol aliases",
+			Response: []database.SymbolAlias{},
+		}},
+		{"PUT /symbols/aliases/{alias}", hostOnly(app.handleSetAlias), openapi.Operation{
+			Summary:     "Alias a symbol",
+			Description: "Orders and symbol lists using the alias trade the target symbol instead. Both are normalized first, e.g. brk-b becomes BRK.B and btc-usd becomes BTC/USD.",
+			Request:     setAliasRequest{},
+			Status:      http.StatusNoContent,
+		}},
+		{"DELETE /symbols/aliases/{alias}", hostOnly(app.handleDeleteAlias), openapi.Operation{
+			Summary: "Delete a symbol alias",
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /experiments", app.handleCreateExperiment, openapi.Operation{
+			Summary:  "Register an A/B experiment",
+			Request:  createExperimentRequest{},
+			Response: database.Experiment{},
+			Status:   http.StatusCreated,
+		}},
+		{"POST /experiments/{id}/stop", app.handleStopExperiment, openapi.Operation{
+			Summary:  "Stop an A/B experiment",
+			Response: database.Experiment{},
+		}},
+		{"GET /experiments/{id}/report", app.handleExperimentReport, openapi.Operation{
+			Summary:  "Compare experiment variants",
+			Response: experimentReport{},
+		}},
+		{"GET /reports/daily", app.handleDailyReport, openapi.Operation{
+			Summary: "Daily trade aggregates",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "from", Description: "First date, YYYY-MM-DD (default 30 days ago)"},
+				{Name: "to", Description: "Last date, YYYY-MM-DD (default today)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's trades"},
+			},
+			Response: []database.DailyAggregate{},
+		}},
+		{"GET /reports/cash", app.handleCashReport, openapi.Operation{
+			Summary:     "Daily cash ledger with carry costs and net P&L",
+			Description: "One row per day and strategy with deposits, trade cash flow, fees, borrow fees, margin interest, realized and net P&L, and the closing cash balance.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "from", Description: "First date, YYYY-MM-DD (default 30 days ago)"},
+				{Name: "to", Description: "Last date, YYYY-MM-DD (default today)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's cash"},
+			},
+			Response: []database.DailyCash{},
+		}},
+		{"GET /reports/weekly", app.handleWeeklyReport, openapi.Operation{
+			Summary:     "Weekly performance report (JSON or HTML)",
+			Description: "Equity curve from the previous Friday's close, top winners and losers, risk stats and open positions. Send Accept: text/html or format=html for the HTML report.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "date", Description: "Any date in the week, YYYY-MM-DD (default today)"},
+				{Name: "format", Description: "html for the HTML report"},
+			},
+			Response: reports.Weekly{},
+		}},
+		{"GET /reports/weekly/club", app.handleClubWeeklyReport, openapi.Operation{
+			Summary: "Weekly performance report of every user's books combined (JSON or HTML)",
+			Query: []openapi.Param{
+				{Name: "date", Description: "Any date in the week, YYYY-MM-DD (default today)"},
+				{Name: "format", Description: "html for the HTML report"},
+			},
+			Response: reports.Weekly{},
+		}},
+		{"GET /reports/explain", app.handleExplainReport, openapi.Operation{
+			Summary:     "Attribute a day's P&L to trading, holding, dividends, fees and carry",
+			Description: "Per strategy and symbol, from the previous session's close: trading is the day's trades, holding is overnight positions moving with the price. Today is marked at live prices.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "date", Description: "Session date, YYYY-MM-DD (default today)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's books"},
+			},
+			Response: reports.Explain{},
+		}},
+		{"GET /reports/explain/club", app.handleClubExplainReport, openapi.Operation{
+			Summary: "Attribute a day's P&L in every user's books",
+			Query: []openapi.Param{
+				{Name: "date", Description: "Session date, YYYY-MM-DD (default today)"},
+			},
+			Response: reports.Explain{},
+		}},
+		{"GET /reports/tca", app.handleTCA, openapi.Operation{
+			Summary:     "Execution quality per strategy against interval VWAP",
+			Description: "Each order that filled in the range is measured against the VWAP of the minute bars from its submission to its last fill. Slippage is positive when an order filled worse than VWAP; orders without bars, such as options, are counted but not measured.",
+			Headers:     []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "from", Description: "First fill date, YYYY-MM-DD (default 30 days ago)"},
+				{Name: "to", Description: "Last fill date, YYYY-MM-DD (default today)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's orders"},
+				{Name: "format", Description: "arrow for an Arrow IPC stream"},
+			},
+			Response: tcaResponse{},
+		}},
+		{"GET /reports/tca/orders", app.handleTCAOrders, openapi.Operation{
+			Summary: "Each filled order's interval VWAP and slippage",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "from", Description: "First fill date, YYYY-MM-DD (default 30 days ago)"},
+				{Name: "to", Description: "Last fill date, YYYY-MM-DD (default today)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's orders"},
+				{Name: "format", Description: "arrow for an Arrow IPC stream"},
+			},
+			Response: []tca.Execution{},
+		}},
+		{"GET /reports/tax-lots", app.handleTaxLots, openapi.Operation{
+			Summary: "Tax lots closed in a year, with wash sales flagged",
+			Description: "The caller's live fills matched first in, first out. A loss on shares bought back within 30 days before or after the sale is a wash sale: the disallowed loss is added back to its gain and carried into the replacement lot's cost. " +
+				"Losses whose window is still open carry wash_window_ends. Simulator fills are left out; crypto isn't subject to the rule and short sales aren't checked.",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "year", Type: "integer", Description: "Tax year lots were closed in (default this year)"},
+			},
+			Response: taxlots.Report{},
+		}},
+		{"GET /performance/opt-in", app.handleGetPublicOptIn, openapi.Operation{
+			Summary:  "Whether the caller's books are on the public performance page",
+			Headers:  []openapi.Param{userHeader},
+			Response: publicOptIn{},
+		}},
+		{"PUT /performance/opt-in", hostOnly(app.handlePublicOptIn), openapi.Operation{
+			Summary:     "Include the caller's books on the public performance page",
+			Description: "The page only shows a combined growth index and trade counts, never amounts or positions, and only once PUBLIC_PERFORMANCE_MIN_MEMBERS members have opted in.",
+			Headers:     []openapi.Param{userHeader},
+			Response:    publicOptIn{},
+		}},
+		{"DELETE /performance/opt-in", app.handlePublicOptOut, openapi.Operation{
+			Summary: "Remove the caller's books from the public performance page",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /orders/tickets", app.handleCreateTicket, openapi.Operation{
+			Summary: "Hold a manual order for confirmation",
+			Description: "Validates the order like POST /order and answers with its notional, the current quote and the caller's position before and after, without sending it. " +
+				"The order is submitted by confirming the ticket within ORDER_CONFIRM_TTL.",
+			Headers:  []openapi.Param{userHeader},
+			Request:  ticketRequest{},
+			Response: confirm.Ticket{},
+			Status:   http.StatusCreated,
+		}},
+		{"POST /orders/tickets/{id}/confirm", app.handleConfirmTicket, openapi.Operation{
+			Summary:     "Submit a ticket's order",
+			Description: "Answers like POST /order. A ticket can be confirmed once; an expired one is answered 410 Gone.",
+			Headers:     []openapi.Param{userHeader},
+			Response:    &orderprotos.OrderResponse{},
+			Status:      http.StatusCreated,
+			ProtoJSON:   true,
+		}},
+		{"DELETE /orders/tickets/{id}", app.handleCancelTicket, openapi.Operation{
+			Summary: "Discard a ticket without submitting it",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"GET /preferences", app.handleGetPreferences, openapi.Operation{
+			Summary:  "The caller's preferences",
+			Headers:  []openapi.Param{userHeader},
+			Response: database.Preferences{},
+		}},
+		{"PUT /preferences", app.handleSetPreferences, openapi.Operation{
+			Summary: "Replace the caller's preferences",
+			Description: "default_order_type and default_time_in_force fill orders that leave them empty, in POST /order, baskets and conditional orders. " +
+				"Notifications about the caller's orders also go to each of notification_channels (webhooks) at or above its min_level. Fields left out are cleared.",
+			Headers:  []openapi.Param{userHeader},
+			Request:  preferencesRequest{},
+			Response: database.Preferences{},
+		}},
+		{"DELETE /preferences", app.handleDeletePreferences, openapi.Operation{
+			Summary: "Reset the caller's preferences to the defaults",
+			Headers: []openapi.Param{userHeader},
+			Status:  http.StatusNoContent,
+		}},
+		{"POST /cash/deposits", app.handleDeposit, openapi.Operation{
+			Summary:     "Deposit or withdraw cash",
+			Description: "Records capital for the caller's unattributed trades, or for strategy_id. A negative amount is a withdrawal; date defaults to today.",
+			Headers:     []openapi.Param{userHeader},
+			Request:     depositRequest{},
+			Status:      http.StatusNoContent,
+		}},
+		{"GET /risk/snapshot", hostOnly(app.handleRiskSnapshot), openapi.Operation{
+			Summary:  "Latest risk snapshot",
+			Response: risk.Snapshot{},
+		}},
+		{"GET /risk/leverage", hostOnly(app.handleLeverage), openapi.Operation{
+			Summary: "Account leverage and its history",
+			Description: "Leverage is gross exposure over equity, from the latest risk snapshot; a snapshot is stored every LEVERAGE_HISTORY_INTERVAL for the history, oldest first. " +
+				"With MAX_LEVERAGE set, orders that would take leverage over it are blocked, while orders that only reduce a position are always allowed.",
+			Query: []openapi.Param{
+				{Name: "from", Description: "Start time, RFC 3339 or exchange time (default 7 days ago)"},
+				{Name: "to", Description: "End time (default now)"},
+			},
+			Response: leverageResponse{},
+		}},
+		{"GET /risk/overnight", hostOnly(app.handleOvernight), openapi.Operation{
+			Summary: "Overnight limits and the reductions the end-of-session check would make now",
+			Description: "OVERNIGHT_CHECK_LEAD before every close, gross exposure is checked against OVERNIGHT_MAX_GROSS and OVERNIGHT_MAX_LEVERAGE x equity, whichever is tighter. " +
+				"With OVERNIGHT_ACTION=flag an excess fails the check and is notified; with reduce every position is cut by the same fraction to remove it. " +
+				"From the check until the next open, orders that would take gross exposure over the overnight limits are blocked.",
+			Response: overnightResponse{},
+		}},
+		{"GET /risk/concentration", hostOnly(app.handleDeskConcentration), openapi.Operation{
+			Summary: "The desk's concentration by symbol",
+			Description: "Each symbol's net market value across the desk account's books as a share of equity, most concentrated first, against MAX_DESK_CONCENTRATION_PCT. " +
+				"With either concentration limit set, orders that would breach it are blocked, or with CONCENTRATION_ACTION=trim cut to the quantity that fits.",
+			Response: risk.ConcentrationReport{},
+		}},
+		{"GET /risk/rules", hostOnly(app.handleRiskRules), openapi.Operation{
+			Summary: "Custom pre-trade rules and the variables they may use",
+			Description: "Rules are loaded from the JSON file in RISK_RULES_FILE, each an expression such as order.notional < account.equity * 0.05 that an order must satisfy. " +
+				"An order for which it is false is flagged or blocked, as the rule's action says, and the hit logged. Each rule lists the variables it uses and its hits since midnight exchange time.",
+			Response: riskRulesResponse{},
+		}},
+		{"GET /risk/rules/hits", hostOnly(app.handleRiskRuleHits), openapi.Operation{
+			Summary:     "Custom rule hits",
+			Description: "Every order a custom rule flagged or blocked, newest first, with the values of the variables the rule's expression read.",
+			Query: []openapi.Param{
+				{Name: "rule", Description: "Only this rule's hits"},
+				{Name: "from", Description: "Start time, RFC 3339 or exchange time (default 7 days ago)"},
+				{Name: "to", Description: "End time (default now)"},
+			},
+			Response: []database.RuleHit{},
+		}},
+		{"GET /risk/greeks", hostOnly(app.handleGreeks), openapi.Operation{
+			Summary: "Per-position and portfolio greeks",
+			Description: "Black-Scholes delta, gamma, theta and vega from current quotes and implied volatilities, refreshed every GREEKS_INTERVAL. " +
+				"Portfolio figures are dollar delta, dollar gamma per 1% move, theta per day and vega per volatility point, with the configured limits and any breaches.",
+			Response: risk.GreeksReport{},
+		}},
+		{"GET /risk/alerts", hostOnly(app.handleExposureAlerts), openapi.Operation{
+			Summary: "Exposure alert thresholds and open breaches",
+			Description: "Every time positions are marked, gross exposure, each symbol's share of equity and cash are checked against ALERT_MAX_EXPOSURE, ALERT_MAX_CONCENTRATION_PCT and ALERT_MIN_CASH. " +
+				"A breach is notified when it opens, again every ALERT_REPEAT while it lasts, and once it has cleared.",
+			Response: exposureAlertsResponse{},
+		}},
+		{"GET /risk/hedge", hostOnly(app.handleHedges), openapi.Operation{
+			Summary: "Portfolio beta against each hedge rule's benchmark",
+			Description: "Every HEDGE_INTERVAL, each rule in HEDGE_RULES beta-weights the desk's positions against its benchmark, with betas from HEDGE_BETA_DAYS of daily returns. " +
+				"A rule whose beta is outside its band has a proposal: the benchmark order that brings the beta back to zero, placed if HEDGE_ACTION is execute.",
+			Response: hedge.Report{},
+		}},
+		{"GET /risk/cash", hostOnly(app.handleCash), openapi.Operation{
+			Summary: "The cash rules and the sweep they call for now",
+			Description: "CASH_SWEEP_LEAD before every close, the desk account's cash is kept at least CASH_MIN and at most CASH_MAX_PCT of equity by buying or selling CASH_SWEEP_SYMBOL (default BIL), booked to CASH_SWEEP_USER with the sweep order source. " +
+				"The sweep is notified, or placed if CASH_SWEEP_ACTION is execute. This only reports it.",
+			Response: cashResponse{},
+		}},
+		{"POST /risk/scenario", hostOnly(app.handleScenario), openapi.Operation{
+			Summary: "Price shock what-if on current positions",
+			Description: "Applies each shock's price_pct to the symbols, universe or watchlist it names, or to every position if it names none. " +
+				"Shocks matching the same position compound. Returns the estimated P&L per position and in aggregate; positions other than equities and crypto are listed as unmodeled.",
+			Headers:  []openapi.Param{userHeader},
+			Request:  scenarioRequest{},
+			Response: risk.Scenario{},
+		}},
+		{"GET /checklists", hostOnly(app.handleGetChecklists), openapi.Operation{
+			Summary: "Latest runs of the pre-open, post-close and maintenance checklists",
+			Description: "The latest run of each checklist, with every step's status (pending, running, passed, failed or skipped) and what it found. " +
+				"Runs are stored as they progress, so a step in progress shows as running.",
+			Query:    []openapi.Param{{Name: "date", Description: "Only runs for this session date, YYYY-MM-DD"}},
+			Response: []database.ChecklistRun{},
+		}},
+		{"GET /stream/risk", hostOnly(app.handleRiskStream), openapi.Operation{
+			Summary:  "Risk snapshot stream (SSE)",
+			Response: risk.Snapshot{},
+			Stream:   true,
+		}},
+		{"GET /stream/blotter", app.handleBlotterStream, openapi.Operation{
+			Summary: "Trade blotter stream (websocket)",
+			Description: "Sends a snapshot of the latest trades matching the filter, then each new trade and status change that matches. " +
+				"Send a filter as JSON ({\"user\", \"strategy_id\", \"symbol\", \"source\"}) to change it and get a new snapshot. " +
+				"A client that falls behind gets a fresh snapshot instead of the updates it missed.",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "user", Description: "Whose trades: default the caller's, * for every user's (host chapter only)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's trades"},
+				{Name: "symbol", Description: "Only this symbol's trades"},
+				{Name: "source", Description: "Only orders from this source: manual, api, webhook, scheduler, algo or sweep"},
+				{Name: "limit", Type: "integer", Description: "Rows in each snapshot (default 100, max 500)"},
+			},
+			Response:  &orderprotos.TradeRecord{},
+			Websocket: true,
+		}},
+		{"GET /stream/positions", app.handlePositionsStream, openapi.Operation{
+			Summary: "Positions and risk stream (websocket)",
+			Description: "Sends a snapshot of the marked positions (and, to the host chapter, the desk's risk), then a delta each time positions are marked or risk is snapshotted: " +
+				"positions that opened or whose quantity, cost or price changed, positions that closed, and the new risk. " +
+				"Messages are binary protobuf PositionsMessages, or protojson text with format=json. Seq counts the connection's messages; " +
+				"a client that sees a gap should send a PositionsResync to get a new snapshot. A client that falls behind is sent one without asking.",
+			Headers: []openapi.Param{userHeader},
+			Query: []openapi.Param{
+				{Name: "user", Description: "Whose positions: default the caller's, * for every user's (host chapter only)"},
+				{Name: "strategy_id", Type: "integer", Description: "Only this strategy's positions"},
+				{Name: "format", Description: "proto (default) or json"},
+			},
+			Response:  &positionprotos.PositionsMessage{},
+			Websocket: true,
+		}},
+		{"GET /stream/news", app.handleNewsStream, openapi.Operation{
+			Summary:  "News headline stream (SSE)",
+			Query:    []openapi.Param{symbolsParam, watchlistParam},
+			Response: database.NewsArticle{},
+			Stream:   true,
+		}},
+	}
+}
+
+// openAPI describes routes as an OpenAPI document
+func openAPI(routes []route) *openapi.Document {
+	doc := openapi.New("Quant Club Trading Desk", "1.0.0",
+		"Order entry, strategy management and market data for desk strategies. "+
+			"Errors are returned as plain text with a non-2xx status.")
+	for _, rt := range routes {
+		doc.Add(rt.pattern, rt.op)
+	}
+	return doc
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/screener"
+)
+
+// maxScreenSymbols caps the size of a screened universe
+const maxScreenSymbols = 500
+
+type screenResponse struct {
+	Universe []string `json:"universe"`
+	*screener.Result
+}
+
+// handleScreen filters a universe of symbols on cached daily bar data. The
+// universe is one of ?universe=<index name>, ?watchlist=<id> or ?symbols=;
+// each ?filter= (e.g. price>=10, avg_volume>1000000, change_pct<-2, rsi<30)
+// must pass for a symbol to match.
+func (app *Application) handleScreen(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var symbols []string
+	if name := query.Get("universe"); name != "" {
+		universe, ok := app.universe(name)
+		if !ok {
+			http.Error(w, "Bad request: unknown universe "+name, http.StatusBadRequest)
+			return
+		}
+		symbols = universe
+	} else {
+		var ok bool
+		if symbols, ok = app.requestSymbols(w, r); !ok {
+			return
+		}
+	}
+	if len(symbols) == 0 {
+		http.Error(w, "Bad request: universe, watchlist or symbols is required", http.StatusBadRequest)
+		return
+	}
+	if len(symbols) > maxScreenSymbols {
+		http.Error(w, "Bad request: universe is too large", http.StatusBadRequest)
+		return
+	}
+
+	var filters []screener.Filter
+	for _, expr := range query["filter"] {
+		f, err := screener.ParseFilter(expr)
+		if err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, f)
+	}
+
+	result, err := app.screener.Screen(symbols, filters)
+	if err != nil {
+		log.Printf("Failed to screen symbols: %v", err)
+		http.Error(w, "Failed to load market data", http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, screenResponse{Universe: symbols, Result: result})
+}
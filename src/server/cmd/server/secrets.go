@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"desk/internal/database"
+	"desk/internal/secrets"
+)
+
+// maxSecretBytes bounds a single secret value
+const maxSecretBytes = 64 * 1024
+
+type setSecretRequest struct {
+	Value string `json:"value"`
+}
+
+// secretsEnabled writes an error response when no secrets key is configured
+func (app *Application) secretsEnabled(w http.ResponseWriter) bool {
+	if app.secrets == nil {
+		http.Error(w, "Secrets are not configured (set STRATEGY_SECRETS_KEY)", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// handleListSecrets lists the names of a strategy's secrets. Values are
+// never returned.
+func (app *Application) handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	stored, err := app.db.GetStrategySecrets(strategy.ID)
+	if err != nil {
+		log.Printf("Failed to load strategy secrets: %v", err)
+		http.Error(w, "Failed to load secrets", http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		stored = []database.StrategySecret{}
+	}
+
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// handleSetSecret encrypts and stores a secret. It is injected into the
+// strategy's environment as {name} the next time the strategy starts.
+func (app *Application) handleSetSecret(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+	if !app.secretsEnabled(w) {
+		return
+	}
+
+	name := r.PathValue("name")
+	if !secrets.ValidName(name) {
+		http.Error(w, "Bad request: secret names must be upper-case environment variable names and not reserved", http.StatusBadRequest)
+		return
+	}
+
+	var req setSecretRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxSecretBytes)
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	sealed, err := app.secrets.Seal([]byte(req.Value), secrets.StrategyAAD(strategy.ID, name))
+	if err != nil {
+		log.Printf("Failed to encrypt secret: %v", err)
+		http.Error(w, "Failed to store secret", http.StatusInternalServerError)
+		return
+	}
+	if err := app.db.SetStrategySecret(strategy.ID, name, sealed); err != nil {
+		log.Printf("Failed to store secret: %v", err)
+		http.Error(w, "Failed to store secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := app.db.DeleteStrategySecret(strategy.ID, r.PathValue("name"))
+	if err != nil {
+		log.Printf("Failed to delete secret: %v", err)
+		http.Error(w, "Failed to delete secret", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
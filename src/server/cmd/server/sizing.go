@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/indicators"
+	"desk/internal/orders"
+)
+
+// Allocation sources in a sizing suggestion
+const (
+	allocationConfigured = "configured"
+	allocationEquity     = "equity"
+	allocationRequest    = "request"
+)
+
+// sizingSuggestion is a volatility-targeted position size for one symbol
+type sizingSuggestion struct {
+	Symbol           string          `json:"symbol"`
+	Price            decimal.Decimal `json:"price"`
+	Allocation       decimal.Decimal `json:"allocation"`
+	AllocationSource string          `json:"allocation_source"`
+	TargetVol        decimal.Decimal `json:"target_vol"`
+	// RealizedVol is annualized, over Window daily returns
+	RealizedVol decimal.Decimal `json:"realized_vol"`
+	Window      int             `json:"window"`
+	ATR         decimal.Decimal `json:"atr"`
+	ATRPeriod   int             `json:"atr_period"`
+	// VolQty makes the position's annualized volatility TargetVol of the
+	// allocation; ATRQty makes a one-ATR move the daily share of it
+	VolQty decimal.Decimal `json:"vol_qty"`
+	ATRQty decimal.Decimal `json:"atr_qty"`
+	// Qty is the smaller of the two
+	Qty      decimal.Decimal `json:"qty"`
+	Notional decimal.Decimal `json:"notional"`
+}
+
+// parseAllocations parses USER_ALLOCATIONS, a comma-separated list of
+// user=dollars
+func parseAllocations(s string) (map[string]decimal.Decimal, error) {
+	allocations := make(map[string]decimal.Decimal)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not user=amount", entry)
+		}
+		amount, err := decimal.NewFromString(strings.TrimSpace(v))
+		if err != nil || !amount.IsPositive() {
+			return nil, fmt.Errorf("invalid allocation for %s: %q", user, v)
+		}
+		allocations[strings.TrimSpace(user)] = amount
+	}
+	return allocations, nil
+}
+
+// allocation returns the capital userID's positions are sized against: their
+// configured allocation, else their account's equity
+func (app *Application) allocation(userID string) (decimal.Decimal, string, error) {
+	app.allocationsMu.RLock()
+	amount, ok := app.allocations[userID]
+	app.allocationsMu.RUnlock()
+	if ok {
+		return amount, allocationConfigured, nil
+	}
+
+	equity, err := app.equity(userID)
+	return equity, allocationEquity, err
+}
+
+// capital returns userID's allocation, else their account's equity
+func (app *Application) capital(userID string) (decimal.Decimal, error) {
+	amount, _, err := app.allocation(userID)
+	return amount, err
+}
+
+// equity returns the equity of the account userID trades in. The desk's
+// comes from the latest risk snapshot, so it moves with the marks, or from
+// the broker if there is no snapshot yet; a chapter's own account's comes
+// from the broker.
+func (app *Application) equity(userID string) (decimal.Decimal, error) {
+	if snap := app.riskSnapshots.Latest(); snap != nil && !app.brokers.ownAccount(userID) {
+		return snap.Equity, nil
+	}
+	account, err := app.brokers.forUser(userID).Account()
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get account: %w", err)
+	}
+	return account.Equity, nil
+}
+
+// sizeOrder computes the quantity of an order that asked the desk to size it,
+// from the equity of userID's account and the symbol's current mark
+func (app *Application) sizeOrder(userID string, order *orders.Order) error {
+	equity, err := app.equity(userID)
+	if err != nil {
+		return fmt.Errorf("cannot size order: %w", err)
+	}
+
+	var price decimal.Decimal
+	if order.LimitPrice == nil {
+		if price, err = app.marks.LatestPrice(order.Symbol); err != nil {
+			return fmt.Errorf("cannot size order: no price for %s: %w", order.Symbol, err)
+		}
+	}
+
+	return order.Size(equity, price, app.instruments.Lookup(order.Symbol))
+}
+
+// queryInt parses an optional integer query parameter within [min, max],
+// writing an error response if it is invalid
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def, min, max int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		http.Error(w, fmt.Sprintf("Bad request: %s must be between %d and %d", name, min, max), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// handleSizing suggests a position size in {symbol} whose volatility is
+// ?target_vol= (annualized, as a fraction) of the caller's allocation, from
+// the realized volatility over ?window= daily returns (default 20) and the
+// ATR over ?atr_period= days (default 14). ?allocation= overrides the
+// caller's allocation.
+func (app *Application) handleSizing(w http.ResponseWriter, r *http.Request) {
+	symbol := app.aliases.Resolve(r.PathValue("symbol"))
+	query := r.URL.Query()
+
+	targetVol, err := decimal.NewFromString(query.Get("target_vol"))
+	if err != nil || !targetVol.IsPositive() || targetVol.GreaterThan(decimal.NewFromInt(5)) {
+		http.Error(w, "Bad request: target_vol must be an annualized volatility between 0 and 5 (e.g. 0.15)", http.StatusBadRequest)
+		return
+	}
+	window, ok := queryInt(w, r, "window", 20, 2, 250)
+	if !ok {
+		return
+	}
+	atrPeriod, ok := queryInt(w, r, "atr_period", 14, 1, 250)
+	if !ok {
+		return
+	}
+
+	resp := sizingSuggestion{
+		Symbol:    symbol,
+		TargetVol: targetVol,
+		Window:    window,
+		ATRPeriod: atrPeriod,
+	}
+	if v := query.Get("allocation"); v != "" {
+		if resp.Allocation, err = decimal.NewFromString(v); err != nil || !resp.Allocation.IsPositive() {
+			http.Error(w, "Bad request: allocation must be a positive amount", http.StatusBadRequest)
+			return
+		}
+		resp.AllocationSource = allocationRequest
+	} else if resp.Allocation, resp.AllocationSource, err = app.allocation(requestUserID(r)); err != nil {
+		log.Printf("Failed to get allocation: %v", err)
+		http.Error(w, "Failed to get allocation", http.StatusInternalServerError)
+		return
+	}
+
+	// Enough calendar days for the longer lookback plus ATR smoothing
+	days := max(window, 3*atrPeriod) + 1
+	since := time.Now().AddDate(0, 0, -(days*7/5 + 10))
+	bars, err := app.marketData.Live.DailyBars([]string{symbol}, since)
+	if err != nil {
+		log.Printf("Failed to get daily bars for %s: %v", symbol, err)
+		http.Error(w, "Failed to get daily bars", http.StatusBadGateway)
+		return
+	}
+	history := make([]indicators.Bar, len(bars[symbol]))
+	closes := make([]decimal.Decimal, len(bars[symbol]))
+	for i, b := range bars[symbol] {
+		history[i] = indicators.Bar{
+			High:  decimal.NewFromFloat(b.High),
+			Low:   decimal.NewFromFloat(b.Low),
+			Close: decimal.NewFromFloat(b.Close),
+		}
+		closes[i] = history[i].Close
+	}
+
+	if resp.RealizedVol, err = indicators.RealizedVol(closes, window); err != nil {
+		http.Error(w, "Not enough history for "+symbol+": "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if resp.ATR, err = indicators.ATR(history, atrPeriod); err != nil {
+		http.Error(w, "Not enough history for "+symbol+": "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if resp.RealizedVol.IsZero() || resp.ATR.IsZero() {
+		http.Error(w, symbol+" has not moved over the lookback; no volatility to size against", http.StatusUnprocessableEntity)
+		return
+	}
+	if resp.Price, err = app.marks.LatestPrice(symbol); err != nil {
+		log.Printf("Failed to get price for %s: %v", symbol, err)
+		http.Error(w, "Failed to get price", http.StatusBadGateway)
+		return
+	}
+
+	inst := app.instruments.Lookup(symbol)
+	riskBudget := resp.Allocation.Mul(targetVol)
+	dailyBudget := riskBudget.Div(decimal.NewFromFloat(math.Sqrt(indicators.TradingDays)))
+	resp.VolQty = inst.RoundQty(riskBudget.Div(resp.RealizedVol).Div(resp.Price))
+	resp.ATRQty = inst.RoundQty(dailyBudget.Div(resp.ATR))
+	resp.Qty = decimal.Min(resp.VolQty, resp.ATRQty)
+	resp.Notional = resp.Qty.Mul(resp.Price).Round(2)
+	resp.RealizedVol = resp.RealizedVol.Round(4)
+	resp.ATR = resp.ATR.Round(4)
+
+	writeJSON(w, http.StatusOK, resp)
+}
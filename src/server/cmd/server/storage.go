@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"desk/internal/storage"
+)
+
+// openStore returns the object store artifacts, backups, exports and
+// archived data are kept in: an S3 bucket when STORAGE_S3_BUCKET is set,
+// otherwise STORAGE_DIR on local disk
+func openStore() (storage.Store, error) {
+	if bucket := os.Getenv("STORAGE_S3_BUCKET"); bucket != "" {
+		if os.Getenv("STORAGE_S3_REGION") == "" {
+			return nil, fmt.Errorf("invalid STORAGE_S3_REGION: required with STORAGE_S3_BUCKET")
+		}
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("STORAGE_S3_ENDPOINT"),
+			Region:    os.Getenv("STORAGE_S3_REGION"),
+			Bucket:    bucket,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		}), nil
+	}
+
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = "."
+	}
+	return storage.NewDisk(dir), nil
+}
+
+// openArtifactStore returns where strategy versions are kept: the
+// artifacts/ prefix of store, unless the older STRATEGY_ARTIFACT_S3_BUCKET
+// or STRATEGY_ARTIFACT_DIR settings give them a store of their own
+func openArtifactStore(store storage.Store) (storage.Store, error) {
+	if bucket := os.Getenv("STRATEGY_ARTIFACT_S3_BUCKET"); bucket != "" {
+		if os.Getenv("STRATEGY_ARTIFACT_S3_REGION") == "" {
+			return nil, fmt.Errorf("invalid STRATEGY_ARTIFACT_S3_REGION: required with STRATEGY_ARTIFACT_S3_BUCKET")
+		}
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("STRATEGY_ARTIFACT_S3_ENDPOINT"),
+			Region:    os.Getenv("STRATEGY_ARTIFACT_S3_REGION"),
+			Bucket:    bucket,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		}), nil
+	}
+	if dir := os.Getenv("STRATEGY_ARTIFACT_DIR"); dir != "" {
+		return storage.NewDisk(dir), nil
+	}
+	return storage.WithPrefix(store, "artifacts"), nil
+}
+
+type backupResponse struct {
+	Key string `json:"key"`
+}
+
+// handleBackup backs the database up to the object store now
+func (app *Application) handleBackup(w http.ResponseWriter, r *http.Request) {
+	key, err := app.backups.Backup(r.Context())
+	if err != nil {
+		log.Printf("Failed to back up database: %v", err)
+		http.Error(w, "Failed to back up database: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, backupResponse{Key: "backups/" + key})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"desk/internal/database"
+	"desk/internal/runner"
+	"desk/internal/tenants"
+)
+
+type createStrategyRequest struct {
+	Name     string `json:"name"`
+	FilePath string `json:"file_path"`
+	GitURL   string `json:"git_url"`
+	GitRef   string `json:"git_ref"`
+}
+
+func (app *Application) handleCreateStrategy(w http.ResponseWriter, r *http.Request) {
+	if !app.activeUser(w, r) {
+		return
+	}
+
+	var req createStrategyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.GitURL != "" {
+		app.createGitStrategy(w, r, req)
+		return
+	}
+	if req.Name == "" || req.FilePath == "" {
+		http.Error(w, "Bad request: name and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	strategy := &database.Strategy{
+		UserID:   requestUserID(r),
+		Name:     req.Name,
+		FilePath: req.FilePath,
+		Status:   "active",
+	}
+
+	id, err := app.db.CreateStrategy(strategy)
+	if err != nil {
+		log.Printf("Failed to create strategy: %v", err)
+		http.Error(w, "Failed to create strategy", http.StatusConflict)
+		return
+	}
+
+	created, err := app.db.GetStrategyByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load strategy", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (app *Application) handleGetStrategy(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid strategy ID", http.StatusBadRequest)
+		return
+	}
+
+	// Other chapters' strategies don't exist as far as the caller knows
+	strategy, err := app.db.GetStrategyByID(id)
+	if err != nil || !tenants.SameChapter(strategy.UserID, requestUserID(r)) {
+		http.Error(w, "Strategy not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, strategy)
+}
+
+// ownedStrategy loads the strategy in the {id} path parameter for its owner,
+// writing an error response if it can't be
+func (app *Application) ownedStrategy(w http.ResponseWriter, r *http.Request) (*database.Strategy, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid strategy ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	strategy, err := app.db.GetStrategyByID(id)
+	if err != nil {
+		http.Error(w, "Strategy not found", http.StatusNotFound)
+		return nil, false
+	}
+	if strategy.UserID != requestUserID(r) {
+		http.Error(w, "Only the owner can manage a strategy", http.StatusForbidden)
+		return nil, false
+	}
+	return strategy, true
+}
+
+// handleStartStrategy launches a strategy under the runner
+func (app *Application) handleStartStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.runner.Start(strategy); err != nil {
+		if errors.Is(err, runner.ErrRunning) || errors.Is(err, runner.ErrKilled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to start strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to start strategy", http.StatusInternalServerError)
+		return
+	}
+
+	app.writeStrategy(w, strategy.ID)
+}
+
+// handleStopStrategy stops a runner-managed strategy
+func (app *Application) handleStopStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.runner.Stop(strategy.ID); err != nil {
+		if errors.Is(err, runner.ErrNotRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to stop strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to stop strategy", http.StatusInternalServerError)
+		return
+	}
+
+	app.writeStrategy(w, strategy.ID)
+}
+
+// handleStrategyLogs returns the last ?tail= lines (default 100) of a
+// strategy's captured output. With ?follow=true the lines are sent as
+// server-sent events, followed by new lines as they are captured.
+func (app *Application) handleStrategyLogs(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	tail := 100
+	if v := query.Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > app.runnerConfig.LogLines {
+			http.Error(w, fmt.Sprintf("Bad request: tail must be between 0 and %d", app.runnerConfig.LogLines), http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+	follow := query.Get("follow") == "true"
+
+	// Subscribe before reading the stored tail so no line falls between them
+	var events <-chan runner.LogEvent
+	if follow {
+		var unsubscribe func()
+		events, unsubscribe = app.runner.Subscribe()
+		defer unsubscribe()
+	}
+
+	lines, err := app.db.GetStrategyLogs(strategy.ID, tail)
+	if err != nil {
+		log.Printf("Failed to load strategy logs: %v", err)
+		http.Error(w, "Failed to load strategy logs", http.StatusInternalServerError)
+		return
+	}
+
+	if !follow {
+		writeJSON(w, http.StatusOK, lines)
+		return
+	}
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	var last int64
+	for _, l := range lines {
+		if err := writeSSE(w, flusher, "log", l); err != nil {
+			return
+		}
+		last = l.Seq
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.StrategyID != strategy.ID || event.Seq <= last {
+				continue
+			}
+			if err := writeSSE(w, flusher, "log", event.LogLine); err != nil {
+				return
+			}
+			last = event.Seq
+		}
+	}
+}
+
+// activeUser writes a 403 and reports false if the caller has been
+// deactivated
+func (app *Application) activeUser(w http.ResponseWriter, r *http.Request) bool {
+	deleted, err := app.db.IsUserDeleted(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to check user: %v", err)
+		http.Error(w, "Failed to check user", http.StatusInternalServerError)
+		return false
+	}
+	if deleted {
+		http.Error(w, "User has been deactivated", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleDeleteStrategy soft-deletes one of the caller's strategies, stopping
+// it first if it is running. Its trades keep their attribution, and it can be
+// restored.
+func (app *Application) handleDeleteStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.runner.Stop(strategy.ID); err != nil && !errors.Is(err, runner.ErrNotRunning) {
+		log.Printf("Failed to stop strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to stop strategy", http.StatusInternalServerError)
+		return
+	}
+	if _, err := app.db.DeleteStrategy(strategy.ID); err != nil {
+		log.Printf("Failed to delete strategy %d: %v", strategy.ID, err)
+		http.Error(w, "Failed to delete strategy", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListDeletedStrategies lists the caller's deleted strategies
+func (app *Application) handleListDeletedStrategies(w http.ResponseWriter, r *http.Request) {
+	strategies, err := app.db.GetDeletedStrategies(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load deleted strategies: %v", err)
+		http.Error(w, "Failed to load deleted strategies", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, strategies)
+}
+
+// handleRestoreStrategy restores one of the caller's deleted strategies. It
+// comes back stopped.
+func (app *Application) handleRestoreStrategy(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid strategy ID", http.StatusBadRequest)
+		return
+	}
+	if !app.activeUser(w, r) {
+		return
+	}
+
+	restored, err := app.db.RestoreStrategy(id, requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to restore strategy %d: %v", id, err)
+		http.Error(w, "Failed to restore strategy", http.StatusInternalServerError)
+		return
+	}
+	if !restored {
+		http.Error(w, "Deleted strategy not found", http.StatusNotFound)
+		return
+	}
+
+	app.writeStrategy(w, id)
+}
+
+func (app *Application) writeStrategy(w http.ResponseWriter, id int64) {
+	strategy, err := app.db.GetStrategyByID(id)
+	if err != nil {
+		http.Error(w, "Failed to load strategy", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, strategy)
+}
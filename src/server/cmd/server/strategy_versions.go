@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"desk/internal/artifacts"
+	"desk/internal/database"
+	"desk/internal/runner"
+)
+
+// handleUploadStrategyVersion stores the request body as the strategy's next
+// version. The body is either a single Python script or a tar.gz bundle with
+// strategy.py at its root. ?note= describes the version and ?activate=true
+// makes it the version the runner starts.
+func (app *Application) handleUploadStrategyVersion(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, app.artifactMaxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Artifact too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "Bad request: empty artifact", http.StatusBadRequest)
+		return
+	}
+
+	version, err := app.artifacts.Put(r.Context(), strategy.ID, data)
+	if err != nil {
+		if errors.Is(err, artifacts.ErrInvalid) {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to store strategy artifact: %v", err)
+		http.Error(w, "Failed to store artifact", http.StatusInternalServerError)
+		return
+	}
+	version.Note = r.URL.Query().Get("note")
+	version.UploadedBy = requestUserID(r)
+	version.CreatedAt = time.Now()
+
+	if err := app.db.CreateStrategyVersion(version); err != nil {
+		log.Printf("Failed to create strategy version: %v", err)
+		http.Error(w, "Failed to create strategy version", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("activate") == "true" {
+		if err := app.activateStrategyVersion(strategy, version.Version); err != nil {
+			log.Printf("Failed to activate strategy %d version %d: %v", strategy.ID, version.Version, err)
+			http.Error(w, "Version stored but failed to activate", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, version)
+}
+
+func (app *Application) handleListStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := app.db.GetStrategyVersions(strategy.ID)
+	if err != nil {
+		log.Printf("Failed to load strategy versions: %v", err)
+		http.Error(w, "Failed to load strategy versions", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []database.StrategyVersion{}
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// handleActivateStrategyVersion makes a version, typically an earlier one
+// when rolling back, the one the runner starts
+func (app *Application) handleActivateStrategyVersion(w http.ResponseWriter, r *http.Request) {
+	strategy, ok := app.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+	version, ok := pathID(r, "version")
+	if !ok {
+		http.Error(w, "Bad request: invalid version", http.StatusBadRequest)
+		return
+	}
+	if _, err := app.db.GetStrategyVersion(strategy.ID, version); err != nil {
+		http.Error(w, "Strategy version not found", http.StatusNotFound)
+		return
+	}
+
+	if err := app.activateStrategyVersion(strategy, version); err != nil {
+		log.Printf("Failed to activate strategy %d version %d: %v", strategy.ID, version, err)
+		http.Error(w, "Failed to activate strategy version", http.StatusInternalServerError)
+		return
+	}
+
+	app.writeStrategy(w, strategy.ID)
+}
+
+// activateStrategyVersion selects the version the runner starts, restarting
+// the strategy on it if it is running
+func (app *Application) activateStrategyVersion(strategy *database.Strategy, version int64) error {
+	if err := app.db.SetActiveStrategyVersion(strategy.ID, version); err != nil {
+		return err
+	}
+	if !app.runner.Running(strategy.ID) {
+		return nil
+	}
+
+	if err := app.runner.Stop(strategy.ID); err != nil && !errors.Is(err, runner.ErrNotRunning) {
+		return err
+	}
+	updated, err := app.db.GetStrategyByID(strategy.ID)
+	if err != nil {
+		return err
+	}
+	return app.runner.Start(updated)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/risk"
+)
+
+// submitOrder runs pre-trade risk checks, routes a validated order to its
+// venue and logs the resulting trade. Orders from variant B of a running
+// experiment, and from members still trading on paper, trade against the
+// simulator. Orders blocked by a risk rule or
+// rejected by the broker (or by chaos mode) are logged as rejected trades
+// and the error is returned; flags raised by risk rules are returned with
+// the trade. Trades are timestamped with when the order was received (now,
+// if the order doesn't say), sent to the venue and acknowledged by it, and
+// carry the order's client order ID, assigned here if it has none.
+func (app *Application) submitOrder(userID string, strategyID *int64, order *orders.Order) (*database.Trade, []risk.Finding, error) {
+	if order.ReceivedAt.IsZero() {
+		order.ReceivedAt = app.clock.Now()
+	}
+	if order.ClientOrderID == "" {
+		order.ClientOrderID = orders.NewID(order.ReceivedAt)
+	}
+
+	venue := database.VenueAlpaca
+	placeOrder := app.brokers.forUser(userID).PlaceOrder
+	if strategyID != nil {
+		simulated, err := app.db.IsSimulatedVariant(*strategyID)
+		if err != nil {
+			log.Printf("Failed to check experiment routing: %v", err)
+		}
+		if simulated {
+			venue = database.VenueSimulator
+			placeOrder = app.simulator.PlaceOrder
+		}
+	}
+	if venue == database.VenueAlpaca && app.tradesOnPaper(userID) {
+		venue = database.VenueSimulator
+		placeOrder = app.simulator.PlaceOrder
+	}
+
+	if app.chaos != nil {
+		placeOrder = app.chaos.Wrap(placeOrder)
+	}
+
+	flags, err := app.gatePreTrade(userID, strategyID, order, venue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sentAt := app.clock.Now()
+	placedOrder, err := placeOrder(order)
+	ackedAt := app.clock.Now()
+	if err != nil {
+		log.Printf("Failed to place order %s: %v", order.ClientOrderID, err)
+		return nil, nil, app.logRejectedTrade(userID, strategyID, order, venue, err)
+	}
+
+	log.Printf("Successfully placed order - ID: %s, Client ID: %s, Status: %s, Venue: %s", placedOrder.ID, order.ClientOrderID, placedOrder.Status, venue)
+
+	// Log successful trade to database
+	trade := &database.Trade{
+		StrategyID:      strategyID,
+		StrategyVersion: app.strategyVersion(strategyID),
+		UserID:          userID,
+		OrderID:         placedOrder.ID,
+		Symbol:          order.Symbol,
+		Qty:             order.Qty,
+		Side:            string(placedOrder.Side),
+		OrderType:       string(placedOrder.Type),
+		TimeInForce:     string(placedOrder.TimeInForce),
+		LimitPrice:      order.LimitPrice,
+		StopPrice:       order.StopPrice,
+		FilledQty:       placedOrder.FilledQty,
+		FilledAvgPrice:  placedOrder.FilledAvgPrice,
+		OrderStatus:     string(placedOrder.Status),
+		SubmittedAt:     app.clock.Now(),
+		FilledAt:        placedOrder.FilledAt,
+		Venue:           venue,
+		ReceivedAt:      &order.ReceivedAt,
+		SentAt:          &sentAt,
+		AckedAt:         &ackedAt,
+		ClientOrderID:   order.ClientOrderID,
+		HedgeRule:       order.HedgeRule,
+		ExtendedHours:   order.ExtendedHours,
+		Source:          order.Source,
+	}
+
+	if id, err := app.db.LogTrade(trade); err != nil {
+		log.Printf("Failed to log trade to database: %v", err)
+	} else {
+		trade.ID = id
+		if err := app.dailyAggregates.RecordTrade(*trade); err != nil {
+			log.Printf("Failed to update daily aggregates: %v", err)
+		}
+		app.events.Fill(*trade)
+	}
+
+	return trade, flags, nil
+}
+
+// gatePreTrade runs the pre-trade risk rules against an order, reporting
+// flags, cutting the order to any trim and logging a blocked order as a
+// rejected trade on venue
+func (app *Application) gatePreTrade(userID string, strategyID *int64, order *orders.Order, venue string) ([]risk.Finding, error) {
+	flags, err := app.checkPreTrade(userID, strategyID, order)
+	if err != nil {
+		log.Printf("Order %s from user=%s %s", order.ClientOrderID, userID, err)
+		notify.SendUser(context.Background(), app.userNotifier, userID, notify.LevelWarning, "Order blocked",
+			fmt.Sprintf("%s %s %s for user %s: %v", order.Side, order.Qty, order.Symbol, userID, err))
+		return nil, app.logRejectedTrade(userID, strategyID, order, venue, err)
+	}
+	for _, f := range flags {
+		verb, title := "flagged", "Order flagged"
+		if f.Action == risk.ActionTrim {
+			verb, title = "trimmed", "Order trimmed"
+		}
+		log.Printf("Order from user=%s %s by %s: %s", userID, verb, f.Rule, f.Reason)
+		notify.SendUser(context.Background(), app.userNotifier, userID, notify.LevelWarning, title,
+			fmt.Sprintf("%s %s %s for user %s: %s", order.Side, order.Qty, order.Symbol, userID, f.Reason))
+	}
+	if qty, ok := risk.TrimmedQty(flags); ok {
+		order.Qty = qty
+	}
+	return flags, nil
+}
+
+// describeFinding describes a flag or trim for an order response
+func describeFinding(f risk.Finding) string {
+	if f.Action == risk.ActionTrim {
+		return "trimmed by " + f.Rule + ": " + f.Reason
+	}
+	return "flagged by " + f.Rule + ": " + f.Reason
+}
+
+// checkPreTrade runs the pre-trade risk rules against an order
+func (app *Application) checkPreTrade(userID string, strategyID *int64, order *orders.Order) ([]risk.Finding, error) {
+	var positionStrategy int64
+	if strategyID != nil {
+		positionStrategy = *strategyID
+	}
+	position, err := app.db.GetPositionQty(userID, positionStrategy, order.Symbol)
+	if err != nil {
+		return nil, &risk.BlockedError{Findings: []risk.Finding{{
+			Rule:   "position",
+			Action: risk.ActionBlock,
+			Reason: "current position could not be read: " + err.Error(),
+		}}}
+	}
+
+	return app.preTrade.Check(risk.Order{
+		UserID:      userID,
+		StrategyID:  strategyID,
+		Symbol:      order.Symbol,
+		Side:        order.Side,
+		Qty:         order.Qty,
+		LimitPrice:  order.LimitPrice,
+		PositionQty: position,
+		Time:        app.clock.Now(),
+		ClientTime:  order.ClientTime,
+		Nonce:       order.Nonce,
+		Source:      order.Source,
+	})
+}
+
+// rejectedError is an order failure that was logged as a rejected trade
+type rejectedError struct {
+	tradeID int64
+	err     error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// rejectedTradeID returns the ID of the rejected trade an order failure was
+// logged as, if it was
+func rejectedTradeID(err error) (int64, bool) {
+	var rejected *rejectedError
+	if errors.As(err, &rejected) && rejected.tradeID != 0 {
+		return rejected.tradeID, true
+	}
+	return 0, false
+}
+
+// logRejectedTrade records an order that never reached the market and
+// returns reason annotated with the rejected trade's ID
+func (app *Application) logRejectedTrade(userID string, strategyID *int64, order *orders.Order, venue string, reason error) error {
+	errMsg := reason.Error()
+	trade := &database.Trade{
+		StrategyID:      strategyID,
+		StrategyVersion: app.strategyVersion(strategyID),
+		UserID:          userID,
+		OrderID:         "", // No order ID for failed orders
+		Symbol:          order.Symbol,
+		Qty:             order.Qty,
+		Side:            order.Side,
+		OrderType:       order.Type,
+		TimeInForce:     order.TimeInForce,
+		LimitPrice:      order.LimitPrice,
+		StopPrice:       order.StopPrice,
+		OrderStatus:     orders.StatusRejected,
+		SubmittedAt:     app.clock.Now(),
+		ErrorMessage:    &errMsg,
+		Venue:           venue,
+		ClientOrderID:   order.ClientOrderID,
+		HedgeRule:       order.HedgeRule,
+		ExtendedHours:   order.ExtendedHours,
+		Source:          order.Source,
+	}
+	if !order.ReceivedAt.IsZero() {
+		trade.ReceivedAt = &order.ReceivedAt
+	}
+
+	id, err := app.db.LogTrade(trade)
+	if err != nil {
+		log.Printf("Failed to log rejected trade to database: %v", err)
+	}
+	return &rejectedError{tradeID: id, err: reason}
+}
+
+// strategyVersion is the artifact version the strategy placing an order is
+// running, if any
+func (app *Application) strategyVersion(strategyID *int64) *int64 {
+	if strategyID == nil || app.runner == nil {
+		return nil
+	}
+	return app.runner.RunningVersion(*strategyID)
+}
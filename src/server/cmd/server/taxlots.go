@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"desk/internal/market"
+	"desk/internal/taxlots"
+)
+
+// handleTaxLots returns the caller's lots closed in ?year= (default this
+// year), first in, first out, with wash sales flagged, and the lots still
+// open. Every fill up to now is matched, since a lot's basis depends on the
+// fills before it and a wash sale on the purchases after.
+func (app *Application) handleTaxLots(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	year := now.In(market.Exchange).Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < 2000 || y > year {
+			http.Error(w, "Bad request: year must be a year up to this one", http.StatusBadRequest)
+			return
+		}
+		year = y
+	}
+
+	userID := requestUserID(r)
+	trades, err := app.db.GetFilledTradesBetween(userID, nil, time.Time{}, now)
+	if err != nil {
+		log.Printf("Failed to load filled trades: %v", err)
+		http.Error(w, "Failed to load trades", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, taxlots.Build(userID, trades, year, now))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"desk/internal/arrowipc"
+	"desk/internal/market"
+	"desk/internal/tca"
+)
+
+// tcaResponse is the execution quality of the caller's strategies over a
+// range of sessions
+type tcaResponse struct {
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Strategies []tca.Summary `json:"strategies"`
+}
+
+// executions measures the caller's orders that filled in the report range
+// against their interval VWAPs, writing an error response on failure
+func (app *Application) executions(w http.ResponseWriter, r *http.Request) (from, to string, execs []tca.Execution, ok bool) {
+	from, to, strategyID, ok := reportRange(w, r)
+	if !ok {
+		return "", "", nil, false
+	}
+	start, _ := time.ParseInLocation("2006-01-02", from, market.Exchange)
+	end, _ := time.ParseInLocation("2006-01-02", to, market.Exchange)
+
+	trades, err := app.db.GetFilledTradesBetween(requestUserID(r), strategyID, start, end.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Failed to load filled trades: %v", err)
+		http.Error(w, "Failed to load trades", http.StatusInternalServerError)
+		return "", "", nil, false
+	}
+	return from, to, app.tca.Analyze(r.Context(), trades), true
+}
+
+// handleTCA returns, per strategy, how the caller's orders filled against
+// the VWAP over the time each was working. Query parameters are those of
+// the daily report; ?format=arrow returns the rows as an Arrow stream.
+func (app *Application) handleTCA(w http.ResponseWriter, r *http.Request) {
+	from, to, execs, ok := app.executions(w, r)
+	if !ok {
+		return
+	}
+	summaries := tca.Summarize(execs)
+	if wantsArrow(r) {
+		writeArrow(w, tcaSummaryColumns(summaries)...)
+		return
+	}
+	writeJSON(w, http.StatusOK, tcaResponse{From: from, To: to, Strategies: summaries})
+}
+
+// handleTCAOrders returns each of the caller's filled orders with its
+// interval VWAP and slippage, oldest fill first
+func (app *Application) handleTCAOrders(w http.ResponseWriter, r *http.Request) {
+	_, _, execs, ok := app.executions(w, r)
+	if !ok {
+		return
+	}
+	if wantsArrow(r) {
+		writeArrow(w, executionColumns(execs)...)
+		return
+	}
+	writeJSON(w, http.StatusOK, execs)
+}
+
+// tcaSummaryColumns lays strategy summaries out as Arrow columns
+func tcaSummaryColumns(summaries []tca.Summary) []arrowipc.Column {
+	n := len(summaries)
+	strategyID, orders, measured, beat := make([]*int64, n), make([]*int64, n), make([]*int64, n), make([]*int64, n)
+	notional, cost, slippage := make([]*float64, n), make([]*float64, n), make([]*float64, n)
+	for i := range summaries {
+		s := &summaries[i]
+		o, m, b := int64(s.Orders), int64(s.Measured), int64(s.Beat)
+		strategyID[i], orders[i], measured[i], beat[i] = s.StrategyID, &o, &m, &b
+		notional[i], cost[i], slippage[i] = decimalFloat(&s.Notional), decimalFloat(&s.Cost), decimalFloat(&s.SlippageBps)
+	}
+	return []arrowipc.Column{
+		arrowipc.Int64("strategy_id", strategyID),
+		arrowipc.Int64("orders", orders),
+		arrowipc.Int64("measured", measured),
+		arrowipc.Float64("notional", notional),
+		arrowipc.Float64("cost", cost),
+		arrowipc.Float64("slippage_bps", slippage),
+		arrowipc.Int64("beat", beat),
+	}
+}
+
+// executionColumns lays measured orders out as Arrow columns
+func executionColumns(execs []tca.Execution) []arrowipc.Column {
+	n := len(execs)
+	tradeID, strategyID, bars, volume := make([]*int64, n), make([]*int64, n), make([]*int64, n), make([]*int64, n)
+	orderID, symbol, side, orderType, source, errs := make([]*string, n), make([]*string, n), make([]*string, n), make([]*string, n), make([]*string, n), make([]*string, n)
+	qty, fillPrice, notional, vwap, slippage, cost := make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n), make([]*float64, n)
+	submittedAt, filledAt := make([]*time.Time, n), make([]*time.Time, n)
+	for i := range execs {
+		e := &execs[i]
+		b := int64(e.Bars)
+		tradeID[i], strategyID[i], bars[i], volume[i] = &e.TradeID, e.StrategyID, &b, &e.Volume
+		orderID[i], symbol[i], side[i], orderType[i] = &e.OrderID, &e.Symbol, &e.Side, &e.OrderType
+		if e.Source != "" {
+			source[i] = &e.Source
+		}
+		if e.Error != "" {
+			errs[i] = &e.Error
+		}
+		qty[i], fillPrice[i], notional[i], vwap[i] = decimalFloat(&e.Qty), decimalFloat(&e.FillPrice), decimalFloat(&e.Notional), decimalFloat(e.VWAP)
+		if e.Measured() {
+			slippage[i], cost[i] = decimalFloat(&e.SlippageBps), decimalFloat(&e.Cost)
+		}
+		submittedAt[i], filledAt[i] = &e.SubmittedAt, &e.FilledAt
+	}
+	return []arrowipc.Column{
+		arrowipc.Int64("trade_id", tradeID),
+		arrowipc.String("order_id", orderID),
+		arrowipc.Int64("strategy_id", strategyID),
+		arrowipc.String("symbol", symbol),
+		arrowipc.String("side", side),
+		arrowipc.String("order_type", orderType),
+		arrowipc.String("source", source),
+		arrowipc.Float64("qty", qty),
+		arrowipc.Float64("fill_price", fillPrice),
+		arrowipc.Float64("notional", notional),
+		arrowipc.Timestamp("submitted_at", submittedAt),
+		arrowipc.Timestamp("filled_at", filledAt),
+		arrowipc.Float64("vwap", vwap),
+		arrowipc.Int64("bars", bars),
+		arrowipc.Int64("volume", volume),
+		arrowipc.Float64("slippage_bps", slippage),
+		arrowipc.Float64("cost", cost),
+		arrowipc.String("error", errs),
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	alpacaapi "github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+
+	"desk/internal/alpaca"
+	"desk/internal/chaos"
+	"desk/internal/database"
+	"desk/internal/latency"
+	"desk/internal/tenants"
+)
+
+// tenantExempt are the API paths served without a chapter token: probes and
+// the API's own documentation
+var tenantExempt = map[string]bool{
+	"/readyz":             true,
+	"/openapi.json":       true,
+	"/docs":               true,
+	"/protos/descriptors": true,
+}
+
+// tenantHandler wraps the API so every request belongs to a chapter: it
+// requires a chapter token in the Authorization header and stores the
+// chapter in the request context, where requestUserID picks it up. A user
+// ID already qualified with a chapter prefix must be the caller's own.
+func (app *Application) tenantHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, "Unauthorized: chapter token required", http.StatusUnauthorized)
+			return
+		}
+		chapter, ok := app.tenants.Authenticate(token)
+		if !ok {
+			http.Error(w, "Unauthorized: unknown chapter token", http.StatusUnauthorized)
+			return
+		}
+		if user := r.Header.Get("X-User-ID"); strings.Contains(user, ":") && !chapter.Owns(user) {
+			http.Error(w, "Forbidden: user belongs to another chapter", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenants.WithChapter(r.Context(), chapter)))
+	})
+}
+
+// qualifyUserID returns the desk-wide ID of a user named in a request from
+// chapter, which is nil when there are no chapters. tenantHandler has
+// already rejected IDs prefixed with another chapter.
+func qualifyUserID(chapter *tenants.Chapter, user string) string {
+	if chapter == nil || tenants.ChapterID(user) != "" {
+		return user
+	}
+	return chapter.UserID(user)
+}
+
+// requestHost reports whether the request comes from the host chapter,
+// which is every request when there are no chapters. Desk-wide views and
+// controls, such as the account's risk and the checklists, are the host's.
+func requestHost(r *http.Request) bool {
+	chapter := tenants.FromContext(r.Context())
+	return chapter == nil || chapter.Host
+}
+
+// hostOnly restricts a handler to the host chapter
+func hostOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requestHost(r) {
+			http.Error(w, "Forbidden: available to the host chapter only", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// brokers routes broker calls to the account of the chapter that owns the
+// user or order: a chapter's own Alpaca account if it has one, the desk's
+// otherwise
+type brokers struct {
+	host     Broker
+	chapters map[string]Broker
+	registry *tenants.Registry
+	db       *database.DB
+}
+
+// connectChapters connects to the Alpaca account of every chapter that has
+// one. Their requests are timed by brokerLatency alongside the desk's own.
+func connectChapters(registry *tenants.Registry, defaultBaseURL string, brokerLatency *latency.Recorder) (map[string]Broker, error) {
+	chapters := make(map[string]Broker)
+	if registry == nil {
+		return chapters, nil
+	}
+	for _, c := range registry.Chapters() {
+		if c.Alpaca == nil {
+			continue
+		}
+		baseURL := c.Alpaca.BaseURL
+		if baseURL == "" {
+			baseURL = defaultBaseURL
+		}
+		client, err := alpaca.NewClient(c.Alpaca.KeyID, c.Alpaca.SecretKey, baseURL, brokerLatency.HTTPClient())
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to chapter %s's Alpaca account: %w", c.ID, err)
+		}
+		chapters[c.ID] = client
+	}
+	return chapters, nil
+}
+
+// chaosPaperOnly checks that chaos mode can't reach a live account: the
+// desk's own and every chapter's account must be on the paper API (or an
+// allowed test server). Chapters without an account of their own trade on
+// the desk's.
+func chaosPaperOnly(registry *tenants.Registry, defaultBaseURL string, allowed []string) error {
+	if err := chaos.PaperOnly(defaultBaseURL, allowed...); err != nil {
+		return err
+	}
+	if registry == nil {
+		return nil
+	}
+	for _, c := range registry.Chapters() {
+		if c.Alpaca == nil || c.Alpaca.BaseURL == "" {
+			continue
+		}
+		if err := chaos.PaperOnly(c.Alpaca.BaseURL, allowed...); err != nil {
+			return fmt.Errorf("chapter %s: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// forUser returns the account userID's orders go to
+func (b *brokers) forUser(userID string) Broker {
+	if b.registry != nil {
+		if c := b.registry.ChapterOf(userID); c != nil {
+			if client, ok := b.chapters[c.ID]; ok {
+				return client
+			}
+		}
+	}
+	return b.host
+}
+
+// accountOf returns the key accounts lists userID's account under: their
+// chapter's ID if it trades in its own account, else ""
+func (b *brokers) accountOf(userID string) string {
+	if b.registry != nil {
+		if c := b.registry.ChapterOf(userID); c != nil {
+			if _, ok := b.chapters[c.ID]; ok {
+				return c.ID
+			}
+		}
+	}
+	return ""
+}
+
+// ownAccount reports whether userID's chapter trades in its own account
+func (b *brokers) ownAccount(userID string) bool {
+	return b.forUser(userID) != b.host
+}
+
+// forOrder returns the account an order was placed in, by the user whose
+// trade it is. Orders the desk has no trade for are the desk account's.
+func (b *brokers) forOrder(orderID string) Broker {
+	if len(b.chapters) == 0 {
+		return b.host
+	}
+	userID, err := b.db.GetOrderUserID(orderID)
+	if err != nil {
+		log.Printf("Routing order %s to the desk account: %v", orderID, err)
+		return b.host
+	}
+	return b.forUser(userID)
+}
+
+// accounts returns every account, keyed by the chapter that trades in it;
+// the desk's is keyed by ""
+func (b *brokers) accounts() map[string]Broker {
+	accounts := map[string]Broker{"": b.host}
+	for id, client := range b.chapters {
+		accounts[id] = client
+	}
+	return accounts
+}
+
+func (b *brokers) GetOrder(orderID string) (*alpacaapi.Order, error) {
+	return b.forOrder(orderID).GetOrder(orderID)
+}
+
+func (b *brokers) CancelOrder(orderID string) error {
+	return b.forOrder(orderID).CancelOrder(orderID)
+}
+
+func (b *brokers) ReplaceOrder(orderID string, req alpacaapi.ReplaceOrderRequest) (*alpacaapi.Order, error) {
+	return b.forOrder(orderID).ReplaceOrder(orderID, req)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"desk/internal/tenants"
+)
+
+func loadChapters(t *testing.T, body string) *tenants.Registry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := tenants.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestChaosPaperOnly(t *testing.T) {
+	const paper = "https://paper-api.alpaca.markets"
+	chapters := func(baseURL string) *tenants.Registry {
+		return loadChapters(t, `{"chapters": [
+			{"id": "main", "token": "main-token-0123456789", "host": true},
+			{"id": "north", "token": "north-token-0123456789", "alpaca": {"key_id": "k", "secret_key": "s", "base_url": "`+baseURL+`"}}
+		]}`)
+	}
+
+	tests := []struct {
+		name     string
+		registry *tenants.Registry
+		baseURL  string
+		allowed  []string
+		ok       bool
+	}{
+		{"no chapters", nil, paper, nil, true},
+		{"live desk", nil, "https://api.alpaca.markets", nil, false},
+		{"paper chapter", chapters(paper), paper, nil, true},
+		{"chapter on the desk's URL", chapters(""), paper, nil, true},
+		{"live chapter", chapters("https://api.alpaca.markets"), paper, nil, false},
+		{"chapter on an allowed test server", chapters("http://127.0.0.1:8089"), paper, []string{"127.0.0.1:8089"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := chaosPaperOnly(tt.registry, tt.baseURL, tt.allowed)
+			if (err == nil) != tt.ok {
+				t.Errorf("chaosPaperOnly = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/confirm"
+	"desk/internal/orders"
+	orderprotos "desk/internal/protos/orders"
+	"desk/internal/risk"
+)
+
+// errConfirmationRequired rejects a manual POST /order from a user whose
+// preferences ask for orders to be confirmed
+var errConfirmationRequired = errors.New("confirmation required: place manual orders with POST /orders/tickets and confirm them, or turn off confirm_orders")
+
+type ticketRequest struct {
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	Qty         string `json:"qty"`
+	OrderType   string `json:"order_type"`
+	TimeInForce string `json:"time_in_force"`
+	LimitPrice  string `json:"limit_price"`
+	StopPrice   string `json:"stop_price"`
+
+	ExtendedHours bool `json:"extended_hours"`
+}
+
+// handleCreateTicket validates a manual order and holds it for
+// confirmation, answering with its notional at the current quote and the
+// position it would leave. Nothing is sent to the broker until the ticket
+// is confirmed.
+func (app *Application) handleCreateTicket(w http.ResponseWriter, r *http.Request) {
+	var req ticketRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("X-Strategy-ID") != "" {
+		http.Error(w, "Bad request: tickets are for manual orders; strategies place orders with POST /order", http.StatusBadRequest)
+		return
+	}
+	userID := requestUserID(r)
+
+	orderReq := &orderprotos.OrderRequest{
+		Symbol:      app.aliases.Resolve(req.Symbol),
+		Side:        req.Side,
+		Qty:         req.Qty,
+		OrderType:   req.OrderType,
+		TimeInForce: req.TimeInForce,
+		LimitPrice:  req.LimitPrice,
+		StopPrice:   req.StopPrice,
+
+		ExtendedHours: req.ExtendedHours,
+	}
+	if err := app.applyOrderDefaults(userID, orderReq); err != nil {
+		log.Printf("Failed to load preferences: %v", err)
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	order, err := orders.FromRequest(orderReq, app.instruments)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	order.ClientOrderID = orders.NewID(clock.Now())
+	order.Source = orders.SourceManual
+
+	var quote *decimal.Decimal
+	var quotedAt *time.Time
+	if mark, err := app.marks.Quote(order.Symbol); err != nil {
+		log.Printf("No quote for ticket in %s: %v", order.Symbol, err)
+	} else {
+		quote, quotedAt = &mark.Price, &mark.TradedAt
+	}
+	if quote == nil && order.LimitPrice == nil && order.StopPrice == nil {
+		http.Error(w, "No quote for "+order.Symbol+" to value the order at", http.StatusServiceUnavailable)
+		return
+	}
+
+	position, err := app.db.GetPositionQty(userID, 0, order.Symbol)
+	if err != nil {
+		log.Printf("Failed to load position for ticket: %v", err)
+		http.Error(w, "Failed to load position", http.StatusInternalServerError)
+		return
+	}
+
+	ticket := confirm.NewTicket(userID, order, quote, quotedAt, position)
+	app.tickets.Add(ticket, time.Now())
+	log.Printf("Created ticket %s for user=%s: %s %s %s, notional %s", ticket.ID, userID, order.Side, order.Qty, order.Symbol, ticket.Notional)
+
+	w.Header().Set("Location", "/orders/tickets/"+ticket.ID)
+	writeJSON(w, http.StatusCreated, ticket)
+}
+
+// handleConfirmTicket submits a ticket's order, if the ticket hasn't
+// expired, and answers like POST /order. A ticket can be confirmed once.
+func (app *Application) handleConfirmTicket(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	ticket, err := app.tickets.Take(userID, r.PathValue("id"), time.Now())
+	if errors.Is(err, confirm.ErrExpired) {
+		http.Error(w, fmt.Sprintf("Ticket expired after %s; create a new one", app.tickets.TTL()), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+
+	order := ticket.Order()
+	order.ReceivedAt = clock.Now()
+	trade, flags, err := app.submitOrder(userID, nil, order)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var blocked *risk.BlockedError
+		if errors.As(err, &blocked) {
+			status = http.StatusForbidden
+		}
+		writeOrderError(w, r, status, &orderprotos.OrderRequest{
+			Symbol: ticket.Symbol,
+			Qty:    ticket.Qty.String(),
+			Side:   ticket.Side,
+		}, err)
+		return
+	}
+
+	message := "Order placed successfully"
+	for _, f := range flags {
+		message += "; flagged by " + f.Rule + ": " + f.Reason
+	}
+	writeProto(w, r, http.StatusCreated, &orderprotos.OrderResponse{
+		Status:        "success",
+		OrderId:       trade.OrderID,
+		Message:       message,
+		Symbol:        trade.Symbol,
+		Qty:           trade.Qty.String(),
+		Side:          trade.Side,
+		FilledQty:     trade.FilledQty.String(),
+		OrderStatus:   trade.OrderStatus,
+		ClientOrderId: trade.ClientOrderID,
+	})
+}
+
+// handleCancelTicket discards a ticket without submitting it
+func (app *Application) handleCancelTicket(w http.ResponseWriter, r *http.Request) {
+	if !app.tickets.Cancel(requestUserID(r), r.PathValue("id")) {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	orderprotos "desk/internal/protos/orders"
+)
+
+const (
+	defaultTradePageSize = 50
+	maxTradePageSize     = 500
+	// maxArrowTradePageSize is the page size limit of Arrow responses, which
+	// are meant for pulling a whole blotter into a notebook
+	maxArrowTradePageSize = 10000
+)
+
+// handleListTrades serves the trade blotter one page at a time. Query
+// parameters: limit (default 50, max 500), cursor (from a previous page's
+// next_cursor) and include_total=true to also count all of the user's trades.
+// Arrow responses carry the cursor in the X-Next-Cursor header instead.
+func (app *Application) handleListTrades(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	arrow := wantsArrow(r)
+
+	limit, maxLimit := defaultTradePageSize, maxTradePageSize
+	if arrow {
+		maxLimit = maxArrowTradePageSize
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLimit)
+	}
+	includeTotal := query.Get("include_total") == "true"
+
+	page, err := app.db.GetTradesByUser(requestUserID(r), query.Get("cursor"), limit, includeTotal)
+	if err != nil {
+		log.Printf("Failed to list trades: %v", err)
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if arrow {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		if page.Total != nil {
+			w.Header().Set("X-Total-Count", strconv.FormatInt(*page.Total, 10))
+		}
+		writeArrow(w, tradeColumns(page.Trades)...)
+		return
+	}
+
+	resp := &orderprotos.TradePage{
+		NextCursor: page.NextCursor,
+		HasMore:    page.HasMore,
+	}
+	if page.Total != nil {
+		resp.TotalCount = *page.Total
+	}
+	tradeIDs := make([]int64, len(page.Trades))
+	for i, t := range page.Trades {
+		tradeIDs[i] = t.ID
+	}
+	journal, err := app.db.GetJournalEntryIDsByTrade(tradeIDs)
+	if err != nil {
+		log.Printf("Failed to load journal entries of trades: %v", err)
+	}
+	disputes, err := app.db.GetDisputeStatusByTrade(tradeIDs)
+	if err != nil {
+		log.Printf("Failed to load disputes of trades: %v", err)
+	}
+	for _, t := range page.Trades {
+		rec := tradeRecord(t)
+		rec.JournalEntryIds = journal[t.ID]
+		rec.Dispute = disputes[t.ID]
+		resp.Trades = append(resp.Trades, rec)
+	}
+
+	writeProto(w, r, http.StatusOK, resp)
+}
+
+// tradeRecord converts a database trade into its protobuf representation
+func tradeRecord(t database.Trade) *orderprotos.TradeRecord {
+	rec := &orderprotos.TradeRecord{
+		Id:          t.ID,
+		UserId:      t.UserID,
+		OrderId:     t.OrderID,
+		Symbol:      t.Symbol,
+		Qty:         t.Qty.String(),
+		Side:        t.Side,
+		OrderType:   t.OrderType,
+		TimeInForce: t.TimeInForce,
+		FilledQty:   t.FilledQty.String(),
+		OrderStatus: t.OrderStatus,
+		SubmittedAt: t.SubmittedAt.UTC().Format(time.RFC3339Nano),
+		Venue:       t.Venue,
+
+		ClientOrderId:       t.ClientOrderID,
+		SubmittedAtExchange: market.ExchangeTime(t.SubmittedAt).Format(time.RFC3339Nano),
+		SessionDate:         market.SessionDate(t.SubmittedAt),
+		ExtendedHours:       t.ExtendedHours,
+		Session:             tradeSession(&t),
+		Source:              t.Source,
+	}
+	if t.StrategyID != nil {
+		rec.StrategyId = *t.StrategyID
+	}
+	if t.StrategyVersion != nil {
+		rec.StrategyVersion = *t.StrategyVersion
+	}
+	if t.LimitPrice != nil {
+		rec.LimitPrice = t.LimitPrice.String()
+	}
+	if t.StopPrice != nil {
+		rec.StopPrice = t.StopPrice.String()
+	}
+	if t.FilledAvgPrice != nil {
+		rec.FilledAvgPrice = t.FilledAvgPrice.String()
+	}
+	if t.FilledAt != nil {
+		rec.FilledAt = t.FilledAt.UTC().Format(time.RFC3339Nano)
+		rec.FilledAtExchange = market.ExchangeTime(*t.FilledAt).Format(time.RFC3339Nano)
+	}
+	if t.ErrorMessage != nil {
+		rec.ErrorMessage = *t.ErrorMessage
+	}
+	return rec
+}
+
+// tradeSession returns the session a trade filled in, or was submitted in
+// if it hasn't filled
+func tradeSession(t *database.Trade) string {
+	if t.FilledAt != nil {
+		return market.SessionOf(*t.FilledAt)
+	}
+	return market.SessionOf(t.SubmittedAt)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"desk/internal/runner"
+)
+
+type deletedUser struct {
+	UserID            string  `json:"user_id"`
+	DeletedStrategies []int64 `json:"deleted_strategies"`
+}
+
+// handleDeleteUser deactivates a member on the admin port, e.g. on
+// graduating: their running strategies are stopped and deleted with them,
+// their pending conditional orders canceled and their orders blocked. Their
+// trades and books are kept. The user ID is the desk-wide one, with any
+// chapter prefix.
+func (app *Application) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	strategies, deleted, err := app.db.DeleteUser(userID)
+	if err != nil {
+		log.Printf("Failed to deactivate user %s: %v", userID, err)
+		http.Error(w, "Failed to deactivate user", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "User is already deactivated", http.StatusConflict)
+		return
+	}
+
+	for _, id := range strategies {
+		if err := app.runner.Stop(id); err != nil && !errors.Is(err, runner.ErrNotRunning) {
+			log.Printf("Failed to stop strategy %d of deactivated user %s: %v", id, userID, err)
+		}
+	}
+	if strategies == nil {
+		strategies = []int64{}
+	}
+	writeJSON(w, http.StatusOK, deletedUser{UserID: userID, DeletedStrategies: strategies})
+}
+
+// handleRestoreUser reactivates a member on the admin port, restoring the
+// strategies deleted with them. Strategies come back stopped, and canceled
+// conditional orders stay canceled.
+func (app *Application) handleRestoreUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	restored, err := app.db.RestoreUser(userID)
+	if err != nil {
+		log.Printf("Failed to restore user %s: %v", userID, err)
+		http.Error(w, "Failed to restore user", http.StatusInternalServerError)
+		return
+	}
+	if !restored {
+		http.Error(w, "User is not deactivated", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListDeletedUsers lists the deactivated members on the admin port
+func (app *Application) handleListDeletedUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.db.GetDeletedUsers()
+	if err != nil {
+		log.Printf("Failed to load deactivated users: %v", err)
+		http.Error(w, "Failed to load deactivated users", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
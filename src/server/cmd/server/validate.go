@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+
+	"desk/internal/alpaca"
+	"desk/internal/config"
+	"desk/internal/database"
+	"desk/internal/latency"
+	"desk/internal/mktdata"
+	"desk/internal/research"
+	"desk/internal/runner"
+	"desk/internal/secrets"
+	"desk/internal/tenants"
+)
+
+// Check outcomes in the validation report
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "FAIL"
+)
+
+// validation collects the results of a dry-run startup check
+type validation struct {
+	out    io.Writer
+	failed int
+	warned int
+}
+
+func (v *validation) section(name string) {
+	fmt.Fprintf(v.out, "\n%s\n", name)
+}
+
+func (v *validation) report(status, name, format string, args ...any) {
+	switch status {
+	case checkFail:
+		v.failed++
+	case checkWarn:
+		v.warned++
+	}
+	fmt.Fprintf(v.out, "  %-4s  %-30s %s\n", status, name, fmt.Sprintf(format, args...))
+}
+
+// envCheck validates one startup variable when it is set
+type envCheck struct {
+	key   string
+	parse func(string) error
+}
+
+func durationVar(v string) error {
+	_, err := time.ParseDuration(v)
+	return err
+}
+
+func positiveDurationVar(v string) error {
+	d, err := time.ParseDuration(v)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return err
+}
+
+func intVar(min int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err == nil && n < min {
+			err = fmt.Errorf("must be at least %d", min)
+		}
+		return err
+	}
+}
+
+func researchPolicyVar(v string) error {
+	_, err := research.LoadPolicy(v)
+	return err
+}
+
+func nonNegativeFloatVar(v string) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err == nil && f < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	return err
+}
+
+func rateVar(v string) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err == nil && (f < 0 || f > 1) {
+		err = fmt.Errorf("want 0 to 1")
+	}
+	return err
+}
+
+func boolVar(v string) error {
+	_, err := strconv.ParseBool(v)
+	return err
+}
+
+func feedVar(v string) error {
+	if v != marketdata.IEX && v != marketdata.SIP {
+		return fmt.Errorf("want iex or sip")
+	}
+	return nil
+}
+
+// marketDataVar checks a provider name for a use of market data
+func marketDataVar(use string) func(string) error {
+	return func(v string) error {
+		return mktdata.CheckName(use, v)
+	}
+}
+
+// sloVar checks a list of broker latency SLOs
+func sloVar(v string) error {
+	_, err := latency.ParseSLOs(v)
+	return err
+}
+
+// envChecks covers the startup variables that aren't reloadable settings
+var envChecks = []envCheck{
+	{"PORT", intVar(1)},
+	{"RISK_SNAPSHOT_INTERVAL", durationVar},
+	{"GREEKS_INTERVAL", positiveDurationVar},
+	{"MARK_INTERVAL", positiveDurationVar},
+	{"MARK_PERSIST_INTERVAL", durationVar},
+	{"MARK_RETENTION_DAYS", intVar(1)},
+	{"LEVERAGE_HISTORY_INTERVAL", durationVar},
+	{"LEVERAGE_RETENTION_DAYS", intVar(0)},
+	{"RISK_FREE_RATE", rateVar},
+	{"DAY_ORDER_SWEEP_DELAY", durationVar},
+	{"OPEN_CHECKLIST_LEAD", positiveDurationVar},
+	{"OVERNIGHT_CHECK_LEAD", positiveDurationVar},
+	{"MAINTENANCE_DELAY", positiveDurationVar},
+	{"MAINTENANCE_VACUUM_FREE", rateVar},
+	{"WARMUP_MAX_SYMBOLS", intVar(0)},
+	{"BROKER_LATENCY_SLO", sloVar},
+	{"BROKER_LATENCY_SLO_MINUTES", intVar(1)},
+	{"CONDITIONAL_POLL_INTERVAL", durationVar},
+	{"HEDGE_INTERVAL", positiveDurationVar},
+	{"HEDGE_BETA_DAYS", intVar(20)},
+	{"NETTING_WINDOW", durationVar},
+	{"NETTING_FILL_TIMEOUT", positiveDurationVar},
+	{"NTP_CHECK_INTERVAL", positiveDurationVar},
+	{"CLOCK_MAX_OFFSET", positiveDurationVar},
+	{"ORDER_CAPTURE_TTL", positiveDurationVar},
+	{"ORDER_CONFIRM_TTL", positiveDurationVar},
+	{"ORDER_CAPTURE_MAX_BYTES", intVar(1)},
+	{"NEWS_POLL_INTERVAL", durationVar},
+	{"NEWS_RETENTION_DAYS", intVar(1)},
+	{"HALT_FEED", feedVar},
+	{"STRATEGY_EVENTS_PORT", intVar(1)},
+	{"STRATEGY_EVENTS_FEED", feedVar},
+	{"STRATEGY_EVENTS_QUOTES", boolVar},
+	{"MARKET_DATA_LIVE", marketDataVar(mktdata.UseLive)},
+	{"MARKET_DATA_BACKTEST", marketDataVar(mktdata.UseBacktest)},
+	{"BACKTEST_WORKERS", intVar(1)},
+	{"MARKET_DATA_DASHBOARD", marketDataVar(mktdata.UseDashboard)},
+	{"WATCHLIST_ALPACA_SYNC", boolVar},
+	{"SCREEN_CACHE_TTL", durationVar},
+	{"STRATEGY_LOG_MAX_MB", intVar(1)},
+	{"STRATEGY_LOG_FILES", intVar(0)},
+	{"STRATEGY_LOG_LINES", intVar(1)},
+	{"STRATEGY_MAX_MEMORY_MB", intVar(0)},
+	{"STRATEGY_MAX_CPU_PCT", nonNegativeFloatVar},
+	{"STRATEGY_CPU_WINDOW", durationVar},
+	{"STRATEGY_MAX_RUNTIME", durationVar},
+	{"STRATEGY_ARTIFACT_MAX_MB", intVar(1)},
+	{"STRATEGY_DEPLOY_HEALTH_WINDOW", positiveDurationVar},
+	{"CHAOS_LATENCY", durationVar},
+	{"CHAOS_JITTER", durationVar},
+	{"CHAOS_REJECT_RATE", rateVar},
+	{"CHAOS_PARTIAL_FILL_RATE", rateVar},
+	{"ADMIN_PORT", intVar(1)},
+	{"ADMIN_SQL_WRITE", boolVar},
+	{"PUBLIC_PORT", intVar(1)},
+	{"PUBLIC_PERFORMANCE_DAYS", intVar(2)},
+	{"PUBLIC_PERFORMANCE_MIN_MEMBERS", intVar(1)},
+	{"RESEARCH_EXPORT_POLICY", researchPolicyVar},
+	{"RESTORE_FROM_BACKUP", boolVar},
+	{"BACKUP_DAILY", boolVar},
+	{"BACKUP_KEEP", intVar(0)},
+	{"ARCHIVE_MARKS", boolVar},
+	{"TSDB_FLUSH_INTERVAL", positiveDurationVar},
+	{"TSDB_FEED", feedVar},
+	{"TSDB_QUOTES", boolVar},
+}
+
+// runValidate checks configuration, the database, Alpaca credentials and
+// market data entitlements without starting the server, writing a report to
+// out. It returns the process exit code: 1 if any check failed.
+func runValidate(out io.Writer) int {
+	// Components log as they initialize; the report replaces that output
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	v := &validation{out: out}
+	fmt.Fprintln(out, "Validating trading desk configuration")
+
+	v.section("Configuration")
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := config.Load(path); err != nil {
+			v.report(checkFail, "CONFIG_FILE", "%v", err)
+		} else {
+			v.report(checkOK, "CONFIG_FILE", "loaded %s", path)
+		}
+	}
+	if path := os.Getenv("TENANTS_FILE"); path != "" {
+		if chapters, err := tenants.Load(path); err != nil {
+			v.report(checkFail, "TENANTS_FILE", "%v", err)
+		} else {
+			v.report(checkOK, "TENANTS_FILE", "%d chapters", len(chapters.Chapters()))
+		}
+	}
+
+	apiKey := os.Getenv("APCA_API_KEY_ID")
+	apiSecret := os.Getenv("APCA_API_SECRET_KEY")
+	if apiKey == "" || apiSecret == "" {
+		v.report(checkFail, "APCA_API_KEY_ID/SECRET_KEY", "must be set")
+	} else {
+		v.report(checkOK, "APCA_API_KEY_ID/SECRET_KEY", "set")
+	}
+
+	invalid := 0
+	for _, c := range envChecks {
+		if val := os.Getenv(c.key); val != "" {
+			if err := c.parse(val); err != nil {
+				v.report(checkFail, c.key, "invalid %q: %v", val, err)
+				invalid++
+			}
+		}
+	}
+	if invalid == 0 {
+		v.report(checkOK, "startup settings", "valid")
+	}
+
+	live, err := loadSettings(os.Getenv)
+	if err != nil {
+		v.report(checkFail, "reloadable settings", "%v", err)
+	} else {
+		v.report(checkOK, "reloadable settings", "drawdown limit %s, GTC stale action %s, earnings rule %s, %d universes, %d instrument overrides, %d custom rules",
+			live.drawdownLimit, live.gtcPolicy.Action, live.earningsRule, len(live.universes), len(live.instruments), len(live.customRules))
+		if live.earningsRule != "off" && os.Getenv("FINNHUB_API_KEY") == "" && os.Getenv("EARNINGS_CALENDAR_FILE") == "" {
+			v.report(checkWarn, "EARNINGS_RULE", "set but no earnings calendar source is configured")
+		}
+	}
+
+	if key := os.Getenv("STRATEGY_SECRETS_KEY"); key != "" {
+		if _, err := secrets.ParseKey(key); err != nil {
+			v.report(checkFail, "STRATEGY_SECRETS_KEY", "%v", err)
+		} else {
+			v.report(checkOK, "STRATEGY_SECRETS_KEY", "valid")
+		}
+	}
+	if os.Getenv("STORAGE_S3_BUCKET") != "" && os.Getenv("STORAGE_S3_REGION") == "" {
+		v.report(checkFail, "STORAGE_S3_REGION", "required with STORAGE_S3_BUCKET")
+	}
+	if os.Getenv("STRATEGY_ARTIFACT_S3_BUCKET") != "" && os.Getenv("STRATEGY_ARTIFACT_S3_REGION") == "" {
+		v.report(checkFail, "STRATEGY_ARTIFACT_S3_REGION", "required with STRATEGY_ARTIFACT_S3_BUCKET")
+	}
+	if os.Getenv("TSDB_URL") != "" && os.Getenv("TSDB_BUCKET") == "" {
+		v.report(checkFail, "TSDB_BUCKET", "required when TSDB_URL is set")
+	}
+	if os.Getenv("ADMIN_PORT") != "" && os.Getenv("ADMIN_TOKEN") == "" {
+		v.report(checkFail, "ADMIN_TOKEN", "required when ADMIN_PORT is set")
+	}
+	for _, key := range []string{"MARKET_DATA_LIVE", "MARKET_DATA_BACKTEST", "MARKET_DATA_DASHBOARD"} {
+		if os.Getenv(key) == mktdata.Polygon && os.Getenv("POLYGON_API_KEY") == "" {
+			v.report(checkFail, "POLYGON_API_KEY", "required when %s=polygon", key)
+			break
+		}
+	}
+
+	python := os.Getenv("STRATEGY_PYTHON")
+	if python == "" {
+		python = "python3"
+	}
+	if path, err := exec.LookPath(python); err != nil {
+		v.report(checkWarn, "STRATEGY_PYTHON", "%s not found; runner-managed strategies won't start", python)
+	} else {
+		v.report(checkOK, "STRATEGY_PYTHON", "%s", path)
+	}
+	if name := os.Getenv("STRATEGY_USER"); name == "" {
+		v.report(checkWarn, "STRATEGY_USER", "unset; runner-managed strategies won't start")
+	} else if _, err := runner.LookupSandbox(name); err != nil {
+		v.report(checkFail, "STRATEGY_USER", "%v", err)
+	} else {
+		v.report(checkOK, "STRATEGY_USER", "%s", name)
+	}
+
+	baseURL := os.Getenv("APCA_API_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://paper-api.alpaca.markets"
+	}
+	if os.Getenv("CHAOS_MODE") == "true" {
+		var chapters *tenants.Registry
+		if path := os.Getenv("TENANTS_FILE"); path != "" {
+			chapters, _ = tenants.Load(path)
+		}
+		if err := chaosPaperOnly(chapters, baseURL, strings.Split(os.Getenv("CHAOS_ALLOW_HOSTS"), ",")); err != nil {
+			v.report(checkFail, "CHAOS_MODE", "%v", err)
+		} else {
+			v.report(checkWarn, "CHAOS_MODE", "enabled; orders will see injected faults")
+		}
+	}
+
+	v.section("Database")
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./trading_desk.db"
+	}
+	if schema, err := database.CheckSchema(dbPath); err != nil {
+		v.report(checkFail, "DB_PATH", "%s: %v", dbPath, err)
+	} else {
+		if schema.Exists {
+			v.report(checkOK, "DB_PATH", "%s connected", dbPath)
+		} else {
+			v.report(checkWarn, "DB_PATH", "%s does not exist and will be created", dbPath)
+		}
+		switch {
+		case !schema.Exists:
+			v.report(checkOK, "migrations", "schema v%d will be created", schema.Latest)
+		case len(schema.Pending) > 0:
+			v.report(checkOK, "migrations", "schema v%d, startup will apply: %s",
+				schema.Current, strings.Join(schema.Pending, ", "))
+		default:
+			v.report(checkOK, "migrations", "schema v%d is up to date", schema.Current)
+		}
+	}
+
+	v.section("Alpaca")
+	if apiKey != "" && apiSecret != "" {
+		validateAlpaca(v, apiKey, apiSecret, baseURL)
+	} else {
+		v.report(checkFail, "credentials", "skipped: no API key")
+	}
+
+	v.section("Market data providers")
+	validateProviders(v, apiKey, apiSecret)
+
+	fmt.Fprintf(out, "\n%d failed, %d warnings\n", v.failed, v.warned)
+	if v.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validateAlpaca checks the trading account and market data entitlements the
+// credentials give access to
+func validateAlpaca(v *validation, apiKey, apiSecret, baseURL string) {
+	paper := strings.Contains(baseURL, "paper-api.")
+	mode := "live"
+	if paper {
+		mode = "paper"
+	}
+
+	client, err := alpaca.NewClient(apiKey, apiSecret, baseURL, nil)
+	if err != nil {
+		v.report(checkFail, "credentials", "%s account at %s: %v", mode, baseURL, err)
+		return
+	}
+	account, err := client.Account()
+	if err != nil {
+		v.report(checkFail, "credentials", "%v", err)
+		return
+	}
+	v.report(checkOK, "credentials", "%s account %s", mode, account.AccountNumber)
+	if !paper {
+		v.report(checkWarn, "trading mode", "LIVE: orders are sent to a real account")
+	}
+	if paperAccount := strings.HasPrefix(account.AccountNumber, "PA"); paperAccount != paper {
+		v.report(checkWarn, "trading mode", "account %s does not look like a %s account", account.AccountNumber, mode)
+	}
+
+	switch {
+	case account.Status != "ACTIVE":
+		v.report(checkFail, "account status", "%s", account.Status)
+	case account.AccountBlocked:
+		v.report(checkFail, "account status", "account blocked")
+	case account.TradingBlocked, account.TradeSuspendedByUser:
+		v.report(checkFail, "account status", "trading blocked")
+	default:
+		v.report(checkOK, "account status", "active, buying power %s, multiplier %s",
+			account.BuyingPower.StringFixed(2), account.Multiplier)
+	}
+	if !account.ShortingEnabled {
+		v.report(checkWarn, "shorting", "disabled; short sales will be rejected")
+	}
+
+	data := alpaca.NewDataClient(apiKey, apiSecret, "", nil)
+	if err := data.CheckFeed("SPY", marketdata.IEX); err != nil {
+		v.report(checkFail, "market data (IEX)", "%v", err)
+	} else {
+		v.report(checkOK, "market data (IEX)", "entitled")
+	}
+	if err := data.CheckFeed("SPY", marketdata.SIP); err != nil {
+		v.report(checkWarn, "market data (SIP)", "not entitled; prices come from IEX only: %v", err)
+		if os.Getenv("HALT_FEED") == marketdata.SIP {
+			v.report(checkFail, "halt feed", "HALT_FEED=sip but the account is not entitled to SIP")
+		}
+	} else {
+		v.report(checkOK, "market data (SIP)", "entitled")
+	}
+	if _, err := data.News(time.Now().Add(-24*time.Hour), 1); err != nil {
+		v.report(checkFail, "news", "%v", err)
+	} else {
+		v.report(checkOK, "news", "entitled")
+	}
+}
+
+// validateProviders fetches the latest SPY trade from each market data
+// provider other than Alpaca, which validateAlpaca covers
+func validateProviders(v *validation, apiKey, apiSecret string) {
+	selection, err := mktdata.Select(
+		os.Getenv("MARKET_DATA_LIVE"), os.Getenv("MARKET_DATA_BACKTEST"), os.Getenv("MARKET_DATA_DASHBOARD"),
+		mktdata.Config{Alpaca: alpaca.NewDataClient(apiKey, apiSecret, "", nil), PolygonAPIKey: os.Getenv("POLYGON_API_KEY")},
+	)
+	if err != nil {
+		v.report(checkFail, "providers", "%v", err)
+		return
+	}
+
+	checked := make(map[string]bool)
+	for _, use := range []struct {
+		name     string
+		provider mktdata.Provider
+	}{
+		{mktdata.UseLive, selection.Live},
+		{mktdata.UseBacktest, selection.Backtest},
+		{mktdata.UseDashboard, selection.Dashboard},
+	} {
+		name := selection.Names[use.name]
+		if name == mktdata.Alpaca || checked[name] {
+			v.report(checkOK, use.name, "%s", name)
+			continue
+		}
+		checked[name] = true
+		if _, tradedAt, err := use.provider.LatestTrade("SPY"); err != nil {
+			v.report(checkFail, use.name, "%s: %v", name, err)
+		} else {
+			v.report(checkOK, use.name, "%s, latest SPY trade at %s", name, tradedAt.UTC().Format(time.RFC3339))
+		}
+	}
+}
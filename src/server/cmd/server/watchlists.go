@@ -0,0 +1,258 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"desk/internal/database"
+)
+
+type createWatchlistRequest struct {
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+	Shared  bool     `json:"shared"`
+}
+
+type updateWatchlistRequest struct {
+	Name   *string `json:"name"`
+	Shared *bool   `json:"shared"`
+}
+
+type watchlistSymbolsRequest struct {
+	Symbols []string `json:"symbols"`
+}
+
+// requestSymbols resolves the symbol universe for a request: the symbols of
+// the watchlist named by ?watchlist=<id> if given, otherwise ?symbols=. It
+// writes an error response and returns false if the watchlist can't be used.
+func (app *Application) requestSymbols(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	v := r.URL.Query().Get("watchlist")
+	if v == "" {
+		return app.aliases.ResolveAll(querySymbols(r)), true
+	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "Bad request: invalid watchlist ID", http.StatusBadRequest)
+		return nil, false
+	}
+	wl, err := app.db.GetWatchlist(id)
+	if err != nil || !wl.VisibleTo(requestUserID(r)) {
+		http.Error(w, "Watchlist not found", http.StatusNotFound)
+		return nil, false
+	}
+	if len(wl.Symbols) == 0 {
+		http.Error(w, "Bad request: watchlist has no symbols", http.StatusBadRequest)
+		return nil, false
+	}
+	return app.aliases.ResolveAll(wl.Symbols), true
+}
+
+// ownedWatchlist loads the watchlist in the {id} path parameter for
+// modification by its owner, writing an error response if it can't be
+func (app *Application) ownedWatchlist(w http.ResponseWriter, r *http.Request) (*database.Watchlist, bool) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid watchlist ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	userID := requestUserID(r)
+	wl, err := app.db.GetWatchlist(id)
+	if err != nil || !wl.VisibleTo(userID) {
+		http.Error(w, "Watchlist not found", http.StatusNotFound)
+		return nil, false
+	}
+	if wl.UserID != userID {
+		http.Error(w, "Only the owner can change a watchlist", http.StatusForbidden)
+		return nil, false
+	}
+	return wl, true
+}
+
+// syncWatchlist mirrors a changed watchlist to Alpaca when sync is enabled.
+// Failures are logged; the desk's copy stays authoritative.
+func (app *Application) syncWatchlist(id int64) *database.Watchlist {
+	wl, err := app.db.GetWatchlist(id)
+	if err != nil {
+		log.Printf("Failed to reload watchlist: %v", err)
+		return nil
+	}
+	if app.watchlistSync != nil {
+		if err := app.watchlistSync.Push(wl); err != nil {
+			log.Printf("Failed to sync watchlist ID=%d to Alpaca: %v", id, err)
+		}
+	}
+	return wl
+}
+
+// handleCreateWatchlist creates a watchlist owned by the caller
+func (app *Application) handleCreateWatchlist(w http.ResponseWriter, r *http.Request) {
+	var req createWatchlistRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Bad request: name is required", http.StatusBadRequest)
+		return
+	}
+
+	wl := &database.Watchlist{
+		UserID:  requestUserID(r),
+		Name:    req.Name,
+		Shared:  req.Shared,
+		Symbols: app.aliases.ResolveAll(req.Symbols),
+	}
+	id, err := app.db.CreateWatchlist(wl)
+	if err != nil {
+		log.Printf("Failed to create watchlist: %v", err)
+		http.Error(w, "Failed to create watchlist", http.StatusConflict)
+		return
+	}
+
+	created := app.syncWatchlist(id)
+	if created == nil {
+		http.Error(w, "Failed to load watchlist", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// handleListWatchlists lists the caller's watchlists and every shared one
+func (app *Application) handleListWatchlists(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.db.GetWatchlists(requestUserID(r))
+	if err != nil {
+		log.Printf("Failed to load watchlists: %v", err)
+		http.Error(w, "Failed to load watchlists", http.StatusInternalServerError)
+		return
+	}
+	if lists == nil {
+		lists = []database.Watchlist{}
+	}
+
+	writeJSON(w, http.StatusOK, lists)
+}
+
+func (app *Application) handleGetWatchlist(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(r, "id")
+	if !ok {
+		http.Error(w, "Bad request: invalid watchlist ID", http.StatusBadRequest)
+		return
+	}
+
+	wl, err := app.db.GetWatchlist(id)
+	if err != nil || !wl.VisibleTo(requestUserID(r)) {
+		http.Error(w, "Watchlist not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, wl)
+}
+
+// handleUpdateWatchlist renames a watchlist or shares/unshares it with the
+// club
+func (app *Application) handleUpdateWatchlist(w http.ResponseWriter, r *http.Request) {
+	wl, ok := app.ownedWatchlist(w, r)
+	if !ok {
+		return
+	}
+
+	var req updateWatchlistRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil {
+		wl.Name = strings.TrimSpace(*req.Name)
+		if wl.Name == "" {
+			http.Error(w, "Bad request: name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Shared != nil {
+		wl.Shared = *req.Shared
+	}
+
+	if err := app.db.UpdateWatchlist(wl.ID, wl.Name, wl.Shared); err != nil {
+		log.Printf("Failed to update watchlist: %v", err)
+		http.Error(w, "Failed to update watchlist", http.StatusConflict)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.syncWatchlist(wl.ID))
+}
+
+// handleAddWatchlistSymbols adds symbols to one of the caller's watchlists
+func (app *Application) handleAddWatchlistSymbols(w http.ResponseWriter, r *http.Request) {
+	wl, ok := app.ownedWatchlist(w, r)
+	if !ok {
+		return
+	}
+
+	var req watchlistSymbolsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Bad request: invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	symbols := app.aliases.ResolveAll(req.Symbols)
+	if len(symbols) == 0 {
+		http.Error(w, "Bad request: symbols are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.db.AddWatchlistSymbols(wl.ID, symbols); err != nil {
+		log.Printf("Failed to add watchlist symbols: %v", err)
+		http.Error(w, "Failed to add watchlist symbols", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.syncWatchlist(wl.ID))
+}
+
+// handleRemoveWatchlistSymbol removes a symbol from one of the caller's
+// watchlists
+func (app *Application) handleRemoveWatchlistSymbol(w http.ResponseWriter, r *http.Request) {
+	wl, ok := app.ownedWatchlist(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := app.db.RemoveWatchlistSymbol(wl.ID, app.aliases.Resolve(r.PathValue("symbol")))
+	if err != nil {
+		log.Printf("Failed to remove watchlist symbol: %v", err)
+		http.Error(w, "Failed to remove watchlist symbol", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Symbol is not on the watchlist", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app.syncWatchlist(wl.ID))
+}
+
+// handleDeleteWatchlist deletes one of the caller's watchlists
+func (app *Application) handleDeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	wl, ok := app.ownedWatchlist(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.db.DeleteWatchlist(wl.ID); err != nil {
+		log.Printf("Failed to delete watchlist: %v", err)
+		http.Error(w, "Failed to delete watchlist", http.StatusInternalServerError)
+		return
+	}
+	if app.watchlistSync != nil {
+		if err := app.watchlistSync.Delete(wl); err != nil {
+			log.Printf("Failed to delete Alpaca watchlist for ID=%d: %v", wl.ID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
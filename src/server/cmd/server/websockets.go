@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	defaultWSPingInterval    = 30 * time.Second
+	defaultWSIdleTimeout     = 75 * time.Second
+	defaultWSMaxPerUser      = 8
+	defaultWSMaxResubscribes = 30
+
+	// wsWriteTimeout drops a client that stops reading
+	wsWriteTimeout = 10 * time.Second
+	// resubscribeWindow is the window WS_MAX_RESUBSCRIBES counts over
+	resubscribeWindow = time.Minute
+)
+
+// socketConfig limits websocket connections. Zero turns a limit off.
+type socketConfig struct {
+	// PingInterval is how often every connection is pinged
+	PingInterval time.Duration
+	// IdleTimeout closes a connection nothing (a message or a pong) has
+	// been heard from for this long
+	IdleTimeout time.Duration
+	// MaxPerUser caps the websockets a user may have open at once
+	MaxPerUser int
+	// MaxResubscribes caps how often a connection may change what it is
+	// subscribed to, per minute
+	MaxResubscribes int
+}
+
+// socketStats counts the open websockets and why others were refused or
+// closed
+type socketStats struct {
+	Open map[string]int `json:"open"`
+	// Rejected counts connections refused for the per-user limit
+	Rejected uint64 `json:"rejected"`
+	// Reaped counts connections closed because nothing was heard from them
+	Reaped uint64 `json:"reaped"`
+	// Throttled counts resubscribes refused for the per-connection limit
+	Throttled uint64 `json:"throttled"`
+}
+
+// sockets tracks every open websocket, so the limits hold across endpoints,
+// dead clients are closed instead of holding their goroutines forever, and
+// every connection can be told to reconnect when the server stops
+type sockets struct {
+	config  socketConfig
+	origins []string
+
+	mu       sync.Mutex
+	open     map[*socket]struct{}
+	perUser  map[string]int
+	stopping bool
+
+	rejected, reaped, throttled atomic.Uint64
+}
+
+func newSockets(config socketConfig, origins []string) *sockets {
+	return &sockets{
+		config:  config,
+		origins: origins,
+		open:    make(map[*socket]struct{}),
+		perUser: make(map[string]int),
+	}
+}
+
+// socket is one open websocket. Its context ends when the client goes away,
+// is reaped or the server stops; the handler must keep reading from it for
+// pings to be answered, and must call close when it returns.
+type socket struct {
+	*websocket.Conn
+	endpoint string
+	user     string
+	sockets  *sockets
+	ctx      context.Context
+	cancel   context.CancelFunc
+	once     sync.Once
+
+	// heard is when the client last sent a message or answered a ping, in
+	// Unix nanoseconds
+	heard atomic.Int64
+
+	mu           sync.Mutex
+	resubscribes []time.Time
+}
+
+// accept upgrades r to a websocket for endpoint, answering the request
+// itself if the caller has too many open or the upgrade fails
+func (s *sockets) accept(w http.ResponseWriter, r *http.Request, endpoint string) (*socket, bool) {
+	user := requestUserID(r)
+
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	if s.config.MaxPerUser > 0 && s.perUser[user] >= s.config.MaxPerUser {
+		s.mu.Unlock()
+		s.rejected.Add(1)
+		http.Error(w, fmt.Sprintf("Too many websockets: at most %d may be open at once", s.config.MaxPerUser), http.StatusTooManyRequests)
+		return nil, false
+	}
+	s.perUser[user]++
+	s.mu.Unlock()
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: s.origins})
+	if err != nil {
+		// Accept has answered the request
+		log.Printf("Failed to open %s stream: %v", endpoint, err)
+		s.release(nil, user)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	sk := &socket{Conn: conn, endpoint: endpoint, user: user, sockets: s, ctx: ctx, cancel: cancel}
+	sk.heard.Store(time.Now().UnixNano())
+
+	s.mu.Lock()
+	s.open[sk] = struct{}{}
+	stopping := s.stopping
+	s.mu.Unlock()
+	if stopping {
+		sk.Conn.Close(websocket.StatusGoingAway, "server shutting down; reconnect")
+	}
+
+	go sk.heartbeat()
+	return sk, true
+}
+
+// release forgets a connection, or a reservation for one if sk is nil
+func (s *sockets) release(sk *socket, user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sk != nil {
+		delete(s.open, sk)
+	}
+	if s.perUser[user]--; s.perUser[user] <= 0 {
+		delete(s.perUser, user)
+	}
+}
+
+// closeAll tells every client the server is going away, so they reconnect
+// to its replacement, and refuses new connections
+func (s *sockets) closeAll() {
+	s.mu.Lock()
+	s.stopping = true
+	open := make([]*socket, 0, len(s.open))
+	for sk := range s.open {
+		open = append(open, sk)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sk := range open {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sk.Conn.Close(websocket.StatusGoingAway, "server shutting down; reconnect")
+			sk.cancel()
+		}()
+	}
+	wg.Wait()
+	if len(open) > 0 {
+		log.Printf("Closed %d websockets", len(open))
+	}
+}
+
+// stats returns the open connections per endpoint and the counters
+func (s *sockets) stats() socketStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := socketStats{
+		Open:      make(map[string]int),
+		Rejected:  s.rejected.Load(),
+		Reaped:    s.reaped.Load(),
+		Throttled: s.throttled.Load(),
+	}
+	for sk := range s.open {
+		stats.Open[sk.endpoint]++
+	}
+	return stats
+}
+
+// close ends the connection and releases its slot. It is safe to call more
+// than once.
+func (sk *socket) close() {
+	sk.once.Do(func() {
+		sk.cancel()
+		sk.Conn.CloseNow()
+		sk.sockets.release(sk, sk.user)
+	})
+}
+
+// read reads the client's next message
+func (sk *socket) read() (websocket.MessageType, []byte, error) {
+	typ, data, err := sk.Conn.Read(sk.ctx)
+	if err == nil {
+		sk.heard.Store(time.Now().UnixNano())
+	}
+	return typ, data, err
+}
+
+// readJSON reads the client's next message as JSON into v
+func (sk *socket) readJSON(v any) error {
+	_, data, err := sk.read()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// write sends a message, giving up on a client that doesn't take it within
+// wsWriteTimeout
+func (sk *socket) write(typ websocket.MessageType, data []byte) error {
+	ctx, cancel := context.WithTimeout(sk.ctx, wsWriteTimeout)
+	defer cancel()
+	return sk.Conn.Write(ctx, typ, data)
+}
+
+// writeJSON sends v as a JSON text message
+func (sk *socket) writeJSON(v any) error {
+	ctx, cancel := context.WithTimeout(sk.ctx, wsWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, sk.Conn, v)
+}
+
+// resubscribe reports whether the connection may change its subscription
+// now, counting the change if it may
+func (sk *socket) resubscribe() bool {
+	limit := sk.sockets.config.MaxResubscribes
+	if limit <= 0 {
+		return true
+	}
+
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	now := time.Now()
+	recent := sk.resubscribes[:0]
+	for _, t := range sk.resubscribes {
+		if now.Sub(t) < resubscribeWindow {
+			recent = append(recent, t)
+		}
+	}
+	sk.resubscribes = recent
+	if len(recent) >= limit {
+		sk.sockets.throttled.Add(1)
+		return false
+	}
+	sk.resubscribes = append(sk.resubscribes, now)
+	return true
+}
+
+// heartbeat pings the client every PingInterval and closes the connection
+// once nothing has been heard from it for IdleTimeout. A connection whose
+// client went away without closing it would otherwise never end.
+func (sk *socket) heartbeat() {
+	config := sk.sockets.config
+	if config.PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sk.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		wait := wsWriteTimeout
+		if config.IdleTimeout > 0 {
+			wait = config.IdleTimeout - time.Since(time.Unix(0, sk.heard.Load()))
+		}
+		if wait > 0 {
+			ctx, cancel := context.WithTimeout(sk.ctx, wait)
+			err := sk.Conn.Ping(ctx)
+			cancel()
+			if err == nil {
+				sk.heard.Store(time.Now().UnixNano())
+				continue
+			}
+		}
+		if sk.ctx.Err() != nil {
+			return
+		}
+
+		sk.sockets.reaped.Add(1)
+		log.Printf("Closing %s stream of %s: nothing heard for %s", sk.endpoint, sk.user,
+			time.Since(time.Unix(0, sk.heard.Load())).Round(time.Second))
+		sk.Conn.Close(websocket.StatusPolicyViolation, "idle timeout")
+		sk.cancel()
+		return
+	}
+}
@@ -0,0 +1,295 @@
+package alpaca
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/fixture"
+	"desk/internal/orders"
+)
+
+// These tests hold the client to Alpaca's API as the recorded fixture
+// serves it: the requests it makes, the responses it decodes and the
+// errors it returns.
+
+func newFixture(t *testing.T) (*fixture.Server, *Client, *httptest.Server) {
+	t.Helper()
+	alpacaFixture, err := fixture.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(alpacaFixture)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient("key", "secret", server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return alpacaFixture, client, server
+}
+
+func marketOrder(symbol, side, qty string) *orders.Order {
+	return &orders.Order{
+		Symbol:      symbol,
+		Qty:         decimal.RequireFromString(qty),
+		Side:        side,
+		Type:        "market",
+		TimeInForce: "day",
+	}
+}
+
+func limitOrder(symbol, side, qty, price string) *orders.Order {
+	order := marketOrder(symbol, side, qty)
+	order.Type = "limit"
+	limit := decimal.RequireFromString(price)
+	order.LimitPrice = &limit
+	return order
+}
+
+// apiStatus returns the HTTP status of an Alpaca API error, or 0
+func apiStatus(err error) int {
+	var apiErr *alpaca.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+func TestContractAccount(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	account, err := client.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccountNumber != "PA37FIXTURE1" || account.Status != "ACTIVE" || !account.Cash.Equal(decimal.RequireFromString("90651.47")) {
+		t.Errorf("account = %+v", account)
+	}
+
+	positions, err := client.Positions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 2 || positions[0].Symbol != "AAPL" || !positions[0].Qty.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("positions = %+v", positions)
+	}
+}
+
+func TestContractOrderLifecycle(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	// A market order fills at once at the recorded price
+	filled, err := client.PlaceOrder(marketOrder("AAPL", "buy", "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled.Status != "filled" || !filled.FilledQty.Equal(decimal.NewFromInt(5)) || !filled.FilledAvgPrice.Equal(decimal.RequireFromString("187.25")) {
+		t.Errorf("market order = %+v", filled)
+	}
+	positions, err := client.Positions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !positions[0].Qty.Equal(decimal.NewFromInt(55)) {
+		t.Errorf("AAPL position = %s, want 55", positions[0].Qty)
+	}
+
+	// A limit below the market rests, and replacing it at the market fills
+	resting, err := client.PlaceOrder(limitOrder("MSFT", "buy", "10", "400"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resting.Status != "new" {
+		t.Fatalf("resting limit order status = %s, want new", resting.Status)
+	}
+	open, err := client.OpenOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].ID != resting.ID {
+		t.Errorf("open orders = %+v, want the resting one", open)
+	}
+	limit := decimal.RequireFromString("420")
+	replacement, err := client.ReplaceOrder(resting.ID, alpaca.ReplaceOrderRequest{LimitPrice: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacement.Status != "filled" || replacement.Replaces == nil || *replacement.Replaces != resting.ID {
+		t.Errorf("replacement = %+v", replacement)
+	}
+	replaced, err := client.GetOrder(resting.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.Status != "replaced" || replaced.ReplacedBy == nil || *replaced.ReplacedBy != replacement.ID {
+		t.Errorf("replaced order = %+v", replaced)
+	}
+
+	// An open order can be canceled once
+	resting, err = client.PlaceOrder(limitOrder("MSFT", "sell", "10", "450"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CancelOrder(resting.ID); err != nil {
+		t.Fatal(err)
+	}
+	if canceled, err := client.GetOrder(resting.ID); err != nil || canceled.Status != "canceled" {
+		t.Errorf("canceled order = %+v, %v", canceled, err)
+	}
+	if err := client.CancelOrder(resting.ID); apiStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("canceling twice: %v, want 422", err)
+	}
+	if _, err := client.GetOrder("no-such-order"); apiStatus(err) != http.StatusNotFound {
+		t.Errorf("unknown order: %v, want 404", err)
+	}
+}
+
+func TestContractOrderRejected(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		scenario string
+		order    *orders.Order
+		status   int
+	}{
+		{name: "unknown symbol", order: marketOrder("ZZZZ", "buy", "1"), status: http.StatusUnprocessableEntity},
+		{name: "no limit price", order: &orders.Order{Symbol: "AAPL", Qty: decimal.NewFromInt(1), Side: "buy", Type: "limit", TimeInForce: "day"}, status: http.StatusUnprocessableEntity},
+		{name: "insufficient buying power", order: marketOrder("NVDA", "buy", "1000"), status: http.StatusForbidden},
+		{name: "rejected by scenario", scenario: "reject-orders", order: marketOrder("AAPL", "buy", "1"), status: http.StatusForbidden},
+		{name: "outage", scenario: "outage", order: marketOrder("AAPL", "buy", "1"), status: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			alpacaFixture, client, _ := newFixture(t)
+			if tc.scenario != "" {
+				sc, err := fixture.Named(tc.scenario)
+				if err != nil {
+					t.Fatal(err)
+				}
+				alpacaFixture.Inject(sc)
+			}
+
+			placed, err := client.PlaceOrder(tc.order)
+			if apiStatus(err) != tc.status {
+				t.Errorf("got %+v, %v; want HTTP %d", placed, err, tc.status)
+			}
+		})
+	}
+}
+
+func TestContractDuplicateClientOrderID(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	order := marketOrder("AAPL", "buy", "1")
+	order.ClientOrderID = "dup-1"
+	if _, err := client.PlaceOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PlaceOrder(order); apiStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("resent order: %v, want 422", err)
+	}
+}
+
+func TestContractRateLimitRetried(t *testing.T) {
+	alpacaFixture, client, _ := newFixture(t)
+
+	// Alpaca's client waits and retries a rate-limited request
+	sc, err := fixture.Named("rate-limited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Times = 1
+	alpacaFixture.Inject(sc)
+	if _, err := client.Account(); err != nil {
+		t.Errorf("rate limited once: %v", err)
+	}
+}
+
+func TestContractDividends(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	activities, err := client.Dividends(time.Date(2026, 2, 13, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 2 || activities[0].ActivityType != "DIV" || activities[1].ActivityType != "DIVNRA" {
+		t.Fatalf("activities = %+v, want the DIV and its withholding", activities)
+	}
+	if !activities[0].NetAmount.Equal(decimal.NewFromInt(13)) || activities[0].Symbol != "AAPL" {
+		t.Errorf("dividend = %+v", activities[0])
+	}
+}
+
+func TestContractOrdersSince(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	before := time.Now().Add(-time.Minute)
+	filled, err := client.PlaceOrder(marketOrder("AAPL", "buy", "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resting, err := client.PlaceOrder(limitOrder("MSFT", "buy", "10", "400"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Orders in every status are listed, oldest first
+	since, err := client.OrdersSince(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(since) != 2 || since[0].ID != filled.ID || since[1].ID != resting.ID {
+		t.Errorf("orders since = %+v, want the filled then the resting one", since)
+	}
+	if later, err := client.OrdersSince(time.Now().Add(time.Minute)); err != nil || len(later) != 0 {
+		t.Errorf("orders since a minute from now = %+v, %v, want none", later, err)
+	}
+}
+
+func TestContractTradeUpdates(t *testing.T) {
+	_, client, _ := newFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan alpaca.TradeUpdate, 10)
+	go client.StreamTradeUpdates(ctx, time.Time{}, func(u alpaca.TradeUpdate) { updates <- u })
+
+	placed, err := client.PlaceOrder(marketOrder("AAPL", "buy", "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"new", "fill"} {
+		select {
+		case u := <-updates:
+			if u.Event != want || u.Order.ID != placed.ID {
+				t.Fatalf("got %s for %s, want %s for %s", u.Event, u.Order.ID, want, placed.ID)
+			}
+			if want == "fill" && (!u.Price.Equal(decimal.RequireFromString("187.25")) || !u.PositionQty.Equal(decimal.NewFromInt(55))) {
+				t.Errorf("fill = %+v", u)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+}
+
+func TestContractLatestTrade(t *testing.T) {
+	_, _, server := newFixture(t)
+	data := NewDataClient("key", "secret", server.URL, server.Client())
+
+	price, at, err := data.LatestTrade("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !price.Equal(decimal.RequireFromString("187.25")) || time.Since(at) > time.Minute {
+		t.Errorf("latest trade = %s at %s", price, at)
+	}
+	if _, _, err := data.LatestTrade("ZZZZ"); err == nil {
+		t.Error("latest trade in a symbol that hasn't traded succeeded")
+	}
+}
@@ -0,0 +1,219 @@
+package alpaca
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+	"github.com/shopspring/decimal"
+)
+
+type DataClient struct {
+	mdClient  *marketdata.Client
+	apiKey    string
+	apiSecret string
+}
+
+// NewDataClient creates a market data client. An empty baseURL is Alpaca's
+// data API, and a nil httpClient uses Alpaca's default.
+func NewDataClient(apiKey, apiSecret, baseURL string, httpClient *http.Client) *DataClient {
+	mdClient := marketdata.NewClient(marketdata.ClientOpts{
+		APIKey:     apiKey,
+		APISecret:  apiSecret,
+		BaseURL:    baseURL,
+		HTTPClient: httpClient,
+	})
+
+	return &DataClient{
+		mdClient:  mdClient,
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+	}
+}
+
+// LatestPrice returns the price of the most recent trade in symbol
+func (d *DataClient) LatestPrice(symbol string) (decimal.Decimal, error) {
+	price, _, err := d.LatestTrade(symbol)
+	return price, err
+}
+
+// LatestTrade returns the price and time of the most recent trade in symbol
+func (d *DataClient) LatestTrade(symbol string) (decimal.Decimal, time.Time, error) {
+	trade, err := d.mdClient.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{})
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+	if trade == nil {
+		return decimal.Zero, time.Time{}, fmt.Errorf("no trades in %s", symbol)
+	}
+
+	return decimal.NewFromFloat(trade.Price), trade.Timestamp, nil
+}
+
+// LatestTrades returns the most recent trade in each of symbols in one
+// request. Symbols that haven't traded are left out.
+func (d *DataClient) LatestTrades(symbols []string) (map[string]marketdata.Trade, error) {
+	return d.mdClient.GetLatestTrades(symbols, marketdata.GetLatestTradeRequest{})
+}
+
+// OptionMid returns the midpoint of the latest quote for an option contract,
+// or the side that is quoted if only one is
+func (d *DataClient) OptionMid(symbol string) (decimal.Decimal, error) {
+	quote, err := d.mdClient.GetLatestOptionQuote(symbol, marketdata.GetLatestOptionQuoteRequest{})
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	bid, ask := decimal.NewFromFloat(quote.BidPrice), decimal.NewFromFloat(quote.AskPrice)
+	switch {
+	case bid.IsPositive() && ask.IsPositive():
+		return bid.Add(ask).Div(decimal.NewFromInt(2)), nil
+	case ask.IsPositive():
+		return ask, nil
+	case bid.IsPositive():
+		return bid, nil
+	}
+	return decimal.Zero, fmt.Errorf("no quote for %s", symbol)
+}
+
+// CheckFeed fetches the latest trade in symbol from feed (iex or sip), failing
+// if the account isn't entitled to it
+func (d *DataClient) CheckFeed(symbol, feed string) error {
+	_, err := d.mdClient.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{Feed: feed})
+	return err
+}
+
+// StreamTradingStatus subscribes to halt, resume and LULD band messages for
+// every symbol on feed and blocks until ctx is cancelled or the stream gives
+// up reconnecting. Halts across all venues are only reported on the SIP
+// feed.
+func (d *DataClient) StreamTradingStatus(ctx context.Context, feed string, onStatus func(stream.TradingStatus), onLULD func(stream.LULD)) error {
+	client := stream.NewStocksClient(feed,
+		stream.WithCredentials(d.apiKey, d.apiSecret),
+		stream.WithStatuses(onStatus, "*"),
+		stream.WithLULDs(onLULD, "*"),
+	)
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		<-client.Terminated()
+		return nil
+	case err := <-client.Terminated():
+		return err
+	}
+}
+
+// StreamBarsAndQuotes subscribes to minute bars, and quotes unless onQuote
+// is nil, of symbols on feed and blocks until ctx is cancelled or the stream
+// gives up reconnecting
+func (d *DataClient) StreamBarsAndQuotes(ctx context.Context, feed string, symbols []string, onBar func(stream.Bar), onQuote func(stream.Quote)) error {
+	opts := []stream.StockOption{
+		stream.WithCredentials(d.apiKey, d.apiSecret),
+		stream.WithBars(onBar, symbols...),
+	}
+	if onQuote != nil {
+		opts = append(opts, stream.WithQuotes(onQuote, symbols...))
+	}
+	client := stream.NewStocksClient(feed, opts...)
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		<-client.Terminated()
+		return nil
+	case err := <-client.Terminated():
+		return err
+	}
+}
+
+// barLookback is how far back RecentCloses searches for bars of each
+// timeframe, long enough to span weekends and holidays
+var barLookback = map[string]struct {
+	timeFrame marketdata.TimeFrame
+	perBar    time.Duration
+	minimum   time.Duration
+}{
+	"1Min":  {marketdata.OneMin, time.Minute, 5 * 24 * time.Hour},
+	"1Hour": {marketdata.OneHour, time.Hour, 10 * 24 * time.Hour},
+	"1Day":  {marketdata.OneDay, 24 * time.Hour, 30 * 24 * time.Hour},
+}
+
+// SupportedTimeframe reports whether RecentCloses and Bars accept timeframe
+func SupportedTimeframe(timeframe string) bool {
+	_, ok := barLookback[timeframe]
+	return ok
+}
+
+// RecentCloses returns up to n of the most recent bar closes for symbol,
+// oldest first. timeframe is one of 1Min, 1Hour or 1Day.
+func (d *DataClient) RecentCloses(symbol, timeframe string, n int) ([]decimal.Decimal, error) {
+	lookback, ok := barLookback[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+
+	// Bars only exist while the market is open, so search back about twice
+	// as far as n bars would take
+	span := max(lookback.minimum, 2*time.Duration(n)*lookback.perBar)
+	bars, err := d.mdClient.GetBars(symbol, marketdata.GetBarsRequest{
+		TimeFrame:  lookback.timeFrame,
+		Start:      time.Now().Add(-span),
+		TotalLimit: n,
+		Sort:       marketdata.SortDesc,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	closes := make([]decimal.Decimal, len(bars))
+	for i, bar := range bars {
+		closes[i] = decimal.NewFromFloat(bar.Close)
+	}
+	slices.Reverse(closes)
+	return closes, nil
+}
+
+// Bars returns split-adjusted bars of symbol between start and end, oldest
+// first, at most limit of them. timeframe is one of 1Min, 1Hour or 1Day.
+func (d *DataClient) Bars(symbol, timeframe string, start, end time.Time, limit int) ([]marketdata.Bar, error) {
+	lookback, ok := barLookback[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+	return d.mdClient.GetBars(symbol, marketdata.GetBarsRequest{
+		TimeFrame:  lookback.timeFrame,
+		Adjustment: marketdata.Split,
+		Start:      start,
+		End:        end,
+		TotalLimit: limit,
+	})
+}
+
+// News returns headlines updated since the given time, oldest first
+func (d *DataClient) News(since time.Time, limit int) ([]marketdata.News, error) {
+	return d.mdClient.GetNews(marketdata.GetNewsRequest{
+		Start:      since,
+		End:        time.Now(),
+		Sort:       marketdata.SortAsc,
+		TotalLimit: limit,
+	})
+}
+
+// DailyBars returns split-adjusted daily bars since the given time for each
+// of symbols, oldest first, in as few requests as possible
+func (d *DataClient) DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error) {
+	return d.mdClient.GetMultiBars(symbols, marketdata.GetBarsRequest{
+		TimeFrame:  marketdata.OneDay,
+		Adjustment: marketdata.Split,
+		Start:      since,
+	})
+}
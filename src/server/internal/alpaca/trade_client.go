@@ -1,20 +1,27 @@
 package alpaca
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
-	"github.com/shopspring/decimal"
-	orderprotos "desk/internal/protos/orders"
+
+	"desk/internal/orders"
 )
 
 type Client struct {
 	tradeClient *alpaca.Client
 }
 
-func NewClient(apiKey, apiSecret, baseUrl string) (*Client, error) {
+// NewClient connects to an Alpaca account. A nil httpClient uses Alpaca's
+// default.
+func NewClient(apiKey, apiSecret, baseUrl string, httpClient *http.Client) (*Client, error) {
 	tradeClient := alpaca.NewClient(alpaca.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		BaseURL:   baseUrl,
+		APIKey:     apiKey,
+		APISecret:  apiSecret,
+		BaseURL:    baseUrl,
+		HTTPClient: httpClient,
 	})
 	_, err := tradeClient.GetAccount()
 
@@ -23,42 +30,146 @@ func NewClient(apiKey, apiSecret, baseUrl string) (*Client, error) {
 	}, err
 }
 
-func (c *Client) PlaceOrder(orderReq *orderprotos.OrderRequest) (*alpaca.Order, error) {
-	qtyDecimal, err := decimal.NewFromString(orderReq.GetQty())
+// PlaceOrder submits a validated order to Alpaca
+func (c *Client) PlaceOrder(order *orders.Order) (*alpaca.Order, error) {
+	qty := order.Qty
+	placeOrderRequest := alpaca.PlaceOrderRequest{
+		Symbol:      order.Symbol,
+		Qty:         &qty,
+		Side:        alpaca.Side(order.Side),
+		Type:        alpaca.OrderType(order.Type),
+		TimeInForce: alpaca.TimeInForce(order.TimeInForce),
+		LimitPrice:  order.LimitPrice,
+		StopPrice:   order.StopPrice,
+
+		ExtendedHours: order.ExtendedHours,
+		// Alpaca generates one if it is empty
+		ClientOrderID: order.ClientOrderID,
+	}
+
+	placedOrder, err := c.tradeClient.PlaceOrder(placeOrderRequest)
 	if err != nil {
 		return nil, err
 	}
 
-	placeOrderRequest := alpaca.PlaceOrderRequest{
-		Symbol:      orderReq.GetSymbol(),
-		Qty:         &qtyDecimal,
-		Side:        alpaca.Side(orderReq.GetSide()),
-		Type:        alpaca.OrderType(orderReq.GetOrderType()),
-		TimeInForce: alpaca.TimeInForce(orderReq.GetTimeInForce()),
-	}
+	return placedOrder, nil
+}
 
-	// Add limit price if provided
-	if limitPrice := orderReq.GetLimitPrice(); limitPrice != "" {
-		limitPriceDecimal, err := decimal.NewFromString(limitPrice)
+// Account returns the current Alpaca account state
+func (c *Client) Account() (*alpaca.Account, error) {
+	return c.tradeClient.GetAccount()
+}
+
+// Positions returns all open positions held in the Alpaca account
+func (c *Client) Positions() ([]alpaca.Position, error) {
+	return c.tradeClient.GetPositions()
+}
+
+// OpenOrders returns all orders that have not reached a terminal state
+func (c *Client) OpenOrders() ([]alpaca.Order, error) {
+	return c.tradeClient.GetOrders(alpaca.GetOrdersRequest{
+		Status: "open",
+		Limit:  500,
+	})
+}
+
+// OrdersSince returns every order submitted after the given time, in any
+// status and oldest first, following Alpaca's pages
+func (c *Client) OrdersSince(after time.Time) ([]alpaca.Order, error) {
+	const pageSize = 500
+	var all []alpaca.Order
+	req := alpaca.GetOrdersRequest{
+		Status:    "all",
+		Limit:     pageSize,
+		After:     after,
+		Direction: "asc",
+	}
+	for {
+		page, err := c.tradeClient.GetOrders(req)
 		if err != nil {
 			return nil, err
 		}
-		placeOrderRequest.LimitPrice = &limitPriceDecimal
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+		req.After = page[len(page)-1].SubmittedAt
 	}
+}
 
-	// Add stop price if provided
-	if stopPrice := orderReq.GetStopPrice(); stopPrice != "" {
-		stopPriceDecimal, err := decimal.NewFromString(stopPrice)
+// GetOrder returns the broker's current view of an order
+func (c *Client) GetOrder(orderID string) (*alpaca.Order, error) {
+	return c.tradeClient.GetOrder(orderID)
+}
+
+// CancelOrder asks Alpaca to cancel an open order
+func (c *Client) CancelOrder(orderID string) error {
+	return c.tradeClient.CancelOrder(orderID)
+}
+
+// ReplaceOrder replaces an open order; Alpaca returns the new order
+func (c *Client) ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error) {
+	return c.tradeClient.ReplaceOrder(orderID, req)
+}
+
+// dividendActivities are the account activity types that pay or withhold
+// dividends: ordinary and capital gain distributions, return of capital,
+// and the fees and taxes withheld from them
+var dividendActivities = []string{"DIV", "DIVCGL", "DIVCGS", "DIVROC", "DIVTXEX", "DIVFEE", "DIVFT", "DIVNRA", "DIVTW"}
+
+// Dividends returns the dividend activities posted to the account on date,
+// following Alpaca's pages
+func (c *Client) Dividends(date time.Time) ([]alpaca.AccountActivity, error) {
+	const pageSize = 100
+	var activities []alpaca.AccountActivity
+	req := alpaca.GetAccountActivitiesRequest{
+		ActivityTypes: dividendActivities,
+		Date:          time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Direction:     "asc",
+		PageSize:      pageSize,
+	}
+	for {
+		page, err := c.tradeClient.GetAccountActivities(req)
 		if err != nil {
 			return nil, err
 		}
-		placeOrderRequest.StopPrice = &stopPriceDecimal
+		activities = append(activities, page...)
+		if len(page) < pageSize {
+			return activities, nil
+		}
+		req.PageToken = page[len(page)-1].ID
 	}
+}
 
-	placedOrder, err := c.tradeClient.PlaceOrder(placeOrderRequest)
+// CreateWatchlist creates an Alpaca watchlist and returns its ID
+func (c *Client) CreateWatchlist(name string, symbols []string) (string, error) {
+	wl, err := c.tradeClient.CreateWatchlist(alpaca.CreateWatchlistRequest{
+		Name:    name,
+		Symbols: symbols,
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return wl.ID, nil
+}
 
-	return placedOrder, nil
-}
\ No newline at end of file
+// UpdateWatchlist replaces an Alpaca watchlist's name and symbols
+func (c *Client) UpdateWatchlist(watchlistID, name string, symbols []string) error {
+	_, err := c.tradeClient.UpdateWatchlist(watchlistID, alpaca.UpdateWatchlistRequest{
+		Name:    name,
+		Symbols: symbols,
+	})
+	return err
+}
+
+// DeleteWatchlist deletes an Alpaca watchlist
+func (c *Client) DeleteWatchlist(watchlistID string) error {
+	return c.tradeClient.DeleteWatchlist(watchlistID)
+}
+
+// StreamTradeUpdates calls handler with the account's order events from
+// since (or from now, if since is zero) and blocks until ctx is cancelled
+// or the stream fails
+func (c *Client) StreamTradeUpdates(ctx context.Context, since time.Time, handler func(alpaca.TradeUpdate)) error {
+	return c.tradeClient.StreamTradeUpdates(ctx, handler, alpaca.StreamTradeUpdatesRequest{Since: since})
+}
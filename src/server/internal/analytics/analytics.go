@@ -0,0 +1,245 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/storage"
+)
+
+// Tables are the datasets in the object store that queries can read, by
+// table name and key prefix
+var Tables = []struct {
+	Name   string
+	Prefix string
+}{
+	{Name: "position_marks", Prefix: "archive/position_marks/"},
+	{Name: "research_trades", Prefix: "exports/research/"},
+	{Name: "audit_orders", Prefix: "exports/audit/"},
+}
+
+// ErrSnapshot is returned by Query when the snapshot can't be built from
+// the store
+var ErrSnapshot = errors.New("analytics snapshot unavailable")
+
+// typeCandidates are the types CSV columns are detected as. Prices and
+// amounts load as exact decimals rather than floats.
+const typeCandidates = "['BOOLEAN', 'BIGINT', 'DECIMAL(38, 10)', 'TIMESTAMP', 'DATE', 'VARCHAR']"
+
+// readOnlyOptions open a snapshot that can't be written, can't read files
+// or the network, and can't have those settings changed by a query
+const readOnlyOptions = "?access_mode=read_only&enable_external_access=false" +
+	"&autoinstall_known_extensions=false&autoload_known_extensions=false&lock_configuration=true"
+
+// Engine answers read-only SQL over the archive with an embedded DuckDB.
+// It copies the archived files out of the object store into a scratch
+// directory, loads them into a DuckDB snapshot and queries that, so
+// analytical scans never touch the trading database. The snapshot is
+// rebuilt when it is older than the refresh interval; only files new to
+// the store are downloaded.
+type Engine struct {
+	store   storage.Store
+	dir     string
+	refresh time.Duration
+
+	mu       sync.RWMutex
+	db       *sql.DB
+	file     string
+	loadedAt time.Time
+	builds   int
+}
+
+// NewEngine returns an engine reading store, keeping its copies and
+// snapshots in dir
+func NewEngine(store storage.Store, dir string, refresh time.Duration) *Engine {
+	return &Engine{store: store, dir: dir, refresh: refresh}
+}
+
+// Query runs sql against the current snapshot and returns up to limit rows
+// starting at offset. Exact decimals are returned as decimals.
+func (e *Engine) Query(ctx context.Context, query string, offset, limit int) (*database.QueryResult, error) {
+	if err := e.ensure(ctx); err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rows, err := e.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	result, err := database.ReadRows(rows, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range result.Rows {
+		for i, v := range row {
+			if d, ok := v.(duckdb.Decimal); ok {
+				row[i] = decimal.NewFromBigInt(d.Value, -int32(d.Scale))
+			}
+		}
+	}
+	return result, nil
+}
+
+// LoadedAt returns when the current snapshot was built, or the zero time
+// before the first query
+func (e *Engine) LoadedAt() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.loadedAt
+}
+
+// ensure rebuilds the snapshot if there is none or it is stale
+func (e *Engine) ensure(ctx context.Context) error {
+	e.mu.RLock()
+	fresh := e.db != nil && time.Since(e.loadedAt) < e.refresh
+	e.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.db != nil && time.Since(e.loadedAt) < e.refresh {
+		return nil
+	}
+	if err := e.rebuild(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshot, err)
+	}
+	return nil
+}
+
+// rebuild syncs the scratch copies with the store, loads them into a new
+// snapshot and swaps it in. The caller holds the write lock.
+func (e *Engine) rebuild(ctx context.Context) error {
+	files := make(map[string]int)
+	for _, t := range Tables {
+		n, err := e.sync(ctx, t.Name, t.Prefix)
+		if err != nil {
+			return err
+		}
+		files[t.Name] = n
+	}
+
+	e.builds++
+	file := filepath.Join(e.dir, fmt.Sprintf("snapshot-%d.duckdb", e.builds))
+	if err := e.load(ctx, file, files); err != nil {
+		os.Remove(file)
+		return err
+	}
+
+	db, err := sql.Open("duckdb", file+readOnlyOptions)
+	if err != nil {
+		os.Remove(file)
+		return fmt.Errorf("failed to open analytics snapshot: %w", err)
+	}
+	if e.db != nil {
+		e.db.Close()
+		os.Remove(e.file)
+		os.Remove(e.file + ".wal")
+	}
+	e.db, e.file, e.loadedAt = db, file, time.Now()
+	log.Printf("Loaded analytics snapshot: %d position mark, %d research and %d audit files",
+		files["position_marks"], files["research_trades"], files["audit_orders"])
+	return nil
+}
+
+// sync makes dir/table hold a copy of every object under prefix, fetching
+// only the ones it doesn't have, and returns how many there are
+func (e *Engine) sync(ctx context.Context, table, prefix string) (int, error) {
+	dir := filepath.Join(e.dir, table)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return 0, err
+	}
+	keys, err := e.store.List(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	want := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		name := path.Base(key)
+		if !strings.HasSuffix(name, ".csv") && !strings.HasSuffix(name, ".csv.gz") {
+			continue
+		}
+		want[name] = true
+		local := filepath.Join(dir, name)
+		if _, err := os.Stat(local); err == nil {
+			continue
+		}
+		data, err := e.store.Get(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch %s: %w", key, err)
+		}
+		if err := os.WriteFile(local, data, 0o600); err != nil {
+			return 0, err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if !want[entry.Name()] {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return 0, err
+			}
+		}
+	}
+	return len(want), nil
+}
+
+// load builds a snapshot at file with a table for every dataset that has
+// files. Datasets with none have no table, so a query on one fails rather
+// than quietly returning nothing.
+func (e *Engine) load(ctx context.Context, file string, files map[string]int) error {
+	db, err := sql.Open("duckdb", file)
+	if err != nil {
+		return fmt.Errorf("failed to create analytics snapshot: %w", err)
+	}
+	defer db.Close()
+
+	for _, t := range Tables {
+		if files[t.Name] == 0 {
+			continue
+		}
+		glob := strings.ReplaceAll(filepath.Join(e.dir, t.Name, "*"), "'", "''")
+		stmt := fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM read_csv('%s', union_by_name = true, auto_type_candidates = %s)",
+			t.Name, glob, typeCandidates)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to load %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the snapshot and removes it
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.db == nil {
+		return nil
+	}
+	err := e.db.Close()
+	os.Remove(e.file)
+	e.db = nil
+	return err
+}
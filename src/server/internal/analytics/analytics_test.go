@@ -0,0 +1,119 @@
+package analytics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/storage"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newEngine(t *testing.T, refresh time.Duration) (*Engine, storage.Store) {
+	t.Helper()
+	store := storage.NewDisk(t.TempDir())
+	ctx := context.Background()
+	store.Put(ctx, "archive/position_marks/2026-03-02.csv.gz", gzipped(t,
+		"marked_at,user_id,strategy_id,symbol,qty,avg_cost,price,unrealized_pl\n"+
+			"2026-03-02T15:00:00Z,alice,1,AAPL,10,150.00,155.25,52.50\n"+
+			"2026-03-02T15:00:00Z,bob,,MSFT,5,400.00,390.00,-50.00\n"))
+	store.Put(ctx, "archive/position_marks/2026-03-03.csv.gz", gzipped(t,
+		"marked_at,user_id,strategy_id,symbol,qty,avg_cost,price,unrealized_pl\n"+
+			"2026-03-03T15:00:00Z,alice,1,AAPL,10,150.00,157.00,70.00\n"))
+
+	e := NewEngine(store, t.TempDir(), refresh)
+	t.Cleanup(func() { e.Close() })
+	return e, store
+}
+
+func TestQueryArchive(t *testing.T) {
+	e, _ := newEngine(t, time.Hour)
+
+	result, err := e.Query(context.Background(),
+		"SELECT symbol, count(*) AS marks, sum(unrealized_pl) AS pl FROM position_marks GROUP BY symbol ORDER BY symbol", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("rows = %v, want 2", result.Rows)
+	}
+	row := result.Rows[0]
+	if row[0] != "AAPL" || row[1] != int64(2) {
+		t.Errorf("first row = %v, want AAPL with 2 marks", row)
+	}
+	if pl, ok := row[2].(decimal.Decimal); !ok || !pl.Equal(decimal.RequireFromString("122.50")) {
+		t.Errorf("AAPL P&L = %#v, want decimal 122.50", row[2])
+	}
+
+	result, err = e.Query(context.Background(), "SELECT * FROM position_marks ORDER BY marked_at", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.NextOffset == nil || *result.NextOffset != 2 {
+		t.Errorf("page = %v next %v, want 1 row and next offset 2", result.Rows, result.NextOffset)
+	} else if at, ok := result.Rows[0][0].(time.Time); !ok || !at.Equal(time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("marked_at = %#v, want 2026-03-02 15:00 UTC", result.Rows[0][0])
+	}
+}
+
+func TestQueryReadOnly(t *testing.T) {
+	e, _ := newEngine(t, time.Hour)
+	secret := filepath.Join(t.TempDir(), "secret.csv")
+	os.WriteFile(secret, []byte("key\nhunter2\n"), 0o600)
+
+	for _, query := range []string{
+		"DELETE FROM position_marks",
+		"DROP TABLE position_marks",
+		"CREATE TABLE scratch (x INTEGER)",
+		"SELECT * FROM read_csv('" + secret + "')",
+		"COPY position_marks TO '" + filepath.Join(t.TempDir(), "out.csv") + "'",
+		"ATTACH '" + filepath.Join(t.TempDir(), "other.duckdb") + "'",
+		"SET enable_external_access = true",
+		"INSTALL httpfs",
+	} {
+		if _, err := e.Query(context.Background(), query, 0, 10); err == nil {
+			t.Errorf("%s succeeded, want it refused", query)
+		}
+	}
+
+	result, err := e.Query(context.Background(), "SELECT count(*) FROM position_marks", 0, 10)
+	if err != nil || result.Rows[0][0] != int64(3) {
+		t.Errorf("marks after refused writes = %v, %v; want 3", result, err)
+	}
+}
+
+func TestQueryRefresh(t *testing.T) {
+	e, store := newEngine(t, 0)
+	ctx := context.Background()
+
+	if _, err := e.Query(ctx, "SELECT * FROM research_trades", 0, 10); err == nil {
+		t.Error("query of a dataset with no files succeeded")
+	}
+
+	store.Put(ctx, "exports/research/trades-20260304T000000Z.csv", []byte("user,symbol,side\nu1,AAPL,buy\nu2,MSFT,sell\n"))
+	store.Delete(ctx, "archive/position_marks/2026-03-02.csv.gz")
+
+	result, err := e.Query(ctx, "SELECT (SELECT count(*) FROM research_trades), (SELECT count(*) FROM position_marks)", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows[0][0] != int64(2) || result.Rows[0][1] != int64(1) {
+		t.Errorf("counts = %v, want 2 research trades and 1 mark", result.Rows[0])
+	}
+}
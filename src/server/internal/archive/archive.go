@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/storage"
+)
+
+// markColumns is the header of an archived day of position marks
+var markColumns = []string{
+	"marked_at", "user_id", "strategy_id", "symbol", "qty", "avg_cost", "price", "unrealized_pl",
+}
+
+// Archiver moves position marks older than the retention window out of the
+// database into a store, one gzipped CSV per session, instead of deleting
+// them
+type Archiver struct {
+	db        *database.DB
+	store     storage.Store
+	retention time.Duration
+}
+
+func NewArchiver(db *database.DB, store storage.Store, retention time.Duration) *Archiver {
+	return &Archiver{db: db, store: store, retention: retention}
+}
+
+// Archive stores every whole session of marks older than the retention
+// window, then deletes them. Marks are only deleted once all of them are
+// stored, so a failed run is retried in full by the next one. It returns the
+// number of sessions archived.
+func (a *Archiver) Archive(ctx context.Context) (int, error) {
+	cutoff := market.SessionDate(time.Now().Add(-a.retention))
+	end, err := time.ParseInLocation("2006-01-02", cutoff, market.Exchange)
+	if err != nil {
+		return 0, err
+	}
+
+	times, err := a.db.GetPositionMarkTimes(time.Time{}, end.Add(-time.Nanosecond))
+	if err != nil {
+		return 0, err
+	}
+	var dates []string
+	byDate := make(map[string][]time.Time)
+	for _, t := range times {
+		date := market.SessionDate(t)
+		if _, ok := byDate[date]; !ok {
+			dates = append(dates, date)
+		}
+		byDate[date] = append(byDate[date], t)
+	}
+
+	for _, date := range dates {
+		marks, err := a.db.GetPositionMarksAt(byDate[date])
+		if err != nil {
+			return 0, err
+		}
+		data, err := marksCSV(marks)
+		if err != nil {
+			return 0, err
+		}
+		if err := a.store.Put(ctx, "position_marks/"+date+".csv.gz", data); err != nil {
+			return 0, err
+		}
+		log.Printf("Archived %d position marks of %s", len(marks), date)
+	}
+
+	if len(dates) == 0 {
+		return 0, nil
+	}
+	if _, err := a.db.DeletePositionMarksBefore(end); err != nil {
+		return 0, err
+	}
+	return len(dates), nil
+}
+
+// marksCSV writes marks as a gzipped CSV
+func marksCSV(marks []database.PositionMark) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	out := csv.NewWriter(zw)
+	out.Write(markColumns)
+	for _, m := range marks {
+		out.Write([]string{
+			m.MarkedAt.UTC().Format(time.RFC3339Nano),
+			m.UserID,
+			strconv.FormatInt(m.StrategyID, 10),
+			m.Symbol,
+			m.Qty.String(),
+			m.AvgCost.String(),
+			m.Price.String(),
+			m.UnrealizedPL.String(),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write archived marks: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archived marks: %w", err)
+	}
+	return buf.Bytes(), nil
+}
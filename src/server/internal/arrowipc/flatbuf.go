@@ -0,0 +1,152 @@
+package arrowipc
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// builder writes the small subset of FlatBuffers the Arrow message headers
+// need. Objects are written front to back: a table's offset slots are
+// reserved when the table is written and patched once the object they point
+// to has been written after it, since FlatBuffers offsets point forward.
+type builder struct {
+	buf []byte
+}
+
+// slot is the position of a reserved offset to be patched
+type slot int
+
+// field is one member of a table: a little-endian scalar, or an offset to
+// an object written later
+type field struct {
+	id     int
+	scalar []byte
+	offset bool
+}
+
+func u8(id int, v uint8) field { return field{id: id, scalar: []byte{v}} }
+
+func i16(id int, v int16) field {
+	return field{id: id, scalar: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func i32(id int, v int32) field {
+	return field{id: id, scalar: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func i64(id int, v int64) field {
+	return field{id: id, scalar: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+func boolean(id int, v bool) field {
+	if v {
+		return u8(id, 1)
+	}
+	return u8(id, 0)
+}
+
+func ref(id int) field { return field{id: id, offset: true} }
+
+func (b *builder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// root reserves the buffer's root table offset
+func (b *builder) root() slot {
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	return 0
+}
+
+// patch points s at the object starting at pos
+func (b *builder) patch(s slot, pos int) {
+	binary.LittleEndian.PutUint32(b.buf[s:], uint32(pos-int(s)))
+}
+
+// table writes a table with its vtable in front of it. It returns the
+// table's position and the slots of its offset fields, by field id.
+func (b *builder) table(fields ...field) (int, map[int]slot) {
+	// Lay the fields out largest first so each is aligned within the table
+	sorted := append([]field(nil), fields...)
+	sort.SliceStable(sorted, func(i, j int) bool { return size(sorted[i]) > size(sorted[j]) })
+	offsets := make(map[int]int, len(fields))
+	pos, slots := 4, 0
+	for _, f := range sorted {
+		n := size(f)
+		for pos%n != 0 {
+			pos++
+		}
+		offsets[f.id] = pos
+		pos += n
+		slots = max(slots, f.id+1)
+	}
+
+	b.pad(2)
+	vtable := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*slots))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(pos))
+	for id := 0; id < slots; id++ {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(offsets[id]))
+	}
+
+	b.pad(8)
+	start := len(b.buf)
+	b.buf = append(b.buf, make([]byte, pos)...)
+	binary.LittleEndian.PutUint32(b.buf[start:], uint32(start-vtable))
+	refs := make(map[int]slot)
+	for _, f := range fields {
+		at := start + offsets[f.id]
+		if f.offset {
+			refs[f.id] = slot(at)
+		} else {
+			copy(b.buf[at:], f.scalar)
+		}
+	}
+	return start, refs
+}
+
+func size(f field) int {
+	if f.offset {
+		return 4
+	}
+	return len(f.scalar)
+}
+
+// offsets writes a vector of n offsets and returns their slots
+func (b *builder) offsets(n int) (int, []slot) {
+	b.pad(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(n))
+	slots := make([]slot, n)
+	for i := range slots {
+		slots[i] = slot(len(b.buf))
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+	return start, slots
+}
+
+// structs writes a vector of structs of two longs each, as Arrow's
+// FieldNode and Buffer are
+func (b *builder) structs(pairs [][2]int64) int {
+	// The elements follow the 4-byte length and must be 8-byte aligned
+	b.pad(8)
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(pairs)))
+	for _, p := range pairs {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(p[0]))
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(p[1]))
+	}
+	return start
+}
+
+// str writes a string
+func (b *builder) str(s string) int {
+	b.pad(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return start
+}
@@ -0,0 +1,215 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"desk/internal/database"
+	"desk/internal/storage"
+)
+
+const (
+	FormatScript = "script"
+	FormatTarGz  = "tar.gz"
+)
+
+// Entrypoint is the script a tar.gz artifact must contain at its root
+const Entrypoint = "strategy.py"
+
+// maxExtractedBytes caps the unpacked size of a tar.gz artifact
+const maxExtractedBytes = 256 << 20
+
+var (
+	ErrInvalid  = errors.New("invalid artifact")
+	ErrChecksum = errors.New("artifact checksum mismatch")
+)
+
+// Manager stores uploaded strategy artifacts and checks versions out into a
+// working directory the runner can execute from
+type Manager struct {
+	store   storage.Store
+	workDir string
+}
+
+func NewManager(store storage.Store, workDir string) *Manager {
+	return &Manager{store: store, workDir: workDir}
+}
+
+// Detect reports the format of an uploaded artifact: gzip data is treated as
+// a tar.gz bundle and anything else as a single Python script
+func Detect(data []byte) string {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		return FormatTarGz
+	}
+	return FormatScript
+}
+
+// Put validates and stores an artifact for a strategy. The returned version
+// carries the format, checksum, size and storage key but is not yet saved.
+func (m *Manager) Put(ctx context.Context, strategyID int64, data []byte) (*database.StrategyVersion, error) {
+	format := Detect(data)
+	if format == FormatTarGz {
+		if err := validateTarGz(data); err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := sha256Hex(data)
+	ext := "py"
+	if format == FormatTarGz {
+		ext = "tar.gz"
+	}
+	key := fmt.Sprintf("strategies/%d/%s.%s", strategyID, checksum, ext)
+
+	if err := m.store.Put(ctx, key, data); err != nil {
+		return nil, err
+	}
+
+	return &database.StrategyVersion{
+		StrategyID: strategyID,
+		Format:     format,
+		Checksum:   checksum,
+		Size:       int64(len(data)),
+		StorageKey: key,
+	}, nil
+}
+
+// Checkout fetches a version, verifies its checksum and unpacks it into the
+// working directory. It returns the path of the script to run.
+func (m *Manager) Checkout(ctx context.Context, v *database.StrategyVersion) (string, error) {
+	data, err := m.store.Get(ctx, v.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	if sha256Hex(data) != v.Checksum {
+		return "", ErrChecksum
+	}
+
+	dir := filepath.Join(m.workDir, fmt.Sprintf("strategy-%d", v.StrategyID), fmt.Sprintf("v%d", v.Version))
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to clear checkout directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create checkout directory: %w", err)
+	}
+
+	script := filepath.Join(dir, Entrypoint)
+	if v.Format == FormatScript {
+		if err := os.WriteFile(script, data, 0o644); err != nil {
+			return "", fmt.Errorf("failed to write strategy script: %w", err)
+		}
+		return script, nil
+	}
+
+	if err := extractTarGz(data, dir); err != nil {
+		return "", err
+	}
+	return script, nil
+}
+
+// validateTarGz checks that a bundle unpacks safely and has an entrypoint
+func validateTarGz(data []byte) error {
+	found := false
+	err := walkTarGz(data, func(name string, hdr *tar.Header, r io.Reader) error {
+		if name == Entrypoint && hdr.Typeflag == tar.TypeReg {
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: must contain %s at its root", ErrInvalid, Entrypoint)
+	}
+	return nil
+}
+
+func extractTarGz(data []byte, dir string) error {
+	return walkTarGz(data, func(name string, hdr *tar.Header, r io.Reader) error {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(target, 0o755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, r); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}
+		return nil
+	})
+}
+
+// walkTarGz visits each entry of a bundle, rejecting links, paths that
+// escape the bundle root and bundles that unpack beyond maxExtractedBytes
+func walkTarGz(data []byte, fn func(name string, hdr *tar.Header, r io.Reader) error) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		// git archive records the commit in a pax global header
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%w: entry %q escapes the bundle", ErrInvalid, hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir:
+		default:
+			return fmt.Errorf("%w: entry %q is not a regular file or directory", ErrInvalid, hdr.Name)
+		}
+
+		total += hdr.Size
+		if total > maxExtractedBytes {
+			return fmt.Errorf("%w: unpacks to more than %d bytes", ErrInvalid, maxExtractedBytes)
+		}
+
+		if err := fn(name, hdr, tr); err != nil {
+			return fmt.Errorf("failed to extract artifact: %w", err)
+		}
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
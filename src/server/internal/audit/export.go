@@ -0,0 +1,225 @@
+// Package audit reconstructs the lifecycle of every order, from receipt
+// through routing, modifications and executions, as a CSV in the style of
+// the SEC's Consolidated Audit Trail, for periodic review by the faculty
+// advisor. Each trade's receipt, routing and acknowledgement come from the
+// trade itself; later changes come from its order events.
+package audit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/orders"
+)
+
+// Lifecycle event types
+const (
+	EventReceived = "received"
+	EventRejected = "rejected"
+	EventRouted   = "routed"
+	EventAccepted = "accepted"
+	EventModified = "modified"
+	EventFill     = "fill"
+	EventCanceled = "canceled"
+	EventStatus   = "status"
+)
+
+// catEvents maps lifecycle events to the nearest CAT event type: new order,
+// order route, order accepted, order modified, order cancelled and trade.
+// Events CAT has no type for are left blank.
+var catEvents = map[string]string{
+	EventReceived: "MENO",
+	EventRouted:   "MEOR",
+	EventAccepted: "MEOA",
+	EventModified: "MEOM",
+	EventCanceled: "MEOC",
+	EventFill:     "MEOT",
+}
+
+// Columns are the header of an audit export
+var Columns = []string{
+	"event_id", "event_type", "cat_event_type", "event_timestamp",
+	"trade_id", "broker_order_id", "client_order_id", "user_id", "strategy_id", "symbol", "side",
+	"order_type", "time_in_force", "order_qty", "limit_price", "stop_price", "venue",
+	"order_status", "fill_qty", "avg_fill_price", "cum_filled_qty", "leaves_qty", "detail",
+}
+
+// timestampFormat has microsecond precision, the resolution of the desk's
+// order timestamps
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// row is one lifecycle event of a trade
+type row struct {
+	event  string
+	at     time.Time
+	status string
+	// qty is the quantity of a fill and price the order's average fill
+	// price after it
+	qty       *decimal.Decimal
+	price     *decimal.Decimal
+	cumFilled decimal.Decimal
+	detail    string
+}
+
+// lifecycle returns a trade's events in the order they happened. events are
+// the trade's order events, oldest first.
+func lifecycle(t database.Trade, events []database.OrderEvent) []row {
+	received := t.SubmittedAt
+	if t.ReceivedAt != nil {
+		received = *t.ReceivedAt
+	}
+	rows := []row{{event: EventReceived, at: received, status: "new"}}
+
+	if t.OrderID == "" {
+		var reason string
+		if t.ErrorMessage != nil {
+			reason = *t.ErrorMessage
+		}
+		return append(rows, row{event: EventRejected, at: t.SubmittedAt, status: t.OrderStatus, detail: reason})
+	}
+
+	// The trade holds its latest state; its state when the broker acked it
+	// is the state before its first change, whose average price wasn't kept
+	status, filled, price := t.OrderStatus, t.FilledQty, t.FilledAvgPrice
+	if len(events) > 0 {
+		status, filled, price = events[0].PreviousStatus, events[0].PreviousFilledQty, nil
+	}
+
+	routed := t.SubmittedAt
+	if t.SentAt != nil {
+		routed = *t.SentAt
+	}
+	acked := routed
+	if t.AckedAt != nil {
+		acked = *t.AckedAt
+	}
+	rows = append(rows,
+		row{event: EventRouted, at: routed, status: "new", detail: "to " + t.Venue},
+		row{event: EventAccepted, at: acked, status: status},
+	)
+	if filled.IsPositive() {
+		at := acked
+		if len(events) == 0 && t.FilledAt != nil {
+			at = *t.FilledAt
+		}
+		rows = append(rows, row{event: EventFill, at: at, status: status, qty: &filled, price: price, cumFilled: filled})
+	}
+
+	for _, e := range events {
+		rows = append(rows, eventRows(e)...)
+	}
+	return rows
+}
+
+// eventRows turns an order event into lifecycle events: a fill for any
+// quantity that filled, then the change of status. A trade the desk
+// recovered from the broker is noted as a status event. Disputes of a fill
+// don't change the order and aren't reported.
+func eventRows(e database.OrderEvent) []row {
+	var detail string
+	if e.Detail != nil {
+		detail = *e.Detail
+	}
+	switch e.EventType {
+	case database.EventModified:
+		return []row{{event: EventModified, at: e.OccurredAt, status: e.OrderStatus, cumFilled: e.FilledQty, detail: detail}}
+	case database.EventRecovered:
+		return []row{{event: EventStatus, at: e.OccurredAt, status: e.OrderStatus, cumFilled: e.FilledQty, detail: detail}}
+	case database.EventDisputed, database.EventDisputeResolved:
+		return nil
+	}
+
+	var out []row
+	if delta := e.FilledQty.Sub(e.PreviousFilledQty); delta.IsPositive() {
+		out = append(out, row{event: EventFill, at: e.OccurredAt, status: e.OrderStatus, qty: &delta, price: e.FilledAvgPrice, cumFilled: e.FilledQty, detail: detail})
+	}
+	if e.OrderStatus == e.PreviousStatus {
+		return out
+	}
+
+	event := EventStatus
+	switch e.OrderStatus {
+	case "filled", "partially_filled":
+		// The fill says it
+		if len(out) > 0 {
+			return out
+		}
+	case "canceled", orders.StatusExpired, orders.StatusReplaced:
+		event = EventCanceled
+	case orders.StatusRejected:
+		event = EventRejected
+	}
+	return append(out, row{event: event, at: e.OccurredAt, status: e.OrderStatus, cumFilled: e.FilledQty, detail: detail})
+}
+
+// Export writes the lifecycle of every trade, oldest first, returning the
+// number of events written
+func Export(w io.Writer, trades []database.Trade, events map[int64][]database.OrderEvent) (int, error) {
+	out := csv.NewWriter(w)
+	out.Write(Columns)
+
+	n := 0
+	for _, t := range trades {
+		for i, r := range lifecycle(t, events[t.ID]) {
+			out.Write(record(t, i+1, r))
+			n++
+		}
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return 0, fmt.Errorf("failed to write audit export: %w", err)
+	}
+	return n, nil
+}
+
+func record(t database.Trade, seq int, r row) []string {
+	var strategy string
+	if t.StrategyID != nil {
+		strategy = strconv.FormatInt(*t.StrategyID, 10)
+	}
+
+	leaves := decimal.Zero
+	if r.event != EventRejected && !orders.IsTerminal(r.status) {
+		leaves = decimal.Max(t.Qty.Sub(r.cumFilled), decimal.Zero)
+	}
+
+	return []string{
+		fmt.Sprintf("%d-%d", t.ID, seq),
+		r.event,
+		catEvents[r.event],
+		r.at.UTC().Format(timestampFormat),
+		strconv.FormatInt(t.ID, 10),
+		t.OrderID,
+		t.ClientOrderID,
+		t.UserID,
+		strategy,
+		t.Symbol,
+		t.Side,
+		t.OrderType,
+		t.TimeInForce,
+		t.Qty.String(),
+		decimalString(t.LimitPrice),
+		decimalString(t.StopPrice),
+		t.Venue,
+		r.status,
+		decimalString(r.qty),
+		decimalString(r.price),
+		r.cumFilled.String(),
+		leaves.String(),
+		r.detail,
+	}
+}
+
+func decimalString(d *decimal.Decimal) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
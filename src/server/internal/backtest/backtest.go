@@ -0,0 +1,203 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// tradingDays annualizes daily returns
+const tradingDays = 252
+
+// ErrTooFewBars is returned when there isn't enough history to trade over
+// after the strategy's lookback
+var ErrTooFewBars = errors.New("not enough bars to backtest over")
+
+// Config is how backtests trade
+type Config struct {
+	// Capital is the starting equity
+	Capital float64 `json:"capital"`
+	// CostBps is charged on every change of position, in basis points of
+	// the equity traded, for commissions and slippage
+	CostBps float64 `json:"cost_bps"`
+	// Fill is how orders fill; without one, every change of position fills
+	// in full at the close it is decided
+	Fill *FillModel `json:"fill,omitempty"`
+}
+
+// Point is the equity at one close
+type Point struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// Metrics summarize a run of daily returns
+type Metrics struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Bars         int       `json:"bars"`
+	TotalReturn  float64   `json:"total_return"`
+	AnnualReturn float64   `json:"annual_return"`
+	Volatility   float64   `json:"volatility"`
+	Sharpe       float64   `json:"sharpe"`
+	MaxDrawdown  float64   `json:"max_drawdown"`
+	// Trades counts changes of position
+	Trades int `json:"trades"`
+	// Exposure is the fraction of bars a position was held over
+	Exposure float64 `json:"exposure"`
+	// FillRate is the fraction of the shares ordered that filled, with a
+	// fill model; without one every order fills
+	FillRate *float64 `json:"fill_rate,omitempty"`
+}
+
+// Result is one backtest of a strategy on a symbol
+type Result struct {
+	Strategy string  `json:"strategy"`
+	Symbol   string  `json:"symbol"`
+	Params   Params  `json:"params"`
+	Config   Config  `json:"config"`
+	Metrics  Metrics `json:"metrics"`
+	Equity   []Point `json:"equity"`
+}
+
+// Run backtests s with params over bars, oldest first. The first bars the
+// strategy needs for its lookback are warm-up and aren't traded.
+func Run(symbol string, bars []marketdata.Bar, s Strategy, params Params, cfg Config) (*Result, error) {
+	params, err := s.Resolve(params)
+	if err != nil {
+		return nil, err
+	}
+	closes := closesOf(bars)
+	from := s.lookback(params) + 1
+	if len(closes)-from < 2 {
+		return nil, ErrTooFewBars
+	}
+
+	positions := held(s.signal(closes, params))
+	equity, metrics := simulate(bars, closes, positions, from, len(closes), cfg)
+	return &Result{
+		Strategy: s.Name,
+		Symbol:   symbol,
+		Params:   params,
+		Config:   cfg,
+		Metrics:  metrics,
+		Equity:   equity,
+	}, nil
+}
+
+func closesOf(bars []marketdata.Bar) []float64 {
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		closes[i] = b.Close
+	}
+	return closes
+}
+
+// held turns the signal after each close into the position held over each
+// bar: the one decided at the previous close
+func held(signal []float64) []float64 {
+	out := make([]float64, len(signal))
+	copy(out[1:], signal)
+	return out
+}
+
+// simulate trades positions over bars [from, to): bar t earns positions[t]
+// times its return from the previous close, less the cost of changing
+// position at that close. The equity curve starts at the close before from.
+// With a fill model the positions are traded through orders instead (see
+// simulateFills).
+func simulate(bars []marketdata.Bar, closes, positions []float64, from, to int, cfg Config) ([]Point, Metrics) {
+	if cfg.Fill != nil {
+		return simulateFills(bars, closes, positions, from, to, cfg)
+	}
+	capital, costBps := cfg.Capital, cfg.CostBps
+	equity := []Point{{Time: bars[from-1].Timestamp, Equity: capital}}
+	returns := make([]float64, 0, to-from)
+	value, peak := capital, capital
+	m := Metrics{Start: bars[from-1].Timestamp, End: bars[to-1].Timestamp, Bars: to - from}
+	inMarket := 0
+
+	for t := from; t < to; t++ {
+		r := positions[t] * (closes[t]/closes[t-1] - 1)
+		if change := math.Abs(positions[t] - positions[t-1]); change > 0 {
+			r -= change * costBps / 10000
+			m.Trades++
+		}
+		if positions[t] != 0 {
+			inMarket++
+		}
+		value *= 1 + r
+		returns = append(returns, r)
+		equity = append(equity, Point{Time: bars[t].Timestamp, Equity: round(value, 2)})
+		peak = max(peak, value)
+		m.MaxDrawdown = max(m.MaxDrawdown, 1-value/peak)
+	}
+
+	m.summarize(returns, value, capital, inMarket)
+	return equity, m.rounded()
+}
+
+// summarize sets the metrics computed from the returns of a run that turned
+// capital into value, in the market over inMarket of its bars
+func (m *Metrics) summarize(returns []float64, value, capital float64, inMarket int) {
+	m.TotalReturn = value/capital - 1
+	if years := float64(len(returns)) / tradingDays; years > 0 && value > 0 {
+		m.AnnualReturn = math.Pow(value/capital, 1/years) - 1
+	}
+	mean, std := meanStd(returns)
+	m.Volatility = std * math.Sqrt(tradingDays)
+	if std > 0 {
+		m.Sharpe = mean / std * math.Sqrt(tradingDays)
+	}
+	m.Exposure = float64(inMarket) / float64(len(returns))
+}
+
+func (m Metrics) rounded() Metrics {
+	m.TotalReturn = round(m.TotalReturn, 4)
+	m.AnnualReturn = round(m.AnnualReturn, 4)
+	m.Volatility = round(m.Volatility, 4)
+	m.Sharpe = round(m.Sharpe, 4)
+	m.MaxDrawdown = round(m.MaxDrawdown, 4)
+	m.Exposure = round(m.Exposure, 4)
+	return m
+}
+
+// objective returns the metric fits maximize
+func (m Metrics) objective(name string) (float64, error) {
+	switch name {
+	case ObjectiveSharpe:
+		return m.Sharpe, nil
+	case ObjectiveTotalReturn:
+		return m.TotalReturn, nil
+	case ObjectiveReturnOverDrawdown:
+		if m.MaxDrawdown == 0 {
+			return m.AnnualReturn, nil
+		}
+		return m.AnnualReturn / m.MaxDrawdown, nil
+	}
+	return 0, fmt.Errorf("unknown objective %q", name)
+}
+
+func meanStd(xs []float64) (float64, float64) {
+	if len(xs) < 2 {
+		return 0, 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	var ss float64
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
+
+func round(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
@@ -0,0 +1,135 @@
+package backtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ConfigHash identifies what a run ran, not when: runs of the same kind,
+// strategy, symbol, parameters and settings hash the same whatever dates
+// they cover, so reruns over new data can be found together
+func ConfigHash(kind, strategy, symbol string, params Params, settings any) string {
+	// Maps marshal with sorted keys, so equal configs encode the same
+	b, _ := json.Marshal(struct {
+		Kind     string `json:"kind"`
+		Strategy string `json:"strategy"`
+		Symbol   string `json:"symbol"`
+		Params   Params `json:"params"`
+		Settings any    `json:"settings"`
+	}{kind, strategy, symbol, params, settings})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// MetricDelta is how one metric changed from one run to another. Better is
+// set for metrics with a direction: returns and Sharpe are better higher,
+// drawdown and volatility lower.
+type MetricDelta struct {
+	Metric string  `json:"metric"`
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+	Change float64 `json:"change"`
+	Better *bool   `json:"better,omitempty"`
+}
+
+// metricDirections is +1 for metrics better higher, -1 for those better
+// lower and 0 for those with no better direction
+var metricDirections = []struct {
+	name      string
+	direction int
+	value     func(Metrics) float64
+}{
+	{"total_return", 1, func(m Metrics) float64 { return m.TotalReturn }},
+	{"annual_return", 1, func(m Metrics) float64 { return m.AnnualReturn }},
+	{"sharpe", 1, func(m Metrics) float64 { return m.Sharpe }},
+	{"volatility", -1, func(m Metrics) float64 { return m.Volatility }},
+	{"max_drawdown", -1, func(m Metrics) float64 { return m.MaxDrawdown }},
+	{"trades", 0, func(m Metrics) float64 { return float64(m.Trades) }},
+	{"exposure", 0, func(m Metrics) float64 { return m.Exposure }},
+	{"fill_rate", 0, func(m Metrics) float64 {
+		if m.FillRate == nil {
+			return 1
+		}
+		return *m.FillRate
+	}},
+	{"bars", 0, func(m Metrics) float64 { return float64(m.Bars) }},
+}
+
+// DiffMetrics returns how each metric changed from a to b
+func DiffMetrics(a, b Metrics) []MetricDelta {
+	out := make([]MetricDelta, 0, len(metricDirections))
+	for _, d := range metricDirections {
+		from, to := d.value(a), d.value(b)
+		delta := MetricDelta{Metric: d.name, From: from, To: to, Change: round(to-from, 4)}
+		if d.direction != 0 && to != from {
+			better := (to > from) == (d.direction > 0)
+			delta.Better = &better
+		}
+		out = append(out, delta)
+	}
+	return out
+}
+
+// Best returns, for each metric with a better direction, the index of the
+// run that did best on it; ties go to the earlier run
+func Best(metrics []Metrics) map[string]int {
+	out := make(map[string]int)
+	if len(metrics) == 0 {
+		return out
+	}
+	for _, d := range metricDirections {
+		if d.direction == 0 {
+			continue
+		}
+		best := 0
+		for i, m := range metrics {
+			if float64(d.direction)*(d.value(m)-d.value(metrics[best])) > 0 {
+				best = i
+			}
+		}
+		out[d.name] = best
+	}
+	return out
+}
+
+// Rebase returns the equity curves restricted to the closes every curve has
+// and scaled to start at 1, so runs with different capital and dates can be
+// plotted together. The curves are empty if they share fewer than two
+// closes.
+func Rebase(curves [][]Point) [][]Point {
+	out := make([][]Point, len(curves))
+	for i := range out {
+		out[i] = []Point{}
+	}
+	if len(curves) == 0 {
+		return out
+	}
+
+	common := make(map[int64]int)
+	for _, curve := range curves {
+		for _, p := range curve {
+			common[p.Time.Unix()]++
+		}
+	}
+	for i, curve := range curves {
+		var base float64
+		for _, p := range curve {
+			if common[p.Time.Unix()] != len(curves) {
+				continue
+			}
+			if base == 0 {
+				base = p.Equity
+			}
+			if base > 0 {
+				out[i] = append(out[i], Point{Time: p.Time, Equity: round(p.Equity/base, 6)})
+			}
+		}
+	}
+	if len(out[0]) < 2 {
+		for i := range out {
+			out[i] = []Point{}
+		}
+	}
+	return out
+}
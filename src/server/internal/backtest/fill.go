@@ -0,0 +1,186 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// Order types a fill model places
+const (
+	// OrderMarket works the order through the next bars at each bar's VWAP
+	OrderMarket = "market"
+	// OrderLimit rests the order at a limit price set from the close it was
+	// placed at, behind the volume already queued there
+	OrderLimit = "limit"
+)
+
+// FillModel is how a backtest's orders fill when it doesn't trade at the
+// close. A change of position is placed as an order at the close it is
+// decided and worked through the bars after it, taking no more than
+// Participation of each bar's volume, so a large order fills over several
+// bars and a limit order may never fill at all.
+type FillModel struct {
+	OrderType string `json:"order_type"`
+	// LimitOffsetBps sets a limit order's price that far below the close
+	// for a buy, or above it for a sell, in basis points
+	LimitOffsetBps float64 `json:"limit_offset_bps"`
+	// Participation is the most of a bar's volume an order may take, above
+	// 0 and at most 1
+	Participation float64 `json:"participation"`
+	// QueueAhead is the volume resting ahead of a new limit order at its
+	// price, as a fraction of the volume of the bar it is placed at. The
+	// volume that trades at the limit fills it before the order.
+	QueueAhead float64 `json:"queue_ahead"`
+}
+
+// Resolve fills in the defaults of a fill model, a market order taking up
+// to 10% of each bar, and checks it
+func (m FillModel) Resolve() (FillModel, error) {
+	if m.OrderType == "" {
+		m.OrderType = OrderMarket
+	}
+	if m.Participation == 0 {
+		m.Participation = 0.1
+	}
+	switch {
+	case m.OrderType != OrderMarket && m.OrderType != OrderLimit:
+		return m, fmt.Errorf("order_type must be %s or %s", OrderMarket, OrderLimit)
+	case m.Participation < 0 || m.Participation > 1:
+		return m, fmt.Errorf("participation must be above 0 and at most 1")
+	case m.QueueAhead < 0:
+		return m, fmt.Errorf("queue_ahead can't be negative")
+	case m.LimitOffsetBps < 0 || m.LimitOffsetBps >= 10000:
+		return m, fmt.Errorf("limit_offset_bps must be at least 0 and under 10000")
+	}
+	return m, nil
+}
+
+// workingOrder is an order being filled bar by bar. Qty is signed, positive
+// to buy.
+type workingOrder struct {
+	model FillModel
+	qty   float64
+	limit float64
+	queue float64
+}
+
+// newOrder places an order for qty shares at the close of bar, the limit
+// price and queue taken from it
+func newOrder(m FillModel, qty float64, bar marketdata.Bar) *workingOrder {
+	o := &workingOrder{model: m, qty: qty}
+	if m.OrderType == OrderLimit {
+		offset := m.LimitOffsetBps / 10000
+		if qty > 0 {
+			o.limit = bar.Close * (1 - offset)
+		} else {
+			o.limit = bar.Close * (1 + offset)
+		}
+		o.queue = m.QueueAhead * float64(bar.Volume)
+	}
+	return o
+}
+
+// fill works the order through one bar and returns the shares it filled,
+// signed, and their price
+func (o *workingOrder) fill(bar marketdata.Bar) (float64, float64) {
+	volume := float64(bar.Volume)
+	price := bar.VWAP
+	if price <= 0 {
+		price = (bar.High + bar.Low + bar.Close) / 3
+	}
+
+	if o.model.OrderType == OrderLimit {
+		// The volume that traded at or through the limit is taken as the
+		// share of the bar's range beyond it; a bar that only touches it
+		// fills nothing, since the order is at the back of the queue
+		var reach float64
+		switch {
+		case bar.High <= bar.Low:
+			if o.qty > 0 && bar.Low < o.limit || o.qty < 0 && bar.High > o.limit {
+				reach = 1
+			}
+		case o.qty > 0:
+			reach = (o.limit - bar.Low) / (bar.High - bar.Low)
+			price = min(o.limit, bar.Open)
+		default:
+			reach = (bar.High - o.limit) / (bar.High - bar.Low)
+			price = max(o.limit, bar.Open)
+		}
+		volume *= math.Min(math.Max(reach, 0), 1)
+		ahead := math.Min(o.queue, volume)
+		o.queue -= ahead
+		volume -= ahead
+	}
+
+	n := math.Min(math.Abs(o.qty), math.Floor(volume*o.model.Participation))
+	if n <= 0 {
+		return 0, 0
+	}
+	if o.qty < 0 {
+		n = -n
+	}
+	o.qty -= n
+	return n, price
+}
+
+// done reports whether the order has filled in full
+func (o *workingOrder) done() bool {
+	return o.qty == 0
+}
+
+// simulateFills is simulate with a fill model: the backtest starts in cash,
+// every change of the position to hold is placed as an order at the close
+// it is decided, replacing any order still working, and equity is cash plus
+// the shares held at each close. Cost is charged on each fill's notional.
+func simulateFills(bars []marketdata.Bar, closes, positions []float64, from, to int, cfg Config) ([]Point, Metrics) {
+	m := *cfg.Fill
+	equity := []Point{{Time: bars[from-1].Timestamp, Equity: cfg.Capital}}
+	returns := make([]float64, 0, to-from)
+	cash, shares := cfg.Capital, 0.0
+	value, peak := cfg.Capital, cfg.Capital
+	metrics := Metrics{Start: bars[from-1].Timestamp, End: bars[to-1].Timestamp, Bars: to - from}
+	var order *workingOrder
+	var ordered, filled float64
+	inMarket := 0
+
+	for t := from; t < to; t++ {
+		// The position to hold over bar t was decided at the close before
+		if t == from || positions[t] != positions[t-1] {
+			target := math.Trunc(positions[t] * value / closes[t-1])
+			order = nil
+			if qty := target - shares; qty != 0 {
+				order = newOrder(m, qty, bars[t-1])
+				ordered += math.Abs(qty)
+				metrics.Trades++
+			}
+		}
+		if order != nil {
+			qty, price := order.fill(bars[t])
+			shares += qty
+			cash -= qty*price + math.Abs(qty*price)*cfg.CostBps/10000
+			filled += math.Abs(qty)
+			if order.done() {
+				order = nil
+			}
+		}
+		if shares != 0 {
+			inMarket++
+		}
+
+		next := cash + shares*closes[t]
+		returns = append(returns, next/value-1)
+		value = next
+		equity = append(equity, Point{Time: bars[t].Timestamp, Equity: round(value, 2)})
+		peak = max(peak, value)
+		metrics.MaxDrawdown = max(metrics.MaxDrawdown, 1-value/peak)
+	}
+
+	if ordered > 0 {
+		rate := round(filled/ordered, 4)
+		metrics.FillRate = &rate
+	}
+	metrics.summarize(returns, value, cfg.Capital, inMarket)
+	return equity, metrics.rounded()
+}
@@ -0,0 +1,76 @@
+package backtest
+
+import (
+	"testing"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// fills is what an order should fill on one bar
+type fills struct {
+	bar   marketdata.Bar
+	qty   float64
+	price float64
+}
+
+func checkFills(t *testing.T, o *workingOrder, want []fills, done bool) {
+	t.Helper()
+	for i, w := range want {
+		qty, price := o.fill(w.bar)
+		if qty != w.qty || price != w.price {
+			t.Errorf("bar %d: filled %v at %v, want %v at %v", i, qty, price, w.qty, w.price)
+		}
+	}
+	if o.done() != done {
+		t.Errorf("done = %v with %v left, want %v", o.done(), o.qty, done)
+	}
+}
+
+func TestFillParticipationCap(t *testing.T) {
+	m := FillModel{OrderType: OrderMarket, Participation: 0.1}
+	o := newOrder(m, 1000, marketdata.Bar{Close: 50, Volume: 5000})
+
+	// A tenth of each bar's volume, at its VWAP, until the order is done
+	checkFills(t, o, []fills{
+		{bar: marketdata.Bar{Open: 50, High: 51, Low: 49, Close: 50, Volume: 2000, VWAP: 50.2}, qty: 200, price: 50.2},
+		{bar: marketdata.Bar{Open: 50, High: 51, Low: 49, Close: 50, Volume: 4005, VWAP: 50.4}, qty: 400, price: 50.4},
+	}, false)
+	if o.qty != 400 {
+		t.Errorf("left %v, want 400", o.qty)
+	}
+	checkFills(t, o, []fills{
+		{bar: marketdata.Bar{Open: 50, High: 51, Low: 49, Close: 50, Volume: 10000, VWAP: 50.6}, qty: 400, price: 50.6},
+	}, true)
+}
+
+func TestFillLimitQueueAhead(t *testing.T) {
+	m := FillModel{OrderType: OrderLimit, LimitOffsetBps: 100, Participation: 0.2, QueueAhead: 0.5}
+	o := newOrder(m, 300, marketdata.Bar{Close: 100, Volume: 1000})
+	if o.limit != 99 || o.queue != 500 {
+		t.Fatalf("limit %v behind %v, want 99 behind 500", o.limit, o.queue)
+	}
+
+	checkFills(t, o, []fills{
+		// Touching the limit fills nothing
+		{bar: marketdata.Bar{Open: 100, High: 101, Low: 99, Close: 100, Volume: 4000, VWAP: 100}},
+		// Half the range is through the limit, so 1000 shares traded
+		// there; the queue takes 500 and the order a fifth of the rest
+		{bar: marketdata.Bar{Open: 99.5, High: 100, Low: 98, Close: 99, Volume: 2000, VWAP: 99.2}, qty: 100, price: 99},
+		// The queue is gone, so the order takes a fifth of all 1000
+		{bar: marketdata.Bar{Open: 98.5, High: 100, Low: 98, Close: 99, Volume: 2000, VWAP: 99.2}, qty: 200, price: 98.5},
+	}, true)
+}
+
+func TestFillMarketFullParticipation(t *testing.T) {
+	m := FillModel{OrderType: OrderMarket, Participation: 1}
+	o := newOrder(m, -500, marketdata.Bar{Close: 20, Volume: 100})
+
+	// Without a VWAP the typical price is used
+	checkFills(t, o, []fills{
+		{bar: marketdata.Bar{Open: 20, High: 21, Low: 18, Close: 21, Volume: 300}, qty: -300, price: 20},
+		{bar: marketdata.Bar{Open: 20, High: 21, Low: 19, Close: 20, Volume: 1000, VWAP: 19.9}, qty: -200, price: 19.9},
+	}, true)
+	if qty, _ := o.fill(marketdata.Bar{Volume: 1000, VWAP: 20}); qty != 0 {
+		t.Errorf("filled %v after done", qty)
+	}
+}
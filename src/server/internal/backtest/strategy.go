@@ -0,0 +1,224 @@
+// Package backtest runs the desk's built-in strategies over historical daily
+// bars and evaluates them walk-forward. A strategy is a rule that decides,
+// at each close, the position to hold until the next one; backtests are
+// long-only or long/short by strategy, trade at closes and charge a cost per
+// unit of turnover, or with a fill model work orders through the volume of
+// the bars that follow.
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// Params are a strategy's parameter values by name
+type Params map[string]float64
+
+// Param describes one strategy parameter
+type Param struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Default     float64 `json:"default"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	// Integer parameters only take whole values, e.g. periods
+	Integer bool `json:"integer"`
+}
+
+// Strategy is a built-in strategy
+type Strategy struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Params      []Param `json:"params"`
+	// signal returns the exposure to hold after each close: 1 long, 0 flat,
+	// -1 short. It may only look at closes up to and including its own.
+	signal func(closes []float64, p Params) []float64
+	// lookback is how many bars signal needs before its first position
+	lookback func(p Params) int
+	// check rejects parameter combinations that don't make sense together
+	check func(p Params) error
+}
+
+var strategies = map[string]Strategy{
+	"sma_cross": {
+		Name:        "sma_cross",
+		Description: "Long while the fast simple moving average is above the slow one, flat otherwise",
+		Params: []Param{
+			{Name: "fast", Description: "Fast average period", Default: 10, Min: 2, Max: 200, Integer: true},
+			{Name: "slow", Description: "Slow average period", Default: 50, Min: 3, Max: 400, Integer: true},
+		},
+		signal: func(closes []float64, p Params) []float64 {
+			fast, slow := sma(closes, int(p["fast"])), sma(closes, int(p["slow"]))
+			out := make([]float64, len(closes))
+			for i := range out {
+				if !math.IsNaN(slow[i]) && fast[i] > slow[i] {
+					out[i] = 1
+				}
+			}
+			return out
+		},
+		lookback: func(p Params) int { return int(p["slow"]) },
+		check: func(p Params) error {
+			if p["fast"] >= p["slow"] {
+				return fmt.Errorf("fast must be less than slow")
+			}
+			return nil
+		},
+	},
+	"rsi_reversion": {
+		Name:        "rsi_reversion",
+		Description: "Buys when RSI falls below entry and sells once it rises above exit",
+		Params: []Param{
+			{Name: "period", Description: "RSI period", Default: 14, Min: 2, Max: 100, Integer: true},
+			{Name: "entry", Description: "RSI to buy below", Default: 30, Min: 1, Max: 99},
+			{Name: "exit", Description: "RSI to sell above", Default: 70, Min: 1, Max: 99},
+		},
+		signal: func(closes []float64, p Params) []float64 {
+			rsi := wilderRSI(closes, int(p["period"]))
+			out := make([]float64, len(closes))
+			var pos float64
+			for i, r := range rsi {
+				switch {
+				case math.IsNaN(r):
+				case r < p["entry"]:
+					pos = 1
+				case r > p["exit"]:
+					pos = 0
+				}
+				out[i] = pos
+			}
+			return out
+		},
+		lookback: func(p Params) int { return int(p["period"]) + 1 },
+		check: func(p Params) error {
+			if p["entry"] >= p["exit"] {
+				return fmt.Errorf("entry must be less than exit")
+			}
+			return nil
+		},
+	},
+	"momentum": {
+		Name:        "momentum",
+		Description: "Long when the close is above its close lookback bars ago, short below it if short is 1",
+		Params: []Param{
+			{Name: "lookback", Description: "Bars to measure momentum over", Default: 60, Min: 2, Max: 400, Integer: true},
+			{Name: "short", Description: "1 to go short on negative momentum, 0 to stay flat", Default: 0, Min: 0, Max: 1, Integer: true},
+		},
+		signal: func(closes []float64, p Params) []float64 {
+			n := int(p["lookback"])
+			out := make([]float64, len(closes))
+			for i := n; i < len(closes); i++ {
+				switch {
+				case closes[i] > closes[i-n]:
+					out[i] = 1
+				case closes[i] < closes[i-n]:
+					out[i] = -p["short"]
+				}
+			}
+			return out
+		},
+		lookback: func(p Params) int { return int(p["lookback"]) },
+	},
+}
+
+// Lookup returns the built-in strategy called name
+func Lookup(name string) (Strategy, bool) {
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// Strategies lists the built-in strategies by name
+func Strategies() []Strategy {
+	out := make([]Strategy, 0, len(strategies))
+	for _, s := range strategies {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Resolve returns p with defaults filled in, or an error if p names a
+// parameter the strategy doesn't have or a value out of range
+func (s Strategy) Resolve(p Params) (Params, error) {
+	out := make(Params, len(s.Params))
+	for name := range p {
+		if !slices.ContainsFunc(s.Params, func(param Param) bool { return param.Name == name }) {
+			return nil, fmt.Errorf("%s has no parameter %q", s.Name, name)
+		}
+	}
+	for _, param := range s.Params {
+		v, ok := p[param.Name]
+		if !ok {
+			v = param.Default
+		}
+		if v < param.Min || v > param.Max {
+			return nil, fmt.Errorf("%s must be between %g and %g", param.Name, param.Min, param.Max)
+		}
+		if param.Integer && v != math.Trunc(v) {
+			return nil, fmt.Errorf("%s must be a whole number", param.Name)
+		}
+		out[param.Name] = v
+	}
+	if s.check != nil {
+		if err := s.check(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func sma(closes []float64, n int) []float64 {
+	out := make([]float64, len(closes))
+	var sum float64
+	for i, c := range closes {
+		sum += c
+		if i >= n {
+			sum -= closes[i-n]
+		}
+		if i >= n-1 {
+			out[i] = sum / float64(n)
+		} else {
+			out[i] = math.NaN()
+		}
+	}
+	return out
+}
+
+// wilderRSI returns the RSI at each close, NaN until there are period+1
+// closes, as indicators.RSI computes it
+func wilderRSI(closes []float64, period int) []float64 {
+	out := make([]float64, len(closes))
+	var gain, loss float64
+	for i := range closes {
+		if i == 0 {
+			out[i] = math.NaN()
+			continue
+		}
+		d := closes[i] - closes[i-1]
+		g, l := max(d, 0), max(-d, 0)
+		switch {
+		case i < period:
+			gain += g
+			loss += l
+			out[i] = math.NaN()
+			continue
+		case i == period:
+			gain = (gain + g) / float64(period)
+			loss = (loss + l) / float64(period)
+		default:
+			gain = (gain*float64(period-1) + g) / float64(period)
+			loss = (loss*float64(period-1) + l) / float64(period)
+		}
+		switch {
+		case loss == 0 && gain == 0:
+			out[i] = 50
+		case loss == 0:
+			out[i] = 100
+		default:
+			out[i] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return out
+}
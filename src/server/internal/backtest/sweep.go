@@ -0,0 +1,212 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+const (
+	// isolatedPeak is the fraction of a configuration's score its grid
+	// neighbors must average for the score not to be flagged as an
+	// isolated peak
+	isolatedPeak = 0.5
+	// minTrades is the fewest trades a configuration should make for its
+	// metrics to mean much
+	minTrades = 10
+)
+
+// SweepConfig is how a sweep runs
+type SweepConfig struct {
+	// Grid lists the values each parameter is swept over; parameters left
+	// out keep their value from the fixed parameters, or their default
+	Grid      map[string][]float64 `json:"grid"`
+	Objective string               `json:"objective"`
+	// Workers is how many backtests run at once
+	Workers int `json:"workers"`
+	// Top is how many of the best configurations the report singles out
+	Top int `json:"top"`
+}
+
+// SweepRun is one configuration of a sweep. Result is the full backtest,
+// left out of reports.
+type SweepRun struct {
+	Params  Params  `json:"params"`
+	Metrics Metrics `json:"metrics"`
+	Score   float64 `json:"score"`
+	// NeighborScore is the mean score of the configurations one grid step
+	// away in one parameter, nil if there are none
+	NeighborScore *float64 `json:"neighbor_score,omitempty"`
+	Warnings      []string `json:"warnings"`
+	// RunID is the stored backtest run, set by the caller
+	RunID  int64   `json:"run_id,omitempty"`
+	Result *Result `json:"-"`
+}
+
+// SweepReport ranks every configuration of a sweep by its objective
+type SweepReport struct {
+	Strategy  string               `json:"strategy"`
+	Symbol    string               `json:"symbol"`
+	Config    Config               `json:"config"`
+	Objective string               `json:"objective"`
+	Fixed     Params               `json:"fixed"`
+	Grid      map[string][]float64 `json:"grid"`
+	// Best is the Top configurations by score, with their warnings
+	Best []SweepRun `json:"best"`
+	// Runs is every configuration, best first
+	Runs []SweepRun `json:"runs"`
+	// Warnings are about the sweep as a whole
+	Warnings []string `json:"warnings"`
+}
+
+// Sweep backtests every combination of the grid's values on bars, up to
+// Workers at a time, ranks them by the objective and flags results that
+// look overfit: a score its grid neighbors don't come close to, a best
+// value at the edge of its grid or too few trades. A cancelled ctx stops
+// the sweep.
+func Sweep(ctx context.Context, symbol string, bars []marketdata.Bar, s Strategy, fixed Params, sc SweepConfig, cfg Config) (*SweepReport, error) {
+	if sc.Objective == "" {
+		sc.Objective = ObjectiveSharpe
+	}
+	if !ValidObjective(sc.Objective) {
+		return nil, fmt.Errorf("unknown objective %q", sc.Objective)
+	}
+	if len(sc.Grid) == 0 {
+		return nil, fmt.Errorf("grid is required")
+	}
+	// Neighbors are adjacent values, so each grid is swept in order
+	grid := make(map[string][]float64, len(sc.Grid))
+	for name, values := range sc.Grid {
+		values = slices.Clone(values)
+		slices.Sort(values)
+		grid[name] = slices.Compact(values)
+	}
+	points, err := expandGrid(s, fixed, grid)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]SweepRun, len(points))
+	errs := make([]error, len(points))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(sc.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result, err := Run(symbol, bars, s, points[i].params, cfg)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				score, _ := result.Metrics.objective(sc.Objective)
+				runs[i] = SweepRun{Params: result.Params, Metrics: result.Metrics, Score: round(score, 4), Warnings: []string{}, Result: result}
+			}
+		}()
+	}
+feed:
+	for i := range points {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(grid))
+	for name := range grid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	flagRuns(runs, points, names, grid)
+
+	report := &SweepReport{
+		Strategy:  s.Name,
+		Symbol:    symbol,
+		Config:    cfg,
+		Objective: sc.Objective,
+		Fixed:     fixed,
+		Grid:      grid,
+		Warnings:  []string{},
+	}
+	order := make([]int, len(runs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return runs[order[a]].Score > runs[order[b]].Score })
+	for _, i := range order {
+		report.Runs = append(report.Runs, runs[i])
+	}
+	top := sc.Top
+	if top <= 0 {
+		top = 10
+	}
+	report.Best = report.Runs[:min(top, len(report.Runs))]
+
+	if len(runs) > 1 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"The best of %d configurations is picked with hindsight; expect it to do worse out of sample, and check it walk-forward", len(runs)))
+	}
+	if best := report.Runs[0]; len(best.Warnings) > 0 {
+		report.Warnings = append(report.Warnings, "The best configuration has warnings: "+best.Warnings[0])
+	}
+	return report, nil
+}
+
+// flagRuns sets each run's neighbor score and overfitting warnings. names
+// are the grid's parameters in the order of the points' coordinates.
+func flagRuns(runs []SweepRun, points []gridPoint, names []string, grid map[string][]float64) {
+	index := make(map[string]int, len(points))
+	for i, point := range points {
+		index[fmt.Sprint(point.coords)] = i
+	}
+
+	for i, point := range points {
+		run := &runs[i]
+		var sum float64
+		var neighbors int
+		for d := range point.coords {
+			for _, step := range []int{-1, 1} {
+				coords := slices.Clone(point.coords)
+				coords[d] += step
+				if j, ok := index[fmt.Sprint(coords)]; ok {
+					sum += runs[j].Score
+					neighbors++
+				}
+			}
+		}
+		if neighbors > 0 {
+			mean := round(sum/float64(neighbors), 4)
+			run.NeighborScore = &mean
+			if run.Score > 0 && mean < run.Score*isolatedPeak {
+				run.Warnings = append(run.Warnings, fmt.Sprintf(
+					"isolated peak: neighboring configurations score %g on average against %g", mean, run.Score))
+			}
+		}
+		for d, name := range names {
+			if n := len(grid[name]); n > 2 && (point.coords[d] == 0 || point.coords[d] == n-1) {
+				run.Warnings = append(run.Warnings, fmt.Sprintf(
+					"%s is at the edge of its grid; the optimum may lie outside it", name))
+			}
+		}
+		if run.Metrics.Trades < minTrades {
+			run.Warnings = append(run.Warnings, fmt.Sprintf(
+				"only %d trades; the metrics rest on a handful of positions", run.Metrics.Trades))
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package backtest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// Objectives a walk-forward fit maximizes in sample
+const (
+	ObjectiveSharpe      = "sharpe"
+	ObjectiveTotalReturn = "total_return"
+	// ObjectiveReturnOverDrawdown is the annual return over the maximum
+	// drawdown
+	ObjectiveReturnOverDrawdown = "return_over_drawdown"
+)
+
+// ValidObjective reports whether name is a fit objective
+func ValidObjective(name string) bool {
+	return name == ObjectiveSharpe || name == ObjectiveTotalReturn || name == ObjectiveReturnOverDrawdown
+}
+
+// MaxCandidates caps the parameter combinations a grid may expand to
+const MaxCandidates = 500
+
+// WalkForwardConfig is how history is split and fit
+type WalkForwardConfig struct {
+	// InSample and OutOfSample are the lengths, in bars, of each fitting
+	// window and of the window traded with its fit
+	InSample    int `json:"in_sample"`
+	OutOfSample int `json:"out_of_sample"`
+	// Anchored fits every window from the start of history rather than over
+	// the last InSample bars
+	Anchored  bool   `json:"anchored"`
+	Objective string `json:"objective"`
+	// Grid lists the values each parameter is fit over; parameters left
+	// out keep their value from the fixed parameters, or their default
+	Grid map[string][]float64 `json:"grid"`
+}
+
+// Window is one walk-forward step: the parameters fit in sample and how
+// they did in and out of sample
+type Window struct {
+	Params      Params  `json:"params"`
+	InSample    Metrics `json:"in_sample"`
+	OutOfSample Metrics `json:"out_of_sample"`
+}
+
+// WalkForwardReport aggregates a walk-forward evaluation. Only the
+// out-of-sample results say how the strategy would have done; the in-sample
+// ones are what the fits saw.
+type WalkForwardReport struct {
+	Strategy    string            `json:"strategy"`
+	Symbol      string            `json:"symbol"`
+	Config      Config            `json:"config"`
+	WalkForward WalkForwardConfig `json:"walk_forward"`
+	// Candidates is the number of parameter combinations each window fit
+	// chose from
+	Candidates int      `json:"candidates"`
+	Windows    []Window `json:"windows"`
+	// OutOfSample is the metrics of the out-of-sample windows traded back
+	// to back, each with its own fit, and Equity their equity curve
+	OutOfSample Metrics `json:"out_of_sample"`
+	Equity      []Point `json:"equity"`
+	// Efficiency is the mean out-of-sample objective over the mean
+	// in-sample one; well below 1 suggests the fits are overfit. It is
+	// left out when the in-sample mean isn't positive.
+	Efficiency *float64 `json:"efficiency,omitempty"`
+	// ParamChanges counts windows whose fit differs from the window
+	// before's; parameters that change every window aren't stable
+	ParamChanges int `json:"param_changes"`
+}
+
+// WalkForward splits bars into consecutive in-sample and out-of-sample
+// windows, fits the strategy's parameters over the grid in each in-sample
+// window and trades the fit over the out-of-sample window that follows.
+// Out-of-sample windows are stitched into one report, with equity carried
+// from each window into the next and position changes at the seams charged.
+func WalkForward(symbol string, bars []marketdata.Bar, s Strategy, fixed Params, wf WalkForwardConfig, cfg Config) (*WalkForwardReport, error) {
+	if wf.InSample < 2 || wf.OutOfSample < 2 {
+		return nil, fmt.Errorf("in-sample and out-of-sample windows need at least 2 bars")
+	}
+	if wf.Objective == "" {
+		wf.Objective = ObjectiveSharpe
+	}
+	if !ValidObjective(wf.Objective) {
+		return nil, fmt.Errorf("unknown objective %q", wf.Objective)
+	}
+	points, err := expandGrid(s, fixed, wf.Grid)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]Params, len(points))
+	for i, point := range points {
+		candidates[i] = point.params
+	}
+
+	closes := closesOf(bars)
+	positions := make([][]float64, len(candidates))
+	start := 0
+	for i, p := range candidates {
+		positions[i] = held(s.signal(closes, p))
+		start = max(start, s.lookback(p)+1)
+	}
+	if len(closes)-start < wf.InSample+2 {
+		return nil, fmt.Errorf("%w: %d bars after a %d bar lookback, fewer than one window", ErrTooFewBars, len(closes)-start, start)
+	}
+
+	report := &WalkForwardReport{
+		Strategy:    s.Name,
+		Symbol:      symbol,
+		Config:      cfg,
+		WalkForward: wf,
+		Candidates:  len(candidates),
+	}
+	stitched := make([]float64, len(closes))
+	firstOOS := start + wf.InSample
+	var isScore, oosScore float64
+	var prev Params
+
+	for isStart, isEnd := start, firstOOS; len(closes)-isEnd >= 2; isEnd += wf.OutOfSample {
+		if !wf.Anchored {
+			isStart = isEnd - wf.InSample
+		}
+		oosEnd := min(isEnd+wf.OutOfSample, len(closes))
+
+		best, bestScore := 0, 0.0
+		var bestMetrics Metrics
+		for i := range candidates {
+			_, m := simulate(bars, closes, positions[i], isStart, isEnd, cfg)
+			score, _ := m.objective(wf.Objective)
+			if i == 0 || score > bestScore {
+				best, bestScore, bestMetrics = i, score, m
+			}
+		}
+		copy(stitched[isEnd:oosEnd], positions[best][isEnd:oosEnd])
+		_, oos := simulate(bars, closes, stitched, isEnd, oosEnd, cfg)
+		score, _ := oos.objective(wf.Objective)
+		isScore += bestScore
+		oosScore += score
+
+		if prev != nil && !sameParams(prev, candidates[best]) {
+			report.ParamChanges++
+		}
+		prev = candidates[best]
+		report.Windows = append(report.Windows, Window{Params: candidates[best], InSample: bestMetrics, OutOfSample: oos})
+	}
+
+	lastOOS := min(firstOOS+len(report.Windows)*wf.OutOfSample, len(closes))
+	report.Equity, report.OutOfSample = simulate(bars, closes, stitched, firstOOS, lastOOS, cfg)
+	if n := float64(len(report.Windows)); isScore > 0 {
+		efficiency := round((oosScore/n)/(isScore/n), 4)
+		report.Efficiency = &efficiency
+	}
+	return report, nil
+}
+
+// gridPoint is one parameter combination of a grid and the index of each
+// grid parameter's value in it, in sorted name order
+type gridPoint struct {
+	params Params
+	coords []int
+}
+
+// expandGrid returns every combination of the grid's values over the fixed
+// parameters that the strategy accepts
+func expandGrid(s Strategy, fixed Params, grid map[string][]float64) ([]gridPoint, error) {
+	names := make([]string, 0, len(grid))
+	size := 1
+	for name, values := range grid {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("grid of %s has no values", name)
+		}
+		if _, ok := fixed[name]; ok {
+			return nil, fmt.Errorf("%s is both fixed and in the grid", name)
+		}
+		names = append(names, name)
+		size *= len(values)
+		if size > MaxCandidates {
+			return nil, fmt.Errorf("grid has more than %d combinations", MaxCandidates)
+		}
+	}
+	sort.Strings(names)
+
+	var out []gridPoint
+	var firstErr error
+	combo := make([]int, len(names))
+	for {
+		p := make(Params, len(fixed)+len(names))
+		for name, v := range fixed {
+			p[name] = v
+		}
+		for i, name := range names {
+			p[name] = grid[name][combo[i]]
+		}
+		if resolved, err := s.Resolve(p); err == nil {
+			out = append(out, gridPoint{params: resolved, coords: slices.Clone(combo)})
+		} else if firstErr == nil {
+			firstErr = err
+		}
+
+		// Advance the combination like an odometer
+		i := len(combo) - 1
+		for ; i >= 0; i-- {
+			if combo[i]++; combo[i] < len(grid[names[i]]) {
+				break
+			}
+			combo[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no valid parameter combination: %w", firstErr)
+	}
+	return out, nil
+}
+
+func sameParams(a, b Params) bool {
+	for name, v := range a {
+		if b[name] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/storage"
+)
+
+// keyPrefix and keySuffix surround a backup's UTC timestamp in its key, so
+// keys sort oldest first
+const (
+	keyPrefix = "trading_desk-"
+	keySuffix = ".db.gz"
+)
+
+// Manager copies the database to a store and keeps the most recent copies
+type Manager struct {
+	db    *database.DB
+	store storage.Store
+	keep  int
+}
+
+// NewManager returns a manager that backs db up to store, keeping the keep
+// most recent backups (all of them if keep is 0)
+func NewManager(db *database.DB, store storage.Store, keep int) *Manager {
+	return &Manager{db: db, store: store, keep: keep}
+}
+
+// Backup stores a gzipped copy of the database and prunes old backups. It
+// returns the new backup's key.
+func (m *Manager) Backup(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "desk-backup")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := m.db.BackupTo(ctx, path); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress backup: %w", err)
+	}
+
+	key := keyPrefix + time.Now().UTC().Format("20060102T150405Z") + keySuffix
+	if err := m.store.Put(ctx, key, buf.Bytes()); err != nil {
+		return "", err
+	}
+	log.Printf("Backed up database to %s (%d bytes)", key, buf.Len())
+
+	if err := m.prune(ctx); err != nil {
+		log.Printf("Failed to prune old backups: %v", err)
+	}
+	return key, nil
+}
+
+// prune deletes all but the newest keep backups
+func (m *Manager) prune(ctx context.Context) error {
+	if m.keep <= 0 {
+		return nil
+	}
+	keys, err := backups(ctx, m.store)
+	if err != nil {
+		return err
+	}
+	for len(keys) > m.keep {
+		if err := m.store.Delete(ctx, keys[0]); err != nil {
+			return err
+		}
+		log.Printf("Deleted old backup %s", keys[0])
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// backups lists the backups in store, oldest first
+func backups(ctx context.Context, store storage.Store) ([]string, error) {
+	keys, err := store.List(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, keySuffix) {
+			found = append(found, key)
+		}
+	}
+	return found, nil
+}
+
+// Restore writes the newest backup in store to dbPath if no database exists
+// there yet, so a fresh machine starts from the last backup. It returns the
+// key restored, or "" if there was a database already or no backup.
+func Restore(ctx context.Context, store storage.Store, dbPath string) (string, error) {
+	dbPath, _, _ = strings.Cut(dbPath, "?")
+	if _, err := os.Stat(dbPath); err == nil {
+		return "", nil
+	}
+
+	keys, err := backups(ctx, store)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+	key := keys[len(keys)-1]
+
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup %s: %w", key, err)
+	}
+	db, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress backup %s: %w", key, err)
+	}
+
+	// Write beside the target first so a failed restore leaves no database
+	// behind for the next start to mistake for a real one
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create database directory: %w", err)
+	}
+	tmp := dbPath + ".restore"
+	if err := os.WriteFile(tmp, db, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write restored database: %w", err)
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return "", fmt.Errorf("failed to restore database: %w", err)
+	}
+	return key, nil
+}
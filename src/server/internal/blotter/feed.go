@@ -0,0 +1,113 @@
+package blotter
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"desk/internal/database"
+	"desk/internal/stream"
+)
+
+// loadChunk caps the trades loaded per query
+const loadChunk = 500
+
+// Update is a new trade or a trade whose status changed. Seq numbers every
+// update the feed publishes, so a subscriber that sees one skipped knows it
+// missed an update.
+type Update struct {
+	Seq   uint64
+	Trade database.Trade
+}
+
+// Feed publishes blotter updates as trades are written. The database tells
+// it which trades changed; it loads their committed rows and fans them out
+// to subscribers. It never blocks the writer: changes that arrive faster
+// than they can be loaded, or that a subscriber can't keep up with, are
+// dropped, and the gap in Seq tells subscribers to start again from a
+// snapshot.
+type Feed struct {
+	db      *database.DB
+	changed chan []int64
+	hub     *stream.Hub[Update]
+
+	// mu orders publishing and subscribing, so a subscriber's first update
+	// follows the Seq it subscribed at
+	mu  sync.Mutex
+	seq uint64
+}
+
+func NewFeed(db *database.DB) *Feed {
+	return &Feed{
+		db:      db,
+		changed: make(chan []int64, 256),
+		hub:     stream.NewHub[Update](256),
+	}
+}
+
+// Changed queues the trades with ids to be published. It is meant for
+// database.OnTradeChange.
+func (f *Feed) Changed(ids []int64) {
+	select {
+	case f.changed <- ids:
+	default:
+		f.skip()
+	}
+}
+
+// skip leaves a gap in Seq for updates that were lost
+func (f *Feed) skip() {
+	f.mu.Lock()
+	f.seq++
+	f.mu.Unlock()
+}
+
+// Subscribe registers for updates, returning the Seq of the last update
+// before the first one the subscriber will see. The returned function must
+// be called to unsubscribe.
+func (f *Feed) Subscribe() (<-chan Update, uint64, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	updates, unsubscribe := f.hub.Subscribe()
+	return updates, f.seq, unsubscribe
+}
+
+// StreamStats describes the blotter stream's subscribers
+func (f *Feed) StreamStats() stream.Stats {
+	return f.hub.Stats()
+}
+
+// Run publishes changed trades until ctx is cancelled
+func (f *Feed) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ids := <-f.changed:
+			f.publish(ids)
+		}
+	}
+}
+
+func (f *Feed) publish(ids []int64) {
+	// Nobody is watching, and a new subscriber starts from a snapshot
+	if f.hub.Len() == 0 {
+		return
+	}
+
+	for start := 0; start < len(ids); start += loadChunk {
+		trades, err := f.db.GetTradesByIDs(ids[start:min(start+loadChunk, len(ids))])
+		if err != nil {
+			log.Printf("Failed to load blotter updates: %v", err)
+			f.skip()
+			continue
+		}
+
+		f.mu.Lock()
+		for _, t := range trades {
+			f.seq++
+			f.hub.Publish(Update{Seq: f.seq, Trade: t})
+		}
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,228 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// Report timings
+const (
+	BeforeOpen   = "bmo"
+	AfterClose   = "amc"
+	DuringMarket = "dmh"
+)
+
+// Source provides earnings reports expected between two times
+type Source interface {
+	Name() string
+	Earnings(ctx context.Context, from, to time.Time) ([]database.EarningsEvent, error)
+}
+
+// ReportTime estimates when a report on date (YYYY-MM-DD, exchange time) is
+// released. Reports of unknown timing are assumed to land at the start of
+// the day so that windows around them err on the early side.
+func ReportTime(date, timing string) (time.Time, error) {
+	d, err := time.ParseInLocation("2006-01-02", date, market.Exchange)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid report date %q: %w", date, err)
+	}
+
+	hour, minute := 0, 0
+	switch timing {
+	case BeforeOpen:
+		hour = 8
+	case DuringMarket:
+		hour = 12
+	case AfterClose:
+		hour, minute = 16, 5
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, market.Exchange), nil
+}
+
+// Finnhub reads the earnings calendar from finnhub.io
+type Finnhub struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewFinnhub(apiKey string) *Finnhub {
+	return &Finnhub{
+		apiKey:  apiKey,
+		baseURL: "https://finnhub.io/api/v1",
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (f *Finnhub) Name() string {
+	return "finnhub"
+}
+
+func (f *Finnhub) Earnings(ctx context.Context, from, to time.Time) ([]database.EarningsEvent, error) {
+	q := url.Values{}
+	q.Set("from", market.SessionDate(from))
+	q.Set("to", market.SessionDate(to))
+	q.Set("token", f.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+"/calendar/earnings?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build earnings request: %w", err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch earnings calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("earnings calendar returned %s", resp.Status)
+	}
+
+	var body struct {
+		EarningsCalendar []struct {
+			Date        string   `json:"date"`
+			Hour        string   `json:"hour"`
+			Symbol      string   `json:"symbol"`
+			EPSEstimate *float64 `json:"epsEstimate"`
+		} `json:"earningsCalendar"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode earnings calendar: %w", err)
+	}
+
+	events := make([]database.EarningsEvent, 0, len(body.EarningsCalendar))
+	for _, e := range body.EarningsCalendar {
+		reportAt, err := ReportTime(e.Date, e.Hour)
+		if err != nil {
+			log.Printf("Skipping earnings event for %s: %v", e.Symbol, err)
+			continue
+		}
+		event := database.EarningsEvent{
+			Symbol:     strings.ToUpper(e.Symbol),
+			ReportDate: e.Date,
+			Timing:     e.Hour,
+			ReportAt:   reportAt,
+			Source:     f.Name(),
+		}
+		if e.EPSEstimate != nil {
+			eps := decimal.NewFromFloat(*e.EPSEstimate)
+			event.EPSEstimate = &eps
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// File reads earnings events from a JSON file, for clubs maintaining their
+// own calendar. The file is a list of {"symbol", "report_date", "timing",
+// "eps_estimate"} objects and is re-read on every refresh.
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Name() string {
+	return "file"
+}
+
+func (f *File) Earnings(ctx context.Context, from, to time.Time) ([]database.EarningsEvent, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read earnings calendar: %w", err)
+	}
+
+	var entries []struct {
+		Symbol      string           `json:"symbol"`
+		ReportDate  string           `json:"report_date"`
+		Timing      string           `json:"timing"`
+		EPSEstimate *decimal.Decimal `json:"eps_estimate"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse earnings calendar: %w", err)
+	}
+
+	var events []database.EarningsEvent
+	for _, e := range entries {
+		reportAt, err := ReportTime(e.ReportDate, e.Timing)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry for %s: %w", e.Symbol, err)
+		}
+		if reportAt.Before(from) || reportAt.After(to) {
+			continue
+		}
+		events = append(events, database.EarningsEvent{
+			Symbol:      strings.ToUpper(e.Symbol),
+			ReportDate:  e.ReportDate,
+			Timing:      e.Timing,
+			ReportAt:    reportAt,
+			EPSEstimate: e.EPSEstimate,
+			Source:      f.Name(),
+		})
+	}
+	return events, nil
+}
+
+// Refresher periodically copies upcoming earnings from a source into the
+// database
+type Refresher struct {
+	source  Source
+	db      *database.DB
+	horizon time.Duration
+}
+
+// NewRefresher creates a refresher that loads reports up to horizon ahead
+func NewRefresher(source Source, db *database.DB, horizon time.Duration) *Refresher {
+	return &Refresher{
+		source:  source,
+		db:      db,
+		horizon: horizon,
+	}
+}
+
+// Run refreshes the calendar every interval until ctx is cancelled
+func (r *Refresher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			log.Printf("Failed to refresh earnings calendar: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh loads reports from the start of today's session to the horizon
+func (r *Refresher) Refresh(ctx context.Context) error {
+	now := time.Now()
+	from, err := time.ParseInLocation("2006-01-02", market.SessionDate(now), market.Exchange)
+	if err != nil {
+		return err
+	}
+
+	events, err := r.source.Earnings(ctx, from, now.Add(r.horizon))
+	if err != nil {
+		return err
+	}
+	return r.db.UpsertEarningsEvents(events)
+}
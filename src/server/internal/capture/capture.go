@@ -0,0 +1,182 @@
+// Package capture records the request and broker response of failed orders,
+// so a rejection can be explained after the logs have rolled over. Capture
+// is opt-in: payloads are redacted of anything that looks like a credential
+// and cut to a size limit, and are deleted once they expire.
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+
+	"desk/internal/database"
+)
+
+// redacted replaces the value of a secret header or JSON field
+const redacted = "[REDACTED]"
+
+// secretWords mark header and field names whose values are redacted
+var secretWords = []string{"auth", "cookie", "key", "password", "secret", "signature", "token"}
+
+// Request is the order request as the desk received it. Body is JSON; binary
+// protobuf requests are captured in their JSON mapping.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Recorder stores captures of failed orders while enabled
+type Recorder struct {
+	db       *database.DB
+	ttl      time.Duration
+	maxBytes int
+	enabled  atomic.Bool
+}
+
+// NewRecorder creates a recorder that keeps captures for ttl and limits each
+// payload to maxBytes. It starts disabled.
+func NewRecorder(db *database.DB, ttl time.Duration, maxBytes int) *Recorder {
+	return &Recorder{db: db, ttl: ttl, maxBytes: maxBytes}
+}
+
+// SetEnabled turns capture on or off
+func (r *Recorder) SetEnabled(enabled bool) {
+	r.enabled.Store(enabled)
+}
+
+// Enabled reports whether failed orders are being captured
+func (r *Recorder) Enabled() bool {
+	return r.enabled.Load()
+}
+
+// Record captures the request of an order logged as rejected trade tradeID
+// and the error it failed with. Broker errors keep the broker's status and
+// response body; other errors are captured as their message.
+func (r *Recorder) Record(tradeID int64, userID string, req Request, reason error) {
+	if !r.Enabled() {
+		return
+	}
+
+	now := time.Now()
+	c := &database.OrderCapture{
+		TradeID:        tradeID,
+		UserID:         userID,
+		RequestMethod:  req.Method,
+		RequestPath:    req.Path,
+		RequestHeaders: redactHeaders(req.Header),
+		ErrorMessage:   reason.Error(),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(r.ttl),
+	}
+
+	var requestCut, responseCut bool
+	c.RequestBody, requestCut = r.limit(redactJSON(req.Body))
+	var apiErr *alpaca.APIError
+	if errors.As(reason, &apiErr) {
+		status := apiErr.StatusCode
+		c.ResponseStatus = &status
+		c.ResponseBody, responseCut = r.limit(redactJSON([]byte(apiErr.Body)))
+	}
+	c.Truncated = requestCut || responseCut
+
+	if err := r.db.SaveOrderCapture(c); err != nil {
+		log.Printf("Failed to capture failed order for trade ID=%d: %v", tradeID, err)
+	}
+}
+
+// Run deletes expired captures every interval until ctx is cancelled
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.db.PruneOrderCaptures(time.Now()); err != nil {
+			log.Printf("Failed to prune order captures: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// limit cuts s to the payload size limit, reporting whether it was cut
+func (r *Recorder) limit(s string) (string, bool) {
+	if r.maxBytes <= 0 || len(s) <= r.maxBytes {
+		return s, false
+	}
+	cut := r.maxBytes
+	// Don't split a UTF-8 sequence
+	for cut > 0 && s[cut]&0xc0 == 0x80 {
+		cut--
+	}
+	return s[:cut], true
+}
+
+// secret reports whether a header or field name looks like it holds a
+// credential
+func secret(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders flattens headers, redacting secret ones
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if secret(name) {
+			out[name] = redacted
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// redactJSON redacts secret fields anywhere in a JSON document. A body that
+// isn't JSON is kept as it is.
+func redactJSON(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if secret(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,233 @@
+package carry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/symbols"
+)
+
+// dayCountBasis is the ACT/360 convention brokers use for borrow fees and
+// margin interest
+var dayCountBasis = decimal.NewFromInt(360)
+
+// PriceSource supplies the marks short positions are valued at
+type PriceSource interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// Rates are annual carry rates as fractions (0.05 is 5%)
+type Rates struct {
+	// Borrow is the fee on the value of short positions, unless the symbol
+	// has its own rate in BorrowBySymbol (e.g. hard-to-borrow names)
+	Borrow         decimal.Decimal
+	BorrowBySymbol map[string]decimal.Decimal
+	// Margin is the interest on a negative cash balance
+	Margin decimal.Decimal
+}
+
+// BorrowRate returns the borrow fee rate for symbol
+func (r Rates) BorrowRate(symbol string) decimal.Decimal {
+	if rate, ok := r.BorrowBySymbol[symbol]; ok {
+		return rate
+	}
+	return r.Borrow
+}
+
+// Enabled reports whether any carry accrues at these rates
+func (r Rates) Enabled() bool {
+	if r.Borrow.IsPositive() || r.Margin.IsPositive() {
+		return true
+	}
+	for _, rate := range r.BorrowBySymbol {
+		if rate.IsPositive() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBorrowRates parses per-symbol borrow rates in the form
+// "GME=0.25,AMC=0.15"
+func ParseBorrowRates(s string) (map[string]decimal.Decimal, error) {
+	rates := make(map[string]decimal.Decimal)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		symbol, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not SYMBOL=rate", entry)
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(v))
+		if err != nil || rate.IsNegative() {
+			return nil, fmt.Errorf("invalid rate for %s: %q", symbol, v)
+		}
+		rates[symbols.Normalize(symbol)] = rate
+	}
+	return rates, nil
+}
+
+// Result summarizes one accrual
+type Result struct {
+	SessionDate    string          `json:"session_date"`
+	Days           int             `json:"days"`
+	Books          int             `json:"books"`
+	BorrowFees     decimal.Decimal `json:"borrow_fees"`
+	MarginInterest decimal.Decimal `json:"margin_interest"`
+	Failed         int             `json:"failed"`
+}
+
+// Accruer charges carry to each user/strategy book after the close: borrow
+// fees on short positions and margin interest on negative cash. Both accrue
+// for every calendar day until the next session, so Friday's accrual covers
+// the weekend.
+type Accruer struct {
+	db       *database.DB
+	prices   PriceSource
+	notifier notify.Notifier
+
+	mu    sync.RWMutex
+	rates Rates
+}
+
+func NewAccruer(db *database.DB, prices PriceSource, notifier notify.Notifier) *Accruer {
+	return &Accruer{
+		db:       db,
+		prices:   prices,
+		notifier: notifier,
+	}
+}
+
+// Rates returns the rates carry accrues at
+func (a *Accruer) Rates() Rates {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.rates
+}
+
+// SetRates changes the rates; the next accrual uses them
+func (a *Accruer) SetRates(rates Rates) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rates = rates
+}
+
+// accrualDays is the number of calendar days from a session date to the next
+// weekday session
+func accrualDays(sessionDate string) (int, error) {
+	day, err := time.Parse("2006-01-02", sessionDate)
+	if err != nil {
+		return 0, err
+	}
+	days := 1
+	for next := day.AddDate(0, 0, 1); next.Weekday() == time.Saturday || next.Weekday() == time.Sunday; next = next.AddDate(0, 0, 1) {
+		days++
+	}
+	return days, nil
+}
+
+// Accrue charges carry for a session to every book that owes any. Books
+// already accrued for the session are skipped, so it is safe to re-run.
+func (a *Accruer) Accrue(ctx context.Context, sessionDate string) (*Result, error) {
+	days, err := accrualDays(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{SessionDate: sessionDate, Days: days}
+
+	rates := a.Rates()
+	if !rates.Enabled() {
+		return result, nil
+	}
+
+	positions, err := a.db.GetOpenPositionCosts()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := a.db.CashBalances(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	shorts := make(map[database.CashBook][]database.PositionCost)
+	for _, p := range positions {
+		if p.Qty.IsNegative() {
+			shorts[p.CashBook] = append(shorts[p.CashBook], p)
+		}
+	}
+	books := make(map[database.CashBook]bool)
+	for book := range shorts {
+		books[book] = true
+	}
+	for book := range balances {
+		books[book] = true
+	}
+
+	factor := decimal.NewFromInt(int64(days)).Div(dayCountBasis)
+	marks := make(map[string]decimal.Decimal)
+	for book := range books {
+		borrowFees := make(map[string]decimal.Decimal)
+		for _, p := range shorts[book] {
+			rate := rates.BorrowRate(p.Symbol)
+			if !rate.IsPositive() {
+				continue
+			}
+			mark, ok := marks[p.Symbol]
+			if !ok {
+				if mark, err = a.prices.LatestPrice(p.Symbol); err != nil {
+					log.Printf("Failed to mark %s for borrow fees, using cost: %v", p.Symbol, err)
+					mark = p.AvgCost
+				}
+				marks[p.Symbol] = mark
+			}
+			borrowFees[p.Symbol] = p.Qty.Abs().Mul(mark).Mul(rate).Mul(factor).Round(4)
+		}
+
+		marginInterest := decimal.Zero
+		if balance := balances[book]; balance.IsNegative() {
+			marginInterest = balance.Abs().Mul(rates.Margin).Mul(factor).Round(4)
+		}
+
+		if len(borrowFees) == 0 && marginInterest.IsZero() {
+			continue
+		}
+		accrued, err := a.db.CarryAccrued(sessionDate, book)
+		if err != nil || accrued {
+			if err != nil {
+				log.Printf("Failed to check carry for user=%s strategy=%d: %v", book.UserID, book.StrategyID, err)
+				result.Failed++
+			}
+			continue
+		}
+
+		if err := a.db.RecordCarry(sessionDate, book, borrowFees, marginInterest); err != nil {
+			log.Printf("Failed to record carry for user=%s strategy=%d: %v", book.UserID, book.StrategyID, err)
+			result.Failed++
+			continue
+		}
+		result.Books++
+		for _, fee := range borrowFees {
+			result.BorrowFees = result.BorrowFees.Add(fee)
+		}
+		result.MarginInterest = result.MarginInterest.Add(marginInterest)
+	}
+
+	if result.Failed > 0 {
+		notify.Send(ctx, a.notifier, notify.LevelError, "Carry accrual incomplete",
+			fmt.Sprintf("Carry for %d books could not be recorded for %s", result.Failed, sessionDate))
+	}
+
+	log.Printf("Accrued carry for %s (%d days): books=%d borrow_fees=%s margin_interest=%s failed=%d",
+		sessionDate, days, result.Books, result.BorrowFees, result.MarginInterest, result.Failed)
+	return result, nil
+}
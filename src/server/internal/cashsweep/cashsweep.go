@@ -0,0 +1,140 @@
+// Package cashsweep manages the desk's uninvested cash. Rules keep a floor
+// of cash on hand and sweep cash above a share of equity into a cash-like
+// fund, such as BIL, selling the fund again when cash runs below the floor.
+// Sweeps are booked to their own book with their own order source, so
+// attribution can tell them apart from members' trades.
+package cashsweep
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/orders"
+	"desk/internal/symbols"
+)
+
+// What is done with a sweep the rules call for
+const (
+	// ActionPropose notifies the sweep, leaving it to a human to place
+	ActionPropose = "propose"
+	// ActionExecute places the sweep
+	ActionExecute = "execute"
+)
+
+// DefaultSymbol is the fund cash is swept into unless configured otherwise
+const DefaultSymbol = "BIL"
+
+// Rule names, as recorded on a sweep
+const (
+	RuleMinCash    = "min_cash"
+	RuleMaxCashPct = "max_cash_pct"
+)
+
+// Rules bound the desk's uninvested cash. Zero disables a rule.
+type Rules struct {
+	// MinCash is the cash to keep uninvested; below it the fund is sold
+	MinCash decimal.Decimal `json:"min_cash"`
+	// MaxCashPct is the share of equity, in percent, cash may make up;
+	// above it the excess is swept into the fund
+	MaxCashPct decimal.Decimal `json:"max_cash_pct"`
+	// Symbol is the fund swept into
+	Symbol string `json:"symbol"`
+}
+
+// Enabled reports whether any cash rule is set
+func (r Rules) Enabled() bool {
+	return r.MinCash.IsPositive() || r.MaxCashPct.IsPositive()
+}
+
+// ValidSymbol checks that symbol can be swept into: an equity, such as a
+// Treasury bill ETF, not an option or crypto
+func ValidSymbol(symbol string) error {
+	symbol = symbols.Normalize(symbol)
+	if symbol == "" || orders.AssetClassOf(symbol) != orders.AssetClassEquity {
+		return fmt.Errorf("%q is not an equity fund", symbol)
+	}
+	return nil
+}
+
+// Sweep is the rules' verdict on the desk's cash: the band cash may sit in
+// and, outside it, the order in the fund that brings it back
+type Sweep struct {
+	Symbol string          `json:"symbol"`
+	Cash   decimal.Decimal `json:"cash"`
+	Equity decimal.Decimal `json:"equity"`
+	// Floor is MinCash and Ceiling MaxCashPct of equity, never below the
+	// floor; zero is no bound
+	Floor   decimal.Decimal `json:"floor"`
+	Ceiling decimal.Decimal `json:"ceiling"`
+	// Held is the fund the sweep book holds, the most a sweep sells
+	Held  decimal.Decimal `json:"held"`
+	Price decimal.Decimal `json:"price"`
+	// Rule is the rule the sweep answers; it and the order are empty when
+	// cash is within the band
+	Rule     string          `json:"rule,omitempty"`
+	Side     string          `json:"side,omitempty"`
+	Qty      decimal.Decimal `json:"qty"`
+	Notional decimal.Decimal `json:"notional"`
+	// Error says why a sweep the rules call for can't be made
+	Error string `json:"error,omitempty"`
+}
+
+// Due reports whether there is an order to place
+func (s *Sweep) Due() bool {
+	return s.Side != "" && s.Qty.IsPositive()
+}
+
+// Describe summarises the sweep for notifications and checklist runs
+func (s *Sweep) Describe() string {
+	band := "at least " + s.Floor.StringFixed(2)
+	if s.Ceiling.IsPositive() {
+		band = fmt.Sprintf("between %s and %s", s.Floor.StringFixed(2), s.Ceiling.StringFixed(2))
+	}
+	msg := fmt.Sprintf("cash is %s, %s is kept", s.Cash.StringFixed(2), band)
+	if s.Due() {
+		msg += fmt.Sprintf("; %s %s %s (about $%s) for %s", s.Side, s.Qty, s.Symbol, s.Notional.StringFixed(2), s.Rule)
+	}
+	if s.Error != "" {
+		msg += "; " + s.Error
+	}
+	return msg
+}
+
+// Plan applies the rules to the account's cash and equity. held is the
+// fund the sweep book holds and price the fund's price. Cash below the
+// floor sells enough of the fund to restore it, as far as the book holds
+// any; cash above the ceiling buys the fund with the excess, in whole
+// shares.
+func Plan(rules Rules, cash, equity, held, price decimal.Decimal) *Sweep {
+	s := &Sweep{Symbol: rules.Symbol, Cash: cash, Equity: equity, Floor: rules.MinCash, Held: held, Price: price}
+	if rules.MaxCashPct.IsPositive() && equity.IsPositive() {
+		s.Ceiling = decimal.Max(equity.Mul(rules.MaxCashPct).Div(decimal.NewFromInt(100)).Round(2), s.Floor)
+	}
+
+	var amount decimal.Decimal
+	switch {
+	case s.Floor.IsPositive() && cash.LessThan(s.Floor):
+		s.Rule, s.Side, amount = RuleMinCash, "sell", s.Floor.Sub(cash)
+		if !held.IsPositive() {
+			s.Error = fmt.Sprintf("cash is below the minimum but no %s is held to sell", rules.Symbol)
+			return s
+		}
+	case s.Ceiling.IsPositive() && cash.GreaterThan(s.Ceiling):
+		s.Rule, s.Side, amount = RuleMaxCashPct, "buy", cash.Sub(s.Ceiling)
+	default:
+		return s
+	}
+	if !price.IsPositive() {
+		s.Error = fmt.Sprintf("no price for %s to size the sweep", rules.Symbol)
+		return s
+	}
+
+	if s.Side == "sell" {
+		s.Qty = decimal.Min(amount.Div(price).Ceil(), held)
+	} else {
+		s.Qty = amount.Div(price).Floor()
+	}
+	s.Notional = s.Qty.Mul(price).Round(2)
+	return s
+}
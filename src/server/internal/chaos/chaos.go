@@ -0,0 +1,142 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/orders"
+)
+
+// ErrInjectedReject is returned for orders the injector rejects
+var ErrInjectedReject = errors.New("chaos: injected broker rejection")
+
+// Config describes the adverse conditions to inject
+type Config struct {
+	// Latency is added before every order reaches the venue, plus a random
+	// amount up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// RejectRate is the fraction of orders rejected before reaching the
+	// venue
+	RejectRate float64
+
+	// PartialFillRate is the fraction of filled orders reported back as
+	// only partially filled. The venue still holds the full fill, so the
+	// desk's view lags the broker until the order is reconciled.
+	PartialFillRate float64
+}
+
+// PlaceFunc places an order at a venue
+type PlaceFunc func(order *orders.Order) (*alpaca.Order, error)
+
+// PaperHost is the host of Alpaca's paper trading API
+const PaperHost = "paper-api.alpaca.markets"
+
+// PaperOnly reports an error unless baseURL is Alpaca's paper trading API,
+// or one of allowed, the hosts (with any port) of test servers an operator
+// has explicitly vouched for. Chaos mode must never run against a live
+// account.
+func PaperOnly(baseURL string, allowed ...string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("chaos mode requires the paper trading API, not %q", baseURL)
+	}
+	if u.Scheme == "https" && u.Host == PaperHost {
+		return nil
+	}
+	for _, host := range allowed {
+		if host != "" && u.Host == host {
+			return nil
+		}
+	}
+	return fmt.Errorf("chaos mode requires the paper trading API, not %s", baseURL)
+}
+
+// Injector wraps order placement with artificial latency, rejections and
+// partial fills
+type Injector struct {
+	cfg Config
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func New(cfg Config, seed int64) *Injector {
+	return &Injector{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Wrap returns place with the configured faults injected
+func (i *Injector) Wrap(place PlaceFunc) PlaceFunc {
+	return func(order *orders.Order) (*alpaca.Order, error) {
+		delay, reject, partial := i.roll()
+
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		if reject {
+			log.Printf("Chaos: rejecting %s %s %s", order.Side, order.Qty, order.Symbol)
+			return nil, ErrInjectedReject
+		}
+
+		placed, err := place(order)
+		if err != nil || placed.Status != "filled" || partial <= 0 {
+			return placed, err
+		}
+
+		filled := partialQty(placed.FilledQty, partial)
+		if filled.IsZero() {
+			return placed, nil
+		}
+
+		log.Printf("Chaos: reporting order %s as partially filled (%s of %s)", placed.ID, filled, placed.FilledQty)
+		reported := *placed
+		reported.Status = "partially_filled"
+		reported.FilledQty = filled
+		reported.FilledAt = nil
+		return &reported, nil
+	}
+}
+
+// roll draws the faults for one order. partial is the fraction of the fill
+// to report, or zero for a complete fill.
+func (i *Injector) roll() (delay time.Duration, reject bool, partial float64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delay = i.cfg.Latency
+	if i.cfg.Jitter > 0 {
+		delay += time.Duration(i.rng.Int63n(int64(i.cfg.Jitter)))
+	}
+	reject = i.rng.Float64() < i.cfg.RejectRate
+	if i.rng.Float64() < i.cfg.PartialFillRate {
+		partial = 0.1 + 0.8*i.rng.Float64()
+	}
+	return delay, reject, partial
+}
+
+// partialQty is fraction of qty, in whole shares when qty is whole. It is
+// zero when no smaller positive quantity can be reported.
+func partialQty(qty decimal.Decimal, fraction float64) decimal.Decimal {
+	part := qty.Mul(decimal.NewFromFloat(fraction))
+	if qty.IsInteger() {
+		part = part.Floor()
+	} else {
+		part = part.Truncate(4)
+	}
+	if !part.IsPositive() || part.GreaterThanOrEqual(qty) {
+		return decimal.Zero
+	}
+	return part
+}
@@ -0,0 +1,33 @@
+package chaos
+
+import "testing"
+
+func TestPaperOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		allowed []string
+		ok      bool
+	}{
+		{"paper", "https://paper-api.alpaca.markets", nil, true},
+		{"paper with path", "https://paper-api.alpaca.markets/v2", nil, true},
+		{"live", "https://api.alpaca.markets", nil, false},
+		{"paper in the path", "https://api.alpaca.markets/paper-api.", nil, false},
+		{"paper as a subdomain", "https://paper-api.alpaca.markets.example.com", nil, false},
+		{"paper in the user info", "https://paper-api.alpaca.markets@api.alpaca.markets", nil, false},
+		{"plain http", "http://paper-api.alpaca.markets", nil, false},
+		{"not a URL", "paper-api.alpaca.markets", nil, false},
+		{"test server not allowed", "http://127.0.0.1:8089", nil, false},
+		{"test server allowed", "http://127.0.0.1:8089", []string{"127.0.0.1:8089"}, true},
+		{"test server on another port", "http://127.0.0.1:9000", []string{"127.0.0.1:8089"}, false},
+		{"empty allowance", "http://127.0.0.1:8089", []string{""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PaperOnly(tt.baseURL, tt.allowed...)
+			if (err == nil) != tt.ok {
+				t.Errorf("PaperOnly(%q, %q) = %v, want ok %v", tt.baseURL, tt.allowed, err, tt.ok)
+			}
+		})
+	}
+}
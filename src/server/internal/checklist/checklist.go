@@ -0,0 +1,196 @@
+// Package checklist runs the desk's daily procedures: checks before the open
+// that the desk is fit to trade, and tasks after the close that settle the
+// session. A checklist is a list of steps run in order at a set time every
+// session. Each run is stored as it progresses, so the dashboard shows what
+// ran, what failed and why, and a failed run raises a notification.
+package checklist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/scheduler"
+)
+
+// Run and step statuses
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+var (
+	// ErrUnknown is returned when running a checklist that doesn't exist
+	ErrUnknown = errors.New("unknown checklist")
+	// ErrRunning is returned when running a checklist that is already running
+	ErrRunning = errors.New("checklist is already running")
+)
+
+// errSkipped marks a step that had nothing to do
+var errSkipped = errors.New("skipped")
+
+// Skip is returned by a step that has nothing to do this session, such as a
+// Friday-only task, with the reason
+func Skip(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errSkipped, fmt.Sprintf(format, args...))
+}
+
+// Step is one check or task. Run returns a short description of what it
+// found or did; an error fails the step.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, date string) (string, error)
+}
+
+// Checklist is a named list of steps run at At(date) every session. Every
+// step runs even if an earlier one failed: checks are independent, and a
+// close task failing shouldn't hold back the rest of the close.
+type Checklist struct {
+	Name  string
+	Title string
+	At    func(date string) (time.Time, error)
+	Steps []Step
+}
+
+// Runner runs checklists on schedule or on demand, one run of a checklist at
+// a time
+type Runner struct {
+	db       *database.DB
+	notifier notify.Notifier
+	lists    []*Checklist
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewRunner(db *database.DB, notifier notify.Notifier, lists ...*Checklist) *Runner {
+	return &Runner{
+		db:       db,
+		notifier: notifier,
+		lists:    lists,
+		clock:    clock.System,
+		running:  make(map[string]bool),
+	}
+}
+
+// SetClock changes the clock checklists are scheduled and timed on. It must
+// be called before Start.
+func (r *Runner) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Start schedules every checklist until ctx is cancelled
+func (r *Runner) Start(ctx context.Context) {
+	for _, list := range r.lists {
+		go scheduler.EverySession(ctx, r.clock, list.Title, list.At, func(ctx context.Context, date string) {
+			if _, err := r.Run(ctx, list.Name, date); err != nil {
+				log.Printf("Failed to run %s for %s: %v", list.Title, date, err)
+			}
+		})
+	}
+}
+
+// Run runs a checklist for a session date now and returns the finished run.
+// It fails if the checklist is already running.
+func (r *Runner) Run(ctx context.Context, name, date string) (*database.ChecklistRun, error) {
+	var list *Checklist
+	for _, l := range r.lists {
+		if l.Name == name {
+			list = l
+		}
+	}
+	if list == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknown, name)
+	}
+
+	r.mu.Lock()
+	if r.running[name] {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrRunning, name)
+	}
+	r.running[name] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, name)
+		r.mu.Unlock()
+	}()
+
+	run := &database.ChecklistRun{
+		Checklist:   name,
+		SessionDate: date,
+		Status:      StatusRunning,
+		StartedAt:   r.clock.Now(),
+		Steps:       make([]database.ChecklistStep, len(list.Steps)),
+	}
+	for i, step := range list.Steps {
+		run.Steps[i] = database.ChecklistStep{Name: step.Name, Status: StatusPending}
+	}
+	if err := r.db.StartChecklistRun(run); err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for i, step := range list.Steps {
+		result := r.runStep(ctx, run.ID, i, step, date)
+		run.Steps[i] = result
+		if result.Status == StatusFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", step.Name, result.Detail))
+		}
+	}
+
+	run.Status = StatusPassed
+	if len(failed) > 0 {
+		run.Status = StatusFailed
+	}
+	finishedAt := r.clock.Now()
+	run.FinishedAt = &finishedAt
+	if err := r.db.FinishChecklistRun(run.ID, run.Status, finishedAt); err != nil {
+		log.Printf("Failed to record %s for %s: %v", list.Title, date, err)
+	}
+
+	log.Printf("Ran %s for %s: %s", list.Title, date, run.Status)
+	if len(failed) > 0 {
+		notify.Send(ctx, r.notifier, notify.LevelError, list.Title+" failed",
+			fmt.Sprintf("%d of %d steps failed for %s: %s", len(failed), len(list.Steps), date, strings.Join(failed, "; ")))
+	}
+	return run, nil
+}
+
+// runStep runs one step, recording it as running and then its outcome
+func (r *Runner) runStep(ctx context.Context, runID int64, seq int, step Step, date string) database.ChecklistStep {
+	startedAt := r.clock.Now()
+	result := database.ChecklistStep{Name: step.Name, Status: StatusRunning, StartedAt: &startedAt}
+	if err := r.db.UpdateChecklistStep(runID, seq, result); err != nil {
+		log.Printf("Failed to record checklist step %s: %v", step.Name, err)
+	}
+
+	detail, err := step.Run(ctx, date)
+	switch {
+	case errors.Is(err, errSkipped):
+		result.Status, result.Detail = StatusSkipped, strings.TrimPrefix(err.Error(), errSkipped.Error()+": ")
+	case err != nil:
+		result.Status, result.Detail = StatusFailed, err.Error()
+		log.Printf("Checklist step %s failed for %s: %v", step.Name, date, err)
+	default:
+		result.Status, result.Detail = StatusPassed, detail
+	}
+	finishedAt := r.clock.Now()
+	result.FinishedAt = &finishedAt
+
+	if err := r.db.UpdateChecklistStep(runID, seq, result); err != nil {
+		log.Printf("Failed to record checklist step %s: %v", step.Name, err)
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+// Package clock timestamps orders for latency analysis. Timestamps come
+// from the monotonic clock, anchored to the wall clock once at startup, so
+// they never go backwards or jump when the system clock is stepped, and the
+// intervals between them are exact. A Checker compares the anchored clock
+// with NTP and with the system clock and reports drift.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	// anchor carries the wall time at startup and a monotonic reading
+	anchor = time.Now()
+
+	mu   sync.Mutex
+	last int64
+)
+
+// Now returns the current time on the anchored monotonic clock, in UTC.
+// Successive calls return strictly increasing microseconds, so timestamps
+// stored to the microsecond keep the order events happened in.
+func Now() time.Time {
+	us := anchor.Add(time.Since(anchor)).UnixMicro()
+
+	mu.Lock()
+	if us <= last {
+		us = last + 1
+	}
+	last = us
+	mu.Unlock()
+
+	return time.UnixMicro(us).UTC()
+}
+
+// SystemDrift returns how far the system wall clock has moved from the
+// anchored clock since startup, e.g. because NTP stepped it
+func SystemDrift() time.Duration {
+	wall := time.Now()
+	return wall.Round(0).Sub(anchor.Add(wall.Sub(anchor)).Round(0))
+}
@@ -0,0 +1,209 @@
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"desk/internal/notify"
+)
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the
+// Unix epoch
+const ntpEpochOffset = 2208988800
+
+// QueryNTP asks an NTP server for the time once and returns the offset of
+// the anchored clock from it (positive when the desk is behind) and the
+// round trip time of the query
+func QueryNTP(ctx context.Context, server string) (time.Duration, time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to reach NTP server: %w", err)
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	// SNTP client request: leap indicator 0, version 4, mode 3. The
+	// transmit timestamp is echoed back as the originate timestamp.
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3
+	sent := Now()
+	binary.BigEndian.PutUint64(req[40:], toNTP(sent))
+	if _, err := conn.Write(req); err != nil {
+		return 0, 0, fmt.Errorf("failed to query NTP server: %w", err)
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := Now()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read NTP response: %w", err)
+	}
+	if n < 48 {
+		return 0, 0, errors.New("short NTP response")
+	}
+	if mode := resp[0] & 7; mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if stratum := resp[1]; stratum == 0 || stratum > 15 {
+		return 0, 0, fmt.Errorf("NTP server is unsynchronized (stratum %d)", stratum)
+	}
+	if binary.BigEndian.Uint64(resp[24:]) != toNTP(sent) {
+		return 0, 0, errors.New("NTP response doesn't match the request")
+	}
+
+	serverReceived := fromNTP(binary.BigEndian.Uint64(resp[32:]))
+	serverSent := fromNTP(binary.BigEndian.Uint64(resp[40:]))
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	rtt := received.Sub(sent) - serverSent.Sub(serverReceived)
+	return offset, rtt, nil
+}
+
+func toNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTP(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64((v & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos).UTC()
+}
+
+// Status is the latest clock check
+type Status struct {
+	Server         string     `json:"server,omitempty"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+	NTPOffsetMs    *float64   `json:"ntp_offset_ms,omitempty"`
+	RoundTripMs    *float64   `json:"round_trip_ms,omitempty"`
+	SystemDriftMs  float64    `json:"system_drift_ms"`
+	MaxOffsetMs    float64    `json:"max_offset_ms"`
+	Error          string     `json:"error,omitempty"`
+	Warnings       []string   `json:"warnings"`
+	lastSuccessful time.Time
+}
+
+// Checker periodically compares the anchored clock with an NTP server and
+// with the system clock, warning when either is further off than maxOffset
+type Checker struct {
+	server    string
+	interval  time.Duration
+	maxOffset time.Duration
+	notifier  notify.Notifier
+
+	mu     sync.Mutex
+	status Status
+	warned bool
+}
+
+// NewChecker creates a checker; with an empty server only the system clock
+// is compared
+func NewChecker(server string, interval, maxOffset time.Duration, notifier notify.Notifier) *Checker {
+	return &Checker{
+		server:    server,
+		interval:  interval,
+		maxOffset: maxOffset,
+		notifier:  notifier,
+		status:    Status{Server: server},
+	}
+}
+
+// Run checks the clock every interval until ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check queries NTP once and notifies when the clock goes out of bounds
+func (c *Checker) Check(ctx context.Context) {
+	var offset, rtt time.Duration
+	var err error
+	if c.server != "" {
+		queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		offset, rtt, err = QueryNTP(queryCtx, c.server)
+		cancel()
+	}
+
+	c.mu.Lock()
+	now := Now()
+	c.status.CheckedAt = &now
+	c.status.Error = ""
+	if err != nil {
+		c.status.Error = err.Error()
+		log.Printf("Clock check against %s failed: %v", c.server, err)
+	} else if c.server != "" {
+		c.status.NTPOffsetMs, c.status.RoundTripMs = ms(offset), ms(rtt)
+		c.status.lastSuccessful = now
+	}
+	warnings := c.warnings()
+	notifyWarn := len(warnings) > 0 && !c.warned
+	c.warned = len(warnings) > 0
+	c.mu.Unlock()
+
+	if notifyWarn {
+		notify.Send(ctx, c.notifier, notify.LevelWarning, "Clock drift", warnings[0])
+	}
+}
+
+// Status returns the latest check with current warnings
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.status
+	s.SystemDriftMs = *ms(SystemDrift())
+	s.MaxOffsetMs = *ms(c.maxOffset)
+	s.Warnings = c.warnings()
+	return s
+}
+
+// warnings explains how the clock is out of bounds. c.mu must be held.
+func (c *Checker) warnings() []string {
+	warnings := []string{}
+	if drift := SystemDrift(); drift.Abs() > c.maxOffset {
+		warnings = append(warnings, fmt.Sprintf(
+			"system clock has moved %s from the timestamp clock since startup; restart to re-anchor timestamps", drift.Round(time.Millisecond)))
+	}
+	if c.server == "" {
+		return warnings
+	}
+	if s := c.status; s.NTPOffsetMs != nil && time.Duration(*s.NTPOffsetMs*float64(time.Millisecond)).Abs() > c.maxOffset {
+		warnings = append(warnings, fmt.Sprintf("timestamps are %.1fms off %s (max %s)", *s.NTPOffsetMs, c.server, c.maxOffset))
+	}
+	if c.status.lastSuccessful.IsZero() || Now().Sub(c.status.lastSuccessful) > 3*c.interval {
+		if c.status.Error != "" {
+			warnings = append(warnings, "clock can't be checked against NTP: "+c.status.Error)
+		} else if c.status.CheckedAt != nil {
+			warnings = append(warnings, "clock hasn't been checked against NTP recently")
+		}
+	}
+	return warnings
+}
+
+func ms(d time.Duration) *float64 {
+	v := float64(d.Microseconds()) / 1000
+	return &v
+}
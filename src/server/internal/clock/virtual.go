@@ -0,0 +1,110 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for it. The scheduler, checklists and
+// simulator take one rather than calling time.Now, so tests and replays can
+// run them on a Virtual clock and step across session boundaries.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// System is the system wall clock
+var System Clock = system{}
+
+type system struct{}
+
+func (system) Now() time.Time                         { return time.Now() }
+func (system) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// waiter is a pending After on a virtual clock
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// Virtual is a clock that only moves when it is advanced. Waits due by the
+// new time fire in the order they are due, each receiving its deadline.
+type Virtual struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+// NewVirtual returns a virtual clock stopped at start
+func NewVirtual(start time.Time) *Virtual {
+	v := &Virtual{now: start}
+	v.changed = sync.NewCond(&v.mu)
+	return v
+}
+
+func (v *Virtual) Now() time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.now
+}
+
+func (v *Virtual) After(d time.Duration) <-chan time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- v.now
+		return ch
+	}
+	v.waiters = append(v.waiters, waiter{at: v.now.Add(d), ch: ch})
+	// Keep waiters due first at the front, in the order they were added
+	// when due together
+	sort.SliceStable(v.waiters, func(i, j int) bool { return v.waiters[i].at.Before(v.waiters[j].at) })
+	v.changed.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d
+func (v *Virtual) Advance(d time.Duration) {
+	v.Set(v.Now().Add(d))
+}
+
+// Set moves the clock to t, firing every wait due by then. The clock never
+// goes backwards; an earlier t is ignored.
+func (v *Virtual) Set(t time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for len(v.waiters) > 0 && !v.waiters[0].at.After(t) {
+		w := v.waiters[0]
+		v.waiters = v.waiters[1:]
+		v.now = w.at
+		w.ch <- w.at
+	}
+	if t.After(v.now) {
+		v.now = t
+	}
+	v.changed.Broadcast()
+}
+
+// Waiting returns the number of waits that haven't fired
+func (v *Virtual) Waiting() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.waiters)
+}
+
+// BlockUntil waits until at least n waits are pending, so a caller driving
+// the clock knows the goroutines it is stepping have gone back to sleep
+// before advancing it again
+func (v *Virtual) BlockUntil(n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for len(v.waiters) < n {
+		v.changed.Wait()
+	}
+}
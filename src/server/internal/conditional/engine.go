@@ -0,0 +1,310 @@
+package conditional
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/indicators"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/scheduler"
+)
+
+// Trigger types
+const (
+	PriceAbove = "price_above"
+	PriceBelow = "price_below"
+	RSIAbove   = "rsi_above"
+	RSIBelow   = "rsi_below"
+	AtTime     = "at_time"
+)
+
+// missedGrace is how late a timed order may still be submitted, e.g. when
+// the desk restarts moments after its scheduled time. Orders missed by more
+// than this are marked failed rather than sent at the wrong time.
+const missedGrace = time.Minute
+
+// Defaults for RSI triggers
+const (
+	DefaultRSIPeriod = 14
+	DefaultTimeframe = "1Day"
+)
+
+var timeframes = map[string]bool{"1Min": true, "1Hour": true, "1Day": true}
+
+// rsiHistory is how many bars beyond the period are fetched so Wilder
+// smoothing has settled
+const rsiHistory = 100
+
+// MarketData provides the prices and bars triggers are evaluated against
+type MarketData interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+	RecentCloses(symbol, timeframe string, n int) ([]decimal.Decimal, error)
+}
+
+// SubmitFunc places an order through the desk's normal order path
+type SubmitFunc func(userID string, strategyID *int64, order *orders.Order) (*database.Trade, error)
+
+// ValidateTrigger checks a conditional order's trigger and fills in RSI
+// defaults
+func ValidateTrigger(co *database.ConditionalOrder) error {
+	switch co.TriggerType {
+	case PriceAbove, PriceBelow:
+		if !co.TriggerValue.IsPositive() {
+			return fmt.Errorf("trigger value must be a positive price")
+		}
+		co.RSIPeriod = 0
+		co.Timeframe = ""
+		co.TriggerAt = nil
+	case RSIAbove, RSIBelow:
+		if co.TriggerValue.IsNegative() || co.TriggerValue.GreaterThan(decimal.NewFromInt(100)) {
+			return fmt.Errorf("RSI trigger value must be between 0 and 100")
+		}
+		if co.RSIPeriod == 0 {
+			co.RSIPeriod = DefaultRSIPeriod
+		}
+		if co.RSIPeriod < 2 || co.RSIPeriod > 200 {
+			return fmt.Errorf("RSI period must be between 2 and 200")
+		}
+		if co.Timeframe == "" {
+			co.Timeframe = DefaultTimeframe
+		}
+		if !timeframes[co.Timeframe] {
+			return fmt.Errorf("timeframe must be 1Min, 1Hour or 1Day")
+		}
+		co.TriggerAt = nil
+	case AtTime:
+		if co.TriggerAt == nil {
+			return fmt.Errorf("at is required for at_time triggers")
+		}
+		if !co.TriggerAt.After(time.Now()) {
+			return fmt.Errorf("scheduled time must be in the future")
+		}
+		co.TriggerValue = decimal.Zero
+		co.RSIPeriod = 0
+		co.Timeframe = ""
+	default:
+		return fmt.Errorf("unknown trigger type %q", co.TriggerType)
+	}
+	return nil
+}
+
+// Engine watches pending conditional orders and submits them when their
+// trigger fires. Market triggers are polled; timed orders are held in
+// one-shot timers so they fire on the second. Orders live in the database,
+// so pending orders survive a restart and are picked up again by Run.
+type Engine struct {
+	db       *database.DB
+	data     MarketData
+	submit   SubmitFunc
+	notifier notify.Notifier
+	interval time.Duration
+	timers   *scheduler.Timers[int64]
+}
+
+func NewEngine(db *database.DB, data MarketData, submit SubmitFunc, notifier notify.Notifier, interval time.Duration) *Engine {
+	return &Engine{
+		db:       db,
+		data:     data,
+		submit:   submit,
+		notifier: notifier,
+		interval: interval,
+		timers:   scheduler.NewTimers[int64](),
+	}
+}
+
+// Run schedules pending timed orders and evaluates market triggers every
+// interval until ctx is cancelled
+func (e *Engine) Run(ctx context.Context) {
+	if err := e.scheduleTimed(); err != nil {
+		log.Printf("Failed to schedule timed orders: %v", err)
+	}
+	defer e.timers.Stop()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Check(ctx); err != nil {
+			log.Printf("Failed to check conditional orders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check evaluates every pending conditional order once. Market data is
+// fetched once per symbol (and per RSI setting) however many orders use it.
+func (e *Engine) Check(ctx context.Context) error {
+	pending, err := e.db.GetPendingConditionalOrders()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]decimal.Decimal{}
+	failed := map[string]bool{}
+	for i := range pending {
+		co := &pending[i]
+		if co.TriggerType == AtTime {
+			continue
+		}
+
+		key := co.Symbol
+		if co.TriggerType == RSIAbove || co.TriggerType == RSIBelow {
+			key = fmt.Sprintf("%s|rsi|%d|%s", co.Symbol, co.RSIPeriod, co.Timeframe)
+		}
+		if failed[key] {
+			continue
+		}
+		value, ok := values[key]
+		if !ok {
+			if value, err = e.observe(co); err != nil {
+				log.Printf("Failed to evaluate trigger for conditional order %d: %v", co.ID, err)
+				failed[key] = true
+				continue
+			}
+			values[key] = value
+		}
+
+		if fires(co, value) {
+			e.fire(ctx, co, fmt.Sprintf("%s reached %s", co.TriggerType, value.StringFixed(2)))
+		}
+	}
+
+	return nil
+}
+
+// observe fetches the value a conditional order's trigger compares against
+func (e *Engine) observe(co *database.ConditionalOrder) (decimal.Decimal, error) {
+	switch co.TriggerType {
+	case PriceAbove, PriceBelow:
+		return e.data.LatestPrice(co.Symbol)
+	case RSIAbove, RSIBelow:
+		closes, err := e.data.RecentCloses(co.Symbol, co.Timeframe, co.RSIPeriod+rsiHistory)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		return indicators.RSI(closes, co.RSIPeriod)
+	}
+	return decimal.Zero, fmt.Errorf("unknown trigger type %q", co.TriggerType)
+}
+
+func fires(co *database.ConditionalOrder, value decimal.Decimal) bool {
+	switch co.TriggerType {
+	case PriceAbove, RSIAbove:
+		return value.GreaterThanOrEqual(co.TriggerValue)
+	case PriceBelow, RSIBelow:
+		return value.LessThanOrEqual(co.TriggerValue)
+	}
+	return false
+}
+
+// Schedule arms the timer for a newly created timed order
+func (e *Engine) Schedule(co database.ConditionalOrder) {
+	if co.TriggerType != AtTime || co.TriggerAt == nil {
+		return
+	}
+
+	e.timers.At(co.ID, *co.TriggerAt, func() {
+		// Timers outlive the request that created them
+		ctx := context.Background()
+		if late := time.Since(*co.TriggerAt); late > missedGrace {
+			e.miss(ctx, &co, late)
+			return
+		}
+		e.fire(ctx, &co, "scheduled time "+market.ExchangeTime(*co.TriggerAt).Format("2006-01-02 15:04:05 MST")+" reached")
+	})
+}
+
+// Unschedule disarms a cancelled timed order's timer
+func (e *Engine) Unschedule(id int64) {
+	e.timers.Cancel(id)
+}
+
+// Scheduled returns how many timed orders are armed
+func (e *Engine) Scheduled() int {
+	return e.timers.Len()
+}
+
+// scheduleTimed arms timers for every pending timed order in the database
+func (e *Engine) scheduleTimed() error {
+	pending, err := e.db.GetPendingConditionalOrders()
+	if err != nil {
+		return err
+	}
+
+	for _, co := range pending {
+		e.Schedule(co)
+	}
+	return nil
+}
+
+// miss fails a timed order whose time passed while it could not be sent
+func (e *Engine) miss(ctx context.Context, co *database.ConditionalOrder, late time.Duration) {
+	claimed, err := e.db.ClaimConditionalOrder(co.ID, time.Now())
+	if err != nil || !claimed {
+		return
+	}
+
+	errMsg := fmt.Sprintf("missed scheduled time by %s", late.Round(time.Second))
+	if err := e.db.CompleteConditionalOrder(co.ID, database.ConditionalFailed, nil, &errMsg); err != nil {
+		log.Printf("Failed to record missed timed order %d: %v", co.ID, err)
+	}
+	notify.SendUser(ctx, e.notifier, co.UserID, notify.LevelWarning, "Timed order missed",
+		fmt.Sprintf("Timed order %d (%s %s %s, user %s) was not sent: %s",
+			co.ID, co.Side, co.Qty, co.Symbol, co.UserID, errMsg))
+}
+
+// fire claims a triggered order and submits it
+func (e *Engine) fire(ctx context.Context, co *database.ConditionalOrder, reason string) {
+	claimed, err := e.db.ClaimConditionalOrder(co.ID, time.Now())
+	if err != nil {
+		log.Printf("Failed to claim conditional order %d: %v", co.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	log.Printf("Conditional order %d triggered: %s %s", co.ID, co.Symbol, reason)
+
+	order := &orders.Order{
+		Symbol:      co.Symbol,
+		AssetClass:  orders.AssetClassOf(co.Symbol),
+		Side:        co.Side,
+		Type:        co.OrderType,
+		TimeInForce: co.TimeInForce,
+		Qty:         co.Qty,
+		LimitPrice:  co.LimitPrice,
+		StopPrice:   co.StopPrice,
+	}
+
+	trade, err := e.submit(co.UserID, co.StrategyID, order)
+	if err != nil {
+		errMsg := err.Error()
+		if dbErr := e.db.CompleteConditionalOrder(co.ID, database.ConditionalFailed, nil, &errMsg); dbErr != nil {
+			log.Printf("Failed to record conditional order %d failure: %v", co.ID, dbErr)
+		}
+		notify.SendUser(ctx, e.notifier, co.UserID, notify.LevelError, "Conditional order failed",
+			fmt.Sprintf("Conditional order %d (%s %s %s, user %s) triggered but could not be placed: %v",
+				co.ID, co.Side, co.Qty, co.Symbol, co.UserID, err))
+		return
+	}
+
+	if err := e.db.CompleteConditionalOrder(co.ID, database.ConditionalSubmitted, &trade.OrderID, nil); err != nil {
+		log.Printf("Failed to record conditional order %d submission: %v", co.ID, err)
+	}
+	notify.SendUser(ctx, e.notifier, co.UserID, notify.LevelInfo, "Conditional order triggered",
+		fmt.Sprintf("Conditional order %d (%s %s %s, user %s) submitted as order %s: %s",
+			co.ID, co.Side, co.Qty, co.Symbol, co.UserID, trade.OrderID, reason))
+}
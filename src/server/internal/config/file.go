@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// File is a KEY=VALUE configuration file, in the same format as .env, whose
+// values are applied to the process environment. Values in the file take
+// precedence over variables already set.
+type File struct {
+	path string
+
+	mu     sync.Mutex
+	values map[string]string
+	// environ holds the environment's own value of each key the file has
+	// set, restored if the key is removed from the file
+	environ map[string]*string
+}
+
+// Load reads the file at path and applies it to the environment
+func Load(path string) (*File, error) {
+	f := &File{path: path, environ: make(map[string]*string)}
+	values, err := f.Read()
+	if err != nil {
+		return nil, err
+	}
+	f.Apply(values)
+	return f, nil
+}
+
+// Read parses the file's current contents without applying them
+func (f *File) Read() (map[string]string, error) {
+	return parse(f.path)
+}
+
+// Getenv returns a lookup that sees the environment as it will be once
+// values are applied, so they can be validated first
+func (f *File) Getenv(values map[string]string) func(string) string {
+	f.mu.Lock()
+	environ := make(map[string]*string, len(f.environ))
+	for key, v := range f.environ {
+		environ[key] = v
+	}
+	f.mu.Unlock()
+
+	return func(key string) string {
+		if v, ok := values[key]; ok {
+			return v
+		}
+		if v, ok := environ[key]; ok {
+			if v == nil {
+				return ""
+			}
+			return *v
+		}
+		return os.Getenv(key)
+	}
+}
+
+// Apply sets values in the environment, returning the keys whose values
+// changed since the file was last applied. Keys no longer in the file revert
+// to the environment's own value.
+func (f *File) Apply(values map[string]string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var changed []string
+	for key, value := range values {
+		if old, ok := f.values[key]; ok && old == value {
+			continue
+		}
+		if f.values != nil {
+			changed = append(changed, key)
+		}
+		if _, ok := f.environ[key]; !ok {
+			if v, ok := os.LookupEnv(key); ok {
+				f.environ[key] = &v
+			} else {
+				f.environ[key] = nil
+			}
+		}
+		os.Setenv(key, value)
+	}
+	for key := range f.values {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		changed = append(changed, key)
+		if v := f.environ[key]; v != nil {
+			os.Setenv(key, *v)
+		} else {
+			os.Unsetenv(key)
+		}
+		delete(f.environ, key)
+	}
+	f.values = values
+
+	sort.Strings(changed)
+	return changed
+}
+
+// parse reads KEY=VALUE lines, skipping blanks and # comments. An optional
+// "export " prefix and matching quotes around the value are removed.
+func parse(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("config file line %d: want KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
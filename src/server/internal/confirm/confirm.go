@@ -0,0 +1,158 @@
+// Package confirm holds manual orders awaiting the user's confirmation. A
+// ticket echoes what the order would do (its notional at the current quote
+// and the position it leaves) and the order is only submitted if the ticket
+// is confirmed before it expires.
+package confirm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/orders"
+)
+
+var (
+	// ErrNotFound is returned for a ticket that doesn't exist, belongs to
+	// another user or was already confirmed or canceled
+	ErrNotFound = errors.New("ticket not found")
+	// ErrExpired is returned for a ticket confirmed after its TTL
+	ErrExpired = errors.New("ticket expired")
+)
+
+// Ticket is an order awaiting confirmation and what it would do
+type Ticket struct {
+	ID          string           `json:"id"`
+	UserID      string           `json:"user_id"`
+	Symbol      string           `json:"symbol"`
+	Side        string           `json:"side"`
+	Qty         decimal.Decimal  `json:"qty"`
+	OrderType   string           `json:"order_type"`
+	TimeInForce string           `json:"time_in_force"`
+	LimitPrice  *decimal.Decimal `json:"limit_price,omitempty"`
+	StopPrice   *decimal.Decimal `json:"stop_price,omitempty"`
+	// Quote is the latest trade price, if there is one, and QuotedAt when
+	// that trade happened
+	Quote    *decimal.Decimal `json:"quote,omitempty"`
+	QuotedAt *time.Time       `json:"quoted_at,omitempty"`
+	// Notional is Qty at the limit price, else the stop price, else the
+	// quote
+	Notional decimal.Decimal `json:"notional"`
+	// Position is the user's manual position in Symbol now, and
+	// PostTradePosition once the order fills in full
+	Position          decimal.Decimal `json:"position"`
+	PostTradePosition decimal.Decimal `json:"post_trade_position"`
+	CreatedAt         time.Time       `json:"created_at"`
+	ExpiresAt         time.Time       `json:"expires_at"`
+
+	order *orders.Order
+}
+
+// Order returns the order the ticket submits
+func (t *Ticket) Order() *orders.Order {
+	return t.order
+}
+
+// NewTicket describes order for userID at quote, if there is one, with
+// position the user's current position in its symbol. The ticket's ID is
+// the order's client order ID.
+func NewTicket(userID string, order *orders.Order, quote *decimal.Decimal, quotedAt *time.Time, position decimal.Decimal) *Ticket {
+	t := &Ticket{
+		ID:          order.ClientOrderID,
+		UserID:      userID,
+		Symbol:      order.Symbol,
+		Side:        order.Side,
+		Qty:         order.Qty,
+		OrderType:   order.Type,
+		TimeInForce: order.TimeInForce,
+		LimitPrice:  order.LimitPrice,
+		StopPrice:   order.StopPrice,
+		Quote:       quote,
+		QuotedAt:    quotedAt,
+		Position:    position,
+		order:       order,
+	}
+
+	switch {
+	case order.LimitPrice != nil:
+		t.Notional = order.Qty.Mul(*order.LimitPrice)
+	case order.StopPrice != nil:
+		t.Notional = order.Qty.Mul(*order.StopPrice)
+	case quote != nil:
+		t.Notional = order.Qty.Mul(*quote)
+	}
+
+	t.PostTradePosition = position.Add(order.Qty)
+	if order.Side == "sell" {
+		t.PostTradePosition = position.Sub(order.Qty)
+	}
+	return t
+}
+
+// Store keeps tickets in memory until they are confirmed, canceled or
+// expire. Tickets are forgotten on restart.
+type Store struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	tickets   map[string]*Ticket
+	nextPrune time.Time
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, tickets: make(map[string]*Ticket)}
+}
+
+// TTL returns how long a ticket can be confirmed for
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Add holds a ticket from now until the TTL has passed
+func (s *Store) Add(t *Ticket, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.After(s.nextPrune) {
+		for id, held := range s.tickets {
+			if now.After(held.ExpiresAt) {
+				delete(s.tickets, id)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+
+	t.CreatedAt, t.ExpiresAt = now, now.Add(s.ttl)
+	s.tickets[t.ID] = t
+}
+
+// Take removes userID's ticket so it can be submitted, once
+func (s *Store) Take(userID, id string, now time.Time) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[id]
+	if !ok || t.UserID != userID {
+		return nil, ErrNotFound
+	}
+	delete(s.tickets, id)
+	if now.After(t.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return t, nil
+}
+
+// Cancel discards userID's ticket, reporting whether there was one
+func (s *Store) Cancel(userID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[id]
+	if !ok || t.UserID != userID {
+		return false
+	}
+	delete(s.tickets, id)
+	return true
+}
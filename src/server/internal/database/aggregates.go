@@ -0,0 +1,290 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DailyAggregate holds one day's fill statistics for a user/strategy/symbol
+type DailyAggregate struct {
+	TradeDate  string          `json:"trade_date"`
+	UserID     string          `json:"user_id"`
+	StrategyID int64           `json:"strategy_id"`
+	Symbol     string          `json:"symbol"`
+	TradeCount int64           `json:"trade_count"`
+	BuyQty     decimal.Decimal `json:"buy_qty"`
+	SellQty    decimal.Decimal `json:"sell_qty"`
+	Notional   decimal.Decimal `json:"notional"`
+	RealizedPL decimal.Decimal `json:"realized_pl"`
+	Fees       decimal.Decimal `json:"fees"`
+	BorrowFees decimal.Decimal `json:"borrow_fees"`
+	// NetPL is realized P&L less fees and borrow fees
+	NetPL decimal.Decimal `json:"net_pl"`
+}
+
+// DailyFill is a single fill to be folded into the daily aggregates
+type DailyFill struct {
+	TradeDate  string
+	UserID     string
+	StrategyID int64 // 0 if not attributed to a strategy
+	Symbol     string
+	Side       string
+	Qty        decimal.Decimal
+	Price      decimal.Decimal
+	Fees       decimal.Decimal
+}
+
+// CostBasis is the running average-cost position behind realized P&L
+type CostBasis struct {
+	Qty     decimal.Decimal
+	AvgCost decimal.Decimal
+}
+
+// BookFunc applies a fill to a cost basis, returning the updated basis and the
+// P&L the fill realized
+type BookFunc func(basis CostBasis, fill DailyFill) (CostBasis, decimal.Decimal)
+
+// upsertCostBasisSQL sets a user/strategy's position and average cost in a
+// symbol
+const upsertCostBasisSQL = `
+	INSERT INTO position_costs (user_id, strategy_id, symbol, qty, avg_cost, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (user_id, strategy_id, symbol)
+	DO UPDATE SET qty = excluded.qty, avg_cost = excluded.avg_cost, updated_at = excluded.updated_at
+`
+
+// RecordDailyFill folds a fill into its day's aggregate row and the running
+// cost basis in a single transaction. The accounting itself is supplied by
+// book so that this package stays free of P&L rules.
+func (db *DB) RecordDailyFill(fill DailyFill, book BookFunc) error {
+	db.fillMu.Lock()
+	defer db.fillMu.Unlock()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin fill transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var basis CostBasis
+	var qty, avgCost string
+	stmt, err := db.txStmt(tx, `
+		SELECT qty, avg_cost FROM position_costs
+		WHERE user_id = ? AND strategy_id = ? AND symbol = ?
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read cost basis: %w", err)
+	}
+	err = stmt.QueryRow(fill.UserID, fill.StrategyID, fill.Symbol).Scan(&qty, &avgCost)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to read cost basis: %w", err)
+	default:
+		if basis.Qty, err = decimal.NewFromString(qty); err != nil {
+			return fmt.Errorf("invalid cost basis qty: %w", err)
+		}
+		if basis.AvgCost, err = decimal.NewFromString(avgCost); err != nil {
+			return fmt.Errorf("invalid cost basis price: %w", err)
+		}
+	}
+
+	basis, realized := book(basis, fill)
+
+	now := time.Now().UTC()
+	if stmt, err = db.txStmt(tx, upsertCostBasisSQL); err != nil {
+		return fmt.Errorf("failed to update cost basis: %w", err)
+	}
+	if _, err := stmt.Exec(fill.UserID, fill.StrategyID, fill.Symbol, basis.Qty.String(), basis.AvgCost.String(), now); err != nil {
+		return fmt.Errorf("failed to update cost basis: %w", err)
+	}
+
+	agg := DailyAggregate{
+		TradeDate:  fill.TradeDate,
+		UserID:     fill.UserID,
+		StrategyID: fill.StrategyID,
+		Symbol:     fill.Symbol,
+	}
+	var buyQty, sellQty, notional, realizedPL, fees string
+	if stmt, err = db.txStmt(tx, `
+		SELECT trade_count, buy_qty, sell_qty, notional, realized_pl, fees
+		FROM daily_aggregates
+		WHERE trade_date = ? AND user_id = ? AND strategy_id = ? AND symbol = ?
+	`); err != nil {
+		return fmt.Errorf("failed to read daily aggregate: %w", err)
+	}
+	err = stmt.QueryRow(fill.TradeDate, fill.UserID, fill.StrategyID, fill.Symbol).Scan(
+		&agg.TradeCount, &buyQty, &sellQty, &notional, &realizedPL, &fees,
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to read daily aggregate: %w", err)
+	default:
+		if err := parseDecimals(
+			[]string{buyQty, sellQty, notional, realizedPL, fees},
+			[]*decimal.Decimal{&agg.BuyQty, &agg.SellQty, &agg.Notional, &agg.RealizedPL, &agg.Fees},
+		); err != nil {
+			return fmt.Errorf("invalid daily aggregate: %w", err)
+		}
+	}
+
+	agg.TradeCount++
+	if fill.Side == "sell" {
+		agg.SellQty = agg.SellQty.Add(fill.Qty)
+	} else {
+		agg.BuyQty = agg.BuyQty.Add(fill.Qty)
+	}
+	agg.Notional = agg.Notional.Add(fill.Qty.Mul(fill.Price))
+	agg.RealizedPL = agg.RealizedPL.Add(realized)
+	agg.Fees = agg.Fees.Add(fill.Fees)
+
+	if stmt, err = db.txStmt(tx, `
+		INSERT INTO daily_aggregates (
+			trade_date, user_id, strategy_id, symbol, trade_count,
+			buy_qty, sell_qty, notional, realized_pl, fees, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (trade_date, user_id, strategy_id, symbol)
+		DO UPDATE SET
+			trade_count = excluded.trade_count,
+			buy_qty = excluded.buy_qty,
+			sell_qty = excluded.sell_qty,
+			notional = excluded.notional,
+			realized_pl = excluded.realized_pl,
+			fees = excluded.fees,
+			updated_at = excluded.updated_at
+	`); err != nil {
+		return fmt.Errorf("failed to update daily aggregate: %w", err)
+	}
+	if _, err := stmt.Exec(agg.TradeDate, agg.UserID, agg.StrategyID, agg.Symbol, agg.TradeCount,
+		agg.BuyQty.String(), agg.SellQty.String(), agg.Notional.String(),
+		agg.RealizedPL.String(), agg.Fees.String(), now); err != nil {
+		return fmt.Errorf("failed to update daily aggregate: %w", err)
+	}
+
+	if err := db.addDailyCash(tx, fill.TradeDate, fill.UserID, fill.StrategyID, fillCash(fill)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit fill: %w", err)
+	}
+	return nil
+}
+
+// GetPositionQty returns the net position a user/strategy holds in symbol
+// according to the running cost basis; strategyID is 0 for unattributed
+// trades. Long positions are positive and shorts negative.
+func (db *DB) GetPositionQty(userID string, strategyID int64, symbol string) (decimal.Decimal, error) {
+	stmt, err := db.stmt(`
+		SELECT qty FROM position_costs
+		WHERE user_id = ? AND strategy_id = ? AND symbol = ?
+	`)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to read position: %w", err)
+	}
+	var qty string
+	err = stmt.QueryRow(userID, strategyID, symbol).Scan(&qty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to read position: %w", err)
+	}
+
+	return decimal.NewFromString(qty)
+}
+
+// GetDailyAggregates returns a user's aggregates for trade dates in [from, to]
+// (YYYY-MM-DD, inclusive), optionally restricted to one strategy
+func (db *DB) GetDailyAggregates(userID, from, to string, strategyID *int64) ([]DailyAggregate, error) {
+	query := `
+		SELECT trade_date, user_id, strategy_id, symbol, trade_count,
+		       buy_qty, sell_qty, notional, realized_pl, fees, borrow_fees
+		FROM daily_aggregates
+		WHERE user_id = ? AND trade_date >= ? AND trade_date <= ?
+	`
+	args := []any{userID, from, to}
+	if strategyID != nil {
+		query += " AND strategy_id = ?"
+		args = append(args, *strategyID)
+	}
+	query += " ORDER BY trade_date, strategy_id, symbol"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily aggregates: %w", err)
+	}
+	defer rows.Close()
+
+	var aggs []DailyAggregate
+	for rows.Next() {
+		var a DailyAggregate
+		var buyQty, sellQty, notional, realizedPL, fees, borrowFees string
+		if err := rows.Scan(
+			&a.TradeDate, &a.UserID, &a.StrategyID, &a.Symbol, &a.TradeCount,
+			&buyQty, &sellQty, &notional, &realizedPL, &fees, &borrowFees,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan daily aggregate: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{buyQty, sellQty, notional, realizedPL, fees, borrowFees},
+			[]*decimal.Decimal{&a.BuyQty, &a.SellQty, &a.Notional, &a.RealizedPL, &a.Fees, &a.BorrowFees},
+		); err != nil {
+			return nil, fmt.Errorf("invalid daily aggregate: %w", err)
+		}
+		a.NetPL = a.RealizedPL.Sub(a.Fees).Sub(a.BorrowFees)
+		aggs = append(aggs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate daily aggregates: %w", err)
+	}
+
+	return aggs, nil
+}
+
+// HasDailyAggregates reports whether any aggregates have been recorded
+func (db *DB) HasDailyAggregates() (bool, error) {
+	var n int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM daily_aggregates LIMIT 1)").Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check daily aggregates: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetFilledTrades returns every trade with a non-zero fill, oldest first
+func (db *DB) GetFilledTrades() ([]Trade, error) {
+	query := `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE filled_avg_price IS NOT NULL AND CAST(filled_qty AS REAL) > 0
+		ORDER BY submitted_at ASC, id ASC
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filled trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+func parseDecimals(values []string, dest []*decimal.Decimal) error {
+	for i, v := range values {
+		d, err := decimal.NewFromString(v)
+		if err != nil {
+			return err
+		}
+		*dest[i] = d
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Backtest run kinds
+const (
+	BacktestSingle      = "backtest"
+	BacktestWalkForward = "walk_forward"
+)
+
+// BacktestRun is a stored backtest. Its parameters, settings, metrics,
+// equity curve and any kind-specific detail (a walk-forward's windows) are
+// kept as the JSON they were reported in.
+type BacktestRun struct {
+	ID       int64  `json:"id"`
+	UserID   string `json:"user_id"`
+	Kind     string `json:"kind"`
+	Strategy string `json:"strategy"`
+	Symbol   string `json:"symbol"`
+	// ConfigHash is the same for runs of the same strategy, symbol,
+	// parameters and settings, whatever dates they cover
+	ConfigHash string          `json:"config_hash"`
+	Params     json.RawMessage `json:"params"`
+	Config     json.RawMessage `json:"config"`
+	// DataStart and DataEnd are the first and last bars the run traded
+	DataStart time.Time       `json:"data_start"`
+	DataEnd   time.Time       `json:"data_end"`
+	Metrics   json.RawMessage `json:"metrics"`
+	// Equity and Detail are left out of listings
+	Equity    json.RawMessage `json:"equity,omitempty"`
+	Detail    json.RawMessage `json:"detail,omitempty"`
+	Note      string          `json:"note"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BacktestRunQuery filters a listing of backtest runs; empty fields match
+// every run
+type BacktestRunQuery struct {
+	Strategy   string
+	Symbol     string
+	ConfigHash string
+	Limit      int
+}
+
+// CreateBacktestRun stores a backtest run
+func (db *DB) CreateBacktestRun(run *BacktestRun) (int64, error) {
+	var detail *string
+	if run.Detail != nil {
+		s := string(run.Detail)
+		detail = &s
+	}
+	result, err := db.conn.Exec(`
+		INSERT INTO backtest_runs (
+			user_id, kind, strategy, symbol, config_hash, params, config,
+			data_start, data_end, metrics, equity, detail, note, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.UserID, run.Kind, run.Strategy, run.Symbol, run.ConfigHash, string(run.Params), string(run.Config),
+		utc(run.DataStart), utc(run.DataEnd), string(run.Metrics), string(run.Equity), detail, run.Note, utc(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backtest run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get backtest run ID: %w", err)
+	}
+
+	log.Printf("Stored %s run ID=%d of %s on %s for user=%s", run.Kind, id, run.Strategy, run.Symbol, run.UserID)
+	return id, nil
+}
+
+// GetBacktestRun retrieves a backtest run with its equity curve and detail
+func (db *DB) GetBacktestRun(id int64) (*BacktestRun, error) {
+	var run BacktestRun
+	var params, config, metrics, equity string
+	var detail sql.NullString
+	err := db.conn.QueryRow(`
+		SELECT id, user_id, kind, strategy, symbol, config_hash, params, config,
+		       data_start, data_end, metrics, equity, detail, note, created_at
+		FROM backtest_runs WHERE id = ?
+	`, id).Scan(&run.ID, &run.UserID, &run.Kind, &run.Strategy, &run.Symbol, &run.ConfigHash, &params, &config,
+		&run.DataStart, &run.DataEnd, &metrics, &equity, &detail, &run.Note, &run.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backtest run: %w", err)
+	}
+
+	run.Params, run.Config, run.Metrics, run.Equity = json.RawMessage(params), json.RawMessage(config), json.RawMessage(metrics), json.RawMessage(equity)
+	if detail.Valid {
+		run.Detail = json.RawMessage(detail.String)
+	}
+	return &run, nil
+}
+
+// GetBacktestRuns retrieves userID's backtest runs matching q, newest first,
+// without their equity curves or detail
+func (db *DB) GetBacktestRuns(userID string, q BacktestRunQuery) ([]BacktestRun, error) {
+	query := `
+		SELECT id, user_id, kind, strategy, symbol, config_hash, params, config,
+		       data_start, data_end, metrics, note, created_at
+		FROM backtest_runs
+		WHERE user_id = ?
+	`
+	args := []any{userID}
+	if q.Strategy != "" {
+		query += " AND strategy = ?"
+		args = append(args, q.Strategy)
+	}
+	if q.Symbol != "" {
+		query += " AND symbol = ?"
+		args = append(args, q.Symbol)
+	}
+	if q.ConfigHash != "" {
+		query += " AND config_hash = ?"
+		args = append(args, q.ConfigHash)
+	}
+	query += " ORDER BY id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backtest runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []BacktestRun{}
+	for rows.Next() {
+		var run BacktestRun
+		var params, config, metrics string
+		if err := rows.Scan(&run.ID, &run.UserID, &run.Kind, &run.Strategy, &run.Symbol, &run.ConfigHash, &params, &config,
+			&run.DataStart, &run.DataEnd, &metrics, &run.Note, &run.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan backtest run: %w", err)
+		}
+		run.Params, run.Config, run.Metrics = json.RawMessage(params), json.RawMessage(config), json.RawMessage(metrics)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate backtest runs: %w", err)
+	}
+	return runs, nil
+}
+
+// DeleteBacktestRun deletes a backtest run
+func (db *DB) DeleteBacktestRun(id int64) error {
+	if _, err := db.conn.Exec("DELETE FROM backtest_runs WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete backtest run: %w", err)
+	}
+	log.Printf("Deleted backtest run ID=%d", id)
+	return nil
+}
+
+// BacktestSweep is a stored parameter sweep. Report is left out of
+// listings.
+type BacktestSweep struct {
+	ID       int64  `json:"id"`
+	UserID   string `json:"user_id"`
+	Strategy string `json:"strategy"`
+	Symbol   string `json:"symbol"`
+	// Runs is the number of configurations swept
+	Runs      int             `json:"runs"`
+	Report    json.RawMessage `json:"report,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// CreateBacktestSweep stores a parameter sweep
+func (db *DB) CreateBacktestSweep(sweep *BacktestSweep) (int64, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO backtest_sweeps (user_id, strategy, symbol, runs, report, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, sweep.UserID, sweep.Strategy, sweep.Symbol, sweep.Runs, string(sweep.Report), utc(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backtest sweep: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get backtest sweep ID: %w", err)
+	}
+
+	log.Printf("Stored sweep ID=%d of %s on %s (%d runs) for user=%s", id, sweep.Strategy, sweep.Symbol, sweep.Runs, sweep.UserID)
+	return id, nil
+}
+
+// GetBacktestSweep retrieves a parameter sweep with its report
+func (db *DB) GetBacktestSweep(id int64) (*BacktestSweep, error) {
+	var sweep BacktestSweep
+	var report string
+	err := db.conn.QueryRow(`
+		SELECT id, user_id, strategy, symbol, runs, report, created_at
+		FROM backtest_sweeps WHERE id = ?
+	`, id).Scan(&sweep.ID, &sweep.UserID, &sweep.Strategy, &sweep.Symbol, &sweep.Runs, &report, &sweep.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backtest sweep: %w", err)
+	}
+	sweep.Report = json.RawMessage(report)
+	return &sweep, nil
+}
+
+// GetBacktestSweeps retrieves userID's parameter sweeps, newest first,
+// without their reports
+func (db *DB) GetBacktestSweeps(userID string, limit int) ([]BacktestSweep, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, strategy, symbol, runs, created_at
+		FROM backtest_sweeps
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backtest sweeps: %w", err)
+	}
+	defer rows.Close()
+
+	sweeps := []BacktestSweep{}
+	for rows.Next() {
+		var sweep BacktestSweep
+		if err := rows.Scan(&sweep.ID, &sweep.UserID, &sweep.Strategy, &sweep.Symbol, &sweep.Runs, &sweep.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan backtest sweep: %w", err)
+		}
+		sweeps = append(sweeps, sweep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate backtest sweeps: %w", err)
+	}
+	return sweeps, nil
+}
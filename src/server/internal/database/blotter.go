@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlotterFilter selects blotter rows. Empty fields match every trade.
+type BlotterFilter struct {
+	UserID     string `json:"user,omitempty"`
+	StrategyID *int64 `json:"strategy_id,omitempty"`
+	Symbol     string `json:"symbol,omitempty"`
+	// Source is the channel orders came in through (see orders.Sources)
+	Source string `json:"source,omitempty"`
+}
+
+// Matches reports whether t is one of the filter's rows
+func (f BlotterFilter) Matches(t Trade) bool {
+	if f.UserID != "" && t.UserID != f.UserID {
+		return false
+	}
+	if f.StrategyID != nil && (t.StrategyID == nil || *t.StrategyID != *f.StrategyID) {
+		return false
+	}
+	if f.Source != "" && t.Source != f.Source {
+		return false
+	}
+	return f.Symbol == "" || t.Symbol == f.Symbol
+}
+
+// GetBlotterTrades retrieves the latest limit trades matching a filter,
+// newest first
+func (db *DB) GetBlotterTrades(f BlotterFilter, limit int) ([]Trade, error) {
+	var where []string
+	var args []any
+	if f.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.StrategyID != nil {
+		where = append(where, "strategy_id = ?")
+		args = append(args, *f.StrategyID)
+	}
+	if f.Symbol != "" {
+		where = append(where, "symbol = ?")
+		args = append(args, f.Symbol)
+	}
+	if f.Source != "" {
+		where = append(where, "source = ?")
+		args = append(args, f.Source)
+	}
+	query := `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+	`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY submitted_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blotter: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// GetTradesByIDs retrieves trades by ID, in ID order
+func (db *DB) GetTradesByIDs(ids []int64) ([]Trade, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
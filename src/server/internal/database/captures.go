@@ -0,0 +1,82 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OrderCapture is the request and broker response of a failed order
+type OrderCapture struct {
+	ID             int64             `json:"id"`
+	TradeID        int64             `json:"trade_id"`
+	UserID         string            `json:"user_id"`
+	RequestMethod  string            `json:"request_method"`
+	RequestPath    string            `json:"request_path"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestBody    string            `json:"request_body"`
+	ResponseStatus *int              `json:"response_status,omitempty"`
+	ResponseBody   string            `json:"response_body"`
+	ErrorMessage   string            `json:"error_message"`
+	Truncated      bool              `json:"truncated"`
+	CreatedAt      time.Time         `json:"created_at"`
+	ExpiresAt      time.Time         `json:"expires_at"`
+}
+
+// SaveOrderCapture stores a capture, replacing any earlier one of its trade
+func (db *DB) SaveOrderCapture(c *OrderCapture) error {
+	headers, err := json.Marshal(c.RequestHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to encode capture headers: %w", err)
+	}
+
+	result, err := db.conn.Exec(`
+		INSERT OR REPLACE INTO order_captures (
+			trade_id, user_id, request_method, request_path, request_headers, request_body,
+			response_status, response_body, error_message, truncated, created_at, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.TradeID, c.UserID, c.RequestMethod, c.RequestPath, string(headers), c.RequestBody,
+		c.ResponseStatus, c.ResponseBody, c.ErrorMessage, c.Truncated, utc(c.CreatedAt), utc(c.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to save order capture: %w", err)
+	}
+
+	if c.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get order capture ID: %w", err)
+	}
+	return nil
+}
+
+// GetOrderCapture retrieves a trade's capture if it hasn't expired
+func (db *DB) GetOrderCapture(tradeID int64, now time.Time) (*OrderCapture, error) {
+	var c OrderCapture
+	var headers string
+	err := db.conn.QueryRow(`
+		SELECT id, trade_id, user_id, request_method, request_path, request_headers, request_body,
+		       response_status, response_body, error_message, truncated, created_at, expires_at
+		FROM order_captures WHERE trade_id = ? AND expires_at > ?
+	`, tradeID, utc(now)).Scan(&c.ID, &c.TradeID, &c.UserID, &c.RequestMethod, &c.RequestPath, &headers, &c.RequestBody,
+		&c.ResponseStatus, &c.ResponseBody, &c.ErrorMessage, &c.Truncated, &c.CreatedAt, &c.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order capture: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(headers), &c.RequestHeaders); err != nil {
+		return nil, fmt.Errorf("failed to decode capture headers: %w", err)
+	}
+	return &c, nil
+}
+
+// PruneOrderCaptures deletes captures that expired before now
+func (db *DB) PruneOrderCaptures(now time.Time) error {
+	result, err := db.conn.Exec("DELETE FROM order_captures WHERE expires_at <= ?", utc(now))
+	if err != nil {
+		return fmt.Errorf("failed to prune order captures: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d expired order captures", n)
+	}
+	return nil
+}
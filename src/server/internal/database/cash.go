@@ -0,0 +1,435 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CashBook identifies whose cash a ledger row tracks; StrategyID is 0 for
+// trades not attributed to a strategy
+type CashBook struct {
+	UserID     string
+	StrategyID int64
+}
+
+// DailyCash is one day of a user/strategy's cash ledger
+type DailyCash struct {
+	TradeDate      string          `json:"trade_date"`
+	UserID         string          `json:"user_id"`
+	StrategyID     int64           `json:"strategy_id"`
+	Deposits       decimal.Decimal `json:"deposits"`
+	TradeFlow      decimal.Decimal `json:"trade_flow"`
+	Dividends      decimal.Decimal `json:"dividends"`
+	Fees           decimal.Decimal `json:"fees"`
+	BorrowFees     decimal.Decimal `json:"borrow_fees"`
+	MarginInterest decimal.Decimal `json:"margin_interest"`
+	RealizedPL     decimal.Decimal `json:"realized_pl"`
+	// NetPL is realized P&L plus dividends, less fees, borrow fees and margin
+	// interest
+	NetPL decimal.Decimal `json:"net_pl"`
+	// Balance is the cash balance at the end of the day
+	Balance decimal.Decimal `json:"balance"`
+}
+
+// cashDelta is a change to one day's cash ledger row
+type cashDelta struct {
+	deposits       decimal.Decimal
+	tradeFlow      decimal.Decimal
+	dividends      decimal.Decimal
+	fees           decimal.Decimal
+	borrowFees     decimal.Decimal
+	marginInterest decimal.Decimal
+	// accrued marks the day's carry as accrued
+	accrued bool
+}
+
+// fillCash is the cash a fill moves: sells add proceeds and buys spend
+func fillCash(fill DailyFill) cashDelta {
+	flow := fill.Qty.Mul(fill.Price)
+	if fill.Side != "sell" {
+		flow = flow.Neg()
+	}
+	return cashDelta{tradeFlow: flow, fees: fill.Fees}
+}
+
+// addDailyCash folds a change into a day's cash ledger row
+func (db *DB) addDailyCash(tx *sql.Tx, date, userID string, strategyID int64, d cashDelta) error {
+	var row cashDelta
+	var deposits, tradeFlow, dividends, fees, borrowFees, marginInterest string
+	stmt, err := db.txStmt(tx, `
+		SELECT deposits, trade_flow, dividends, fees, borrow_fees, margin_interest
+		FROM daily_cash
+		WHERE trade_date = ? AND user_id = ? AND strategy_id = ?
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read daily cash: %w", err)
+	}
+	err = stmt.QueryRow(date, userID, strategyID).Scan(&deposits, &tradeFlow, &dividends, &fees, &borrowFees, &marginInterest)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to read daily cash: %w", err)
+	default:
+		if err := parseDecimals(
+			[]string{deposits, tradeFlow, dividends, fees, borrowFees, marginInterest},
+			[]*decimal.Decimal{&row.deposits, &row.tradeFlow, &row.dividends, &row.fees, &row.borrowFees, &row.marginInterest},
+		); err != nil {
+			return fmt.Errorf("invalid daily cash: %w", err)
+		}
+	}
+
+	var accruedAt *time.Time
+	if d.accrued {
+		now := time.Now().UTC()
+		accruedAt = &now
+	}
+	if stmt, err = db.txStmt(tx, `
+		INSERT INTO daily_cash (
+			trade_date, user_id, strategy_id, deposits, trade_flow,
+			dividends, fees, borrow_fees, margin_interest, accrued_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (trade_date, user_id, strategy_id)
+		DO UPDATE SET
+			deposits = excluded.deposits,
+			trade_flow = excluded.trade_flow,
+			dividends = excluded.dividends,
+			fees = excluded.fees,
+			borrow_fees = excluded.borrow_fees,
+			margin_interest = excluded.margin_interest,
+			accrued_at = COALESCE(excluded.accrued_at, daily_cash.accrued_at)
+	`); err != nil {
+		return fmt.Errorf("failed to update daily cash: %w", err)
+	}
+	if _, err := stmt.Exec(date, userID, strategyID,
+		row.deposits.Add(d.deposits).String(),
+		row.tradeFlow.Add(d.tradeFlow).String(),
+		row.dividends.Add(d.dividends).String(),
+		row.fees.Add(d.fees).String(),
+		row.borrowFees.Add(d.borrowFees).String(),
+		row.marginInterest.Add(d.marginInterest).String(),
+		accruedAt); err != nil {
+		return fmt.Errorf("failed to update daily cash: %w", err)
+	}
+	return nil
+}
+
+// updateDailyCash applies a change to a day's cash ledger row in its own
+// transaction
+func (db *DB) updateDailyCash(date string, book CashBook, d cashDelta) error {
+	db.fillMu.Lock()
+	defer db.fillMu.Unlock()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin cash transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.addDailyCash(tx, date, book.UserID, book.StrategyID, d); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cash: %w", err)
+	}
+	return nil
+}
+
+// RecordDeposit adds a deposit, or a withdrawal if amount is negative, to a
+// book's cash on date
+func (db *DB) RecordDeposit(date string, book CashBook, amount decimal.Decimal) error {
+	if err := db.updateDailyCash(date, book, cashDelta{deposits: amount}); err != nil {
+		return err
+	}
+
+	log.Printf("Recorded deposit of %s on %s for user=%s strategy=%d", amount, date, book.UserID, book.StrategyID)
+	return nil
+}
+
+// RecordFillCash records only the cash a fill moves. RecordDailyFill does
+// this itself; it is for rebuilding the cash ledger from existing trades.
+func (db *DB) RecordFillCash(fill DailyFill) error {
+	return db.updateDailyCash(fill.TradeDate, CashBook{fill.UserID, fill.StrategyID}, fillCash(fill))
+}
+
+// HasDailyCash reports whether any cash ledger rows have been recorded
+func (db *DB) HasDailyCash() (bool, error) {
+	var n int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM daily_cash LIMIT 1)").Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check daily cash: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetDailyCash returns a user's cash ledger for trade dates in [from, to]
+// (YYYY-MM-DD, inclusive), optionally restricted to one strategy. Balances
+// include everything before from.
+func (db *DB) GetDailyCash(userID, from, to string, strategyID *int64) ([]DailyCash, error) {
+	query := `
+		SELECT trade_date, user_id, strategy_id, deposits, trade_flow,
+		       dividends, fees, borrow_fees, margin_interest
+		FROM daily_cash
+		WHERE user_id = ? AND trade_date <= ?
+	`
+	args := []any{userID, to}
+	if strategyID != nil {
+		query += " AND strategy_id = ?"
+		args = append(args, *strategyID)
+	}
+	query += " ORDER BY strategy_id, trade_date"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily cash: %w", err)
+	}
+	defer rows.Close()
+
+	var days []DailyCash
+	balances := make(map[int64]decimal.Decimal)
+	for rows.Next() {
+		var c DailyCash
+		var deposits, tradeFlow, dividends, fees, borrowFees, marginInterest string
+		if err := rows.Scan(
+			&c.TradeDate, &c.UserID, &c.StrategyID, &deposits, &tradeFlow,
+			&dividends, &fees, &borrowFees, &marginInterest,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan daily cash: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{deposits, tradeFlow, dividends, fees, borrowFees, marginInterest},
+			[]*decimal.Decimal{&c.Deposits, &c.TradeFlow, &c.Dividends, &c.Fees, &c.BorrowFees, &c.MarginInterest},
+		); err != nil {
+			return nil, fmt.Errorf("invalid daily cash: %w", err)
+		}
+
+		c.Balance = balances[c.StrategyID].Add(c.Deposits).Add(c.TradeFlow).Add(c.Dividends).
+			Sub(c.Fees).Sub(c.BorrowFees).Sub(c.MarginInterest)
+		balances[c.StrategyID] = c.Balance
+		if c.TradeDate >= from {
+			days = append(days, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate daily cash: %w", err)
+	}
+
+	aggs, err := db.GetDailyAggregates(userID, from, to, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	realized := make(map[string]decimal.Decimal)
+	for _, a := range aggs {
+		key := fmt.Sprintf("%s/%d", a.TradeDate, a.StrategyID)
+		realized[key] = realized[key].Add(a.RealizedPL)
+	}
+	for i := range days {
+		c := &days[i]
+		c.RealizedPL = realized[fmt.Sprintf("%s/%d", c.TradeDate, c.StrategyID)]
+		c.NetPL = c.RealizedPL.Add(c.Dividends).Sub(c.Fees).Sub(c.BorrowFees).Sub(c.MarginInterest)
+	}
+
+	return days, nil
+}
+
+// CashBalances returns every book's cash balance at the end of date
+func (db *DB) CashBalances(date string) (map[CashBook]decimal.Decimal, error) {
+	rows, err := db.conn.Query(`
+		SELECT user_id, strategy_id, deposits, trade_flow, dividends, fees, borrow_fees, margin_interest
+		FROM daily_cash
+		WHERE trade_date <= ?
+	`, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cash balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[CashBook]decimal.Decimal)
+	for rows.Next() {
+		var book CashBook
+		var c cashDelta
+		var deposits, tradeFlow, dividends, fees, borrowFees, marginInterest string
+		if err := rows.Scan(&book.UserID, &book.StrategyID, &deposits, &tradeFlow, &dividends, &fees, &borrowFees, &marginInterest); err != nil {
+			return nil, fmt.Errorf("failed to scan cash balance: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{deposits, tradeFlow, dividends, fees, borrowFees, marginInterest},
+			[]*decimal.Decimal{&c.deposits, &c.tradeFlow, &c.dividends, &c.fees, &c.borrowFees, &c.marginInterest},
+		); err != nil {
+			return nil, fmt.Errorf("invalid daily cash: %w", err)
+		}
+		balances[book] = balances[book].Add(c.deposits).Add(c.tradeFlow).Add(c.dividends).
+			Sub(c.fees).Sub(c.borrowFees).Sub(c.marginInterest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate cash balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// GetBookUsers returns every user with a cash ledger, which is everyone who
+// has had a fill or a deposit
+func (db *DB) GetBookUsers() ([]string, error) {
+	rows, err := db.conn.Query("SELECT DISTINCT user_id FROM daily_cash ORDER BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query book users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan book user: %w", err)
+		}
+		users = append(users, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate book users: %w", err)
+	}
+	return users, nil
+}
+
+// PositionCost is a book's open position in one symbol at average cost
+type PositionCost struct {
+	CashBook
+	Symbol  string
+	Qty     decimal.Decimal
+	AvgCost decimal.Decimal
+}
+
+// GetOpenPositionCosts returns every non-zero position in the running cost
+// basis
+func (db *DB) GetOpenPositionCosts() ([]PositionCost, error) {
+	rows, err := db.conn.Query(`SELECT user_id, strategy_id, symbol, qty, avg_cost FROM position_costs`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position costs: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []PositionCost
+	for rows.Next() {
+		var p PositionCost
+		var qty, avgCost string
+		if err := rows.Scan(&p.UserID, &p.StrategyID, &p.Symbol, &qty, &avgCost); err != nil {
+			return nil, fmt.Errorf("failed to scan position cost: %w", err)
+		}
+		if err := parseDecimals([]string{qty, avgCost}, []*decimal.Decimal{&p.Qty, &p.AvgCost}); err != nil {
+			return nil, fmt.Errorf("invalid position cost: %w", err)
+		}
+		if !p.Qty.IsZero() {
+			positions = append(positions, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position costs: %w", err)
+	}
+
+	return positions, nil
+}
+
+// GetBookPositionCosts returns a book's non-zero positions in the running
+// cost basis
+func (db *DB) GetBookPositionCosts(book CashBook) ([]PositionCost, error) {
+	rows, err := db.conn.Query(`
+		SELECT symbol, qty, avg_cost FROM position_costs
+		WHERE user_id = ? AND strategy_id = ?
+		ORDER BY symbol
+	`, book.UserID, book.StrategyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position costs: %w", err)
+	}
+	defer rows.Close()
+
+	var positions []PositionCost
+	for rows.Next() {
+		p := PositionCost{CashBook: book}
+		var qty, avgCost string
+		if err := rows.Scan(&p.Symbol, &qty, &avgCost); err != nil {
+			return nil, fmt.Errorf("failed to scan position cost: %w", err)
+		}
+		if err := parseDecimals([]string{qty, avgCost}, []*decimal.Decimal{&p.Qty, &p.AvgCost}); err != nil {
+			return nil, fmt.Errorf("invalid position cost: %w", err)
+		}
+		if !p.Qty.IsZero() {
+			positions = append(positions, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position costs: %w", err)
+	}
+	return positions, nil
+}
+
+// CarryAccrued reports whether a book's carry has already been accrued for
+// date
+func (db *DB) CarryAccrued(date string, book CashBook) (bool, error) {
+	var n int
+	if err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM daily_cash
+		WHERE trade_date = ? AND user_id = ? AND strategy_id = ? AND accrued_at IS NOT NULL
+	`, date, book.UserID, book.StrategyID).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check carry accrual: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecordCarry books a day's carry for one book: borrow fees per short symbol
+// into the daily aggregates, and their total plus margin interest into the
+// cash ledger
+func (db *DB) RecordCarry(date string, book CashBook, borrowFees map[string]decimal.Decimal, marginInterest decimal.Decimal) error {
+	db.fillMu.Lock()
+	defer db.fillMu.Unlock()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin carry transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	total := decimal.Zero
+	for symbol, fee := range borrowFees {
+		var current string
+		err := tx.QueryRow(`
+			SELECT borrow_fees FROM daily_aggregates
+			WHERE trade_date = ? AND user_id = ? AND strategy_id = ? AND symbol = ?
+		`, date, book.UserID, book.StrategyID, symbol).Scan(&current)
+		existing := decimal.Zero
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("failed to read borrow fees: %w", err)
+		default:
+			if existing, err = decimal.NewFromString(current); err != nil {
+				return fmt.Errorf("invalid borrow fees: %w", err)
+			}
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO daily_aggregates (trade_date, user_id, strategy_id, symbol, borrow_fees, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (trade_date, user_id, strategy_id, symbol)
+			DO UPDATE SET borrow_fees = excluded.borrow_fees, updated_at = excluded.updated_at
+		`, date, book.UserID, book.StrategyID, symbol, existing.Add(fee).String(), time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to record borrow fees: %w", err)
+		}
+		total = total.Add(fee)
+	}
+
+	if err := db.addDailyCash(tx, date, book.UserID, book.StrategyID, cashDelta{
+		borrowFees:     total,
+		marginInterest: marginInterest,
+		accrued:        true,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit carry: %w", err)
+	}
+	return nil
+}
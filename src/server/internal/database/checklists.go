@@ -0,0 +1,147 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChecklistRun is one run of a daily checklist and its steps, in order
+type ChecklistRun struct {
+	ID          int64           `json:"id"`
+	Checklist   string          `json:"checklist"`
+	SessionDate string          `json:"session_date"`
+	Status      string          `json:"status"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Steps       []ChecklistStep `json:"steps"`
+}
+
+// ChecklistStep is the outcome of one step of a checklist run
+type ChecklistStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Detail     string     `json:"detail"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// StartChecklistRun stores a new run with its steps pending, setting its ID
+func (db *DB) StartChecklistRun(run *ChecklistRun) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin checklist run: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO checklist_runs (checklist, session_date, status, started_at)
+		VALUES (?, ?, ?, ?)
+	`, run.Checklist, run.SessionDate, run.Status, utc(run.StartedAt))
+	if err != nil {
+		return fmt.Errorf("failed to insert checklist run: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get checklist run ID: %w", err)
+	}
+
+	for i, step := range run.Steps {
+		if _, err := tx.Exec(`
+			INSERT INTO checklist_steps (run_id, seq, name, status, detail)
+			VALUES (?, ?, ?, ?, ?)
+		`, id, i, step.Name, step.Status, step.Detail); err != nil {
+			return fmt.Errorf("failed to insert checklist step: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit checklist run: %w", err)
+	}
+	run.ID = id
+	return nil
+}
+
+// UpdateChecklistStep stores the outcome so far of the step at index seq of
+// a run
+func (db *DB) UpdateChecklistStep(runID int64, seq int, step ChecklistStep) error {
+	if _, err := db.conn.Exec(`
+		UPDATE checklist_steps SET status = ?, detail = ?, started_at = ?, finished_at = ?
+		WHERE run_id = ? AND seq = ?
+	`, step.Status, step.Detail, utcPtr(step.StartedAt), utcPtr(step.FinishedAt), runID, seq); err != nil {
+		return fmt.Errorf("failed to update checklist step: %w", err)
+	}
+	return nil
+}
+
+// FinishChecklistRun records the outcome of a run
+func (db *DB) FinishChecklistRun(runID int64, status string, finishedAt time.Time) error {
+	if _, err := db.conn.Exec(`
+		UPDATE checklist_runs SET status = ?, finished_at = ? WHERE id = ?
+	`, status, utc(finishedAt), runID); err != nil {
+		return fmt.Errorf("failed to finish checklist run: %w", err)
+	}
+	return nil
+}
+
+// GetLatestChecklistRuns returns the latest run of each checklist, or of each
+// checklist for the session date if it isn't empty, by checklist name
+func (db *DB) GetLatestChecklistRuns(sessionDate string) ([]ChecklistRun, error) {
+	query := `
+		SELECT id, checklist, session_date, status, started_at, finished_at
+		FROM checklist_runs
+		WHERE id IN (
+			SELECT MAX(id) FROM checklist_runs
+			WHERE ? = '' OR session_date = ?
+			GROUP BY checklist
+		)
+		ORDER BY checklist
+	`
+	rows, err := db.conn.Query(query, sessionDate, sessionDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checklist runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ChecklistRun{}
+	for rows.Next() {
+		var run ChecklistRun
+		if err := rows.Scan(&run.ID, &run.Checklist, &run.SessionDate, &run.Status, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan checklist run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate checklist runs: %w", err)
+	}
+
+	for i := range runs {
+		if runs[i].Steps, err = db.getChecklistSteps(runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (db *DB) getChecklistSteps(runID int64) ([]ChecklistStep, error) {
+	rows, err := db.conn.Query(`
+		SELECT name, status, detail, started_at, finished_at
+		FROM checklist_steps WHERE run_id = ? ORDER BY seq
+	`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checklist steps: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []ChecklistStep{}
+	for rows.Next() {
+		var step ChecklistStep
+		if err := rows.Scan(&step.Name, &step.Status, &step.Detail, &step.StartedAt, &step.FinishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan checklist step: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate checklist steps: %w", err)
+	}
+	return steps, nil
+}
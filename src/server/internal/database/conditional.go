@@ -0,0 +1,196 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Conditional order statuses
+const (
+	ConditionalPending   = "pending"
+	ConditionalTriggered = "triggered"
+	ConditionalSubmitted = "submitted"
+	ConditionalFailed    = "failed"
+	ConditionalCanceled  = "canceled"
+)
+
+// ConditionalOrder is an order held by the desk until its trigger fires
+type ConditionalOrder struct {
+	ID           int64            `json:"id"`
+	UserID       string           `json:"user_id"`
+	StrategyID   *int64           `json:"strategy_id,omitempty"`
+	Symbol       string           `json:"symbol"`
+	Side         string           `json:"side"`
+	Qty          decimal.Decimal  `json:"qty"`
+	OrderType    string           `json:"order_type"`
+	TimeInForce  string           `json:"time_in_force"`
+	LimitPrice   *decimal.Decimal `json:"limit_price,omitempty"`
+	StopPrice    *decimal.Decimal `json:"stop_price,omitempty"`
+	TriggerType  string           `json:"trigger_type"`
+	TriggerValue decimal.Decimal  `json:"trigger_value"`
+	RSIPeriod    int              `json:"rsi_period,omitempty"`
+	Timeframe    string           `json:"timeframe,omitempty"`
+	TriggerAt    *time.Time       `json:"trigger_at,omitempty"`
+	Status       string           `json:"status"`
+	CreatedAt    time.Time        `json:"created_at"`
+	TriggeredAt  *time.Time       `json:"triggered_at,omitempty"`
+	OrderID      *string          `json:"order_id,omitempty"`
+	ErrorMessage *string          `json:"error_message,omitempty"`
+}
+
+const conditionalOrderColumns = `
+	id, user_id, strategy_id, symbol, side, qty, order_type, time_in_force,
+	limit_price, stop_price, trigger_type, trigger_value, rsi_period, timeframe,
+	trigger_at, status, created_at, triggered_at, order_id, error_message
+`
+
+// CreateConditionalOrder stores a new pending conditional order
+func (db *DB) CreateConditionalOrder(co *ConditionalOrder) (int64, error) {
+	query := `
+		INSERT INTO conditional_orders (
+			user_id, strategy_id, symbol, side, qty, order_type, time_in_force,
+			limit_price, stop_price, trigger_type, trigger_value, rsi_period, timeframe,
+			trigger_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := db.conn.Exec(query,
+		co.UserID, co.StrategyID, co.Symbol, co.Side, co.Qty, co.OrderType, co.TimeInForce,
+		co.LimitPrice, co.StopPrice, co.TriggerType, co.TriggerValue, co.RSIPeriod, co.Timeframe,
+		utcPtr(co.TriggerAt), utc(co.CreatedAt),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create conditional order: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get conditional order ID: %w", err)
+	}
+
+	log.Printf("Created conditional order ID=%d for user=%s: %s %s %s trigger=%s",
+		id, co.UserID, co.Side, co.Qty, co.Symbol, co.TriggerType)
+	return id, nil
+}
+
+// GetPendingConditionalOrders retrieves every conditional order still waiting
+// for its trigger
+func (db *DB) GetPendingConditionalOrders() ([]ConditionalOrder, error) {
+	query := `SELECT ` + conditionalOrderColumns + `
+		FROM conditional_orders
+		WHERE status = ?
+		ORDER BY id ASC
+	`
+
+	rows, err := db.conn.Query(query, ConditionalPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending conditional orders: %w", err)
+	}
+	defer rows.Close()
+
+	return scanConditionalOrders(rows)
+}
+
+// GetConditionalOrdersByUser retrieves a user's conditional orders, newest
+// first, optionally only those in the given status and with the given
+// trigger type
+func (db *DB) GetConditionalOrdersByUser(userID, status, triggerType string) ([]ConditionalOrder, error) {
+	query := `SELECT ` + conditionalOrderColumns + `
+		FROM conditional_orders
+		WHERE user_id = ? AND (? = '' OR status = ?) AND (? = '' OR trigger_type = ?)
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := db.conn.Query(query, userID, status, status, triggerType, triggerType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conditional orders: %w", err)
+	}
+	defer rows.Close()
+
+	return scanConditionalOrders(rows)
+}
+
+// ClaimConditionalOrder moves a pending conditional order to triggered. It
+// reports false if the order was no longer pending, so an order is only ever
+// submitted once even if it is cancelled at the same moment.
+func (db *DB) ClaimConditionalOrder(id int64, at time.Time) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE conditional_orders
+		SET status = ?, triggered_at = ?
+		WHERE id = ? AND status = ?
+	`, ConditionalTriggered, utc(at), id, ConditionalPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim conditional order: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim conditional order: %w", err)
+	}
+	return n == 1, nil
+}
+
+// CompleteConditionalOrder records the outcome of submitting a triggered
+// conditional order
+func (db *DB) CompleteConditionalOrder(id int64, status string, orderID, errMsg *string) error {
+	_, err := db.conn.Exec(`
+		UPDATE conditional_orders
+		SET status = ?, order_id = ?, error_message = ?
+		WHERE id = ?
+	`, status, orderID, errMsg, id)
+	if err != nil {
+		return fmt.Errorf("failed to update conditional order: %w", err)
+	}
+
+	log.Printf("Conditional order ID=%d %s", id, status)
+	return nil
+}
+
+// CancelConditionalOrder cancels one of a user's pending conditional orders.
+// It reports false if no such pending order exists.
+func (db *DB) CancelConditionalOrder(id int64, userID string) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE conditional_orders
+		SET status = ?
+		WHERE id = ? AND user_id = ? AND status = ?
+	`, ConditionalCanceled, id, userID, ConditionalPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel conditional order: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel conditional order: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Canceled conditional order ID=%d for user=%s", id, userID)
+	}
+	return n == 1, nil
+}
+
+func scanConditionalOrders(rows *sql.Rows) ([]ConditionalOrder, error) {
+	var out []ConditionalOrder
+	for rows.Next() {
+		var co ConditionalOrder
+		err := rows.Scan(
+			&co.ID, &co.UserID, &co.StrategyID, &co.Symbol, &co.Side, &co.Qty,
+			&co.OrderType, &co.TimeInForce, &co.LimitPrice, &co.StopPrice,
+			&co.TriggerType, &co.TriggerValue, &co.RSIPeriod, &co.Timeframe,
+			&co.TriggerAt, &co.Status, &co.CreatedAt, &co.TriggeredAt, &co.OrderID, &co.ErrorMessage,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conditional order: %w", err)
+		}
+		out = append(out, co)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate conditional orders: %w", err)
+	}
+
+	return out, nil
+}
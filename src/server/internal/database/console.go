@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// readOnlyDriver opens connections that can only read: the database file is
+// opened read-only and an authorizer rejects anything but reads, so console
+// queries can't write, attach other files or change pragmas.
+const readOnlyDriver = "sqlite3_readonly"
+
+// sqliteRecursive is SQLITE_RECURSIVE, the authorizer code for recursive
+// CTEs, which the driver doesn't export
+const sqliteRecursive = 33
+
+// schemaPragmas take a table or index name but only read the schema
+var schemaPragmas = map[string]bool{
+	"table_info":       true,
+	"table_xinfo":      true,
+	"index_list":       true,
+	"index_info":       true,
+	"index_xinfo":      true,
+	"foreign_key_list": true,
+}
+
+func init() {
+	sql.Register(readOnlyDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			conn.RegisterAuthorizer(func(op int, arg1, arg2, _ string) int {
+				switch op {
+				case sqlite3.SQLITE_SELECT, sqlite3.SQLITE_READ, sqlite3.SQLITE_FUNCTION, sqliteRecursive:
+					return sqlite3.SQLITE_OK
+				case sqlite3.SQLITE_PRAGMA:
+					// Reading a pragma is fine; setting one is not
+					if arg2 == "" || schemaPragmas[strings.ToLower(arg1)] {
+						return sqlite3.SQLITE_OK
+					}
+				}
+				return sqlite3.SQLITE_DENY
+			})
+			return nil
+		},
+	})
+}
+
+// openReadOnly opens the console connection to the database at dbPath
+func openReadOnly(dbPath string) (*sql.DB, error) {
+	dsn := "file:" + dbPath
+	if strings.Contains(dsn, "?") {
+		dsn += "&mode=ro&_loc=UTC"
+	} else {
+		dsn += "?mode=ro&_loc=UTC"
+	}
+	conn, err := sql.Open(readOnlyDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
+	}
+	return conn, nil
+}
+
+// QueryResult is one page of an ad-hoc query's rows
+type QueryResult struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	// NextOffset is the offset of the next page, if there are more rows
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// RunQuery runs ad-hoc SQL from the admin console and returns up to limit
+// rows starting at offset. Unless write is set it runs on the read-only
+// connection.
+func (db *DB) RunQuery(ctx context.Context, query string, offset, limit int, write bool) (*QueryResult, error) {
+	conn := db.readOnly
+	if write {
+		conn = db.conn
+	}
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	result, err := ReadRows(rows, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if write {
+		log.Printf("Admin console ran write-enabled query: %s", query)
+	}
+	return result, nil
+}
+
+// ReadRows reads up to limit rows of a query result starting at offset
+func ReadRows(rows *sql.Rows, offset, limit int) (*QueryResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query columns: %w", err)
+	}
+
+	if columns == nil {
+		columns = []string{}
+	}
+	result := &QueryResult{Columns: columns, Rows: [][]any{}}
+	for n := 0; rows.Next(); n++ {
+		if n < offset {
+			continue
+		}
+		if len(result.Rows) == limit {
+			next := offset + limit
+			result.NextOffset = &next
+			break
+		}
+
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan query row: %w", err)
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate query rows: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TradeCursor identifies the last row of a page of trades
+type TradeCursor struct {
+	SubmittedAt time.Time
+	ID          int64
+}
+
+// Encode returns the opaque string form handed to clients
+func (c TradeCursor) Encode() string {
+	raw := c.SubmittedAt.Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseTradeCursor decodes a cursor produced by TradeCursor.Encode
+func ParseTradeCursor(s string) (TradeCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return TradeCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return TradeCursor{}, fmt.Errorf("invalid cursor")
+	}
+
+	submittedAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return TradeCursor{}, fmt.Errorf("invalid cursor time: %w", err)
+	}
+	tradeID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return TradeCursor{}, fmt.Errorf("invalid cursor id: %w", err)
+	}
+
+	return TradeCursor{SubmittedAt: submittedAt, ID: tradeID}, nil
+}
@@ -1,13 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/orders"
 )
 
 //go:embed schema.sql
@@ -15,57 +22,186 @@ var schemaSQL string
 
 type DB struct {
 	conn *sql.DB
+	// readOnly serves the admin SQL console
+	readOnly *sql.DB
+
+	// fillMu serializes read-modify-write updates of aggregate tables
+	fillMu sync.Mutex
+	// maintMu keeps backups and maintenance, which each read or rewrite
+	// the whole file, from running at the same time
+	maintMu sync.Mutex
+
+	// onTrades is told which trades changed, see OnTradeChange
+	onTrades func(ids []int64)
+
+	// stmts caches prepared statements by query, see statements.go
+	stmts sync.Map
 }
 
+// Venues a trade can be routed to
+const (
+	VenueAlpaca    = "alpaca"
+	VenueSimulator = "simulator"
+	// VenueNetted trades are a strategy's share of a netted order (see
+	// netting_signals); the broker only saw the net order
+	VenueNetted = "netted"
+)
+
 // Trade represents a trade record
 type Trade struct {
-	ID              int64
-	StrategyID      *int64
-	UserID          string
-	OrderID         string
-	Symbol          string
-	Qty             string
-	Side            string
-	OrderType       string
-	TimeInForce     string
-	LimitPrice      *string
-	StopPrice       *string
-	FilledQty       string
-	FilledAvgPrice  *string
-	OrderStatus     string
-	SubmittedAt     time.Time
-	FilledAt        *time.Time
-	ErrorMessage    *string
+	ID             int64
+	StrategyID     *int64
+	UserID         string
+	OrderID        string
+	Symbol         string
+	Qty            decimal.Decimal
+	Side           string
+	OrderType      string
+	TimeInForce    string
+	LimitPrice     *decimal.Decimal
+	StopPrice      *decimal.Decimal
+	FilledQty      decimal.Decimal
+	FilledAvgPrice *decimal.Decimal
+	OrderStatus    string
+	SubmittedAt    time.Time
+	FilledAt       *time.Time
+	ErrorMessage   *string
+	Venue          string
+	// StrategyVersion is the strategy artifact version running when the
+	// order was placed, if the strategy was runner-managed
+	StrategyVersion *int64
+	// ReceivedAt is when the desk received the order, SentAt when it was
+	// handed to the broker and AckedAt when the broker answered, all taken
+	// from the monotonic clock (see internal/clock) and stored to the
+	// microsecond. Trades logged before these were recorded have none.
+	ReceivedAt *time.Time
+	SentAt     *time.Time
+	AckedAt    *time.Time
+	// ClientOrderID is the desk's ULID for the order, sent to the broker as
+	// its client_order_id, so even a trade the broker never acknowledged
+	// can be traced. Trades logged before it was assigned have none.
+	ClientOrderID string
+	// HedgeRule names the hedge rule (see internal/hedge) that placed the
+	// order; it is empty for every other trade
+	HedgeRule string
+	// ExtendedHours is set when the order could also trade in the
+	// pre-market and after-hours sessions
+	ExtendedHours bool
+	// Source is the channel the order came in through (see orders.Source);
+	// it is empty for trades logged before sources were recorded, and for
+	// orders recovered from the broker
+	Source string
 }
 
 // Strategy represents a trading strategy
 type Strategy struct {
-	ID        int64
-	UserID    string
-	Name      string
-	FilePath  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Status    string
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	FilePath  string    `json:"file_path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+
+	// Process state as seen by the strategy runner
+	RunState   string     `json:"run_state"`
+	RunMessage *string    `json:"run_message,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	ExitedAt   *time.Time `json:"exited_at,omitempty"`
+
+	// ActiveVersion is the uploaded artifact version the runner starts;
+	// without one it runs FilePath. RunningVersion is the version of the
+	// live process.
+	ActiveVersion  *int64 `json:"active_version,omitempty"`
+	RunningVersion *int64 `json:"running_version,omitempty"`
+
+	// Strategies registered from git are deployed from GitURL; GitRef is
+	// the ref most recently deployed
+	GitURL *string `json:"git_url,omitempty"`
+	GitRef *string `json:"git_ref,omitempty"`
+
+	// DeletedAt is when the strategy was deleted; its trades are kept
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// KilledAt is when the strategy's kill switch was thrown; it can't be
+	// started again until an admin clears it
+	KilledAt   *time.Time `json:"killed_at,omitempty"`
+	KillReason *string    `json:"kill_reason,omitempty"`
 }
 
 // Position represents a current position
 type Position struct {
-	ID             int64
-	StrategyID     int64
-	UserID         string
-	Symbol         string
-	Qty            string
-	AvgEntryPrice  string
-	CurrentPrice   *string
-	MarketValue    *string
-	UnrealizedPL   *string
-	UpdatedAt      time.Time
+	ID            int64
+	StrategyID    int64
+	UserID        string
+	Symbol        string
+	Qty           string
+	AvgEntryPrice string
+	CurrentPrice  *string
+	MarketValue   *string
+	UnrealizedPL  *string
+	UpdatedAt     time.Time
+}
+
+// utc normalizes a timestamp before it is written or compared. The driver
+// stores times as text in whatever zone they carry, so mixing zones would
+// break ordering and range queries; every TIMESTAMP column holds UTC.
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// micros stores a timestamp as integer Unix microseconds, for columns used in
+// latency analysis where SQLite's text timestamps are too coarse to compare
+func micros(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: true}
+}
+
+// nullInt64 stores a nil pointer as NULL. Passing the pointer itself works
+// too, but the driver has to unwrap it by reflection.
+func nullInt64(p *int64) sql.NullInt64 {
+	if p == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *p, Valid: true}
+}
+
+// fromMicros reads a micros column
+func fromMicros(us sql.NullInt64) *time.Time {
+	if !us.Valid {
+		return nil
+	}
+	t := time.UnixMicro(us.Int64).UTC()
+	return &t
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
 
 // NewDB creates a new database connection and initializes the schema
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	// Timestamps are stored in UTC; _loc makes the driver return them as UTC
+	// too instead of guessing a zone
+	dsn := dbPath
+	if strings.Contains(dsn, "?") {
+		dsn += "&_loc=UTC"
+	} else {
+		dsn += "?_loc=UTC"
+	}
+
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -82,30 +218,76 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	// Apply incremental migrations
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	readOnly, err := openReadOnly(dbPath)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	log.Printf("Database initialized at %s", dbPath)
 
-	return &DB{conn: conn}, nil
+	return &DB{conn: conn, readOnly: readOnly}, nil
+}
+
+// Stats returns connection pool statistics
+func (db *DB) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
+// Ping checks that the database can be reached
+func (db *DB) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
+// BackupTo writes a consistent copy of the live database to path, which
+// must not exist
+func (db *DB) BackupTo(ctx context.Context, path string) error {
+	db.maintMu.Lock()
+	defer db.maintMu.Unlock()
+
+	if _, err := db.conn.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
 }
 
 // Close closes the database connection
 func (db *DB) Close() error {
+	db.closeStmts()
+	db.readOnly.Close()
 	return db.conn.Close()
 }
 
-// LogTrade inserts a new trade record
-func (db *DB) LogTrade(trade *Trade) (int64, error) {
-	query := `
-		INSERT INTO trades (
-			strategy_id, user_id, order_id, symbol, qty, side,
-			order_type, time_in_force, limit_price, stop_price,
-			filled_qty, filled_avg_price, order_status, submitted_at,
-			filled_at, error_message
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// tradeInsertColumns lists the columns written for every new trade, in the
+// order returned by tradeInsertArgs
+const tradeInsertColumns = `
+	strategy_id, user_id, order_id, symbol, qty, side,
+	order_type, time_in_force, limit_price, stop_price,
+	filled_qty, filled_avg_price, order_status, submitted_at,
+	filled_at, error_message, venue, strategy_version,
+	received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+`
+
+// tradeInsertPlaceholders is one row of placeholders for tradeInsertColumns
+const tradeInsertPlaceholders = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// insertTradeSQL inserts one trade
+const insertTradeSQL = "INSERT INTO trades (" + tradeInsertColumns + ") VALUES " + tradeInsertPlaceholders
+
+func tradeInsertArgs(trade *Trade) []any {
+	venue := trade.Venue
+	if venue == "" {
+		venue = VenueAlpaca
+	}
 
-	result, err := db.conn.Exec(
-		query,
-		trade.StrategyID,
+	return []any{
+		nullInt64(trade.StrategyID),
 		trade.UserID,
 		trade.OrderID,
 		trade.Symbol,
@@ -118,11 +300,41 @@ func (db *DB) LogTrade(trade *Trade) (int64, error) {
 		trade.FilledQty,
 		trade.FilledAvgPrice,
 		trade.OrderStatus,
-		trade.SubmittedAt,
-		trade.FilledAt,
+		utc(trade.SubmittedAt),
+		utcPtr(trade.FilledAt),
 		trade.ErrorMessage,
-	)
+		venue,
+		nullInt64(trade.StrategyVersion),
+		micros(trade.ReceivedAt),
+		micros(trade.SentAt),
+		micros(trade.AckedAt),
+		nullString(trade.ClientOrderID),
+		nullString(trade.HedgeRule),
+		trade.ExtendedHours,
+		trade.Source,
+	}
+}
 
+// OnTradeChange registers fn to be told the IDs of trades that were
+// inserted or changed status, once the change is committed. It must be set
+// before the DB is shared, and fn must not block the writer.
+func (db *DB) OnTradeChange(fn func(ids []int64)) {
+	db.onTrades = fn
+}
+
+func (db *DB) tradesChanged(ids ...int64) {
+	if db.onTrades != nil && len(ids) > 0 {
+		db.onTrades(ids)
+	}
+}
+
+// LogTrade inserts a new trade record
+func (db *DB) LogTrade(trade *Trade) (int64, error) {
+	stmt, err := db.stmt(insertTradeSQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to log trade: %w", err)
+	}
+	result, err := stmt.Exec(tradeInsertArgs(trade)...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to log trade: %w", err)
 	}
@@ -132,61 +344,418 @@ func (db *DB) LogTrade(trade *Trade) (int64, error) {
 		return 0, fmt.Errorf("failed to get trade ID: %w", err)
 	}
 
-	log.Printf("Logged trade ID=%d for user=%s order=%s symbol=%s", id, trade.UserID, trade.OrderID, trade.Symbol)
+	log.Printf("Logged trade ID=%d for user=%s order=%s client_order=%s symbol=%s", id, trade.UserID, trade.OrderID, trade.ClientOrderID, trade.Symbol)
+	db.tradesChanged(id)
 	return id, nil
 }
 
-// UpdateTradeStatus updates the status of an existing trade
-func (db *DB) UpdateTradeStatus(orderID string, status string, filledQty string, filledAvgPrice *string, filledAt *time.Time) error {
-	query := `
-		UPDATE trades
-		SET order_status = ?, filled_qty = ?, filled_avg_price = ?, filled_at = ?
-		WHERE order_id = ?
-	`
-
-	_, err := db.conn.Exec(query, status, filledQty, filledAvgPrice, filledAt, orderID)
+// updateTradeStatusSQL sets a trade's status and fill
+const updateTradeStatusSQL = `
+	UPDATE trades
+	SET order_status = ?, filled_qty = ?, filled_avg_price = ?, filled_at = ?
+	WHERE id = ?
+`
+
+// UpdateTradeStatus updates the status of an existing trade, recording the
+// change as an order event if anything changed. A change the order status
+// machine doesn't allow is refused with an error wrapping
+// orders.ErrIllegalTransition.
+func (db *DB) UpdateTradeStatus(orderID string, status string, filledQty decimal.Decimal, filledAvgPrice *decimal.Decimal, filledAt *time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin trade status update: %w", err)
+	}
+	defer tx.Rollback()
+
+	var tradeID int64
+	var oldStatus string
+	var oldFilled decimal.Decimal
+	stmt, err := db.txStmt(tx, `
+		SELECT id, order_status, filled_qty FROM trades WHERE order_id = ? AND order_id != ''
+	`)
 	if err != nil {
 		return fmt.Errorf("failed to update trade status: %w", err)
 	}
+	err = stmt.QueryRow(orderID).Scan(&tradeID, &oldStatus, &oldFilled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update trade status: %w", err)
+	}
+	if err := orders.CheckTransition(oldStatus, status, oldFilled, filledQty); err != nil {
+		log.Printf("Refused status update for order %s: %v", orderID, err)
+		return fmt.Errorf("order %s: %w", orderID, err)
+	}
+
+	if stmt, err = db.txStmt(tx, updateTradeStatusSQL); err != nil {
+		return fmt.Errorf("failed to update trade status: %w", err)
+	}
+	if _, err := stmt.Exec(status, filledQty, filledAvgPrice, utcPtr(filledAt), tradeID); err != nil {
+		return fmt.Errorf("failed to update trade status: %w", err)
+	}
+
+	changed := status != oldStatus || !filledQty.Equal(oldFilled)
+	if changed {
+		if err := db.insertOrderEvent(tx, &OrderEvent{
+			TradeID:           tradeID,
+			EventType:         EventStatus,
+			PreviousStatus:    oldStatus,
+			PreviousFilledQty: oldFilled,
+			OrderStatus:       status,
+			FilledQty:         filledQty,
+			FilledAvgPrice:    filledAvgPrice,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit trade status update: %w", err)
+	}
 
 	log.Printf("Updated trade order=%s status=%s filled_qty=%s", orderID, status, filledQty)
+	if changed {
+		db.tradesChanged(tradeID)
+	}
 	return nil
 }
 
-// GetTradesByUser retrieves all trades for a specific user
-func (db *DB) GetTradesByUser(userID string, limit int) ([]Trade, error) {
+// TradeStatusUpdate is the broker's latest state of an order
+type TradeStatusUpdate struct {
+	OrderID        string
+	Status         string
+	FilledQty      decimal.Decimal
+	FilledAvgPrice *decimal.Decimal
+	FilledAt       *time.Time
+	// Detail is noted on the order event the update records, if any
+	Detail *string
+}
+
+// TradeStatusChange is a trade a batch changed, as it is now, with what it
+// was before
+type TradeStatusChange struct {
+	Trade             Trade
+	PreviousStatus    string
+	PreviousFilledQty decimal.Decimal
+	PreviousAvgPrice  *decimal.Decimal
+}
+
+// IllegalTransition is a status update the order status machine refused
+type IllegalTransition struct {
+	Update TradeStatusUpdate
+	// PreviousStatus and PreviousFilledQty are the trade's, which stand
+	PreviousStatus    string
+	PreviousFilledQty decimal.Decimal
+	Err               error
+}
+
+// TradeStatusBatch is what UpdateTradeStatusBatch did
+type TradeStatusBatch struct {
+	Changed []TradeStatusChange
+	// Unknown are the order IDs of updates no trade has
+	Unknown []string
+	// Illegal are the updates that weren't applied because the trade's
+	// order can't make that change
+	Illegal []IllegalTransition
+}
+
+// UpdateTradeStatusBatch applies many status updates in one transaction,
+// recording an order event for each trade whose status or filled quantity
+// changed. Updates that change nothing aren't written, and ones the order
+// status machine doesn't allow are left out and reported. Otherwise either
+// every update is applied or none are.
+func (db *DB) UpdateTradeStatusBatch(updates []TradeStatusUpdate) (*TradeStatusBatch, error) {
+	batch := &TradeStatusBatch{}
+	if len(updates) == 0 {
+		return batch, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin trade status batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	find, err := db.txStmt(tx, `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE order_id = ? AND order_id != ''
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update trade statuses: %w", err)
+	}
+	update, err := db.txStmt(tx, updateTradeStatusSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update trade statuses: %w", err)
+	}
+
+	for _, u := range updates {
+		rows, err := find.Query(u.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find trade for order %s: %w", u.OrderID, err)
+		}
+		trades, err := scanTrades(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(trades) == 0 {
+			batch.Unknown = append(batch.Unknown, u.OrderID)
+			continue
+		}
+		t := trades[0]
+
+		sameAvg := (t.FilledAvgPrice == nil) == (u.FilledAvgPrice == nil) &&
+			(t.FilledAvgPrice == nil || t.FilledAvgPrice.Equal(*u.FilledAvgPrice))
+		if u.Status == t.OrderStatus && u.FilledQty.Equal(t.FilledQty) && sameAvg {
+			continue
+		}
+		if err := orders.CheckTransition(t.OrderStatus, u.Status, t.FilledQty, u.FilledQty); err != nil {
+			log.Printf("Refused status update for order %s: %v", u.OrderID, err)
+			batch.Illegal = append(batch.Illegal, IllegalTransition{
+				Update:            u,
+				PreviousStatus:    t.OrderStatus,
+				PreviousFilledQty: t.FilledQty,
+				Err:               err,
+			})
+			continue
+		}
+
+		if _, err := update.Exec(u.Status, u.FilledQty, u.FilledAvgPrice, utcPtr(u.FilledAt), t.ID); err != nil {
+			return nil, fmt.Errorf("failed to update trade status: %w", err)
+		}
+		if err := db.insertOrderEvent(tx, &OrderEvent{
+			TradeID:           t.ID,
+			EventType:         EventStatus,
+			PreviousStatus:    t.OrderStatus,
+			PreviousFilledQty: t.FilledQty,
+			OrderStatus:       u.Status,
+			FilledQty:         u.FilledQty,
+			FilledAvgPrice:    u.FilledAvgPrice,
+			Detail:            u.Detail,
+		}); err != nil {
+			return nil, err
+		}
+
+		change := TradeStatusChange{
+			Trade:             t,
+			PreviousStatus:    t.OrderStatus,
+			PreviousFilledQty: t.FilledQty,
+			PreviousAvgPrice:  t.FilledAvgPrice,
+		}
+		change.Trade.OrderStatus = u.Status
+		change.Trade.FilledQty = u.FilledQty
+		change.Trade.FilledAvgPrice = u.FilledAvgPrice
+		change.Trade.FilledAt = u.FilledAt
+		batch.Changed = append(batch.Changed, change)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit trade status batch: %w", err)
+	}
+
+	log.Printf("Updated trade statuses: updates=%d changed=%d unknown=%d illegal=%d",
+		len(updates), len(batch.Changed), len(batch.Unknown), len(batch.Illegal))
+	ids := make([]int64, len(batch.Changed))
+	for i, c := range batch.Changed {
+		ids[i] = c.Trade.ID
+	}
+	db.tradesChanged(ids...)
+	return batch, nil
+}
+
+// TradePage is one page of trades returned by GetTradesByUser
+type TradePage struct {
+	Trades     []Trade
+	NextCursor string
+	HasMore    bool
+	Total      *int64
+}
+
+// GetTradesByUser retrieves a page of a user's trades, newest first. Pages
+// are keyed on (submitted_at, id) so deep pages cost the same as the first;
+// pass the previous page's NextCursor to continue. The total count is only
+// computed when withTotal is set.
+func (db *DB) GetTradesByUser(userID string, cursor string, limit int, withTotal bool) (*TradePage, error) {
+	args := []any{userID}
+	keyset := ""
+	if cursor != "" {
+		after, err := ParseTradeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		keyset = "AND (submitted_at, id) < (?, ?)"
+		args = append(args, utc(after.SubmittedAt), after.ID)
+	}
+	args = append(args, limit+1)
+
 	query := `
 		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
 		       order_type, time_in_force, limit_price, stop_price,
 		       filled_qty, filled_avg_price, order_status, submitted_at,
-		       filled_at, error_message
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
 		FROM trades
-		WHERE user_id = ?
-		ORDER BY submitted_at DESC
+		WHERE user_id = ? ` + keyset + `
+		ORDER BY submitted_at DESC, id DESC
 		LIMIT ?
 	`
 
-	rows, err := db.conn.Query(query, userID, limit)
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades, err := scanTrades(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TradePage{Trades: trades}
+	if len(trades) > limit {
+		page.Trades = trades[:limit]
+		page.HasMore = true
+		last := page.Trades[limit-1]
+		page.NextCursor = TradeCursor{SubmittedAt: last.SubmittedAt, ID: last.ID}.Encode()
+	}
+
+	if withTotal {
+		var total int64
+		if err := db.conn.QueryRow("SELECT COUNT(*) FROM trades WHERE user_id = ?", userID).Scan(&total); err != nil {
+			return nil, fmt.Errorf("failed to count trades: %w", err)
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+// GetOpenTrades retrieves trades with the given time in force (any if empty)
+// that the broker accepted, were submitted before the cutoff, and are not yet
+// in a terminal status, oldest first
+func (db *DB) GetOpenTrades(timeInForce string, submittedBefore time.Time) ([]Trade, error) {
+	terminal := orders.TerminalStatuses()
+	args := []any{timeInForce, timeInForce, utc(submittedBefore)}
+	for _, s := range terminal {
+		args = append(args, s)
+	}
+
+	query := `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE (? = '' OR time_in_force = ?) AND submitted_at < ? AND order_id != ''
+		  AND order_status NOT IN (?` + strings.Repeat(", ?", len(terminal)-1) + `)
+		ORDER BY submitted_at ASC, id ASC
+	`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// GetOrderUserID returns the user who placed the order with a broker order
+// ID, or sql.ErrNoRows if the desk has no trade for it
+func (db *DB) GetOrderUserID(orderID string) (string, error) {
+	var userID string
+	err := db.conn.QueryRow("SELECT user_id FROM trades WHERE order_id = ? LIMIT 1", orderID).Scan(&userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up order %s: %w", orderID, err)
+	}
+	return userID, nil
+}
+
+// GetTradesByOrderIDs retrieves the trades with the given broker order IDs,
+// in any status. IDs the desk has no trade for are left out.
+func (db *DB) GetTradesByOrderIDs(orderIDs []string) ([]Trade, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE order_id IN (?`+strings.Repeat(", ?", len(orderIDs)-1)+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// GetTradesByStrategy retrieves trades attributed to a strategy submitted at
+// or after since, oldest first
+func (db *DB) GetTradesByStrategy(strategyID int64, since time.Time) ([]Trade, error) {
+	query := `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE strategy_id = ? AND submitted_at >= ?
+		ORDER BY submitted_at ASC, id ASC
+	`
+
+	rows, err := db.conn.Query(query, strategyID, utc(since))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query trades: %w", err)
 	}
 	defer rows.Close()
 
+	return scanTrades(rows)
+}
+
+// scanTrades reads every row of a trades query selecting the full column list
+func scanTrades(rows *sql.Rows) ([]Trade, error) {
 	var trades []Trade
 	for rows.Next() {
 		var t Trade
+		var receivedAt, sentAt, ackedAt sql.NullInt64
+		var clientOrderID, hedgeRule sql.NullString
 		err := rows.Scan(
 			&t.ID, &t.StrategyID, &t.UserID, &t.OrderID, &t.Symbol,
 			&t.Qty, &t.Side, &t.OrderType, &t.TimeInForce,
 			&t.LimitPrice, &t.StopPrice, &t.FilledQty,
 			&t.FilledAvgPrice, &t.OrderStatus, &t.SubmittedAt,
-			&t.FilledAt, &t.ErrorMessage,
+			&t.FilledAt, &t.ErrorMessage, &t.Venue, &t.StrategyVersion,
+			&receivedAt, &sentAt, &ackedAt, &clientOrderID, &hedgeRule,
+			&t.ExtendedHours, &t.Source,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan trade: %w", err)
 		}
+		t.ReceivedAt, t.SentAt, t.AckedAt = fromMicros(receivedAt), fromMicros(sentAt), fromMicros(ackedAt)
+		t.ClientOrderID, t.HedgeRule = clientOrderID.String, hedgeRule.String
 		trades = append(trades, t)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate trades: %w", err)
+	}
 
 	return trades, nil
 }
@@ -194,11 +763,12 @@ func (db *DB) GetTradesByUser(userID string, limit int) ([]Trade, error) {
 // CreateStrategy creates a new strategy record
 func (db *DB) CreateStrategy(strategy *Strategy) (int64, error) {
 	query := `
-		INSERT INTO strategies (user_id, name, file_path, status)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO strategies (user_id, name, file_path, status, git_url, git_ref)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := db.conn.Exec(query, strategy.UserID, strategy.Name, strategy.FilePath, strategy.Status)
+	result, err := db.conn.Exec(query, strategy.UserID, strategy.Name, strategy.FilePath, strategy.Status,
+		strategy.GitURL, strategy.GitRef)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create strategy: %w", err)
 	}
@@ -212,22 +782,36 @@ func (db *DB) CreateStrategy(strategy *Strategy) (int64, error) {
 	return id, nil
 }
 
-// GetStrategyByID retrieves a strategy by ID
+// strategyColumns are the columns scanStrategy reads
+const strategyColumns = `id, user_id, name, file_path, created_at, updated_at, status,
+	run_state, run_message, started_at, exited_at,
+	active_version, running_version, git_url, git_ref, deleted_at,
+	killed_at, kill_reason`
+
+// GetStrategyByID retrieves a strategy by ID, unless it has been deleted
 func (db *DB) GetStrategyByID(id int64) (*Strategy, error) {
-	query := `
-		SELECT id, user_id, name, file_path, created_at, updated_at, status
+	s, err := scanStrategy(db.conn.QueryRow(`SELECT `+strategyColumns+`
 		FROM strategies
-		WHERE id = ?
-	`
+		WHERE id = ? AND deleted_at IS NULL
+	`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get strategy: %w", err)
+	}
+	return s, nil
+}
 
+// scanStrategy scans a row of strategyColumns
+func scanStrategy(row interface{ Scan(...any) error }) (*Strategy, error) {
 	var s Strategy
-	err := db.conn.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&s.ID, &s.UserID, &s.Name, &s.FilePath,
 		&s.CreatedAt, &s.UpdatedAt, &s.Status,
+		&s.RunState, &s.RunMessage, &s.StartedAt, &s.ExitedAt,
+		&s.ActiveVersion, &s.RunningVersion, &s.GitURL, &s.GitRef, &s.DeletedAt,
+		&s.KilledAt, &s.KillReason,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get strategy: %w", err)
+		return nil, err
 	}
-
 	return &s, nil
 }
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DeletedUser is a member the desk has deactivated
+type DeletedUser struct {
+	UserID    string    `json:"user_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// DeleteStrategy soft-deletes a strategy: it disappears from lookups but its
+// row, and the trades attributed to it, are kept. It reports false if there
+// is no such strategy or it is already deleted.
+func (db *DB) DeleteStrategy(id int64) (bool, error) {
+	now := utc(time.Now())
+	result, err := db.conn.Exec(`
+		UPDATE strategies SET deleted_at = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, now, now, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete strategy: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete strategy: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Deleted strategy ID=%d", id)
+	}
+	return n == 1, nil
+}
+
+// RestoreStrategy undoes the deletion of one of userID's strategies. It
+// reports false if userID has no such deleted strategy.
+func (db *DB) RestoreStrategy(id int64, userID string) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE strategies SET deleted_at = NULL, updated_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+	`, utc(time.Now()), id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore strategy: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to restore strategy: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Restored strategy ID=%d for user=%s", id, userID)
+	}
+	return n == 1, nil
+}
+
+// GetDeletedStrategies returns userID's deleted strategies, most recently
+// deleted first
+func (db *DB) GetDeletedStrategies(userID string) ([]Strategy, error) {
+	rows, err := db.conn.Query(`SELECT `+strategyColumns+`
+		FROM strategies
+		WHERE user_id = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted strategies: %w", err)
+	}
+	defer rows.Close()
+
+	strategies := []Strategy{}
+	for rows.Next() {
+		s, err := scanStrategy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan strategy: %w", err)
+		}
+		strategies = append(strategies, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate deleted strategies: %w", err)
+	}
+	return strategies, nil
+}
+
+// IsStrategyDeleted reports whether a strategy has been deleted. A strategy
+// that doesn't exist isn't.
+func (db *DB) IsStrategyDeleted(id int64) (bool, error) {
+	var deleted bool
+	err := db.conn.QueryRow("SELECT deleted_at IS NOT NULL FROM strategies WHERE id = ?", id).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check strategy: %w", err)
+	}
+	return deleted, nil
+}
+
+// DeleteUser deactivates a member: their strategies are deleted with them,
+// at the same time, and their pending conditional orders canceled. It
+// returns the IDs of the strategies deleted, and reports false if the user
+// was already deactivated.
+func (db *DB) DeleteUser(userID string) ([]int64, bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin user deletion: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := utc(time.Now())
+	result, err := tx.Exec(`
+		INSERT INTO users (user_id, deleted_at, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET deleted_at = excluded.deleted_at, updated_at = excluded.updated_at
+		WHERE users.deleted_at IS NULL
+	`, userID, now, now)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n == 0 {
+		return nil, false, nil
+	}
+
+	rows, err := tx.Query("SELECT id FROM strategies WHERE user_id = ? AND deleted_at IS NULL", userID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query user's strategies: %w", err)
+	}
+	var strategies []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, false, fmt.Errorf("failed to scan strategy ID: %w", err)
+		}
+		strategies = append(strategies, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to iterate user's strategies: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE strategies SET deleted_at = ?, updated_at = ? WHERE user_id = ? AND deleted_at IS NULL
+	`, now, now, userID); err != nil {
+		return nil, false, fmt.Errorf("failed to delete user's strategies: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE conditional_orders SET status = ? WHERE user_id = ? AND status = ?
+	`, ConditionalCanceled, userID, ConditionalPending); err != nil {
+		return nil, false, fmt.Errorf("failed to cancel user's conditional orders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+	log.Printf("Deactivated user=%s and deleted %d strategies", userID, len(strategies))
+	return strategies, true, nil
+}
+
+// RestoreUser reactivates a member, restoring the strategies that were
+// deleted with them; strategies they deleted themselves stay deleted. It
+// reports false if the user wasn't deactivated.
+func (db *DB) RestoreUser(userID string) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin user restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Restore the strategies deleted with the user before forgetting when
+	// that was
+	now := utc(time.Now())
+	if _, err := tx.Exec(`
+		UPDATE strategies SET deleted_at = NULL, updated_at = ?
+		WHERE user_id = ? AND deleted_at = (SELECT deleted_at FROM users WHERE user_id = ?)
+	`, now, userID, userID); err != nil {
+		return false, fmt.Errorf("failed to restore user's strategies: %w", err)
+	}
+	result, err := tx.Exec(`
+		UPDATE users SET deleted_at = NULL, updated_at = ? WHERE user_id = ? AND deleted_at IS NOT NULL
+	`, now, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore user: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to restore user: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit user restore: %w", err)
+	}
+	log.Printf("Restored user=%s", userID)
+	return true, nil
+}
+
+// IsUserDeleted reports whether a member has been deactivated
+func (db *DB) IsUserDeleted(userID string) (bool, error) {
+	stmt, err := db.stmt("SELECT COUNT(*) FROM users WHERE user_id = ? AND deleted_at IS NOT NULL")
+	if err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+	var n int
+	if err := stmt.QueryRow(userID).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetDeletedUsers returns the deactivated members, most recently deactivated
+// first
+func (db *DB) GetDeletedUsers() ([]DeletedUser, error) {
+	rows, err := db.conn.Query(`
+		SELECT user_id, deleted_at FROM users WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []DeletedUser{}
+	for rows.Next() {
+		var u DeletedUser
+		if err := rows.Scan(&u.UserID, &u.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate deleted users: %w", err)
+	}
+	return users, nil
+}
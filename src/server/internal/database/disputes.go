@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Dispute statuses
+const (
+	DisputeOpen     = "open"
+	DisputeUpheld   = "upheld"
+	DisputeRejected = "rejected"
+)
+
+// ErrDisputeExists is returned when disputing a trade that already has an
+// open or upheld dispute
+var ErrDisputeExists = errors.New("trade already has an open or upheld dispute")
+
+// Dispute is a member's claim that one of their trades filled in error. The
+// trade stays as it was logged; the dispute records what became of it.
+type Dispute struct {
+	ID       int64     `json:"id"`
+	TradeID  int64     `json:"trade_id"`
+	UserID   string    `json:"user_id"`
+	Reason   string    `json:"reason"`
+	Status   string    `json:"status"`
+	OpenedAt time.Time `json:"opened_at"`
+	// ResolvedAt and ResolutionNote are set once an admin upholds or
+	// rejects the dispute
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolutionNote *string    `json:"resolution_note,omitempty"`
+	// Adjustment is the P&L the fill caused, negative for a loss, which an
+	// upheld dispute takes out of the book's performance on TradeDate
+	Adjustment decimal.Decimal `json:"adjustment"`
+	TradeDate  *string         `json:"trade_date,omitempty"`
+}
+
+// DisputeAdjustment is an upheld dispute as the performance reports see it:
+// the trade it takes out of the stats and the P&L booked against its book
+type DisputeAdjustment struct {
+	DisputeID  int64
+	TradeID    int64
+	TradeDate  string
+	UserID     string
+	StrategyID int64
+	Symbol     string
+	Adjustment decimal.Decimal
+}
+
+const disputeColumns = `
+	id, trade_id, user_id, reason, status, opened_at, resolved_at,
+	resolution_note, adjustment, trade_date
+`
+
+func scanDispute(row interface{ Scan(...any) error }) (*Dispute, error) {
+	var d Dispute
+	if err := row.Scan(&d.ID, &d.TradeID, &d.UserID, &d.Reason, &d.Status, &d.OpenedAt, &d.ResolvedAt,
+		&d.ResolutionNote, &d.Adjustment, &d.TradeDate); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// disputeEvent appends an event about a dispute to its trade's lifecycle in
+// tx, leaving the trade's status and filled quantity as they are
+func (db *DB) disputeEvent(tx *sql.Tx, tradeID int64, eventType, detail string, at time.Time) error {
+	e := OrderEvent{TradeID: tradeID, EventType: eventType, Detail: &detail, OccurredAt: at}
+	if err := tx.QueryRow("SELECT order_status, filled_qty, filled_avg_price FROM trades WHERE id = ?", tradeID).
+		Scan(&e.OrderStatus, &e.FilledQty, &e.FilledAvgPrice); err != nil {
+		return fmt.Errorf("failed to read disputed trade: %w", err)
+	}
+	e.PreviousStatus, e.PreviousFilledQty = e.OrderStatus, e.FilledQty
+	return db.insertOrderEvent(tx, &e)
+}
+
+// OpenDispute stores a new dispute of a trade, with an order event on the
+// trade, in one transaction. It returns ErrDisputeExists if the trade is
+// already disputed and the dispute wasn't rejected.
+func (db *DB) OpenDispute(d *Dispute) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin dispute: %w", err)
+	}
+	defer tx.Rollback()
+
+	var disputed bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM trade_disputes WHERE trade_id = ? AND status IN (?, ?))
+	`, d.TradeID, DisputeOpen, DisputeUpheld).Scan(&disputed); err != nil {
+		return fmt.Errorf("failed to check trade disputes: %w", err)
+	}
+	if disputed {
+		return ErrDisputeExists
+	}
+
+	d.Status = DisputeOpen
+	result, err := tx.Exec(`
+		INSERT INTO trade_disputes (trade_id, user_id, reason, status, opened_at) VALUES (?, ?, ?, ?, ?)
+	`, d.TradeID, d.UserID, d.Reason, d.Status, utc(d.OpenedAt))
+	if err != nil {
+		return fmt.Errorf("failed to open dispute: %w", err)
+	}
+	if d.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get dispute ID: %w", err)
+	}
+	if err := db.disputeEvent(tx, d.TradeID, EventDisputed, fmt.Sprintf("dispute %d: %s", d.ID, d.Reason), d.OpenedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit dispute: %w", err)
+	}
+	log.Printf("User %s disputed trade ID=%d (dispute ID=%d)", d.UserID, d.TradeID, d.ID)
+	return nil
+}
+
+// ResolveDispute upholds or rejects an open dispute, with an order event on
+// its trade. An upheld dispute books adjustment against tradeDate. It
+// returns the resolved dispute, or nil if there is no open dispute with
+// that ID.
+func (db *DB) ResolveDispute(id int64, status, note string, adjustment decimal.Decimal, tradeDate string, at time.Time) (*Dispute, error) {
+	if status != DisputeUpheld && status != DisputeRejected {
+		return nil, fmt.Errorf("invalid dispute resolution %q", status)
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin dispute resolution: %w", err)
+	}
+	defer tx.Rollback()
+
+	var date *string
+	if status == DisputeUpheld {
+		date = &tradeDate
+	} else {
+		adjustment = decimal.Zero
+	}
+	result, err := tx.Exec(`
+		UPDATE trade_disputes SET status = ?, resolved_at = ?, resolution_note = ?, adjustment = ?, trade_date = ?
+		WHERE id = ? AND status = ?
+	`, status, utc(at), nullString(note), adjustment.String(), date, id, DisputeOpen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dispute: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dispute: %w", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	d, err := scanDispute(tx.QueryRow("SELECT "+disputeColumns+" FROM trade_disputes WHERE id = ?", id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dispute: %w", err)
+	}
+	detail := fmt.Sprintf("dispute %d %s", id, status)
+	if status == DisputeUpheld {
+		detail += fmt.Sprintf(", adjustment %s on %s", adjustment, tradeDate)
+	}
+	if note != "" {
+		detail += ": " + note
+	}
+	if err := db.disputeEvent(tx, d.TradeID, EventDisputeResolved, detail, at); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit dispute resolution: %w", err)
+	}
+	log.Printf("Resolved dispute ID=%d of trade ID=%d: %s", id, d.TradeID, status)
+	return d, nil
+}
+
+// GetDispute retrieves a dispute, or nil if there is none with that ID
+func (db *DB) GetDispute(id int64) (*Dispute, error) {
+	d, err := scanDispute(db.conn.QueryRow("SELECT "+disputeColumns+" FROM trade_disputes WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dispute: %w", err)
+	}
+	return d, nil
+}
+
+// GetDisputes lists disputes, newest first: userID's, or everyone's if it
+// is empty, in status, or any status if it is empty
+func (db *DB) GetDisputes(userID, status string) ([]Dispute, error) {
+	var where []string
+	var args []any
+	if userID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, userID)
+	}
+	if status != "" {
+		where = append(where, "status = ?")
+		args = append(args, status)
+	}
+	query := "SELECT " + disputeColumns + " FROM trade_disputes"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query disputes: %w", err)
+	}
+	defer rows.Close()
+
+	disputes := []Dispute{}
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dispute: %w", err)
+		}
+		disputes = append(disputes, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate disputes: %w", err)
+	}
+	return disputes, nil
+}
+
+// GetDisputeStatusByTrade returns the status of the latest dispute of each
+// of tradeIDs that has been disputed
+func (db *DB) GetDisputeStatusByTrade(tradeIDs []int64) (map[int64]string, error) {
+	byTrade := make(map[int64]string)
+	if len(tradeIDs) == 0 {
+		return byTrade, nil
+	}
+
+	args := make([]any, len(tradeIDs))
+	for i, id := range tradeIDs {
+		args[i] = id
+	}
+	rows, err := db.conn.Query(`
+		SELECT trade_id, status FROM trade_disputes
+		WHERE trade_id IN (?`+strings.Repeat(", ?", len(tradeIDs)-1)+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trade disputes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tradeID int64
+		var status string
+		if err := rows.Scan(&tradeID, &status); err != nil {
+			return nil, fmt.Errorf("failed to scan trade dispute: %w", err)
+		}
+		byTrade[tradeID] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate trade disputes: %w", err)
+	}
+	return byTrade, nil
+}
+
+// GetDisputeAdjustments returns the upheld disputes booked on session dates
+// from to to, inclusive, with their trades' books and symbols
+func (db *DB) GetDisputeAdjustments(from, to string) ([]DisputeAdjustment, error) {
+	rows, err := db.conn.Query(`
+		SELECT d.id, d.trade_id, d.trade_date, t.user_id, COALESCE(t.strategy_id, 0), t.symbol, d.adjustment
+		FROM trade_disputes d
+		JOIN trades t ON t.id = d.trade_id
+		WHERE d.status = ? AND d.trade_date BETWEEN ? AND ?
+		ORDER BY d.trade_date, d.id
+	`, DisputeUpheld, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dispute adjustments: %w", err)
+	}
+	defer rows.Close()
+
+	var adjustments []DisputeAdjustment
+	for rows.Next() {
+		var a DisputeAdjustment
+		if err := rows.Scan(&a.DisputeID, &a.TradeID, &a.TradeDate, &a.UserID, &a.StrategyID, &a.Symbol, &a.Adjustment); err != nil {
+			return nil, fmt.Errorf("failed to scan dispute adjustment: %w", err)
+		}
+		adjustments = append(adjustments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dispute adjustments: %w", err)
+	}
+	return adjustments, nil
+}
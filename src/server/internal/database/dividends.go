@@ -0,0 +1,91 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Dividend is one book's share of a dividend paid into a broker account
+type Dividend struct {
+	ActivityID string          `json:"activity_id"`
+	TradeDate  string          `json:"trade_date"`
+	UserID     string          `json:"user_id"`
+	StrategyID int64           `json:"strategy_id"`
+	Symbol     string          `json:"symbol"`
+	Qty        decimal.Decimal `json:"qty"`
+	Amount     decimal.Decimal `json:"amount"`
+}
+
+// DividendImported reports whether the broker activity has been recorded
+func (db *DB) DividendImported(activityID string) (bool, error) {
+	var n int
+	if err := db.conn.QueryRow(
+		"SELECT COUNT(*) FROM dividends WHERE activity_id = ?", activityID,
+	).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to check dividend: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecordDividend stores each book's share of one broker activity and adds
+// it to the book's cash for the day, in one transaction
+func (db *DB) RecordDividend(shares []Dividend) error {
+	db.fillMu.Lock()
+	defer db.fillMu.Unlock()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin dividend transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, d := range shares {
+		if _, err := tx.Exec(`
+			INSERT INTO dividends (activity_id, trade_date, user_id, strategy_id, symbol, qty, amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, d.ActivityID, d.TradeDate, d.UserID, d.StrategyID, d.Symbol, d.Qty.String(), d.Amount.String()); err != nil {
+			return fmt.Errorf("failed to record dividend: %w", err)
+		}
+		if err := db.addDailyCash(tx, d.TradeDate, d.UserID, d.StrategyID, cashDelta{dividends: d.Amount}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit dividend: %w", err)
+	}
+	return nil
+}
+
+// GetDividends retrieves the dividends books received on a date
+func (db *DB) GetDividends(date string) ([]Dividend, error) {
+	rows, err := db.conn.Query(`
+		SELECT activity_id, trade_date, user_id, strategy_id, symbol, qty, amount
+		FROM dividends
+		WHERE trade_date = ?
+		ORDER BY user_id, strategy_id, symbol
+	`, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dividends: %w", err)
+	}
+	defer rows.Close()
+
+	dividends := []Dividend{}
+	for rows.Next() {
+		var d Dividend
+		var qty, amount string
+		if err := rows.Scan(&d.ActivityID, &d.TradeDate, &d.UserID, &d.StrategyID, &d.Symbol, &qty, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan dividend: %w", err)
+		}
+		if err := parseDecimals([]string{qty, amount}, []*decimal.Decimal{&d.Qty, &d.Amount}); err != nil {
+			return nil, fmt.Errorf("invalid dividend: %w", err)
+		}
+		dividends = append(dividends, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate dividends: %w", err)
+	}
+
+	return dividends, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// EarningsEvent is a scheduled earnings report
+type EarningsEvent struct {
+	Symbol      string           `json:"symbol"`
+	ReportDate  string           `json:"report_date"`
+	Timing      string           `json:"timing"`
+	ReportAt    time.Time        `json:"report_at"`
+	EPSEstimate *decimal.Decimal `json:"eps_estimate,omitempty"`
+	Source      string           `json:"source"`
+}
+
+// UpsertEarningsEvents stores earnings events, replacing any existing entry
+// for the same symbol and report date
+func (db *DB) UpsertEarningsEvents(events []EarningsEvent) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin earnings transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO earnings_events (symbol, report_date, timing, report_at, eps_estimate, source, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (symbol, report_date) DO UPDATE SET
+			timing = excluded.timing,
+			report_at = excluded.report_at,
+			eps_estimate = excluded.eps_estimate,
+			source = excluded.source,
+			updated_at = excluded.updated_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare earnings upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, e := range events {
+		if _, err := stmt.Exec(e.Symbol, e.ReportDate, e.Timing, utc(e.ReportAt), e.EPSEstimate, e.Source, now); err != nil {
+			return fmt.Errorf("failed to store earnings event for %s: %w", e.Symbol, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit earnings events: %w", err)
+	}
+
+	log.Printf("Stored %d earnings events", len(events))
+	return nil
+}
+
+// GetEarningsEvents returns earnings reports expected in [from, to], soonest
+// first, optionally only for the given symbols
+func (db *DB) GetEarningsEvents(from, to time.Time, symbols []string) ([]EarningsEvent, error) {
+	query := `
+		SELECT symbol, report_date, timing, report_at, eps_estimate, source
+		FROM earnings_events
+		WHERE report_at >= ? AND report_at <= ?
+	`
+	args := []any{utc(from), utc(to)}
+	if len(symbols) > 0 {
+		query += " AND symbol IN (?" + strings.Repeat(", ?", len(symbols)-1) + ")"
+		for _, s := range symbols {
+			args = append(args, s)
+		}
+	}
+	query += " ORDER BY report_at, symbol"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query earnings events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []EarningsEvent
+	for rows.Next() {
+		var e EarningsEvent
+		if err := rows.Scan(&e.Symbol, &e.ReportDate, &e.Timing, &e.ReportAt, &e.EPSEstimate, &e.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan earnings event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate earnings events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Experiment represents an A/B comparison between two strategy variants
+type Experiment struct {
+	ID          int64      `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	StrategyAID int64      `json:"strategy_a_id"`
+	StrategyBID int64      `json:"strategy_b_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StoppedAt   *time.Time `json:"stopped_at,omitempty"`
+}
+
+// CreateExperiment registers a new A/B experiment
+func (db *DB) CreateExperiment(exp *Experiment) (int64, error) {
+	query := `
+		INSERT INTO experiments (user_id, name, strategy_a_id, strategy_b_id)
+		VALUES (?, ?, ?, ?)
+	`
+
+	result, err := db.conn.Exec(query, exp.UserID, exp.Name, exp.StrategyAID, exp.StrategyBID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create experiment: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get experiment ID: %w", err)
+	}
+
+	log.Printf("Created experiment ID=%d name=%s A=%d B=%d for user=%s",
+		id, exp.Name, exp.StrategyAID, exp.StrategyBID, exp.UserID)
+	return id, nil
+}
+
+// GetExperimentByID retrieves an experiment by ID
+func (db *DB) GetExperimentByID(id int64) (*Experiment, error) {
+	query := `
+		SELECT id, user_id, name, strategy_a_id, strategy_b_id, status, created_at, stopped_at
+		FROM experiments
+		WHERE id = ?
+	`
+
+	var e Experiment
+	err := db.conn.QueryRow(query, id).Scan(
+		&e.ID, &e.UserID, &e.Name, &e.StrategyAID, &e.StrategyBID,
+		&e.Status, &e.CreatedAt, &e.StoppedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get experiment: %w", err)
+	}
+
+	return &e, nil
+}
+
+// IsSimulatedVariant reports whether the strategy is variant B of a running
+// experiment, in which case its orders must be routed to the simulator
+func (db *DB) IsSimulatedVariant(strategyID int64) (bool, error) {
+	query := `
+		SELECT 1 FROM experiments
+		WHERE strategy_b_id = ? AND status = 'running'
+		LIMIT 1
+	`
+
+	var one int
+	err := db.conn.QueryRow(query, strategyID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up experiment variant: %w", err)
+	}
+
+	return true, nil
+}
+
+// StopExperiment marks an experiment as stopped; variant B orders are no longer
+// routed to the simulator afterwards
+func (db *DB) StopExperiment(id int64) error {
+	query := `
+		UPDATE experiments
+		SET status = 'stopped', stopped_at = ?
+		WHERE id = ? AND status = 'running'
+	`
+
+	result, err := db.conn.Exec(query, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to stop experiment: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("experiment %d is not running", id)
+	}
+
+	log.Printf("Stopped experiment ID=%d", id)
+	return nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"desk/internal/orders"
+)
+
+// MarkGTCDrift records that a GTC order's limit has drifted beyond the
+// stale threshold at, unless it already had, and returns when the drift
+// began
+func (db *DB) MarkGTCDrift(tradeID int64, at time.Time) (time.Time, error) {
+	if _, err := db.conn.Exec(`
+		INSERT INTO gtc_drift (trade_id, since) VALUES (?, ?)
+		ON CONFLICT(trade_id) DO NOTHING
+	`, tradeID, utc(at)); err != nil {
+		return time.Time{}, fmt.Errorf("failed to record GTC drift: %w", err)
+	}
+	var since time.Time
+	if err := db.conn.QueryRow("SELECT since FROM gtc_drift WHERE trade_id = ?", tradeID).Scan(&since); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read GTC drift: %w", err)
+	}
+	return since, nil
+}
+
+// ClearGTCDrift forgets a GTC order's drift, once it is back within the
+// threshold
+func (db *DB) ClearGTCDrift(tradeID int64) error {
+	if _, err := db.conn.Exec("DELETE FROM gtc_drift WHERE trade_id = ?", tradeID); err != nil {
+		return fmt.Errorf("failed to clear GTC drift: %w", err)
+	}
+	return nil
+}
+
+// PruneGTCDrift forgets the drift of GTC orders that have finished
+func (db *DB) PruneGTCDrift() error {
+	terminal := orders.TerminalStatuses()
+	args := make([]any, len(terminal))
+	for i, s := range terminal {
+		args[i] = s
+	}
+	if _, err := db.conn.Exec(`
+		DELETE FROM gtc_drift WHERE trade_id IN (
+			SELECT id FROM trades WHERE order_status IN (?`+strings.Repeat(", ?", len(terminal)-1)+`)
+		)
+	`, args...); err != nil {
+		return fmt.Errorf("failed to prune GTC drift: %w", err)
+	}
+	return nil
+}
+
+// GetGTCDrifts returns when each drifting GTC order's drift began, by trade
+// ID
+func (db *DB) GetGTCDrifts() (map[int64]time.Time, error) {
+	rows, err := db.conn.Query("SELECT trade_id, since FROM gtc_drift")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GTC drift: %w", err)
+	}
+	defer rows.Close()
+
+	drifts := make(map[int64]time.Time)
+	for rows.Next() {
+		var id int64
+		var since time.Time
+		if err := rows.Scan(&id, &since); err != nil {
+			return nil, fmt.Errorf("failed to scan GTC drift: %w", err)
+		}
+		drifts[id] = since
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GTC drift: %w", err)
+	}
+	return drifts, nil
+}
@@ -0,0 +1,446 @@
+package database
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+)
+
+// Integrity issue severities. Errors are states the desk can never produce
+// on its own; warnings may be legitimate and need a look.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// IntegrityFix is a statement that repairs one issue
+type IntegrityFix struct {
+	SQL  string `json:"sql"`
+	Args []any  `json:"args,omitempty"`
+}
+
+// IntegrityIssue is one problem found by CheckIntegrity. Fix is nil for
+// problems that need a person to decide, such as an overfilled trade.
+type IntegrityIssue struct {
+	Check    string        `json:"check"`
+	Severity string        `json:"severity"`
+	Table    string        `json:"table"`
+	RowID    int64         `json:"row_id,omitempty"`
+	Detail   string        `json:"detail"`
+	Fix      *IntegrityFix `json:"fix,omitempty"`
+	Fixed    bool          `json:"fixed,omitempty"`
+}
+
+// IntegrityReport is the result of an integrity check, and of the repair if
+// one was run
+type IntegrityReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Issues    []IntegrityIssue `json:"issues"`
+	Errors    int              `json:"errors"`
+	Warnings  int              `json:"warnings"`
+	Fixable   int              `json:"fixable"`
+	Fixed     int              `json:"fixed"`
+}
+
+func (r *IntegrityReport) add(issue IntegrityIssue) {
+	r.Issues = append(r.Issues, issue)
+	if issue.Severity == SeverityError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+	if issue.Fix != nil {
+		r.Fixable++
+	}
+}
+
+// CheckIntegrity validates the database: SQLite's own consistency check,
+// referential integrity, trades in impossible states, fills missing from a
+// trade's order events, positions no fills explain, and negative cash. It
+// only reads.
+func (db *DB) CheckIntegrity() (*IntegrityReport, error) {
+	report := &IntegrityReport{CheckedAt: utc(clock.Now()), Issues: []IntegrityIssue{}}
+	checks := []func(*IntegrityReport) error{
+		db.checkStorage,
+		db.checkForeignKeys,
+		db.checkTradeStates,
+		db.checkFillEvents,
+		db.checkPositions,
+		db.checkCash,
+	}
+	for _, check := range checks {
+		if err := check(report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// RepairIntegrity runs CheckIntegrity and applies the fix of every fixable
+// issue in a single transaction. Issues without a fix are left for a person.
+func (db *DB) RepairIntegrity() (*IntegrityReport, error) {
+	report, err := db.CheckIntegrity()
+	if err != nil || report.Fixable == 0 {
+		return report, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin integrity repair: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range report.Issues {
+		issue := &report.Issues[i]
+		if issue.Fix == nil {
+			continue
+		}
+		if _, err := tx.Exec(issue.Fix.SQL, issue.Fix.Args...); err != nil {
+			return nil, fmt.Errorf("failed to fix %s issue in %s row %d: %w", issue.Check, issue.Table, issue.RowID, err)
+		}
+		issue.Fixed = true
+		report.Fixed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit integrity repair: %w", err)
+	}
+	log.Printf("Repaired %d integrity issues", report.Fixed)
+	return report, nil
+}
+
+// checkStorage runs SQLite's quick check of the file's structure. Damage
+// there can't be fixed in place; restore a backup.
+func (db *DB) checkStorage(report *IntegrityReport) error {
+	rows, err := db.conn.Query("PRAGMA quick_check")
+	if err != nil {
+		return fmt.Errorf("failed to run quick check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to scan quick check: %w", err)
+		}
+		if result == "ok" {
+			continue
+		}
+		report.add(IntegrityIssue{
+			Check:    "storage",
+			Severity: SeverityError,
+			Detail:   result + "; restore from a backup",
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate quick check: %w", err)
+	}
+	return nil
+}
+
+// checkForeignKeys finds rows referencing rows that no longer exist. The fix
+// does what the foreign key's ON DELETE would have: clears the reference if
+// it is SET NULL, and deletes the orphan otherwise.
+func (db *DB) checkForeignKeys(report *IntegrityReport) error {
+	type violation struct {
+		table, parent string
+		rowID         int64
+		fkID          int
+	}
+
+	rows, err := db.conn.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return fmt.Errorf("failed to run foreign key check: %w", err)
+	}
+	var violations []violation
+	for rows.Next() {
+		var v violation
+		var rowID sql.NullInt64
+		if err := rows.Scan(&v.table, &rowID, &v.parent, &v.fkID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan foreign key check: %w", err)
+		}
+		v.rowID = rowID.Int64
+		violations = append(violations, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate foreign key check: %w", err)
+	}
+
+	for _, v := range violations {
+		column, onDelete, err := db.foreignKey(v.table, v.fkID)
+		if err != nil {
+			return err
+		}
+
+		var value any
+		if err := db.conn.QueryRow(
+			fmt.Sprintf(`SELECT "%s" FROM "%s" WHERE rowid = ?`, column, v.table), v.rowID,
+		).Scan(&value); err != nil {
+			return fmt.Errorf("failed to read orphaned %s row %d: %w", v.table, v.rowID, err)
+		}
+
+		fix := &IntegrityFix{SQL: fmt.Sprintf(`DELETE FROM "%s" WHERE rowid = ?`, v.table), Args: []any{v.rowID}}
+		if onDelete == "SET NULL" {
+			fix.SQL = fmt.Sprintf(`UPDATE "%s" SET "%s" = NULL WHERE rowid = ?`, v.table, column)
+		}
+		report.add(IntegrityIssue{
+			Check:    "foreign_key",
+			Severity: SeverityError,
+			Table:    v.table,
+			RowID:    v.rowID,
+			Detail:   fmt.Sprintf("%s %v references a missing %s row", column, value, v.parent),
+			Fix:      fix,
+		})
+	}
+	return nil
+}
+
+// foreignKey returns the column and ON DELETE action of one of a table's
+// foreign keys
+func (db *DB) foreignKey(table string, id int) (string, string, error) {
+	rows, err := db.conn.Query(fmt.Sprintf(`PRAGMA foreign_key_list("%s")`, table))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list %s foreign keys: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fkID, seq int
+		var parent, from, onUpdate, onDelete, match string
+		var to sql.NullString
+		if err := rows.Scan(&fkID, &seq, &parent, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return "", "", fmt.Errorf("failed to scan %s foreign key: %w", table, err)
+		}
+		if fkID == id {
+			return from, onDelete, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", "", fmt.Errorf("failed to iterate %s foreign keys: %w", table, err)
+	}
+	return "", "", fmt.Errorf("%s has no foreign key %d", table, id)
+}
+
+// checkTradeStates finds trades in states no broker report can produce:
+// more filled than ordered, negative quantities, fills without a price, and
+// filled orders that aren't
+func (db *DB) checkTradeStates(report *IntegrityReport) error {
+	rows, err := db.conn.Query(`
+		SELECT id, qty, COALESCE(filled_qty, '0'), filled_avg_price, order_status FROM trades ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var qtyStr, filledStr, status string
+		var price sql.NullString
+		if err := rows.Scan(&id, &qtyStr, &filledStr, &price, &status); err != nil {
+			return fmt.Errorf("failed to scan trade: %w", err)
+		}
+		issue := IntegrityIssue{Check: "trade_state", Severity: SeverityError, Table: "trades", RowID: id}
+
+		var qty, filled decimal.Decimal
+		if err := parseDecimals([]string{qtyStr, filledStr}, []*decimal.Decimal{&qty, &filled}); err != nil {
+			issue.Detail = fmt.Sprintf("unreadable quantity: qty %q, filled_qty %q", qtyStr, filledStr)
+			report.add(issue)
+			continue
+		}
+
+		switch {
+		case !qty.IsPositive():
+			issue.Detail = fmt.Sprintf("qty %s is not positive", qty)
+		case filled.IsNegative():
+			issue.Detail = fmt.Sprintf("filled_qty %s is negative", filled)
+		case filled.GreaterThan(qty):
+			issue.Detail = fmt.Sprintf("filled_qty %s exceeds qty %s", filled, qty)
+		case filled.IsPositive() && !price.Valid:
+			issue.Detail = fmt.Sprintf("filled_qty %s has no filled_avg_price", filled)
+		case status == "filled" && !filled.Equal(qty):
+			issue.Severity = SeverityWarning
+			issue.Detail = fmt.Sprintf("status is filled but only %s of %s filled", filled, qty)
+		case status == "partially_filled" && !filled.IsPositive():
+			issue.Severity = SeverityWarning
+			issue.Detail = "status is partially_filled but nothing filled"
+		default:
+			continue
+		}
+		report.add(issue)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate trades: %w", err)
+	}
+	return nil
+}
+
+// checkFillEvents finds trades whose state differs from where their order
+// events leave them: a fill or status change recorded on the trade without
+// its event. The fix records the missing event, marked as added by fsck.
+func (db *DB) checkFillEvents(report *IntegrityReport) error {
+	rows, err := db.conn.Query(`
+		SELECT t.id, t.order_status, COALESCE(t.filled_qty, '0'), t.filled_avg_price,
+		       e.order_status, e.filled_qty
+		FROM trades t
+		JOIN order_events e ON e.id = (SELECT MAX(id) FROM order_events WHERE trade_id = t.id)
+		ORDER BY t.id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query trade events: %w", err)
+	}
+	defer rows.Close()
+
+	now := clock.Now().UnixMicro()
+	for rows.Next() {
+		var id int64
+		var status, filledStr, eventStatus, eventFilledStr string
+		var price sql.NullString
+		if err := rows.Scan(&id, &status, &filledStr, &price, &eventStatus, &eventFilledStr); err != nil {
+			return fmt.Errorf("failed to scan trade events: %w", err)
+		}
+		var filled, eventFilled decimal.Decimal
+		if err := parseDecimals([]string{filledStr, eventFilledStr}, []*decimal.Decimal{&filled, &eventFilled}); err != nil {
+			// checkTradeStates reports unreadable trades
+			continue
+		}
+		if status == eventStatus && filled.Equal(eventFilled) {
+			continue
+		}
+
+		report.add(IntegrityIssue{
+			Check:    "fill_event",
+			Severity: SeverityError,
+			Table:    "trades",
+			RowID:    id,
+			Detail: fmt.Sprintf("trade is %s with %s filled but its last order event left it %s with %s filled",
+				status, filled, eventStatus, eventFilled),
+			Fix: &IntegrityFix{
+				SQL: `
+					INSERT INTO order_events (
+						trade_id, event_type, previous_status, previous_filled_qty, order_status, filled_qty,
+						filled_avg_price, detail, occurred_at_us
+					) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				`,
+				Args: []any{id, EventStatus, eventStatus, eventFilled.String(), status, filled.String(),
+					price, "recorded by fsck", now},
+			},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate trade events: %w", err)
+	}
+	return nil
+}
+
+// checkPositions compares every running cost-basis position with the net of
+// the fills behind it. A position no fill explains is orphaned and removed
+// by the fix; one that disagrees with its fills is reported for a rebuild.
+func (db *DB) checkPositions(report *IntegrityReport) error {
+	type key struct {
+		userID     string
+		strategyID int64
+		symbol     string
+	}
+
+	trades, err := db.GetFilledTrades()
+	if err != nil {
+		return err
+	}
+	net := make(map[key]decimal.Decimal)
+	for _, t := range trades {
+		k := key{userID: t.UserID, symbol: t.Symbol}
+		if t.StrategyID != nil {
+			k.strategyID = *t.StrategyID
+		}
+		if t.Side == "sell" {
+			net[k] = net[k].Sub(t.FilledQty)
+		} else {
+			net[k] = net[k].Add(t.FilledQty)
+		}
+	}
+
+	rows, err := db.conn.Query(`SELECT rowid, user_id, strategy_id, symbol, qty FROM position_costs ORDER BY rowid`)
+	if err != nil {
+		return fmt.Errorf("failed to query position costs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rowID int64
+		var k key
+		var qtyStr string
+		if err := rows.Scan(&rowID, &k.userID, &k.strategyID, &k.symbol, &qtyStr); err != nil {
+			return fmt.Errorf("failed to scan position cost: %w", err)
+		}
+		issue := IntegrityIssue{Check: "position", Table: "position_costs", RowID: rowID}
+		book := fmt.Sprintf("%s's %s position", k.userID, k.symbol)
+		if k.strategyID != 0 {
+			book = fmt.Sprintf("%s's %s position in strategy %d", k.userID, k.symbol, k.strategyID)
+		}
+
+		qty, err := decimal.NewFromString(qtyStr)
+		if err != nil {
+			issue.Severity = SeverityError
+			issue.Detail = fmt.Sprintf("%s has unreadable qty %q", book, qtyStr)
+			report.add(issue)
+			continue
+		}
+		fills, ok := net[k]
+		switch {
+		case qty.IsZero() || qty.Equal(fills):
+			continue
+		case !ok:
+			issue.Severity = SeverityError
+			issue.Detail = fmt.Sprintf("%s of %s has no fills", book, qty)
+			issue.Fix = &IntegrityFix{SQL: "DELETE FROM position_costs WHERE rowid = ?", Args: []any{rowID}}
+		default:
+			issue.Severity = SeverityWarning
+			issue.Detail = fmt.Sprintf("%s is %s but its fills net to %s", book, qty, fills)
+		}
+		report.add(issue)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate position costs: %w", err)
+	}
+	return nil
+}
+
+// checkCash finds books whose cash balance is negative. Margin can make
+// that legitimate, so it is a warning; the fix is a deposit, not a statement.
+func (db *DB) checkCash(report *IntegrityReport) error {
+	balances, err := db.CashBalances("9999-12-31")
+	if err != nil {
+		return err
+	}
+	books := slices.SortedFunc(maps.Keys(balances), func(a, b CashBook) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.StrategyID, b.StrategyID))
+	})
+	for _, book := range books {
+		balance := balances[book]
+		if !balance.IsNegative() {
+			continue
+		}
+		owner := book.UserID
+		if book.StrategyID != 0 {
+			owner = fmt.Sprintf("%s's strategy %d", book.UserID, book.StrategyID)
+		}
+		report.add(IntegrityIssue{
+			Check:    "cash",
+			Severity: SeverityWarning,
+			Table:    "daily_cash",
+			Detail:   fmt.Sprintf("%s has a cash balance of %s", owner, balance.StringFixed(2)),
+		})
+	}
+	return nil
+}
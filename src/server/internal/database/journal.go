@@ -0,0 +1,367 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// JournalEntry is a user's written reflection on a trading day and,
+// optionally, the trades they made in it. Thesis, Outcome and Lessons are
+// markdown.
+type JournalEntry struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+	// SessionDate is the exchange session date (YYYY-MM-DD) the entry is about
+	SessionDate string    `json:"session_date"`
+	Title       string    `json:"title"`
+	Thesis      string    `json:"thesis"`
+	Outcome     string    `json:"outcome"`
+	Lessons     string    `json:"lessons"`
+	TradeIDs    []int64   `json:"trade_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// JournalQuery selects journal entries. Zero fields don't filter.
+type JournalQuery struct {
+	// TradeID only matches entries linked to this trade
+	TradeID int64
+	// From and To bound the session date, inclusive
+	From string
+	To   string
+	// Search matches entries whose title, thesis, outcome or lessons contain
+	// it, ignoring case
+	Search string
+	Limit  int
+}
+
+// CreateJournalEntry stores a new journal entry and links its trades
+func (db *DB) CreateJournalEntry(e *JournalEntry) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin journal transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := utc(time.Now())
+	result, err := tx.Exec(`
+		INSERT INTO journal_entries (user_id, session_date, title, thesis, outcome, lessons, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.UserID, e.SessionDate, e.Title, e.Thesis, e.Outcome, e.Lessons, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get journal entry ID: %w", err)
+	}
+
+	if err := linkJournalTrades(tx, id, e.UserID, e.TradeIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit journal entry: %w", err)
+	}
+
+	log.Printf("Created journal entry ID=%d for user=%s on %s (%d trades)", id, e.UserID, e.SessionDate, len(e.TradeIDs))
+	return id, nil
+}
+
+// linkJournalTrades links trades to an entry, ignoring any already linked.
+// Every trade must belong to userID.
+func linkJournalTrades(tx *sql.Tx, entryID int64, userID string, tradeIDs []int64) error {
+	for _, tradeID := range tradeIDs {
+		var owner string
+		err := tx.QueryRow("SELECT user_id FROM trades WHERE id = ?", tradeID).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != userID) {
+			return fmt.Errorf("%w: %d", ErrUnknownTrade, tradeID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up trade: %w", err)
+		}
+
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO journal_entry_trades (entry_id, trade_id) VALUES (?, ?)
+		`, entryID, tradeID); err != nil {
+			return fmt.Errorf("failed to link trade to journal entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetJournalEntry retrieves a journal entry and its trade IDs
+func (db *DB) GetJournalEntry(id int64) (*JournalEntry, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, session_date, title, thesis, outcome, lessons, created_at, updated_at
+		FROM journal_entries WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := db.scanJournalEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("failed to get journal entry: %w", sql.ErrNoRows)
+	}
+	return &entries[0], nil
+}
+
+// GetJournalEntries retrieves userID's journal entries matching q, newest
+// session first
+func (db *DB) GetJournalEntries(userID string, q JournalQuery) ([]JournalEntry, error) {
+	query := `
+		SELECT id, user_id, session_date, title, thesis, outcome, lessons, created_at, updated_at
+		FROM journal_entries
+		WHERE user_id = ?
+	`
+	args := []any{userID}
+	if q.TradeID != 0 {
+		query += " AND id IN (SELECT entry_id FROM journal_entry_trades WHERE trade_id = ?)"
+		args = append(args, q.TradeID)
+	}
+	if q.From != "" {
+		query += " AND session_date >= ?"
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		query += " AND session_date <= ?"
+		args = append(args, q.To)
+	}
+	if q.Search != "" {
+		pattern := "%" + escapeLike(q.Search) + "%"
+		query += ` AND (title LIKE ? ESCAPE '\' OR thesis LIKE ? ESCAPE '\'
+			OR outcome LIKE ? ESCAPE '\' OR lessons LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	query += " ORDER BY session_date DESC, id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal entries: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanJournalEntries(rows)
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// scanJournalEntries reads journal entries and loads their trade IDs
+func (db *DB) scanJournalEntries(rows *sql.Rows) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for rows.Next() {
+		var e JournalEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.SessionDate, &e.Title, &e.Thesis, &e.Outcome, &e.Lessons, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan journal entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate journal entries: %w", err)
+	}
+	rows.Close()
+
+	for i := range entries {
+		ids, err := db.journalTradeIDs(entries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].TradeIDs = ids
+	}
+	return entries, nil
+}
+
+func (db *DB) journalTradeIDs(entryID int64) ([]int64, error) {
+	rows, err := db.conn.Query(`
+		SELECT trade_id FROM journal_entry_trades WHERE entry_id = ? ORDER BY trade_id
+	`, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal entry trades: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan journal entry trade: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate journal entry trades: %w", err)
+	}
+	return ids, nil
+}
+
+// GetJournalEntryIDsByTrade maps each of tradeIDs that has journal entries to
+// their IDs, oldest first
+func (db *DB) GetJournalEntryIDsByTrade(tradeIDs []int64) (map[int64][]int64, error) {
+	byTrade := make(map[int64][]int64)
+	if len(tradeIDs) == 0 {
+		return byTrade, nil
+	}
+
+	args := make([]any, len(tradeIDs))
+	for i, id := range tradeIDs {
+		args[i] = id
+	}
+	rows, err := db.conn.Query(`
+		SELECT trade_id, entry_id FROM journal_entry_trades
+		WHERE trade_id IN (?`+strings.Repeat(", ?", len(tradeIDs)-1)+`)
+		ORDER BY trade_id, entry_id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal entry trades: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tradeID, entryID int64
+		if err := rows.Scan(&tradeID, &entryID); err != nil {
+			return nil, fmt.Errorf("failed to scan journal entry trade: %w", err)
+		}
+		byTrade[tradeID] = append(byTrade[tradeID], entryID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate journal entry trades: %w", err)
+	}
+	return byTrade, nil
+}
+
+// GetJournalTrades retrieves the trades linked to a journal entry, oldest
+// first
+func (db *DB) GetJournalTrades(entryID int64) ([]Trade, error) {
+	rows, err := db.conn.Query(`
+		SELECT t.id, t.strategy_id, t.user_id, t.order_id, t.symbol, t.qty, t.side,
+		       t.order_type, t.time_in_force, t.limit_price, t.stop_price,
+		       t.filled_qty, t.filled_avg_price, t.order_status, t.submitted_at,
+		       t.filled_at, t.error_message, t.venue, t.strategy_version,
+		       t.received_at_us, t.sent_at_us, t.acked_at_us, t.client_order_id, t.hedge_rule, t.extended_hours, t.source
+		FROM trades t
+		JOIN journal_entry_trades j ON j.trade_id = t.id
+		WHERE j.entry_id = ?
+		ORDER BY t.submitted_at ASC, t.id ASC
+	`, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal entry trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// GetUserTrades retrieves trades of userID's by ID, oldest first. It returns
+// ErrUnknownTrade if any of them doesn't exist or belongs to another user.
+func (db *DB) GetUserTrades(userID string, tradeIDs []int64) ([]Trade, error) {
+	if len(tradeIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []any{userID}
+	for _, id := range tradeIDs {
+		args = append(args, id)
+	}
+	rows, err := db.conn.Query(`
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE user_id = ? AND id IN (?`+strings.Repeat(", ?", len(tradeIDs)-1)+`)
+		ORDER BY submitted_at ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades, err := scanTrades(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool, len(trades))
+	for _, t := range trades {
+		found[t.ID] = true
+	}
+	for _, id := range tradeIDs {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownTrade, id)
+		}
+	}
+	return trades, nil
+}
+
+// UpdateJournalEntry saves an entry's date, title and markdown, and replaces
+// its trade links with TradeIDs
+func (db *DB) UpdateJournalEntry(e *JournalEntry) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin journal transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE journal_entries
+		SET session_date = ?, title = ?, thesis = ?, outcome = ?, lessons = ?, updated_at = ?
+		WHERE id = ?
+	`, e.SessionDate, e.Title, e.Thesis, e.Outcome, e.Lessons, utc(time.Now()), e.ID); err != nil {
+		return fmt.Errorf("failed to update journal entry: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM journal_entry_trades WHERE entry_id = ?", e.ID); err != nil {
+		return fmt.Errorf("failed to unlink journal entry trades: %w", err)
+	}
+	if err := linkJournalTrades(tx, e.ID, e.UserID, e.TradeIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit journal entry: %w", err)
+	}
+
+	log.Printf("Updated journal entry ID=%d", e.ID)
+	return nil
+}
+
+// DeleteJournalEntry deletes a journal entry. Its trades are kept.
+func (db *DB) DeleteJournalEntry(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin journal transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM journal_entry_trades WHERE entry_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete journal entry trades: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM journal_entries WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete journal entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit journal entry deletion: %w", err)
+	}
+
+	log.Printf("Deleted journal entry ID=%d", id)
+	return nil
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// KillStrategy throws a strategy's kill switch: it is locked from starting
+// and its pending conditional orders are canceled. It reports whether the
+// switch was newly thrown, false if the strategy was already killed, and
+// how many conditional orders were canceled. A deleted or unknown strategy
+// is an error.
+func (db *DB) KillStrategy(id int64, reason string, at time.Time) (bool, int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin strategy kill: %w", err)
+	}
+	defer tx.Rollback()
+
+	var killed bool
+	err = tx.QueryRow("SELECT killed_at IS NOT NULL FROM strategies WHERE id = ? AND deleted_at IS NULL", id).Scan(&killed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, 0, fmt.Errorf("strategy %d not found", id)
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to kill strategy: %w", err)
+	}
+	if !killed {
+		if _, err := tx.Exec(`
+			UPDATE strategies SET killed_at = ?, kill_reason = ?, updated_at = ? WHERE id = ?
+		`, utc(at), reason, utc(at), id); err != nil {
+			return false, 0, fmt.Errorf("failed to kill strategy: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE conditional_orders SET status = ? WHERE strategy_id = ? AND status = ?
+	`, ConditionalCanceled, id, ConditionalPending)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to cancel strategy's conditional orders: %w", err)
+	}
+	canceled, err := result.RowsAffected()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to cancel strategy's conditional orders: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("failed to commit strategy kill: %w", err)
+	}
+	if !killed {
+		log.Printf("Killed strategy ID=%d: %s", id, reason)
+	}
+	return !killed, canceled, nil
+}
+
+// ClearStrategyKill lets a killed strategy be started again. It reports
+// false if the strategy isn't killed.
+func (db *DB) ClearStrategyKill(id int64) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE strategies SET killed_at = NULL, kill_reason = NULL, updated_at = ?
+		WHERE id = ? AND killed_at IS NOT NULL
+	`, utc(time.Now()), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear strategy kill: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to clear strategy kill: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Cleared kill of strategy ID=%d", id)
+	}
+	return n == 1, nil
+}
+
+// IsStrategyKilled reports whether a strategy's kill switch is thrown. A
+// strategy that doesn't exist isn't killed.
+func (db *DB) IsStrategyKilled(id int64) (bool, error) {
+	var killed bool
+	err := db.conn.QueryRow("SELECT killed_at IS NOT NULL FROM strategies WHERE id = ?", id).Scan(&killed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check strategy: %w", err)
+	}
+	return killed, nil
+}
+
+// GetKilledStrategies returns the strategies whose kill switch is thrown,
+// most recently killed first
+func (db *DB) GetKilledStrategies() ([]Strategy, error) {
+	rows, err := db.conn.Query(`SELECT ` + strategyColumns + `
+		FROM strategies
+		WHERE killed_at IS NOT NULL AND deleted_at IS NULL
+		ORDER BY killed_at DESC, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query killed strategies: %w", err)
+	}
+	defer rows.Close()
+
+	strategies := []Strategy{}
+	for rows.Next() {
+		s, err := scanStrategy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan strategy: %w", err)
+		}
+		strategies = append(strategies, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate killed strategies: %w", err)
+	}
+	return strategies, nil
+}
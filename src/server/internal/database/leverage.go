@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// LeveragePoint is the account's leverage at one risk snapshot
+type LeveragePoint struct {
+	RecordedAt    time.Time       `json:"recorded_at"`
+	Equity        decimal.Decimal `json:"equity"`
+	GrossExposure decimal.Decimal `json:"gross_exposure"`
+	NetExposure   decimal.Decimal `json:"net_exposure"`
+	Leverage      decimal.Decimal `json:"leverage"`
+}
+
+// RecordLeverage stores a point of leverage history
+func (db *DB) RecordLeverage(p LeveragePoint) error {
+	if _, err := db.conn.Exec(`
+		INSERT INTO leverage_history (recorded_at, equity, gross_exposure, net_exposure, leverage)
+		VALUES (?, ?, ?, ?, ?)
+	`, utc(p.RecordedAt), p.Equity.String(), p.GrossExposure.String(), p.NetExposure.String(), p.Leverage.String()); err != nil {
+		return fmt.Errorf("failed to record leverage: %w", err)
+	}
+	return nil
+}
+
+// GetLeverageHistory retrieves the leverage recorded between from and to,
+// oldest first
+func (db *DB) GetLeverageHistory(from, to time.Time) ([]LeveragePoint, error) {
+	rows, err := db.conn.Query(`
+		SELECT recorded_at, equity, gross_exposure, net_exposure, leverage
+		FROM leverage_history
+		WHERE recorded_at >= ? AND recorded_at <= ?
+		ORDER BY recorded_at ASC, id ASC
+	`, utc(from), utc(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query leverage history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []LeveragePoint
+	for rows.Next() {
+		var p LeveragePoint
+		var equity, gross, net, leverage string
+		if err := rows.Scan(&p.RecordedAt, &equity, &gross, &net, &leverage); err != nil {
+			return nil, fmt.Errorf("failed to scan leverage history: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{equity, gross, net, leverage},
+			[]*decimal.Decimal{&p.Equity, &p.GrossExposure, &p.NetExposure, &p.Leverage},
+		); err != nil {
+			return nil, fmt.Errorf("invalid leverage history: %w", err)
+		}
+		history = append(history, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate leverage history: %w", err)
+	}
+
+	return history, nil
+}
+
+// DeleteLeverageBefore removes leverage history recorded before cutoff
+func (db *DB) DeleteLeverageBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec("DELETE FROM leverage_history WHERE recorded_at < ?", utc(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune leverage history: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("Pruned %d leverage history points before %s", n, cutoff.Format(time.RFC3339))
+	}
+	return n, nil
+}
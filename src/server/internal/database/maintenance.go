@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// SpaceStats describes how much of the database file is in use. Deletes,
+// such as mark archival, leave free pages behind that only VACUUM returns.
+type SpaceStats struct {
+	PageSize  int64 `json:"page_size"`
+	Pages     int64 `json:"pages"`
+	FreePages int64 `json:"free_pages"`
+}
+
+// Bytes returns the size of the database file
+func (s SpaceStats) Bytes() int64 {
+	return s.PageSize * s.Pages
+}
+
+// FreeFraction returns the fraction of the file's pages that are free
+func (s SpaceStats) FreeFraction() float64 {
+	if s.Pages == 0 {
+		return 0
+	}
+	return float64(s.FreePages) / float64(s.Pages)
+}
+
+// SpaceStats returns the database file's page counts
+func (db *DB) SpaceStats(ctx context.Context) (SpaceStats, error) {
+	var s SpaceStats
+	for _, p := range []struct {
+		pragma string
+		dest   *int64
+	}{
+		{"page_size", &s.PageSize},
+		{"page_count", &s.Pages},
+		{"freelist_count", &s.FreePages},
+	} {
+		if err := db.conn.QueryRowContext(ctx, "PRAGMA "+p.pragma).Scan(p.dest); err != nil {
+			return SpaceStats{}, fmt.Errorf("failed to read %s: %w", p.pragma, err)
+		}
+	}
+	return s, nil
+}
+
+// Analyze refreshes the statistics the query planner picks indexes with
+func (db *DB) Analyze(ctx context.Context) error {
+	db.maintMu.Lock()
+	defer db.maintMu.Unlock()
+
+	if _, err := db.conn.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("failed to analyze database: %w", err)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file without its free pages and returns the
+// space stats before and after. The rebuild locks the whole file, so it
+// waits for a running backup, and holds fill bookkeeping back until it is
+// done; other writes in the meantime fail as locked.
+func (db *DB) Vacuum(ctx context.Context) (SpaceStats, SpaceStats, error) {
+	db.maintMu.Lock()
+	defer db.maintMu.Unlock()
+	db.fillMu.Lock()
+	defer db.fillMu.Unlock()
+
+	before, err := db.SpaceStats(ctx)
+	if err != nil {
+		return SpaceStats{}, SpaceStats{}, err
+	}
+	if _, err := db.conn.ExecContext(ctx, "VACUUM"); err != nil {
+		return SpaceStats{}, SpaceStats{}, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	after, err := db.SpaceStats(ctx)
+	if err != nil {
+		return SpaceStats{}, SpaceStats{}, err
+	}
+
+	log.Printf("Vacuumed database from %d to %d bytes", before.Bytes(), after.Bytes())
+	return before, after, nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PositionMark is an open position marked to a price
+type PositionMark struct {
+	MarkedAt     time.Time       `json:"marked_at"`
+	UserID       string          `json:"user_id"`
+	StrategyID   int64           `json:"strategy_id"`
+	Symbol       string          `json:"symbol"`
+	Qty          decimal.Decimal `json:"qty"`
+	AvgCost      decimal.Decimal `json:"avg_cost"`
+	Price        decimal.Decimal `json:"price"`
+	MarketValue  decimal.Decimal `json:"market_value"`
+	UnrealizedPL decimal.Decimal `json:"unrealized_pl"`
+}
+
+// RecordPositionMarks stores a set of marks taken together
+func (db *DB) RecordPositionMarks(marks []PositionMark) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin position marks transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range marks {
+		if _, err := tx.Exec(`
+			INSERT INTO position_marks (marked_at, user_id, strategy_id, symbol, qty, avg_cost, price, unrealized_pl)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, utc(m.MarkedAt), m.UserID, m.StrategyID, m.Symbol,
+			m.Qty.String(), m.AvgCost.String(), m.Price.String(), m.UnrealizedPL.String()); err != nil {
+			return fmt.Errorf("failed to record position mark: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit position marks: %w", err)
+	}
+	return nil
+}
+
+// GetPositionMarks retrieves userID's persisted marks between from and to,
+// oldest first, optionally only for one strategy and one symbol
+func (db *DB) GetPositionMarks(userID string, from, to time.Time, strategyID *int64, symbol string) ([]PositionMark, error) {
+	query := `
+		SELECT marked_at, user_id, strategy_id, symbol, qty, avg_cost, price, unrealized_pl
+		FROM position_marks
+		WHERE user_id = ? AND marked_at >= ? AND marked_at <= ?
+	`
+	args := []any{userID, utc(from), utc(to)}
+	if strategyID != nil {
+		query += " AND strategy_id = ?"
+		args = append(args, *strategyID)
+	}
+	if symbol != "" {
+		query += " AND symbol = ?"
+		args = append(args, symbol)
+	}
+	query += " ORDER BY marked_at ASC, id ASC"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position marks: %w", err)
+	}
+	defer rows.Close()
+
+	var marks []PositionMark
+	for rows.Next() {
+		var m PositionMark
+		var qty, avgCost, price, unrealized string
+		if err := rows.Scan(&m.MarkedAt, &m.UserID, &m.StrategyID, &m.Symbol, &qty, &avgCost, &price, &unrealized); err != nil {
+			return nil, fmt.Errorf("failed to scan position mark: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{qty, avgCost, price, unrealized},
+			[]*decimal.Decimal{&m.Qty, &m.AvgCost, &m.Price, &m.UnrealizedPL},
+		); err != nil {
+			return nil, fmt.Errorf("invalid position mark: %w", err)
+		}
+		m.MarketValue = m.Qty.Mul(m.Price)
+		marks = append(marks, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position marks: %w", err)
+	}
+
+	return marks, nil
+}
+
+// DeletePositionMarksBefore removes marks taken before cutoff
+func (db *DB) DeletePositionMarksBefore(cutoff time.Time) (int64, error) {
+	result, err := db.conn.Exec("DELETE FROM position_marks WHERE marked_at < ?", utc(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune position marks: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("Pruned %d position marks before %s", n, cutoff.Format(time.RFC3339))
+	}
+	return n, nil
+}
+
+// GetPositionMarkTimes returns the distinct times marks were persisted
+// between from and to, oldest first
+func (db *DB) GetPositionMarkTimes(from, to time.Time) ([]time.Time, error) {
+	rows, err := db.conn.Query(`
+		SELECT DISTINCT marked_at FROM position_marks
+		WHERE marked_at >= ? AND marked_at <= ?
+		ORDER BY marked_at ASC
+	`, utc(from), utc(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position mark times: %w", err)
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("failed to scan position mark time: %w", err)
+		}
+		times = append(times, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position mark times: %w", err)
+	}
+	return times, nil
+}
+
+// GetPositionMarksAt retrieves every user's marks persisted at the given
+// times, oldest first
+func (db *DB) GetPositionMarksAt(times []time.Time) ([]PositionMark, error) {
+	if len(times) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(times))
+	for i, t := range times {
+		args[i] = utc(t)
+	}
+	rows, err := db.conn.Query(`
+		SELECT marked_at, user_id, strategy_id, symbol, qty, avg_cost, price, unrealized_pl
+		FROM position_marks
+		WHERE marked_at IN (?`+strings.Repeat(", ?", len(times)-1)+`)
+		ORDER BY marked_at ASC, id ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position marks: %w", err)
+	}
+	defer rows.Close()
+
+	var marks []PositionMark
+	for rows.Next() {
+		var m PositionMark
+		var qty, avgCost, price, unrealized string
+		if err := rows.Scan(&m.MarkedAt, &m.UserID, &m.StrategyID, &m.Symbol, &qty, &avgCost, &price, &unrealized); err != nil {
+			return nil, fmt.Errorf("failed to scan position mark: %w", err)
+		}
+		if err := parseDecimals(
+			[]string{qty, avgCost, price, unrealized},
+			[]*decimal.Decimal{&m.Qty, &m.AvgCost, &m.Price, &m.UnrealizedPL},
+		); err != nil {
+			return nil, fmt.Errorf("invalid position mark: %w", err)
+		}
+		m.MarketValue = m.Qty.Mul(m.Price)
+		marks = append(marks, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position marks: %w", err)
+	}
+	return marks, nil
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrMemberExists is returned when onboarding a user the desk already has a
+// row for: an onboarded or a deactivated member
+var ErrMemberExists = errors.New("user already exists")
+
+// Member is a user the desk onboarded, with the limits their orders are
+// held to. Zero limits are no limit.
+type Member struct {
+	UserID           string          `json:"user_id"`
+	OnboardedAt      time.Time       `json:"onboarded_at"`
+	MaxOrderNotional decimal.Decimal `json:"max_order_notional"`
+	MaxGrossExposure decimal.Decimal `json:"max_gross_exposure"`
+	// PaperAllocation is the simulated cash a member trading on the
+	// simulator starts with; zero once they trade live
+	PaperAllocation decimal.Decimal `json:"paper_allocation"`
+}
+
+// Paper reports whether the member's orders go to the simulator
+func (m *Member) Paper() bool {
+	return m.PaperAllocation.IsPositive()
+}
+
+// APIKey is one of a member's API keys. Hash is never shown.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"user_id"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OnboardMember stores a new member with their first API key, in one
+// transaction. It returns ErrMemberExists if the user already has a row.
+func (db *DB) OnboardMember(m *Member, key *APIKey) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin onboarding: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO users (user_id, updated_at, onboarded_at, max_order_notional, max_gross_exposure, paper_allocation)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO NOTHING
+	`, m.UserID, utc(m.OnboardedAt), utc(m.OnboardedAt), m.MaxOrderNotional.String(), m.MaxGrossExposure.String(), m.PaperAllocation.String())
+	if err != nil {
+		return fmt.Errorf("failed to onboard user: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to onboard user: %w", err)
+	}
+	if n == 0 {
+		return ErrMemberExists
+	}
+	if err := db.insertAPIKey(tx, key); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit onboarding: %w", err)
+	}
+	log.Printf("Onboarded user=%s paper_allocation=%s", m.UserID, m.PaperAllocation)
+	return nil
+}
+
+// GetMember returns an onboarded member, or nil if the user wasn't onboarded
+func (db *DB) GetMember(userID string) (*Member, error) {
+	stmt, err := db.stmt(`
+		SELECT user_id, onboarded_at, max_order_notional, max_gross_exposure, paper_allocation
+		FROM users
+		WHERE user_id = ? AND onboarded_at IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	var m Member
+	err = stmt.QueryRow(userID).Scan(&m.UserID, &m.OnboardedAt, &m.MaxOrderNotional, &m.MaxGrossExposure, &m.PaperAllocation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	return &m, nil
+}
+
+// SetMemberLimits replaces a member's limits and paper allocation. It
+// reports false if the user wasn't onboarded.
+func (db *DB) SetMemberLimits(m *Member) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE users SET max_order_notional = ?, max_gross_exposure = ?, paper_allocation = ?, updated_at = ?
+		WHERE user_id = ? AND onboarded_at IS NOT NULL
+	`, m.MaxOrderNotional.String(), m.MaxGrossExposure.String(), m.PaperAllocation.String(), utc(time.Now()), m.UserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set member limits: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to set member limits: %w", err)
+	}
+	return n == 1, nil
+}
+
+// GetPaperSpent returns the cash a user's simulated fills have spent: what
+// they bought less what they sold
+func (db *DB) GetPaperSpent(userID string) (decimal.Decimal, error) {
+	rows, err := db.conn.Query(`
+		SELECT side, filled_qty, filled_avg_price
+		FROM trades
+		WHERE user_id = ? AND venue = ? AND filled_avg_price IS NOT NULL
+	`, userID, VenueSimulator)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to query paper fills: %w", err)
+	}
+	defer rows.Close()
+
+	spent := decimal.Zero
+	for rows.Next() {
+		var side string
+		var qty, price decimal.Decimal
+		if err := rows.Scan(&side, &qty, &price); err != nil {
+			return decimal.Zero, fmt.Errorf("failed to scan paper fill: %w", err)
+		}
+		if side == "buy" {
+			spent = spent.Add(qty.Mul(price))
+		} else {
+			spent = spent.Sub(qty.Mul(price))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return decimal.Zero, fmt.Errorf("failed to iterate paper fills: %w", err)
+	}
+	return spent, nil
+}
+
+// CreateAPIKey stores a new API key for a member
+func (db *DB) CreateAPIKey(key *APIKey) error {
+	return db.insertAPIKey(nil, key)
+}
+
+// insertAPIKey stores key in tx, or on its own if tx is nil
+func (db *DB) insertAPIKey(tx *sql.Tx, key *APIKey) error {
+	stmt, err := db.txStmt(tx, `
+		INSERT INTO api_keys (user_id, prefix, key_hash, created_at) VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	result, err := stmt.Exec(key.UserID, key.Prefix, key.Hash, utc(key.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get API key ID: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyUser returns the user an unrevoked API key belongs to, by the
+// key's hash, or "" if there is no such key
+func (db *DB) GetAPIKeyUser(hash string) (string, error) {
+	stmt, err := db.stmt("SELECT user_id FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL")
+	if err != nil {
+		return "", fmt.Errorf("failed to look up API key: %w", err)
+	}
+	var userID string
+	err = stmt.QueryRow(hash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up API key: %w", err)
+	}
+	return userID, nil
+}
+
+// GetAPIKeys returns a member's API keys, revoked ones included, oldest
+// first
+func (db *DB) GetAPIKeys(userID string) ([]APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, prefix, created_at, revoked_at
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Prefix, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of a member's keys. It reports false if the
+// member has no such unrevoked key.
+func (db *DB) RevokeAPIKey(userID string, id int64) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`, utc(time.Now()), id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Revoked API key ID=%d of user=%s", id, userID)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,362 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// migration is a schema change applied on top of schema.sql. Migrations are
+// applied in order and recorded in schema_migrations so that existing
+// databases pick up new columns without being recreated.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations must only ever be appended to; never edit or reorder an entry
+// that has shipped.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "trades_venue",
+		sql:     `ALTER TABLE trades ADD COLUMN venue TEXT NOT NULL DEFAULT 'alpaca'`,
+	},
+	{
+		// Rebuild trades so order_id uniqueness only applies to orders the
+		// broker accepted (rejected orders have no ID), and replace the
+		// single-column indexes with ones matching the reporting queries.
+		version: 2,
+		name:    "trades_reporting_indexes",
+		sql: `
+			CREATE TABLE trades_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				strategy_id INTEGER,
+				user_id TEXT NOT NULL,
+				order_id TEXT NOT NULL,
+				symbol TEXT NOT NULL,
+				qty TEXT NOT NULL,
+				side TEXT NOT NULL CHECK(side IN ('buy', 'sell')),
+				order_type TEXT NOT NULL,
+				time_in_force TEXT NOT NULL,
+				limit_price TEXT,
+				stop_price TEXT,
+				filled_qty TEXT DEFAULT '0',
+				filled_avg_price TEXT,
+				order_status TEXT NOT NULL,
+				submitted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				filled_at TIMESTAMP,
+				error_message TEXT,
+				venue TEXT NOT NULL DEFAULT 'alpaca',
+				FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE SET NULL
+			);
+			INSERT INTO trades_new (
+				id, strategy_id, user_id, order_id, symbol, qty, side,
+				order_type, time_in_force, limit_price, stop_price,
+				filled_qty, filled_avg_price, order_status, submitted_at,
+				filled_at, error_message, venue
+			)
+			SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+			       order_type, time_in_force, limit_price, stop_price,
+			       filled_qty, filled_avg_price, order_status, submitted_at,
+			       filled_at, error_message, venue
+			FROM trades;
+			DROP TABLE trades;
+			ALTER TABLE trades_new RENAME TO trades;
+
+			CREATE UNIQUE INDEX idx_trades_order_id ON trades(order_id) WHERE order_id != '';
+			CREATE INDEX idx_trades_user_submitted ON trades(user_id, submitted_at, id);
+			CREATE INDEX idx_trades_strategy_submitted ON trades(strategy_id, submitted_at, id);
+			CREATE INDEX idx_trades_symbol_submitted ON trades(symbol, submitted_at);
+			CREATE INDEX idx_trades_submitted_at ON trades(submitted_at);
+		`,
+	},
+	{
+		// Quantities and prices are read back as decimals; older rejected
+		// trades were stored with empty strings instead of zero or NULL.
+		version: 3,
+		name:    "trades_numeric_cleanup",
+		sql: `
+			UPDATE trades SET qty = '0' WHERE qty = '';
+			UPDATE trades SET filled_qty = '0' WHERE filled_qty IS NULL OR filled_qty = '';
+			UPDATE trades SET limit_price = NULL WHERE limit_price = '';
+			UPDATE trades SET stop_price = NULL WHERE stop_price = '';
+			UPDATE trades SET filled_avg_price = NULL WHERE filled_avg_price = '';
+		`,
+	},
+	{
+		// Rewrite timestamps stored with a local offset as UTC so text
+		// comparisons and ordering agree with time ordering
+		version: 4,
+		name:    "utc_timestamps",
+		sql: `
+			UPDATE trades SET submitted_at = strftime('%Y-%m-%d %H:%M:%f+00:00', submitted_at)
+				WHERE submitted_at IS NOT NULL AND submitted_at NOT LIKE '%+00:00';
+			UPDATE trades SET filled_at = strftime('%Y-%m-%d %H:%M:%f+00:00', filled_at)
+				WHERE filled_at IS NOT NULL AND filled_at NOT LIKE '%+00:00';
+			UPDATE strategies SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+				WHERE created_at IS NOT NULL AND created_at NOT LIKE '%+00:00';
+			UPDATE strategies SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', updated_at)
+				WHERE updated_at IS NOT NULL AND updated_at NOT LIKE '%+00:00';
+			UPDATE experiments SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+				WHERE created_at IS NOT NULL AND created_at NOT LIKE '%+00:00';
+			UPDATE experiments SET stopped_at = strftime('%Y-%m-%d %H:%M:%f+00:00', stopped_at)
+				WHERE stopped_at IS NOT NULL AND stopped_at NOT LIKE '%+00:00';
+			UPDATE positions SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', updated_at)
+				WHERE updated_at IS NOT NULL AND updated_at NOT LIKE '%+00:00';
+		`,
+	},
+	{
+		// Daily aggregates used to be keyed on the server-local date, which
+		// splits sessions around DST changes. Clear them so startup backfills
+		// them keyed on America/New_York session dates.
+		version: 5,
+		name:    "rebuild_daily_aggregates",
+		sql: `
+			DELETE FROM daily_aggregates;
+			DELETE FROM position_costs;
+		`,
+	},
+	{
+		version: 6,
+		name:    "conditional_orders_trigger_at",
+		sql:     `ALTER TABLE conditional_orders ADD COLUMN trigger_at TIMESTAMP`,
+	},
+	{
+		// Track processes started by the strategy runner separately from the
+		// user-facing active/paused/stopped status
+		version: 7,
+		name:    "strategies_run_state",
+		sql: `
+			ALTER TABLE strategies ADD COLUMN run_state TEXT NOT NULL DEFAULT 'idle';
+			ALTER TABLE strategies ADD COLUMN run_message TEXT;
+			ALTER TABLE strategies ADD COLUMN started_at TIMESTAMP;
+			ALTER TABLE strategies ADD COLUMN exited_at TIMESTAMP;
+		`,
+	},
+	{
+		version: 8,
+		name:    "strategy_versions",
+		sql: `
+			ALTER TABLE strategies ADD COLUMN active_version INTEGER;
+			ALTER TABLE strategies ADD COLUMN running_version INTEGER;
+			ALTER TABLE trades ADD COLUMN strategy_version INTEGER;
+		`,
+	},
+	{
+		version: 9,
+		name:    "strategies_git",
+		sql: `
+			ALTER TABLE strategies ADD COLUMN git_url TEXT;
+			ALTER TABLE strategies ADD COLUMN git_ref TEXT;
+		`,
+	},
+	{
+		version: 10,
+		name:    "daily_aggregates_borrow_fees",
+		sql:     `ALTER TABLE daily_aggregates ADD COLUMN borrow_fees TEXT NOT NULL DEFAULT '0'`,
+	},
+	{
+		// Order receipt, submission and broker acknowledgement times in
+		// Unix microseconds, for latency analysis
+		version: 11,
+		name:    "trades_latency_timestamps",
+		sql: `
+			ALTER TABLE trades ADD COLUMN received_at_us INTEGER;
+			ALTER TABLE trades ADD COLUMN sent_at_us INTEGER;
+			ALTER TABLE trades ADD COLUMN acked_at_us INTEGER;
+		`,
+	},
+	{
+		// Deleted strategies keep their row, so their trades stay attributed
+		version: 12,
+		name:    "strategies_deleted_at",
+		sql:     `ALTER TABLE strategies ADD COLUMN deleted_at TIMESTAMP`,
+	},
+	{
+		// The desk's own ULID for every order, sent to the broker as
+		// client_order_id, so orders can be traced without a broker ID
+		version: 13,
+		name:    "trades_client_order_id",
+		sql: `
+			ALTER TABLE trades ADD COLUMN client_order_id TEXT;
+			CREATE INDEX idx_trades_client_order_id ON trades(client_order_id) WHERE client_order_id IS NOT NULL;
+		`,
+	},
+	{
+		// Hedge orders the desk places record the rule that placed them
+		version: 14,
+		name:    "trades_hedge_rule",
+		sql:     `ALTER TABLE trades ADD COLUMN hedge_rule TEXT`,
+	},
+	{
+		// Dividends imported from the broker are part of each book's cash
+		version: 15,
+		name:    "daily_cash_dividends",
+		sql:     `ALTER TABLE daily_cash ADD COLUMN dividends TEXT NOT NULL DEFAULT '0'`,
+	},
+	{
+		// Orders may trade in the pre-market and after-hours sessions
+		version: 16,
+		name:    "trades_extended_hours",
+		sql:     `ALTER TABLE trades ADD COLUMN extended_hours BOOLEAN NOT NULL DEFAULT 0`,
+	},
+	{
+		// Members the desk onboards get a row with their risk limits and
+		// paper allocation
+		version: 17,
+		name:    "users_onboarding",
+		sql: `
+			ALTER TABLE users ADD COLUMN onboarded_at TIMESTAMP;
+			ALTER TABLE users ADD COLUMN max_order_notional TEXT NOT NULL DEFAULT '0';
+			ALTER TABLE users ADD COLUMN max_gross_exposure TEXT NOT NULL DEFAULT '0';
+			ALTER TABLE users ADD COLUMN paper_allocation TEXT NOT NULL DEFAULT '0';
+		`,
+	},
+	{
+		// A killed strategy can't be started again until an admin clears it
+		version: 18,
+		name:    "strategies_kill",
+		sql: `
+			ALTER TABLE strategies ADD COLUMN killed_at TIMESTAMP;
+			ALTER TABLE strategies ADD COLUMN kill_reason TEXT;
+		`,
+	},
+	{
+		// The channel each order came in through: manual, api, webhook,
+		// scheduler or algo
+		version: 19,
+		name:    "trades_source",
+		sql: `
+			ALTER TABLE trades ADD COLUMN source TEXT NOT NULL DEFAULT '';
+			CREATE INDEX idx_trades_source ON trades(source, submitted_at);
+		`,
+	},
+}
+
+// migrate applies any migrations that have not yet been recorded
+func migrate(conn *sql.DB) error {
+	if _, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+
+	return nil
+}
+
+// SchemaCheck describes the migrations startup would apply to a database
+type SchemaCheck struct {
+	// Exists is false when startup would create a new database
+	Exists  bool
+	Current int
+	Latest  int
+	Pending []string
+}
+
+// CheckSchema applies the schema and any pending migrations to a scratch
+// copy of the database at dbPath, leaving the database itself untouched
+func CheckSchema(dbPath string) (*SchemaCheck, error) {
+	check := &SchemaCheck{Latest: migrations[len(migrations)-1].version}
+
+	scratchDir, err := os.MkdirTemp("", "desk-schema-check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratchDir)
+	scratch := filepath.Join(scratchDir, "check.db")
+
+	file, _, _ := strings.Cut(dbPath, "?")
+	if _, err := os.Stat(file); err == nil {
+		check.Exists = true
+		if check.Current, err = copyDatabase(file, scratch); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version > check.Current {
+			check.Pending = append(check.Pending, fmt.Sprintf("%d %s", m.version, m.name))
+		}
+	}
+
+	db, err := NewDB(scratch)
+	if err != nil {
+		return nil, err
+	}
+	db.Close()
+	return check, nil
+}
+
+// copyDatabase copies the database at path to scratch through a read-only
+// connection and returns its schema version
+func copyDatabase(path, scratch string) (int, error) {
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Ping(); err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	var current int
+	var tables int
+	if err := conn.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+	).Scan(&tables); err != nil {
+		return 0, fmt.Errorf("failed to read schema: %w", err)
+	}
+	if tables > 0 {
+		if err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+			return 0, fmt.Errorf("failed to read schema version: %w", err)
+		}
+	}
+
+	if _, err := conn.Exec("VACUUM INTO ?", scratch); err != nil {
+		return 0, fmt.Errorf("failed to copy database: %w", err)
+	}
+	return current, nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MinuteBar is one cached minute bar. VWAP is zero when the provider
+// doesn't report one.
+type MinuteBar struct {
+	Timestamp time.Time       `json:"timestamp"`
+	High      decimal.Decimal `json:"high"`
+	Low       decimal.Decimal `json:"low"`
+	Close     decimal.Decimal `json:"close"`
+	Volume    int64           `json:"volume"`
+	VWAP      decimal.Decimal `json:"vwap"`
+}
+
+// CacheMinuteBars stores every minute bar of a symbol's session, replacing
+// any cached before, and records the session as cached
+func (db *DB) CacheMinuteBars(symbol, sessionDate string, bars []MinuteBar) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin minute bar transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM minute_bars WHERE symbol = ? AND session_date = ?", symbol, sessionDate); err != nil {
+		return fmt.Errorf("failed to clear minute bars: %w", err)
+	}
+	for _, b := range bars {
+		if _, err := tx.Exec(`
+			INSERT INTO minute_bars (symbol, session_date, bar_at, high, low, close, volume, vwap)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(symbol, session_date, bar_at) DO NOTHING
+		`, symbol, sessionDate, utc(b.Timestamp), b.High.String(), b.Low.String(), b.Close.String(), b.Volume, b.VWAP.String()); err != nil {
+			return fmt.Errorf("failed to cache minute bar: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO minute_bar_sessions (symbol, session_date, bars, cached_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(symbol, session_date) DO UPDATE SET bars = excluded.bars, cached_at = excluded.cached_at
+	`, symbol, sessionDate, len(bars), utc(time.Now())); err != nil {
+		return fmt.Errorf("failed to record minute bar session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit minute bars: %w", err)
+	}
+	return nil
+}
+
+// GetMinuteBars retrieves a symbol's cached minute bars for a session,
+// oldest first. It reports false if the session isn't cached.
+func (db *DB) GetMinuteBars(symbol, sessionDate string) ([]MinuteBar, bool, error) {
+	var n int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM minute_bar_sessions WHERE symbol = ? AND session_date = ?
+	`, symbol, sessionDate).Scan(&n)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query minute bar sessions: %w", err)
+	}
+	if n == 0 {
+		return nil, false, nil
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT bar_at, high, low, close, volume, vwap FROM minute_bars
+		WHERE symbol = ? AND session_date = ?
+		ORDER BY bar_at
+	`, symbol, sessionDate)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query minute bars: %w", err)
+	}
+	defer rows.Close()
+
+	bars := []MinuteBar{}
+	for rows.Next() {
+		var b MinuteBar
+		if err := rows.Scan(&b.Timestamp, &b.High, &b.Low, &b.Close, &b.Volume, &b.VWAP); err != nil {
+			return nil, false, fmt.Errorf("failed to scan minute bar: %w", err)
+		}
+		bars = append(bars, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to iterate minute bars: %w", err)
+	}
+	return bars, true, nil
+}
+
+// GetFilledTradesBetween retrieves the trades with a fill that last filled
+// in [from, to), oldest first. An empty userID matches every user, and a
+// non-nil strategyID only that strategy's trades.
+func (db *DB) GetFilledTradesBetween(userID string, strategyID *int64, from, to time.Time) ([]Trade, error) {
+	query := `
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE filled_avg_price IS NOT NULL AND CAST(filled_qty AS REAL) > 0
+		  AND filled_at >= ? AND filled_at < ?
+	`
+	args := []any{utc(from), utc(to)}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if strategyID != nil {
+		query += " AND strategy_id = ?"
+		args = append(args, *strategyID)
+	}
+	query += " ORDER BY filled_at ASC, id ASC"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filled trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
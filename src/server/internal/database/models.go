@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrModelExists is returned when creating a model portfolio under a name
+// that is taken
+var ErrModelExists = errors.New("model portfolio already exists")
+
+// ModelPortfolio is a named set of target weights, fractions of capital
+// that may sum to less than one, the rest staying in cash
+type ModelPortfolio struct {
+	ID          int64                      `json:"id"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Weights     map[string]decimal.Decimal `json:"weights"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	UpdatedAt   time.Time                  `json:"updated_at"`
+}
+
+// CreateModel stores a new model portfolio and its weights. It returns
+// ErrModelExists if the name is taken.
+func (db *DB) CreateModel(m *ModelPortfolio) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin model transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO model_portfolios (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO NOTHING
+	`, m.Name, m.Description, utc(now), utc(now))
+	if err != nil {
+		return fmt.Errorf("failed to create model: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to create model: %w", err)
+	}
+	if n == 0 {
+		return ErrModelExists
+	}
+	if m.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get model ID: %w", err)
+	}
+	if err := insertModelWeights(tx, m.ID, m.Weights); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit model: %w", err)
+	}
+	m.CreatedAt, m.UpdatedAt = now, now
+	log.Printf("Created model portfolio ID=%d: %s (%d symbols)", m.ID, m.Name, len(m.Weights))
+	return nil
+}
+
+// UpdateModel replaces a model portfolio's description and weights, by
+// name. It reports false if there is no such model.
+func (db *DB) UpdateModel(m *ModelPortfolio) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin model transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT id, created_at FROM model_portfolios WHERE name = ?", m.Name).Scan(&m.ID, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get model: %w", err)
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`
+		UPDATE model_portfolios SET description = ?, updated_at = ? WHERE id = ?
+	`, m.Description, utc(now), m.ID); err != nil {
+		return false, fmt.Errorf("failed to update model: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM model_portfolio_weights WHERE model_id = ?", m.ID); err != nil {
+		return false, fmt.Errorf("failed to replace model weights: %w", err)
+	}
+	if err := insertModelWeights(tx, m.ID, m.Weights); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit model: %w", err)
+	}
+	m.UpdatedAt = now
+	log.Printf("Updated model portfolio ID=%d: %s (%d symbols)", m.ID, m.Name, len(m.Weights))
+	return true, nil
+}
+
+// DeleteModel deletes a model portfolio and its weights, by name. It
+// reports false if there is no such model.
+func (db *DB) DeleteModel(name string) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin model transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM model_portfolio_weights WHERE model_id IN (SELECT id FROM model_portfolios WHERE name = ?)
+	`, name); err != nil {
+		return false, fmt.Errorf("failed to delete model weights: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM model_portfolios WHERE name = ?", name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete model: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete model: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit model deletion: %w", err)
+	}
+	if n == 1 {
+		log.Printf("Deleted model portfolio %s", name)
+	}
+	return n == 1, nil
+}
+
+// GetModel retrieves a model portfolio and its weights by name, or nil if
+// there is none
+func (db *DB) GetModel(name string) (*ModelPortfolio, error) {
+	models, err := db.queryModels("WHERE name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, nil
+	}
+	return &models[0], nil
+}
+
+// GetModels retrieves every model portfolio, ordered by name
+func (db *DB) GetModels() ([]ModelPortfolio, error) {
+	return db.queryModels("")
+}
+
+func (db *DB) queryModels(where string, args ...any) ([]ModelPortfolio, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, name, description, created_at, updated_at FROM model_portfolios
+	`+where+` ORDER BY name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query models: %w", err)
+	}
+	defer rows.Close()
+
+	models := []ModelPortfolio{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		m := ModelPortfolio{Weights: make(map[string]decimal.Decimal)}
+		if err := rows.Scan(&m.ID, &m.Name, &m.Description, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan model: %w", err)
+		}
+		index[m.ID] = len(models)
+		models = append(models, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate models: %w", err)
+	}
+	rows.Close()
+	if len(models) == 0 {
+		return models, nil
+	}
+
+	weights, err := db.conn.Query(`
+		SELECT model_id, symbol, weight FROM model_portfolio_weights
+		WHERE model_id IN (SELECT id FROM model_portfolios `+where+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model weights: %w", err)
+	}
+	defer weights.Close()
+
+	for weights.Next() {
+		var id int64
+		var symbol string
+		var weight decimal.Decimal
+		if err := weights.Scan(&id, &symbol, &weight); err != nil {
+			return nil, fmt.Errorf("failed to scan model weight: %w", err)
+		}
+		if i, ok := index[id]; ok {
+			models[i].Weights[symbol] = weight
+		}
+	}
+	if err := weights.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate model weights: %w", err)
+	}
+	return models, nil
+}
+
+func insertModelWeights(tx *sql.Tx, id int64, weights map[string]decimal.Decimal) error {
+	for symbol, weight := range weights {
+		if _, err := tx.Exec(
+			"INSERT INTO model_portfolio_weights (model_id, symbol, weight) VALUES (?, ?, ?)",
+			id, symbol, weight.String(),
+		); err != nil {
+			return fmt.Errorf("failed to add model weight: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Netting signal statuses
+const (
+	SignalPending = "pending"
+	SignalNetted  = "netted"
+	SignalFailed  = "failed"
+)
+
+// NettingSignal is one strategy's market order held for netting, and once
+// its batch is sent, its contribution to the net order
+type NettingSignal struct {
+	ID              int64           `json:"id"`
+	BatchID         *int64          `json:"batch_id,omitempty"`
+	UserID          string          `json:"user_id"`
+	StrategyID      int64           `json:"strategy_id"`
+	StrategyVersion *int64          `json:"strategy_version,omitempty"`
+	Symbol          string          `json:"symbol"`
+	Side            string          `json:"side"`
+	Qty             decimal.Decimal `json:"qty"`
+	Status          string          `json:"status"`
+	CrossedQty      decimal.Decimal `json:"crossed_qty"`
+	RoutedQty       decimal.Decimal `json:"routed_qty"`
+	FilledQty       decimal.Decimal `json:"filled_qty"`
+	TradeID         *int64          `json:"trade_id,omitempty"`
+	ErrorMessage    *string         `json:"error_message,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+// NettingBatch is the net order sent for the signals in one symbol within a
+// netting window
+type NettingBatch struct {
+	ID           int64            `json:"id"`
+	Symbol       string           `json:"symbol"`
+	Side         string           `json:"side"`
+	NetQty       decimal.Decimal  `json:"net_qty"`
+	GrossQty     decimal.Decimal  `json:"gross_qty"`
+	OrderID      *string          `json:"order_id,omitempty"`
+	FilledQty    decimal.Decimal  `json:"filled_qty"`
+	Price        *decimal.Decimal `json:"price,omitempty"`
+	ErrorMessage *string          `json:"error_message,omitempty"`
+	OpenedAt     time.Time        `json:"opened_at"`
+	CompletedAt  time.Time        `json:"completed_at"`
+	Signals      []NettingSignal  `json:"signals"`
+}
+
+const nettingSignalColumns = `
+	id, batch_id, user_id, strategy_id, strategy_version, symbol, side, qty,
+	status, crossed_qty, routed_qty, filled_qty, trade_id, error_message, created_at
+`
+
+// CreateNettingSignal stores a new pending signal
+func (db *DB) CreateNettingSignal(s *NettingSignal) (int64, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO netting_signals (
+			user_id, strategy_id, strategy_version, symbol, side, qty, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, s.UserID, s.StrategyID, s.StrategyVersion, s.Symbol, s.Side, s.Qty, utc(s.CreatedAt))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create netting signal: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get netting signal ID: %w", err)
+	}
+	return id, nil
+}
+
+// CompleteNettingBatch stores a sent batch and books each of its signals as
+// a trade, trades[i] being b.Signals[i]'s. Trades get order IDs of the form
+// net-<batch>-<signal>. The IDs of the batch and trades are filled in.
+func (db *DB) CompleteNettingBatch(b *NettingBatch, trades []Trade) error {
+	if len(trades) != len(b.Signals) {
+		return fmt.Errorf("failed to complete netting batch: %d trades for %d signals", len(trades), len(b.Signals))
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin netting batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO netting_batches (
+			symbol, side, net_qty, gross_qty, order_id, filled_qty, price,
+			error_message, opened_at, completed_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, b.Symbol, b.Side, b.NetQty, b.GrossQty, b.OrderID, b.FilledQty, b.Price,
+		b.ErrorMessage, utc(b.OpenedAt), utc(b.CompletedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create netting batch: %w", err)
+	}
+	if b.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get netting batch ID: %w", err)
+	}
+
+	for i := range b.Signals {
+		s, t := &b.Signals[i], &trades[i]
+		t.OrderID = fmt.Sprintf("net-%d-%d", b.ID, s.ID)
+		result, err := tx.Exec("INSERT INTO trades ("+tradeInsertColumns+") VALUES "+tradeInsertPlaceholders, tradeInsertArgs(t)...)
+		if err != nil {
+			return fmt.Errorf("failed to log netted trade: %w", err)
+		}
+		if t.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get netted trade ID: %w", err)
+		}
+
+		s.BatchID, s.TradeID, s.Status = &b.ID, &t.ID, SignalNetted
+		if _, err := tx.Exec(`
+			UPDATE netting_signals
+			SET batch_id = ?, status = ?, crossed_qty = ?, routed_qty = ?, filled_qty = ?,
+			    trade_id = ?, error_message = ?
+			WHERE id = ?
+		`, b.ID, s.Status, s.CrossedQty, s.RoutedQty, s.FilledQty, t.ID, s.ErrorMessage, s.ID); err != nil {
+			return fmt.Errorf("failed to update netting signal: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit netting batch: %w", err)
+	}
+
+	if b.Side == "" {
+		log.Printf("Netted %d signals in %s as batch ID=%d: fully offset", len(b.Signals), b.Symbol, b.ID)
+	} else {
+		log.Printf("Netted %d signals in %s as batch ID=%d: %s %s", len(b.Signals), b.Symbol, b.ID, b.Side, b.NetQty)
+	}
+	ids := make([]int64, len(trades))
+	for i := range trades {
+		ids[i] = trades[i].ID
+	}
+	db.tradesChanged(ids...)
+	return nil
+}
+
+// FailPendingNettingSignals fails every signal still pending, e.g. those
+// held when the desk stopped, returning how many there were
+func (db *DB) FailPendingNettingSignals(reason string) (int64, error) {
+	result, err := db.conn.Exec(`
+		UPDATE netting_signals SET status = ?, error_message = ? WHERE status = ?
+	`, SignalFailed, reason, SignalPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail pending netting signals: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail pending netting signals: %w", err)
+	}
+	return n, nil
+}
+
+// GetNettingSignal retrieves a signal
+func (db *DB) GetNettingSignal(id int64) (*NettingSignal, error) {
+	rows, err := db.conn.Query(`SELECT `+nettingSignalColumns+` FROM netting_signals WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get netting signal: %w", err)
+	}
+	defer rows.Close()
+
+	signals, err := scanNettingSignals(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("failed to get netting signal: %w", sql.ErrNoRows)
+	}
+	return &signals[0], nil
+}
+
+// GetNettingBatch retrieves a batch and its signals
+func (db *DB) GetNettingBatch(id int64) (*NettingBatch, error) {
+	var b NettingBatch
+	err := db.conn.QueryRow(`
+		SELECT id, symbol, side, net_qty, gross_qty, order_id, filled_qty, price,
+		       error_message, opened_at, completed_at
+		FROM netting_batches WHERE id = ?
+	`, id).Scan(&b.ID, &b.Symbol, &b.Side, &b.NetQty, &b.GrossQty, &b.OrderID, &b.FilledQty, &b.Price,
+		&b.ErrorMessage, &b.OpenedAt, &b.CompletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get netting batch: %w", err)
+	}
+
+	rows, err := db.conn.Query(`SELECT `+nettingSignalColumns+` FROM netting_signals WHERE batch_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get netting batch signals: %w", err)
+	}
+	defer rows.Close()
+
+	if b.Signals, err = scanNettingSignals(rows); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func scanNettingSignals(rows *sql.Rows) ([]NettingSignal, error) {
+	var out []NettingSignal
+	for rows.Next() {
+		var s NettingSignal
+		err := rows.Scan(
+			&s.ID, &s.BatchID, &s.UserID, &s.StrategyID, &s.StrategyVersion, &s.Symbol, &s.Side, &s.Qty,
+			&s.Status, &s.CrossedQty, &s.RoutedQty, &s.FilledQty, &s.TradeID, &s.ErrorMessage, &s.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan netting signal: %w", err)
+		}
+		out = append(out, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate netting signals: %w", err)
+	}
+
+	return out, nil
+}
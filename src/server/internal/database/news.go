@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// NewsArticle is a relayed news headline
+type NewsArticle struct {
+	ID        int64     `json:"id"`
+	Headline  string    `json:"headline"`
+	Summary   string    `json:"summary"`
+	Author    string    `json:"author"`
+	URL       string    `json:"url"`
+	Symbols   []string  `json:"symbols"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveNewsArticles stores articles, updating any already stored, and returns
+// the ones that were new
+func (db *DB) SaveNewsArticles(articles []NewsArticle) ([]NewsArticle, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin news transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var added []NewsArticle
+	for _, a := range articles {
+		result, err := tx.Exec(`
+			INSERT INTO news_articles (id, headline, summary, author, url, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO NOTHING
+		`, a.ID, a.Headline, a.Summary, a.Author, a.URL, utc(a.CreatedAt), utc(a.UpdatedAt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store news article %d: %w", a.ID, err)
+		}
+
+		if n, _ := result.RowsAffected(); n == 0 {
+			if _, err := tx.Exec(`
+				UPDATE news_articles
+				SET headline = ?, summary = ?, author = ?, url = ?, updated_at = ?
+				WHERE id = ?
+			`, a.Headline, a.Summary, a.Author, a.URL, utc(a.UpdatedAt), a.ID); err != nil {
+				return nil, fmt.Errorf("failed to update news article %d: %w", a.ID, err)
+			}
+			if _, err := tx.Exec("DELETE FROM news_symbols WHERE news_id = ?", a.ID); err != nil {
+				return nil, fmt.Errorf("failed to update news article %d symbols: %w", a.ID, err)
+			}
+		} else {
+			added = append(added, a)
+		}
+
+		for _, symbol := range a.Symbols {
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO news_symbols (news_id, symbol) VALUES (?, ?)", a.ID, symbol,
+			); err != nil {
+				return nil, fmt.Errorf("failed to store news article %d symbols: %w", a.ID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit news articles: %w", err)
+	}
+
+	if len(added) > 0 {
+		log.Printf("Stored %d new news articles", len(added))
+	}
+	return added, nil
+}
+
+// GetNewsArticles returns up to limit articles created before the given time,
+// newest first, optionally only those mentioning one of symbols
+func (db *DB) GetNewsArticles(symbols []string, before time.Time, limit int) ([]NewsArticle, error) {
+	query := `
+		SELECT id, headline, summary, author, url, created_at, updated_at
+		FROM news_articles
+		WHERE created_at < ?
+	`
+	args := []any{utc(before)}
+	if len(symbols) > 0 {
+		query += " AND id IN (SELECT news_id FROM news_symbols WHERE symbol IN (?" +
+			strings.Repeat(", ?", len(symbols)-1) + "))"
+		for _, s := range symbols {
+			args = append(args, s)
+		}
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query news: %w", err)
+	}
+	defer rows.Close()
+
+	var articles []NewsArticle
+	for rows.Next() {
+		var a NewsArticle
+		if err := rows.Scan(&a.ID, &a.Headline, &a.Summary, &a.Author, &a.URL, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan news article: %w", err)
+		}
+		articles = append(articles, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate news: %w", err)
+	}
+
+	if err := db.loadNewsSymbols(articles); err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// LatestNewsUpdate returns the most recent updated_at of any stored article,
+// or nil if none are stored
+func (db *DB) LatestNewsUpdate() (*time.Time, error) {
+	var latest sql.NullTime
+	err := db.conn.QueryRow("SELECT MAX(updated_at) FROM news_articles").Scan(&latest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latest news update: %w", err)
+	}
+	if !latest.Valid {
+		return nil, nil
+	}
+	return &latest.Time, nil
+}
+
+// PruneNews deletes articles created before the cutoff
+func (db *DB) PruneNews(before time.Time) error {
+	if _, err := db.conn.Exec(`
+		DELETE FROM news_symbols
+		WHERE news_id IN (SELECT id FROM news_articles WHERE created_at < ?)
+	`, utc(before)); err != nil {
+		return fmt.Errorf("failed to prune news symbols: %w", err)
+	}
+
+	result, err := db.conn.Exec("DELETE FROM news_articles WHERE created_at < ?", utc(before))
+	if err != nil {
+		return fmt.Errorf("failed to prune news: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d news articles", n)
+	}
+	return nil
+}
+
+func (db *DB) loadNewsSymbols(articles []NewsArticle) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(articles))
+	args := make([]any, len(articles))
+	for i, a := range articles {
+		index[a.ID] = i
+		args[i] = a.ID
+		articles[i].Symbols = []string{}
+	}
+
+	rows, err := db.conn.Query(
+		"SELECT news_id, symbol FROM news_symbols WHERE news_id IN (?"+strings.Repeat(", ?", len(articles)-1)+") ORDER BY symbol",
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query news symbols: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var symbol string
+		if err := rows.Scan(&id, &symbol); err != nil {
+			return fmt.Errorf("failed to scan news symbol: %w", err)
+		}
+		i := index[id]
+		articles[i].Symbols = append(articles[i].Symbols, symbol)
+	}
+	return rows.Err()
+}
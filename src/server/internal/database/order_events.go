@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+)
+
+// Order event types
+const (
+	// EventStatus is a change in a trade's status or filled quantity
+	EventStatus = "status"
+	// EventModified is a change to the order itself, such as a new limit
+	// price; the broker replaces the order and the replacement is logged as
+	// a new trade
+	EventModified = "modified"
+	// EventRecovered is a trade logged from the broker's order after the
+	// desk missed it, as when the server went down between placing the
+	// order and logging its trade
+	EventRecovered = "recovered"
+	// EventDisputed is the trade's user disputing its fill; the trade is
+	// left as it was
+	EventDisputed = "disputed"
+	// EventDisputeResolved is an admin upholding or rejecting a dispute of
+	// the trade
+	EventDisputeResolved = "dispute_resolved"
+)
+
+// OrderEvent is a change to a trade after it was logged, with the trade's
+// status and filled quantity before and after it
+type OrderEvent struct {
+	ID                int64            `json:"id"`
+	TradeID           int64            `json:"trade_id"`
+	EventType         string           `json:"event_type"`
+	PreviousStatus    string           `json:"previous_status"`
+	PreviousFilledQty decimal.Decimal  `json:"previous_filled_qty"`
+	OrderStatus       string           `json:"order_status"`
+	FilledQty         decimal.Decimal  `json:"filled_qty"`
+	FilledAvgPrice    *decimal.Decimal `json:"filled_avg_price,omitempty"`
+	Detail            *string          `json:"detail,omitempty"`
+	OccurredAt        time.Time        `json:"occurred_at"`
+}
+
+// insertOrderEvent appends an event in tx, or on its own if tx is nil
+func (db *DB) insertOrderEvent(tx *sql.Tx, e *OrderEvent) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = clock.Now()
+	}
+	stmt, err := db.txStmt(tx, `
+		INSERT INTO order_events (
+			trade_id, event_type, previous_status, previous_filled_qty, order_status, filled_qty,
+			filled_avg_price, detail, occurred_at_us
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to record order event: %w", err)
+	}
+	result, err := stmt.Exec(e.TradeID, e.EventType, e.PreviousStatus, e.PreviousFilledQty, e.OrderStatus, e.FilledQty,
+		e.FilledAvgPrice, e.Detail, micros(&e.OccurredAt))
+	if err != nil {
+		return fmt.Errorf("failed to record order event: %w", err)
+	}
+	if e.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get order event ID: %w", err)
+	}
+	return nil
+}
+
+// RecordOrderEvent appends an event to a trade's lifecycle, timestamped now
+// if OccurredAt isn't set
+func (db *DB) RecordOrderEvent(e *OrderEvent) error {
+	return db.insertOrderEvent(nil, e)
+}
+
+// GetTradesSubmittedBetween retrieves every trade submitted in [from, to),
+// oldest first
+func (db *DB) GetTradesSubmittedBetween(from, to time.Time) ([]Trade, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, strategy_id, user_id, order_id, symbol, qty, side,
+		       order_type, time_in_force, limit_price, stop_price,
+		       filled_qty, filled_avg_price, order_status, submitted_at,
+		       filled_at, error_message, venue, strategy_version,
+		       received_at_us, sent_at_us, acked_at_us, client_order_id, hedge_rule, extended_hours, source
+		FROM trades
+		WHERE submitted_at >= ? AND submitted_at < ?
+		ORDER BY submitted_at ASC, id ASC
+	`, utc(from), utc(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// GetOrderEventsSubmittedBetween retrieves the events of every trade
+// submitted in [from, to), by trade ID and in the order they were recorded
+func (db *DB) GetOrderEventsSubmittedBetween(from, to time.Time) (map[int64][]OrderEvent, error) {
+	rows, err := db.conn.Query(`
+		SELECT e.id, e.trade_id, e.event_type, e.previous_status, e.previous_filled_qty,
+		       e.order_status, e.filled_qty, e.filled_avg_price, e.detail, e.occurred_at_us
+		FROM order_events e
+		JOIN trades t ON t.id = e.trade_id
+		WHERE t.submitted_at >= ? AND t.submitted_at < ?
+		ORDER BY e.trade_id ASC, e.id ASC
+	`, utc(from), utc(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make(map[int64][]OrderEvent)
+	for rows.Next() {
+		var e OrderEvent
+		var occurredAt int64
+		if err := rows.Scan(&e.ID, &e.TradeID, &e.EventType, &e.PreviousStatus, &e.PreviousFilledQty,
+			&e.OrderStatus, &e.FilledQty, &e.FilledAvgPrice, &e.Detail, &occurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order event: %w", err)
+		}
+		e.OccurredAt = time.UnixMicro(occurredAt).UTC()
+		events[e.TradeID] = append(events[e.TradeID], e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate order events: %w", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Position group kinds
+const (
+	GroupPair   = "pair"
+	GroupSpread = "spread"
+	GroupHedge  = "hedge"
+	GroupBasket = "basket"
+	GroupOther  = "other"
+)
+
+// ValidGroupKind reports whether kind is a known position group kind
+func ValidGroupKind(kind string) bool {
+	switch kind {
+	case GroupPair, GroupSpread, GroupHedge, GroupBasket, GroupOther:
+		return true
+	}
+	return false
+}
+
+// ErrUnknownTrade is returned when a trade added to a position group doesn't
+// exist or belongs to another user
+var ErrUnknownTrade = errors.New("unknown trade")
+
+// PositionGroup is a set of related trades reported as one position
+type PositionGroup struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	TradeIDs  []int64   `json:"trade_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatePositionGroup stores a new position group and its trades
+func (db *DB) CreatePositionGroup(g *PositionGroup) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin position group transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO position_groups (user_id, name, kind, created_at)
+		VALUES (?, ?, ?, ?)
+	`, g.UserID, g.Name, g.Kind, utc(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create position group: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get position group ID: %w", err)
+	}
+
+	if err := addGroupTrades(tx, id, g.UserID, g.TradeIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit position group: %w", err)
+	}
+
+	log.Printf("Created position group ID=%d for user=%s: %s (%s, %d trades)", id, g.UserID, g.Name, g.Kind, len(g.TradeIDs))
+	return id, nil
+}
+
+// addGroupTrades adds trades to a group, ignoring any already in it. Every
+// trade must belong to userID.
+func addGroupTrades(tx *sql.Tx, groupID int64, userID string, tradeIDs []int64) error {
+	for _, tradeID := range tradeIDs {
+		var owner string
+		err := tx.QueryRow("SELECT user_id FROM trades WHERE id = ?", tradeID).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != userID) {
+			return fmt.Errorf("%w: %d", ErrUnknownTrade, tradeID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up trade: %w", err)
+		}
+
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO position_group_trades (group_id, trade_id) VALUES (?, ?)
+		`, groupID, tradeID); err != nil {
+			return fmt.Errorf("failed to add trade to position group: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetPositionGroup retrieves a position group and its trade IDs
+func (db *DB) GetPositionGroup(id int64) (*PositionGroup, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, name, kind, created_at FROM position_groups WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get position group: %w", err)
+	}
+	defer rows.Close()
+
+	groups, err := db.scanPositionGroups(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("failed to get position group: %w", sql.ErrNoRows)
+	}
+	return &groups[0], nil
+}
+
+// GetPositionGroups retrieves userID's position groups, newest first
+func (db *DB) GetPositionGroups(userID string) ([]PositionGroup, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, user_id, name, kind, created_at
+		FROM position_groups
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position groups: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanPositionGroups(rows)
+}
+
+// scanPositionGroups reads position groups and loads their trade IDs
+func (db *DB) scanPositionGroups(rows *sql.Rows) ([]PositionGroup, error) {
+	var groups []PositionGroup
+	for rows.Next() {
+		var g PositionGroup
+		if err := rows.Scan(&g.ID, &g.UserID, &g.Name, &g.Kind, &g.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan position group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position groups: %w", err)
+	}
+	rows.Close()
+
+	for i := range groups {
+		ids, err := db.groupTradeIDs(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].TradeIDs = ids
+	}
+	return groups, nil
+}
+
+func (db *DB) groupTradeIDs(groupID int64) ([]int64, error) {
+	rows, err := db.conn.Query(`
+		SELECT trade_id FROM position_group_trades WHERE group_id = ? ORDER BY trade_id
+	`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position group trades: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan position group trade: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate position group trades: %w", err)
+	}
+	return ids, nil
+}
+
+// GetGroupTrades retrieves the trades in a position group, oldest first
+func (db *DB) GetGroupTrades(groupID int64) ([]Trade, error) {
+	rows, err := db.conn.Query(`
+		SELECT t.id, t.strategy_id, t.user_id, t.order_id, t.symbol, t.qty, t.side,
+		       t.order_type, t.time_in_force, t.limit_price, t.stop_price,
+		       t.filled_qty, t.filled_avg_price, t.order_status, t.submitted_at,
+		       t.filled_at, t.error_message, t.venue, t.strategy_version,
+		       t.received_at_us, t.sent_at_us, t.acked_at_us, t.client_order_id, t.hedge_rule, t.extended_hours, t.source
+		FROM trades t
+		JOIN position_group_trades g ON g.trade_id = t.id
+		WHERE g.group_id = ?
+		ORDER BY t.submitted_at ASC, t.id ASC
+	`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query position group trades: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrades(rows)
+}
+
+// AddPositionGroupTrades adds trades owned by the group's user to a group,
+// ignoring any already in it
+func (db *DB) AddPositionGroupTrades(g *PositionGroup, tradeIDs []int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin position group transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := addGroupTrades(tx, g.ID, g.UserID, tradeIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit position group trades: %w", err)
+	}
+
+	log.Printf("Added %d trades to position group ID=%d", len(tradeIDs), g.ID)
+	return nil
+}
+
+// RemovePositionGroupTrade removes a trade from a group. It reports false if
+// the trade was not in the group.
+func (db *DB) RemovePositionGroupTrade(groupID, tradeID int64) (bool, error) {
+	result, err := db.conn.Exec(
+		"DELETE FROM position_group_trades WHERE group_id = ? AND trade_id = ?", groupID, tradeID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove position group trade: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("Removed trade ID=%d from position group ID=%d", tradeID, groupID)
+	}
+	return n > 0, nil
+}
+
+// DeletePositionGroup deletes a position group. Its trades are kept.
+func (db *DB) DeletePositionGroup(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin position group transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM position_group_trades WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete position group trades: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM position_groups WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete position group: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit position group deletion: %w", err)
+	}
+
+	log.Printf("Deleted position group ID=%d", id)
+	return nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Preferences are a user's defaults and settings. A user who hasn't stored
+// any has the zero value: no defaults, no confirmation and no channels.
+type Preferences struct {
+	UserID string `json:"user_id"`
+	// DefaultOrderType and DefaultTimeInForce fill an order's order_type and
+	// time_in_force when it leaves them empty
+	DefaultOrderType   string `json:"default_order_type"`
+	DefaultTimeInForce string `json:"default_time_in_force"`
+	// ConfirmOrders asks for manual orders to be confirmed before they are
+	// submitted
+	ConfirmOrders        bool                  `json:"confirm_orders"`
+	NotificationChannels []NotificationChannel `json:"notification_channels"`
+	UpdatedAt            *time.Time            `json:"updated_at,omitempty"`
+}
+
+// NotificationChannel is somewhere a user's own notifications (their blocked
+// orders, conditional orders, stale GTC orders) are sent, as well as to the
+// desk's notifier
+type NotificationChannel struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// MinLevel is the least severe level sent: info (the default), warning
+	// or error
+	MinLevel string `json:"min_level,omitempty"`
+}
+
+// Notification channel types
+const (
+	ChannelWebhook = "webhook"
+	ChannelDiscord = "discord"
+)
+
+// SetPreferences stores a user's preferences, replacing any they had
+func (db *DB) SetPreferences(p *Preferences) error {
+	channels := p.NotificationChannels
+	if channels == nil {
+		channels = []NotificationChannel{}
+	}
+	encoded, err := json.Marshal(channels)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification channels: %w", err)
+	}
+
+	if _, err := db.conn.Exec(`
+		INSERT INTO user_preferences (
+			user_id, default_order_type, default_time_in_force,
+			confirm_orders, notification_channels, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			default_order_type = excluded.default_order_type,
+			default_time_in_force = excluded.default_time_in_force,
+			confirm_orders = excluded.confirm_orders,
+			notification_channels = excluded.notification_channels,
+			updated_at = excluded.updated_at
+	`, p.UserID, p.DefaultOrderType, p.DefaultTimeInForce, p.ConfirmOrders, string(encoded), utc(time.Now())); err != nil {
+		return fmt.Errorf("failed to set preferences: %w", err)
+	}
+
+	log.Printf("Set preferences for user=%s: order_type=%q time_in_force=%q confirm=%t channels=%d",
+		p.UserID, p.DefaultOrderType, p.DefaultTimeInForce, p.ConfirmOrders, len(channels))
+	return nil
+}
+
+// GetPreferences returns a user's preferences, or the zero value for a user
+// who hasn't stored any
+func (db *DB) GetPreferences(userID string) (*Preferences, error) {
+	p := &Preferences{UserID: userID, NotificationChannels: []NotificationChannel{}}
+	var channels string
+	var updatedAt time.Time
+	stmt, err := db.stmt(`
+		SELECT default_order_type, default_time_in_force, confirm_orders,
+		       notification_channels, updated_at
+		FROM user_preferences
+		WHERE user_id = ?
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	err = stmt.QueryRow(userID).Scan(&p.DefaultOrderType, &p.DefaultTimeInForce, &p.ConfirmOrders, &channels, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(channels), &p.NotificationChannels); err != nil {
+		return nil, fmt.Errorf("failed to decode notification channels: %w", err)
+	}
+	p.UpdatedAt = &updatedAt
+	return p, nil
+}
+
+// DeletePreferences resets a user's preferences to the defaults
+func (db *DB) DeletePreferences(userID string) error {
+	if _, err := db.conn.Exec("DELETE FROM user_preferences WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete preferences: %w", err)
+	}
+	log.Printf("Reset preferences for user=%s", userID)
+	return nil
+}
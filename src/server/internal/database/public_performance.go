@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OptInPublicPerformance includes userID's books in the public performance
+// page. Opting in again keeps the original time.
+func (db *DB) OptInPublicPerformance(userID string) error {
+	if _, err := db.conn.Exec(`
+		INSERT OR IGNORE INTO public_performance_members (user_id, opted_in_at) VALUES (?, ?)
+	`, userID, utc(time.Now())); err != nil {
+		return fmt.Errorf("failed to opt in to public performance: %w", err)
+	}
+	log.Printf("User %s opted in to the public performance page", userID)
+	return nil
+}
+
+// OptOutPublicPerformance removes userID's books from the public performance
+// page
+func (db *DB) OptOutPublicPerformance(userID string) error {
+	if _, err := db.conn.Exec("DELETE FROM public_performance_members WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to opt out of public performance: %w", err)
+	}
+	log.Printf("User %s opted out of the public performance page", userID)
+	return nil
+}
+
+// GetPublicPerformanceOptIn returns when userID opted in to the public
+// performance page, or nil if they haven't
+func (db *DB) GetPublicPerformanceOptIn(userID string) (*time.Time, error) {
+	var at time.Time
+	err := db.conn.QueryRow("SELECT opted_in_at FROM public_performance_members WHERE user_id = ?", userID).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public performance opt-in: %w", err)
+	}
+	return &at, nil
+}
+
+// GetPublicPerformanceMembers returns the users who opted in to the public
+// performance page
+func (db *DB) GetPublicPerformanceMembers() ([]string, error) {
+	rows, err := db.conn.Query("SELECT user_id FROM public_performance_members ORDER BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query public performance members: %w", err)
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan public performance member: %w", err)
+		}
+		users = append(users, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate public performance members: %w", err)
+	}
+	return users, nil
+}
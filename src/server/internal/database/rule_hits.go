@@ -0,0 +1,63 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RuleHit is an order a custom pre-trade rule objected to
+type RuleHit struct {
+	ID         int64           `json:"id"`
+	Rule       string          `json:"rule"`
+	Action     string          `json:"action"`
+	UserID     string          `json:"user_id"`
+	StrategyID *int64          `json:"strategy_id,omitempty"`
+	Symbol     string          `json:"symbol"`
+	Side       string          `json:"side"`
+	Qty        decimal.Decimal `json:"qty"`
+	Reason     string          `json:"reason"`
+	HitAt      time.Time       `json:"hit_at"`
+}
+
+// RecordRuleHit stores a hit of a custom pre-trade rule
+func (db *DB) RecordRuleHit(h RuleHit) error {
+	if _, err := db.conn.Exec(`
+		INSERT INTO risk_rule_hits (rule, action, user_id, strategy_id, symbol, side, qty, reason, hit_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, h.Rule, h.Action, h.UserID, h.StrategyID, h.Symbol, h.Side, h.Qty.String(), h.Reason, utc(h.HitAt)); err != nil {
+		return fmt.Errorf("failed to record rule hit: %w", err)
+	}
+	return nil
+}
+
+// GetRuleHits retrieves the hits between from and to, newest first, of one
+// rule or with rule empty of every rule
+func (db *DB) GetRuleHits(rule string, from, to time.Time) ([]RuleHit, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, rule, action, user_id, strategy_id, symbol, side, qty, reason, hit_at
+		FROM risk_rule_hits
+		WHERE (? = '' OR rule = ?) AND hit_at >= ? AND hit_at <= ?
+		ORDER BY hit_at DESC, id DESC
+	`, rule, rule, utc(from), utc(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rule hits: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []RuleHit{}
+	for rows.Next() {
+		var h RuleHit
+		if err := rows.Scan(&h.ID, &h.Rule, &h.Action, &h.UserID, &h.StrategyID, &h.Symbol,
+			&h.Side, &h.Qty, &h.Reason, &h.HitAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rule hit: %w", err)
+		}
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rule hits: %w", err)
+	}
+
+	return hits, nil
+}
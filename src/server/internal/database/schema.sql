@@ -48,11 +48,598 @@ CREATE TABLE IF NOT EXISTS positions (
     FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE CASCADE
 );
 
--- Indexes for common queries
-CREATE INDEX IF NOT EXISTS idx_trades_user_id ON trades(user_id);
-CREATE INDEX IF NOT EXISTS idx_trades_strategy_id ON trades(strategy_id);
-CREATE INDEX IF NOT EXISTS idx_trades_symbol ON trades(symbol);
-CREATE INDEX IF NOT EXISTS idx_trades_submitted_at ON trades(submitted_at);
+-- Experiments table: A/B comparisons between two variants of a strategy.
+-- Variant A trades normally; variant B is routed to the simulator.
+CREATE TABLE IF NOT EXISTS experiments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    strategy_a_id INTEGER NOT NULL,
+    strategy_b_id INTEGER NOT NULL,
+    status TEXT DEFAULT 'running' CHECK(status IN ('running', 'stopped')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    stopped_at TIMESTAMP,
+    UNIQUE(user_id, name),
+    FOREIGN KEY (strategy_a_id) REFERENCES strategies(id) ON DELETE CASCADE,
+    FOREIGN KEY (strategy_b_id) REFERENCES strategies(id) ON DELETE CASCADE
+);
+
+-- Daily aggregates: per day/user/strategy/symbol fill statistics, maintained
+-- incrementally as fills arrive so reports never re-scan the trades table.
+-- strategy_id is 0 for trades not attributed to a strategy.
+CREATE TABLE IF NOT EXISTS daily_aggregates (
+    trade_date TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL DEFAULT 0,
+    symbol TEXT NOT NULL,
+    trade_count INTEGER NOT NULL DEFAULT 0,
+    buy_qty TEXT NOT NULL DEFAULT '0',
+    sell_qty TEXT NOT NULL DEFAULT '0',
+    notional TEXT NOT NULL DEFAULT '0',
+    realized_pl TEXT NOT NULL DEFAULT '0',
+    fees TEXT NOT NULL DEFAULT '0',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (trade_date, user_id, strategy_id, symbol)
+);
+
+-- Position costs: running average-cost basis per user/strategy/symbol, used to
+-- compute realized P&L for daily_aggregates
+CREATE TABLE IF NOT EXISTS position_costs (
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL DEFAULT 0,
+    symbol TEXT NOT NULL,
+    qty TEXT NOT NULL DEFAULT '0',
+    avg_cost TEXT NOT NULL DEFAULT '0',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, strategy_id, symbol)
+);
+
+-- Daily cash ledger per user/strategy. Cash moves with deposits, fills
+-- (sells add proceeds, buys spend), fees and carry: borrow fees on shorts and
+-- margin interest on a negative balance, accrued after each close.
+CREATE TABLE IF NOT EXISTS daily_cash (
+    trade_date TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL DEFAULT 0,
+    deposits TEXT NOT NULL DEFAULT '0',
+    trade_flow TEXT NOT NULL DEFAULT '0',
+    fees TEXT NOT NULL DEFAULT '0',
+    borrow_fees TEXT NOT NULL DEFAULT '0',
+    margin_interest TEXT NOT NULL DEFAULT '0',
+    accrued_at TIMESTAMP,
+    PRIMARY KEY (trade_date, user_id, strategy_id)
+);
+
+-- Dividends paid into a broker account, split among the books holding the
+-- symbol when they were imported (see internal/dividends). One row per book
+-- per broker activity, so re-importing a day adds nothing.
+CREATE TABLE IF NOT EXISTS dividends (
+    activity_id TEXT NOT NULL,
+    trade_date TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL DEFAULT 0,
+    symbol TEXT NOT NULL,
+    qty TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    PRIMARY KEY (activity_id, user_id, strategy_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dividends_trade_date ON dividends(trade_date);
+
+-- Position marks: open positions marked to the latest price by the marking
+-- engine (see internal/marks), persisted periodically for intraday
+-- unrealized P&L history
+CREATE TABLE IF NOT EXISTS position_marks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    marked_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL DEFAULT 0,
+    symbol TEXT NOT NULL,
+    qty TEXT NOT NULL,
+    avg_cost TEXT NOT NULL,
+    price TEXT NOT NULL,
+    unrealized_pl TEXT NOT NULL
+);
+
+-- Conditional orders: orders held by the desk and submitted once their
+-- trigger fires. The order fields mirror trades; trigger_value is a price for
+-- price triggers and an RSI level for RSI triggers.
+CREATE TABLE IF NOT EXISTS conditional_orders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL CHECK(side IN ('buy', 'sell')),
+    qty TEXT NOT NULL,
+    order_type TEXT NOT NULL,
+    time_in_force TEXT NOT NULL,
+    limit_price TEXT,
+    stop_price TEXT,
+    trigger_type TEXT NOT NULL,
+    trigger_value TEXT NOT NULL,
+    rsi_period INTEGER NOT NULL DEFAULT 0,
+    timeframe TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'triggered', 'submitted', 'failed', 'canceled')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    triggered_at TIMESTAMP,
+    order_id TEXT,
+    error_message TEXT,
+    FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE SET NULL
+);
+
+-- Earnings events: upcoming earnings reports from the configured calendar
+-- source. timing is bmo (before open), amc (after close), dmh (during market
+-- hours) or empty if unknown; report_at is the estimated report time.
+CREATE TABLE IF NOT EXISTS earnings_events (
+    symbol TEXT NOT NULL,
+    report_date TEXT NOT NULL,
+    timing TEXT NOT NULL DEFAULT '',
+    report_at TIMESTAMP NOT NULL,
+    eps_estimate TEXT,
+    source TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (symbol, report_date)
+);
+
+-- News articles relayed from Alpaca's news API. id is Alpaca's article ID;
+-- news_symbols maps each article to the symbols it mentions.
+CREATE TABLE IF NOT EXISTS news_articles (
+    id INTEGER PRIMARY KEY,
+    headline TEXT NOT NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    author TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS news_symbols (
+    news_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    PRIMARY KEY (symbol, news_id),
+    FOREIGN KEY (news_id) REFERENCES news_articles(id) ON DELETE CASCADE
+);
+
+-- Watchlists are named symbol lists owned by a user; shared lists are
+-- visible to the whole club. alpaca_id links a list mirrored to Alpaca.
+CREATE TABLE IF NOT EXISTS watchlists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    shared INTEGER NOT NULL DEFAULT 0,
+    alpaca_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS watchlist_symbols (
+    watchlist_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    added_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (watchlist_id, symbol),
+    FOREIGN KEY (watchlist_id) REFERENCES watchlists(id) ON DELETE CASCADE
+);
+
+-- Recent output of runner-managed strategies. Each strategy has a fixed
+-- number of slots reused in seq order, so the table is a ring buffer.
+CREATE TABLE IF NOT EXISTS strategy_logs (
+    strategy_id INTEGER NOT NULL,
+    slot INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    stream TEXT NOT NULL CHECK(stream IN ('stdout', 'stderr')),
+    line TEXT NOT NULL,
+    logged_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (strategy_id, slot),
+    FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE CASCADE
+);
+
+-- Uploaded strategy artifacts. Versions are numbered from 1 per strategy;
+-- storage_key locates the artifact in the artifact store.
+CREATE TABLE IF NOT EXISTS strategy_versions (
+    strategy_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    format TEXT NOT NULL CHECK(format IN ('script', 'tar.gz')),
+    checksum TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    storage_key TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    uploaded_by TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (strategy_id, version),
+    FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE CASCADE
+);
+
+-- Git deployments of strategies. version is the strategy version the
+-- commit was stored as; previous_version is what was active before.
+CREATE TABLE IF NOT EXISTS strategy_deployments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    strategy_id INTEGER NOT NULL,
+    ref TEXT NOT NULL,
+    commit_sha TEXT,
+    version INTEGER,
+    previous_version INTEGER,
+    status TEXT NOT NULL CHECK(status IN ('deployed', 'rolled_back', 'failed')),
+    message TEXT,
+    deployed_by TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE CASCADE
+);
+
+-- Per-strategy secrets. value is AES-GCM ciphertext (see internal/secrets);
+-- plaintext is never stored.
+CREATE TABLE IF NOT EXISTS strategy_secrets (
+    strategy_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    value BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (strategy_id, name),
+    FOREIGN KEY (strategy_id) REFERENCES strategies(id) ON DELETE CASCADE
+);
+
+-- Position groups tie related trades (pairs, spreads, hedges, basket legs)
+-- together so their P&L and exposure are reported as one position.
+CREATE TABLE IF NOT EXISTS position_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS position_group_trades (
+    group_id INTEGER NOT NULL,
+    trade_id INTEGER NOT NULL,
+    PRIMARY KEY (group_id, trade_id),
+    FOREIGN KEY (group_id) REFERENCES position_groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (trade_id) REFERENCES trades(id)
+);
+
+-- Alternative symbols resolved to the symbol the desk trades before an order
+-- or symbol list is used (see internal/symbols). Both columns hold
+-- normalized symbols.
+CREATE TABLE IF NOT EXISTS symbol_aliases (
+    alias TEXT PRIMARY KEY,
+    symbol TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Trade journal: users' reflections on a session date and the trades they
+-- made in it. thesis, outcome and lessons hold markdown.
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    session_date TEXT NOT NULL,
+    title TEXT NOT NULL,
+    thesis TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL DEFAULT '',
+    lessons TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS journal_entry_trades (
+    entry_id INTEGER NOT NULL,
+    trade_id INTEGER NOT NULL,
+    PRIMARY KEY (entry_id, trade_id),
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id) ON DELETE CASCADE,
+    FOREIGN KEY (trade_id) REFERENCES trades(id)
+);
+
+-- Users whose books are included, anonymized and aggregated, in the public
+-- performance page. Nobody is included without opting in.
+CREATE TABLE IF NOT EXISTS public_performance_members (
+    user_id TEXT PRIMARY KEY,
+    opted_in_at TIMESTAMP NOT NULL
+);
+
+-- Members the desk has onboarded or deactivated, e.g. on graduating. Users
+-- are otherwise only the X-User-ID they send, so a user without a row, or
+-- whose deleted_at is cleared by a restore, is active. Their trades and
+-- books are kept. Onboarding columns are added by migrations.go.
+CREATE TABLE IF NOT EXISTS users (
+    user_id TEXT PRIMARY KEY,
+    deleted_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Netted orders: market orders from strategies in one symbol that arrived
+-- within NETTING_WINDOW, sent to the broker as one order for their net
+-- quantity. side is '' when the signals offset exactly and nothing was sent.
+CREATE TABLE IF NOT EXISTS netting_batches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL DEFAULT '',
+    net_qty TEXT NOT NULL,
+    gross_qty TEXT NOT NULL,
+    order_id TEXT,
+    filled_qty TEXT NOT NULL,
+    price TEXT,
+    error_message TEXT,
+    opened_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NOT NULL
+);
+
+-- One strategy's order in a netted batch and its contribution: crossed_qty
+-- offset against other strategies' orders, routed_qty went into the net
+-- order, and filled_qty is what the strategy was allocated. Each netted
+-- signal is booked as its own trade with venue 'netted'.
+CREATE TABLE IF NOT EXISTS netting_signals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    batch_id INTEGER,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER NOT NULL,
+    strategy_version INTEGER,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL CHECK(side IN ('buy', 'sell')),
+    qty TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'netted', 'failed')),
+    crossed_qty TEXT NOT NULL DEFAULT '0',
+    routed_qty TEXT NOT NULL DEFAULT '0',
+    filled_qty TEXT NOT NULL DEFAULT '0',
+    trade_id INTEGER,
+    error_message TEXT,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (batch_id) REFERENCES netting_batches(id),
+    FOREIGN KEY (trade_id) REFERENCES trades(id)
+);
+
+-- Changes to trades after they are logged: status updates from the broker
+-- and modifications. A trade's receipt, routing, acknowledgement and first
+-- state are on the trade itself; these complete its lifecycle.
+CREATE TABLE IF NOT EXISTS order_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    previous_status TEXT NOT NULL,
+    previous_filled_qty TEXT NOT NULL DEFAULT '0',
+    order_status TEXT NOT NULL,
+    filled_qty TEXT NOT NULL DEFAULT '0',
+    filled_avg_price TEXT,
+    detail TEXT,
+    occurred_at_us INTEGER NOT NULL,
+    FOREIGN KEY (trade_id) REFERENCES trades(id)
+);
+
+-- Request and broker response payloads of failed orders, kept for debugging
+-- while order capture is on (see internal/capture). Headers and bodies are
+-- redacted and size-limited before they are stored.
+CREATE TABLE IF NOT EXISTS order_captures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL UNIQUE,
+    user_id TEXT NOT NULL,
+    request_method TEXT NOT NULL,
+    request_path TEXT NOT NULL,
+    request_headers TEXT NOT NULL,
+    request_body TEXT NOT NULL,
+    response_status INTEGER,
+    response_body TEXT NOT NULL,
+    error_message TEXT NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (trade_id) REFERENCES trades(id)
+);
+
+-- Runs of the daily open and close checklists (see internal/checklist). A
+-- run and its steps are stored as they progress, so a step that hangs shows
+-- as running.
+CREATE TABLE IF NOT EXISTS checklist_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    checklist TEXT NOT NULL,
+    session_date TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running' CHECK(status IN ('running', 'passed', 'failed')),
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS checklist_steps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    seq INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'running', 'passed', 'failed', 'skipped')),
+    detail TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    UNIQUE (run_id, seq),
+    FOREIGN KEY (run_id) REFERENCES checklist_runs(id)
+);
+
+-- Per-user preferences (see internal/database/preferences.go). Defaults
+-- fill fields an order leaves empty; notification_channels is a JSON array
+-- of channels the user's own notifications are also sent to.
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id TEXT PRIMARY KEY,
+    default_order_type TEXT NOT NULL DEFAULT '',
+    default_time_in_force TEXT NOT NULL DEFAULT '',
+    confirm_orders BOOLEAN NOT NULL DEFAULT 0,
+    notification_channels TEXT NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Backtest runs (see internal/database/backtests.go). params, config,
+-- metrics, equity and detail are JSON; config_hash identifies runs of the
+-- same strategy, symbol, parameters and settings over any dates.
+CREATE TABLE IF NOT EXISTS backtest_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK(kind IN ('backtest', 'walk_forward')),
+    strategy TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    config_hash TEXT NOT NULL,
+    params TEXT NOT NULL,
+    config TEXT NOT NULL,
+    data_start TIMESTAMP NOT NULL,
+    data_end TIMESTAMP NOT NULL,
+    metrics TEXT NOT NULL,
+    equity TEXT NOT NULL,
+    detail TEXT,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Parameter sweeps of a backtest (see internal/database/backtests.go).
+-- report is the JSON sweep report, which links each configuration to its
+-- stored run.
+CREATE TABLE IF NOT EXISTS backtest_sweeps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    strategy TEXT NOT NULL,
+    symbol TEXT NOT NULL,
+    runs INTEGER NOT NULL,
+    report TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Account leverage history: the risk snapshotter's equity, exposures and
+-- leverage (gross exposure over equity), persisted every
+-- LEVERAGE_HISTORY_INTERVAL for charting how leverage has moved.
+CREATE TABLE IF NOT EXISTS leverage_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recorded_at TIMESTAMP NOT NULL,
+    equity TEXT NOT NULL,
+    gross_exposure TEXT NOT NULL,
+    net_exposure TEXT NOT NULL,
+    leverage TEXT NOT NULL
+);
+
+-- Hits of the custom pre-trade rules in RISK_RULES_FILE: every order a
+-- rule's expression rejected, with the action taken.
+CREATE TABLE IF NOT EXISTS risk_rule_hits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule TEXT NOT NULL,
+    action TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    strategy_id INTEGER,
+    symbol TEXT NOT NULL,
+    side TEXT NOT NULL,
+    qty TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    hit_at TIMESTAMP NOT NULL
+);
+
+-- API keys of onboarded members. Only a SHA-256 hash of each key is kept;
+-- the key itself is shown once, when it is issued. prefix is the start of
+-- the key, so a member and an admin can tell keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+-- How far each account's trade updates have been recorded (see
+-- internal/tradeupdates): the last time the account's stream was followed
+-- with nothing left unwritten. After a restart, what the broker did since
+-- is recovered from its orders. account is the chapter trading in its own
+-- account, empty for the desk's.
+CREATE TABLE IF NOT EXISTS trade_update_cursors (
+    account TEXT PRIMARY KEY,
+    synced_at TIMESTAMP NOT NULL
+);
+
+-- Disputes of trades a member says filled in error. The trade itself is
+-- never changed; an admin resolves the dispute as upheld, which takes the
+-- trade out of performance stats and books adjustment, the P&L the fill
+-- caused, against trade_date, or rejected.
+CREATE TABLE IF NOT EXISTS trade_disputes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL REFERENCES trades(id),
+    user_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open',
+    opened_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    resolution_note TEXT,
+    adjustment TEXT NOT NULL DEFAULT '0',
+    trade_date TEXT
+);
+
+-- Model portfolios are named target weights, fractions of capital, that
+-- admins maintain for members to track drift against and rebalance to.
+CREATE TABLE IF NOT EXISTS model_portfolios (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS model_portfolio_weights (
+    model_id INTEGER NOT NULL,
+    symbol TEXT NOT NULL,
+    weight TEXT NOT NULL,
+    PRIMARY KEY (model_id, symbol),
+    FOREIGN KEY (model_id) REFERENCES model_portfolios(id) ON DELETE CASCADE
+);
+
+-- Minute bars cached for trade cost analysis, one row per bar of a symbol's
+-- session. minute_bar_sessions records the sessions fetched in full, so a
+-- session without bars in an order's interval isn't fetched again.
+CREATE TABLE IF NOT EXISTS minute_bar_sessions (
+    symbol TEXT NOT NULL,
+    session_date TEXT NOT NULL,
+    bars INTEGER NOT NULL,
+    cached_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (symbol, session_date)
+);
+
+CREATE TABLE IF NOT EXISTS minute_bars (
+    symbol TEXT NOT NULL,
+    session_date TEXT NOT NULL,
+    bar_at TIMESTAMP NOT NULL,
+    high TEXT NOT NULL,
+    low TEXT NOT NULL,
+    close TEXT NOT NULL,
+    volume INTEGER NOT NULL,
+    vwap TEXT NOT NULL,
+    PRIMARY KEY (symbol, session_date, bar_at)
+);
+
+-- When each open GTC order's limit first drifted beyond the stale policy's
+-- threshold; the row goes when the drift falls back or the order finishes
+CREATE TABLE IF NOT EXISTS gtc_drift (
+    trade_id INTEGER PRIMARY KEY,
+    since TIMESTAMP NOT NULL,
+    FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE
+);
+
+-- All TIMESTAMP columns hold UTC. trade_date columns are America/New_York
+-- session dates (see internal/market).
+
+-- Indexes for common queries. Trade indexes are managed by migrations.go.
 CREATE INDEX IF NOT EXISTS idx_positions_strategy_id ON positions(strategy_id);
 CREATE INDEX IF NOT EXISTS idx_positions_user_id ON positions(user_id);
 CREATE INDEX IF NOT EXISTS idx_strategies_user_id ON strategies(user_id);
+CREATE INDEX IF NOT EXISTS idx_experiments_strategy_b_id ON experiments(strategy_b_id);
+CREATE INDEX IF NOT EXISTS idx_daily_aggregates_user_date ON daily_aggregates(user_id, trade_date);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_daily_cash_user_date ON daily_cash(user_id, trade_date);
+CREATE INDEX IF NOT EXISTS idx_position_marks_user_marked_at ON position_marks(user_id, marked_at);
+CREATE INDEX IF NOT EXISTS idx_conditional_orders_status ON conditional_orders(status);
+CREATE INDEX IF NOT EXISTS idx_conditional_orders_user_id ON conditional_orders(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_earnings_events_report_at ON earnings_events(report_at);
+CREATE INDEX IF NOT EXISTS idx_news_articles_created_at ON news_articles(created_at);
+CREATE INDEX IF NOT EXISTS idx_trade_disputes_trade_id ON trade_disputes(trade_id);
+CREATE INDEX IF NOT EXISTS idx_trade_disputes_status ON trade_disputes(status, trade_date);
+CREATE INDEX IF NOT EXISTS idx_news_symbols_news_id ON news_symbols(news_id);
+CREATE INDEX IF NOT EXISTS idx_watchlists_shared ON watchlists(shared);
+CREATE INDEX IF NOT EXISTS idx_strategy_logs_seq ON strategy_logs(strategy_id, seq);
+CREATE INDEX IF NOT EXISTS idx_strategy_deployments_strategy ON strategy_deployments(strategy_id, id);
+CREATE INDEX IF NOT EXISTS idx_position_groups_user_id ON position_groups(user_id);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_user_date ON journal_entries(user_id, session_date);
+CREATE INDEX IF NOT EXISTS idx_journal_entry_trades_trade_id ON journal_entry_trades(trade_id);
+CREATE INDEX IF NOT EXISTS idx_netting_signals_batch_id ON netting_signals(batch_id);
+CREATE INDEX IF NOT EXISTS idx_netting_signals_status ON netting_signals(status);
+CREATE INDEX IF NOT EXISTS idx_order_captures_expires_at ON order_captures(expires_at);
+CREATE INDEX IF NOT EXISTS idx_order_events_trade_id ON order_events(trade_id, id);
+CREATE INDEX IF NOT EXISTS idx_checklist_runs_checklist ON checklist_runs(checklist, session_date);
+CREATE INDEX IF NOT EXISTS idx_backtest_runs_user_id ON backtest_runs(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_backtest_runs_config_hash ON backtest_runs(config_hash);
+CREATE INDEX IF NOT EXISTS idx_backtest_sweeps_user_id ON backtest_sweeps(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_leverage_history_recorded_at ON leverage_history(recorded_at);
+CREATE INDEX IF NOT EXISTS idx_risk_rule_hits_hit_at ON risk_rule_hits(hit_at);
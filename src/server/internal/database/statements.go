@@ -0,0 +1,48 @@
+package database
+
+import "database/sql"
+
+// The order and fill paths run the same few queries for every order, and
+// SQLite parses a query's SQL again each time it is executed unprepared.
+// Those queries are prepared once and kept in the DB's cache instead: stmt
+// for queries run on their own, txStmt for queries run in a transaction.
+// database/sql prepares a cached statement on each pooled connection the
+// first time it runs there, and reuses it after that, in or out of a
+// transaction. Only constant queries belong in the cache, since statements
+// are kept until the DB is closed.
+
+// stmt returns query prepared on the read-write connection, preparing it
+// the first time it is used
+func (db *DB) stmt(query string) (*sql.Stmt, error) {
+	if s, ok := db.stmts.Load(query); ok {
+		return s.(*sql.Stmt), nil
+	}
+	s, err := db.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if prepared, loaded := db.stmts.LoadOrStore(query, s); loaded {
+		// Another caller prepared it first
+		s.Close()
+		return prepared.(*sql.Stmt), nil
+	}
+	return s, nil
+}
+
+// txStmt returns query's cached statement bound to tx, or to the connection
+// if tx is nil. A statement bound to tx is closed when tx ends.
+func (db *DB) txStmt(tx *sql.Tx, query string) (*sql.Stmt, error) {
+	s, err := db.stmt(query)
+	if err != nil || tx == nil {
+		return s, err
+	}
+	return tx.Stmt(s), nil
+}
+
+// closeStmts closes every cached statement
+func (db *DB) closeStmts() {
+	db.stmts.Range(func(_, s any) bool {
+		s.(*sql.Stmt).Close()
+		return true
+	})
+}
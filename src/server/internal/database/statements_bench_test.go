@@ -0,0 +1,205 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// seededTrades is how many trades BenchmarkUpdateTradeStatus updates
+const seededTrades = 1000
+
+// benchDB opens a scratch database. Commits don't wait for the disk
+// (_sync=OFF), so the benchmarks measure SQLite's work on the queries
+// rather than fsync.
+func benchDB(b *testing.B) *DB {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	db, err := NewDB(filepath.Join(b.TempDir(), "desk.db") + "?_sync=OFF")
+	if err != nil {
+		b.Fatalf("open database: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// benchTrade is a new limit order, numbered to keep its order ID unique
+func benchTrade(n int64) *Trade {
+	now := time.Now()
+	limit := decimal.RequireFromString("187.25")
+	return &Trade{
+		UserID:        "bench",
+		OrderID:       fmt.Sprintf("bench-%d", n),
+		Symbol:        "AAPL",
+		Qty:           decimal.NewFromInt(10),
+		Side:          "buy",
+		OrderType:     "limit",
+		TimeInForce:   "day",
+		LimitPrice:    &limit,
+		OrderStatus:   "new",
+		SubmittedAt:   now,
+		Venue:         VenueAlpaca,
+		ReceivedAt:    &now,
+		SentAt:        &now,
+		AckedAt:       &now,
+		ClientOrderID: fmt.Sprintf("client-%d", n),
+	}
+}
+
+// seedTrades logs seededTrades trades, bench-0 to bench-999
+func seedTrades(b *testing.B, db *DB) {
+	for i := range int64(seededTrades) {
+		if _, err := db.LogTrade(benchTrade(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// bookAverageCost is a minimal BookFunc: buys average in, sells realize
+// against the average cost
+func bookAverageCost(basis CostBasis, fill DailyFill) (CostBasis, decimal.Decimal) {
+	if fill.Side == "sell" {
+		realized := fill.Price.Sub(basis.AvgCost).Mul(fill.Qty)
+		basis.Qty = basis.Qty.Sub(fill.Qty)
+		return basis, realized
+	}
+	cost := basis.AvgCost.Mul(basis.Qty).Add(fill.Price.Mul(fill.Qty))
+	basis.Qty = basis.Qty.Add(fill.Qty)
+	basis.AvgCost = decimal.Zero
+	if !basis.Qty.IsZero() {
+		basis.AvgCost = cost.Div(basis.Qty)
+	}
+	return basis, decimal.Zero
+}
+
+func BenchmarkLogTrade(b *testing.B) {
+	db := benchDB(b)
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.LogTrade(benchTrade(n.Add(1))); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkUpdateTradeStatus(b *testing.B) {
+	db := benchDB(b)
+	seedTrades(b, db)
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := n.Add(1)
+			// Every update fills another share, so each records an event
+			filled := decimal.NewFromInt(i / seededTrades)
+			err := db.UpdateTradeStatus(fmt.Sprintf("bench-%d", i%seededTrades), "partially_filled", filled, nil, nil)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkRecordDailyFill(b *testing.B) {
+	db := benchDB(b)
+	date := time.Now().Format("2006-01-02")
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := n.Add(1)
+			side := "buy"
+			if i%3 == 0 {
+				side = "sell"
+			}
+			err := db.RecordDailyFill(DailyFill{
+				TradeDate:  date,
+				UserID:     "bench",
+				StrategyID: i % 8,
+				Symbol:     fmt.Sprintf("SYM%d", i%50),
+				Side:       side,
+				Qty:        decimal.NewFromInt(10),
+				Price:      decimal.NewFromInt(100 + i%7),
+			}, bookAverageCost)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkHotQueries runs cached queries from concurrent goroutines twice:
+// unprepared, which parses the SQL on every call as the database package
+// did before statements were cached, and from the statement cache
+func BenchmarkHotQueries(b *testing.B) {
+	queries := []struct {
+		name  string
+		query string
+		args  func(n int64) []any
+	}{
+		{"insert trade", insertTradeSQL, func(n int64) []any {
+			return tradeInsertArgs(benchTrade(n))
+		}},
+		{"update trade status", updateTradeStatusSQL, func(n int64) []any {
+			return []any{"partially_filled", decimal.NewFromInt(n), nil, nil, n%seededTrades + 1}
+		}},
+		{"upsert cost basis", upsertCostBasisSQL, func(n int64) []any {
+			return []any{"bench", n % 8, fmt.Sprintf("SYM%d", n%50), decimal.NewFromInt(n).String(), "100", time.Now().UTC()}
+		}},
+	}
+
+	for _, q := range queries {
+		for _, prepared := range []bool{false, true} {
+			name := q.name + "/unprepared"
+			if prepared {
+				name = q.name + "/prepared"
+			}
+			b.Run(name, func(b *testing.B) {
+				db := benchDB(b)
+				seedTrades(b, db)
+				exec := db.conn.Exec
+				if prepared {
+					stmt, err := db.stmt(q.query)
+					if err != nil {
+						b.Fatal(err)
+					}
+					exec = func(_ string, args ...any) (sql.Result, error) {
+						return stmt.Exec(args...)
+					}
+				}
+
+				// Start past the seeded trades' order IDs
+				var n atomic.Int64
+				n.Store(seededTrades)
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if _, err := exec(q.query, q.args(n.Add(1))...); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Strategy run states recorded by the runner
+const (
+	RunIdle    = "idle"
+	RunRunning = "running"
+	RunStopped = "stopped"
+	RunExited  = "exited"
+	RunFailed  = "failed"
+	RunKilled  = "killed"
+)
+
+// LogLine is one line of output from a runner-managed strategy
+type LogLine struct {
+	Seq      int64     `json:"seq"`
+	Stream   string    `json:"stream"`
+	Line     string    `json:"line"`
+	LoggedAt time.Time `json:"logged_at"`
+}
+
+// SetStrategyRunState records a strategy process starting or exiting.
+// Entering RunRunning sets started_at; any other state sets exited_at.
+func (db *DB) SetStrategyRunState(id int64, state string, message *string, at time.Time) error {
+	query := `UPDATE strategies SET run_state = ?, run_message = ?, exited_at = ? WHERE id = ?`
+	if state == RunRunning {
+		query = `UPDATE strategies SET run_state = ?, run_message = ?, started_at = ?, exited_at = NULL WHERE id = ?`
+	}
+
+	if _, err := db.conn.Exec(query, state, message, utc(at), id); err != nil {
+		return fmt.Errorf("failed to update strategy run state: %w", err)
+	}
+
+	log.Printf("Strategy ID=%d %s", id, state)
+	return nil
+}
+
+// AppendStrategyLogs stores log lines in a strategy's ring of size slots,
+// overwriting the oldest
+func (db *DB) AppendStrategyLogs(strategyID int64, lines []LogLine, size int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin strategy log transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO strategy_logs (strategy_id, slot, seq, stream, line, logged_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare strategy log insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, l := range lines {
+		if _, err := stmt.Exec(strategyID, l.Seq%int64(size), l.Seq, l.Stream, l.Line, utc(l.LoggedAt)); err != nil {
+			return fmt.Errorf("failed to store strategy log: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit strategy logs: %w", err)
+	}
+	return nil
+}
+
+// GetStrategyLogs returns up to the last n stored log lines, oldest first
+func (db *DB) GetStrategyLogs(strategyID int64, n int) ([]LogLine, error) {
+	rows, err := db.conn.Query(`
+		SELECT seq, stream, line, logged_at
+		FROM strategy_logs
+		WHERE strategy_id = ?
+		ORDER BY seq DESC
+		LIMIT ?
+	`, strategyID, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query strategy logs: %w", err)
+	}
+	defer rows.Close()
+
+	lines := []LogLine{}
+	for rows.Next() {
+		var l LogLine
+		if err := rows.Scan(&l.Seq, &l.Stream, &l.Line, &l.LoggedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan strategy log: %w", err)
+		}
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate strategy logs: %w", err)
+	}
+
+	slices.Reverse(lines)
+	return lines, nil
+}
+
+// LastStrategyLogSeq returns the sequence number of a strategy's newest
+// stored log line, or 0 if it has none
+func (db *DB) LastStrategyLogSeq(strategyID int64) (int64, error) {
+	var seq int64
+	err := db.conn.QueryRow(
+		"SELECT COALESCE(MAX(seq), 0) FROM strategy_logs WHERE strategy_id = ?", strategyID,
+	).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read strategy log sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// ResetRunningStrategies marks strategies left running by a previous server
+// process as stopped, since the runner no longer owns them
+func (db *DB) ResetRunningStrategies(message string, at time.Time) error {
+	result, err := db.conn.Exec(`
+		UPDATE strategies SET run_state = ?, run_message = ?, exited_at = ?, running_version = NULL
+		WHERE run_state = ?
+	`, RunStopped, message, utc(at), RunRunning)
+	if err != nil {
+		return fmt.Errorf("failed to reset strategy run states: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Marked %d previously running strategies stopped", n)
+	}
+	return nil
+}
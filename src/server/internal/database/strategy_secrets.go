@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// StrategySecret is an encrypted value injected into a strategy's
+// environment. Value is the sealed ciphertext and is never serialized.
+type StrategySecret struct {
+	StrategyID int64     `json:"strategy_id"`
+	Name       string    `json:"name"`
+	Value      []byte    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SetStrategySecret creates or replaces a strategy's secret
+func (db *DB) SetStrategySecret(strategyID int64, name string, sealed []byte) error {
+	now := utc(time.Now())
+	if _, err := db.conn.Exec(`
+		INSERT INTO strategy_secrets (strategy_id, name, value, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (strategy_id, name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, strategyID, name, sealed, now, now); err != nil {
+		return fmt.Errorf("failed to set strategy secret: %w", err)
+	}
+
+	log.Printf("Set secret %s for strategy ID=%d", name, strategyID)
+	return nil
+}
+
+// GetStrategySecrets retrieves a strategy's secrets ordered by name
+func (db *DB) GetStrategySecrets(strategyID int64) ([]StrategySecret, error) {
+	rows, err := db.conn.Query(`
+		SELECT strategy_id, name, value, created_at, updated_at
+		FROM strategy_secrets
+		WHERE strategy_id = ?
+		ORDER BY name
+	`, strategyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query strategy secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []StrategySecret
+	for rows.Next() {
+		var s StrategySecret
+		if err := rows.Scan(&s.StrategyID, &s.Name, &s.Value, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan strategy secret: %w", err)
+		}
+		secrets = append(secrets, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate strategy secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// DeleteStrategySecret removes a strategy's secret, reporting whether it
+// existed
+func (db *DB) DeleteStrategySecret(strategyID int64, name string) (bool, error) {
+	result, err := db.conn.Exec(
+		"DELETE FROM strategy_secrets WHERE strategy_id = ? AND name = ?", strategyID, name,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete strategy secret: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("Deleted secret %s for strategy ID=%d", name, strategyID)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// StrategyVersion is an uploaded strategy artifact
+type StrategyVersion struct {
+	StrategyID int64     `json:"strategy_id"`
+	Version    int64     `json:"version"`
+	Format     string    `json:"format"`
+	Checksum   string    `json:"checksum"`
+	Size       int64     `json:"size"`
+	StorageKey string    `json:"-"`
+	Note       string    `json:"note"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const strategyVersionColumns = `
+	strategy_id, version, format, checksum, size, storage_key, note, uploaded_by, created_at
+`
+
+// CreateStrategyVersion records an uploaded artifact as the strategy's next
+// version and sets v.Version
+func (db *DB) CreateStrategyVersion(v *StrategyVersion) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin strategy version transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(
+		"SELECT COALESCE(MAX(version), 0) + 1 FROM strategy_versions WHERE strategy_id = ?", v.StrategyID,
+	).Scan(&v.Version); err != nil {
+		return fmt.Errorf("failed to number strategy version: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO strategy_versions (`+strategyVersionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, v.StrategyID, v.Version, v.Format, v.Checksum, v.Size, v.StorageKey, v.Note, v.UploadedBy, utc(v.CreatedAt)); err != nil {
+		return fmt.Errorf("failed to create strategy version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit strategy version: %w", err)
+	}
+
+	log.Printf("Created strategy ID=%d version %d (%s, %d bytes, sha256 %s)",
+		v.StrategyID, v.Version, v.Format, v.Size, v.Checksum)
+	return nil
+}
+
+// GetStrategyVersion retrieves one version of a strategy
+func (db *DB) GetStrategyVersion(strategyID, version int64) (*StrategyVersion, error) {
+	var v StrategyVersion
+	err := db.conn.QueryRow(`
+		SELECT `+strategyVersionColumns+`
+		FROM strategy_versions
+		WHERE strategy_id = ? AND version = ?
+	`, strategyID, version).Scan(
+		&v.StrategyID, &v.Version, &v.Format, &v.Checksum, &v.Size,
+		&v.StorageKey, &v.Note, &v.UploadedBy, &v.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get strategy version: %w", err)
+	}
+	return &v, nil
+}
+
+// GetStrategyVersions retrieves every version of a strategy, newest first
+func (db *DB) GetStrategyVersions(strategyID int64) ([]StrategyVersion, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+strategyVersionColumns+`
+		FROM strategy_versions
+		WHERE strategy_id = ?
+		ORDER BY version DESC
+	`, strategyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query strategy versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []StrategyVersion
+	for rows.Next() {
+		var v StrategyVersion
+		if err := rows.Scan(
+			&v.StrategyID, &v.Version, &v.Format, &v.Checksum, &v.Size,
+			&v.StorageKey, &v.Note, &v.UploadedBy, &v.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan strategy version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate strategy versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// SetActiveStrategyVersion selects the version the runner starts
+func (db *DB) SetActiveStrategyVersion(strategyID, version int64) error {
+	_, err := db.conn.Exec(
+		"UPDATE strategies SET active_version = ?, updated_at = ? WHERE id = ?",
+		version, utc(time.Now()), strategyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set active strategy version: %w", err)
+	}
+
+	log.Printf("Strategy ID=%d active version set to %d", strategyID, version)
+	return nil
+}
+
+// SetStrategyRunningVersion records the version of a strategy's live process,
+// or clears it when version is nil
+func (db *DB) SetStrategyRunningVersion(strategyID int64, version *int64) error {
+	if _, err := db.conn.Exec(
+		"UPDATE strategies SET running_version = ? WHERE id = ?", version, strategyID,
+	); err != nil {
+		return fmt.Errorf("failed to set running strategy version: %w", err)
+	}
+	return nil
+}
+
+// Deployment outcomes
+const (
+	DeployDeployed   = "deployed"
+	DeployRolledBack = "rolled_back"
+	DeployFailed     = "failed"
+)
+
+// Deployment records one attempt to deploy a git ref of a strategy
+type Deployment struct {
+	ID              int64     `json:"id"`
+	StrategyID      int64     `json:"strategy_id"`
+	Ref             string    `json:"ref"`
+	CommitSHA       *string   `json:"commit_sha,omitempty"`
+	Version         *int64    `json:"version,omitempty"`
+	PreviousVersion *int64    `json:"previous_version,omitempty"`
+	Status          string    `json:"status"`
+	Message         *string   `json:"message,omitempty"`
+	DeployedBy      string    `json:"deployed_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CreateDeployment records a deployment attempt and sets d.ID
+func (db *DB) CreateDeployment(d *Deployment) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO strategy_deployments (
+			strategy_id, ref, commit_sha, version, previous_version,
+			status, message, deployed_by, created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.StrategyID, d.Ref, d.CommitSHA, d.Version, d.PreviousVersion,
+		d.Status, d.Message, d.DeployedBy, utc(d.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	if d.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get deployment ID: %w", err)
+	}
+
+	log.Printf("Deployment ID=%d of strategy ID=%d ref %s: %s", d.ID, d.StrategyID, d.Ref, d.Status)
+	return nil
+}
+
+// GetDeployments retrieves a strategy's deployments, newest first
+func (db *DB) GetDeployments(strategyID int64) ([]Deployment, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, strategy_id, ref, commit_sha, version, previous_version,
+		       status, message, deployed_by, created_at
+		FROM strategy_deployments
+		WHERE strategy_id = ?
+		ORDER BY id DESC
+	`, strategyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []Deployment
+	for rows.Next() {
+		var d Deployment
+		if err := rows.Scan(
+			&d.ID, &d.StrategyID, &d.Ref, &d.CommitSHA, &d.Version, &d.PreviousVersion,
+			&d.Status, &d.Message, &d.DeployedBy, &d.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// SetStrategyGitRef records the ref a git strategy was last deployed from
+func (db *DB) SetStrategyGitRef(strategyID int64, ref string) error {
+	if _, err := db.conn.Exec(
+		"UPDATE strategies SET git_ref = ?, updated_at = ? WHERE id = ?", ref, utc(time.Now()), strategyID,
+	); err != nil {
+		return fmt.Errorf("failed to set strategy git ref: %w", err)
+	}
+	return nil
+}
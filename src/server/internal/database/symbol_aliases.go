@@ -0,0 +1,69 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SymbolAlias maps an alternative symbol to the symbol the desk trades
+type SymbolAlias struct {
+	Alias     string    `json:"alias"`
+	Symbol    string    `json:"symbol"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetSymbolAlias creates or replaces an alias
+func (db *DB) SetSymbolAlias(alias, symbol string) error {
+	if _, err := db.conn.Exec(`
+		INSERT INTO symbol_aliases (alias, symbol, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (alias) DO UPDATE SET symbol = excluded.symbol
+	`, alias, symbol, utc(time.Now())); err != nil {
+		return fmt.Errorf("failed to set symbol alias: %w", err)
+	}
+
+	log.Printf("Set symbol alias %s -> %s", alias, symbol)
+	return nil
+}
+
+// GetSymbolAliases retrieves all aliases ordered by alias
+func (db *DB) GetSymbolAliases() ([]SymbolAlias, error) {
+	rows, err := db.conn.Query(`
+		SELECT alias, symbol, created_at
+		FROM symbol_aliases
+		ORDER BY alias
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query symbol aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []SymbolAlias
+	for rows.Next() {
+		var a SymbolAlias
+		if err := rows.Scan(&a.Alias, &a.Symbol, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan symbol alias: %w", err)
+		}
+		aliases = append(aliases, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate symbol aliases: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// DeleteSymbolAlias removes an alias, reporting whether it existed
+func (db *DB) DeleteSymbolAlias(alias string) (bool, error) {
+	result, err := db.conn.Exec("DELETE FROM symbol_aliases WHERE alias = ?", alias)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete symbol alias: %w", err)
+	}
+
+	n, _ := result.RowsAffected()
+	if n > 0 {
+		log.Printf("Deleted symbol alias %s", alias)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetTradeUpdatesSyncedAt returns when an account's trade updates were last
+// known to be recorded, or nil if they never were
+func (db *DB) GetTradeUpdatesSyncedAt(account string) (*time.Time, error) {
+	var syncedAt time.Time
+	err := db.conn.QueryRow(`
+		SELECT synced_at FROM trade_update_cursors WHERE account = ?
+	`, account).Scan(&syncedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade update cursor: %w", err)
+	}
+	return &syncedAt, nil
+}
+
+// SetTradeUpdatesSyncedAt records that an account's trade updates are
+// recorded up to syncedAt
+func (db *DB) SetTradeUpdatesSyncedAt(account string, syncedAt time.Time) error {
+	if _, err := db.conn.Exec(`
+		INSERT INTO trade_update_cursors (account, synced_at) VALUES (?, ?)
+		ON CONFLICT(account) DO UPDATE SET synced_at = excluded.synced_at
+	`, account, utc(syncedAt)); err != nil {
+		return fmt.Errorf("failed to set trade update cursor: %w", err)
+	}
+	return nil
+}
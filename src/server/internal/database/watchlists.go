@@ -0,0 +1,320 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"desk/internal/tenants"
+)
+
+// Watchlist is a named list of symbols. Shared watchlists are visible to
+// every user in the owner's chapter; only the owner may change one.
+type Watchlist struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Shared    bool      `json:"shared"`
+	AlpacaID  *string   `json:"alpaca_id,omitempty"`
+	Symbols   []string  `json:"symbols"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// VisibleTo reports whether userID may read the watchlist
+func (wl *Watchlist) VisibleTo(userID string) bool {
+	return wl.UserID == userID || (wl.Shared && tenants.SameChapter(wl.UserID, userID))
+}
+
+const watchlistColumns = `id, user_id, name, shared, alpaca_id, created_at, updated_at`
+
+// CreateWatchlist stores a new watchlist and its symbols
+func (db *DB) CreateWatchlist(wl *Watchlist) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin watchlist transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO watchlists (user_id, name, shared, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, wl.UserID, wl.Name, wl.Shared, utc(now), utc(now))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create watchlist: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get watchlist ID: %w", err)
+	}
+
+	if err := addWatchlistSymbols(tx, id, wl.Symbols, now); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit watchlist: %w", err)
+	}
+
+	log.Printf("Created watchlist ID=%d for user=%s: %s (%d symbols)", id, wl.UserID, wl.Name, len(wl.Symbols))
+	return id, nil
+}
+
+// GetWatchlist retrieves a watchlist and its symbols
+func (db *DB) GetWatchlist(id int64) (*Watchlist, error) {
+	rows, err := db.conn.Query(`SELECT `+watchlistColumns+` FROM watchlists WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watchlist: %w", err)
+	}
+	defer rows.Close()
+
+	lists, err := db.scanWatchlists(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("failed to get watchlist: %w", sql.ErrNoRows)
+	}
+	return &lists[0], nil
+}
+
+// GetWatchlists retrieves the watchlists userID owns plus every watchlist
+// shared in their chapter, ordered by name
+func (db *DB) GetWatchlists(userID string) ([]Watchlist, error) {
+	rows, err := db.conn.Query(`SELECT `+watchlistColumns+`
+		FROM watchlists
+		WHERE user_id = ? OR shared = 1
+		ORDER BY name ASC, id ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query watchlists: %w", err)
+	}
+	defer rows.Close()
+
+	lists, err := db.scanWatchlists(rows)
+	if err != nil {
+		return nil, err
+	}
+	visible := lists[:0]
+	for _, wl := range lists {
+		if wl.VisibleTo(userID) {
+			visible = append(visible, wl)
+		}
+	}
+	return visible, nil
+}
+
+// GetAllWatchlists retrieves every watchlist
+func (db *DB) GetAllWatchlists() ([]Watchlist, error) {
+	rows, err := db.conn.Query(`SELECT ` + watchlistColumns + ` FROM watchlists ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query watchlists: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanWatchlists(rows)
+}
+
+// UpdateWatchlist renames a watchlist and sets whether it is shared
+func (db *DB) UpdateWatchlist(id int64, name string, shared bool) error {
+	_, err := db.conn.Exec(`
+		UPDATE watchlists SET name = ?, shared = ?, updated_at = ? WHERE id = ?
+	`, name, shared, utc(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to update watchlist: %w", err)
+	}
+
+	log.Printf("Updated watchlist ID=%d: %s shared=%t", id, name, shared)
+	return nil
+}
+
+// AddWatchlistSymbols adds symbols to a watchlist, ignoring any already on it
+func (db *DB) AddWatchlistSymbols(id int64, symbols []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin watchlist transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := addWatchlistSymbols(tx, id, symbols, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE watchlists SET updated_at = ? WHERE id = ?", utc(now), id); err != nil {
+		return fmt.Errorf("failed to update watchlist: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit watchlist symbols: %w", err)
+	}
+
+	log.Printf("Added %s to watchlist ID=%d", strings.Join(symbols, ","), id)
+	return nil
+}
+
+// RemoveWatchlistSymbol removes a symbol from a watchlist. It reports false
+// if the symbol was not on the list.
+func (db *DB) RemoveWatchlistSymbol(id int64, symbol string) (bool, error) {
+	result, err := db.conn.Exec(
+		"DELETE FROM watchlist_symbols WHERE watchlist_id = ? AND symbol = ?", id, symbol,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove watchlist symbol: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove watchlist symbol: %w", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	if _, err := db.conn.Exec("UPDATE watchlists SET updated_at = ? WHERE id = ?", utc(time.Now()), id); err != nil {
+		return false, fmt.Errorf("failed to update watchlist: %w", err)
+	}
+
+	log.Printf("Removed %s from watchlist ID=%d", symbol, id)
+	return true, nil
+}
+
+// SetWatchlistAlpacaID links a watchlist to the Alpaca watchlist mirroring it
+func (db *DB) SetWatchlistAlpacaID(id int64, alpacaID *string) error {
+	if _, err := db.conn.Exec("UPDATE watchlists SET alpaca_id = ? WHERE id = ?", alpacaID, id); err != nil {
+		return fmt.Errorf("failed to set watchlist Alpaca ID: %w", err)
+	}
+	return nil
+}
+
+// DeleteWatchlist deletes a watchlist and its symbols
+func (db *DB) DeleteWatchlist(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin watchlist transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM watchlist_symbols WHERE watchlist_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete watchlist symbols: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM watchlists WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete watchlist: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit watchlist deletion: %w", err)
+	}
+
+	log.Printf("Deleted watchlist ID=%d", id)
+	return nil
+}
+
+func addWatchlistSymbols(tx *sql.Tx, id int64, symbols []string, at time.Time) error {
+	for _, symbol := range symbols {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO watchlist_symbols (watchlist_id, symbol, added_at) VALUES (?, ?, ?)",
+			id, symbol, utc(at),
+		); err != nil {
+			return fmt.Errorf("failed to add watchlist symbol: %w", err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) scanWatchlists(rows *sql.Rows) ([]Watchlist, error) {
+	var lists []Watchlist
+	for rows.Next() {
+		var wl Watchlist
+		if err := rows.Scan(&wl.ID, &wl.UserID, &wl.Name, &wl.Shared, &wl.AlpacaID, &wl.CreatedAt, &wl.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan watchlist: %w", err)
+		}
+		lists = append(lists, wl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate watchlists: %w", err)
+	}
+	rows.Close()
+
+	for i := range lists {
+		symbols, err := db.getWatchlistSymbols(lists[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		lists[i].Symbols = symbols
+	}
+	return lists, nil
+}
+
+func (db *DB) getWatchlistSymbols(id int64) ([]string, error) {
+	rows, err := db.conn.Query(
+		"SELECT symbol FROM watchlist_symbols WHERE watchlist_id = ? ORDER BY symbol", id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query watchlist symbols: %w", err)
+	}
+	defer rows.Close()
+
+	symbols := []string{}
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, fmt.Errorf("failed to scan watchlist symbol: %w", err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate watchlist symbols: %w", err)
+	}
+	return symbols, nil
+}
+
+// GetStrategyUniverse returns the symbols active strategies are likely to
+// trade, most likely first: those of pending conditional orders, those
+// traded since since, then those on their owners' watchlists. Strategies
+// declare no universe, so this is the desk's best guess at one.
+func (db *DB) GetStrategyUniverse(since time.Time) ([]string, error) {
+	query := `
+		WITH active AS (
+			SELECT id, user_id FROM strategies
+			WHERE status = 'active' AND deleted_at IS NULL
+		)
+		SELECT symbol FROM (
+			SELECT c.symbol, 0 AS rank FROM conditional_orders c
+			JOIN active a ON a.id = c.strategy_id
+			WHERE c.status = 'pending'
+			UNION ALL
+			SELECT t.symbol, 1 FROM trades t
+			JOIN active a ON a.id = t.strategy_id
+			WHERE t.submitted_at >= ?
+			UNION ALL
+			SELECT s.symbol, 2 FROM watchlist_symbols s
+			JOIN watchlists w ON w.id = s.watchlist_id
+			WHERE w.user_id IN (SELECT user_id FROM active)
+		)
+		GROUP BY symbol
+		ORDER BY MIN(rank), symbol
+	`
+
+	rows, err := db.conn.Query(query, utc(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query strategy universe: %w", err)
+	}
+	defer rows.Close()
+
+	symbols := []string{}
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, fmt.Errorf("failed to scan strategy universe symbol: %w", err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate strategy universe: %w", err)
+	}
+	return symbols, nil
+}
@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"desk/internal/artifacts"
+	"desk/internal/database"
+	"desk/internal/runner"
+)
+
+// Deployer deploys git refs of strategies as new strategy versions,
+// restarting running strategies on them and rolling back when the new
+// version does not stay up
+type Deployer struct {
+	db        *database.DB
+	git       *Git
+	artifacts *artifacts.Manager
+	runner    *runner.Runner
+
+	// healthWindow is how long a restarted strategy must keep running for
+	// a deployment to succeed
+	healthWindow time.Duration
+}
+
+func NewDeployer(db *database.DB, git *Git, artifacts *artifacts.Manager, runner *runner.Runner, healthWindow time.Duration) *Deployer {
+	return &Deployer{
+		db:           db,
+		git:          git,
+		artifacts:    artifacts,
+		runner:       runner,
+		healthWindow: healthWindow,
+	}
+}
+
+// Fetch resolves ref in the repository at url, returning the commit SHA and
+// an archive of its tree
+func (d *Deployer) Fetch(ctx context.Context, url, ref string) (string, []byte, error) {
+	return d.git.Fetch(ctx, url, ref)
+}
+
+// Deploy fetches ref from the strategy's repository and installs it. A
+// deployment is recorded whatever the outcome; the error is only set when
+// recording it fails.
+func (d *Deployer) Deploy(ctx context.Context, s *database.Strategy, ref, userID string) (*database.Deployment, error) {
+	if s.GitURL == nil {
+		return nil, errors.New("strategy is not registered from git")
+	}
+
+	sha, archive, err := d.git.Fetch(ctx, *s.GitURL, ref)
+	if err != nil {
+		dep := d.newDeployment(s, ref, userID)
+		return d.record(dep, database.DeployFailed, err.Error())
+	}
+	return d.Install(ctx, s, ref, sha, archive, userID)
+}
+
+// Install stores a fetched commit as the strategy's next version and makes
+// it active. A running strategy is restarted on it and rolled back to the
+// previous version if it exits within the health window.
+func (d *Deployer) Install(ctx context.Context, s *database.Strategy, ref, sha string, archive []byte, userID string) (*database.Deployment, error) {
+	dep := d.newDeployment(s, ref, userID)
+	dep.CommitSHA = &sha
+
+	v, err := d.artifacts.Put(ctx, s.ID, archive)
+	if err != nil {
+		if errors.Is(err, artifacts.ErrInvalid) {
+			return d.record(dep, database.DeployFailed, err.Error())
+		}
+		return nil, err
+	}
+	v.Note = fmt.Sprintf("git %s %s", ref, shortSHA(sha))
+	v.UploadedBy = userID
+	v.CreatedAt = time.Now()
+	if err := d.db.CreateStrategyVersion(v); err != nil {
+		return nil, err
+	}
+	dep.Version = &v.Version
+
+	if err := d.db.SetActiveStrategyVersion(s.ID, v.Version); err != nil {
+		return nil, err
+	}
+	if err := d.db.SetStrategyGitRef(s.ID, ref); err != nil {
+		return nil, err
+	}
+
+	if !d.runner.Running(s.ID) {
+		return d.record(dep, database.DeployDeployed, "")
+	}
+
+	if err := d.restart(s.ID); err != nil {
+		return d.rollback(dep, fmt.Sprintf("version %d failed to start: %v", v.Version, err))
+	}
+
+	// A nil channel means the process has already exited
+	exited := d.runner.Exited(s.ID)
+	if exited != nil {
+		select {
+		case <-exited:
+		case <-time.After(d.healthWindow):
+			return d.record(dep, database.DeployDeployed, "")
+		}
+	}
+
+	reason := fmt.Sprintf("version %d exited within %s", v.Version, d.healthWindow)
+	if updated, err := d.db.GetStrategyByID(s.ID); err == nil && updated.RunMessage != nil {
+		reason += ": " + *updated.RunMessage
+	}
+	return d.rollback(dep, reason)
+}
+
+// rollback reactivates and starts the version that was active before a
+// failed deployment
+func (d *Deployer) rollback(dep *database.Deployment, reason string) (*database.Deployment, error) {
+	if dep.PreviousVersion == nil {
+		return d.record(dep, database.DeployFailed, reason+"; no previous version to roll back to")
+	}
+
+	if err := d.db.SetActiveStrategyVersion(dep.StrategyID, *dep.PreviousVersion); err != nil {
+		return nil, err
+	}
+	if err := d.restart(dep.StrategyID); err != nil {
+		reason += fmt.Sprintf("; restarting version %d failed: %v", *dep.PreviousVersion, err)
+	}
+
+	log.Printf("Rolled strategy ID=%d back to version %d: %s", dep.StrategyID, *dep.PreviousVersion, reason)
+	return d.record(dep, database.DeployRolledBack, reason)
+}
+
+// restart stops a strategy if it is running and starts its active version
+func (d *Deployer) restart(id int64) error {
+	if err := d.runner.Stop(id); err != nil && !errors.Is(err, runner.ErrNotRunning) {
+		return err
+	}
+	s, err := d.db.GetStrategyByID(id)
+	if err != nil {
+		return err
+	}
+	return d.runner.Start(s)
+}
+
+func (d *Deployer) newDeployment(s *database.Strategy, ref, userID string) *database.Deployment {
+	return &database.Deployment{
+		StrategyID:      s.ID,
+		Ref:             ref,
+		PreviousVersion: s.ActiveVersion,
+		DeployedBy:      userID,
+		CreatedAt:       time.Now(),
+	}
+}
+
+func (d *Deployer) record(dep *database.Deployment, status, message string) (*database.Deployment, error) {
+	dep.Status = status
+	if message != "" {
+		dep.Message = &message
+	}
+	if err := d.db.CreateDeployment(dep); err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
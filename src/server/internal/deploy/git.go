@@ -0,0 +1,96 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitTimeout bounds each clone, fetch or archive
+const gitTimeout = 2 * time.Minute
+
+// Git keeps bare clones of strategy repositories and exports commits from
+// them
+type Git struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+func NewGit(dir string) *Git {
+	return &Git{dir: dir}
+}
+
+// Fetch brings the clone of url up to date, resolves ref to a commit and
+// returns the commit SHA with the commit's tree as a tar.gz archive
+func (g *Git) Fetch(ctx context.Context, url, ref string) (string, []byte, error) {
+	if url == "" || strings.HasPrefix(url, "-") {
+		return "", nil, fmt.Errorf("invalid git URL %q", url)
+	}
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	sum := sha256.Sum256([]byte(url))
+	repo := filepath.Join(g.dir, hex.EncodeToString(sum[:8])+".git")
+
+	if _, err := os.Stat(repo); os.IsNotExist(err) {
+		if err := os.MkdirAll(g.dir, 0o755); err != nil {
+			return "", nil, fmt.Errorf("failed to create git directory: %w", err)
+		}
+		if _, err := git(ctx, "", "clone", "--bare", "--quiet", "--", url, repo); err != nil {
+			os.RemoveAll(repo)
+			return "", nil, fmt.Errorf("failed to clone %s: %w", url, err)
+		}
+	} else if _, err := git(ctx, repo, "fetch", "--quiet", "--prune", "--force", "--tags",
+		"origin", "+refs/heads/*:refs/heads/*"); err != nil {
+		return "", nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+
+	out, err := git(ctx, repo, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("unknown git ref %q", ref)
+	}
+	sha := strings.TrimSpace(string(out))
+
+	archive, err := git(ctx, repo, "archive", "--format=tar.gz", sha)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to archive %s: %w", sha, err)
+	}
+	return sha, archive, nil
+}
+
+// git runs a git command, returning its stdout. Prompts are disabled so a
+// repository needing credentials fails instead of hanging.
+func git(ctx context.Context, repo string, args ...string) ([]byte, error) {
+	if repo != "" {
+		args = append([]string{"-C", repo}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,162 @@
+package dividends
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/symbols"
+)
+
+// Source lists the dividend activities posted to a broker account on a date
+type Source interface {
+	Dividends(date time.Time) ([]alpaca.AccountActivity, error)
+}
+
+// Result summarizes one import
+type Result struct {
+	SessionDate string          `json:"session_date"`
+	Payments    int             `json:"payments"`
+	Books       int             `json:"books"`
+	Amount      decimal.Decimal `json:"amount"`
+	// Unallocated are payments no book held the symbol for; they stay out
+	// of every book until someone allocates them
+	Unallocated []string `json:"unallocated,omitempty"`
+	Failed      int      `json:"failed"`
+}
+
+// Importer records the dividends paid into each broker account in the books
+// that earned them. The broker reports a payment against the account, so it
+// is split among the account's books in proportion to their positions in
+// the symbol when it is imported; a short book's share is negative, since
+// shorts pay the dividend.
+type Importer struct {
+	db       *database.DB
+	accounts func() map[string]Source
+	// accountOf returns the key of the account a user trades in
+	accountOf func(userID string) string
+	notifier  notify.Notifier
+}
+
+func NewImporter(db *database.DB, accounts func() map[string]Source, accountOf func(userID string) string, notifier notify.Notifier) *Importer {
+	return &Importer{
+		db:        db,
+		accounts:  accounts,
+		accountOf: accountOf,
+		notifier:  notifier,
+	}
+}
+
+// Import records every account's dividends for a session. Payments already
+// recorded are skipped, so it is safe to re-run.
+func (im *Importer) Import(ctx context.Context, sessionDate string) (*Result, error) {
+	date, err := time.Parse("2006-01-02", sessionDate)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{SessionDate: sessionDate}
+
+	positions, err := im.db.GetOpenPositionCosts()
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]map[string][]database.PositionCost)
+	for _, p := range positions {
+		account := im.accountOf(p.UserID)
+		if held[account] == nil {
+			held[account] = make(map[string][]database.PositionCost)
+		}
+		held[account][p.Symbol] = append(held[account][p.Symbol], p)
+	}
+
+	for account, source := range im.accounts() {
+		activities, err := source.Dividends(date)
+		if err != nil {
+			if account != "" {
+				err = fmt.Errorf("chapter %s: %w", account, err)
+			}
+			return nil, err
+		}
+
+		for _, a := range activities {
+			if a.NetAmount.IsZero() {
+				continue
+			}
+			imported, err := im.db.DividendImported(a.ID)
+			if err != nil || imported {
+				if err != nil {
+					log.Printf("Failed to check dividend %s: %v", a.ID, err)
+					result.Failed++
+				}
+				continue
+			}
+
+			symbol := symbols.Normalize(a.Symbol)
+			shares := Allocate(a.NetAmount, held[account][symbol])
+			if len(shares) == 0 {
+				log.Printf("No book holds %s for dividend %s of %s", symbol, a.ID, a.NetAmount)
+				result.Unallocated = append(result.Unallocated, fmt.Sprintf("%s %s", symbol, a.NetAmount.StringFixed(2)))
+				continue
+			}
+			for i := range shares {
+				shares[i].ActivityID = a.ID
+				shares[i].TradeDate = sessionDate
+			}
+			if err := im.db.RecordDividend(shares); err != nil {
+				log.Printf("Failed to record dividend %s: %v", a.ID, err)
+				result.Failed++
+				continue
+			}
+			result.Payments++
+			result.Books += len(shares)
+			result.Amount = result.Amount.Add(a.NetAmount)
+		}
+	}
+
+	if result.Failed > 0 || len(result.Unallocated) > 0 {
+		notify.Send(ctx, im.notifier, notify.LevelError, "Dividend import incomplete",
+			fmt.Sprintf("%d dividends could not be recorded and %d had no book to go to for %s",
+				result.Failed, len(result.Unallocated), sessionDate))
+	}
+
+	log.Printf("Imported dividends for %s: payments=%d books=%d amount=%s unallocated=%d failed=%d",
+		sessionDate, result.Payments, result.Books, result.Amount, len(result.Unallocated), result.Failed)
+	return result, nil
+}
+
+// Allocate splits amount among positions in proportion to their quantity.
+// Shares are rounded to the cent and the last position takes the rounding,
+// so they sum to amount exactly. Positions that net to zero get nothing.
+func Allocate(amount decimal.Decimal, positions []database.PositionCost) []database.Dividend {
+	total := decimal.Zero
+	for _, p := range positions {
+		total = total.Add(p.Qty)
+	}
+	if total.IsZero() {
+		return nil
+	}
+
+	shares := make([]database.Dividend, len(positions))
+	remaining := amount
+	for i, p := range positions {
+		share := remaining
+		if i < len(positions)-1 {
+			share = amount.Mul(p.Qty).Div(total).Round(2)
+			remaining = remaining.Sub(share)
+		}
+		shares[i] = database.Dividend{
+			UserID:     p.UserID,
+			StrategyID: p.StrategyID,
+			Symbol:     p.Symbol,
+			Qty:        p.Qty,
+			Amount:     share,
+		}
+	}
+	return shares
+}
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+
+	"desk/internal/database"
+	"desk/internal/pnl"
+	strategyprotos "desk/internal/protos/strategy"
+	deskstream "desk/internal/stream"
+)
+
+const (
+	// busBuffer is how many events a subscriber may fall behind by before
+	// events are dropped for it
+	busBuffer = 1024
+	// retryDelay is how long Stream waits before reconnecting a dropped
+	// market data stream
+	retryDelay = 30 * time.Second
+)
+
+// Source streams market data
+type Source interface {
+	StreamBarsAndQuotes(ctx context.Context, feed string, symbols []string, onBar func(stream.Bar), onQuote func(stream.Quote)) error
+}
+
+// message is an event with what the server needs to route it: the symbol
+// of a bar or quote, and the owner of a fill, which only the strategy (or,
+// for unattributed trades, the user) that traded receives
+type message struct {
+	event      *strategyprotos.Event
+	symbol     string
+	userID     string
+	strategyID int64
+}
+
+// Bus fans the desk's bars, quotes and fills out to subscribed strategies.
+// A strategy that falls behind has events dropped rather than holding up the
+// desk.
+type Bus struct {
+	hub *deskstream.Hub[message]
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		hub: deskstream.NewHub[message](busBuffer),
+	}
+}
+
+// subscribe registers for every event on the bus. The returned function must
+// be called to unsubscribe.
+func (b *Bus) subscribe() (<-chan message, func()) {
+	return b.hub.Subscribe()
+}
+
+// StreamStats describes the bus's subscribers
+func (b *Bus) StreamStats() deskstream.Stats {
+	return b.hub.Stats()
+}
+
+// Stream publishes bars, and quotes if quotes is set, of symbols on feed
+// until ctx is cancelled, reconnecting if the stream ends
+func (b *Bus) Stream(ctx context.Context, source Source, feed string, symbols []string, quotes bool) {
+	var onQuote func(stream.Quote)
+	if quotes {
+		onQuote = b.Quote
+	}
+	for {
+		if err := source.StreamBarsAndQuotes(ctx, feed, symbols, b.Bar, onQuote); err != nil {
+			log.Printf("Strategy event stream failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Bar publishes a minute bar
+func (b *Bus) Bar(bar stream.Bar) {
+	b.hub.Publish(message{
+		symbol: bar.Symbol,
+		event: &strategyprotos.Event{Event: &strategyprotos.Event_Bar{Bar: &strategyprotos.Bar{
+			Symbol: bar.Symbol,
+			TimeUs: bar.Timestamp.UnixMicro(),
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+			Vwap:   bar.VWAP,
+		}}},
+	})
+}
+
+// Quote publishes a quote
+func (b *Bus) Quote(q stream.Quote) {
+	b.hub.Publish(message{
+		symbol: q.Symbol,
+		event: &strategyprotos.Event{Event: &strategyprotos.Event_Quote{Quote: &strategyprotos.Quote{
+			Symbol:   q.Symbol,
+			TimeUs:   q.Timestamp.UnixMicro(),
+			BidPrice: q.BidPrice,
+			BidSize:  float64(q.BidSize),
+			AskPrice: q.AskPrice,
+			AskSize:  float64(q.AskSize),
+		}}},
+	})
+}
+
+// Fill publishes what has filled on a booked trade. It is a no-op for
+// trades with nothing filled.
+func (b *Bus) Fill(trade database.Trade) {
+	f, ok := pnl.FillFromTrade(trade)
+	if !ok {
+		return
+	}
+	at := trade.SubmittedAt
+	if trade.FilledAt != nil {
+		at = *trade.FilledAt
+	}
+
+	msg := message{
+		userID: trade.UserID,
+		event: &strategyprotos.Event{Event: &strategyprotos.Event_Fill{Fill: &strategyprotos.Fill{
+			TradeId:       trade.ID,
+			OrderId:       trade.OrderID,
+			ClientOrderId: trade.ClientOrderID,
+			Symbol:        f.Symbol,
+			Side:          f.Side,
+			Qty:           f.Qty.String(),
+			Price:         f.Price.String(),
+			TimeUs:        at.UnixMicro(),
+		}}},
+	}
+	if trade.StrategyID != nil {
+		msg.strategyID = *trade.StrategyID
+	}
+	b.hub.Publish(msg)
+}
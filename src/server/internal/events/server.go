@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	strategyprotos "desk/internal/protos/strategy"
+)
+
+// maxTimerInterval caps the timer interval a subscription may ask for
+const maxTimerInterval = 24 * 60 * 60
+
+// IdentifyFunc returns the user and strategy (0 for none) a subscription
+// comes from, or an error if it may not subscribe
+type IdentifyFunc func(ctx context.Context) (userID string, strategyID int64, err error)
+
+// Server serves the StrategyEvents gRPC service from a bus
+type Server struct {
+	strategyprotos.UnimplementedStrategyEventsServer
+
+	bus      *Bus
+	identify IdentifyFunc
+	resolve  func(symbol string) string
+}
+
+// NewServer serves bus to the callers identify accepts. resolve maps a
+// requested symbol to the one the bus publishes it under.
+func NewServer(bus *Bus, identify IdentifyFunc, resolve func(string) string) *Server {
+	return &Server{
+		bus:      bus,
+		identify: identify,
+		resolve:  resolve,
+	}
+}
+
+// Register adds the service to a gRPC server
+func (s *Server) Register(g *grpc.Server) {
+	strategyprotos.RegisterStrategyEventsServer(g, s)
+}
+
+// Subscribe streams the caller's events until it disconnects
+func (s *Server) Subscribe(req *strategyprotos.SubscribeRequest, out grpc.ServerStreamingServer[strategyprotos.Event]) error {
+	ctx := out.Context()
+	userID, strategyID, err := s.identify(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	if req.TimerIntervalSeconds < 0 || req.TimerIntervalSeconds > maxTimerInterval {
+		return status.Errorf(codes.InvalidArgument, "timer_interval_seconds must be between 0 and %d", maxTimerInterval)
+	}
+	symbols := make(map[string]bool, len(req.Symbols))
+	for _, sym := range req.Symbols {
+		if sym = s.resolve(sym); sym != "" {
+			symbols[sym] = true
+		}
+	}
+
+	msgs, unsubscribe := s.bus.subscribe()
+	defer unsubscribe()
+	var tick <-chan time.Time
+	if req.TimerIntervalSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(req.TimerIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	log.Printf("Strategy events subscribed: user=%s strategy=%d symbols=%d quotes=%t", userID, strategyID, len(symbols), req.Quotes)
+	defer log.Printf("Strategy events unsubscribed: user=%s strategy=%d", userID, strategyID)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-tick:
+			timer := &strategyprotos.Event{Event: &strategyprotos.Event_Timer{Timer: &strategyprotos.Timer{TimeUs: t.UnixMicro()}}}
+			if err := out.Send(timer); err != nil {
+				return err
+			}
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if !wants(msg, req.Quotes, symbols, userID, strategyID) {
+				continue
+			}
+			if err := out.Send(msg.event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// wants reports whether a subscriber gets an event: bars of its symbols,
+// quotes of them if it asked for quotes, and its own fills
+func wants(msg message, quotes bool, symbols map[string]bool, userID string, strategyID int64) bool {
+	switch msg.event.Event.(type) {
+	case *strategyprotos.Event_Bar:
+		return symbols[msg.symbol]
+	case *strategyprotos.Event_Quote:
+		return quotes && symbols[msg.symbol]
+	case *strategyprotos.Event_Fill:
+		return msg.userID == userID && msg.strategyID == strategyID
+	}
+	return false
+}
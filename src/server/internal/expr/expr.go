@@ -0,0 +1,301 @@
+// Package expr is a small expression language for conditions written in
+// configuration, such as custom risk rules:
+//
+//	order.notional < account.equity * 0.05 && symbol.avg_volume > 1e6
+//
+// Expressions combine numbers (exact decimals), strings and booleans with
+// arithmetic (+ - * /), comparisons (< <= > >= == !=), logic (&& || !),
+// membership (x in [a, b]) and the functions min, max and abs. Variables
+// are dotted names whose types are declared when an expression is parsed,
+// so a misspelt name or a type error is caught when the configuration
+// loads rather than when an order arrives. && and || short-circuit, so a
+// variable that is costly to look up is only read if it is needed.
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Kind is the type of a value
+type Kind int
+
+const (
+	KindNumber Kind = iota + 1
+	KindString
+	KindBool
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindBool:
+		return "bool"
+	}
+	return "unknown"
+}
+
+// Value is a number, string or boolean
+type Value struct {
+	kind Kind
+	num  decimal.Decimal
+	str  string
+	b    bool
+}
+
+func Number(d decimal.Decimal) Value { return Value{kind: KindNumber, num: d} }
+func String(s string) Value          { return Value{kind: KindString, str: s} }
+func Bool(b bool) Value              { return Value{kind: KindBool, b: b} }
+
+func (v Value) Kind() Kind { return v.kind }
+
+// Number returns the value of a number
+func (v Value) Number() decimal.Decimal { return v.num }
+
+// Bool returns the value of a boolean
+func (v Value) Bool() bool { return v.b }
+
+func (v Value) String() string {
+	switch v.kind {
+	case KindNumber:
+		return v.num.String()
+	case KindString:
+		return fmt.Sprintf("%q", v.str)
+	case KindBool:
+		return fmt.Sprint(v.b)
+	}
+	return "<invalid>"
+}
+
+func (v Value) equal(w Value) bool {
+	switch v.kind {
+	case KindNumber:
+		return v.num.Equal(w.num)
+	case KindString:
+		return v.str == w.str
+	}
+	return v.b == w.b
+}
+
+// Env supplies the values of variables during evaluation
+type Env interface {
+	Lookup(name string) (Value, error)
+}
+
+// Expr is a parsed, type-checked expression
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Parse parses src, checking it against vars, the variables it may use and
+// their types
+func Parse(src string, vars map[string]Kind) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: vars, used: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+
+	e := &Expr{src: src, root: root}
+	for name := range p.used {
+		e.vars = append(e.vars, name)
+	}
+	slices.Sort(e.vars)
+	return e, nil
+}
+
+// Kind returns the type of the expression's result
+func (e *Expr) Kind() Kind {
+	return e.root.kind()
+}
+
+// Vars returns the variables the expression uses, sorted
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression. Errors come from env or from arithmetic
+// such as division by zero.
+func (e *Expr) Eval(env Env) (Value, error) {
+	return e.root.eval(env)
+}
+
+// node is a node of the syntax tree. Its kind is known from parsing.
+type node interface {
+	kind() Kind
+	eval(env Env) (Value, error)
+}
+
+type literal struct{ v Value }
+
+func (n literal) kind() Kind              { return n.v.kind }
+func (n literal) eval(Env) (Value, error) { return n.v, nil }
+
+type variable struct {
+	name string
+	k    Kind
+}
+
+func (n variable) kind() Kind { return n.k }
+
+func (n variable) eval(env Env) (Value, error) {
+	v, err := env.Lookup(n.name)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", n.name, err)
+	}
+	if v.kind != n.k {
+		return Value{}, fmt.Errorf("%s is a %s, not a %s", n.name, v.kind, n.k)
+	}
+	return v, nil
+}
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (n unary) kind() Kind { return n.x.kind() }
+
+func (n unary) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return Value{}, err
+	}
+	if n.op == "!" {
+		return Bool(!x.b), nil
+	}
+	return Number(x.num.Neg()), nil
+}
+
+type binary struct {
+	op   string
+	l, r node
+}
+
+func (n binary) kind() Kind {
+	switch n.op {
+	case "+", "-", "*", "/":
+		return KindNumber
+	}
+	return KindBool
+}
+
+func (n binary) eval(env Env) (Value, error) {
+	l, err := n.l.eval(env)
+	if err != nil {
+		return Value{}, err
+	}
+	// Short-circuit, so the right side's variables aren't looked up
+	switch {
+	case n.op == "&&" && !l.b:
+		return Bool(false), nil
+	case n.op == "||" && l.b:
+		return Bool(true), nil
+	}
+	r, err := n.r.eval(env)
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return Bool(r.b), nil
+	case "==":
+		return Bool(l.equal(r)), nil
+	case "!=":
+		return Bool(!l.equal(r)), nil
+	case "+":
+		return Number(l.num.Add(r.num)), nil
+	case "-":
+		return Number(l.num.Sub(r.num)), nil
+	case "*":
+		return Number(l.num.Mul(r.num)), nil
+	case "/":
+		if r.num.IsZero() {
+			return Value{}, fmt.Errorf("division by zero")
+		}
+		return Number(l.num.Div(r.num)), nil
+	}
+
+	var c int
+	if l.kind == KindString {
+		c = strings.Compare(l.str, r.str)
+	} else {
+		c = l.num.Cmp(r.num)
+	}
+	switch n.op {
+	case "<":
+		return Bool(c < 0), nil
+	case "<=":
+		return Bool(c <= 0), nil
+	case ">":
+		return Bool(c > 0), nil
+	default:
+		return Bool(c >= 0), nil
+	}
+}
+
+type in struct {
+	x    node
+	list []Value
+}
+
+func (n in) kind() Kind { return KindBool }
+
+func (n in) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return Value{}, err
+	}
+	for _, v := range n.list {
+		if x.equal(v) {
+			return Bool(true), nil
+		}
+	}
+	return Bool(false), nil
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+func (n call) kind() Kind { return KindNumber }
+
+func (n call) eval(env Env) (Value, error) {
+	values := make([]decimal.Decimal, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return Value{}, err
+		}
+		values[i] = v.num
+	}
+	switch n.fn {
+	case "abs":
+		return Number(values[0].Abs()), nil
+	case "min":
+		return Number(decimal.Min(values[0], values[1:]...)), nil
+	default:
+		return Number(decimal.Max(values[0], values[1:]...)), nil
+	}
+}
@@ -0,0 +1,88 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// twoCharOps are the operators of two characters; they are matched before
+// single characters so "<=" isn't read as "<" then "="
+var twoCharOps = []string{"&&", "||", "<=", ">=", "==", "!="}
+
+const oneCharOps = "!<>+-*/()[],."
+
+// lex splits src into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1])):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			// An exponent, as in 1e6 or 2.5e-3
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && unicode.IsDigit(rune(src[j])) {
+					for i = j; i < len(src) && unicode.IsDigit(rune(src[i])); i++ {
+					}
+				}
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			end := strings.IndexByte(src[i+1:], byte(c))
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i += end + 2
+			tokens = append(tokens, token{tokString, src[start+1 : i-1], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		default:
+			op := ""
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(src[i:], two) {
+					op = two
+				}
+			}
+			if op == "" && strings.ContainsRune(oneCharOps, c) {
+				op = string(c)
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
@@ -0,0 +1,319 @@
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// functions are the functions expressions may call, with the fewest
+// arguments each takes; abs takes exactly one
+var functions = map[string]int{
+	"abs": 1,
+	"min": 2,
+	"max": 2,
+}
+
+// parser is a recursive-descent parser, one method per precedence level
+// from loosest (||) to tightest (unary operators and primaries)
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]Kind
+	used   map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of ops
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind == tokOp && slices.Contains(ops, t.text) {
+		p.pos++
+		return t.text, true
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return fmt.Errorf("expected %q at end", op)
+		}
+		return fmt.Errorf("expected %q at %d, found %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+// want checks an operand of op has kind k
+func want(op string, n node, k Kind) error {
+	if n.kind() != k {
+		return fmt.Errorf("%s needs a %s, not a %s", op, k, n.kind())
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept(op); !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := want(op, l, KindBool); err != nil {
+			return nil, err
+		}
+		if err := want(op, r, KindBool); err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := want("!", x, KindBool); err != nil {
+			return nil, err
+		}
+		return unary{op: "!", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "in" {
+		p.next()
+		return p.parseIn(l)
+	}
+
+	op, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return l, nil
+	}
+	r, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if l.kind() != r.kind() {
+		return nil, fmt.Errorf("%s compares a %s with a %s", op, l.kind(), r.kind())
+	}
+	if l.kind() == KindBool && op != "==" && op != "!=" {
+		return nil, fmt.Errorf("%s can't order booleans", op)
+	}
+	return binary{op: op, l: l, r: r}, nil
+}
+
+// parseIn parses the literal list of x in [a, b, ...]
+func (p *parser) parseIn(x node) (node, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	n := in{x: x}
+	for {
+		if _, ok := p.accept("]"); ok && len(n.list) == 0 {
+			return nil, fmt.Errorf("in needs at least one value")
+		} else if ok {
+			return n, nil
+		}
+		if len(n.list) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		item, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(literal)
+		if !ok {
+			if u, isUnary := item.(unary); isUnary {
+				if l, isLit := u.x.(literal); isLit && l.v.kind == KindNumber {
+					lit, ok = literal{Number(l.v.num.Neg())}, true
+				}
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("in lists only literal values")
+		}
+		if lit.v.kind != x.kind() {
+			return nil, fmt.Errorf("in compares a %s with a %s", x.kind(), lit.v.kind)
+		}
+		n.list = append(n.list, lit.v)
+	}
+}
+
+func (p *parser) parseSum() (node, error) {
+	return p.parseArithmetic([]string{"+", "-"}, p.parseProduct)
+}
+
+func (p *parser) parseProduct() (node, error) {
+	return p.parseArithmetic([]string{"*", "/"}, p.parseUnary)
+}
+
+func (p *parser) parseArithmetic(ops []string, operand func() (node, error)) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := want(op, l, KindNumber); err != nil {
+			return nil, err
+		}
+		if err := want(op, r, KindNumber); err != nil {
+			return nil, err
+		}
+		l = binary{op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := want("-", x, KindNumber); err != nil {
+			return nil, err
+		}
+		return unary{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		d, err := decimal.NewFromString(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literal{Number(d)}, nil
+	case tokString:
+		return literal{String(t.text)}, nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{Bool(true)}, nil
+		case "false":
+			return literal{Bool(false)}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		return p.parseVariable(t)
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// parseVariable parses a dotted name whose first part is t
+func (p *parser) parseVariable(t token) (node, error) {
+	parts := []string{t.text}
+	for {
+		if _, ok := p.accept("."); !ok {
+			break
+		}
+		part := p.next()
+		if part.kind != tokIdent {
+			return nil, fmt.Errorf("expected a name after %q at %d", strings.Join(parts, "."), part.pos)
+		}
+		parts = append(parts, part.text)
+	}
+
+	name := strings.Join(parts, ".")
+	k, ok := p.vars[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s at %d", name, t.pos)
+	}
+	p.used[name] = true
+	return variable{name: name, k: k}, nil
+}
+
+// parseCall parses the arguments of a call of the function t, whose opening
+// parenthesis has been read
+func (p *parser) parseCall(t token) (node, error) {
+	least, ok := functions[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at %d", t.text, t.pos)
+	}
+	n := call{fn: t.text}
+	for {
+		if _, ok := p.accept(")"); ok {
+			break
+		}
+		if len(n.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := want(t.text, arg, KindNumber); err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+	}
+	if t.text == "abs" && len(n.args) != 1 {
+		return nil, fmt.Errorf("abs takes one argument, not %d", len(n.args))
+	}
+	if len(n.args) < least {
+		return nil, fmt.Errorf("%s takes at least %d arguments, not %d", t.text, least, len(n.args))
+	}
+	return n, nil
+}
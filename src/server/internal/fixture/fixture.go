@@ -0,0 +1,711 @@
+// Package fixture emulates the parts of Alpaca's API the desk uses: the
+// account, positions, orders, dividend activities, the trade update stream,
+// latest trades and (empty) news. It starts from recorded responses and keeps orders in
+// memory, so the desk can be tested and demonstrated without an Alpaca
+// account or a network.
+//
+// Market orders and marketable limit orders fill at once at the recorded
+// price, whatever the time of day, and update the account and positions.
+// Other orders stay open until they are canceled or replaced; stops never
+// trigger. Scenarios make chosen requests fail, or answer slowly, the way
+// Alpaca does.
+package fixture
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+//go:embed recorded
+var recorded embed.FS
+
+// Alpaca's error codes for the errors the server returns
+const (
+	codeUnauthorized = 40110000
+	codeForbidden    = 40310000
+	codeNotFound     = 40410000
+	codeUnprocessed  = 42210000
+)
+
+// terminal are the order statuses after which an order can't change
+var terminal = []string{"filled", "canceled", "expired", "replaced", "rejected"}
+
+// Server is an in-memory Alpaca account served over HTTP
+type Server struct {
+	mux *http.ServeMux
+	now func() time.Time
+
+	mu         sync.Mutex
+	account    alpaca.Account
+	positions  map[string]*alpaca.Position
+	trades     map[string]marketdata.Trade
+	activities []alpaca.AccountActivity
+	orders     []*alpaca.Order
+	updates    []alpaca.TradeUpdate
+	// changed is closed, and replaced, when an update is added
+	changed   chan struct{}
+	scenarios []*Scenario
+	seq       int
+}
+
+// New creates a server holding the recorded account, positions, prices
+// and dividends
+func New() (*Server, error) {
+	s := &Server{
+		mux:       http.NewServeMux(),
+		now:       time.Now,
+		positions: make(map[string]*alpaca.Position),
+		changed:   make(chan struct{}),
+	}
+
+	var positions []alpaca.Position
+	var trades struct {
+		Trades map[string]marketdata.Trade `json:"trades"`
+	}
+	for name, dest := range map[string]any{
+		"account.json":    &s.account,
+		"positions.json":  &positions,
+		"trades.json":     &trades,
+		"activities.json": &s.activities,
+	} {
+		data, err := recorded.ReadFile("recorded/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, dest); err != nil {
+			return nil, fmt.Errorf("recorded %s: %w", name, err)
+		}
+	}
+	for _, p := range positions {
+		s.positions[p.Symbol] = &p
+	}
+	s.trades = trades.Trades
+
+	s.mux.HandleFunc("GET /v2/account", s.handleAccount)
+	s.mux.HandleFunc("GET /v2/positions", s.handlePositions)
+	s.mux.HandleFunc("GET /v2/orders", s.handleListOrders)
+	s.mux.HandleFunc("POST /v2/orders", s.handlePlaceOrder)
+	s.mux.HandleFunc("GET /v2/orders/{id}", s.handleGetOrder)
+	s.mux.HandleFunc("DELETE /v2/orders/{id}", s.handleCancelOrder)
+	s.mux.HandleFunc("PATCH /v2/orders/{id}", s.handleReplaceOrder)
+	s.mux.HandleFunc("GET /v2/account/activities", s.handleActivities)
+	s.mux.HandleFunc("GET /v2beta1/events/trades", s.handleTradeUpdates)
+	s.mux.HandleFunc("GET /v2/stocks/trades/latest", s.handleLatestTrades)
+	s.mux.HandleFunc("GET /v1beta1/news", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"news": []any{}})
+	})
+	s.mux.HandleFunc("POST /fixture/scenarios/{name}", s.handleInjectScenario)
+	s.mux.HandleFunc("DELETE /fixture/scenarios", s.handleClearScenarios)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeNotFound, "endpoint not found")
+	})
+	return s, nil
+}
+
+// ServeHTTP serves Alpaca's API to any key, applying the scenarios that
+// match. The /fixture/ endpoints that control it need no key and are never
+// failed by scenarios.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/fixture/") {
+		if r.Header.Get("APCA-API-KEY-ID") == "" {
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "request is not authorized")
+			return
+		}
+		if sc := s.scenarioFor(r); sc != nil {
+			if sc.Delay > 0 {
+				select {
+				case <-time.After(sc.Delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if sc.Status != 0 {
+				writeError(w, sc.Status, sc.Code, sc.Message)
+				return
+			}
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Inject applies sc to the requests it matches from now on
+func (s *Server) Inject(sc Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = append(s.scenarios, &sc)
+}
+
+// Clear removes every scenario
+func (s *Server) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = nil
+}
+
+// scenarioFor returns the first scenario matching r and counts r against
+// it, dropping it once it has applied Times times
+func (s *Server) scenarioFor(r *http.Request) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sc := range s.scenarios {
+		if !sc.matches(r) {
+			continue
+		}
+		if sc.Times > 0 {
+			sc.Times--
+			if sc.Times == 0 {
+				s.scenarios = slices.Delete(s.scenarios, i, i+1)
+			}
+		}
+		return sc
+	}
+	return nil
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, s.account)
+}
+
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	positions := make([]alpaca.Position, 0, len(s.positions))
+	for _, p := range s.positions {
+		positions = append(positions, *p)
+	}
+	slices.SortFunc(positions, func(a, b alpaca.Position) int { return strings.Compare(a.Symbol, b.Symbol) })
+	writeJSON(w, http.StatusOK, positions)
+}
+
+// handleListOrders lists orders newest first, or oldest first with
+// direction=asc. Status is open (the default), closed or all; after and
+// until bound when the orders were submitted.
+func (s *Server) handleListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "closed" && status != "all" {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid status")
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	var symbols []string
+	if v := q.Get("symbols"); v != "" {
+		symbols = strings.Split(v, ",")
+	}
+	var after, until time.Time
+	if v := q.Get("after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid after")
+			return
+		}
+		after = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid until")
+			return
+		}
+		until = t
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]alpaca.Order, 0)
+	for _, o := range s.orders {
+		closed := slices.Contains(terminal, o.Status)
+		if (status == "open" && closed) || (status == "closed" && !closed) {
+			continue
+		}
+		if symbols != nil && !slices.Contains(symbols, o.Symbol) {
+			continue
+		}
+		if (!after.IsZero() && !o.SubmittedAt.After(after)) || (!until.IsZero() && o.SubmittedAt.After(until)) {
+			continue
+		}
+		list = append(list, *o)
+	}
+	if q.Get("direction") != "asc" {
+		slices.Reverse(list)
+	}
+	writeJSON(w, http.StatusOK, list[:min(limit, len(list))])
+}
+
+func (s *Server) handlePlaceOrder(w http.ResponseWriter, r *http.Request) {
+	var req alpaca.PlaceOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid order request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg := s.checkOrder(req); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, msg)
+		return
+	}
+	price := decimal.NewFromFloat(s.trades[req.Symbol].Price)
+	if req.Side == alpaca.Buy {
+		cost := price
+		if req.LimitPrice != nil {
+			cost = *req.LimitPrice
+		}
+		if cost.Mul(*req.Qty).GreaterThan(s.account.BuyingPower) {
+			writeError(w, http.StatusForbidden, codeForbidden, "insufficient buying power")
+			return
+		}
+	}
+
+	now := s.now().UTC()
+	s.seq++
+	o := &alpaca.Order{
+		ID:            fmt.Sprintf("00000000-0000-4000-8000-%012d", s.seq),
+		ClientOrderID: req.ClientOrderID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		SubmittedAt:   now,
+		Symbol:        req.Symbol,
+		AssetClass:    alpaca.USEquity,
+		Type:          req.Type,
+		Side:          req.Side,
+		TimeInForce:   req.TimeInForce,
+		Status:        "new",
+		Qty:           req.Qty,
+		LimitPrice:    req.LimitPrice,
+		StopPrice:     req.StopPrice,
+		ExtendedHours: req.ExtendedHours,
+	}
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = fmt.Sprintf("00000000-0000-4000-9000-%012d", s.seq)
+	}
+	if p, ok := s.positions[o.Symbol]; ok {
+		o.AssetID = p.AssetID
+	}
+	s.orders = append(s.orders, o)
+	s.publish("new", o)
+	s.execute(o)
+	writeJSON(w, http.StatusOK, o)
+}
+
+// checkOrder returns why Alpaca would refuse req, or "" if it wouldn't
+func (s *Server) checkOrder(req alpaca.PlaceOrderRequest) string {
+	if _, ok := s.trades[req.Symbol]; !ok {
+		return fmt.Sprintf("asset %q not found", req.Symbol)
+	}
+	if req.Qty == nil || !req.Qty.IsPositive() {
+		return "qty must be > 0"
+	}
+	if req.Side != alpaca.Buy && req.Side != alpaca.Sell {
+		return "invalid side"
+	}
+	switch req.Type {
+	case alpaca.Market:
+	case alpaca.Limit:
+		if req.LimitPrice == nil {
+			return "limit_price is required for limit orders"
+		}
+	case alpaca.Stop:
+		if req.StopPrice == nil {
+			return "stop_price is required for stop orders"
+		}
+	case alpaca.StopLimit:
+		if req.LimitPrice == nil || req.StopPrice == nil {
+			return "limit_price and stop_price are required for stop_limit orders"
+		}
+	default:
+		return "invalid order type"
+	}
+	switch req.TimeInForce {
+	case alpaca.Day, alpaca.GTC, alpaca.OPG, alpaca.CLS, alpaca.IOC, alpaca.FOK:
+	default:
+		return "invalid time_in_force"
+	}
+	if req.ExtendedHours && (req.Type != alpaca.Limit || req.TimeInForce != alpaca.Day) {
+		return "extended hours order must be DAY limit orders"
+	}
+	if req.ClientOrderID != "" && slices.ContainsFunc(s.orders, func(o *alpaca.Order) bool { return o.ClientOrderID == req.ClientOrderID }) {
+		return "client_order_id must be unique"
+	}
+	return ""
+}
+
+// execute fills o if it is marketable at the recorded price, and cancels
+// an immediate-or-cancel or fill-or-kill order that isn't
+func (s *Server) execute(o *alpaca.Order) {
+	price := decimal.NewFromFloat(s.trades[o.Symbol].Price)
+	marketable := false
+	switch o.Type {
+	case alpaca.Market:
+		marketable = true
+	case alpaca.Limit:
+		marketable = (o.Side == alpaca.Buy && o.LimitPrice.GreaterThanOrEqual(price)) ||
+			(o.Side == alpaca.Sell && o.LimitPrice.LessThanOrEqual(price))
+	}
+
+	now := s.now().UTC()
+	switch {
+	case marketable:
+		o.Status, o.UpdatedAt, o.FilledAt = "filled", now, &now
+		o.FilledQty, o.FilledAvgPrice = *o.Qty, &price
+		s.fill(o, price)
+	case o.TimeInForce == alpaca.IOC || o.TimeInForce == alpaca.FOK:
+		o.Status, o.UpdatedAt, o.CanceledAt = "canceled", now, &now
+		s.publish("canceled", o)
+	}
+}
+
+// fill books a fill of o at price to the account and its position
+func (s *Server) fill(o *alpaca.Order, price decimal.Decimal) {
+	qty := *o.Qty
+	if o.Side == alpaca.Sell {
+		qty = qty.Neg()
+	}
+	s.account.Cash = s.account.Cash.Sub(qty.Mul(price))
+	s.account.BuyingPower = s.account.BuyingPower.Sub(qty.Mul(price))
+
+	p, ok := s.positions[o.Symbol]
+	if !ok {
+		p = &alpaca.Position{AssetID: o.AssetID, Symbol: o.Symbol, AssetClass: alpaca.USEquity, AssetMarginable: true}
+		s.positions[o.Symbol] = p
+	}
+	held := p.Qty.Add(qty)
+	switch {
+	case held.IsZero():
+		delete(s.positions, o.Symbol)
+	case p.Qty.IsZero() || p.Qty.Sign() != held.Sign():
+		// Opened, or reversed through zero
+		p.AvgEntryPrice = price
+	case held.Abs().GreaterThan(p.Qty.Abs()):
+		p.AvgEntryPrice = p.Qty.Mul(p.AvgEntryPrice).Add(qty.Mul(price)).Div(held).Round(4)
+	}
+	p.Qty, p.QtyAvailable = held, held
+	p.Side = "long"
+	if held.IsNegative() {
+		p.Side = "short"
+	}
+	p.CostBasis = held.Mul(p.AvgEntryPrice)
+	marketValue := held.Mul(price)
+	unrealized := marketValue.Sub(p.CostBasis)
+	unrealizedPct := unrealized.Div(p.CostBasis.Abs())
+	p.MarketValue, p.CurrentPrice = &marketValue, &price
+	p.UnrealizedPL, p.UnrealizedPLPC = &unrealized, &unrealizedPct
+	s.revalue()
+
+	s.publishFill(o, price, held)
+}
+
+// revalue recomputes the account's market values and equity from its
+// positions
+func (s *Server) revalue() {
+	long, short := decimal.Zero, decimal.Zero
+	for _, p := range s.positions {
+		if p.MarketValue == nil {
+			continue
+		}
+		if p.MarketValue.IsNegative() {
+			short = short.Add(*p.MarketValue)
+		} else {
+			long = long.Add(*p.MarketValue)
+		}
+	}
+	s.account.LongMarketValue, s.account.ShortMarketValue = long, short
+	s.account.PositionMarketValue = long.Add(short.Abs())
+	s.account.Equity = s.account.Cash.Add(long).Add(short)
+	s.account.PortfolioValue = s.account.Equity
+}
+
+func (s *Server) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.order(r.PathValue("id"))
+	if o == nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.order(r.PathValue("id"))
+	if o == nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	}
+	if slices.Contains(terminal, o.Status) {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "order is not cancelable")
+		return
+	}
+	now := s.now().UTC()
+	o.Status, o.UpdatedAt, o.CanceledAt = "canceled", now, &now
+	s.publish("canceled", o)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReplaceOrder replaces an open order with a new one carrying the
+// changes, which fills if it is now marketable
+func (s *Server) handleReplaceOrder(w http.ResponseWriter, r *http.Request) {
+	var req alpaca.ReplaceOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid replace request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.order(r.PathValue("id"))
+	if old == nil {
+		writeError(w, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	}
+	if slices.Contains(terminal, old.Status) {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "unable to replace order, order isn't in replaceable state")
+		return
+	}
+	if req.Qty != nil && !req.Qty.IsPositive() {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "qty must be > 0")
+		return
+	}
+
+	now := s.now().UTC()
+	s.seq++
+	o := *old
+	o.ID = fmt.Sprintf("00000000-0000-4000-8000-%012d", s.seq)
+	o.ClientOrderID = req.ClientOrderID
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = fmt.Sprintf("00000000-0000-4000-9000-%012d", s.seq)
+	}
+	o.CreatedAt, o.UpdatedAt, o.SubmittedAt = now, now, now
+	o.Replaces, o.ReplacedBy, o.ReplacedAt = &old.ID, nil, nil
+	if req.Qty != nil {
+		o.Qty = req.Qty
+	}
+	if req.LimitPrice != nil {
+		o.LimitPrice = req.LimitPrice
+	}
+	if req.StopPrice != nil {
+		o.StopPrice = req.StopPrice
+	}
+	if req.TimeInForce != "" {
+		o.TimeInForce = req.TimeInForce
+	}
+
+	old.Status, old.UpdatedAt, old.ReplacedAt, old.ReplacedBy = "replaced", now, &now, &o.ID
+	s.publish("replaced", old)
+	s.orders = append(s.orders, &o)
+	s.publish("new", &o)
+	s.execute(&o)
+	writeJSON(w, http.StatusOK, &o)
+}
+
+func (s *Server) order(id string) *alpaca.Order {
+	for _, o := range s.orders {
+		if o.ID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+// handleActivities serves the recorded activities of the requested types,
+// on the requested date, a page at a time
+func (s *Server) handleActivities(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var types []string
+	if v := q.Get("activity_types"); v != "" {
+		types = strings.Split(v, ",")
+	}
+	var date string
+	if v := q.Get("date"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid date")
+			return
+		}
+		date = t.UTC().Format(time.DateOnly)
+	}
+	pageSize := 100
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid page_size")
+			return
+		}
+		pageSize = n
+	}
+
+	s.mu.Lock()
+	matched := make([]alpaca.AccountActivity, 0)
+	for _, a := range s.activities {
+		if types != nil && !slices.Contains(types, a.ActivityType) {
+			continue
+		}
+		on := a.Date.String()
+		if a.Date.IsZero() {
+			on = a.TransactionTime.UTC().Format(time.DateOnly)
+		}
+		if date != "" && on != date {
+			continue
+		}
+		matched = append(matched, a)
+	}
+	s.mu.Unlock()
+
+	if q.Get("direction") != "asc" {
+		slices.Reverse(matched)
+	}
+	if token := q.Get("page_token"); token != "" {
+		i := slices.IndexFunc(matched, func(a alpaca.AccountActivity) bool { return a.ID == token })
+		matched = matched[i+1:]
+	}
+	writeJSON(w, http.StatusOK, matched[:min(pageSize, len(matched))])
+}
+
+// handleTradeUpdates streams every order event since the requested time as
+// server-sent events, then new ones until the client disconnects
+func (s *Server) handleTradeUpdates(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, codeUnprocessed, "invalid since")
+			return
+		}
+		since = t
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sent := 0
+	for {
+		s.mu.Lock()
+		pending := slices.Clone(s.updates[sent:])
+		sent = len(s.updates)
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, u := range pending {
+			if u.At.Before(since) {
+				continue
+			}
+			data, err := json.Marshal(u)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// publish adds an order event to the trade update stream
+func (s *Server) publish(event string, o *alpaca.Order) {
+	s.add(alpaca.TradeUpdate{At: s.now().UTC(), Event: event, Order: *o})
+}
+
+func (s *Server) publishFill(o *alpaca.Order, price, positionQty decimal.Decimal) {
+	at := s.now().UTC()
+	qty := *o.Qty
+	s.add(alpaca.TradeUpdate{
+		At:          at,
+		Event:       "fill",
+		ExecutionID: fmt.Sprintf("00000000-0000-4000-a000-%012d", len(s.updates)+1),
+		Order:       *o,
+		PositionQty: &positionQty,
+		Price:       &price,
+		Qty:         &qty,
+		Timestamp:   &at,
+	})
+}
+
+func (s *Server) add(u alpaca.TradeUpdate) {
+	u.EventID = strconv.Itoa(len(s.updates) + 1)
+	s.updates = append(s.updates, u)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// handleLatestTrades serves the recorded trades in the requested symbols,
+// stamped with the current time so they don't look stale. Symbols that
+// weren't recorded are left out, as Alpaca leaves out ones that haven't
+// traded.
+func (s *Server) handleLatestTrades(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trades := make(map[string]marketdata.Trade)
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		if trade, ok := s.trades[symbol]; ok {
+			trade.Timestamp = s.now().UTC()
+			trades[symbol] = trade
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"trades": trades})
+}
+
+// handleInjectScenario applies a named scenario until it is cleared
+func (s *Server) handleInjectScenario(w http.ResponseWriter, r *http.Request) {
+	sc, err := Named(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.Inject(sc)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleClearScenarios(w http.ResponseWriter, r *http.Request) {
+	s.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v with status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error the way Alpaca does
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, map[string]any{"code": code, "message": message})
+}
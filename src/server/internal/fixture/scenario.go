@@ -0,0 +1,86 @@
+package fixture
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scenario makes the requests it matches fail, or answer slowly, the way
+// Alpaca does
+type Scenario struct {
+	// Method and Path select the requests it applies to; empty matches any.
+	// Path matches as a prefix, so /v2/orders covers the order endpoints.
+	Method string
+	Path   string
+	// Delay is waited before answering
+	Delay time.Duration
+	// Status is returned with Alpaca's error Code and Message instead of
+	// the response. Zero only delays.
+	Status  int
+	Code    int
+	Message string
+	// Times is how many requests it applies to; zero is every one
+	Times int
+}
+
+func (sc *Scenario) matches(r *http.Request) bool {
+	return (sc.Method == "" || sc.Method == r.Method) && strings.HasPrefix(r.URL.Path, sc.Path)
+}
+
+// scenarios are the named scenarios demo mode and the /fixture/scenarios
+// endpoint can apply
+var scenarios = map[string]Scenario{
+	// Every new order is refused for lack of buying power
+	"reject-orders": {
+		Method:  http.MethodPost,
+		Path:    "/v2/orders",
+		Status:  http.StatusForbidden,
+		Code:    codeForbidden,
+		Message: "insufficient buying power",
+	},
+	// Every request is over the rate limit
+	"rate-limited": {
+		Status:  http.StatusTooManyRequests,
+		Code:    42910000,
+		Message: "rate limit exceeded",
+	},
+	// Alpaca is down
+	"outage": {
+		Status:  http.StatusServiceUnavailable,
+		Code:    50010000,
+		Message: "service unavailable",
+	},
+	// Every request takes two seconds
+	"slow": {
+		Delay: 2 * time.Second,
+	},
+}
+
+// Named returns the named scenario
+func Named(name string) (Scenario, error) {
+	sc, ok := scenarios[name]
+	if !ok {
+		return Scenario{}, fmt.Errorf("unknown scenario %q, want one of %s", name, strings.Join(slices.Sorted(maps.Keys(scenarios)), ", "))
+	}
+	return sc, nil
+}
+
+// ParseScenarios returns the named scenarios in a comma-separated list
+func ParseScenarios(list string) ([]Scenario, error) {
+	var out []Scenario
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		sc, err := Named(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+package halts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/notify"
+)
+
+// Rejection codes for orders in a symbol that isn't trading
+const (
+	CodeHalted    = "HALTED"
+	CodeLULDPause = "LULD_PAUSE"
+)
+
+// Status codes from the CTA and UTP feeds. A quotation resumption ("Q")
+// reopens quoting ahead of trading, so the symbol stays halted until the
+// trading resumption.
+var (
+	haltCodes   = []string{"H", "P", "Q", "2"}
+	resumeCodes = []string{"T", "3"}
+)
+
+// luldPauseReason is the reason code of a limit up-limit down pause
+const luldPauseReason = "LUDP"
+
+// retryDelay is how long Run waits before reconnecting a dropped stream
+const retryDelay = 30 * time.Second
+
+// Source streams trading status and LULD band messages
+type Source interface {
+	StreamTradingStatus(ctx context.Context, feed string, onStatus func(stream.TradingStatus), onLULD func(stream.LULD)) error
+}
+
+// Bands are a symbol's current limit up-limit down price bands
+type Bands struct {
+	LimitUp   decimal.Decimal `json:"limit_up"`
+	LimitDown decimal.Decimal `json:"limit_down"`
+	Indicator string          `json:"indicator"`
+	Time      time.Time       `json:"time"`
+}
+
+// Halt is a symbol that isn't trading
+type Halt struct {
+	Symbol     string    `json:"symbol"`
+	Code       string    `json:"code"`
+	StatusCode string    `json:"status_code"`
+	Status     string    `json:"status"`
+	ReasonCode string    `json:"reason_code"`
+	Reason     string    `json:"reason"`
+	Since      time.Time `json:"since"`
+	Bands      *Bands    `json:"bands,omitempty"`
+}
+
+// Monitor tracks trading halts and LULD bands from the market data feed and
+// tells the desk when a symbol someone holds is halted or resumes
+type Monitor struct {
+	source   Source
+	feed     string
+	db       *database.DB
+	notifier notify.Notifier
+
+	mu    sync.RWMutex
+	halts map[string]Halt
+	bands map[string]Bands
+}
+
+// NewMonitor creates a monitor of feed (sip or iex)
+func NewMonitor(source Source, feed string, db *database.DB, notifier notify.Notifier) *Monitor {
+	return &Monitor{
+		source:   source,
+		feed:     feed,
+		db:       db,
+		notifier: notifier,
+		halts:    make(map[string]Halt),
+		bands:    make(map[string]Bands),
+	}
+}
+
+// Run consumes the feed until ctx is cancelled, reconnecting if the stream
+// ends
+func (m *Monitor) Run(ctx context.Context) {
+	for {
+		if err := m.source.StreamTradingStatus(ctx, m.feed, m.HandleStatus, m.HandleLULD); err != nil {
+			log.Printf("Trading status stream failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// HandleStatus records a halt or resumption
+func (m *Monitor) HandleStatus(s stream.TradingStatus) {
+	var halt Halt
+	switch {
+	case slices.Contains(haltCodes, s.StatusCode):
+		halt = Halt{
+			Symbol:     s.Symbol,
+			Code:       CodeHalted,
+			StatusCode: s.StatusCode,
+			Status:     s.StatusMsg,
+			ReasonCode: s.ReasonCode,
+			Reason:     s.ReasonMsg,
+			Since:      s.Timestamp,
+		}
+		if s.StatusCode == "P" || s.ReasonCode == luldPauseReason {
+			halt.Code = CodeLULDPause
+		}
+	case slices.Contains(resumeCodes, s.StatusCode):
+	default:
+		return
+	}
+
+	m.mu.Lock()
+	previous, wasHalted := m.halts[s.Symbol]
+	if halt.Symbol != "" {
+		// A halt keeps the time it began; a quotation resumption also keeps
+		// why it began
+		if wasHalted {
+			halt.Since = previous.Since
+			if s.StatusCode == "Q" {
+				halt.Code, halt.ReasonCode, halt.Reason = previous.Code, previous.ReasonCode, previous.Reason
+			}
+		}
+		m.halts[s.Symbol] = halt
+	} else {
+		delete(m.halts, s.Symbol)
+	}
+	m.mu.Unlock()
+
+	switch {
+	case halt.Symbol != "" && !wasHalted:
+		log.Printf("%s halted: %s (%s)", s.Symbol, s.StatusMsg, s.ReasonMsg)
+		m.notifyHolders(s.Symbol, notify.LevelWarning, s.Symbol+" halted",
+			fmt.Sprintf("%s: %s", s.StatusMsg, s.ReasonMsg))
+	case halt.Symbol == "" && wasHalted:
+		log.Printf("%s resumed trading", s.Symbol)
+		m.notifyHolders(s.Symbol, notify.LevelInfo, s.Symbol+" resumed",
+			fmt.Sprintf("%s after a halt since %s", s.StatusMsg, previous.Since.Format(time.RFC3339)))
+	}
+}
+
+// HandleLULD records a symbol's latest price bands
+func (m *Monitor) HandleLULD(l stream.LULD) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bands[l.Symbol] = Bands{
+		LimitUp:   decimal.NewFromFloat(l.LimitUpPrice),
+		LimitDown: decimal.NewFromFloat(l.LimitDownPrice),
+		Indicator: l.Indicator,
+		Time:      l.Timestamp,
+	}
+}
+
+// notifyHolders sends a notification about symbol if any user holds it
+func (m *Monitor) notifyHolders(symbol, level, title, message string) {
+	costs, err := m.db.GetOpenPositionCosts()
+	if err != nil {
+		log.Printf("Failed to find holders of %s: %v", symbol, err)
+		return
+	}
+
+	var holders []string
+	for _, c := range costs {
+		if c.Symbol == symbol && !slices.Contains(holders, c.UserID) {
+			holders = append(holders, c.UserID)
+		}
+	}
+	if len(holders) == 0 {
+		return
+	}
+	sort.Strings(holders)
+	notify.Send(context.Background(), m.notifier, level, title,
+		fmt.Sprintf("%s; held by %s", message, strings.Join(holders, ", ")))
+}
+
+// Halted returns the halt in force for symbol, if any
+func (m *Monitor) Halted(symbol string) (Halt, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	halt, ok := m.halts[symbol]
+	return halt, ok
+}
+
+// Halts lists the symbols currently halted, longest halted first, with their
+// last price bands
+func (m *Monitor) Halts() []Halt {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Halt, 0, len(m.halts))
+	for symbol, halt := range m.halts {
+		if b, ok := m.bands[symbol]; ok {
+			halt.Bands = &b
+		}
+		out = append(out, halt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Since.Equal(out[j].Since) {
+			return out[i].Since.Before(out[j].Since)
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
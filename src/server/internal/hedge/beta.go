@@ -0,0 +1,71 @@
+package hedge
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// errShortHistory is returned when a symbol and its benchmark share too few
+// sessions for a beta
+var errShortHistory = errors.New("not enough history in common with the benchmark")
+
+// minReturns is the fewest daily returns in common a beta is computed from
+const minReturns = 20
+
+// Beta returns the beta of a symbol's daily returns against a benchmark's
+// over the last n sessions both traded: their covariance over the variance
+// of the benchmark's. Returns are only taken between consecutive sessions
+// with bars for both.
+func Beta(bars, benchmark []marketdata.Bar, n int) (float64, error) {
+	closes := make(map[time.Time]float64, len(benchmark))
+	for _, b := range benchmark {
+		closes[b.Timestamp.UTC().Truncate(24*time.Hour)] = b.Close
+	}
+
+	var asset, bench []float64
+	var prevAsset, prevBench float64
+	for _, b := range bars {
+		benchClose, ok := closes[b.Timestamp.UTC().Truncate(24*time.Hour)]
+		if !ok {
+			prevAsset = 0
+			continue
+		}
+		if prevAsset > 0 && prevBench > 0 {
+			asset = append(asset, b.Close/prevAsset-1)
+			bench = append(bench, benchClose/prevBench-1)
+		}
+		prevAsset, prevBench = b.Close, benchClose
+	}
+	if len(asset) > n {
+		asset, bench = asset[len(asset)-n:], bench[len(bench)-n:]
+	}
+	if len(asset) < minReturns {
+		return 0, errShortHistory
+	}
+
+	meanAsset, meanBench := mean(asset), mean(bench)
+	var cov, variance float64
+	for i := range asset {
+		cov += (asset[i] - meanAsset) * (bench[i] - meanBench)
+		variance += (bench[i] - meanBench) * (bench[i] - meanBench)
+	}
+	if variance == 0 {
+		return 0, errors.New("the benchmark has not moved")
+	}
+	beta := cov / variance
+	if math.IsNaN(beta) || math.IsInf(beta, 0) {
+		return 0, errors.New("beta is undefined")
+	}
+	return beta, nil
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
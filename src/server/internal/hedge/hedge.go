@@ -0,0 +1,482 @@
+// Package hedge keeps the desk's portfolio beta within configured bands.
+// Each rule beta-weights the account's positions against a benchmark and,
+// when the portfolio's beta leaves the band, proposes or places an order in
+// the benchmark that brings it back to zero. Hedge orders are booked as
+// hedge trades, so attribution can tell them apart from members' trades.
+package hedge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/options"
+	"desk/internal/orders"
+	"desk/internal/symbols"
+)
+
+// ErrNoRule is returned by Execute for a benchmark without a rule
+var ErrNoRule = errors.New("no hedge rule for benchmark")
+
+// Actions taken when a rule's band is breached
+const (
+	// ActionPropose reports the hedge order and notifies, leaving it to a
+	// human to place
+	ActionPropose = "propose"
+	// ActionExecute places the hedge order
+	ActionExecute = "execute"
+)
+
+// Rule keeps the portfolio's beta against Benchmark within ±Band, hedging
+// with the benchmark itself
+type Rule struct {
+	Benchmark string          `json:"benchmark"`
+	Band      decimal.Decimal `json:"band"`
+}
+
+// Name identifies the rule on its hedge trades, e.g. beta:SPY
+func (r Rule) Name() string {
+	return "beta:" + r.Benchmark
+}
+
+// ParseRules parses a comma-separated list of benchmark=band, e.g.
+// "SPY=0.2". A benchmark can only have one rule.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		benchmark, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not benchmark=band", entry)
+		}
+		benchmark = symbols.Normalize(benchmark)
+		if benchmark == "" || orders.AssetClassOf(benchmark) != orders.AssetClassEquity {
+			return nil, fmt.Errorf("%q is not an equity benchmark", entry)
+		}
+		band, err := decimal.NewFromString(strings.TrimSpace(v))
+		if err != nil || !band.IsPositive() {
+			return nil, fmt.Errorf("invalid band for %s: %q", benchmark, v)
+		}
+		if seen[benchmark] {
+			return nil, fmt.Errorf("%s has more than one rule", benchmark)
+		}
+		seen[benchmark] = true
+		rules = append(rules, Rule{Benchmark: benchmark, Band: band})
+	}
+	return rules, nil
+}
+
+// Policy is the rules and what is done when one is breached
+type Policy struct {
+	Rules  []Rule `json:"rules"`
+	Action string `json:"action"`
+}
+
+// AccountSource provides the account whose positions are hedged
+type AccountSource interface {
+	Account() (*alpaca.Account, error)
+	Positions() ([]alpaca.Position, error)
+	OpenOrders() ([]alpaca.Order, error)
+}
+
+// Prices supplies marks for positions and the hedge instrument's price
+type Prices interface {
+	MarkPrice(symbol string) (decimal.Decimal, bool)
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// BarSource supplies the daily bars betas are estimated from
+type BarSource interface {
+	DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error)
+}
+
+// SubmitFunc places a hedge order through the desk's order path
+type SubmitFunc func(order *orders.Order) (*database.Trade, error)
+
+// PositionBeta is one position's contribution to a rule's portfolio beta
+type PositionBeta struct {
+	Symbol string          `json:"symbol"`
+	Qty    decimal.Decimal `json:"qty"`
+	Value  decimal.Decimal `json:"value"`
+	Beta   *float64        `json:"beta,omitempty"`
+	// Error says why a position has no beta; it is left out of the total
+	Error string `json:"error,omitempty"`
+}
+
+// Proposal is the order that brings a rule's portfolio beta back to zero
+type Proposal struct {
+	Symbol   string          `json:"symbol"`
+	Side     string          `json:"side"`
+	Qty      decimal.Decimal `json:"qty"`
+	Notional decimal.Decimal `json:"notional"`
+}
+
+// Result is one rule's evaluation
+type Result struct {
+	Rule      string          `json:"rule"`
+	Benchmark string          `json:"benchmark"`
+	Band      decimal.Decimal `json:"band"`
+	// BetaExposure is the beta-weighted net market value of the positions,
+	// in dollars of the benchmark, and Beta that over equity
+	BetaExposure decimal.Decimal `json:"beta_exposure"`
+	Beta         decimal.Decimal `json:"beta"`
+	Breached     bool            `json:"breached"`
+	Positions    []PositionBeta  `json:"positions"`
+	// Unpriced counts positions left out for want of a beta
+	Unpriced int       `json:"unpriced"`
+	Proposal *Proposal `json:"proposal,omitempty"`
+	// OrderID and TradeID are set once a hedge is placed
+	OrderID string `json:"order_id,omitempty"`
+	TradeID int64  `json:"trade_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the latest evaluation of every rule
+type Report struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Equity    decimal.Decimal `json:"equity"`
+	Action    string          `json:"action"`
+	Rules     []Result        `json:"rules"`
+}
+
+// cachedBeta is a symbol's beta against a benchmark, estimated once a
+// session
+type cachedBeta struct {
+	day  string
+	beta float64
+	err  error
+}
+
+// Hedger evaluates the hedge rules every interval
+type Hedger struct {
+	account  AccountSource
+	prices   Prices
+	bars     BarSource
+	submit   SubmitFunc
+	notifier notify.Notifier
+	interval time.Duration
+	// days is how many daily returns betas are estimated over
+	days int
+
+	mu       sync.RWMutex
+	policy   Policy
+	latest   *Report
+	breached map[string]bool
+	betas    map[string]cachedBeta
+}
+
+func NewHedger(account AccountSource, prices Prices, bars BarSource, submit SubmitFunc, notifier notify.Notifier, interval time.Duration, days int) *Hedger {
+	return &Hedger{
+		account:  account,
+		prices:   prices,
+		bars:     bars,
+		submit:   submit,
+		notifier: notifier,
+		interval: interval,
+		days:     days,
+		policy:   Policy{Action: ActionPropose},
+		breached: make(map[string]bool),
+		betas:    make(map[string]cachedBeta),
+	}
+}
+
+// Policy returns the rules and action
+func (h *Hedger) Policy() Policy {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.policy
+}
+
+// SetPolicy changes the rules and action from the next evaluation on
+func (h *Hedger) SetPolicy(p Policy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = p
+}
+
+// Latest returns the most recent report, or nil if the rules haven't been
+// evaluated yet
+func (h *Hedger) Latest() *Report {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.latest
+}
+
+// Run evaluates the rules every interval until ctx is cancelled. Nothing
+// is evaluated while there are no rules.
+func (h *Hedger) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		if len(h.Policy().Rules) > 0 {
+			if _, err := h.Refresh(ctx); err != nil {
+				log.Printf("Failed to evaluate hedge rules: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh evaluates every rule and, under ActionExecute, places the hedges
+// of breached rules. Hedges are only placed in the regular session and
+// never while an order in the benchmark is open, so a hedge that hasn't
+// filled yet isn't placed twice.
+func (h *Hedger) Refresh(ctx context.Context) (*Report, error) {
+	policy := h.Policy()
+	report, err := h.evaluate(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Rules {
+		r := &report.Rules[i]
+		if r.Proposal != nil && policy.Action == ActionExecute {
+			h.place(r, report.Timestamp)
+		}
+		h.notify(ctx, r, policy.Action)
+	}
+
+	h.mu.Lock()
+	h.latest = report
+	h.mu.Unlock()
+	return report, nil
+}
+
+// Execute evaluates rule and places its hedge, if its band is breached,
+// whatever the action. It returns the rule's result.
+func (h *Hedger) Execute(ctx context.Context, benchmark string) (*Result, error) {
+	policy := h.Policy()
+	var rules []Rule
+	for _, r := range policy.Rules {
+		if r.Benchmark == benchmark {
+			rules = append(rules, r)
+		}
+	}
+	if rules == nil {
+		return nil, fmt.Errorf("%w %s", ErrNoRule, benchmark)
+	}
+
+	report, err := h.evaluate(Policy{Rules: rules, Action: ActionExecute})
+	if err != nil {
+		return nil, err
+	}
+	r := &report.Rules[0]
+	if r.Proposal != nil {
+		h.place(r, report.Timestamp)
+	}
+	h.notify(ctx, r, ActionExecute)
+	return r, nil
+}
+
+// evaluate beta-weights the account's positions for each rule
+func (h *Hedger) evaluate(policy Policy) (*Report, error) {
+	account, err := h.account.Account()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := h.account.Positions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &Report{Timestamp: now, Equity: account.Equity, Action: policy.Action, Rules: []Result{}}
+	for _, rule := range policy.Rules {
+		report.Rules = append(report.Rules, h.evaluateRule(rule, positions, account.Equity, now))
+	}
+	return report, nil
+}
+
+func (h *Hedger) evaluateRule(rule Rule, positions []alpaca.Position, equity decimal.Decimal, now time.Time) Result {
+	r := Result{Rule: rule.Name(), Benchmark: rule.Benchmark, Band: rule.Band, Positions: []PositionBeta{}}
+
+	syms := make([]string, len(positions))
+	for i, p := range positions {
+		syms[i] = p.Symbol
+	}
+	betas := h.betasFor(rule.Benchmark, syms, now)
+
+	for _, p := range positions {
+		pb := PositionBeta{Symbol: p.Symbol, Qty: p.Qty}
+		if mark, ok := h.prices.MarkPrice(p.Symbol); ok {
+			pb.Value = p.Qty.Mul(mark)
+		} else if p.MarketValue != nil {
+			pb.Value = *p.MarketValue
+		}
+		if b, ok := betas[p.Symbol]; ok && b.err == nil {
+			beta := b.beta
+			pb.Beta = &beta
+			r.BetaExposure = r.BetaExposure.Add(pb.Value.Mul(decimal.NewFromFloat(beta)))
+		} else {
+			r.Unpriced++
+			pb.Error = "no beta"
+			if ok {
+				pb.Error = b.err.Error()
+			}
+		}
+		r.Positions = append(r.Positions, pb)
+	}
+	r.BetaExposure = r.BetaExposure.Round(2)
+
+	if !equity.IsPositive() {
+		r.Error = "account equity is not positive"
+		return r
+	}
+	r.Beta = r.BetaExposure.Div(equity).Round(4)
+	r.Breached = r.Beta.Abs().GreaterThan(rule.Band)
+	if !r.Breached {
+		return r
+	}
+
+	price, err := h.prices.LatestPrice(rule.Benchmark)
+	if err != nil || !price.IsPositive() {
+		r.Error = fmt.Sprintf("no price for %s to size the hedge", rule.Benchmark)
+		return r
+	}
+	qty := r.BetaExposure.Abs().Div(price).Floor()
+	if !qty.IsPositive() {
+		return r
+	}
+	side := "sell"
+	if r.BetaExposure.IsNegative() {
+		side = "buy"
+	}
+	r.Proposal = &Proposal{Symbol: rule.Benchmark, Side: side, Qty: qty, Notional: qty.Mul(price).Round(2)}
+	return r
+}
+
+// betasFor returns the beta of each of symbols against benchmark,
+// estimating those not yet estimated this session in one request for bars.
+// Options have no beta.
+func (h *Hedger) betasFor(benchmark string, syms []string, now time.Time) map[string]cachedBeta {
+	day := market.SessionDate(now)
+	out := make(map[string]cachedBeta, len(syms))
+	var missing []string
+
+	h.mu.Lock()
+	for _, s := range syms {
+		switch {
+		case s == benchmark:
+			out[s] = cachedBeta{day: day, beta: 1}
+		case options.IsOCC(s):
+			out[s] = cachedBeta{day: day, err: fmt.Errorf("options are not beta-weighted")}
+		default:
+			if b, ok := h.betas[benchmark+"|"+s]; ok && b.day == day {
+				out[s] = b
+			} else {
+				missing = append(missing, s)
+			}
+		}
+	}
+	h.mu.Unlock()
+	if len(missing) == 0 {
+		return out
+	}
+
+	// Enough calendar days for days sessions of returns
+	since := now.AddDate(0, 0, -(h.days*7/5 + 10))
+	bars, err := h.bars.DailyBars(append(missing, benchmark), since)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range missing {
+		b := cachedBeta{day: day}
+		if err != nil {
+			// Don't cache a failed request; try again next time
+			out[s] = cachedBeta{day: day, err: fmt.Errorf("no bars: %w", err)}
+			continue
+		}
+		b.beta, b.err = Beta(bars[s], bars[benchmark], h.days)
+		h.betas[benchmark+"|"+s] = b
+		out[s] = b
+	}
+	return out
+}
+
+// place submits r's proposed hedge, recording the order or why it wasn't
+// placed on r
+func (h *Hedger) place(r *Result, now time.Time) {
+	if !market.InSession(now) {
+		r.Error = "hedges are only placed in the regular session"
+		return
+	}
+	open, err := h.account.OpenOrders()
+	if err != nil {
+		r.Error = "failed to check open orders: " + err.Error()
+		return
+	}
+	for _, o := range open {
+		if o.Symbol == r.Proposal.Symbol {
+			r.Error = fmt.Sprintf("an order in %s is already open", r.Proposal.Symbol)
+			return
+		}
+	}
+
+	trade, err := h.submit(&orders.Order{
+		Symbol:      r.Proposal.Symbol,
+		AssetClass:  orders.AssetClassEquity,
+		Side:        r.Proposal.Side,
+		Type:        "market",
+		TimeInForce: "day",
+		Qty:         r.Proposal.Qty,
+		HedgeRule:   r.Rule,
+	})
+	if err != nil {
+		r.Error = "failed to place hedge: " + err.Error()
+		return
+	}
+	r.OrderID, r.TradeID = trade.OrderID, trade.ID
+	log.Printf("Placed hedge for %s: %s %s %s as order %s", r.Rule, r.Proposal.Side, r.Proposal.Qty, r.Proposal.Symbol, trade.OrderID)
+}
+
+// notify reports a rule entering or leaving its band, and every hedge
+// placed or failed. A breach proposed but not acted on is only reported
+// once, not every evaluation.
+func (h *Hedger) notify(ctx context.Context, r *Result, action string) {
+	h.mu.Lock()
+	was := h.breached[r.Rule]
+	h.breached[r.Rule] = r.Breached
+	h.mu.Unlock()
+
+	switch {
+	case r.OrderID != "":
+		notify.Send(ctx, h.notifier, notify.LevelInfo, "Hedge placed",
+			fmt.Sprintf("Portfolio beta against %s was %s (band ±%s): %s %s %s placed as order %s",
+				r.Benchmark, r.Beta, r.Band, r.Proposal.Side, r.Proposal.Qty, r.Proposal.Symbol, r.OrderID))
+	case r.Breached && action == ActionExecute && r.Error != "":
+		notify.Send(ctx, h.notifier, notify.LevelError, "Hedge not placed",
+			fmt.Sprintf("Portfolio beta against %s is %s (band ±%s): %s", r.Benchmark, r.Beta, r.Band, r.Error))
+	case r.Breached && !was:
+		msg := fmt.Sprintf("Portfolio beta against %s is %s, outside its band of ±%s", r.Benchmark, r.Beta, r.Band)
+		if r.Proposal != nil {
+			msg += fmt.Sprintf("; proposed hedge: %s %s %s (about $%s)", r.Proposal.Side, r.Proposal.Qty, r.Proposal.Symbol, r.Proposal.Notional)
+		}
+		if r.Error != "" {
+			msg += "; " + r.Error
+		}
+		notify.Send(ctx, h.notifier, notify.LevelWarning, "Hedge proposed", msg)
+	case !r.Breached && was:
+		notify.Send(ctx, h.notifier, notify.LevelInfo, "Portfolio beta back within band",
+			fmt.Sprintf("Portfolio beta against %s is %s, within ±%s", r.Benchmark, r.Beta, r.Band))
+	}
+}
@@ -0,0 +1,56 @@
+package indicators
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// RSI returns Wilder's relative strength index (0-100) of closes, oldest
+// first, over period. It needs at least period+1 closes; extra history
+// smooths the average gain and loss.
+func RSI(closes []decimal.Decimal, period int) (decimal.Decimal, error) {
+	if period < 1 {
+		return decimal.Zero, fmt.Errorf("RSI period must be positive")
+	}
+	if len(closes) < period+1 {
+		return decimal.Zero, fmt.Errorf("RSI(%d) needs %d closes, have %d", period, period+1, len(closes))
+	}
+
+	n := decimal.NewFromInt(int64(period))
+	var avgGain, avgLoss decimal.Decimal
+	for i := 1; i <= period; i++ {
+		gain, loss := change(closes[i-1], closes[i])
+		avgGain = avgGain.Add(gain)
+		avgLoss = avgLoss.Add(loss)
+	}
+	avgGain = avgGain.Div(n)
+	avgLoss = avgLoss.Div(n)
+
+	prev := n.Sub(decimal.NewFromInt(1))
+	for i := period + 1; i < len(closes); i++ {
+		gain, loss := change(closes[i-1], closes[i])
+		avgGain = avgGain.Mul(prev).Add(gain).Div(n)
+		avgLoss = avgLoss.Mul(prev).Add(loss).Div(n)
+	}
+
+	hundred := decimal.NewFromInt(100)
+	if avgLoss.IsZero() {
+		if avgGain.IsZero() {
+			return decimal.NewFromInt(50), nil
+		}
+		return hundred, nil
+	}
+	rs := avgGain.Div(avgLoss)
+	return hundred.Sub(hundred.Div(rs.Add(decimal.NewFromInt(1)))), nil
+}
+
+// change splits the move from prev to cur into a gain and a loss, both
+// non-negative
+func change(prev, cur decimal.Decimal) (gain, loss decimal.Decimal) {
+	d := cur.Sub(prev)
+	if d.IsPositive() {
+		return d, decimal.Zero
+	}
+	return decimal.Zero, d.Neg()
+}
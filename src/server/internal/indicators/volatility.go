@@ -0,0 +1,83 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/shopspring/decimal"
+)
+
+// TradingDays is the number of sessions in a year, used to annualize daily
+// volatility
+const TradingDays = 252
+
+// Bar is one period's high, low and close
+type Bar struct {
+	High  decimal.Decimal
+	Low   decimal.Decimal
+	Close decimal.Decimal
+}
+
+// ATR returns Wilder's average true range of bars, oldest first, over period.
+// It needs at least period+1 bars; extra history smooths the average.
+func ATR(bars []Bar, period int) (decimal.Decimal, error) {
+	if period < 1 {
+		return decimal.Zero, fmt.Errorf("ATR period must be positive")
+	}
+	if len(bars) < period+1 {
+		return decimal.Zero, fmt.Errorf("ATR(%d) needs %d bars, have %d", period, period+1, len(bars))
+	}
+
+	n := decimal.NewFromInt(int64(period))
+	var atr decimal.Decimal
+	for i := 1; i <= period; i++ {
+		atr = atr.Add(trueRange(bars[i-1], bars[i]))
+	}
+	atr = atr.Div(n)
+
+	prev := n.Sub(decimal.NewFromInt(1))
+	for i := period + 1; i < len(bars); i++ {
+		atr = atr.Mul(prev).Add(trueRange(bars[i-1], bars[i])).Div(n)
+	}
+	return atr, nil
+}
+
+// trueRange is the largest of cur's range and its gaps from prev's close
+func trueRange(prev, cur Bar) decimal.Decimal {
+	return decimal.Max(
+		cur.High.Sub(cur.Low),
+		cur.High.Sub(prev.Close).Abs(),
+		cur.Low.Sub(prev.Close).Abs(),
+	)
+}
+
+// RealizedVol returns the annualized standard deviation of the daily log
+// returns of the last window+1 closes, oldest first
+func RealizedVol(closes []decimal.Decimal, window int) (decimal.Decimal, error) {
+	if window < 2 {
+		return decimal.Zero, fmt.Errorf("volatility window must be at least 2")
+	}
+	if len(closes) < window+1 {
+		return decimal.Zero, fmt.Errorf("volatility over %d days needs %d closes, have %d", window, window+1, len(closes))
+	}
+
+	closes = closes[len(closes)-window-1:]
+	returns := make([]float64, window)
+	var mean float64
+	for i := range returns {
+		prev, cur := closes[i].InexactFloat64(), closes[i+1].InexactFloat64()
+		if prev <= 0 || cur <= 0 {
+			return decimal.Zero, fmt.Errorf("non-positive close")
+		}
+		returns[i] = math.Log(cur / prev)
+		mean += returns[i]
+	}
+	mean /= float64(window)
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(window - 1)
+	return decimal.NewFromFloat(math.Sqrt(variance * TradingDays)), nil
+}
@@ -0,0 +1,244 @@
+// Package instruments holds the rounding and lot size rules of each symbol
+// the desk trades: the increments a quantity must come in, the smallest
+// order, and the ticks a price must fall on. Validation, sizing and the
+// rebalancer all round through it, so the desk never sends an order a venue
+// would reject for a sub-penny price or an illegal increment.
+package instruments
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/options"
+	"desk/internal/symbols"
+)
+
+// Asset classes an instrument belongs to
+const (
+	AssetClassEquity = "us_equity"
+	AssetClassCrypto = "crypto"
+	AssetClassOption = "us_option"
+)
+
+// FractionalScale is the most decimal places a fractional share order may
+// have
+const FractionalScale = 9
+
+var (
+	one     = decimal.NewFromInt(1)
+	penny   = decimal.New(1, -2)
+	subTick = decimal.New(1, -4)
+	// cryptoIncrement is the quantity and price increment of a crypto pair
+	// without an override
+	cryptoIncrement = decimal.New(1, -9)
+)
+
+// Instrument is the rounding and lot size rules of one symbol
+type Instrument struct {
+	Symbol     string `json:"symbol"`
+	AssetClass string `json:"asset_class"`
+	// QtyIncrement is the lot an order's quantity is a multiple of: a
+	// share, a contract or a crypto pair's trade increment
+	QtyIncrement decimal.Decimal `json:"qty_increment"`
+	// MinQty is the smallest order, zero for none
+	MinQty decimal.Decimal `json:"min_qty"`
+	// PriceIncrement is the tick prices fall on. Zero means the equity tick
+	// schedule: a cent at or above $1 and a hundredth of a cent below.
+	PriceIncrement decimal.Decimal `json:"price_increment"`
+	// Fractionable equities may also be ordered in fractions of a share, to
+	// FractionalScale places, as day orders
+	Fractionable bool `json:"fractionable"`
+}
+
+// Tick returns the price increment at price
+func (i Instrument) Tick(price decimal.Decimal) decimal.Decimal {
+	if i.PriceIncrement.IsPositive() {
+		return i.PriceIncrement
+	}
+	if price.LessThan(one) {
+		return subTick
+	}
+	return penny
+}
+
+// RoundPrice rounds a price to the nearest tick
+func (i Instrument) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	tick := i.Tick(price)
+	return price.Div(tick).Round(0).Mul(tick)
+}
+
+// CheckPrice returns an error if price isn't on a tick
+func (i Instrument) CheckPrice(price decimal.Decimal) error {
+	if tick := i.Tick(price); !price.Mod(tick).IsZero() {
+		return fmt.Errorf("%s is not a multiple of the %s tick of %s", price, tick, i.Symbol)
+	}
+	return nil
+}
+
+// RoundQty rounds a computed quantity down to whole lots, the way the desk
+// sizes orders, and to zero if that is below the minimum order
+func (i Instrument) RoundQty(qty decimal.Decimal) decimal.Decimal {
+	qty = qty.Div(i.QtyIncrement).Floor().Mul(i.QtyIncrement)
+	if qty.LessThan(i.MinQty) {
+		return decimal.Zero
+	}
+	return qty
+}
+
+// Fractional reports whether qty is not a whole number of lots
+func (i Instrument) Fractional(qty decimal.Decimal) bool {
+	return !qty.Mod(i.QtyIncrement).IsZero()
+}
+
+// CheckQty returns an error if qty is below the minimum order or isn't a
+// multiple of the lot, unless it is a fraction of a fractionable equity
+func (i Instrument) CheckQty(qty decimal.Decimal) error {
+	if qty.LessThan(i.MinQty) {
+		return fmt.Errorf("%s is below the minimum order of %s %s", qty, i.MinQty, i.Symbol)
+	}
+	if !i.Fractional(qty) {
+		return nil
+	}
+	if !i.Fractionable {
+		return fmt.Errorf("%s is not a multiple of %s, the lot size of %s", qty, i.QtyIncrement, i.Symbol)
+	}
+	if !qty.Equal(qty.Truncate(FractionalScale)) {
+		return fmt.Errorf("%s has more than %d decimal places", qty, FractionalScale)
+	}
+	return nil
+}
+
+// AssetClassOf infers the asset class from the symbol format: OCC option
+// symbols are options, and Alpaca quotes crypto as BASE/QUOTE pairs (e.g.
+// BTC/USD)
+func AssetClassOf(symbol string) string {
+	switch {
+	case options.IsOCC(symbol):
+		return AssetClassOption
+	case strings.Contains(symbol, "/"):
+		return AssetClassCrypto
+	}
+	return AssetClassEquity
+}
+
+// defaults returns the rules of symbol without an override: whole shares
+// and the equity tick schedule for equities, which may be ordered in
+// fractions; whole contracts and cent ticks for options; and nine decimal
+// places for crypto pairs
+func defaults(symbol string) Instrument {
+	switch AssetClassOf(symbol) {
+	case AssetClassOption:
+		return Instrument{Symbol: symbol, AssetClass: AssetClassOption, QtyIncrement: one, PriceIncrement: penny}
+	case AssetClassCrypto:
+		return Instrument{Symbol: symbol, AssetClass: AssetClassCrypto, QtyIncrement: cryptoIncrement, PriceIncrement: cryptoIncrement}
+	}
+	return Instrument{Symbol: symbol, AssetClass: AssetClassEquity, QtyIncrement: one, Fractionable: true}
+}
+
+// Override replaces some of a symbol's default rules. Fields left out keep
+// their defaults.
+type Override struct {
+	QtyIncrement   *decimal.Decimal `json:"qty_increment,omitempty"`
+	MinQty         *decimal.Decimal `json:"min_qty,omitempty"`
+	PriceIncrement *decimal.Decimal `json:"price_increment,omitempty"`
+	Fractionable   *bool            `json:"fractionable,omitempty"`
+}
+
+// apply sets the fields o overrides on i
+func (o Override) apply(i Instrument) Instrument {
+	if o.QtyIncrement != nil {
+		i.QtyIncrement = *o.QtyIncrement
+	}
+	if o.MinQty != nil {
+		i.MinQty = *o.MinQty
+	}
+	if o.PriceIncrement != nil {
+		i.PriceIncrement = *o.PriceIncrement
+	}
+	if o.Fractionable != nil {
+		i.Fractionable = *o.Fractionable
+	}
+	return i
+}
+
+// check returns an error if o's increments aren't positive
+func (o Override) check() error {
+	switch {
+	case o.QtyIncrement != nil && !o.QtyIncrement.IsPositive():
+		return fmt.Errorf("qty_increment must be positive")
+	case o.MinQty != nil && o.MinQty.IsNegative():
+		return fmt.Errorf("min_qty can't be negative")
+	case o.PriceIncrement != nil && !o.PriceIncrement.IsPositive():
+		return fmt.Errorf("price_increment must be positive")
+	}
+	return nil
+}
+
+// Load reads per-symbol overrides from the JSON file at path, an object of
+// symbol to override. path may be empty, for none.
+func Load(path string) (map[string]Override, error) {
+	overrides := make(map[string]Override)
+	if path == "" {
+		return overrides, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read instruments file: %w", err)
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse instruments file: %w", err)
+	}
+	normalized := make(map[string]Override, len(overrides))
+	for symbol, o := range overrides {
+		if err := o.check(); err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+		normalized[symbols.Normalize(symbol)] = o
+	}
+	return normalized, nil
+}
+
+// Registry looks up the rules of symbols, the defaults of their asset class
+// with any override applied. It is safe for concurrent use, and a nil
+// Registry serves the defaults.
+type Registry struct {
+	mu        sync.RWMutex
+	overrides map[string]Override
+}
+
+// New returns a registry applying overrides, keyed by normalized symbol
+func New(overrides map[string]Override) *Registry {
+	if overrides == nil {
+		overrides = make(map[string]Override)
+	}
+	return &Registry{overrides: overrides}
+}
+
+// Lookup returns the rules of a normalized symbol
+func (r *Registry) Lookup(symbol string) Instrument {
+	i := defaults(symbol)
+	if r == nil {
+		return i
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if o, ok := r.overrides[symbol]; ok {
+		i = o.apply(i)
+	}
+	return i
+}
+
+// Set replaces the overrides
+func (r *Registry) Set(overrides map[string]Override) {
+	if overrides == nil {
+		overrides = make(map[string]Override)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides = overrides
+}
@@ -0,0 +1,77 @@
+package latency
+
+import "time"
+
+// bounds are the upper bounds of the histogram buckets: 1ms growing by a
+// quarter per bucket up to a minute, so a quantile is within 25% of the
+// true value. Slower requests fall in a final overflow bucket.
+var bounds = func() []time.Duration {
+	var b []time.Duration
+	for d := float64(time.Millisecond); d < float64(time.Minute); d *= 1.25 {
+		b = append(b, time.Duration(d))
+	}
+	return append(b, time.Minute)
+}()
+
+// histogram counts request durations in fixed buckets
+type histogram struct {
+	counts []uint64
+	count  uint64
+	errors uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) add(d time.Duration, failed bool) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+	}
+	i := 0
+	for i < len(bounds) && d > bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+	if failed {
+		h.errors++
+	}
+}
+
+func (h *histogram) merge(o *histogram) {
+	if o.count == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.count += o.count
+	h.errors += o.errors
+	h.sum += o.sum
+	h.max = max(h.max, o.max)
+}
+
+// quantile returns the upper bound of the bucket holding the q quantile,
+// or the slowest request if that is sooner
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.count) + 0.5)
+	rank = max(rank, 1)
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if i < len(bounds) {
+				return min(bounds[i], h.max)
+			}
+			break
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,306 @@
+// Package latency records how long the broker takes to answer each of its
+// endpoints and alerts when an endpoint's p95 stays above its SLO, so broker
+// slowness is noticed before strategies feel it as late fills.
+package latency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"desk/internal/notify"
+)
+
+// window is how many minutes of histograms are kept per endpoint
+const window = 60
+
+// minSamples is the fewest requests a minute needs for its p95 to count
+// towards or against an SLO; quieter minutes leave a breach as it was
+const minSamples = 5
+
+// SLOs are the p95 latencies endpoints are expected to stay within
+type SLOs struct {
+	// Default applies to endpoints without their own SLO; zero is none
+	Default    time.Duration
+	ByEndpoint map[string]time.Duration
+}
+
+// ParseSLOs parses a comma-separated list of endpoint=duration, where an
+// endpoint is a method and path as Endpoint names it (e.g.
+// "POST /v2/orders=500ms") and * sets the default
+func ParseSLOs(s string) (SLOs, error) {
+	slos := SLOs{ByEndpoint: make(map[string]time.Duration)}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		endpoint, v, ok := strings.Cut(entry, "=")
+		if !ok {
+			return SLOs{}, fmt.Errorf("%q is not endpoint=duration", entry)
+		}
+		endpoint = strings.Join(strings.Fields(endpoint), " ")
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d <= 0 {
+			return SLOs{}, fmt.Errorf("invalid SLO for %s: %q", endpoint, v)
+		}
+		if endpoint == "*" {
+			slos.Default = d
+			continue
+		}
+		method, path, ok := strings.Cut(endpoint, " ")
+		if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return SLOs{}, fmt.Errorf("%q is not a method and path", endpoint)
+		}
+		slos.ByEndpoint[endpoint] = d
+	}
+	return slos, nil
+}
+
+// For returns endpoint's SLO, or zero if it has none
+func (s SLOs) For(endpoint string) time.Duration {
+	if d, ok := s.ByEndpoint[endpoint]; ok {
+		return d
+	}
+	return s.Default
+}
+
+// Empty reports whether no endpoint has an SLO
+func (s SLOs) Empty() bool {
+	return s.Default == 0 && len(s.ByEndpoint) == 0
+}
+
+// Endpoint names a request by its method and path, with path segments that
+// identify something (order IDs, symbols) replaced by {id} so requests to
+// the same endpoint share a histogram
+func Endpoint(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+	for i, s := range segments {
+		if i > 0 && !isWord(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return req.Method + " /" + strings.Join(segments, "/")
+}
+
+// isWord reports whether a path segment is a fixed part of an API's paths
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats describes an endpoint's latency over a window. Durations are in
+// milliseconds, and quantiles are within 25% of the true value.
+type Stats struct {
+	Endpoint string  `json:"endpoint"`
+	Requests uint64  `json:"requests"`
+	Errors   uint64  `json:"errors"`
+	MeanMS   float64 `json:"mean_ms"`
+	P50MS    float64 `json:"p50_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	P99MS    float64 `json:"p99_ms"`
+	MaxMS    float64 `json:"max_ms"`
+	SLOMS    float64 `json:"slo_ms,omitempty"`
+	// BreachMinutes is how many minutes in a row p95 has been over the SLO
+	BreachMinutes int  `json:"breach_minutes"`
+	Alerting      bool `json:"alerting"`
+}
+
+// minute is one minute of an endpoint's requests
+type minute struct {
+	at int64
+	h  histogram
+}
+
+// series is an endpoint's last window minutes of requests and SLO state
+type series struct {
+	minutes  [window]minute
+	breach   int
+	alerting bool
+}
+
+// Recorder keeps per-minute latency histograms of each endpoint
+type Recorder struct {
+	slos SLOs
+
+	mu        sync.Mutex
+	endpoints map[string]*series
+}
+
+func NewRecorder(slos SLOs) *Recorder {
+	return &Recorder{
+		slos:      slos,
+		endpoints: make(map[string]*series),
+	}
+}
+
+// Observe records a request to endpoint that took d, and whether it failed
+func (r *Recorder) Observe(endpoint string, d time.Duration, failed bool) {
+	at := time.Now().Unix() / 60
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.endpoints[endpoint]
+	if !ok {
+		s = &series{}
+		r.endpoints[endpoint] = s
+	}
+	m := &s.minutes[at%window]
+	if m.at != at {
+		*m = minute{at: at}
+	}
+	m.h.add(d, failed)
+}
+
+// Stats returns each endpoint's latency over the last since (up to an
+// hour), slowest p95 first
+func (r *Recorder) Stats(since time.Duration) []Stats {
+	now := time.Now().Unix() / 60
+	from := now - int64(since/time.Minute)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []Stats{}
+	for endpoint, s := range r.endpoints {
+		var h histogram
+		for i := range s.minutes {
+			if m := &s.minutes[i]; m.at > from && m.at <= now {
+				h.merge(&m.h)
+			}
+		}
+		if h.count == 0 {
+			continue
+		}
+		out = append(out, Stats{
+			Endpoint:      endpoint,
+			Requests:      h.count,
+			Errors:        h.errors,
+			MeanMS:        ms(h.sum / time.Duration(h.count)),
+			P50MS:         ms(h.quantile(0.5)),
+			P95MS:         ms(h.quantile(0.95)),
+			P99MS:         ms(h.quantile(0.99)),
+			MaxMS:         ms(h.max),
+			SLOMS:         ms(r.slos.For(endpoint)),
+			BreachMinutes: s.breach,
+			Alerting:      s.alerting,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].P95MS != out[j].P95MS {
+			return out[i].P95MS > out[j].P95MS
+		}
+		return out[i].Endpoint < out[j].Endpoint
+	})
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Run checks every finished minute's p95 against the SLOs until ctx is
+// cancelled. Once an endpoint has been over its SLO for minutes minutes in
+// a row a warning is sent, and once it is back within it, a recovery.
+func (r *Recorder) Run(ctx context.Context, minutes int, notifier notify.Notifier) {
+	if r.slos.Empty() {
+		return
+	}
+	for {
+		// Check a second into each minute, once the last one is complete
+		next := time.Now().Truncate(time.Minute).Add(time.Minute + time.Second)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, n := range r.check(next.Unix()/60-1, minutes) {
+			notify.Send(ctx, notifier, n.Level, n.Title, n.Message)
+		}
+	}
+}
+
+// check updates each endpoint's breach count with minute at's p95 and
+// returns the alerts and recoveries due
+func (r *Recorder) check(at int64, minutes int) []notify.Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []notify.Notification
+	for endpoint, s := range r.endpoints {
+		slo := r.slos.For(endpoint)
+		m := &s.minutes[at%window]
+		if slo == 0 || m.at != at || m.h.count < minSamples {
+			continue
+		}
+
+		p95 := m.h.quantile(0.95)
+		if p95 <= slo {
+			s.breach = 0
+			if s.alerting {
+				s.alerting = false
+				out = append(out, notify.Notification{
+					Level: notify.LevelInfo,
+					Title: "Broker latency recovered",
+					Message: fmt.Sprintf("p95 of %s is back to %s, within its %s SLO (%d requests in the last minute)",
+						endpoint, p95.Round(time.Millisecond), slo, m.h.count),
+				})
+			}
+			continue
+		}
+
+		s.breach++
+		if s.breach >= minutes && !s.alerting {
+			s.alerting = true
+			out = append(out, notify.Notification{
+				Level: notify.LevelWarning,
+				Title: "Broker latency over SLO",
+				Message: fmt.Sprintf("p95 of %s has been over its %s SLO for %d minutes, %s in the last minute (%d requests, %d failed)",
+					endpoint, slo, s.breach, p95.Round(time.Millisecond), m.h.count, m.h.errors),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Message < out[j].Message })
+	return out
+}
+
+// HTTPClient returns a client that records the latency of every request it
+// makes, with the same timeout as Alpaca's default client. A nil recorder
+// returns nil, which leaves Alpaca's default in place.
+func (r *Recorder) HTTPClient() *http.Client {
+	if r == nil {
+		return nil
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &transport{next: http.DefaultTransport, recorder: r},
+	}
+}
+
+// transport times each round trip, up to the response headers, as a
+// request to its endpoint. Transport errors and 5xx responses are failures.
+type transport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	t.recorder.Observe(Endpoint(req), time.Since(start), failed)
+	return resp, err
+}
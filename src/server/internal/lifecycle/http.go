@@ -0,0 +1,38 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// HTTPServer makes a component of srv. Starting binds srv.Addr, so a port
+// in use fails startup; stopping stops accepting connections and waits for
+// requests in flight to finish. Hijacked connections such as websockets
+// aren't waited for.
+func HTTPServer(name string, srv *http.Server, dependsOn ...string) Component {
+	var listener net.Listener
+	return Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(ctx context.Context) error {
+			var err error
+			listener, err = (&net.ListenConfig{}).Listen(ctx, "tcp", srv.Addr)
+			return err
+		},
+		Run: func(ctx context.Context) error {
+			if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if err := srv.Shutdown(ctx); err != nil {
+				srv.Close()
+				return err
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,297 @@
+// Package lifecycle starts and stops the server's subsystems in dependency
+// order. Each component (a server, a stream consumer, a scheduler, a worker)
+// names the components it uses; it starts after them and stops before them,
+// within its own timeout, so on shutdown the servers stop taking requests
+// before the workers behind them stop and the database closes last. Every
+// component's state is kept for health reporting.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Component states
+const (
+	StatePending  = "pending"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+	StateFailed   = "failed"
+)
+
+// Component is a subsystem of the server: a server, a stream consumer, a
+// scheduler or a worker. Every function is optional.
+type Component struct {
+	Name string
+	// DependsOn names the components this one uses. It starts after them
+	// and stops before them.
+	DependsOn []string
+	// Start prepares the component, e.g. binds its listener. An error
+	// aborts startup.
+	Start func(ctx context.Context) error
+	// Run does the component's work until ctx is cancelled. Returning
+	// before then fails the component.
+	Run func(ctx context.Context) error
+	// Stop asks the component to finish, e.g. drains a server. It is
+	// called before Run's context is cancelled.
+	Stop func(ctx context.Context) error
+	// Timeout bounds Start, and Stop and waiting for Run to return. The
+	// manager's default applies if it is zero.
+	Timeout time.Duration
+}
+
+// Status is a component's state, for health reporting
+type Status struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	DependsOn []string  `json:"depends_on,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// component is a Component and its state
+type component struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	state string
+	since time.Time
+	err   error
+}
+
+// Manager starts components in dependency order and stops them in reverse
+type Manager struct {
+	timeout time.Duration
+
+	mu         sync.Mutex
+	components []*component
+	started    []*component
+	stopping   bool
+}
+
+// New creates a manager giving each component timeout to start or stop
+// unless it sets its own
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Add registers a component. Components start in the order they are added,
+// except that each starts after the components it depends on.
+func (m *Manager) Add(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, &component{Component: c, state: StatePending, since: time.Now()})
+}
+
+// Start starts every component. If one fails to start, the ones already
+// started are stopped and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	order, err := m.order()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range order {
+		if err := m.start(ctx, c); err != nil {
+			m.Stop(context.Background())
+			return fmt.Errorf("failed to start %s: %w", c.Name, err)
+		}
+	}
+	log.Printf("Started %d components", len(order))
+	return nil
+}
+
+func (m *Manager) start(ctx context.Context, c *component) error {
+	m.set(c, StateStarting, nil)
+	if c.Start != nil {
+		startCtx, cancel := context.WithTimeout(ctx, m.timeoutOf(c))
+		err := c.Start(startCtx)
+		cancel()
+		if err != nil {
+			m.set(c, StateFailed, err)
+			return err
+		}
+	}
+	m.mu.Lock()
+	m.started = append(m.started, c)
+	m.mu.Unlock()
+
+	if c.Run != nil {
+		runCtx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		c.done = make(chan struct{})
+		go func() {
+			defer close(c.done)
+			err := c.Run(runCtx)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if c.state == StateStopping || c.state == StateStopped {
+				// Asked to stop
+				return
+			}
+			if err == nil {
+				err = errors.New("exited")
+			}
+			log.Printf("Component %s failed: %v", c.Name, err)
+			c.state, c.since, c.err = StateFailed, time.Now(), err
+		}()
+	}
+	m.set(c, StateRunning, nil)
+	return nil
+}
+
+// Stop stops every started component in reverse order, giving each its
+// timeout, and returns once they have all stopped or ctx ends. A component
+// that doesn't stop in time is logged and left behind.
+func (m *Manager) Stop(ctx context.Context) {
+	m.mu.Lock()
+	if m.stopping {
+		m.mu.Unlock()
+		return
+	}
+	m.stopping = true
+	started := slices.Clone(m.started)
+	m.mu.Unlock()
+
+	for _, c := range slices.Backward(started) {
+		if ctx.Err() != nil {
+			log.Printf("Shutdown deadline passed before stopping %s", c.Name)
+			continue
+		}
+		m.stop(ctx, c)
+	}
+}
+
+func (m *Manager) stop(ctx context.Context, c *component) {
+	start := time.Now()
+	m.set(c, StateStopping, nil)
+	stopCtx, cancel := context.WithTimeout(ctx, m.timeoutOf(c))
+	defer cancel()
+
+	var err error
+	if c.Stop != nil {
+		err = c.Stop(stopCtx)
+	}
+	if c.cancel != nil {
+		c.cancel()
+		select {
+		case <-c.done:
+		case <-stopCtx.Done():
+			err = errors.Join(err, fmt.Errorf("did not stop within %s", m.timeoutOf(c)))
+		}
+	}
+
+	if err != nil {
+		log.Printf("Failed to stop %s cleanly: %v", c.Name, err)
+		m.set(c, StateFailed, err)
+		return
+	}
+	log.Printf("Stopped %s in %s", c.Name, time.Since(start).Round(time.Millisecond))
+	m.set(c, StateStopped, nil)
+}
+
+// Status returns every component's state in the order they were added
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.components))
+	for _, c := range m.components {
+		s := Status{Name: c.Name, State: c.state, Since: c.since, DependsOn: c.DependsOn}
+		if c.err != nil {
+			s.Error = c.err.Error()
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Stopping reports whether the manager has begun stopping
+func (m *Manager) Stopping() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopping
+}
+
+func (m *Manager) set(c *component, state string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// A failure stands until the component is stopped
+	if c.state == StateFailed && state == StateRunning {
+		return
+	}
+	c.state, c.since, c.err = state, time.Now(), err
+}
+
+func (m *Manager) timeoutOf(c *component) time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return m.timeout
+}
+
+// order sorts the components so each comes after its dependencies, keeping
+// the order they were added in otherwise
+func (m *Manager) order() ([]*component, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byName := make(map[string]*component, len(m.components))
+	for _, c := range m.components {
+		if _, ok := byName[c.Name]; ok {
+			return nil, fmt.Errorf("component %s is added twice", c.Name)
+		}
+		byName[c.Name] = c
+	}
+	for _, c := range m.components {
+		for _, dep := range c.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("component %s depends on unknown component %s", c.Name, dep)
+			}
+		}
+	}
+
+	order := make([]*component, 0, len(m.components))
+	placed := make(map[string]bool, len(m.components))
+	visiting := make(map[string]bool)
+	var place func(c *component) error
+	place = func(c *component) error {
+		if placed[c.Name] {
+			return nil
+		}
+		if visiting[c.Name] {
+			return fmt.Errorf("components depend on each other through %s", c.Name)
+		}
+		visiting[c.Name] = true
+		for _, dep := range c.DependsOn {
+			if err := place(byName[dep]); err != nil {
+				return err
+			}
+		}
+		placed[c.Name] = true
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range m.components {
+		if err := place(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Func adapts a function that runs until ctx is cancelled to a Run
+func Func(run func(ctx context.Context)) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		run(ctx)
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package market
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata"
+)
+
+// Exchange is the time zone US equity sessions are defined in. The tz database
+// is embedded so DST transitions are correct even on hosts without zoneinfo.
+var Exchange = mustLoadLocation("America/New_York")
+
+// Regular session hours in exchange time
+const (
+	openHour, openMinute   = 9, 30
+	closeHour, closeMinute = 16, 0
+)
+
+// Extended-hours sessions at Alpaca, in exchange time: pre-market from 4:00
+// to the open and after-hours from the close to 20:00
+const (
+	preMarketHour = 4
+	afterHoursEnd = 20
+)
+
+// Sessions a time falls in
+const (
+	SessionPre     = "pre"
+	SessionRegular = "regular"
+	SessionPost    = "post"
+	SessionClosed  = "closed"
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load time zone %s: %v", name, err))
+	}
+	return loc
+}
+
+// ExchangeTime converts t to exchange-local time
+func ExchangeTime(t time.Time) time.Time {
+	return t.In(Exchange)
+}
+
+// ParseTime parses an RFC 3339 timestamp, or a "YYYY-MM-DD HH:MM[:SS]"
+// time without an offset, which is taken to be exchange time
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, Exchange); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or YYYY-MM-DD HH:MM[:SS] exchange time", s)
+}
+
+// SessionDate returns the exchange-local calendar date (YYYY-MM-DD) of the
+// session t falls in. Daily reports and jobs key on this rather than the UTC
+// or server-local date, so a session is never split across two days.
+func SessionDate(t time.Time) string {
+	return ExchangeTime(t).Format("2006-01-02")
+}
+
+// SessionOpen returns the regular-session open for the given session date
+func SessionOpen(date string) (time.Time, error) {
+	return sessionTime(date, openHour, openMinute)
+}
+
+// SessionClose returns the regular-session close for the given session date
+func SessionClose(date string) (time.Time, error) {
+	return sessionTime(date, closeHour, closeMinute)
+}
+
+// InSession reports whether t falls in a weekday regular session. Exchange
+// holidays are not known.
+func InSession(t time.Time) bool {
+	local := ExchangeTime(t)
+	if local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+		return false
+	}
+	date := local.Format("2006-01-02")
+	open, _ := SessionOpen(date)
+	closeAt, _ := SessionClose(date)
+	return !t.Before(open) && t.Before(closeAt)
+}
+
+// SessionOf returns the session t falls in on a weekday: pre, regular or
+// post, or closed overnight and at weekends. Exchange holidays are not
+// known.
+func SessionOf(t time.Time) string {
+	local := ExchangeTime(t)
+	if local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+		return SessionClosed
+	}
+	date := local.Format("2006-01-02")
+	open, _ := SessionOpen(date)
+	closeAt, _ := SessionClose(date)
+	preOpen, _ := sessionTime(date, preMarketHour, 0)
+	postClose, _ := sessionTime(date, afterHoursEnd, 0)
+	switch {
+	case t.Before(preOpen) || !t.Before(postClose):
+		return SessionClosed
+	case t.Before(open):
+		return SessionPre
+	case t.Before(closeAt):
+		return SessionRegular
+	default:
+		return SessionPost
+	}
+}
+
+func sessionTime(date string, hour, minute int) (time.Time, error) {
+	d, err := time.ParseInLocation("2006-01-02", date, Exchange)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid session date %q: %w", date, err)
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, Exchange), nil
+}
@@ -0,0 +1,382 @@
+package marks
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/orders"
+)
+
+// PriceSource supplies the latest trades positions are marked to
+type PriceSource interface {
+	LatestTrade(symbol string) (decimal.Decimal, time.Time, error)
+}
+
+// BatchPriceSource is a PriceSource that can also fetch the latest trades in
+// many symbols in one request. Watched symbols are refreshed through it when
+// the source supports it, rather than one request per symbol.
+type BatchPriceSource interface {
+	PriceSource
+	LatestTrades(symbols []string) (map[string]marketdata.Trade, error)
+}
+
+// Mark is the price a symbol was last marked at
+type Mark struct {
+	Price decimal.Decimal `json:"price"`
+	// TradedAt is when the trade at Price happened
+	TradedAt time.Time `json:"traded_at"`
+	MarkedAt time.Time `json:"marked_at"`
+}
+
+// StalePrice is a tracked symbol whose last trade is too old to size orders
+// off
+type StalePrice struct {
+	Symbol   string    `json:"symbol"`
+	TradedAt time.Time `json:"traded_at"`
+	Age      string    `json:"age"`
+}
+
+// stale reports whether a price last traded at tradedAt is stale at now.
+// Equity prices only go stale during the regular session; crypto trades
+// around the clock.
+func stale(symbol string, tradedAt, now time.Time, maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	if orders.AssetClassOf(symbol) != orders.AssetClassCrypto && !market.InSession(now) {
+		return false
+	}
+	return now.Sub(tradedAt) > maxAge
+}
+
+// Engine continuously marks the desk's open positions to the latest prices.
+// It is the one price source for unrealized P&L, risk snapshots and price
+// triggers: lookups are served from its marks while they are fresh, so every
+// consumer sees the same price for a symbol. Marks of all open positions are
+// persisted every persistEvery. Watched symbols are marked alongside
+// positions so their first lookup doesn't wait on the price source.
+type Engine struct {
+	db           *database.DB
+	prices       PriceSource
+	interval     time.Duration
+	persistEvery time.Duration
+	retention    time.Duration
+
+	mu          sync.RWMutex
+	marks       map[string]Mark
+	positions   []database.PositionMark
+	watched     []string
+	lastPersist time.Time
+	staleAfter  time.Duration
+	onPersist   func([]database.PositionMark)
+	onRefresh   func([]database.PositionMark)
+}
+
+// NewEngine creates a marking engine. Marks older than twice interval are
+// refreshed on lookup. Persisted marks are kept for retention.
+func NewEngine(db *database.DB, prices PriceSource, interval, persistEvery, retention time.Duration) *Engine {
+	return &Engine{
+		db:           db,
+		prices:       prices,
+		interval:     interval,
+		persistEvery: persistEvery,
+		retention:    retention,
+		marks:        make(map[string]Mark),
+	}
+}
+
+// Run marks positions every interval until ctx is cancelled
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Refresh(); err != nil {
+			log.Printf("Failed to mark positions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh marks every open position and watched symbol to the latest price,
+// and persists the position marks if persistEvery has passed since they
+// were last stored. A position whose symbol can't be priced keeps its
+// previous mark, however old; one that has never been marked is left out.
+func (e *Engine) Refresh() error {
+	_, err := e.refresh(false)
+	return err
+}
+
+// Snapshot marks every open position and persists the marks now, returning
+// the number stored. The close checklist takes one so each session's last
+// marks are at its close.
+func (e *Engine) Snapshot() (int, error) {
+	return e.refresh(true)
+}
+
+func (e *Engine) refresh(force bool) (int, error) {
+	costs, err := e.db.GetOpenPositionCosts()
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.RLock()
+	symbols := slices.Clone(e.watched)
+	e.mu.RUnlock()
+	for _, c := range costs {
+		symbols = append(symbols, c.Symbol)
+	}
+	slices.Sort(symbols)
+	now := time.Now()
+	fresh := e.latest(slices.Compact(symbols), now)
+
+	positions := make([]database.PositionMark, 0, len(costs))
+	for _, c := range costs {
+		mark, ok := fresh[c.Symbol]
+		if !ok {
+			e.mu.RLock()
+			mark, ok = e.marks[c.Symbol]
+			e.mu.RUnlock()
+			if !ok {
+				continue
+			}
+		}
+
+		positions = append(positions, database.PositionMark{
+			MarkedAt:     mark.MarkedAt,
+			UserID:       c.UserID,
+			StrategyID:   c.StrategyID,
+			Symbol:       c.Symbol,
+			Qty:          c.Qty,
+			AvgCost:      c.AvgCost,
+			Price:        mark.Price,
+			MarketValue:  c.Qty.Mul(mark.Price),
+			UnrealizedPL: mark.Price.Sub(c.AvgCost).Mul(c.Qty),
+		})
+	}
+
+	e.mu.Lock()
+	for symbol, mark := range fresh {
+		e.marks[symbol] = mark
+	}
+	e.positions = positions
+	persist := len(positions) > 0 && (force || now.Sub(e.lastPersist) >= e.persistEvery)
+	if persist {
+		e.lastPersist = now
+	}
+	onPersist, onRefresh := e.onPersist, e.onRefresh
+	e.mu.Unlock()
+
+	if onRefresh != nil {
+		onRefresh(positions)
+	}
+
+	if persist {
+		if err := e.db.RecordPositionMarks(positions); err != nil {
+			return 0, err
+		}
+		if onPersist != nil {
+			onPersist(positions)
+		}
+		if e.retention > 0 {
+			if _, err := e.db.DeletePositionMarksBefore(now.Add(-e.retention)); err != nil {
+				return 0, err
+			}
+		}
+		return len(positions), nil
+	}
+	return 0, nil
+}
+
+// latest fetches a new mark of each symbol, in one request if the price
+// source can. If the batch request fails, one symbol the source rejects
+// shouldn't cost the rest their marks, so each is fetched on its own.
+// Symbols that can't be priced are left out.
+func (e *Engine) latest(symbols []string, now time.Time) map[string]Mark {
+	fresh := make(map[string]Mark, len(symbols))
+	if batch, ok := e.prices.(BatchPriceSource); ok && len(symbols) > 1 {
+		trades, err := batch.LatestTrades(symbols)
+		if err == nil {
+			for symbol, trade := range trades {
+				fresh[symbol] = Mark{Price: decimal.NewFromFloat(trade.Price), TradedAt: trade.Timestamp, MarkedAt: now}
+			}
+			return fresh
+		}
+		log.Printf("Failed to mark %d symbols at once, marking each: %v", len(symbols), err)
+	}
+
+	for _, symbol := range symbols {
+		price, tradedAt, err := e.prices.LatestTrade(symbol)
+		if err != nil {
+			log.Printf("Failed to mark %s: %v", symbol, err)
+			continue
+		}
+		fresh[symbol] = Mark{Price: price, TradedAt: tradedAt, MarkedAt: now}
+	}
+	return fresh
+}
+
+// Watch replaces the symbols marked every refresh besides those of open
+// positions
+func (e *Engine) Watch(symbols []string) {
+	watched := slices.Clone(symbols)
+	slices.Sort(watched)
+	e.mu.Lock()
+	e.watched = slices.Compact(watched)
+	e.mu.Unlock()
+}
+
+// Watched returns the number of watched symbols
+func (e *Engine) Watched() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.watched)
+}
+
+// OnPersist sets a function called with every batch of marks after it is
+// stored. It must not block.
+func (e *Engine) OnPersist(fn func([]database.PositionMark)) {
+	e.mu.Lock()
+	e.onPersist = fn
+	e.mu.Unlock()
+}
+
+// OnRefresh sets a function called with the open positions after every
+// refresh, e.g. to check them against alert thresholds. It must not block.
+func (e *Engine) OnRefresh(fn func([]database.PositionMark)) {
+	e.mu.Lock()
+	e.onRefresh = fn
+	e.mu.Unlock()
+}
+
+// Mark returns the last mark of symbol if it is still fresh
+func (e *Engine) Mark(symbol string) (Mark, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	mark, ok := e.marks[symbol]
+	if !ok || time.Since(mark.MarkedAt) > 2*e.interval {
+		return Mark{}, false
+	}
+	return mark, true
+}
+
+// MarkPrice returns the fresh mark price of symbol, if there is one
+func (e *Engine) MarkPrice(symbol string) (decimal.Decimal, bool) {
+	mark, ok := e.Mark(symbol)
+	return mark.Price, ok
+}
+
+// Quote returns the fresh mark of symbol, fetching and recording a new mark
+// if there isn't one
+func (e *Engine) Quote(symbol string) (Mark, error) {
+	if mark, ok := e.Mark(symbol); ok {
+		return mark, nil
+	}
+
+	price, tradedAt, err := e.prices.LatestTrade(symbol)
+	if err != nil {
+		return Mark{}, err
+	}
+
+	mark := Mark{Price: price, TradedAt: tradedAt, MarkedAt: time.Now()}
+	e.mu.Lock()
+	e.marks[symbol] = mark
+	e.mu.Unlock()
+	return mark, nil
+}
+
+// LatestPrice returns the price of symbol's fresh mark, fetching a new mark
+// if there isn't one
+func (e *Engine) LatestPrice(symbol string) (decimal.Decimal, error) {
+	mark, err := e.Quote(symbol)
+	return mark.Price, err
+}
+
+// StaleAfter returns how old a symbol's last trade may be before its price
+// is stale
+func (e *Engine) StaleAfter() time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.staleAfter
+}
+
+// SetStaleAfter changes how old a price may be before it is stale; zero
+// turns staleness detection off
+func (e *Engine) SetStaleAfter(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.staleAfter = d
+}
+
+// PriceAge returns how long ago symbol last traded and whether its price is
+// stale, fetching a new mark if there isn't a fresh one
+func (e *Engine) PriceAge(symbol string, now time.Time) (time.Duration, bool, error) {
+	mark, err := e.Quote(symbol)
+	if err != nil {
+		return 0, false, err
+	}
+	return now.Sub(mark.TradedAt), stale(symbol, mark.TradedAt, now, e.StaleAfter()), nil
+}
+
+// StalePrices lists the symbols of open positions whose last trade is
+// stale, oldest first
+func (e *Engine) StalePrices() []StalePrice {
+	now := time.Now()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := []StalePrice{}
+	seen := make(map[string]bool)
+	for _, p := range e.positions {
+		if seen[p.Symbol] {
+			continue
+		}
+		seen[p.Symbol] = true
+		mark := e.marks[p.Symbol]
+		if stale(p.Symbol, mark.TradedAt, now, e.staleAfter) {
+			out = append(out, StalePrice{
+				Symbol:   p.Symbol,
+				TradedAt: mark.TradedAt,
+				Age:      now.Sub(mark.TradedAt).Round(time.Second).String(),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TradedAt.Before(out[j].TradedAt) })
+	return out
+}
+
+// Tracked returns the number of symbols with a mark
+func (e *Engine) Tracked() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.marks)
+}
+
+// Positions returns the open positions as of the last refresh, optionally
+// only userID's
+func (e *Engine) Positions(userID string) []database.PositionMark {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	positions := []database.PositionMark{}
+	for _, p := range e.positions {
+		if userID == "" || p.UserID == userID {
+			positions = append(positions, p)
+		}
+	}
+	return positions
+}
@@ -0,0 +1,143 @@
+package mktdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+const polygonBaseURL = "https://api.polygon.io"
+
+// polygonTimespans maps the desk's timeframes to Polygon aggregate ranges
+var polygonTimespans = map[string]string{
+	"1Min":  "minute",
+	"1Hour": "hour",
+	"1Day":  "day",
+}
+
+// PolygonClient serves consolidated (SIP) prices and history from Polygon's
+// REST API. Latest trades need a plan that includes trades.
+type PolygonClient struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewPolygon(apiKey string, client *http.Client) *PolygonClient {
+	return &PolygonClient{
+		baseURL: polygonBaseURL,
+		apiKey:  apiKey,
+		client:  client,
+	}
+}
+
+// polygonAgg is one aggregate bar; t is its start in Unix milliseconds
+type polygonAgg struct {
+	Open       float64 `json:"o"`
+	High       float64 `json:"h"`
+	Low        float64 `json:"l"`
+	Close      float64 `json:"c"`
+	Volume     float64 `json:"v"`
+	VWAP       float64 `json:"vw"`
+	TradeCount uint64  `json:"n"`
+	Timestamp  int64   `json:"t"`
+}
+
+func (p *PolygonClient) LatestPrice(symbol string) (decimal.Decimal, error) {
+	price, _, err := p.LatestTrade(symbol)
+	return price, err
+}
+
+func (p *PolygonClient) LatestTrade(symbol string) (decimal.Decimal, time.Time, error) {
+	var resp struct {
+		Results struct {
+			Price     float64 `json:"p"`
+			Timestamp int64   `json:"t"`
+		} `json:"results"`
+	}
+	if err := p.get(p.baseURL+"/v2/last/trade/"+url.PathEscape(symbol), &resp); err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+	if resp.Results.Timestamp == 0 {
+		return decimal.Zero, time.Time{}, fmt.Errorf("polygon: no trades in %s", symbol)
+	}
+	return decimal.NewFromFloat(resp.Results.Price), time.Unix(0, resp.Results.Timestamp), nil
+}
+
+func (p *PolygonClient) RecentCloses(symbol, timeframe string, n int) ([]decimal.Decimal, error) {
+	return recentCloses(p, symbol, timeframe, n)
+}
+
+// Bars pages through Polygon's split-adjusted aggregates. A limit of 0 is
+// no limit.
+func (p *PolygonClient) Bars(symbol, timeframe string, start, end time.Time, limit int) ([]marketdata.Bar, error) {
+	timespan, ok := polygonTimespans[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+
+	next := fmt.Sprintf("%s/v2/aggs/ticker/%s/range/1/%s/%d/%d?adjusted=true&sort=asc&limit=50000",
+		p.baseURL, url.PathEscape(symbol), timespan, start.UnixMilli(), end.UnixMilli())
+	var bars []marketdata.Bar
+	for next != "" && (limit == 0 || len(bars) < limit) {
+		var page struct {
+			Results []polygonAgg `json:"results"`
+			NextURL string       `json:"next_url"`
+		}
+		if err := p.get(next, &page); err != nil {
+			return nil, err
+		}
+		for _, a := range page.Results {
+			bars = append(bars, marketdata.Bar{
+				Timestamp:  time.UnixMilli(a.Timestamp).UTC(),
+				Open:       a.Open,
+				High:       a.High,
+				Low:        a.Low,
+				Close:      a.Close,
+				Volume:     uint64(a.Volume),
+				TradeCount: a.TradeCount,
+				VWAP:       a.VWAP,
+			})
+		}
+		next = page.NextURL
+	}
+
+	if limit > 0 && len(bars) > limit {
+		bars = bars[:limit]
+	}
+	return bars, nil
+}
+
+func (p *PolygonClient) DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error) {
+	return dailyBars(p, symbols, since)
+}
+
+// get fetches a Polygon URL and decodes its JSON body into dest
+func (p *PolygonClient) get(u string, dest any) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("polygon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("polygon: %s: %s", resp.Status, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("polygon: invalid response: %w", err)
+	}
+	return nil
+}
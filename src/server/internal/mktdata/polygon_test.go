@@ -0,0 +1,130 @@
+package mktdata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// polygonServer serves Polygon's REST API from handler, counting requests
+func polygonServer(t *testing.T, handler http.HandlerFunc) (*PolygonClient, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q, want the API key", got)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	p := NewPolygon("test-key", srv.Client())
+	p.baseURL = srv.URL
+	return p, &requests
+}
+
+func TestPolygonBarsPaginates(t *testing.T) {
+	start := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	end := start.Add(3 * time.Minute)
+
+	var p *PolygonClient
+	p, requests := polygonServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/aggs/ticker/AAPL/range/1/minute/1772461800000/1772461980000":
+			if q := r.URL.Query(); q.Get("adjusted") != "true" || q.Get("sort") != "asc" {
+				t.Errorf("query = %s, want adjusted bars oldest first", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"results": [
+				{"o": 189.1, "h": 189.5, "l": 189.0, "c": 189.4, "v": 12000, "vw": 189.3, "n": 140, "t": 1772461800000},
+				{"o": 189.4, "h": 189.9, "l": 189.2, "c": 189.8, "v": 9000.0, "vw": 189.6, "n": 95, "t": 1772461860000}
+			], "next_url": "` + p.baseURL + `/v2/aggs/next-page"}`))
+		case "/v2/aggs/next-page":
+			w.Write([]byte(`{"results": [{"o": 189.8, "h": 190.0, "l": 189.7, "c": 189.9, "v": 7000, "vw": 189.85, "n": 80, "t": 1772461920000}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	})
+
+	bars, err := p.Bars("AAPL", "1Min", start, end, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 3 || *requests != 2 {
+		t.Fatalf("got %d bars in %d requests, want 3 in 2", len(bars), *requests)
+	}
+	first := bars[0]
+	if !first.Timestamp.Equal(start) || first.Open != 189.1 || first.Close != 189.4 || first.Volume != 12000 || first.VWAP != 189.3 || first.TradeCount != 140 {
+		t.Errorf("first bar = %+v", first)
+	}
+	if !bars[2].Timestamp.Equal(start.Add(2*time.Minute)) || bars[2].Close != 189.9 {
+		t.Errorf("last bar = %+v, from the second page", bars[2])
+	}
+
+	// A limit reached on the first page doesn't fetch the next one
+	*requests = 0
+	bars, err = p.Bars("AAPL", "1Min", start, end, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 1 || *requests != 1 {
+		t.Errorf("got %d bars in %d requests with limit 1, want 1 in 1", len(bars), *requests)
+	}
+}
+
+func TestPolygonLatestTrade(t *testing.T) {
+	p, _ := polygonServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/last/trade/AAPL":
+			w.Write([]byte(`{"results": {"p": 189.52, "t": 1772461800123456789}}`))
+		case "/v2/last/trade/NONE":
+			w.Write([]byte(`{"results": {}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	price, at, err := p.LatestTrade("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.String() != "189.52" || !at.Equal(time.Unix(0, 1772461800123456789)) {
+		t.Errorf("latest trade = %s at %s", price, at)
+	}
+	if _, _, err := p.LatestTrade("NONE"); err == nil || !strings.Contains(err.Error(), "no trades") {
+		t.Errorf("latest trade without trades: %v, want no trades", err)
+	}
+}
+
+func TestPolygonErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"not entitled", http.StatusForbidden, `{"status": "NOT_AUTHORIZED", "message": "upgrade your plan"}`, "403 Forbidden"},
+		{"rate limited", http.StatusTooManyRequests, `{"status": "ERROR"}`, "429 Too Many Requests"},
+		{"server error", http.StatusInternalServerError, "oops", "500 Internal Server Error: oops"},
+		{"invalid JSON", http.StatusOK, "<html>", "invalid response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := polygonServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := p.Bars("AAPL", "1Day", time.Now().AddDate(0, 0, -5), time.Now(), 0)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Bars = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	p, requests := polygonServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := p.Bars("AAPL", "5Min", time.Now().Add(-time.Hour), time.Now(), 0); err == nil || *requests != 0 {
+		t.Errorf("Bars with an unsupported timeframe = %v after %d requests, want an error before any", err, *requests)
+	}
+}
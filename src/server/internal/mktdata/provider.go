@@ -0,0 +1,200 @@
+// Package mktdata lets each use of market data pick where it comes from, so
+// the desk isn't limited to what its Alpaca account is entitled to. Live
+// trading needs real-time prices, backtests need deep history and the
+// dashboard can make do with delayed data; a provider is chosen for each.
+//
+// Bars are returned as Alpaca's marketdata.Bar whichever provider serves
+// them, since that is the desk's bar type everywhere else. Streams (halts,
+// the time-series exporter) and news stay on Alpaca.
+package mktdata
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/alpaca"
+)
+
+// Provider names
+const (
+	Alpaca  = "alpaca"
+	Polygon = "polygon"
+	Yahoo   = "yahoo"
+)
+
+// Use cases a provider is selected for
+const (
+	// UseLive prices orders and positions: marks, sizing, the simulator and
+	// the pre-open data feed check
+	UseLive = "live"
+	// UseBacktest serves historical bars to notebooks and backtests
+	UseBacktest = "backtest"
+	// UseDashboard serves indicators and the screener
+	UseDashboard = "dashboard"
+)
+
+// Provider is a source of prices and bars. Timeframes are 1Min, 1Hour and
+// 1Day, and bars are split-adjusted and oldest first.
+type Provider interface {
+	// LatestPrice returns the price of the most recent trade in symbol
+	LatestPrice(symbol string) (decimal.Decimal, error)
+	// LatestTrade returns the price and time of the most recent trade
+	LatestTrade(symbol string) (decimal.Decimal, time.Time, error)
+	// RecentCloses returns up to n of the most recent bar closes
+	RecentCloses(symbol, timeframe string, n int) ([]decimal.Decimal, error)
+	// Bars returns bars between start and end, at most limit of them
+	Bars(symbol, timeframe string, start, end time.Time, limit int) ([]marketdata.Bar, error)
+	// DailyBars returns daily bars since the given time for each symbol
+	DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error)
+}
+
+// errDelayed rejects a delayed provider for live trading
+var errDelayed = errors.New("serves delayed prices and can't be used for live trading")
+
+// SupportedTimeframe reports whether every provider serves timeframe
+func SupportedTimeframe(timeframe string) bool {
+	return alpaca.SupportedTimeframe(timeframe)
+}
+
+// Config holds what the providers need to connect
+type Config struct {
+	Alpaca        *alpaca.DataClient
+	PolygonAPIKey string
+}
+
+// Selection is the provider chosen for each use case
+type Selection struct {
+	Live      Provider
+	Backtest  Provider
+	Dashboard Provider
+	// Names maps each use case to its provider's name
+	Names map[string]string
+}
+
+// Select opens the named provider for each use case; an empty name is
+// Alpaca. Uses that name the same provider share one client.
+func Select(live, backtest, dashboard string, cfg Config) (*Selection, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	opened := make(map[string]Provider)
+	open := func(use, name string) (Provider, error) {
+		if name == "" {
+			name = Alpaca
+		}
+		if use == UseLive && name == Yahoo {
+			return nil, fmt.Errorf("%s market data: %s %w", use, name, errDelayed)
+		}
+		if p, ok := opened[name]; ok {
+			return p, nil
+		}
+
+		var p Provider
+		switch name {
+		case Alpaca:
+			p = cfg.Alpaca
+		case Polygon:
+			if cfg.PolygonAPIKey == "" {
+				return nil, fmt.Errorf("%s market data: polygon needs an API key", use)
+			}
+			p = NewPolygon(cfg.PolygonAPIKey, client)
+		case Yahoo:
+			p = NewYahoo(client)
+		default:
+			return nil, fmt.Errorf("%s market data: unknown provider %q, want alpaca, polygon or yahoo", use, name)
+		}
+		opened[name] = p
+		return p, nil
+	}
+
+	s := &Selection{Names: make(map[string]string)}
+	for _, use := range []struct {
+		name, provider string
+		dest           *Provider
+	}{
+		{UseLive, live, &s.Live},
+		{UseBacktest, backtest, &s.Backtest},
+		{UseDashboard, dashboard, &s.Dashboard},
+	} {
+		p, err := open(use.name, use.provider)
+		if err != nil {
+			return nil, err
+		}
+		*use.dest = p
+		s.Names[use.name] = use.provider
+		if use.provider == "" {
+			s.Names[use.name] = Alpaca
+		}
+	}
+
+	log.Printf("Market data: live from %s, backtests from %s, dashboard from %s",
+		s.Names[UseLive], s.Names[UseBacktest], s.Names[UseDashboard])
+	return s, nil
+}
+
+// CheckName reports whether name is a provider that can serve use
+func CheckName(use, name string) error {
+	switch name {
+	case Alpaca, Polygon:
+		return nil
+	case Yahoo:
+		if use == UseLive {
+			return fmt.Errorf("%s %w", name, errDelayed)
+		}
+		return nil
+	}
+	return fmt.Errorf("want alpaca, polygon or yahoo")
+}
+
+// barSpans are the length of each timeframe's bar, and how far back to
+// search for recent bars at least, long enough to span weekends and holidays
+var barSpans = map[string]struct {
+	perBar  time.Duration
+	minimum time.Duration
+}{
+	"1Min":  {time.Minute, 5 * 24 * time.Hour},
+	"1Hour": {time.Hour, 10 * 24 * time.Hour},
+	"1Day":  {24 * time.Hour, 30 * 24 * time.Hour},
+}
+
+// recentCloses returns up to n of the most recent closes of bars fetched by
+// providers without a newest-first query. Bars only exist while the market
+// is open, so it searches back about twice as far as n bars would take.
+func recentCloses(p Provider, symbol, timeframe string, n int) ([]decimal.Decimal, error) {
+	span, ok := barSpans[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+	lookback := max(span.minimum, 2*time.Duration(n)*span.perBar)
+	bars, err := p.Bars(symbol, timeframe, time.Now().Add(-lookback), time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	bars = bars[max(0, len(bars)-n):]
+	closes := make([]decimal.Decimal, len(bars))
+	for i, bar := range bars {
+		closes[i] = decimal.NewFromFloat(bar.Close)
+	}
+	return closes, nil
+}
+
+// dailyBars fetches each symbol's daily bars in turn, for providers without
+// a multi-symbol query. Symbols with no bars are left out.
+func dailyBars(p Provider, symbols []string, since time.Time) (map[string][]marketdata.Bar, error) {
+	out := make(map[string][]marketdata.Bar, len(symbols))
+	for _, symbol := range symbols {
+		bars, err := p.Bars(symbol, "1Day", since, time.Now(), 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daily bars for %s: %w", symbol, err)
+		}
+		if len(bars) > 0 {
+			out[symbol] = bars
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package mktdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+const yahooBaseURL = "https://query1.finance.yahoo.com"
+
+// yahooIntervals maps the desk's timeframes to Yahoo chart intervals
+var yahooIntervals = map[string]string{
+	"1Min":  "1m",
+	"1Hour": "60m",
+	"1Day":  "1d",
+}
+
+// YahooClient serves free, delayed prices and history from Yahoo Finance's
+// chart API. It needs no key, but prices can be 15 minutes old, minute bars
+// only go back about a month, and bars carry no VWAP or trade count.
+type YahooClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewYahoo(client *http.Client) *YahooClient {
+	return &YahooClient{
+		baseURL: yahooBaseURL,
+		client:  client,
+	}
+}
+
+// yahooChart is a chart response. Quote values are null for intervals
+// without trades.
+type yahooChart struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				RegularMarketPrice float64 `json:"regularMarketPrice"`
+				RegularMarketTime  int64   `json:"regularMarketTime"`
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Open   []*float64 `json:"open"`
+					High   []*float64 `json:"high"`
+					Low    []*float64 `json:"low"`
+					Close  []*float64 `json:"close"`
+					Volume []*float64 `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+func (y *YahooClient) LatestPrice(symbol string) (decimal.Decimal, error) {
+	price, _, err := y.LatestTrade(symbol)
+	return price, err
+}
+
+func (y *YahooClient) LatestTrade(symbol string) (decimal.Decimal, time.Time, error) {
+	chart, err := y.chart(symbol, url.Values{"range": {"1d"}, "interval": {"1m"}})
+	if err != nil {
+		return decimal.Zero, time.Time{}, err
+	}
+	meta := chart.Chart.Result[0].Meta
+	if meta.RegularMarketTime == 0 {
+		return decimal.Zero, time.Time{}, fmt.Errorf("yahoo: no trades in %s", symbol)
+	}
+	return decimal.NewFromFloat(meta.RegularMarketPrice), time.Unix(meta.RegularMarketTime, 0), nil
+}
+
+func (y *YahooClient) RecentCloses(symbol, timeframe string, n int) ([]decimal.Decimal, error) {
+	return recentCloses(y, symbol, timeframe, n)
+}
+
+// Bars returns Yahoo's split-adjusted bars, skipping intervals without
+// trades. A limit of 0 is no limit.
+func (y *YahooClient) Bars(symbol, timeframe string, start, end time.Time, limit int) ([]marketdata.Bar, error) {
+	interval, ok := yahooIntervals[timeframe]
+	if !ok {
+		return nil, fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+	chart, err := y.chart(symbol, url.Values{
+		"period1":  {strconv.FormatInt(start.Unix(), 10)},
+		"period2":  {strconv.FormatInt(end.Unix(), 10)},
+		"interval": {interval},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := chart.Chart.Result[0]
+	if len(result.Indicators.Quote) == 0 {
+		return nil, nil
+	}
+	q := result.Indicators.Quote[0]
+	var bars []marketdata.Bar
+	for i, ts := range result.Timestamp {
+		open, high, low, closePrice := valueAt(q.Open, i), valueAt(q.High, i), valueAt(q.Low, i), valueAt(q.Close, i)
+		if open == nil || high == nil || low == nil || closePrice == nil {
+			continue
+		}
+		bar := marketdata.Bar{
+			Timestamp: time.Unix(ts, 0).UTC(),
+			Open:      *open,
+			High:      *high,
+			Low:       *low,
+			Close:     *closePrice,
+		}
+		if volume := valueAt(q.Volume, i); volume != nil {
+			bar.Volume = uint64(*volume)
+		}
+		bars = append(bars, bar)
+		if limit > 0 && len(bars) == limit {
+			break
+		}
+	}
+	return bars, nil
+}
+
+// valueAt returns a quote series' value at i, or nil if it has none
+func valueAt(values []*float64, i int) *float64 {
+	if i >= len(values) {
+		return nil
+	}
+	return values[i]
+}
+
+func (y *YahooClient) DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error) {
+	return dailyBars(y, symbols, since)
+}
+
+// chart fetches a symbol's chart with the given query
+func (y *YahooClient) chart(symbol string, query url.Values) (*yahooChart, error) {
+	u := y.baseURL + "/v8/finance/chart/" + url.PathEscape(symbol) + "?" + query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Yahoo refuses requests without a browser-like user agent
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; trading-desk)")
+
+	resp, err := y.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("yahoo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var chart yahooChart
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if json.Unmarshal(body, &chart) == nil && chart.Chart.Error != nil {
+			return nil, fmt.Errorf("yahoo: %s: %s", chart.Chart.Error.Code, chart.Chart.Error.Description)
+		}
+		return nil, fmt.Errorf("yahoo: %s: %s", resp.Status, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&chart); err != nil {
+		return nil, fmt.Errorf("yahoo: invalid response: %w", err)
+	}
+	if len(chart.Chart.Result) == 0 {
+		return nil, fmt.Errorf("yahoo: no chart for %s", symbol)
+	}
+	return &chart, nil
+}
@@ -0,0 +1,120 @@
+package mktdata
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// yahooServer serves Yahoo's chart API from handler
+func yahooServer(t *testing.T, handler http.HandlerFunc) *YahooClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			t.Error("request has no User-Agent, which Yahoo refuses")
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	y := NewYahoo(srv.Client())
+	y.baseURL = srv.URL
+	return y
+}
+
+func TestYahooBars(t *testing.T) {
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 4)
+	y := yahooServer(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		bars := q.Get("interval") == "1d" && q.Get("period1") == "1772409600" && q.Get("period2") == "1772755200"
+		latest := q.Get("interval") == "1m" && q.Get("range") == "1d"
+		if r.URL.Path != "/v8/finance/chart/AAPL" || !bars && !latest {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		// The second interval had no trades, and the third no volume
+		w.Write([]byte(`{"chart": {"result": [{
+			"meta": {"regularMarketPrice": 190.1, "regularMarketTime": 1772740800},
+			"timestamp": [1772461800, 1772548200, 1772634600, 1772721000],
+			"indicators": {"quote": [{
+				"open":   [189.1, null, 190.2, 191.0],
+				"high":   [190.0, null, 191.5, 191.8],
+				"low":    [188.5, null, 189.9, 190.4],
+				"close":  [189.8, null, 191.1, 190.9],
+				"volume": [51000000, null, null, 48000000]
+			}]}
+		}], "error": null}}`))
+	})
+
+	bars, err := y.Bars("AAPL", "1Day", start, end, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 3 {
+		t.Fatalf("got %d bars, want 3 without the empty interval: %+v", len(bars), bars)
+	}
+	if !bars[0].Timestamp.Equal(time.Unix(1772461800, 0)) || bars[0].Open != 189.1 || bars[0].Close != 189.8 || bars[0].Volume != 51000000 {
+		t.Errorf("first bar = %+v", bars[0])
+	}
+	if !bars[1].Timestamp.Equal(time.Unix(1772634600, 0)) || bars[1].Volume != 0 {
+		t.Errorf("bar without volume = %+v", bars[1])
+	}
+
+	bars, err = y.Bars("AAPL", "1Day", start, end, 2)
+	if err != nil || len(bars) != 2 {
+		t.Errorf("Bars with limit 2 = %d bars, %v", len(bars), err)
+	}
+
+	price, at, err := y.LatestTrade("AAPL")
+	if err != nil || price.String() != "190.1" || !at.Equal(time.Unix(1772740800, 0)) {
+		t.Errorf("latest trade = %s at %s, %v", price, at, err)
+	}
+}
+
+func TestYahooErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"chart error", http.StatusNotFound, `{"chart": {"result": null, "error": {"code": "Not Found", "description": "No data found, symbol may be delisted"}}}`, "Not Found: No data found"},
+		{"plain error", http.StatusTooManyRequests, "Too Many Requests", "429 Too Many Requests"},
+		{"no result", http.StatusOK, `{"chart": {"result": [], "error": null}}`, "no chart for AAPL"},
+		{"invalid JSON", http.StatusOK, "<html>", "invalid response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y := yahooServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := y.Bars("AAPL", "1Day", time.Now().AddDate(0, 0, -5), time.Now(), 0)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Bars = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestYahooRejectedForLive(t *testing.T) {
+	if _, err := Select(Yahoo, "", "", Config{}); !errors.Is(err, errDelayed) {
+		t.Errorf("Select with live yahoo = %v, want errDelayed", err)
+	}
+	if err := CheckName(UseLive, Yahoo); !errors.Is(err, errDelayed) {
+		t.Errorf("CheckName(live, yahoo) = %v, want errDelayed", err)
+	}
+
+	s, err := Select(Alpaca, Yahoo, Yahoo, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Backtest.(*YahooClient); !ok || s.Backtest != s.Dashboard {
+		t.Errorf("backtest and dashboard = %T and %T, want one shared Yahoo client", s.Backtest, s.Dashboard)
+	}
+	if err := CheckName(UseDashboard, Yahoo); err != nil {
+		t.Errorf("CheckName(dashboard, yahoo) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,100 @@
+package netting
+
+import (
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+)
+
+// allocate nets signals in one symbol. It returns the side and quantity of
+// the net order (side is "" when they offset exactly) and the gross quantity
+// asked for, and sets each signal's crossed and routed quantities: signals
+// on the smaller side are crossed in full, and the larger side's signals
+// share the crossed quantity in proportion to their size, routing the rest
+// to the net order.
+func allocate(signals []database.NettingSignal) (string, decimal.Decimal, decimal.Decimal) {
+	buys, sells := decimal.Zero, decimal.Zero
+	for _, s := range signals {
+		if s.Side == "buy" {
+			buys = buys.Add(s.Qty)
+		} else {
+			sells = sells.Add(s.Qty)
+		}
+	}
+
+	side, crossed := "", buys
+	switch {
+	case buys.GreaterThan(sells):
+		side, crossed = "buy", sells
+	case sells.GreaterThan(buys):
+		side, crossed = "sell", buys
+	}
+
+	var weights []decimal.Decimal
+	var larger []int
+	for i := range signals {
+		s := &signals[i]
+		if s.Side != side {
+			s.CrossedQty, s.RoutedQty = s.Qty, decimal.Zero
+			continue
+		}
+		larger = append(larger, i)
+		weights = append(weights, s.Qty)
+	}
+	for j, share := range prorate(crossed, weights) {
+		s := &signals[larger[j]]
+		s.CrossedQty, s.RoutedQty = share, s.Qty.Sub(share)
+	}
+
+	return side, buys.Sub(sells).Abs(), buys.Add(sells)
+}
+
+// fill sets each signal's filled quantity once filled of the net order on
+// side has filled. Routed quantities share the fill in proportion; crossed
+// quantities fill in full as long as there is a price to book them at.
+func fill(signals []database.NettingSignal, side string, filled decimal.Decimal, priced bool) {
+	var weights []decimal.Decimal
+	var routed []int
+	for i := range signals {
+		s := &signals[i]
+		s.FilledQty = decimal.Zero
+		if priced {
+			s.FilledQty = s.CrossedQty
+		}
+		if s.Side == side && s.RoutedQty.IsPositive() {
+			routed = append(routed, i)
+			weights = append(weights, s.RoutedQty)
+		}
+	}
+	if !priced {
+		return
+	}
+	for j, share := range prorate(filled, weights) {
+		s := &signals[routed[j]]
+		s.FilledQty = s.FilledQty.Add(share)
+	}
+}
+
+// prorate splits total in proportion to weights, rounding down to qtyPlaces
+// and giving the remainder to the last share so the shares add up to total
+func prorate(total decimal.Decimal, weights []decimal.Decimal) []decimal.Decimal {
+	sum := decimal.Zero
+	for _, w := range weights {
+		sum = sum.Add(w)
+	}
+	shares := make([]decimal.Decimal, len(weights))
+	if !sum.IsPositive() {
+		return shares
+	}
+
+	left := total
+	for i, w := range weights {
+		if i == len(weights)-1 {
+			shares[i] = left
+			break
+		}
+		shares[i] = total.Mul(w).Div(sum).Truncate(qtyPlaces)
+		left = left.Sub(shares[i])
+	}
+	return shares
+}
@@ -0,0 +1,330 @@
+package netting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/notify"
+	"desk/internal/orders"
+)
+
+const (
+	// pollInterval is how often a net order is checked until it fills
+	pollInterval = 250 * time.Millisecond
+	// cancelWait is how long a net order that didn't fill in time is given
+	// to confirm its cancellation
+	cancelWait = 5 * time.Second
+	// qtyPlaces is the precision of allocated quantities, Alpaca's for
+	// fractional shares
+	qtyPlaces = 9
+)
+
+// ErrClosed is returned for signals added while the netter shuts down
+var ErrClosed = errors.New("netting is shutting down")
+
+// PlaceFunc sends an order to the broker
+type PlaceFunc func(order *orders.Order) (*alpaca.Order, error)
+
+// Broker tracks net orders once they are placed
+type Broker interface {
+	GetOrder(orderID string) (*alpaca.Order, error)
+	CancelOrder(orderID string) error
+}
+
+// Prices prices signals that offset exactly, when no order is sent
+type Prices interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// Eligible reports whether an order can be netted: only market DAY equity
+// orders can be combined without changing what each strategy asked for
+func Eligible(order *orders.Order) bool {
+	return order.Type == "market" && order.TimeInForce == "day" && order.AssetClass == orders.AssetClassEquity
+}
+
+// Netter holds strategies' market orders for a short window and sends one
+// order per symbol for their net quantity, so strategies trading against
+// each other don't pay to cross the spread twice. Buys and sells that
+// offset are crossed internally; each strategy is booked a trade for its
+// share at the net order's fill price, and its contribution is recorded in
+// netting_signals.
+type Netter struct {
+	db          *database.DB
+	place       PlaceFunc
+	broker      Broker
+	prices      Prices
+	notifier    notify.Notifier
+	window      time.Duration
+	fillTimeout time.Duration
+	onTrade     func(database.Trade)
+
+	mu      sync.Mutex
+	open    map[string]*batch
+	closed  bool
+	pending sync.WaitGroup
+}
+
+// batch is the signals in one symbol waiting for their window to close
+type batch struct {
+	openedAt time.Time
+	signals  []database.NettingSignal
+	timer    *time.Timer
+	// sentAt and ackedAt are when the net order went to the broker and
+	// when the broker acknowledged it
+	sentAt  *time.Time
+	ackedAt *time.Time
+}
+
+func NewNetter(db *database.DB, place PlaceFunc, broker Broker, prices Prices, notifier notify.Notifier, window, fillTimeout time.Duration) *Netter {
+	return &Netter{
+		db:          db,
+		place:       place,
+		broker:      broker,
+		prices:      prices,
+		notifier:    notifier,
+		window:      window,
+		fillTimeout: fillTimeout,
+		open:        make(map[string]*batch),
+	}
+}
+
+// OnTrade registers a function called with each trade booked for a signal
+func (n *Netter) OnTrade(fn func(database.Trade)) {
+	n.onTrade = fn
+}
+
+// Recover fails signals left pending by a previous run, which were never
+// sent
+func (n *Netter) Recover() error {
+	failed, err := n.db.FailPendingNettingSignals("desk stopped before the signal was netted")
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("Failed %d netting signals left pending by the last run", failed)
+		notify.Send(context.Background(), n.notifier, notify.LevelWarning, "Netting signals dropped",
+			fmt.Sprintf("%d netting signals were pending when the desk stopped and were not sent", failed))
+	}
+	return nil
+}
+
+// Add stores a signal and holds it until its symbol's window closes. It
+// returns the stored signal and when its batch will be sent. A signal's
+// CreatedAt is when its order was received, or now if it isn't set.
+func (n *Netter) Add(s database.NettingSignal) (*database.NettingSignal, time.Time, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, time.Time{}, ErrClosed
+	}
+
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = clock.Now()
+	}
+	s.Status = database.SignalPending
+	id, err := n.db.CreateNettingSignal(&s)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	s.ID = id
+
+	b, ok := n.open[s.Symbol]
+	if !ok {
+		b = &batch{openedAt: s.CreatedAt}
+		symbol := s.Symbol
+		b.timer = time.AfterFunc(n.window, func() { n.flush(symbol) })
+		n.open[symbol] = b
+		n.pending.Add(1)
+	}
+	b.signals = append(b.signals, s)
+	return &s, b.openedAt.Add(n.window), nil
+}
+
+// Run sends open batches immediately once ctx is cancelled and waits for
+// every batch to settle
+func (n *Netter) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	n.mu.Lock()
+	n.closed = true
+	var symbols []string
+	for symbol, b := range n.open {
+		if b.timer.Stop() {
+			symbols = append(symbols, symbol)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, symbol := range symbols {
+		go n.flush(symbol)
+	}
+	n.pending.Wait()
+}
+
+// flush closes a symbol's window and settles its batch
+func (n *Netter) flush(symbol string) {
+	defer n.pending.Done()
+
+	n.mu.Lock()
+	b := n.open[symbol]
+	delete(n.open, symbol)
+	n.mu.Unlock()
+
+	if err := n.settle(symbol, b); err != nil {
+		log.Printf("Failed to settle netting batch in %s: %v", symbol, err)
+		notify.Send(context.Background(), n.notifier, notify.LevelError, "Netting failed",
+			fmt.Sprintf("%d signals in %s: %v", len(b.signals), symbol, err))
+	}
+}
+
+// settle sends a batch's net order, allocates the fill and books a trade
+// for every signal
+func (n *Netter) settle(symbol string, b *batch) error {
+	result := database.NettingBatch{Symbol: symbol, OpenedAt: b.openedAt, Signals: b.signals}
+	result.Side, result.NetQty, result.GrossQty = allocate(result.Signals)
+
+	var price *decimal.Decimal
+	var orderErr error
+	var clientOrderID string
+	if result.Side != "" {
+		clientOrderID = orders.NewID(clock.Now())
+		o, err := n.execute(b, &orders.Order{
+			Symbol:      symbol,
+			AssetClass:  orders.AssetClassEquity,
+			Side:        result.Side,
+			Type:        "market",
+			TimeInForce: "day",
+			Qty:         result.NetQty,
+			// Every strategy's trade carries the net order's client ID
+			ClientOrderID: clientOrderID,
+		})
+		if o != nil {
+			result.OrderID = &o.ID
+			result.FilledQty = o.FilledQty
+			if o.FilledQty.IsPositive() {
+				price = o.FilledAvgPrice
+			}
+		}
+		orderErr = err
+	}
+	if price == nil {
+		// Nothing filled at the broker, so the crossed quantity trades at
+		// the last price
+		p, err := n.prices.LatestPrice(symbol)
+		if err != nil {
+			orderErr = errors.Join(orderErr, fmt.Errorf("no price to cross at: %w", err))
+		} else {
+			price = &p
+		}
+	}
+	if orderErr != nil {
+		msg := orderErr.Error()
+		result.ErrorMessage = &msg
+	}
+	result.Price = price
+	fill(result.Signals, result.Side, result.FilledQty, price != nil)
+
+	now := clock.Now()
+	result.CompletedAt = now
+	trades := make([]database.Trade, len(result.Signals))
+	for i, s := range result.Signals {
+		strategyID := s.StrategyID
+		trades[i] = database.Trade{
+			StrategyID:      &strategyID,
+			StrategyVersion: s.StrategyVersion,
+			UserID:          s.UserID,
+			Symbol:          symbol,
+			Qty:             s.Qty,
+			Side:            s.Side,
+			OrderType:       "market",
+			TimeInForce:     "day",
+			FilledQty:       s.FilledQty,
+			OrderStatus:     "filled",
+			SubmittedAt:     s.CreatedAt,
+			Venue:           database.VenueNetted,
+			ReceivedAt:      &s.CreatedAt,
+			SentAt:          b.sentAt,
+			AckedAt:         b.ackedAt,
+			ClientOrderID:   clientOrderID,
+			Source:          orders.SourceAlgo,
+		}
+		switch {
+		case s.FilledQty.IsZero() && orderErr != nil:
+			trades[i].OrderStatus = orders.StatusRejected
+		case !s.FilledQty.Equal(s.Qty):
+			trades[i].OrderStatus = "canceled"
+		}
+		if s.FilledQty.IsPositive() {
+			trades[i].FilledAvgPrice = price
+			trades[i].FilledAt = &now
+		}
+		if trades[i].OrderStatus != "filled" {
+			result.Signals[i].ErrorMessage = result.ErrorMessage
+			trades[i].ErrorMessage = result.ErrorMessage
+		}
+	}
+
+	if err := n.db.CompleteNettingBatch(&result, trades); err != nil {
+		return err
+	}
+	if n.onTrade != nil {
+		for _, t := range trades {
+			n.onTrade(t)
+		}
+	}
+	return orderErr
+}
+
+// execute places a net order and waits up to the fill timeout for it to
+// finish, cancelling it if it doesn't. It returns the last state of the
+// order seen, if it was placed, and records when it was sent and acked on b.
+func (n *Netter) execute(b *batch, order *orders.Order) (*alpaca.Order, error) {
+	sentAt := clock.Now()
+	b.sentAt = &sentAt
+	o, err := n.place(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to place net order: %w", err)
+	}
+	ackedAt := clock.Now()
+	b.ackedAt = &ackedAt
+	log.Printf("Placed net order %s: %s %s %s", o.ID, order.Side, order.Qty, order.Symbol)
+
+	o = n.await(o, n.fillTimeout)
+	if orders.IsTerminal(string(o.Status)) {
+		return o, nil
+	}
+
+	log.Printf("Net order %s not filled after %s; cancelling", o.ID, n.fillTimeout)
+	if err := n.broker.CancelOrder(o.ID); err != nil {
+		log.Printf("Failed to cancel net order %s: %v", o.ID, err)
+	}
+	o = n.await(o, cancelWait)
+	if !orders.IsTerminal(string(o.Status)) {
+		return o, fmt.Errorf("net order %s still %s after cancelling; later fills are not allocated", o.ID, o.Status)
+	}
+	return o, nil
+}
+
+// await polls an order until it reaches a terminal status or timeout passes
+func (n *Netter) await(o *alpaca.Order, timeout time.Duration) *alpaca.Order {
+	deadline := time.Now().Add(timeout)
+	for !orders.IsTerminal(string(o.Status)) && time.Now().Before(deadline) {
+		time.Sleep(pollInterval)
+		latest, err := n.broker.GetOrder(o.ID)
+		if err != nil {
+			log.Printf("Failed to check net order %s: %v", o.ID, err)
+			continue
+		}
+		o = latest
+	}
+	return o
+}
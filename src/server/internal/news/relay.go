@@ -0,0 +1,145 @@
+package news
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+
+	"desk/internal/database"
+	"desk/internal/stream"
+)
+
+// pollLimit caps how many articles are fetched per poll
+const pollLimit = 500
+
+// Source fetches news articles updated since a given time
+type Source interface {
+	News(since time.Time, limit int) ([]marketdata.News, error)
+}
+
+// Relay polls a news source, stores recent headlines and publishes new ones
+// to stream subscribers, so strategies share the desk's news credentials
+type Relay struct {
+	source    Source
+	db        *database.DB
+	retention time.Duration
+	hub       *stream.Hub[database.NewsArticle]
+	since     time.Time
+}
+
+// NewRelay creates a relay that keeps headlines for the retention period
+func NewRelay(source Source, db *database.DB, retention time.Duration) *Relay {
+	return &Relay{
+		source:    source,
+		db:        db,
+		retention: retention,
+		hub:       stream.NewHub[database.NewsArticle](64),
+	}
+}
+
+// Subscribe registers for newly relayed articles. The returned function must
+// be called to unsubscribe.
+func (r *Relay) Subscribe() (<-chan database.NewsArticle, func()) {
+	return r.hub.Subscribe()
+}
+
+// StreamStats describes the news stream's subscribers
+func (r *Relay) StreamStats() stream.Stats {
+	return r.hub.Stats()
+}
+
+// Run polls the source every interval until ctx is cancelled
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Poll(); err != nil {
+			log.Printf("Failed to poll news: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches articles updated since the last poll, stores them, publishes
+// the new ones and prunes headlines past retention
+func (r *Relay) Poll() error {
+	if r.since.IsZero() {
+		// Resume from the newest stored article, or backfill the retention
+		// period on a fresh database
+		latest, err := r.db.LatestNewsUpdate()
+		if err != nil {
+			return err
+		}
+		r.since = time.Now().Add(-r.retention)
+		if latest != nil && latest.After(r.since) {
+			r.since = *latest
+		}
+	}
+
+	items, err := r.source.News(r.since, pollLimit)
+	if err != nil {
+		return err
+	}
+
+	// Updates to old stories would only be pruned again, so skip them
+	cutoff := time.Now().Add(-r.retention)
+	var articles []database.NewsArticle
+	for _, n := range items {
+		if n.UpdatedAt.After(r.since) {
+			r.since = n.UpdatedAt
+		}
+		if n.CreatedAt.After(cutoff) {
+			articles = append(articles, fromAlpaca(n))
+		}
+	}
+
+	added, err := r.db.SaveNewsArticles(articles)
+	if err != nil {
+		return err
+	}
+	for _, a := range added {
+		r.hub.Publish(a)
+	}
+
+	return r.db.PruneNews(cutoff)
+}
+
+// Matches reports whether an article mentions any of symbols; an empty list
+// matches every article
+func Matches(a database.NewsArticle, symbols []string) bool {
+	if len(symbols) == 0 {
+		return true
+	}
+	for _, s := range a.Symbols {
+		if slices.Contains(symbols, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func fromAlpaca(n marketdata.News) database.NewsArticle {
+	symbols := n.Symbols
+	if symbols == nil {
+		symbols = []string{}
+	}
+	return database.NewsArticle{
+		ID:        int64(n.ID),
+		Headline:  n.Headline,
+		Summary:   n.Summary,
+		Author:    n.Author,
+		URL:       n.URL,
+		Symbols:   symbols,
+		CreatedAt: n.CreatedAt,
+		UpdatedAt: n.UpdatedAt,
+	}
+}
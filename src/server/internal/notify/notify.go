@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Severity levels for notifications
+const (
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelError   = "error"
+)
+
+// Notification is an operational event worth a human's attention
+type Notification struct {
+	Level   string    `json:"level"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	// HTML is an optional rendered document, e.g. a report, for channels
+	// that can show it
+	HTML string `json:"html,omitempty"`
+	// UserID is the user the notification is about, if it concerns one
+	// user's orders
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Send builds a notification and delivers it, logging rather than returning
+// delivery failures so callers never fail because an alert could not be sent
+func Send(ctx context.Context, notifier Notifier, level, title, message string) {
+	n := Notification{Level: level, Title: title, Message: message, Time: time.Now()}
+	if err := notifier.Notify(ctx, n); err != nil {
+		log.Printf("Failed to send notification %q: %v", title, err)
+	}
+}
+
+// SendUser is Send for a notification about one user's orders, which a
+// Users notifier also delivers to the user's own channels
+func SendUser(ctx context.Context, notifier Notifier, userID, level, title, message string) {
+	n := Notification{Level: level, Title: title, Message: message, Time: time.Now(), UserID: userID}
+	if err := notifier.Notify(ctx, n); err != nil {
+		log.Printf("Failed to send notification %q: %v", title, err)
+	}
+}
+
+// levels ranks the severity levels
+var levels = map[string]int{LevelInfo: 0, LevelWarning: 1, LevelError: 2}
+
+// ValidLevel reports whether level is a severity level
+func ValidLevel(level string) bool {
+	_, ok := levels[level]
+	return ok
+}
+
+// AtLeast reports whether level is as severe as min. An empty min is info.
+func AtLeast(level, min string) bool {
+	return levels[level] >= levels[min]
+}
+
+// Log writes notifications to the server log
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, n Notification) error {
+	log.Printf("[%s] %s: %s", n.Level, n.Title, n.Message)
+	return nil
+}
+
+// Webhook POSTs each notification as JSON to a URL
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Discord posts each notification to a Discord webhook as an embed, colored
+// by level
+type Discord struct {
+	url    string
+	client *http.Client
+}
+
+func NewDiscord(url string) *Discord {
+	return &Discord{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// discordColors are the embed colors of each level
+var discordColors = map[string]int{LevelInfo: 0x3498db, LevelWarning: 0xf1c40f, LevelError: 0xe74c3c}
+
+// discordMaxDescription is Discord's limit on an embed's description
+const discordMaxDescription = 4096
+
+func (d *Discord) Notify(ctx context.Context, n Notification) error {
+	description := n.Message
+	if n.UserID != "" {
+		description += "\nUser: " + n.UserID
+	}
+	if r := []rune(description); len(r) > discordMaxDescription {
+		description = string(r[:discordMaxDescription-1]) + "…"
+	}
+	body, err := json.Marshal(map[string]any{
+		"embeds": []map[string]any{{
+			"title":       n.Title,
+			"description": description,
+			"color":       discordColors[n.Level],
+			"timestamp":   n.Time.UTC().Format(time.RFC3339),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Discord request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to Discord: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("discord returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Fanout delivers every notification to all of its notifiers, returning the
+// first error after trying them all
+type Fanout []Notifier
+
+func (f Fanout) Notify(ctx context.Context, n Notification) error {
+	var first error
+	for _, notifier := range f {
+		if err := notifier.Notify(ctx, n); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Switch delivers notifications to a notifier that can be replaced while
+// in use, e.g. when configuration is reloaded
+type Switch struct {
+	mu      sync.RWMutex
+	current Notifier
+}
+
+func NewSwitch(n Notifier) *Switch {
+	return &Switch{current: n}
+}
+
+// Set replaces the notifier future notifications are delivered to
+func (s *Switch) Set(n Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = n
+}
+
+func (s *Switch) Notify(ctx context.Context, n Notification) error {
+	s.mu.RLock()
+	current := s.current
+	s.mu.RUnlock()
+	return current.Notify(ctx, n)
+}
+
+// Users delivers every notification to the desk's notifier, and those about
+// one user to that user's own channels as well
+type Users struct {
+	desk Notifier
+	// channels returns a user's notifiers and the least severe level each
+	// is sent
+	channels func(userID string) ([]UserChannel, error)
+}
+
+// UserChannel is one of a user's notifiers and the least severe level sent
+// to it
+type UserChannel struct {
+	Notifier Notifier
+	MinLevel string
+}
+
+func NewUsers(desk Notifier, channels func(userID string) ([]UserChannel, error)) *Users {
+	return &Users{desk: desk, channels: channels}
+}
+
+func (u *Users) Notify(ctx context.Context, n Notification) error {
+	first := u.desk.Notify(ctx, n)
+	if n.UserID == "" {
+		return first
+	}
+
+	channels, err := u.channels(n.UserID)
+	if err != nil {
+		return errors.Join(first, fmt.Errorf("failed to load channels of user %s: %w", n.UserID, err))
+	}
+	for _, c := range channels {
+		if !AtLeast(n.Level, c.MinLevel) {
+			continue
+		}
+		if err := c.Notifier.Notify(ctx, n); err != nil && first == nil {
+			first = fmt.Errorf("user %s: %w", n.UserID, err)
+		}
+	}
+	return first
+}
@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Thresholds are the desk's exposure alert levels. A zero threshold, or a
+// nil MinCash, is off.
+type Thresholds struct {
+	// MaxExposure is the gross exposure, in dollars, above which to alert
+	MaxExposure decimal.Decimal `json:"max_exposure"`
+	// MaxConcentration is the fraction of equity one symbol's position may
+	// be worth before alerting
+	MaxConcentration decimal.Decimal `json:"max_concentration"`
+	// MinCash is the cash balance below which to alert; it can be negative
+	// to allow some margin
+	MinCash *decimal.Decimal `json:"min_cash,omitempty"`
+}
+
+// Enabled reports whether any threshold is set
+func (t Thresholds) Enabled() bool {
+	return t.MaxExposure.IsPositive() || t.MaxConcentration.IsPositive() || t.MinCash != nil
+}
+
+// Exposure is the desk's position the thresholds are checked against.
+// Equity and cash are only known once the account has been read.
+type Exposure struct {
+	GrossExposure decimal.Decimal
+	// Positions is the absolute market value of each symbol's position
+	Positions map[string]decimal.Decimal
+	Equity    *decimal.Decimal
+	Cash      *decimal.Decimal
+}
+
+// Alert is a threshold currently breached
+type Alert struct {
+	Key       string          `json:"key"`
+	Message   string          `json:"message"`
+	Value     decimal.Decimal `json:"value"`
+	Threshold decimal.Decimal `json:"threshold"`
+	Since     time.Time       `json:"since"`
+	// NotifiedAt is when the breach was last notified
+	NotifiedAt time.Time `json:"notified_at"`
+	// clearSince is when the breach was first seen cleared, zero while it
+	// lasts
+	clearSince time.Time
+}
+
+// clearHold is how long a breach must stay cleared before it is closed, so
+// a value hovering around its threshold doesn't alert on every crossing
+const clearHold = 5 * time.Minute
+
+// Alerter checks exposure against the thresholds and notifies breaches.
+// A breach is notified when it starts and, while it lasts, again every
+// repeat (never if repeat is zero); an info notification follows once it
+// has stayed cleared for clearHold. Checks run on every mark, so without this the channel would hear
+// about the same breach every few seconds.
+type Alerter struct {
+	notifier Notifier
+	queue    chan Notification
+
+	mu         sync.Mutex
+	thresholds Thresholds
+	repeat     time.Duration
+	active     map[string]*Alert
+}
+
+func NewAlerter(notifier Notifier) *Alerter {
+	return &Alerter{notifier: notifier, queue: make(chan Notification, 64), active: make(map[string]*Alert)}
+}
+
+// Run delivers alerts, in the order they were raised, until ctx is
+// cancelled
+func (a *Alerter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-a.queue:
+			if err := a.notifier.Notify(ctx, n); err != nil {
+				log.Printf("Failed to send notification %q: %v", n.Title, err)
+			}
+		}
+	}
+}
+
+// SetThresholds changes the thresholds and how often an ongoing breach is
+// notified again from the next check on
+func (a *Alerter) SetThresholds(t Thresholds, repeat time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.thresholds, a.repeat = t, repeat
+}
+
+// Thresholds returns the thresholds in force and the repeat interval
+func (a *Alerter) Thresholds() (Thresholds, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.thresholds, a.repeat
+}
+
+// Active returns the breaches as of the last check, by key
+func (a *Alerter) Active() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Alert, 0, len(a.active))
+	for _, alert := range a.active {
+		out = append(out, *alert)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Check compares e with the thresholds at now. Notifications are queued for
+// Run, so Check never waits on a channel; if the queue is full they are
+// logged and dropped.
+func (a *Alerter) Check(e Exposure, now time.Time) {
+	a.mu.Lock()
+	breaches := a.breaches(e)
+	var pending []Notification
+
+	for key, b := range breaches {
+		alert, ok := a.active[key]
+		if !ok {
+			b.Since, b.NotifiedAt = now, now
+			a.active[key] = b
+			pending = append(pending, Notification{Level: LevelWarning, Title: "Exposure alert", Message: b.Message, Time: now})
+			continue
+		}
+		alert.Message, alert.Value, alert.Threshold = b.Message, b.Value, b.Threshold
+		alert.clearSince = time.Time{}
+		if a.repeat > 0 && now.Sub(alert.NotifiedAt) >= a.repeat {
+			alert.NotifiedAt = now
+			pending = append(pending, Notification{Level: LevelWarning, Title: "Exposure alert", Time: now,
+				Message: fmt.Sprintf("%s (since %s)", b.Message, alert.Since.Format("15:04 MST"))})
+		}
+	}
+	for key, alert := range a.active {
+		if _, ok := breaches[key]; ok || !a.known(key, e) {
+			continue
+		}
+		if alert.clearSince.IsZero() {
+			alert.clearSince = now
+		}
+		if now.Sub(alert.clearSince) < clearHold {
+			continue
+		}
+		delete(a.active, key)
+		pending = append(pending, Notification{Level: LevelInfo, Title: "Exposure alert cleared", Time: now,
+			Message: fmt.Sprintf("Cleared after %s: %s", alert.clearSince.Sub(alert.Since).Round(time.Second), alert.Message)})
+	}
+
+	// Queued under the lock so alerts from consecutive checks stay in order
+	for _, n := range pending {
+		select {
+		case a.queue <- n:
+		default:
+			log.Printf("Dropped notification %q: %s", n.Title, n.Message)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// breaches returns the thresholds e breaches, by key
+func (a *Alerter) breaches(e Exposure) map[string]*Alert {
+	t := a.thresholds
+	out := make(map[string]*Alert)
+
+	if t.MaxExposure.IsPositive() && e.GrossExposure.GreaterThan(t.MaxExposure) {
+		out["exposure"] = &Alert{
+			Key:       "exposure",
+			Message:   fmt.Sprintf("Gross exposure $%s is over $%s", e.GrossExposure.StringFixed(2), t.MaxExposure.StringFixed(2)),
+			Value:     e.GrossExposure,
+			Threshold: t.MaxExposure,
+		}
+	}
+	if t.MaxConcentration.IsPositive() && e.Equity != nil && e.Equity.IsPositive() {
+		for symbol, value := range e.Positions {
+			share := value.Div(*e.Equity)
+			if !share.GreaterThan(t.MaxConcentration) {
+				continue
+			}
+			key := "concentration:" + symbol
+			out[key] = &Alert{
+				Key: key,
+				Message: fmt.Sprintf("%s is %s%% of equity ($%s), over %s%%", symbol,
+					share.Mul(decimal.NewFromInt(100)).StringFixed(1), value.StringFixed(2), t.MaxConcentration.Mul(decimal.NewFromInt(100)).String()),
+				Value:     share,
+				Threshold: t.MaxConcentration,
+			}
+		}
+	}
+	if t.MinCash != nil && e.Cash != nil && e.Cash.LessThan(*t.MinCash) {
+		out["cash"] = &Alert{
+			Key:       "cash",
+			Message:   fmt.Sprintf("Cash $%s is below $%s", e.Cash.StringFixed(2), t.MinCash.StringFixed(2)),
+			Value:     *e.Cash,
+			Threshold: *t.MinCash,
+		}
+	}
+	return out
+}
+
+// known reports whether e has what is needed to tell if the breach at key
+// has cleared; one that can't be checked, say because the account hasn't
+// been read, stays active. A threshold turned off clears its breaches.
+func (a *Alerter) known(key string, e Exposure) bool {
+	switch {
+	case key == "cash":
+		return e.Cash != nil || a.thresholds.MinCash == nil
+	case key != "exposure":
+		return e.Equity != nil || !a.thresholds.MaxConcentration.IsPositive()
+	}
+	return true
+}
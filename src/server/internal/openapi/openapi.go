@@ -0,0 +1,438 @@
+// Package openapi builds an OpenAPI 3 document describing the desk's HTTP
+// API. Schemas are derived from the Go types handlers encode and decode, and
+// from the descriptors of protobuf messages using their JSON mapping.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Content types of request and response bodies
+const (
+	JSON     = "application/json"
+	Protobuf = "application/x-protobuf"
+	Binary   = "application/octet-stream"
+	SSE      = "text/event-stream"
+)
+
+// Param describes a query or header parameter
+type Param struct {
+	Name        string
+	Description string
+	// Type is the parameter's schema type; string when empty
+	Type     string
+	Required bool
+}
+
+// Operation describes one endpoint
+type Operation struct {
+	Summary     string
+	Description string
+	Query       []Param
+	Headers     []Param
+
+	// Request is a value of the body's type: a Go value decoded from JSON,
+	// or a proto.Message sent as binary protobuf. RequestType overrides the
+	// content type, e.g. for raw uploads.
+	Request     any
+	RequestType string
+
+	// Response is a value of the success body's type, sent with Status
+	// (default 200). A Stream response is server-sent events whose data is
+	// the Response type; a Websocket endpoint switches protocols and sends
+	// JSON messages carrying it.
+	Response  any
+	Status    int
+	Stream    bool
+	Websocket bool
+
+	// ProtoJSON marks endpoints whose protobuf bodies may also be sent and
+	// received as JSON
+	ProtoJSON bool
+}
+
+// Schema is an OpenAPI schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	OperationID string              `json:"operationId"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []parameter         `json:"parameters,omitempty"`
+	RequestBody *requestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       info                             `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+
+	// names maps each type given a component schema to its name
+	names map[reflect.Type]string
+}
+
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI:    "3.0.3",
+		Info:       info{Title: title, Version: version, Description: description},
+		Paths:      make(map[string]map[string]*operation),
+		Components: components{Schemas: make(map[string]*Schema)},
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Add describes the endpoint registered with a ServeMux pattern such as
+// "GET /strategies/{id}". Path parameters are taken from the pattern.
+func (d *Document) Add(pattern string, op Operation) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = http.MethodGet, pattern
+	}
+
+	o := &operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: operationID(method, path),
+		Tags:        []string{strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]},
+		Responses:   make(map[string]response),
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			schemaType := "string"
+			if name == "id" || name == "version" {
+				schemaType = "integer"
+			}
+			o.Parameters = append(o.Parameters, parameter{
+				Name: name, In: "path", Required: true, Schema: &Schema{Type: schemaType},
+			})
+		}
+	}
+	for _, p := range op.Headers {
+		o.Parameters = append(o.Parameters, p.parameter("header"))
+	}
+	for _, p := range op.Query {
+		o.Parameters = append(o.Parameters, p.parameter("query"))
+	}
+
+	if op.Request != nil {
+		contentType := op.RequestType
+		if contentType == "" {
+			contentType = JSON
+			if _, ok := op.Request.(proto.Message); ok {
+				contentType = Protobuf
+			}
+		}
+		var schema *Schema
+		if contentType == Binary {
+			schema = &Schema{Type: "string", Format: "binary"}
+		} else {
+			schema = d.schema(reflect.TypeOf(op.Request))
+		}
+		o.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{contentType: {Schema: schema}}}
+		if contentType == Protobuf && op.ProtoJSON {
+			o.RequestBody.Content[JSON] = mediaType{Schema: schema}
+		}
+	}
+
+	status := op.Status
+	switch {
+	case status != 0:
+	case op.Websocket:
+		status = http.StatusSwitchingProtocols
+	default:
+		status = http.StatusOK
+	}
+	success := response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		schema := d.schema(reflect.TypeOf(op.Response))
+		switch _, isProto := op.Response.(proto.Message); {
+		case op.Stream:
+			success.Description = "Server-sent events whose data is JSON of this schema"
+			success.Content = map[string]mediaType{SSE: {Schema: schema}}
+		case op.Websocket:
+			success.Description = "A websocket whose JSON messages carry this schema"
+			success.Content = map[string]mediaType{JSON: {Schema: schema}}
+		case isProto:
+			success.Content = map[string]mediaType{Protobuf: {Schema: schema}}
+			if op.ProtoJSON {
+				success.Content[JSON] = mediaType{Schema: schema}
+			}
+		default:
+			success.Content = map[string]mediaType{JSON: {Schema: schema}}
+		}
+	}
+	o.Responses[strconv.Itoa(status)] = success
+	o.Responses["default"] = response{
+		Description: "Error, as a plain-text message",
+		Content:     map[string]mediaType{"text/plain": {Schema: &Schema{Type: "string"}}},
+	}
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*operation)
+	}
+	d.Paths[path][strings.ToLower(method)] = o
+}
+
+func (p Param) parameter(in string) parameter {
+	schemaType := p.Type
+	if schemaType == "" {
+		schemaType = "string"
+	}
+	return parameter{
+		Name:        p.Name,
+		In:          in,
+		Description: p.Description,
+		Required:    p.Required,
+		Schema:      &Schema{Type: schemaType},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// getStrategiesIdVersions for GET /strategies/{id}/versions
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.' || r == '_' || r == '-'
+	}) {
+		id += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+	return id
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+	rawType     = reflect.TypeOf(json.RawMessage{})
+	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// schema returns the JSON schema of values of type t, referencing a
+// component schema for named structs and messages
+func (d *Document) schema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		if t.Implements(messageType) {
+			break
+		}
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s *Schema
+	switch {
+	case t.Implements(messageType):
+		msg := reflect.Zero(t).Interface().(proto.Message)
+		s = d.messageRef(msg.ProtoReflect().Descriptor())
+	case t == timeType:
+		s = &Schema{Type: "string", Format: "date-time"}
+	case t == decimalType:
+		s = &Schema{Type: "string", Format: "decimal"}
+	case t == rawType:
+		s = &Schema{}
+	default:
+		s = d.kindSchema(t)
+	}
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (d *Document) kindSchema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return d.ref(t, func() *Schema { return d.structSchema(t) })
+	}
+	return &Schema{}
+}
+
+// ref registers a component schema for t, built on first use, and returns a
+// reference to it
+func (d *Document) ref(t reflect.Type, build func() *Schema) *Schema {
+	name, ok := d.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := d.Components.Schemas[name]; taken {
+			pkg := t.PkgPath()
+			name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+		}
+		d.names[t] = name
+		// Reserve the name so recursive types terminate
+		d.Components.Schemas[name] = &Schema{}
+		*d.Components.Schemas[name] = *build()
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema describes a struct as encoding/json marshals it
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// Embedded struct fields are promoted into the parent
+			for k, v := range d.structSchema(ft).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.schema(f.Type)
+	}
+	return s
+}
+
+// messageRef returns a reference to the component schema of a protobuf
+// message, following protojson's mapping with the original field names
+func (d *Document) messageRef(md protoreflect.MessageDescriptor) *Schema {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string"}
+	}
+
+	name := string(md.FullName())
+	if _, ok := d.Components.Schemas[name]; !ok {
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		d.Components.Schemas[name] = s
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			s.Properties[string(f.Name())] = d.fieldSchema(f)
+		}
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (d *Document) fieldSchema(f protoreflect.FieldDescriptor) *Schema {
+	if f.IsMap() {
+		return &Schema{Type: "object", AdditionalProperties: d.singularSchema(f.MapValue())}
+	}
+	if f.IsList() {
+		return &Schema{Type: "array", Items: d.singularSchema(f)}
+	}
+	return d.singularSchema(f)
+}
+
+func (d *Document) singularSchema(f protoreflect.FieldDescriptor) *Schema {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return &Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		return &Schema{Type: "string", Format: "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return &Schema{Type: "number"}
+	case protoreflect.StringKind:
+		return &Schema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &Schema{Type: "string", Format: "byte"}
+	case protoreflect.EnumKind:
+		values := f.Enum().Values()
+		s := &Schema{Type: "string"}
+		for i := 0; i < values.Len(); i++ {
+			s.Enum = append(s.Enum, string(values.Get(i).Name()))
+		}
+		return s
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return d.messageRef(f.Message())
+	}
+	return &Schema{}
+}
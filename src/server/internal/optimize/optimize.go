@@ -0,0 +1,357 @@
+// Package optimize computes long-only target weights for a universe from its
+// daily return history: mean-variance, minimum variance or risk parity.
+// Weights are fully invested (they sum to one) and never short.
+package optimize
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+)
+
+// Optimization methods
+const (
+	// MethodMeanVariance maximizes expected return less RiskAversion/2
+	// times variance
+	MethodMeanVariance = "mean_variance"
+	// MethodMinVariance minimizes variance, ignoring expected returns
+	MethodMinVariance = "min_variance"
+	// MethodRiskParity weights every symbol to contribute equally to the
+	// portfolio's volatility
+	MethodRiskParity = "risk_parity"
+)
+
+// ValidMethod reports whether method is an optimization method
+func ValidMethod(method string) bool {
+	return method == MethodMeanVariance || method == MethodMinVariance || method == MethodRiskParity
+}
+
+const (
+	// tradingDays annualizes daily means and covariances
+	tradingDays = 252
+	// MinObservations is the fewest daily returns in common an
+	// optimization runs on
+	MinObservations = 20
+	maxIterations   = 20000
+	tolerance       = 1e-10
+)
+
+// ErrTooFewSymbols is returned when fewer than two symbols have enough
+// history to optimize over
+var ErrTooFewSymbols = errors.New("at least two symbols with enough history are needed")
+
+// Options configure an optimization
+type Options struct {
+	Method string
+	// RiskAversion weighs variance against expected return in
+	// MethodMeanVariance
+	RiskAversion float64
+	// MaxWeight caps each symbol's weight (1 for no cap); it doesn't apply
+	// to MethodRiskParity
+	MaxWeight float64
+	// Lookback is how many daily returns to estimate from
+	Lookback int
+}
+
+// Weight is one symbol's target weight and its annualized statistics
+type Weight struct {
+	Symbol         string  `json:"symbol"`
+	Weight         float64 `json:"weight"`
+	ExpectedReturn float64 `json:"expected_return"`
+	Volatility     float64 `json:"volatility"`
+	// RiskContribution is the symbol's share of the portfolio's variance
+	RiskContribution float64 `json:"risk_contribution"`
+}
+
+// Result is an optimized portfolio. Returns and volatilities are
+// annualized from daily returns and assume the weights are held.
+type Result struct {
+	Method         string   `json:"method"`
+	Weights        []Weight `json:"weights"`
+	ExpectedReturn float64  `json:"expected_return"`
+	Volatility     float64  `json:"volatility"`
+	// Observations is the number of daily returns the estimates are from
+	Observations int `json:"observations"`
+	// Skipped lists symbols left out for too little history
+	Skipped []string `json:"skipped"`
+}
+
+// Run optimizes over symbols using their daily bars. Symbols with fewer than
+// MinObservations returns are skipped; the rest are aligned on the sessions
+// they all traded.
+func Run(bars map[string][]marketdata.Bar, symbols []string, opts Options) (*Result, error) {
+	result := &Result{Method: opts.Method, Weights: []Weight{}, Skipped: []string{}}
+	var kept []string
+	for _, s := range symbols {
+		if len(bars[s]) > MinObservations {
+			kept = append(kept, s)
+		} else {
+			result.Skipped = append(result.Skipped, s)
+		}
+	}
+	if len(kept) < 2 {
+		return nil, ErrTooFewSymbols
+	}
+	if opts.Method != MethodRiskParity && opts.MaxWeight*float64(len(kept)) < 1 {
+		return nil, fmt.Errorf("max_weight %g can't be met by %d symbols", opts.MaxWeight, len(kept))
+	}
+
+	returns := alignedReturns(bars, kept, opts.Lookback)
+	if len(returns[0]) < MinObservations {
+		return nil, fmt.Errorf("the symbols have only %d daily returns in common, fewer than %d", len(returns[0]), MinObservations)
+	}
+	mean, cov := estimate(returns)
+	for i, s := range kept {
+		if cov[i][i] == 0 {
+			return nil, fmt.Errorf("%s has not moved over the lookback", s)
+		}
+	}
+
+	var w []float64
+	switch opts.Method {
+	case MethodMeanVariance:
+		w = meanVariance(mean, cov, opts.RiskAversion, opts.MaxWeight)
+	case MethodMinVariance:
+		w = meanVariance(make([]float64, len(mean)), cov, 1, opts.MaxWeight)
+	case MethodRiskParity:
+		w = riskParity(cov)
+	default:
+		return nil, fmt.Errorf("unknown method %q", opts.Method)
+	}
+
+	sigma := mulVec(cov, w)
+	variance := dot(w, sigma)
+	for i, s := range kept {
+		weight := Weight{
+			Symbol:         s,
+			Weight:         round(w[i], 4),
+			ExpectedReturn: round(mean[i], 4),
+			Volatility:     round(math.Sqrt(cov[i][i]), 4),
+		}
+		if variance > 0 {
+			weight.RiskContribution = round(w[i]*sigma[i]/variance, 4)
+		}
+		result.Weights = append(result.Weights, weight)
+	}
+	result.ExpectedReturn = round(dot(w, mean), 4)
+	result.Volatility = round(math.Sqrt(variance), 4)
+	result.Observations = len(returns[0])
+	return result, nil
+}
+
+// alignedReturns returns each symbol's daily returns between consecutive
+// sessions that every symbol has a bar for, the last n of them
+func alignedReturns(bars map[string][]marketdata.Bar, symbols []string, n int) [][]float64 {
+	closes := make([]map[time.Time]float64, len(symbols))
+	var days []time.Time
+	for i, s := range symbols {
+		closes[i] = make(map[time.Time]float64, len(bars[s]))
+		for _, b := range bars[s] {
+			day := b.Timestamp.UTC().Truncate(24 * time.Hour)
+			closes[i][day] = b.Close
+			if i == 0 {
+				days = append(days, day)
+			}
+		}
+	}
+	shared := days[:0]
+	for _, day := range days {
+		all := true
+		for _, c := range closes[1:] {
+			if _, ok := c[day]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			shared = append(shared, day)
+		}
+	}
+	slices.SortFunc(shared, func(a, b time.Time) int { return a.Compare(b) })
+	if len(shared) > n+1 {
+		shared = shared[len(shared)-n-1:]
+	}
+
+	returns := make([][]float64, len(symbols))
+	for i := range symbols {
+		returns[i] = []float64{}
+		for d := 1; d < len(shared); d++ {
+			prev, cur := closes[i][shared[d-1]], closes[i][shared[d]]
+			if prev > 0 {
+				returns[i] = append(returns[i], cur/prev-1)
+			} else {
+				returns[i] = append(returns[i], 0)
+			}
+		}
+	}
+	return returns
+}
+
+// estimate returns the annualized mean returns and covariance matrix
+func estimate(returns [][]float64) ([]float64, [][]float64) {
+	k, n := len(returns), len(returns[0])
+	mean := make([]float64, k)
+	for i, r := range returns {
+		for _, x := range r {
+			mean[i] += x
+		}
+		mean[i] /= float64(n)
+	}
+	cov := make([][]float64, k)
+	for i := range cov {
+		cov[i] = make([]float64, k)
+	}
+	for i := 0; i < k; i++ {
+		for j := i; j < k; j++ {
+			var c float64
+			for t := 0; t < n; t++ {
+				c += (returns[i][t] - mean[i]) * (returns[j][t] - mean[j])
+			}
+			c = c / float64(n-1) * tradingDays
+			cov[i][j], cov[j][i] = c, c
+		}
+	}
+	for i := range mean {
+		mean[i] *= tradingDays
+	}
+	return mean, cov
+}
+
+// meanVariance maximizes mean·w - riskAversion/2 w·cov·w over weights in
+// [0, maxWeight] summing to one, by projected gradient ascent
+func meanVariance(mean []float64, cov [][]float64, riskAversion, maxWeight float64) []float64 {
+	k := len(mean)
+	// The step is the inverse of a bound on the gradient's Lipschitz
+	// constant, the largest absolute row sum of the scaled covariance
+	var lipschitz float64
+	for _, row := range cov {
+		var sum float64
+		for _, c := range row {
+			sum += math.Abs(c)
+		}
+		lipschitz = max(lipschitz, riskAversion*sum)
+	}
+	if lipschitz == 0 {
+		lipschitz = 1
+	}
+	step := 1 / lipschitz
+
+	w := make([]float64, k)
+	for i := range w {
+		w[i] = 1 / float64(k)
+	}
+	next := make([]float64, k)
+	for it := 0; it < maxIterations; it++ {
+		sigma := mulVec(cov, w)
+		for i := range next {
+			next[i] = w[i] + step*(mean[i]-riskAversion*sigma[i])
+		}
+		projectCapped(next, maxWeight)
+		var moved float64
+		for i := range w {
+			moved += math.Abs(next[i] - w[i])
+		}
+		copy(w, next)
+		if moved < tolerance {
+			break
+		}
+	}
+	return w
+}
+
+// projectCapped replaces v with its Euclidean projection onto the weights in
+// [0, cap] summing to one: v - tau clamped, for the tau found by bisection
+func projectCapped(v []float64, cap float64) {
+	clampedSum := func(tau float64) float64 {
+		var sum float64
+		for _, x := range v {
+			sum += min(max(x-tau, 0), cap)
+		}
+		return sum
+	}
+	lo, hi := slices.Min(v)-cap, slices.Max(v)
+	for it := 0; it < 100; it++ {
+		mid := (lo + hi) / 2
+		if clampedSum(mid) > 1 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	tau := (lo + hi) / 2
+	for i, x := range v {
+		v[i] = min(max(x-tau, 0), cap)
+	}
+}
+
+// riskParity finds the weights whose risk contributions are equal, by
+// cyclical coordinate descent: each weight in turn solves its own risk
+// contribution equation given the others
+func riskParity(cov [][]float64) []float64 {
+	k := len(cov)
+	budget := 1 / float64(k)
+	w := make([]float64, k)
+	for i := range w {
+		w[i] = 1 / math.Sqrt(cov[i][i])
+	}
+	normalize(w)
+
+	prev := make([]float64, k)
+	for it := 0; it < maxIterations; it++ {
+		copy(prev, w)
+		for i := range w {
+			vol := math.Sqrt(dot(w, mulVec(cov, w)))
+			var c float64
+			for j := range w {
+				if j != i {
+					c += cov[i][j] * w[j]
+				}
+			}
+			w[i] = (-c + math.Sqrt(c*c+4*cov[i][i]*budget*vol)) / (2 * cov[i][i])
+		}
+		var moved float64
+		for i := range w {
+			moved += math.Abs(w[i] - prev[i])
+		}
+		if moved < tolerance {
+			break
+		}
+	}
+	normalize(w)
+	return w
+}
+
+func normalize(w []float64) {
+	var sum float64
+	for _, x := range w {
+		sum += x
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+}
+
+func mulVec(m [][]float64, v []float64) []float64 {
+	out := make([]float64, len(m))
+	for i, row := range m {
+		out[i] = dot(row, v)
+	}
+	return out
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func round(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
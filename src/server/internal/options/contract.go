@@ -0,0 +1,84 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/market"
+)
+
+// Multiplier is the number of shares one equity option contract covers
+const Multiplier = 100
+
+// Option types
+const (
+	Call = "call"
+	Put  = "put"
+)
+
+// Contract is a listed equity option
+type Contract struct {
+	Symbol     string          `json:"symbol"`
+	Underlying string          `json:"underlying"`
+	Type       string          `json:"type"`
+	Strike     decimal.Decimal `json:"strike"`
+	// Expiration is the expiration date, YYYY-MM-DD
+	Expiration string `json:"expiration"`
+}
+
+// ParseOCC parses an OCC option symbol such as AAPL250117C00150000: the
+// underlying, a YYMMDD expiration, C or P, and the strike in thousandths
+// padded to 8 digits
+func ParseOCC(symbol string) (*Contract, error) {
+	const suffix = 15 // YYMMDD + type + 8 strike digits
+	if len(symbol) <= suffix || len(symbol) > suffix+6 {
+		return nil, fmt.Errorf("%q is not an OCC option symbol", symbol)
+	}
+	root, rest := symbol[:len(symbol)-suffix], symbol[len(symbol)-suffix:]
+
+	expiry, err := time.Parse("060102", rest[:6])
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an OCC option symbol: bad expiration", symbol)
+	}
+
+	c := &Contract{
+		Symbol:     symbol,
+		Underlying: root,
+		Expiration: expiry.Format("2006-01-02"),
+	}
+	switch rest[6] {
+	case 'C':
+		c.Type = Call
+	case 'P':
+		c.Type = Put
+	default:
+		return nil, fmt.Errorf("%q is not an OCC option symbol: type must be C or P", symbol)
+	}
+
+	thousandths, err := strconv.ParseInt(rest[7:], 10, 64)
+	if err != nil || thousandths <= 0 {
+		return nil, fmt.Errorf("%q is not an OCC option symbol: bad strike", symbol)
+	}
+	c.Strike = decimal.New(thousandths, -3)
+	return c, nil
+}
+
+// IsOCC reports whether symbol is an OCC option symbol
+func IsOCC(symbol string) bool {
+	_, err := ParseOCC(symbol)
+	return err == nil
+}
+
+// YearsToExpiry is the time from now until the contract expires at the
+// close on its expiration date, in years of 365 days. It is zero or negative
+// once the contract has expired.
+func (c *Contract) YearsToExpiry(now time.Time) (float64, error) {
+	expiresAt, err := market.SessionClose(c.Expiration)
+	if err != nil {
+		return 0, err
+	}
+	return expiresAt.Sub(now).Hours() / (24 * 365), nil
+}
@@ -0,0 +1,99 @@
+package options
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrNoImpliedVol is returned when no volatility reproduces an option price,
+// e.g. a quote below intrinsic value
+var ErrNoImpliedVol = errors.New("no implied volatility matches the price")
+
+// Greeks are Black-Scholes sensitivities per share of underlying. Theta is
+// per calendar day and vega per volatility point (1%).
+type Greeks struct {
+	Price float64
+	Delta float64
+	Gamma float64
+	Theta float64
+	Vega  float64
+}
+
+// Inputs are the Black-Scholes inputs for one European option. Rate and Vol
+// are annual and continuously compounded; dividends are ignored.
+type Inputs struct {
+	Type   string
+	Spot   float64
+	Strike float64
+	Years  float64
+	Rate   float64
+	Vol    float64
+}
+
+func normCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// Price values an option and its greeks. An option at expiry is worth its
+// intrinsic value, with a delta of 1 (or -1) in the money and no other greeks.
+func Price(in Inputs) Greeks {
+	if in.Years <= 0 || in.Vol <= 0 {
+		var g Greeks
+		switch {
+		case in.Type == Call && in.Spot > in.Strike:
+			g.Price, g.Delta = in.Spot-in.Strike, 1
+		case in.Type == Put && in.Spot < in.Strike:
+			g.Price, g.Delta = in.Strike-in.Spot, -1
+		}
+		return g
+	}
+
+	sqrtT := math.Sqrt(in.Years)
+	d1 := (math.Log(in.Spot/in.Strike) + (in.Rate+in.Vol*in.Vol/2)*in.Years) / (in.Vol * sqrtT)
+	d2 := d1 - in.Vol*sqrtT
+	discount := math.Exp(-in.Rate * in.Years)
+
+	g := Greeks{
+		Gamma: normPDF(d1) / (in.Spot * in.Vol * sqrtT),
+		Vega:  in.Spot * normPDF(d1) * sqrtT / 100,
+	}
+	decay := -in.Spot * normPDF(d1) * in.Vol / (2 * sqrtT)
+	if in.Type == Call {
+		g.Price = in.Spot*normCDF(d1) - in.Strike*discount*normCDF(d2)
+		g.Delta = normCDF(d1)
+		g.Theta = (decay - in.Rate*in.Strike*discount*normCDF(d2)) / 365
+	} else {
+		g.Price = in.Strike*discount*normCDF(-d2) - in.Spot*normCDF(-d1)
+		g.Delta = normCDF(d1) - 1
+		g.Theta = (decay + in.Rate*in.Strike*discount*normCDF(-d2)) / 365
+	}
+	return g
+}
+
+// ImpliedVol finds the volatility at which the model price equals price, by
+// bisection between 0.1% and 500%
+func ImpliedVol(in Inputs, price float64) (float64, error) {
+	lo, hi := 0.001, 5.0
+	in.Vol = lo
+	if price < Price(in).Price {
+		return 0, ErrNoImpliedVol
+	}
+	in.Vol = hi
+	if price > Price(in).Price {
+		return 0, ErrNoImpliedVol
+	}
+
+	for i := 0; i < 100 && hi-lo > 1e-6; i++ {
+		in.Vol = (lo + hi) / 2
+		if Price(in).Price < price {
+			lo = in.Vol
+		} else {
+			hi = in.Vol
+		}
+	}
+	return (lo + hi) / 2, nil
+}
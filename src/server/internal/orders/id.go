@@ -0,0 +1,72 @@
+package orders
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	idMu   sync.Mutex
+	lastMS uint64
+	// lastEntropy is the previous ID's 80 random bits
+	lastEntropy [10]byte
+)
+
+// NewID returns a ULID for an order received at t: 48 bits of Unix
+// milliseconds then 80 random bits, as 26 characters of Crockford base32.
+// IDs sort in the order they were generated; within one millisecond the
+// random part of the previous ID is incremented rather than drawn again.
+// The desk sends it to the broker as the order's client_order_id, so an
+// order can be traced before, and without, a broker order ID.
+func NewID(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+
+	idMu.Lock()
+	if ms <= lastMS {
+		ms = lastMS
+		for i := len(lastEntropy) - 1; i >= 0; i-- {
+			lastEntropy[i]++
+			if lastEntropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		rand.Read(lastEntropy[:])
+		lastMS = ms
+	}
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(b[6:], lastEntropy[:])
+	idMu.Unlock()
+
+	return encodeULID(b)
+}
+
+// encodeULID writes 128 bits as 26 base32 characters, the first carrying
+// only the top 3 bits
+func encodeULID(b [16]byte) string {
+	var out [26]byte
+	// Read the bits 5 at a time from the end, with 2 bits of padding
+	// ahead of the first byte
+	var acc uint32
+	bits := 0
+	i := len(out) - 1
+	for j := len(b) - 1; j >= 0; j-- {
+		acc |= uint32(b[j]) << bits
+		bits += 8
+		for bits >= 5 {
+			out[i] = crockford[acc&31]
+			i--
+			acc >>= 5
+			bits -= 5
+		}
+	}
+	out[0] = crockford[acc&31]
+	return string(out[:])
+}
@@ -0,0 +1,151 @@
+package orders
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// timeInForces lists, per asset class, the order types each time in force
+// is valid with at Alpaca. Checking them here turns what would be a 422
+// from the broker into an error naming the field and what it accepts.
+var timeInForces = map[string]map[string][]string{
+	AssetClassEquity: {
+		"day": {"market", "limit", "stop", "stop_limit"},
+		"gtc": {"market", "limit", "stop", "stop_limit"},
+		"ioc": {"market", "limit"},
+		"fok": {"market", "limit"},
+		"opg": {"market", "limit"},
+		"cls": {"market", "limit"},
+	},
+	AssetClassCrypto: {
+		"gtc": {"market", "limit", "stop_limit"},
+		"ioc": {"market", "limit", "stop_limit"},
+	},
+	AssetClassOption: {
+		"day": {"market", "limit", "stop", "stop_limit"},
+	},
+}
+
+// matrixTIFs and matrixTypes order the alternatives errors suggest
+var (
+	matrixTIFs  = []string{"day", "gtc", "ioc", "fok", "opg", "cls"}
+	matrixTypes = []string{"market", "limit", "stop", "stop_limit"}
+)
+
+// TimeInForceAllowed reports whether an order of orderType in assetClass
+// may use tif
+func TimeInForceAllowed(assetClass, orderType, tif string) bool {
+	return slices.Contains(timeInForces[assetClass][tif], orderType)
+}
+
+// TimeInForcesFor returns the time in force values an order of orderType in
+// assetClass may use
+func TimeInForcesFor(assetClass, orderType string) []string {
+	var out []string
+	for _, tif := range matrixTIFs {
+		if TimeInForceAllowed(assetClass, orderType, tif) {
+			out = append(out, tif)
+		}
+	}
+	return out
+}
+
+// typesFor returns the order types assetClass supports with any time in force
+func typesFor(assetClass string) []string {
+	var out []string
+	for _, orderType := range matrixTypes {
+		if len(TimeInForcesFor(assetClass, orderType)) > 0 {
+			out = append(out, orderType)
+		}
+	}
+	return out
+}
+
+// checkMatrix rejects an order whose type its asset class doesn't support,
+// or whose time in force isn't valid with its type
+func checkMatrix(order *Order) error {
+	tifs := TimeInForcesFor(order.AssetClass, order.Type)
+	if len(tifs) == 0 {
+		return invalid("order_type", "%s orders are not supported for %s; use %s",
+			order.Type, order.AssetClass, alternatives(typesFor(order.AssetClass)))
+	}
+	if !slices.Contains(tifs, order.TimeInForce) {
+		return invalid("time_in_force", "%s is not valid for %s orders on %s; use %s",
+			order.TimeInForce, order.Type, order.AssetClass, alternatives(tifs))
+	}
+	return nil
+}
+
+// checkExtendedHours rejects an extended-hours order Alpaca would: only
+// equities trade outside the regular session, and only as day limit orders
+func checkExtendedHours(order *Order) error {
+	if !order.ExtendedHours {
+		return nil
+	}
+	switch {
+	case order.AssetClass == AssetClassCrypto:
+		return invalid("extended_hours", "%s trades around the clock; extended_hours is for us_equity orders", order.AssetClass)
+	case order.AssetClass != AssetClassEquity:
+		return invalid("extended_hours", "%s trades only in the regular session; extended_hours is for us_equity orders", order.AssetClass)
+	case order.Type != "limit":
+		return invalid("order_type", "%s is not valid for extended-hours orders; use limit", order.Type)
+	case order.TimeInForce != "day":
+		return invalid("time_in_force", "%s is not valid for extended-hours orders; use day", order.TimeInForce)
+	}
+	return nil
+}
+
+// alternatives lists values as "a, b or c"
+func alternatives(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
+// builtinTimeInForces are Alpaca's usual choices: day for equities, which
+// fractional orders require, and options, and gtc for crypto, which has no
+// session
+var builtinTimeInForces = map[string]string{
+	AssetClassEquity: "day",
+	AssetClassCrypto: "gtc",
+	AssetClassOption: "day",
+}
+
+// TimeInForceDefaults maps an asset class to the time in force its orders
+// get when neither they nor their user's preferences state one. Classes it
+// doesn't set use the built-in default.
+type TimeInForceDefaults map[string]string
+
+// Set makes tif the default for assetClass. It must be valid for every
+// order type the class supports, so the default never makes an order
+// invalid.
+func (d TimeInForceDefaults) Set(assetClass, tif string) error {
+	if _, ok := timeInForces[assetClass]; !ok {
+		return fmt.Errorf("unknown asset class %q", assetClass)
+	}
+	var valid []string
+	for _, candidate := range matrixTIFs {
+		ok := true
+		for _, orderType := range typesFor(assetClass) {
+			ok = ok && TimeInForceAllowed(assetClass, orderType, candidate)
+		}
+		if ok {
+			valid = append(valid, candidate)
+		}
+	}
+	if !slices.Contains(valid, tif) {
+		return fmt.Errorf("%q is not valid for every %s order; use %s", tif, assetClass, alternatives(valid))
+	}
+	d[assetClass] = tif
+	return nil
+}
+
+// For returns the default time in force for assetClass
+func (d TimeInForceDefaults) For(assetClass string) string {
+	if tif, ok := d[assetClass]; ok {
+		return tif
+	}
+	return builtinTimeInForces[assetClass]
+}
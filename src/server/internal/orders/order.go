@@ -0,0 +1,195 @@
+package orders
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/instruments"
+	orderprotos "desk/internal/protos/orders"
+	"desk/internal/symbols"
+)
+
+// Asset classes the desk trades
+const (
+	AssetClassEquity = instruments.AssetClassEquity
+	AssetClassCrypto = instruments.AssetClassCrypto
+	AssetClassOption = instruments.AssetClassOption
+)
+
+// Order is a validated order with typed quantities and prices. It is built
+// from an OrderRequest at the API boundary and is what brokers receive.
+type Order struct {
+	Symbol      string
+	AssetClass  string
+	Side        string
+	Type        string
+	TimeInForce string
+	Qty         decimal.Decimal
+	LimitPrice  *decimal.Decimal
+	StopPrice   *decimal.Decimal
+	// ExtendedHours lets the order trade in the pre-market and after-hours
+	// sessions as well as the regular one
+	ExtendedHours bool
+	// Sizing is set when the desk is to compute Qty, which stays zero until
+	// Size is called
+	Sizing *Sizing
+	// ReceivedAt is when the desk received the order, from clock.Now
+	ReceivedAt time.Time
+	// ClientTime is when the client says it generated the order and Nonce
+	// its unique ID for it, if it sent them
+	ClientTime *time.Time
+	Nonce      string
+	// ClientOrderID is the desk's ID for the order (see NewID), sent to the
+	// broker as client_order_id
+	ClientOrderID string
+	// HedgeRule names the hedge rule that placed the order, if the desk
+	// placed it as a hedge
+	HedgeRule string
+	// Source is the channel the order came in through (see SourceManual
+	// and the rest)
+	Source string
+}
+
+// ValidationError reports an order that was rejected before reaching a broker
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+func invalid(field, format string, args ...any) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	validSides = map[string]bool{"buy": true, "sell": true}
+	validTypes = map[string]bool{"market": true, "limit": true, "stop": true, "stop_limit": true}
+	validTIFs  = map[string]bool{"day": true, "gtc": true, "ioc": true, "fok": true, "opg": true, "cls": true}
+)
+
+// ValidType reports whether FromRequest accepts orderType for some asset
+// class
+func ValidType(orderType string) bool {
+	return validTypes[orderType]
+}
+
+// ValidTimeInForce reports whether FromRequest accepts tif for some order
+// type (see TimeInForceAllowed)
+func ValidTimeInForce(tif string) bool {
+	return validTIFs[tif]
+}
+
+// AssetClassOf infers the asset class from the symbol format, as the
+// instrument rules do
+func AssetClassOf(symbol string) string {
+	return instruments.AssetClassOf(symbol)
+}
+
+// FromRequest validates an OrderRequest and converts it to an Order, its
+// quantity and prices against the symbol's rules in reg. Any error returned
+// is a *ValidationError.
+func FromRequest(req *orderprotos.OrderRequest, reg *instruments.Registry) (*Order, error) {
+	order := &Order{
+		Symbol:      symbols.Normalize(req.GetSymbol()),
+		Side:        req.GetSide(),
+		Type:        req.GetOrderType(),
+		TimeInForce: req.GetTimeInForce(),
+
+		ExtendedHours: req.GetExtendedHours(),
+	}
+
+	if order.Symbol == "" {
+		return nil, invalid("symbol", "symbol is required")
+	}
+	if !validSides[order.Side] {
+		return nil, invalid("side", "%q is not buy or sell", order.Side)
+	}
+	if !validTypes[order.Type] {
+		return nil, invalid("order_type", "%q is not a supported order type", order.Type)
+	}
+	if !validTIFs[order.TimeInForce] {
+		return nil, invalid("time_in_force", "%q is not a supported time in force", order.TimeInForce)
+	}
+
+	order.AssetClass = AssetClassOf(order.Symbol)
+	inst := reg.Lookup(order.Symbol)
+	if err := checkMatrix(order); err != nil {
+		return nil, err
+	}
+	if err := checkExtendedHours(order); err != nil {
+		return nil, err
+	}
+
+	sizing, err := sizingFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if sizing != nil {
+		order.Sizing = sizing
+	} else {
+		qty, err := parsePositive("qty", req.GetQty())
+		if err != nil {
+			return nil, err
+		}
+		if err := inst.CheckQty(qty); err != nil {
+			return nil, invalid("qty", "%v", err)
+		}
+		// Alpaca only takes fractional shares as day orders
+		if inst.Fractional(qty) && order.TimeInForce != "day" {
+			return nil, invalid("time_in_force", "%s is not valid for fractional quantities of %s; use day", order.TimeInForce, order.AssetClass)
+		}
+		order.Qty = qty
+	}
+
+	needsLimit := order.Type == "limit" || order.Type == "stop_limit"
+	needsStop := order.Type == "stop" || order.Type == "stop_limit"
+
+	if order.LimitPrice, err = parsePrice("limit_price", req.GetLimitPrice(), needsLimit, inst); err != nil {
+		return nil, err
+	}
+	if order.StopPrice, err = parsePrice("stop_price", req.GetStopPrice(), needsStop, inst); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func parsePositive(field, value string) (decimal.Decimal, error) {
+	if value == "" {
+		return decimal.Zero, invalid(field, "%s is required", field)
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero, invalid(field, "%q is not a number", value)
+	}
+	if !d.IsPositive() {
+		return decimal.Zero, invalid(field, "%s must be positive", d)
+	}
+	return d, nil
+}
+
+func parsePrice(field, value string, required bool, inst instruments.Instrument) (*decimal.Decimal, error) {
+	if value == "" {
+		if required {
+			return nil, invalid(field, "%s is required for this order type", field)
+		}
+		return nil, nil
+	}
+	if !required {
+		return nil, invalid(field, "%s is not used by this order type", field)
+	}
+
+	price, err := parsePositive(field, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := inst.CheckPrice(price); err != nil {
+		return nil, invalid(field, "%v", err)
+	}
+	return &price, nil
+}
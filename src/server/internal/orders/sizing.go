@@ -0,0 +1,124 @@
+package orders
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/instruments"
+	orderprotos "desk/internal/protos/orders"
+)
+
+// Sizing modes
+const (
+	SizingRisk     = "risk_per_trade"
+	SizingFraction = "equity_fraction"
+)
+
+// Sizing asks the desk to compute an order's quantity from account equity
+// instead of taking a share count
+type Sizing struct {
+	Mode string
+	// Fraction of equity to risk, or to allocate
+	Fraction decimal.Decimal
+	// StopDistance is the per-unit loss if the stop is hit, for risk sizing.
+	// Nil means the distance from the entry price to the order's stop price.
+	StopDistance *decimal.Decimal
+}
+
+// sizingFromRequest validates the sizing fields of a request, returning nil if
+// the request doesn't use sizing
+func sizingFromRequest(req *orderprotos.OrderRequest) (*Sizing, error) {
+	risk, fraction := req.GetRiskPerTrade(), req.GetEquityFraction()
+	if risk == "" && fraction == "" {
+		if req.GetStopDistance() != "" {
+			return nil, invalid("stop_distance", "stop_distance is only used with risk_per_trade")
+		}
+		return nil, nil
+	}
+	if risk != "" && fraction != "" {
+		return nil, invalid("risk_per_trade", "set either risk_per_trade or equity_fraction, not both")
+	}
+	if req.GetQty() != "" {
+		return nil, invalid("qty", "qty must be empty when the desk sizes the order")
+	}
+
+	sizing := &Sizing{Mode: SizingRisk}
+	field, value := SizingRisk, risk
+	if fraction != "" {
+		sizing.Mode, field, value = SizingFraction, SizingFraction, fraction
+	}
+	f, err := parsePositive(field, value)
+	if err != nil {
+		return nil, err
+	}
+	if f.GreaterThan(decimal.NewFromInt(1)) {
+		return nil, invalid(field, "%s is more than all of equity", f)
+	}
+	sizing.Fraction = f
+
+	if v := req.GetStopDistance(); v != "" {
+		if sizing.Mode != SizingRisk {
+			return nil, invalid("stop_distance", "stop_distance is only used with risk_per_trade")
+		}
+		distance, err := parsePositive("stop_distance", v)
+		if err != nil {
+			return nil, err
+		}
+		sizing.StopDistance = &distance
+	} else if sizing.Mode == SizingRisk && req.GetStopPrice() == "" {
+		return nil, invalid("stop_distance", "risk_per_trade needs stop_distance or a stop_price")
+	}
+	return sizing, nil
+}
+
+// Size sets the quantity of an order that asked to be sized: equity times the
+// fraction at risk divided by the stop distance, or equity times the fraction
+// allocated divided by the entry price. The entry price is the limit price if
+// there is one, else price. The quantity is rounded down to whole lots of
+// inst, the order's instrument.
+func (o *Order) Size(equity, price decimal.Decimal, inst instruments.Instrument) error {
+	s := o.Sizing
+	if s == nil {
+		return nil
+	}
+	if !equity.IsPositive() {
+		return fmt.Errorf("cannot size order: account equity is %s", equity)
+	}
+	entry := price
+	if o.LimitPrice != nil {
+		entry = *o.LimitPrice
+	}
+	if !entry.IsPositive() {
+		return fmt.Errorf("cannot size order: no price for %s", o.Symbol)
+	}
+
+	budget := equity.Mul(s.Fraction)
+	var qty decimal.Decimal
+	switch s.Mode {
+	case SizingRisk:
+		var distance decimal.Decimal
+		switch {
+		case s.StopDistance != nil:
+			distance = *s.StopDistance
+		case o.StopPrice != nil:
+			distance = entry.Sub(*o.StopPrice).Abs()
+		default:
+			return invalid("stop_distance", "risk_per_trade needs stop_distance or a stop_price")
+		}
+		if !distance.IsPositive() {
+			return invalid("stop_distance", "the stop is at the entry price")
+		}
+		qty = budget.Div(distance)
+	case SizingFraction:
+		qty = budget.Div(entry)
+	}
+
+	qty = inst.RoundQty(qty)
+	if !qty.IsPositive() {
+		return invalid("qty", "%s of equity %s sizes to less than the smallest order of %s at %s",
+			s.Fraction, equity.StringFixed(2), o.Symbol, entry)
+	}
+	o.Qty = qty
+	return nil
+}
@@ -0,0 +1,45 @@
+package orders
+
+// Sources are the channels an order can come in through
+const (
+	// SourceManual is an order a person placed by hand, such as a
+	// confirmed ticket or an order entered on the dashboard
+	SourceManual = "manual"
+	// SourceAPI is an order a program placed through the API, such as a
+	// strategy
+	SourceAPI = "api"
+	// SourceWebhook is an order relayed from an alert, such as a charting
+	// platform's webhook
+	SourceWebhook = "webhook"
+	// SourceScheduler is an order the desk placed on a schedule or trigger:
+	// conditional orders and overnight reductions
+	SourceScheduler = "scheduler"
+	// SourceAlgo is an order the desk's own algorithms placed: hedges,
+	// netted orders and kill switch flattening
+	SourceAlgo = "algo"
+	// SourceSweep is an order the desk's cash manager placed to move idle
+	// cash into or out of its sweep fund
+	SourceSweep = "sweep"
+)
+
+var (
+	validSources  = map[string]bool{SourceManual: true, SourceAPI: true, SourceWebhook: true, SourceScheduler: true, SourceAlgo: true, SourceSweep: true}
+	clientSources = map[string]bool{SourceManual: true, SourceAPI: true, SourceWebhook: true}
+)
+
+// Sources returns every order source
+func Sources() []string {
+	return []string{SourceManual, SourceAPI, SourceWebhook, SourceScheduler, SourceAlgo, SourceSweep}
+}
+
+// ValidSource reports whether source is an order source
+func ValidSource(source string) bool {
+	return validSources[source]
+}
+
+// ClientSource reports whether a client may say its order came in through
+// source. Scheduler, algo and sweep orders are only placed by the desk
+// itself.
+func ClientSource(source string) bool {
+	return clientSources[source]
+}
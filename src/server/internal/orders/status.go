@@ -0,0 +1,121 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Order statuses the broker reports, and the desk records itself when it
+// expires, cancels or replaces an order
+const (
+	StatusPendingNew         = "pending_new"
+	StatusAcceptedForBidding = "accepted_for_bidding"
+	StatusNew                = "new"
+	StatusAccepted           = "accepted"
+	StatusHeld               = "held"
+	StatusCalculated         = "calculated"
+	StatusStopped            = "stopped"
+	StatusSuspended          = "suspended"
+	StatusDoneForDay         = "done_for_day"
+	StatusPendingCancel      = "pending_cancel"
+	StatusPendingReplace     = "pending_replace"
+	StatusPartiallyFilled    = "partially_filled"
+	StatusFilled             = "filled"
+	StatusCanceled           = "canceled"
+	StatusExpired            = "expired"
+	StatusRejected           = "rejected"
+	StatusReplaced           = "replaced"
+)
+
+// stages order the statuses an order moves through: pending, working,
+// partially filled and finished. Statuses of the working stage, such as
+// pending_cancel, can also follow fills.
+const (
+	stagePending = iota
+	stageWorking
+	stagePartial
+	stageTerminal
+)
+
+var stages = map[string]int{
+	StatusPendingNew:         stagePending,
+	StatusAcceptedForBidding: stagePending,
+	StatusNew:                stageWorking,
+	StatusAccepted:           stageWorking,
+	StatusHeld:               stageWorking,
+	StatusCalculated:         stageWorking,
+	StatusStopped:            stageWorking,
+	StatusSuspended:          stageWorking,
+	StatusDoneForDay:         stageWorking,
+	StatusPendingCancel:      stageWorking,
+	StatusPendingReplace:     stageWorking,
+	StatusPartiallyFilled:    stagePartial,
+	StatusFilled:             stageTerminal,
+	StatusCanceled:           stageTerminal,
+	StatusExpired:            stageTerminal,
+	StatusRejected:           stageTerminal,
+	StatusReplaced:           stageTerminal,
+}
+
+// ErrIllegalTransition is wrapped by the errors CheckTransition returns
+var ErrIllegalTransition = errors.New("illegal order transition")
+
+// CheckTransition returns an error wrapping ErrIllegalTransition if an order
+// can't move from status from with fromFilled filled to status to with
+// toFilled filled:
+//
+//   - a finished order (filled, canceled, expired, rejected or replaced)
+//     never changes
+//   - a working order never goes back to pending
+//   - an order with fills is never new, accepted or rejected
+//   - the filled quantity never falls
+//   - the new status must be one the broker reports
+//
+// A status that doesn't change is always allowed. Orders in a status the
+// desk doesn't know may move to any known one.
+func CheckTransition(from, to string, fromFilled, toFilled decimal.Decimal) error {
+	if toFilled.LessThan(fromFilled) {
+		return fmt.Errorf("%w: filled quantity fell from %s to %s", ErrIllegalTransition, fromFilled, toFilled)
+	}
+	if from == to {
+		return nil
+	}
+	toStage, ok := stages[to]
+	if !ok {
+		return fmt.Errorf("%w: unknown status %q", ErrIllegalTransition, to)
+	}
+	fromStage, ok := stages[from]
+	if !ok {
+		return nil
+	}
+
+	filled := fromFilled.IsPositive() || fromStage == stagePartial
+	switch {
+	case fromStage == stageTerminal:
+		return fmt.Errorf("%w: %s order can't become %s", ErrIllegalTransition, from, to)
+	case toStage == stagePending:
+		return fmt.Errorf("%w: %s order can't go back to %s", ErrIllegalTransition, from, to)
+	case filled && (to == StatusNew || to == StatusAccepted || to == StatusRejected):
+		return fmt.Errorf("%w: %s order has fills and can't become %s", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
+
+// TerminalStatuses returns every terminal order status
+func TerminalStatuses() []string {
+	var statuses []string
+	for s, stage := range stages {
+		if stage == stageTerminal {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses
+}
+
+// IsTerminal reports whether an order in this status is finished
+func IsTerminal(status string) bool {
+	stage, ok := stages[status]
+	return ok && stage == stageTerminal
+}
@@ -0,0 +1,51 @@
+package orders
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		name                 string
+		from, to             string
+		fromFilled, toFilled string
+		legal                bool
+	}{
+		{"pending to new", StatusPendingNew, StatusNew, "0", "0", true},
+		{"new to accepted", StatusNew, StatusAccepted, "0", "0", true},
+		{"accepted to partially filled", StatusAccepted, StatusPartiallyFilled, "0", "40", true},
+		{"partially filled to pending cancel", StatusPartiallyFilled, StatusPendingCancel, "40", "40", true},
+		{"pending cancel to filled", StatusPendingCancel, StatusFilled, "40", "100", true},
+		{"partially filled to filled", StatusPartiallyFilled, StatusFilled, "40", "100", true},
+		{"unchanged", StatusNew, StatusNew, "0", "0", true},
+		{"unknown to known", "mystery", StatusNew, "0", "0", true},
+
+		{"filled to canceled", StatusFilled, StatusCanceled, "100", "100", false},
+		{"canceled to new", StatusCanceled, StatusNew, "0", "0", false},
+		{"expired to partially filled", StatusExpired, StatusPartiallyFilled, "0", "10", false},
+		{"rejected to accepted", StatusRejected, StatusAccepted, "0", "0", false},
+		{"replaced to filled", StatusReplaced, StatusFilled, "0", "100", false},
+		{"new to pending new", StatusNew, StatusPendingNew, "0", "0", false},
+		{"accepted to accepted for bidding", StatusAccepted, StatusAcceptedForBidding, "0", "0", false},
+		{"filled to rejected", StatusFilled, StatusRejected, "100", "100", false},
+		{"partially filled to rejected", StatusPartiallyFilled, StatusRejected, "40", "40", false},
+		{"partially filled to new", StatusPartiallyFilled, StatusNew, "40", "40", false},
+		{"filled quantity falls", StatusPartiallyFilled, StatusPartiallyFilled, "40", "30", false},
+		{"filled quantity falls to filled", StatusPartiallyFilled, StatusFilled, "40", "30", false},
+		{"unknown status", StatusNew, "mystery", "0", "0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTransition(tt.from, tt.to, decimal.RequireFromString(tt.fromFilled), decimal.RequireFromString(tt.toFilled))
+			switch {
+			case tt.legal && err != nil:
+				t.Errorf("CheckTransition(%s, %s) = %v, want nil", tt.from, tt.to, err)
+			case !tt.legal && !errors.Is(err, ErrIllegalTransition):
+				t.Errorf("CheckTransition(%s, %s) = %v, want ErrIllegalTransition", tt.from, tt.to, err)
+			}
+		})
+	}
+}
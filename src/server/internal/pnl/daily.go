@@ -0,0 +1,126 @@
+package pnl
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// TradingDay returns the trade date a fill at t is aggregated under: the
+// America/New_York session date, so DST changes never split a session
+func TradingDay(t time.Time) string {
+	return market.SessionDate(t)
+}
+
+// DailyRecorder folds fills into the daily_aggregates table as they happen
+type DailyRecorder struct {
+	db *database.DB
+}
+
+func NewDailyRecorder(db *database.DB) *DailyRecorder {
+	return &DailyRecorder{
+		db: db,
+	}
+}
+
+// RecordFill aggregates a fill of qty at price for the given trade
+func (r *DailyRecorder) RecordFill(trade database.Trade, qty, price decimal.Decimal, at time.Time) error {
+	return r.db.RecordDailyFill(dailyFill(trade, qty, price, at), bookAverageCost)
+}
+
+// dailyFill describes a fill of qty at price on trade for the aggregates
+func dailyFill(trade database.Trade, qty, price decimal.Decimal, at time.Time) database.DailyFill {
+	fill := database.DailyFill{
+		TradeDate: TradingDay(at),
+		UserID:    trade.UserID,
+		Symbol:    trade.Symbol,
+		Side:      trade.Side,
+		Qty:       qty,
+		Price:     price,
+	}
+	if trade.StrategyID != nil {
+		fill.StrategyID = *trade.StrategyID
+	}
+	return fill
+}
+
+// RecordTrade aggregates everything filled on a trade. It is a no-op for
+// trades with nothing filled.
+func (r *DailyRecorder) RecordTrade(trade database.Trade) error {
+	f, ok := FillFromTrade(trade)
+	if !ok {
+		return nil
+	}
+
+	at := trade.SubmittedAt
+	if trade.FilledAt != nil {
+		at = *trade.FilledAt
+	}
+
+	return r.RecordFill(trade, f.Qty, f.Price, at)
+}
+
+// Backfill replays all filled trades into an empty aggregates table, and the
+// cash they moved into an empty cash ledger. It does nothing once both have
+// rows, so it is safe to call on every startup.
+func (r *DailyRecorder) Backfill() error {
+	hasAggregates, err := r.db.HasDailyAggregates()
+	if err != nil {
+		return err
+	}
+	hasCash, err := r.db.HasDailyCash()
+	if err != nil || (hasAggregates && hasCash) {
+		return err
+	}
+
+	trades, err := r.db.GetFilledTrades()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range trades {
+		if !hasAggregates {
+			err = r.RecordTrade(t)
+		} else {
+			err = r.recordTradeCash(t)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to backfill trade %d: %w", t.ID, err)
+		}
+	}
+
+	if len(trades) > 0 {
+		if !hasAggregates {
+			log.Printf("Backfilled daily aggregates from %d filled trades", len(trades))
+		} else {
+			log.Printf("Backfilled daily cash ledger from %d filled trades", len(trades))
+		}
+	}
+	return nil
+}
+
+// recordTradeCash records the cash a trade's fill moved, without touching
+// the aggregates
+func (r *DailyRecorder) recordTradeCash(trade database.Trade) error {
+	f, ok := FillFromTrade(trade)
+	if !ok {
+		return nil
+	}
+
+	at := trade.SubmittedAt
+	if trade.FilledAt != nil {
+		at = *trade.FilledAt
+	}
+	return r.db.RecordFillCash(dailyFill(trade, f.Qty, f.Price, at))
+}
+
+func bookAverageCost(basis database.CostBasis, fill database.DailyFill) (database.CostBasis, decimal.Decimal) {
+	h := Holding{Qty: basis.Qty, AvgCost: basis.AvgCost}
+	realized := h.Apply(fill.Side, fill.Qty, fill.Price)
+	return database.CostBasis{Qty: h.Qty, AvgCost: h.AvgCost}, realized
+}
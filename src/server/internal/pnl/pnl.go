@@ -0,0 +1,139 @@
+package pnl
+
+import (
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+)
+
+// Fill is a single execution used for P&L accounting
+type Fill struct {
+	Symbol string
+	Side   string
+	Qty    decimal.Decimal
+	Price  decimal.Decimal
+}
+
+// Holding is a signed position carried at average cost
+type Holding struct {
+	Qty     decimal.Decimal
+	AvgCost decimal.Decimal
+}
+
+// Ledger accumulates fills using average-cost accounting. Short positions are
+// supported: selling through zero opens a short at the fill price.
+type Ledger struct {
+	Holdings map[string]*Holding
+	Realized decimal.Decimal
+	Turnover decimal.Decimal
+	Fills    int
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		Holdings: make(map[string]*Holding),
+	}
+}
+
+// Apply books a fill against the ledger
+func (l *Ledger) Apply(f Fill) {
+	if f.Qty.IsZero() {
+		return
+	}
+
+	h, ok := l.Holdings[f.Symbol]
+	if !ok {
+		h = &Holding{}
+		l.Holdings[f.Symbol] = h
+	}
+
+	l.Fills++
+	l.Turnover = l.Turnover.Add(f.Qty.Mul(f.Price))
+	l.Realized = l.Realized.Add(h.Apply(f.Side, f.Qty, f.Price))
+}
+
+// Apply books a fill against the holding and returns the P&L it realizes
+func (h *Holding) Apply(side string, qty, price decimal.Decimal) decimal.Decimal {
+	signed := qty
+	if side == "sell" {
+		signed = signed.Neg()
+	}
+
+	// Opening or adding to a position
+	if h.Qty.IsZero() || h.Qty.Sign() == signed.Sign() {
+		total := h.Qty.Abs().Add(qty)
+		h.AvgCost = h.AvgCost.Mul(h.Qty.Abs()).Add(price.Mul(qty)).Div(total)
+		h.Qty = h.Qty.Add(signed)
+		return decimal.Zero
+	}
+
+	// Reducing, closing, or flipping a position
+	closing := decimal.Min(qty, h.Qty.Abs())
+	realized := price.Sub(h.AvgCost).Mul(closing)
+	if h.Qty.IsNegative() {
+		realized = realized.Neg()
+	}
+
+	direction := decimal.NewFromInt(int64(signed.Sign()))
+	remaining := qty.Sub(closing)
+	h.Qty = h.Qty.Add(closing.Mul(direction))
+	if remaining.IsPositive() {
+		h.Qty = remaining.Mul(direction)
+		h.AvgCost = price
+	} else if h.Qty.IsZero() {
+		h.AvgCost = decimal.Zero
+	}
+
+	return realized
+}
+
+// Unrealized marks open holdings to the supplied prices. Symbols without a
+// mark are skipped.
+func (l *Ledger) Unrealized(marks map[string]decimal.Decimal) decimal.Decimal {
+	total := decimal.Zero
+	for symbol, h := range l.Holdings {
+		mark, ok := marks[symbol]
+		if !ok || h.Qty.IsZero() {
+			continue
+		}
+		total = total.Add(mark.Sub(h.AvgCost).Mul(h.Qty))
+	}
+	return total
+}
+
+// OpenSymbols returns the symbols with a non-zero holding
+func (l *Ledger) OpenSymbols() []string {
+	var symbols []string
+	for symbol, h := range l.Holdings {
+		if !h.Qty.IsZero() {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// FillFromTrade converts a trade record into a fill. Trades with nothing
+// filled are reported as not ok.
+func FillFromTrade(t database.Trade) (Fill, bool) {
+	if t.FilledAvgPrice == nil || !t.FilledQty.IsPositive() {
+		return Fill{}, false
+	}
+
+	return Fill{
+		Symbol: t.Symbol,
+		Side:   t.Side,
+		Qty:    t.FilledQty,
+		Price:  *t.FilledAvgPrice,
+	}, true
+}
+
+// LedgerFromTrades books every filled trade into a new ledger
+func LedgerFromTrades(trades []database.Trade) *Ledger {
+	l := NewLedger()
+	for _, t := range trades {
+		if f, ok := FillFromTrade(t); ok {
+			l.Apply(f)
+		}
+	}
+	return l
+}
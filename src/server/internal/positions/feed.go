@@ -0,0 +1,174 @@
+package positions
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"desk/internal/database"
+	"desk/internal/risk"
+	"desk/internal/stream"
+)
+
+// Key identifies a position
+type Key struct {
+	UserID     string
+	StrategyID int64
+	Symbol     string
+}
+
+// KeyOf returns the key of a marked position
+func KeyOf(p database.PositionMark) Key {
+	return Key{UserID: p.UserID, StrategyID: p.StrategyID, Symbol: p.Symbol}
+}
+
+// Delta is what changed between two refreshes of the positions, or a new
+// risk snapshot. Seq numbers every delta the feed publishes, so a
+// subscriber that sees one skipped knows it missed a change.
+type Delta struct {
+	Seq      uint64
+	Upserted []database.PositionMark
+	Removed  []Key
+	Risk     *risk.Snapshot
+}
+
+// State is the feed's positions and risk as of Seq
+type State struct {
+	Seq       uint64
+	Positions []database.PositionMark
+	Risk      *risk.Snapshot
+}
+
+// RiskSource publishes risk snapshots
+type RiskSource interface {
+	Subscribe() (<-chan risk.Snapshot, func())
+}
+
+// Feed keeps the latest marked positions and risk snapshot and publishes
+// what changes. Subscribers start from a State and apply deltas to it; a
+// subscriber that can't keep up has deltas dropped, and the gap in Seq
+// tells it to start again from a new State.
+type Feed struct {
+	risk RiskSource
+	hub  *stream.Hub[Delta]
+
+	// mu orders publishing and subscribing, so a subscriber's first delta
+	// follows the State it subscribed at
+	mu        sync.Mutex
+	seq       uint64
+	positions map[Key]database.PositionMark
+	latest    *risk.Snapshot
+}
+
+func NewFeed(riskSource RiskSource) *Feed {
+	return &Feed{
+		risk:      riskSource,
+		hub:       stream.NewHub[Delta](64),
+		positions: make(map[Key]database.PositionMark),
+	}
+}
+
+// Run publishes risk snapshots until ctx is cancelled
+func (f *Feed) Run(ctx context.Context) {
+	snapshots, unsubscribe := f.risk.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case snap, ok := <-snapshots:
+			if !ok {
+				return
+			}
+			f.mu.Lock()
+			f.latest = &snap
+			f.publish(Delta{Risk: &snap})
+			f.mu.Unlock()
+		}
+	}
+}
+
+// Refreshed publishes the positions that opened, closed or were marked to
+// a new price since the last refresh. It is meant for marks.Engine's
+// OnRefresh and doesn't block.
+func (f *Feed) Refreshed(positions []database.PositionMark) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var delta Delta
+	seen := make(map[Key]bool, len(positions))
+	for _, p := range positions {
+		key := KeyOf(p)
+		seen[key] = true
+		if previous, ok := f.positions[key]; ok && !changed(previous, p) {
+			continue
+		}
+		f.positions[key] = p
+		delta.Upserted = append(delta.Upserted, p)
+	}
+	for key := range f.positions {
+		if !seen[key] {
+			delete(f.positions, key)
+			delta.Removed = append(delta.Removed, key)
+		}
+	}
+
+	if len(delta.Upserted) > 0 || len(delta.Removed) > 0 {
+		f.publish(delta)
+	}
+}
+
+// publish numbers and sends a delta. f.mu must be held.
+func (f *Feed) publish(delta Delta) {
+	f.seq++
+	delta.Seq = f.seq
+	f.hub.Publish(delta)
+}
+
+// Subscribe registers for deltas, returning the State the first one
+// applies to. The returned function must be called to unsubscribe.
+func (f *Feed) Subscribe() (<-chan Delta, State, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deltas, unsubscribe := f.hub.Subscribe()
+	return deltas, f.state(), unsubscribe
+}
+
+// Snapshot returns the current State
+func (f *Feed) Snapshot() State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state()
+}
+
+// state copies the positions, ordered by key. f.mu must be held.
+func (f *Feed) state() State {
+	state := State{Seq: f.seq, Positions: make([]database.PositionMark, 0, len(f.positions)), Risk: f.latest}
+	for _, p := range f.positions {
+		state.Positions = append(state.Positions, p)
+	}
+	slices.SortFunc(state.Positions, func(a, b database.PositionMark) int {
+		if c := strings.Compare(a.UserID, b.UserID); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.StrategyID, b.StrategyID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Symbol, b.Symbol)
+	})
+	return state
+}
+
+// StreamStats describes the positions stream's subscribers
+func (f *Feed) StreamStats() stream.Stats {
+	return f.hub.Stats()
+}
+
+// changed reports whether a position's quantity, cost or price moved. The
+// market value and P&L follow from them.
+func changed(a, b database.PositionMark) bool {
+	return !a.Qty.Equal(b.Qty) || !a.AvgCost.Equal(b.AvgCost) || !a.Price.Equal(b.Price)
+}
@@ -23,14 +23,22 @@ const (
 
 // OrderRequest represents a request to place a trading order
 type OrderRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`                                // Stock symbol (e.g., "AAPL")
-	Qty           string                 `protobuf:"bytes,2,opt,name=qty,proto3" json:"qty,omitempty"`                                      // Quantity as string to support decimals
-	Side          string                 `protobuf:"bytes,3,opt,name=side,proto3" json:"side,omitempty"`                                    // "buy" or "sell"
-	OrderType     string                 `protobuf:"bytes,4,opt,name=order_type,json=orderType,proto3" json:"order_type,omitempty"`         // "market", "limit", "stop", "stop_limit"
-	TimeInForce   string                 `protobuf:"bytes,5,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"` // "day", "gtc", "ioc", "fok"
-	LimitPrice    string                 `protobuf:"bytes,6,opt,name=limit_price,json=limitPrice,proto3" json:"limit_price,omitempty"`      // Optional: limit price for limit orders
-	StopPrice     string                 `protobuf:"bytes,7,opt,name=stop_price,json=stopPrice,proto3" json:"stop_price,omitempty"`         // Optional: stop price for stop orders
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Symbol      string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`                                // Stock symbol (e.g., "AAPL")
+	Qty         string                 `protobuf:"bytes,2,opt,name=qty,proto3" json:"qty,omitempty"`                                      // Quantity as string to support decimals
+	Side        string                 `protobuf:"bytes,3,opt,name=side,proto3" json:"side,omitempty"`                                    // "buy" or "sell"
+	OrderType   string                 `protobuf:"bytes,4,opt,name=order_type,json=orderType,proto3" json:"order_type,omitempty"`         // "market", "limit", "stop", "stop_limit"
+	TimeInForce string                 `protobuf:"bytes,5,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"` // "day", "gtc", "ioc", "fok"
+	LimitPrice  string                 `protobuf:"bytes,6,opt,name=limit_price,json=limitPrice,proto3" json:"limit_price,omitempty"`      // Optional: limit price for limit orders
+	StopPrice   string                 `protobuf:"bytes,7,opt,name=stop_price,json=stopPrice,proto3" json:"stop_price,omitempty"`         // Optional: stop price for stop orders
+	// Optional sizing: leave qty empty and set one of these modes to have the
+	// desk compute qty from account equity and the current (or limit) price
+	RiskPerTrade   string `protobuf:"bytes,8,opt,name=risk_per_trade,json=riskPerTrade,proto3" json:"risk_per_trade,omitempty"`      // Fraction of equity to lose if the stop is hit (e.g. "0.01"), with a stop distance
+	StopDistance   string `protobuf:"bytes,9,opt,name=stop_distance,json=stopDistance,proto3" json:"stop_distance,omitempty"`        // Price distance to the stop; defaults to the distance to stop_price
+	EquityFraction string `protobuf:"bytes,10,opt,name=equity_fraction,json=equityFraction,proto3" json:"equity_fraction,omitempty"` // Fraction of equity to put into the position (e.g. "0.05")
+	// Optional: also trade in the pre-market and after-hours sessions.
+	// Equities only, and the order must be a limit order with time_in_force "day".
+	ExtendedHours bool `protobuf:"varint,11,opt,name=extended_hours,json=extendedHours,proto3" json:"extended_hours,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -114,17 +122,46 @@ func (x *OrderRequest) GetStopPrice() string {
 	return ""
 }
 
+func (x *OrderRequest) GetRiskPerTrade() string {
+	if x != nil {
+		return x.RiskPerTrade
+	}
+	return ""
+}
+
+func (x *OrderRequest) GetStopDistance() string {
+	if x != nil {
+		return x.StopDistance
+	}
+	return ""
+}
+
+func (x *OrderRequest) GetEquityFraction() string {
+	if x != nil {
+		return x.EquityFraction
+	}
+	return ""
+}
+
+func (x *OrderRequest) GetExtendedHours() bool {
+	if x != nil {
+		return x.ExtendedHours
+	}
+	return false
+}
+
 // OrderResponse represents the response after placing an order
 type OrderResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`                              // "success" or "error"
-	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`             // Alpaca order ID
-	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                            // Optional error message or additional info
-	Symbol        string                 `protobuf:"bytes,4,opt,name=symbol,proto3" json:"symbol,omitempty"`                              // Echo back the symbol
-	Qty           string                 `protobuf:"bytes,5,opt,name=qty,proto3" json:"qty,omitempty"`                                    // Echo back the quantity
-	Side          string                 `protobuf:"bytes,6,opt,name=side,proto3" json:"side,omitempty"`                                  // Echo back the side
-	FilledQty     string                 `protobuf:"bytes,7,opt,name=filled_qty,json=filledQty,proto3" json:"filled_qty,omitempty"`       // Quantity filled so far
-	OrderStatus   string                 `protobuf:"bytes,8,opt,name=order_status,json=orderStatus,proto3" json:"order_status,omitempty"` // Alpaca order status: "new", "filled", "partially_filled", etc.
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`                                      // "success" or "error"
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`                     // Alpaca order ID
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                                    // Optional error message or additional info
+	Symbol        string                 `protobuf:"bytes,4,opt,name=symbol,proto3" json:"symbol,omitempty"`                                      // Echo back the symbol
+	Qty           string                 `protobuf:"bytes,5,opt,name=qty,proto3" json:"qty,omitempty"`                                            // Echo back the quantity
+	Side          string                 `protobuf:"bytes,6,opt,name=side,proto3" json:"side,omitempty"`                                          // Echo back the side
+	FilledQty     string                 `protobuf:"bytes,7,opt,name=filled_qty,json=filledQty,proto3" json:"filled_qty,omitempty"`               // Quantity filled so far
+	OrderStatus   string                 `protobuf:"bytes,8,opt,name=order_status,json=orderStatus,proto3" json:"order_status,omitempty"`         // Alpaca order status: "new", "filled", "partially_filled", etc.
+	ClientOrderId string                 `protobuf:"bytes,9,opt,name=client_order_id,json=clientOrderId,proto3" json:"client_order_id,omitempty"` // Desk-generated ULID sent to Alpaca as client_order_id
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -215,11 +252,18 @@ func (x *OrderResponse) GetOrderStatus() string {
 	return ""
 }
 
+func (x *OrderResponse) GetClientOrderId() string {
+	if x != nil {
+		return x.ClientOrderId
+	}
+	return ""
+}
+
 var File_order_proto protoreflect.FileDescriptor
 
 const file_order_proto_rawDesc = "" +
 	"\n" +
-	"\vorder.proto\x12\x06orders\"\xcf\x01\n" +
+	"\vorder.proto\x12\x06orders\"\xea\x02\n" +
 	"\fOrderRequest\x12\x16\n" +
 	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x10\n" +
 	"\x03qty\x18\x02 \x01(\tR\x03qty\x12\x12\n" +
@@ -230,7 +274,12 @@ const file_order_proto_rawDesc = "" +
 	"\vlimit_price\x18\x06 \x01(\tR\n" +
 	"limitPrice\x12\x1d\n" +
 	"\n" +
-	"stop_price\x18\a \x01(\tR\tstopPrice\"\xdc\x01\n" +
+	"stop_price\x18\a \x01(\tR\tstopPrice\x12$\n" +
+	"\x0erisk_per_trade\x18\b \x01(\tR\friskPerTrade\x12#\n" +
+	"\rstop_distance\x18\t \x01(\tR\fstopDistance\x12'\n" +
+	"\x0fequity_fraction\x18\n" +
+	" \x01(\tR\x0eequityFraction\x12%\n" +
+	"\x0eextended_hours\x18\v \x01(\bR\rextendedHours\"\x84\x02\n" +
 	"\rOrderResponse\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\tR\x06status\x12\x19\n" +
 	"\border_id\x18\x02 \x01(\tR\aorderId\x12\x18\n" +
@@ -240,7 +289,8 @@ const file_order_proto_rawDesc = "" +
 	"\x04side\x18\x06 \x01(\tR\x04side\x12\x1d\n" +
 	"\n" +
 	"filled_qty\x18\a \x01(\tR\tfilledQty\x12!\n" +
-	"\forder_status\x18\b \x01(\tR\vorderStatusB%Z#trading-desk/internal/protos/ordersb\x06proto3"
+	"\forder_status\x18\b \x01(\tR\vorderStatus\x12&\n" +
+	"\x0fclient_order_id\x18\t \x01(\tR\rclientOrderIdB%Z#trading-desk/internal/protos/ordersb\x06proto3"
 
 var (
 	file_order_proto_rawDescOnce sync.Once
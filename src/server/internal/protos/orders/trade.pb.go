@@ -0,0 +1,450 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.32.1
+// source: trade.proto
+
+package orders
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// TradeRecord is a single row of the trade blotter
+type TradeRecord struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Id                  int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	StrategyId          int64                  `protobuf:"varint,2,opt,name=strategy_id,json=strategyId,proto3" json:"strategy_id,omitempty"` // 0 if the trade is not attributed to a strategy
+	UserId              string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	OrderId             string                 `protobuf:"bytes,4,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Symbol              string                 `protobuf:"bytes,5,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Qty                 string                 `protobuf:"bytes,6,opt,name=qty,proto3" json:"qty,omitempty"`
+	Side                string                 `protobuf:"bytes,7,opt,name=side,proto3" json:"side,omitempty"`
+	OrderType           string                 `protobuf:"bytes,8,opt,name=order_type,json=orderType,proto3" json:"order_type,omitempty"`
+	TimeInForce         string                 `protobuf:"bytes,9,opt,name=time_in_force,json=timeInForce,proto3" json:"time_in_force,omitempty"`
+	LimitPrice          string                 `protobuf:"bytes,10,opt,name=limit_price,json=limitPrice,proto3" json:"limit_price,omitempty"`
+	StopPrice           string                 `protobuf:"bytes,11,opt,name=stop_price,json=stopPrice,proto3" json:"stop_price,omitempty"`
+	FilledQty           string                 `protobuf:"bytes,12,opt,name=filled_qty,json=filledQty,proto3" json:"filled_qty,omitempty"`
+	FilledAvgPrice      string                 `protobuf:"bytes,13,opt,name=filled_avg_price,json=filledAvgPrice,proto3" json:"filled_avg_price,omitempty"`
+	OrderStatus         string                 `protobuf:"bytes,14,opt,name=order_status,json=orderStatus,proto3" json:"order_status,omitempty"`
+	SubmittedAt         string                 `protobuf:"bytes,15,opt,name=submitted_at,json=submittedAt,proto3" json:"submitted_at,omitempty"` // RFC 3339 timestamp, UTC
+	FilledAt            string                 `protobuf:"bytes,16,opt,name=filled_at,json=filledAt,proto3" json:"filled_at,omitempty"`          // RFC 3339 timestamp, UTC, empty if not filled
+	ErrorMessage        string                 `protobuf:"bytes,17,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	Venue               string                 `protobuf:"bytes,18,opt,name=venue,proto3" json:"venue,omitempty"`                                                          // "alpaca" or "simulator"
+	SubmittedAtExchange string                 `protobuf:"bytes,19,opt,name=submitted_at_exchange,json=submittedAtExchange,proto3" json:"submitted_at_exchange,omitempty"` // submitted_at in exchange time (America/New_York)
+	FilledAtExchange    string                 `protobuf:"bytes,20,opt,name=filled_at_exchange,json=filledAtExchange,proto3" json:"filled_at_exchange,omitempty"`          // filled_at in exchange time, empty if not filled
+	SessionDate         string                 `protobuf:"bytes,21,opt,name=session_date,json=sessionDate,proto3" json:"session_date,omitempty"`                           // Exchange session date (YYYY-MM-DD) the trade belongs to
+	StrategyVersion     int64                  `protobuf:"varint,22,opt,name=strategy_version,json=strategyVersion,proto3" json:"strategy_version,omitempty"`              // Strategy version running when the order was placed, 0 if none
+	JournalEntryIds     []int64                `protobuf:"varint,23,rep,packed,name=journal_entry_ids,json=journalEntryIds,proto3" json:"journal_entry_ids,omitempty"`     // Journal entries written about the trade (see /journal)
+	ClientOrderId       string                 `protobuf:"bytes,24,opt,name=client_order_id,json=clientOrderId,proto3" json:"client_order_id,omitempty"`                   // Desk-generated ULID sent to Alpaca as client_order_id
+	ExtendedHours       bool                   `protobuf:"varint,25,opt,name=extended_hours,json=extendedHours,proto3" json:"extended_hours,omitempty"`                    // The order could trade in the pre-market and after-hours sessions
+	Session             string                 `protobuf:"bytes,26,opt,name=session,proto3" json:"session,omitempty"`                                                      // "pre", "regular", "post" or "closed": the session the trade filled in, or was submitted in if not filled
+	Source              string                 `protobuf:"bytes,27,opt,name=source,proto3" json:"source,omitempty"`                                                        // "manual", "api", "webhook", "scheduler", "algo" or "sweep": the channel the order came in through, empty if unknown
+	Dispute             string                 `protobuf:"bytes,28,opt,name=dispute,proto3" json:"dispute,omitempty"`                                                      // "open", "upheld" or "rejected": the status of the trade's latest dispute, empty if never disputed
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *TradeRecord) Reset() {
+	*x = TradeRecord{}
+	mi := &file_trade_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TradeRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TradeRecord) ProtoMessage() {}
+
+func (x *TradeRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_trade_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TradeRecord.ProtoReflect.Descriptor instead.
+func (*TradeRecord) Descriptor() ([]byte, []int) {
+	return file_trade_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TradeRecord) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TradeRecord) GetStrategyId() int64 {
+	if x != nil {
+		return x.StrategyId
+	}
+	return 0
+}
+
+func (x *TradeRecord) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetQty() string {
+	if x != nil {
+		return x.Qty
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSide() string {
+	if x != nil {
+		return x.Side
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetOrderType() string {
+	if x != nil {
+		return x.OrderType
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetTimeInForce() string {
+	if x != nil {
+		return x.TimeInForce
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetLimitPrice() string {
+	if x != nil {
+		return x.LimitPrice
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetStopPrice() string {
+	if x != nil {
+		return x.StopPrice
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetFilledQty() string {
+	if x != nil {
+		return x.FilledQty
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetFilledAvgPrice() string {
+	if x != nil {
+		return x.FilledAvgPrice
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetOrderStatus() string {
+	if x != nil {
+		return x.OrderStatus
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSubmittedAt() string {
+	if x != nil {
+		return x.SubmittedAt
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetFilledAt() string {
+	if x != nil {
+		return x.FilledAt
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetVenue() string {
+	if x != nil {
+		return x.Venue
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSubmittedAtExchange() string {
+	if x != nil {
+		return x.SubmittedAtExchange
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetFilledAtExchange() string {
+	if x != nil {
+		return x.FilledAtExchange
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSessionDate() string {
+	if x != nil {
+		return x.SessionDate
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetStrategyVersion() int64 {
+	if x != nil {
+		return x.StrategyVersion
+	}
+	return 0
+}
+
+func (x *TradeRecord) GetJournalEntryIds() []int64 {
+	if x != nil {
+		return x.JournalEntryIds
+	}
+	return nil
+}
+
+func (x *TradeRecord) GetClientOrderId() string {
+	if x != nil {
+		return x.ClientOrderId
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetExtendedHours() bool {
+	if x != nil {
+		return x.ExtendedHours
+	}
+	return false
+}
+
+func (x *TradeRecord) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *TradeRecord) GetDispute() string {
+	if x != nil {
+		return x.Dispute
+	}
+	return ""
+}
+
+// TradePage is one page of a user's trades, newest first
+type TradePage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Trades        []*TradeRecord         `protobuf:"bytes,1,rep,name=trades,proto3" json:"trades,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`  // Pass as ?cursor= to fetch the next page; empty on the last page
+	HasMore       bool                   `protobuf:"varint,3,opt,name=has_more,json=hasMore,proto3" json:"has_more,omitempty"`          // Whether another page exists
+	TotalCount    int64                  `protobuf:"varint,4,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"` // Total trades for the user, only set when include_total=true
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TradePage) Reset() {
+	*x = TradePage{}
+	mi := &file_trade_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TradePage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TradePage) ProtoMessage() {}
+
+func (x *TradePage) ProtoReflect() protoreflect.Message {
+	mi := &file_trade_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TradePage.ProtoReflect.Descriptor instead.
+func (*TradePage) Descriptor() ([]byte, []int) {
+	return file_trade_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *TradePage) GetTrades() []*TradeRecord {
+	if x != nil {
+		return x.Trades
+	}
+	return nil
+}
+
+func (x *TradePage) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+func (x *TradePage) GetHasMore() bool {
+	if x != nil {
+		return x.HasMore
+	}
+	return false
+}
+
+func (x *TradePage) GetTotalCount() int64 {
+	if x != nil {
+		return x.TotalCount
+	}
+	return 0
+}
+
+var File_trade_proto protoreflect.FileDescriptor
+
+const file_trade_proto_rawDesc = "" +
+	"\n" +
+	"\vtrade.proto\x12\x06orders\"\x91\x07\n" +
+	"\vTradeRecord\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1f\n" +
+	"\vstrategy_id\x18\x02 \x01(\x03R\n" +
+	"strategyId\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x19\n" +
+	"\border_id\x18\x04 \x01(\tR\aorderId\x12\x16\n" +
+	"\x06symbol\x18\x05 \x01(\tR\x06symbol\x12\x10\n" +
+	"\x03qty\x18\x06 \x01(\tR\x03qty\x12\x12\n" +
+	"\x04side\x18\a \x01(\tR\x04side\x12\x1d\n" +
+	"\n" +
+	"order_type\x18\b \x01(\tR\torderType\x12\"\n" +
+	"\rtime_in_force\x18\t \x01(\tR\vtimeInForce\x12\x1f\n" +
+	"\vlimit_price\x18\n" +
+	" \x01(\tR\n" +
+	"limitPrice\x12\x1d\n" +
+	"\n" +
+	"stop_price\x18\v \x01(\tR\tstopPrice\x12\x1d\n" +
+	"\n" +
+	"filled_qty\x18\f \x01(\tR\tfilledQty\x12(\n" +
+	"\x10filled_avg_price\x18\r \x01(\tR\x0efilledAvgPrice\x12!\n" +
+	"\forder_status\x18\x0e \x01(\tR\vorderStatus\x12!\n" +
+	"\fsubmitted_at\x18\x0f \x01(\tR\vsubmittedAt\x12\x1b\n" +
+	"\tfilled_at\x18\x10 \x01(\tR\bfilledAt\x12#\n" +
+	"\rerror_message\x18\x11 \x01(\tR\ferrorMessage\x12\x14\n" +
+	"\x05venue\x18\x12 \x01(\tR\x05venue\x122\n" +
+	"\x15submitted_at_exchange\x18\x13 \x01(\tR\x13submittedAtExchange\x12,\n" +
+	"\x12filled_at_exchange\x18\x14 \x01(\tR\x10filledAtExchange\x12!\n" +
+	"\fsession_date\x18\x15 \x01(\tR\vsessionDate\x12)\n" +
+	"\x10strategy_version\x18\x16 \x01(\x03R\x0fstrategyVersion\x12*\n" +
+	"\x11journal_entry_ids\x18\x17 \x03(\x03R\x0fjournalEntryIds\x12&\n" +
+	"\x0fclient_order_id\x18\x18 \x01(\tR\rclientOrderId\x12%\n" +
+	"\x0eextended_hours\x18\x19 \x01(\bR\rextendedHours\x12\x18\n" +
+	"\asession\x18\x1a \x01(\tR\asession\x12\x16\n" +
+	"\x06source\x18\x1b \x01(\tR\x06source\x12\x18\n" +
+	"\adispute\x18\x1c \x01(\tR\adispute\"\x95\x01\n" +
+	"\tTradePage\x12+\n" +
+	"\x06trades\x18\x01 \x03(\v2\x13.orders.TradeRecordR\x06trades\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\x12\x19\n" +
+	"\bhas_more\x18\x03 \x01(\bR\ahasMore\x12\x1f\n" +
+	"\vtotal_count\x18\x04 \x01(\x03R\n" +
+	"totalCountB%Z#trading-desk/internal/protos/ordersb\x06proto3"
+
+var (
+	file_trade_proto_rawDescOnce sync.Once
+	file_trade_proto_rawDescData []byte
+)
+
+func file_trade_proto_rawDescGZIP() []byte {
+	file_trade_proto_rawDescOnce.Do(func() {
+		file_trade_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_trade_proto_rawDesc), len(file_trade_proto_rawDesc)))
+	})
+	return file_trade_proto_rawDescData
+}
+
+var file_trade_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_trade_proto_goTypes = []any{
+	(*TradeRecord)(nil), // 0: orders.TradeRecord
+	(*TradePage)(nil),   // 1: orders.TradePage
+}
+var file_trade_proto_depIdxs = []int32{
+	0, // 0: orders.TradePage.trades:type_name -> orders.TradeRecord
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_trade_proto_init() }
+func file_trade_proto_init() {
+	if File_trade_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_trade_proto_rawDesc), len(file_trade_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_trade_proto_goTypes,
+		DependencyIndexes: file_trade_proto_depIdxs,
+		MessageInfos:      file_trade_proto_msgTypes,
+	}.Build()
+	File_trade_proto = out.File
+	file_trade_proto_goTypes = nil
+	file_trade_proto_depIdxs = nil
+}
@@ -0,0 +1,176 @@
+package reports
+
+import (
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// sessions lists the weekday dates from from to to, inclusive. Exchange
+// holidays are not known.
+func sessions(from, to string) []string {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil
+	}
+	var dates []string
+	for d := start; d.Format("2006-01-02") <= to; d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			dates = append(dates, d.Format("2006-01-02"))
+		}
+	}
+	return dates
+}
+
+// curve values the combined books of users at the close of each of dates,
+// oldest first: their cash balance plus their positions at the last marks
+// persisted that session, or the session before if none were. It also
+// returns the marks the last date's positions were valued at. Deposits and
+// dispute adjustments are counted from the second date on.
+func (g *Generator) curve(users []string, dates []string) ([]EquityPoint, []database.PositionMark, error) {
+	included := make(map[string]bool, len(users))
+	for _, u := range users {
+		included[u] = true
+	}
+
+	curve := make([]EquityPoint, len(dates))
+	index := make(map[string]int, len(dates))
+	for i, d := range dates {
+		curve[i].Date = d
+		index[d] = i
+
+		balances, err := g.db.CashBalances(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		for book, balance := range balances {
+			if included[book.UserID] {
+				curve[i].Cash = curve[i].Cash.Add(balance)
+			}
+		}
+	}
+
+	if len(dates) > 1 {
+		for _, u := range users {
+			days, err := g.db.GetDailyCash(u, dates[1], dates[len(dates)-1], nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, c := range days {
+				if i, ok := index[c.TradeDate]; ok {
+					curve[i].Deposits = curve[i].Deposits.Add(c.Deposits)
+				}
+			}
+		}
+		adjustments, err := g.adjustments(users, dates[1], dates[len(dates)-1])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range adjustments {
+			if i, ok := index[a.TradeDate]; ok {
+				curve[i].Adjustments = curve[i].Adjustments.Add(a.Adjustment)
+			}
+		}
+	}
+
+	// Look back a week for marks to carry into the first date
+	first, err := market.SessionOpen(dates[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err := market.SessionOpen(dates[len(dates)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	times, err := g.db.GetPositionMarkTimes(first.AddDate(0, 0, -7), last.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endOfDay := make([]*time.Time, len(dates))
+	var latest *time.Time
+	next := 0
+	for i, d := range dates {
+		for next < len(times) && market.SessionDate(times[next]) <= d {
+			latest = &times[next]
+			next++
+		}
+		endOfDay[i] = latest
+	}
+
+	var selected []time.Time
+	for i, t := range endOfDay {
+		if t != nil && (i == 0 || endOfDay[i-1] == nil || !endOfDay[i-1].Equal(*t)) {
+			selected = append(selected, *t)
+		}
+	}
+	marks, err := g.db.GetPositionMarksAt(selected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value := make(map[time.Time]decimal.Decimal)
+	var final []database.PositionMark
+	for _, m := range marks {
+		if !included[m.UserID] {
+			continue
+		}
+		value[m.MarkedAt.UTC()] = value[m.MarkedAt.UTC()].Add(m.MarketValue)
+		if t := endOfDay[len(endOfDay)-1]; t != nil && m.MarkedAt.Equal(*t) {
+			final = append(final, m)
+		}
+	}
+
+	for i, t := range endOfDay {
+		if t != nil {
+			curve[i].MarketValue = value[t.UTC()]
+		}
+		curve[i].Equity = curve[i].Cash.Add(curve[i].MarketValue)
+	}
+	return curve, final, nil
+}
+
+// adjustments returns the upheld disputes of users' trades booked on
+// session dates from to to
+func (g *Generator) adjustments(users []string, from, to string) ([]database.DisputeAdjustment, error) {
+	all, err := g.db.GetDisputeAdjustments(from, to)
+	if err != nil {
+		return nil, err
+	}
+	included := make(map[string]bool, len(users))
+	for _, u := range users {
+		included[u] = true
+	}
+	var adjustments []database.DisputeAdjustment
+	for _, a := range all {
+		if included[a.UserID] {
+			adjustments = append(adjustments, a)
+		}
+	}
+	return adjustments, nil
+}
+
+// dailyReturns returns each day's P&L after the first point, the change in
+// equity less deposits and dispute adjustments, and its return on the
+// previous day's equity plus the deposits. A return is NaN when that base
+// isn't positive.
+func dailyReturns(curve []EquityPoint) ([]decimal.Decimal, []float64) {
+	pl := make([]decimal.Decimal, 0, len(curve))
+	returns := make([]float64, 0, len(curve))
+	for i := 1; i < len(curve); i++ {
+		day := curve[i].Equity.Sub(curve[i-1].Equity).Sub(curve[i].Deposits).Sub(curve[i].Adjustments)
+		pl = append(pl, day)
+
+		base := curve[i-1].Equity.Add(curve[i].Deposits)
+		if !base.IsPositive() {
+			returns = append(returns, math.NaN())
+			continue
+		}
+		returns = append(returns, day.Div(base).InexactFloat64())
+	}
+	return pl, returns
+}
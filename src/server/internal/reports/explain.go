@@ -0,0 +1,304 @@
+package reports
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/tenants"
+)
+
+// Attribution splits a day's P&L by cause. Trading is the P&L of the day's
+// trades: realized P&L plus the change in unrealized P&L that isn't the
+// overnight position moving. Holding is the positions carried in from the
+// previous close moving with the price. Fees are commissions; carry is
+// borrow fees and margin interest.
+type Attribution struct {
+	Trading   decimal.Decimal `json:"trading"`
+	Holding   decimal.Decimal `json:"holding"`
+	Dividends decimal.Decimal `json:"dividends"`
+	Fees      decimal.Decimal `json:"fees"`
+	Carry     decimal.Decimal `json:"carry"`
+	// Total is trading, holding and dividends less fees and carry
+	Total decimal.Decimal `json:"total"`
+}
+
+func (a *Attribution) add(b Attribution) {
+	a.Trading = a.Trading.Add(b.Trading)
+	a.Holding = a.Holding.Add(b.Holding)
+	a.Dividends = a.Dividends.Add(b.Dividends)
+	a.Fees = a.Fees.Add(b.Fees)
+	a.Carry = a.Carry.Add(b.Carry)
+	a.Total = a.Total.Add(b.Total)
+}
+
+func (a *Attribution) total() {
+	a.Total = a.Trading.Add(a.Holding).Add(a.Dividends).Sub(a.Fees).Sub(a.Carry)
+}
+
+// SymbolExplain is one symbol's part of a book's day. Prices are zero when
+// the book held none of the symbol at that close.
+type SymbolExplain struct {
+	Symbol    string          `json:"symbol"`
+	PrevQty   decimal.Decimal `json:"prev_qty"`
+	PrevPrice decimal.Decimal `json:"prev_price"`
+	Qty       decimal.Decimal `json:"qty"`
+	Price     decimal.Decimal `json:"price"`
+	Attribution
+}
+
+// BookExplain is one user/strategy book's day, biggest symbols first
+type BookExplain struct {
+	UserID     string `json:"user_id"`
+	StrategyID int64  `json:"strategy_id"`
+	Attribution
+	Symbols []SymbolExplain `json:"symbols"`
+}
+
+// Explain attributes a day's P&L, from the previous session's close to the
+// day's, to each book, biggest first
+type Explain struct {
+	Date     string `json:"date"`
+	PrevDate string `json:"prev_date,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	// Live is set when the day isn't over and today's positions are marked
+	// at the latest prices
+	Live bool `json:"live"`
+	Attribution
+	Books []BookExplain `json:"books"`
+}
+
+// ExplainUser explains a day of userID's books, optionally only one
+// strategy's. Today's positions are live, the marking engine's current
+// positions, when given; other days use the last marks persisted.
+func (g *Generator) ExplainUser(userID, date string, strategyID *int64, live []database.PositionMark) (*Explain, error) {
+	report, err := g.explain([]string{userID}, date, strategyID, live)
+	if err != nil {
+		return nil, err
+	}
+	report.UserID = userID
+	return report, nil
+}
+
+// ExplainClub explains a day of every user's books, or with chapters, every
+// user's in chapter
+func (g *Generator) ExplainClub(chapter *tenants.Chapter, date string, live []database.PositionMark) (*Explain, error) {
+	users, err := g.users(chapter)
+	if err != nil {
+		return nil, err
+	}
+	return g.explain(users, date, nil, live)
+}
+
+// explainKey is a book's symbol
+type explainKey struct {
+	book   database.CashBook
+	symbol string
+}
+
+// explain attributes each book's P&L for date symbol by symbol. A symbol's
+// market P&L is its realized P&L plus the change in its unrealized P&L
+// between the two closes, which is exactly the change in its value plus the
+// day's trade cash flow. The overnight position times the price move is
+// holding; the rest is trading. A symbol the desk no longer holds at the
+// close has no closing price, so all of its P&L is trading.
+func (g *Generator) explain(users []string, date string, strategyID *int64, live []database.PositionMark) (*Explain, error) {
+	included := make(map[string]bool, len(users))
+	for _, u := range users {
+		included[u] = true
+	}
+	inScope := func(book database.CashBook) bool {
+		return included[book.UserID] && (strategyID == nil || book.StrategyID == *strategyID)
+	}
+
+	report := &Explain{Date: date, Live: live != nil, Books: []BookExplain{}}
+	prev, end, err := g.explainMarks(date, live != nil)
+	if err != nil {
+		return nil, err
+	}
+	if live != nil {
+		end = live
+	}
+	if len(prev) > 0 {
+		report.PrevDate = market.SessionDate(prev[0].MarkedAt)
+	}
+
+	lines := make(map[explainKey]*SymbolExplain)
+	line := func(book database.CashBook, symbol string) *SymbolExplain {
+		k := explainKey{book, symbol}
+		if lines[k] == nil {
+			lines[k] = &SymbolExplain{Symbol: symbol}
+		}
+		return lines[k]
+	}
+	// marketPL is each symbol's realized P&L plus its change in unrealized
+	marketPL := make(map[explainKey]decimal.Decimal)
+	closes := make(map[string]decimal.Decimal)
+	carry := make(map[database.CashBook]decimal.Decimal)
+
+	for _, m := range prev {
+		book := database.CashBook{UserID: m.UserID, StrategyID: m.StrategyID}
+		if !inScope(book) {
+			continue
+		}
+		l := line(book, m.Symbol)
+		l.PrevQty, l.PrevPrice = m.Qty, m.Price
+		marketPL[explainKey{book, m.Symbol}] = marketPL[explainKey{book, m.Symbol}].Sub(m.UnrealizedPL)
+	}
+	for _, m := range end {
+		closes[m.Symbol] = m.Price
+		book := database.CashBook{UserID: m.UserID, StrategyID: m.StrategyID}
+		if !inScope(book) {
+			continue
+		}
+		l := line(book, m.Symbol)
+		l.Qty, l.Price = m.Qty, m.Price
+		marketPL[explainKey{book, m.Symbol}] = marketPL[explainKey{book, m.Symbol}].Add(m.UnrealizedPL)
+	}
+
+	for _, u := range users {
+		aggs, err := g.db.GetDailyAggregates(u, date, date, strategyID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range aggs {
+			book := database.CashBook{UserID: a.UserID, StrategyID: a.StrategyID}
+			l := line(book, a.Symbol)
+			l.Fees = l.Fees.Add(a.Fees)
+			l.Carry = l.Carry.Add(a.BorrowFees)
+			marketPL[explainKey{book, a.Symbol}] = marketPL[explainKey{book, a.Symbol}].Add(a.RealizedPL)
+		}
+
+		days, err := g.db.GetDailyCash(u, date, date, strategyID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range days {
+			// Borrow fees are in the aggregates by symbol; margin interest
+			// is the book's
+			book := database.CashBook{UserID: c.UserID, StrategyID: c.StrategyID}
+			carry[book] = carry[book].Add(c.MarginInterest)
+		}
+	}
+
+	dividends, err := g.db.GetDividends(date)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dividends {
+		book := database.CashBook{UserID: d.UserID, StrategyID: d.StrategyID}
+		if !inScope(book) {
+			continue
+		}
+		l := line(book, d.Symbol)
+		l.Dividends = l.Dividends.Add(d.Amount)
+	}
+
+	books := make(map[database.CashBook]*BookExplain)
+	book := func(b database.CashBook) *BookExplain {
+		if books[b] == nil {
+			books[b] = &BookExplain{UserID: b.UserID, StrategyID: b.StrategyID, Symbols: []SymbolExplain{}}
+		}
+		return books[b]
+	}
+	for k, l := range lines {
+		if price, ok := closes[l.Symbol]; ok && !l.PrevQty.IsZero() {
+			l.Holding = l.PrevQty.Mul(price.Sub(l.PrevPrice))
+		}
+		l.Trading = marketPL[k].Sub(l.Holding)
+		l.total()
+
+		b := book(k.book)
+		b.Symbols = append(b.Symbols, *l)
+		b.add(l.Attribution)
+	}
+	for b, interest := range carry {
+		if interest.IsZero() {
+			continue
+		}
+		e := book(b)
+		e.Carry = e.Carry.Add(interest)
+		e.Total = e.Total.Sub(interest)
+	}
+
+	for _, b := range books {
+		sort.Slice(b.Symbols, func(i, j int) bool {
+			return biggerFirst(b.Symbols[i].Total, b.Symbols[j].Total, b.Symbols[i].Symbol, b.Symbols[j].Symbol)
+		})
+		report.Books = append(report.Books, *b)
+		report.add(b.Attribution)
+	}
+	sort.Slice(report.Books, func(i, j int) bool {
+		a, b := report.Books[i], report.Books[j]
+		if !a.Total.Abs().Equal(b.Total.Abs()) {
+			return a.Total.Abs().GreaterThan(b.Total.Abs())
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.StrategyID < b.StrategyID
+	})
+	return report, nil
+}
+
+// biggerFirst orders amounts by size, whichever their sign, then by name
+func biggerFirst(a, b decimal.Decimal, aName, bName string) bool {
+	if !a.Abs().Equal(b.Abs()) {
+		return a.Abs().GreaterThan(b.Abs())
+	}
+	return aName < bName
+}
+
+// explainMarks returns the last marks persisted in the session before date,
+// looking back a week, and unless live, the last persisted in date's. A day
+// with positions coming in but no marks of its own can't be explained.
+func (g *Generator) explainMarks(date string, live bool) ([]database.PositionMark, []database.PositionMark, error) {
+	open, err := market.SessionOpen(date)
+	if err != nil {
+		return nil, nil, err
+	}
+	times, err := g.db.GetPositionMarkTimes(open.AddDate(0, 0, -7), open.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var prevAt, endAt *time.Time
+	for i := range times {
+		switch d := market.SessionDate(times[i]); {
+		case d < date:
+			prevAt = &times[i]
+		case d == date && !live:
+			endAt = &times[i]
+		}
+	}
+
+	if prevAt != nil && endAt == nil && !live {
+		return nil, nil, fmt.Errorf("no position marks were stored on %s", date)
+	}
+
+	var selected []time.Time
+	for _, t := range []*time.Time{prevAt, endAt} {
+		if t != nil {
+			selected = append(selected, *t)
+		}
+	}
+	marks, err := g.db.GetPositionMarksAt(selected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var prev, end []database.PositionMark
+	for _, m := range marks {
+		switch {
+		case prevAt != nil && m.MarkedAt.Equal(*prevAt):
+			prev = append(prev, m)
+		case endAt != nil && m.MarkedAt.Equal(*endAt):
+			end = append(end, m)
+		}
+	}
+	return prev, end, nil
+}
@@ -0,0 +1,101 @@
+package reports
+
+import (
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/market"
+)
+
+// PublicPoint is one session of the public performance page
+type PublicPoint struct {
+	Date string `json:"date"`
+	// Index is the growth of 100 over the period, net of deposits
+	Index  decimal.Decimal `json:"index"`
+	Trades int64           `json:"trades"`
+}
+
+// Public is the combined, anonymized performance of the members who opted
+// in. It holds no amounts, users or positions: only a growth index and trade
+// counts.
+type Public struct {
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Members     int       `json:"members"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Return is the growth over the period, nil if it couldn't be measured
+	Return *decimal.Decimal `json:"return,omitempty"`
+	Trades int64            `json:"trades"`
+	Curve  []PublicPoint    `json:"curve"`
+}
+
+// Public builds the public performance of users over the last days sessions
+func (g *Generator) Public(users []string, days int) (*Public, error) {
+	now := time.Now()
+	today := market.SessionDate(now)
+
+	// One session more than asked for, to measure the first day's return
+	// from
+	d, _ := time.Parse("2006-01-02", today)
+	var dates []string
+	for len(dates) <= days {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			dates = append([]string{d.Format("2006-01-02")}, dates...)
+		}
+		d = d.AddDate(0, 0, -1)
+	}
+
+	curve, _, err := g.curve(users, dates)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make(map[string]int64)
+	for _, u := range users {
+		aggs, err := g.db.GetDailyAggregates(u, dates[1], today, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range aggs {
+			trades[a.TradeDate] += a.TradeCount
+		}
+	}
+	// Trades of upheld disputes aren't counted
+	adjustments, err := g.adjustments(users, dates[1], today)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range adjustments {
+		trades[a.TradeDate] = max(trades[a.TradeDate]-1, 0)
+	}
+
+	page := &Public{
+		From:        dates[1],
+		To:          today,
+		Members:     len(users),
+		GeneratedAt: now,
+		Curve:       make([]PublicPoint, 0, days),
+	}
+	_, returns := dailyReturns(curve)
+	index, measured := 100.0, false
+	for i, r := range returns {
+		if !math.IsNaN(r) {
+			index *= 1 + r
+			measured = true
+		}
+		date := dates[i+1]
+		page.Curve = append(page.Curve, PublicPoint{
+			Date:   date,
+			Index:  decimal.NewFromFloat(index).Round(2),
+			Trades: trades[date],
+		})
+		page.Trades += trades[date]
+	}
+	if measured {
+		ret := decimal.NewFromFloat(index/100 - 1).Round(6)
+		page.Return = &ret
+	}
+	return page, nil
+}
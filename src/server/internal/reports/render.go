@@ -0,0 +1,161 @@
+package reports
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	//go:embed weekly.html
+	weeklyHTML string
+	//go:embed public.html
+	publicHTML string
+)
+
+// Size of the equity curve chart, in pixels
+const (
+	chartWidth  = 600
+	chartHeight = 160
+)
+
+var funcs = template.FuncMap{
+	"money": money,
+	"pct":   pct,
+	"qty":   func(d decimal.Decimal) string { return d.String() },
+	"curve": curve,
+	"index": indexCurve,
+	"name":  func(w *Weekly) string { return w.Name() },
+}
+
+var (
+	weeklyTemplate = template.Must(template.New("weekly").Funcs(funcs).Parse(weeklyHTML))
+	publicTemplate = template.Must(template.New("public").Funcs(funcs).Parse(publicHTML))
+)
+
+// money formats an amount to cents with thousands separators
+func money(d decimal.Decimal) string {
+	s := d.Abs().StringFixed(2)
+	whole, cents, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if d.IsNegative() {
+		b.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String() + "." + cents
+}
+
+// pct formats a fraction as a percentage
+func pct(d decimal.Decimal) string {
+	return d.Mul(decimal.NewFromInt(100)).StringFixed(2) + "%"
+}
+
+// curve returns the SVG polyline points of an equity curve
+func curve(points []EquityPoint) string {
+	values := make([]decimal.Decimal, len(points))
+	for i, p := range points {
+		values[i] = p.Equity
+	}
+	return polyline(values)
+}
+
+// indexCurve returns the SVG polyline points of a public growth index
+func indexCurve(points []PublicPoint) string {
+	values := make([]decimal.Decimal, len(points))
+	for i, p := range points {
+		values[i] = p.Index
+	}
+	return polyline(values)
+}
+
+// polyline scales values to the chart, oldest on the left
+func polyline(values []decimal.Decimal) string {
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = decimal.Min(low, v), decimal.Max(high, v)
+	}
+	span := high.Sub(low).InexactFloat64()
+
+	coords := make([]string, len(values))
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) * chartWidth / float64(len(values)-1)
+		}
+		y := chartHeight / 2.0
+		if span > 0 {
+			y = chartHeight - v.Sub(low).InexactFloat64()/span*chartHeight
+		}
+		coords[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(coords, " ")
+}
+
+// RenderHTML renders a report as a standalone HTML page
+func RenderHTML(report *Weekly) (string, error) {
+	var buf bytes.Buffer
+	if err := weeklyTemplate.Execute(&buf, report); err != nil {
+		return "", fmt.Errorf("failed to render weekly report: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// RenderPublicHTML renders the public performance page, sized to embed in
+// an iframe
+func RenderPublicHTML(page *Public) (string, error) {
+	var buf bytes.Buffer
+	if err := publicTemplate.Execute(&buf, page); err != nil {
+		return "", fmt.Errorf("failed to render public performance: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Summary is a plain-text digest of a report for notification channels
+// that can't show HTML
+func Summary(report *Weekly) string {
+	r := report.Risk
+	var lines []string
+
+	line := fmt.Sprintf("Equity %s, P&L %s", money(r.EndEquity), money(r.PL))
+	if r.Return != nil {
+		line += fmt.Sprintf(" (%s)", pct(*r.Return))
+	}
+	if !r.Deposits.IsZero() {
+		line += fmt.Sprintf(", net deposits %s", money(r.Deposits))
+	}
+	if !r.Adjustments.IsZero() {
+		line += fmt.Sprintf(", disputed fills %s excluded", money(r.Adjustments))
+	}
+	lines = append(lines, line)
+
+	lines = append(lines, fmt.Sprintf("Best day %s, worst day %s, %d up / %d down, max drawdown %s",
+		money(r.BestDay), money(r.WorstDay), r.WinningDays, r.LosingDays, pct(r.MaxDrawdown)))
+
+	var movers []string
+	if len(report.Winners) > 0 {
+		movers = append(movers, fmt.Sprintf("top winner %s %s", report.Winners[0].Symbol, money(report.Winners[0].NetPL)))
+	}
+	if len(report.Losers) > 0 {
+		movers = append(movers, fmt.Sprintf("top loser %s %s", report.Losers[0].Symbol, money(report.Losers[0].NetPL)))
+	}
+	if len(movers) > 0 {
+		s := strings.Join(movers, "; ")
+		lines = append(lines, strings.ToUpper(s[:1])+s[1:])
+	}
+
+	lines = append(lines, fmt.Sprintf("Open positions: %d, gross exposure %s",
+		len(report.OpenPositions), money(r.GrossExposure)))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,440 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/indicators"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/tenants"
+)
+
+// topMovers is how many winners and losers a report lists
+const topMovers = 5
+
+// EquityPoint is a book's equity at the end of a session: its cash balance
+// plus its positions at the day's last persisted marks
+type EquityPoint struct {
+	Date        string          `json:"date"`
+	Cash        decimal.Decimal `json:"cash"`
+	MarketValue decimal.Decimal `json:"market_value"`
+	Equity      decimal.Decimal `json:"equity"`
+	// Deposits are the net deposits of the day, which don't count as P&L
+	Deposits decimal.Decimal `json:"deposits"`
+	// Adjustments are the P&L of the day's fills that upheld disputes took
+	// out of performance
+	Adjustments decimal.Decimal `json:"adjustments"`
+}
+
+// SymbolPL is the week's net realized P&L in one symbol
+type SymbolPL struct {
+	Symbol string          `json:"symbol"`
+	Trades int64           `json:"trades"`
+	NetPL  decimal.Decimal `json:"net_pl"`
+}
+
+// RiskStats summarise the week's equity curve. Daily P&L is the change in
+// equity less deposits and dispute adjustments; returns are relative to the
+// previous day's equity.
+type RiskStats struct {
+	StartEquity decimal.Decimal `json:"start_equity"`
+	EndEquity   decimal.Decimal `json:"end_equity"`
+	Deposits    decimal.Decimal `json:"deposits"`
+	Adjustments decimal.Decimal `json:"adjustments"`
+	PL          decimal.Decimal `json:"pl"`
+	// Return is the compounded daily return, nil without positive equity to
+	// measure it against
+	Return      *decimal.Decimal `json:"return,omitempty"`
+	BestDay     decimal.Decimal  `json:"best_day"`
+	WorstDay    decimal.Decimal  `json:"worst_day"`
+	WinningDays int              `json:"winning_days"`
+	LosingDays  int              `json:"losing_days"`
+	// Volatility is the annualized standard deviation of daily returns
+	Volatility decimal.Decimal `json:"volatility"`
+	// MaxDrawdown is the largest peak-to-trough fall in compounded returns,
+	// as a fraction
+	MaxDrawdown   decimal.Decimal `json:"max_drawdown"`
+	GrossExposure decimal.Decimal `json:"gross_exposure"`
+	NetExposure   decimal.Decimal `json:"net_exposure"`
+}
+
+// Position is an open position at the end of the week, across strategies
+type Position struct {
+	Symbol       string          `json:"symbol"`
+	Qty          decimal.Decimal `json:"qty"`
+	AvgCost      decimal.Decimal `json:"avg_cost"`
+	Price        decimal.Decimal `json:"price"`
+	MarketValue  decimal.Decimal `json:"market_value"`
+	UnrealizedPL decimal.Decimal `json:"unrealized_pl"`
+}
+
+// Weekly is one week's performance report for a user or the whole club
+type Weekly struct {
+	// UserID is empty for the club report
+	UserID string `json:"user_id,omitempty"`
+	// Chapter is the chapter a club report covers, when there are chapters
+	Chapter string `json:"chapter,omitempty"`
+	// Users is how many users the club report covers
+	Users int `json:"users,omitempty"`
+	// From and To are the Monday and Friday session dates of the week
+	From          string        `json:"from"`
+	To            string        `json:"to"`
+	GeneratedAt   time.Time     `json:"generated_at"`
+	EquityCurve   []EquityPoint `json:"equity_curve"`
+	Winners       []SymbolPL    `json:"winners"`
+	Losers        []SymbolPL    `json:"losers"`
+	Risk          RiskStats     `json:"risk"`
+	OpenPositions []Position    `json:"open_positions"`
+	// MarkedAt is when the open positions were last marked, nil if no marks
+	// were persisted by the end of the week
+	MarkedAt *time.Time `json:"marked_at,omitempty"`
+}
+
+// Name is who the report is for
+func (w *Weekly) Name() string {
+	if w.UserID == "" && w.Chapter != "" {
+		return w.Chapter
+	}
+	if w.UserID == "" {
+		return "the club"
+	}
+	return w.UserID
+}
+
+// WeekOf returns the Monday and Friday session dates of the week date
+// (YYYY-MM-DD) falls in
+func WeekOf(date string) (from, to string, err error) {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid date %q: want YYYY-MM-DD", date)
+	}
+	monday := d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	return monday.Format("2006-01-02"), monday.AddDate(0, 0, 4).Format("2006-01-02"), nil
+}
+
+// Generator builds weekly reports from the cash ledger, daily aggregates and
+// persisted position marks, and sends them through the notifier. With
+// chapters, each chapter's reports go to its own webhook instead, and only
+// the host's through the notifier.
+type Generator struct {
+	db       *database.DB
+	notifier notify.Notifier
+	chapters *tenants.Registry
+}
+
+func NewGenerator(db *database.DB, notifier notify.Notifier, chapters *tenants.Registry) *Generator {
+	return &Generator{
+		db:       db,
+		notifier: notifier,
+		chapters: chapters,
+	}
+}
+
+// User builds userID's report for the week date falls in
+func (g *Generator) User(userID, date string) (*Weekly, error) {
+	report, err := g.build([]string{userID}, date)
+	if err != nil {
+		return nil, err
+	}
+	report.UserID = userID
+	return report, nil
+}
+
+// Club builds the report of every user's books combined for the week date
+// falls in, or only the books of chapter's users if it isn't nil
+func (g *Generator) Club(chapter *tenants.Chapter, date string) (*Weekly, error) {
+	users, err := g.users(chapter)
+	if err != nil {
+		return nil, err
+	}
+	report, err := g.build(users, date)
+	if err != nil {
+		return nil, err
+	}
+	report.Users = len(users)
+	if chapter != nil {
+		report.Chapter = chapter.Name
+	}
+	return report, nil
+}
+
+// users returns the users with books, only chapter's if it isn't nil
+func (g *Generator) users(chapter *tenants.Chapter) ([]string, error) {
+	users, err := g.db.GetBookUsers()
+	if err != nil || chapter == nil {
+		return users, err
+	}
+	var own []string
+	for _, u := range users {
+		if chapter.Owns(u) {
+			own = append(own, u)
+		}
+	}
+	return own, nil
+}
+
+// build reports on the combined books of users. The curve starts at the
+// previous Friday's close and ends today if the week isn't over.
+func (g *Generator) build(users []string, date string) (*Weekly, error) {
+	from, to, err := WeekOf(date)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	monday, _ := time.Parse("2006-01-02", from)
+	last := min(to, market.SessionDate(now))
+	dates := append([]string{monday.AddDate(0, 0, -3).Format("2006-01-02")}, sessions(from, last)...)
+
+	curve, marks, err := g.curve(users, dates)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Weekly{
+		From:          from,
+		To:            to,
+		GeneratedAt:   now,
+		EquityCurve:   curve,
+		Winners:       []SymbolPL{},
+		Losers:        []SymbolPL{},
+		OpenPositions: []Position{},
+	}
+
+	symbols := make(map[string]*SymbolPL)
+	for _, u := range users {
+		aggs, err := g.db.GetDailyAggregates(u, from, to, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range aggs {
+			s, ok := symbols[a.Symbol]
+			if !ok {
+				s = &SymbolPL{Symbol: a.Symbol}
+				symbols[a.Symbol] = s
+			}
+			s.Trades += a.TradeCount
+			s.NetPL = s.NetPL.Add(a.NetPL)
+		}
+	}
+	// Trades of upheld disputes don't count for or against the symbol
+	adjustments, err := g.adjustments(users, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range adjustments {
+		if s, ok := symbols[a.Symbol]; ok {
+			s.Trades = max(s.Trades-1, 0)
+			s.NetPL = s.NetPL.Sub(a.Adjustment)
+		}
+	}
+
+	ranked := make([]SymbolPL, 0, len(symbols))
+	for _, s := range symbols {
+		ranked = append(ranked, *s)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if !ranked[i].NetPL.Equal(ranked[j].NetPL) {
+			return ranked[i].NetPL.GreaterThan(ranked[j].NetPL)
+		}
+		return ranked[i].Symbol < ranked[j].Symbol
+	})
+	for i := 0; i < len(ranked) && len(report.Winners) < topMovers && ranked[i].NetPL.IsPositive(); i++ {
+		report.Winners = append(report.Winners, ranked[i])
+	}
+	for i := len(ranked) - 1; i >= 0 && len(report.Losers) < topMovers && ranked[i].NetPL.IsNegative(); i-- {
+		report.Losers = append(report.Losers, ranked[i])
+	}
+
+	if len(marks) > 0 {
+		report.MarkedAt = &marks[0].MarkedAt
+	}
+	bySymbol := make(map[string]*Position)
+	for _, m := range marks {
+		p, ok := bySymbol[m.Symbol]
+		if !ok {
+			p = &Position{Symbol: m.Symbol, Price: m.Price}
+			bySymbol[m.Symbol] = p
+		}
+		// Average cost across strategies, weighted by quantity
+		cost := p.AvgCost.Mul(p.Qty).Add(m.AvgCost.Mul(m.Qty))
+		p.Qty = p.Qty.Add(m.Qty)
+		if !p.Qty.IsZero() {
+			p.AvgCost = cost.Div(p.Qty)
+		}
+		p.MarketValue = p.MarketValue.Add(m.MarketValue)
+		p.UnrealizedPL = p.UnrealizedPL.Add(m.UnrealizedPL)
+	}
+	for _, p := range bySymbol {
+		if !p.Qty.IsZero() {
+			report.OpenPositions = append(report.OpenPositions, *p)
+		}
+	}
+	sort.Slice(report.OpenPositions, func(i, j int) bool {
+		return report.OpenPositions[i].MarketValue.Abs().GreaterThan(report.OpenPositions[j].MarketValue.Abs())
+	})
+
+	report.Risk = riskStats(report.EquityCurve, report.OpenPositions)
+	return report, nil
+}
+
+// riskStats measures an equity curve whose first point is the starting
+// equity
+func riskStats(curve []EquityPoint, positions []Position) RiskStats {
+	stats := RiskStats{
+		StartEquity: curve[0].Equity,
+		EndEquity:   curve[len(curve)-1].Equity,
+	}
+	for _, p := range positions {
+		stats.GrossExposure = stats.GrossExposure.Add(p.MarketValue.Abs())
+		stats.NetExposure = stats.NetExposure.Add(p.MarketValue)
+	}
+
+	pl, returns := dailyReturns(curve)
+	growth, peak, drawdown := 1.0, 1.0, 0.0
+	measured := len(returns) > 0
+	for i, day := range pl {
+		stats.Deposits = stats.Deposits.Add(curve[i+1].Deposits)
+		stats.Adjustments = stats.Adjustments.Add(curve[i+1].Adjustments)
+		stats.PL = stats.PL.Add(day)
+		if i == 0 || day.GreaterThan(stats.BestDay) {
+			stats.BestDay = day
+		}
+		if i == 0 || day.LessThan(stats.WorstDay) {
+			stats.WorstDay = day
+		}
+		switch {
+		case day.IsPositive():
+			stats.WinningDays++
+		case day.IsNegative():
+			stats.LosingDays++
+		}
+
+		if math.IsNaN(returns[i]) {
+			measured = false
+			continue
+		}
+		growth *= 1 + returns[i]
+		peak = math.Max(peak, growth)
+		drawdown = math.Max(drawdown, (peak-growth)/peak)
+	}
+
+	if measured {
+		ret := decimal.NewFromFloat(growth - 1).Round(6)
+		stats.Return = &ret
+	}
+	stats.MaxDrawdown = decimal.NewFromFloat(drawdown).Round(6)
+	stats.Volatility = volatility(returns)
+	return stats
+}
+
+// volatility annualizes the standard deviation of the measurable daily
+// returns, zero with fewer than two
+func volatility(returns []float64) decimal.Decimal {
+	var measured []float64
+	for _, r := range returns {
+		if !math.IsNaN(r) {
+			measured = append(measured, r)
+		}
+	}
+	if len(measured) < 2 {
+		return decimal.Zero
+	}
+
+	var mean, variance float64
+	for _, r := range measured {
+		mean += r
+	}
+	mean /= float64(len(measured))
+	for _, r := range measured {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(measured) - 1)
+	return decimal.NewFromFloat(math.Sqrt(variance * indicators.TradingDays)).Round(6)
+}
+
+// Distribute sends every user's report, and the club's, for the week date
+// falls in through the notifier. With chapters, each chapter gets its own
+// club report, and its reports go to its webhook; a chapter other than the
+// host without one gets none. A report that fails is logged and skipped.
+func (g *Generator) Distribute(ctx context.Context, date string) error {
+	if g.chapters == nil {
+		return g.distribute(ctx, nil, g.notifier, date)
+	}
+	for _, c := range g.chapters.Chapters() {
+		notifier := g.notifier
+		if !c.Host {
+			if c.NotifyWebhookURL == "" {
+				log.Printf("Not sending weekly reports for chapter %s: it has no notify_webhook_url", c.ID)
+				continue
+			}
+			notifier = notify.NewWebhook(c.NotifyWebhookURL)
+		}
+		if err := g.distribute(ctx, c, notifier, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// distribute sends the reports of chapter's users, or of every user if it
+// is nil, and their club report through notifier
+func (g *Generator) distribute(ctx context.Context, chapter *tenants.Chapter, notifier notify.Notifier, date string) error {
+	users, err := g.users(chapter)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, u := range users {
+		report, err := g.User(u, date)
+		if err != nil {
+			log.Printf("Failed to build weekly report for %s: %v", u, err)
+			continue
+		}
+		if send(ctx, notifier, report) {
+			sent++
+		}
+	}
+
+	club, err := g.Club(chapter, date)
+	if err != nil {
+		return err
+	}
+	if send(ctx, notifier, club) {
+		sent++
+	}
+
+	log.Printf("Sent %d weekly reports for %s for the week of %s", sent, club.Name(), club.From)
+	return nil
+}
+
+// send delivers a report as a text summary with the HTML report attached
+func send(ctx context.Context, notifier notify.Notifier, report *Weekly) bool {
+	html, err := RenderHTML(report)
+	if err != nil {
+		log.Printf("Failed to render weekly report for %s: %v", report.Name(), err)
+		return false
+	}
+
+	n := notify.Notification{
+		Level:   notify.LevelInfo,
+		Title:   fmt.Sprintf("Weekly report for %s, %s to %s", report.Name(), report.From, report.To),
+		Message: Summary(report),
+		HTML:    html,
+		Time:    time.Now(),
+	}
+	if err := notifier.Notify(ctx, n); err != nil {
+		log.Printf("Failed to send notification %q: %v", n.Title, err)
+		return false
+	}
+	return true
+}
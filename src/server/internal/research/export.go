@@ -0,0 +1,139 @@
+package research
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// Columns are the header of an exported dataset
+var Columns = []string{
+	"user", "strategy", "session_date", "session", "filled_at", "symbol", "side",
+	"order_type", "time_in_force", "venue", "size_bucket", "fill_price",
+}
+
+// ErrTooFewUsers is returned by Export when the trades come from fewer
+// users than the policy's MinUsers
+var ErrTooFewUsers = errors.New("too few users to export")
+
+// Anonymizer applies a policy to filled trades
+type Anonymizer struct {
+	policy Policy
+	key    []byte
+}
+
+// NewAnonymizer returns an anonymizer for policy. Users and strategies are
+// hashed with key, so exports made with the same key can be joined; with an
+// empty key a random one is used and each export's hashes are unrelated.
+func NewAnonymizer(policy Policy, key string) (*Anonymizer, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	a := &Anonymizer{policy: policy, key: []byte(key)}
+	if key == "" {
+		a.key = make([]byte, 32)
+		if _, err := rand.Read(a.key); err != nil {
+			return nil, fmt.Errorf("failed to generate export key: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// hash returns a keyed hash of value that can't be reversed or recomputed
+// without the key
+func (a *Anonymizer) hash(kind, value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// filledAt returns when t filled, or was submitted if the fill time wasn't
+// recorded
+func filledAt(t database.Trade) time.Time {
+	if t.FilledAt != nil {
+		return t.FilledAt.UTC()
+	}
+	return t.SubmittedAt.UTC()
+}
+
+// Row anonymizes one filled trade
+func (a *Anonymizer) Row(t database.Trade) []string {
+	at := filledAt(t)
+
+	var when string
+	switch a.policy.TimePrecision {
+	case PrecisionHour:
+		when = at.Truncate(time.Hour).Format(time.RFC3339)
+	case PrecisionMinute:
+		when = at.Truncate(time.Minute).Format(time.RFC3339)
+	}
+
+	var strategy string
+	if a.policy.Strategies && t.StrategyID != nil {
+		strategy = a.hash("strategy", strconv.FormatInt(*t.StrategyID, 10))
+	}
+
+	var price, size string
+	if t.FilledAvgPrice != nil {
+		size = a.policy.bucket(t.FilledQty.Mul(*t.FilledAvgPrice).Abs())
+		if a.policy.Prices {
+			price = t.FilledAvgPrice.String()
+		}
+	}
+
+	return []string{
+		a.hash("user", t.UserID),
+		strategy,
+		market.SessionDate(at),
+		market.SessionOf(at),
+		when,
+		t.Symbol,
+		t.Side,
+		t.OrderType,
+		t.TimeInForce,
+		t.Venue,
+		size,
+		price,
+	}
+}
+
+// Export writes the filled trades whose session date is from to to,
+// inclusive, as an anonymized CSV dataset. It refuses to write anything if
+// the trades come from fewer users than the policy's MinUsers, and returns
+// the number of trades written.
+func (a *Anonymizer) Export(w io.Writer, trades []database.Trade, from, to string) (int, error) {
+	users := make(map[string]bool)
+	var rows [][]string
+	for _, t := range trades {
+		if t.FilledAvgPrice == nil || !t.FilledQty.IsPositive() || slices.Contains(a.policy.ExcludeUsers, t.UserID) {
+			continue
+		}
+		if date := market.SessionDate(filledAt(t)); date < from || date > to {
+			continue
+		}
+		users[t.UserID] = true
+		rows = append(rows, a.Row(t))
+	}
+	if len(users) < a.policy.MinUsers {
+		return 0, fmt.Errorf("%w: %d users, the policy requires at least %d", ErrTooFewUsers, len(users), a.policy.MinUsers)
+	}
+
+	out := csv.NewWriter(w)
+	out.Write(Columns)
+	out.WriteAll(rows)
+	if err := out.Error(); err != nil {
+		return 0, fmt.Errorf("failed to write export: %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,111 @@
+package research
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/shopspring/decimal"
+)
+
+// Timestamp precisions a policy can truncate fill times to
+const (
+	PrecisionDay    = "day"
+	PrecisionHour   = "hour"
+	PrecisionMinute = "minute"
+)
+
+// Policy is how trades are anonymized for a research export. User IDs are
+// always replaced with keyed hashes and order IDs, error messages and exact
+// quantities are never exported; the policy controls everything else.
+type Policy struct {
+	// SizeBuckets are the upper bounds, in dollars, of the notional buckets
+	// a fill's size is reported in. The last bucket is open-ended.
+	SizeBuckets []decimal.Decimal `json:"size_buckets"`
+	// TimePrecision is what fill times are truncated to: day, hour or minute
+	TimePrecision string `json:"time_precision"`
+	// Strategies exports a keyed hash of each trade's strategy, so trades of
+	// one strategy can be grouped without naming it
+	Strategies bool `json:"strategies"`
+	// Prices exports fill prices. Together with a symbol and a fine time they
+	// can narrow a fill down, so they can be left out.
+	Prices bool `json:"prices"`
+	// MinUsers is the fewest distinct users an export may contain, so a
+	// dataset can't be one member's trades under a hash
+	MinUsers int `json:"min_users"`
+	// ExcludeUsers are never exported
+	ExcludeUsers []string `json:"exclude_users"`
+}
+
+// DefaultPolicy is used when no policy file is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		SizeBuckets: []decimal.Decimal{
+			decimal.NewFromInt(1000),
+			decimal.NewFromInt(5000),
+			decimal.NewFromInt(25000),
+			decimal.NewFromInt(100000),
+		},
+		TimePrecision: PrecisionHour,
+		Strategies:    true,
+		Prices:        true,
+		MinUsers:      3,
+	}
+}
+
+// LoadPolicy reads a policy from the JSON file at path, with any fields it
+// leaves out taken from DefaultPolicy. An empty path is the default policy.
+func LoadPolicy(path string) (Policy, error) {
+	policy := DefaultPolicy()
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read export policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return Policy{}, fmt.Errorf("failed to parse export policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return policy, nil
+}
+
+// Validate rejects a policy that would leak more than bucketed sizes
+func (p Policy) Validate() error {
+	if len(p.SizeBuckets) == 0 {
+		return fmt.Errorf("size_buckets must not be empty")
+	}
+	for i, b := range p.SizeBuckets {
+		if !b.IsPositive() {
+			return fmt.Errorf("size_buckets must be positive")
+		}
+		if i > 0 && !b.GreaterThan(p.SizeBuckets[i-1]) {
+			return fmt.Errorf("size_buckets must be increasing")
+		}
+	}
+	if !slices.Contains([]string{PrecisionDay, PrecisionHour, PrecisionMinute}, p.TimePrecision) {
+		return fmt.Errorf("invalid time_precision %q (want day, hour or minute)", p.TimePrecision)
+	}
+	if p.MinUsers < 1 {
+		return fmt.Errorf("min_users must be at least 1")
+	}
+	return nil
+}
+
+// bucket returns the label of the size bucket notional falls in, such as
+// "1000-5000" or "100000+"
+func (p Policy) bucket(notional decimal.Decimal) string {
+	lower := decimal.Zero
+	for _, upper := range p.SizeBuckets {
+		if notional.LessThan(upper) {
+			return lower.String() + "-" + upper.String()
+		}
+		lower = upper
+	}
+	return lower.String() + "+"
+}
@@ -0,0 +1,100 @@
+package risk
+
+import (
+	"fmt"
+
+	"desk/internal/database"
+	"desk/internal/tenants"
+
+	"github.com/shopspring/decimal"
+)
+
+// Prices looks up the latest price of a symbol
+type Prices interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// Positions returns the desk's marked positions, optionally only a user's
+type Positions interface {
+	Positions(userID string) []database.PositionMark
+}
+
+// ChapterRule blocks orders that exceed their chapter's limits: an order's
+// notional, and the gross market value of the chapter's positions once the
+// order fills. Orders that only reduce a position are never held to the
+// exposure limit.
+type ChapterRule struct {
+	chapters  *tenants.Registry
+	prices    Prices
+	positions Positions
+}
+
+func NewChapterRule(chapters *tenants.Registry, prices Prices, positions Positions) *ChapterRule {
+	return &ChapterRule{
+		chapters:  chapters,
+		prices:    prices,
+		positions: positions,
+	}
+}
+
+func (r *ChapterRule) Name() string {
+	return "chapter_limits"
+}
+
+func (r *ChapterRule) Check(o Order) (*Finding, error) {
+	chapter := r.chapters.ChapterOf(o.UserID)
+	if chapter == nil {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "CHAPTER_UNKNOWN",
+			Reason: fmt.Sprintf("user %s belongs to no chapter", o.UserID),
+		}, nil
+	}
+	limits := chapter.Limits
+	if limits.MaxOrderNotional.IsZero() && limits.MaxGrossExposure.IsZero() {
+		return nil, nil
+	}
+
+	var price decimal.Decimal
+	if o.LimitPrice != nil {
+		price = *o.LimitPrice
+	} else {
+		p, err := r.prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		price = p
+	}
+	notional := o.Qty.Mul(price)
+
+	if limits.MaxOrderNotional.IsPositive() && notional.GreaterThan(limits.MaxOrderNotional) {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "CHAPTER_ORDER_LIMIT",
+			Reason: fmt.Sprintf("order notional %s exceeds %s's limit of %s",
+				notional.StringFixed(2), chapter.Name, limits.MaxOrderNotional.StringFixed(2)),
+		}, nil
+	}
+
+	if !limits.MaxGrossExposure.IsPositive() || !o.Opens() {
+		return nil, nil
+	}
+	gross := notional
+	for _, p := range r.positions.Positions("") {
+		if chapter.Owns(p.UserID) {
+			gross = gross.Add(p.MarketValue.Abs())
+		}
+	}
+	if gross.GreaterThan(limits.MaxGrossExposure) {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "CHAPTER_EXPOSURE_LIMIT",
+			Reason: fmt.Sprintf("order would take %s's gross exposure to %s, over its limit of %s",
+				chapter.Name, gross.StringFixed(2), limits.MaxGrossExposure.StringFixed(2)),
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package risk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rejection codes of the client clock rule
+const (
+	CodeStaleOrder  = "STALE_ORDER"
+	CodeClockAhead  = "CLIENT_CLOCK_AHEAD"
+	CodeReusedNonce = "REUSED_NONCE"
+)
+
+// Nonces remembers the nonces users have sent for as long as an order
+// carrying them could still be accepted
+type Nonces struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPrune time.Time
+}
+
+func NewNonces() *Nonces {
+	return &Nonces{seen: make(map[string]time.Time)}
+}
+
+// Use records a user's nonce until expires, reporting false if it is
+// already in use
+func (n *Nonces) Use(userID, nonce string, now, expires time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if now.After(n.nextPrune) {
+		for key, exp := range n.seen {
+			if !exp.After(now) {
+				delete(n.seen, key)
+			}
+		}
+		n.nextPrune = now.Add(time.Minute)
+	}
+
+	key := userID + "\x00" + nonce
+	if exp, ok := n.seen[key]; ok && exp.After(now) {
+		return false
+	}
+	n.seen[key] = expires
+	return true
+}
+
+// ClientClockRule blocks orders generated longer than maxAge ago by the
+// client's clock, so a strategy that wakes up after a network partition
+// doesn't fire orders for a market that has moved on. Orders claiming a
+// time more than maxAge ahead are blocked too, since the client's clock
+// can't be trusted to date them. A nonce may be used once per user until the
+// order carrying it goes stale, so resending an order that was already
+// accepted can't place it twice. Orders without a client time pass.
+type ClientClockRule struct {
+	maxAge time.Duration
+	nonces *Nonces
+}
+
+func NewClientClockRule(maxAge time.Duration, nonces *Nonces) *ClientClockRule {
+	return &ClientClockRule{
+		maxAge: maxAge,
+		nonces: nonces,
+	}
+}
+
+func (r *ClientClockRule) Name() string {
+	return "client_clock"
+}
+
+func (r *ClientClockRule) Check(o Order) (*Finding, error) {
+	if o.ClientTime == nil {
+		return nil, nil
+	}
+
+	age := o.Time.Sub(*o.ClientTime)
+	switch {
+	case age > r.maxAge:
+		return r.block(CodeStaleOrder, fmt.Sprintf("order was generated %s ago, more than the %s allowed", age.Round(time.Millisecond), r.maxAge)), nil
+	case -age > r.maxAge:
+		return r.block(CodeClockAhead, fmt.Sprintf("order is dated %s in the future; check the client's clock", (-age).Round(time.Millisecond))), nil
+	}
+
+	if o.Nonce != "" && !r.nonces.Use(o.UserID, o.Nonce, o.Time, o.ClientTime.Add(r.maxAge)) {
+		return r.block(CodeReusedNonce, fmt.Sprintf("nonce %q was already used", o.Nonce)), nil
+	}
+	return nil, nil
+}
+
+func (r *ClientClockRule) block(code, reason string) *Finding {
+	return &Finding{
+		Rule:   r.Name(),
+		Action: ActionBlock,
+		Code:   code,
+		Reason: reason,
+	}
+}
@@ -0,0 +1,198 @@
+package risk
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/orders"
+)
+
+// CodeConcentrationLimit is the rejection code of an order blocked by a
+// concentration limit
+const CodeConcentrationLimit = "CONCENTRATION_LIMIT"
+
+// ConcentrationLimits caps the market value of any one symbol as a fraction
+// of capital: a user's (their allocation, else their account's equity) and
+// the desk's equity. Zero disables a limit.
+type ConcentrationLimits struct {
+	User decimal.Decimal `json:"user"`
+	Desk decimal.Decimal `json:"desk"`
+}
+
+// Enabled reports whether any concentration limit is set
+func (l ConcentrationLimits) Enabled() bool {
+	return l.User.IsPositive() || l.Desk.IsPositive()
+}
+
+// SymbolConcentration is one symbol's share of capital
+type SymbolConcentration struct {
+	Symbol      string          `json:"symbol"`
+	Qty         decimal.Decimal `json:"qty"`
+	MarketValue decimal.Decimal `json:"market_value"`
+	// Share is the absolute market value as a fraction of capital
+	Share    decimal.Decimal `json:"share"`
+	Breached bool            `json:"breached"`
+}
+
+// ConcentrationReport is how concentrated a set of positions is
+type ConcentrationReport struct {
+	Capital decimal.Decimal       `json:"capital"`
+	Limit   decimal.Decimal       `json:"limit"`
+	Symbols []SymbolConcentration `json:"symbols"`
+}
+
+// Concentration nets positions by symbol and reports each symbol's share of
+// capital against limit (0 for none), most concentrated first
+func Concentration(positions []database.PositionMark, capital, limit decimal.Decimal) ConcentrationReport {
+	net := make(map[string]*SymbolConcentration)
+	for _, p := range positions {
+		c, ok := net[p.Symbol]
+		if !ok {
+			c = &SymbolConcentration{Symbol: p.Symbol}
+			net[p.Symbol] = c
+		}
+		c.Qty = c.Qty.Add(p.Qty)
+		c.MarketValue = c.MarketValue.Add(p.MarketValue)
+	}
+
+	report := ConcentrationReport{Capital: capital, Limit: limit, Symbols: []SymbolConcentration{}}
+	for _, c := range net {
+		if c.Qty.IsZero() {
+			continue
+		}
+		if capital.IsPositive() {
+			c.Share = c.MarketValue.Abs().Div(capital)
+		}
+		c.Breached = limit.IsPositive() && (c.Share.GreaterThan(limit) || !capital.IsPositive())
+		report.Symbols = append(report.Symbols, *c)
+	}
+	slices.SortFunc(report.Symbols, func(a, b SymbolConcentration) int {
+		if n := b.Share.Cmp(a.Share); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.Symbol, b.Symbol)
+	})
+	return report
+}
+
+// ConcentrationRule keeps any one symbol within its limits of the ordering
+// user's capital and of the desk's equity, as of the latest marks. An order
+// that would breach a limit is blocked, or with ActionTrim cut to the
+// quantity that fits if any does. Orders that only reduce a position always
+// pass. The desk limit doesn't apply to users whose chapter trades in its
+// own account.
+type ConcentrationRule struct {
+	limits     ConcentrationLimits
+	action     string
+	positions  Positions
+	prices     Prices
+	capital    func(userID string) (decimal.Decimal, error)
+	snapshots  *Snapshotter
+	ownAccount func(userID string) bool
+}
+
+func NewConcentrationRule(limits ConcentrationLimits, action string, positions Positions, prices Prices,
+	capital func(userID string) (decimal.Decimal, error), snapshots *Snapshotter, ownAccount func(userID string) bool) *ConcentrationRule {
+	return &ConcentrationRule{
+		limits:     limits,
+		action:     action,
+		positions:  positions,
+		prices:     prices,
+		capital:    capital,
+		snapshots:  snapshots,
+		ownAccount: ownAccount,
+	}
+}
+
+func (r *ConcentrationRule) Name() string {
+	return "concentration"
+}
+
+func (r *ConcentrationRule) Check(o Order) (*Finding, error) {
+	if !o.Opens() {
+		return nil, nil
+	}
+
+	var price decimal.Decimal
+	if o.LimitPrice != nil {
+		price = *o.LimitPrice
+	} else {
+		p, err := r.prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		price = p
+	}
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("no positive price for %s", o.Symbol)
+	}
+
+	// maxQty is the most the order may be, the smallest any limit allows
+	maxQty := o.Qty
+	var breach string
+	check := func(scope string, limit, capital decimal.Decimal, positions []database.PositionMark) {
+		var held decimal.Decimal
+		for _, p := range positions {
+			if p.Symbol == o.Symbol {
+				held = held.Add(p.Qty)
+			}
+		}
+		if o.Side == "sell" {
+			held = held.Neg()
+		}
+		// The position may grow in the order's direction to limit x capital
+		allowed := decimal.Max(limit.Mul(capital), decimal.Zero).Div(price).Sub(held)
+		if allowed.LessThan(maxQty) {
+			maxQty = allowed
+			breach = fmt.Sprintf("%s%% of %s capital (%s)", limit.Shift(2).String(), scope, capital.StringFixed(2))
+		}
+	}
+
+	if r.limits.User.IsPositive() {
+		capital, err := r.capital(o.UserID)
+		if err != nil {
+			return nil, err
+		}
+		check("the user's", r.limits.User, capital, r.positions.Positions(o.UserID))
+	}
+	if r.limits.Desk.IsPositive() && !r.ownAccount(o.UserID) {
+		snap := r.snapshots.Latest()
+		if snap == nil {
+			return nil, fmt.Errorf("no risk snapshot has been taken yet")
+		}
+		var desk []database.PositionMark
+		for _, p := range r.positions.Positions("") {
+			if !r.ownAccount(p.UserID) {
+				desk = append(desk, p)
+			}
+		}
+		check("the desk's", r.limits.Desk, snap.Equity, desk)
+	}
+	if breach == "" {
+		return nil, nil
+	}
+
+	if orders.AssetClassOf(o.Symbol) != orders.AssetClassCrypto && o.Qty.IsInteger() {
+		maxQty = maxQty.RoundFloor(0)
+	} else {
+		maxQty = maxQty.RoundFloor(9)
+	}
+	if r.action != ActionTrim || !maxQty.IsPositive() {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   CodeConcentrationLimit,
+			Reason: fmt.Sprintf("order would take %s over %s", o.Symbol, breach),
+		}, nil
+	}
+	return &Finding{
+		Rule:   r.Name(),
+		Action: ActionTrim,
+		Reason: fmt.Sprintf("order cut from %s to %s to keep %s within %s", o.Qty, maxQty, o.Symbol, breach),
+		Qty:    &maxQty,
+	}, nil
+}
@@ -0,0 +1,305 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/expr"
+	"desk/internal/orders"
+)
+
+// CustomRuleVars are the variables custom rule expressions may use. account
+// is the desk's account as of the latest risk snapshot; user.capital is the
+// ordering user's allocation, else their account's equity.
+var CustomRuleVars = map[string]expr.Kind{
+	"order.symbol":             expr.KindString,
+	"order.side":               expr.KindString,
+	"order.asset_class":        expr.KindString,
+	"order.user":               expr.KindString,
+	"order.source":             expr.KindString,
+	"order.strategy_id":        expr.KindNumber,
+	"order.qty":                expr.KindNumber,
+	"order.price":              expr.KindNumber,
+	"order.notional":           expr.KindNumber,
+	"order.opens":              expr.KindBool,
+	"position.qty":             expr.KindNumber,
+	"position.value":           expr.KindNumber,
+	"symbol.price":             expr.KindNumber,
+	"symbol.avg_volume":        expr.KindNumber,
+	"symbol.avg_dollar_volume": expr.KindNumber,
+	"account.equity":           expr.KindNumber,
+	"account.cash":             expr.KindNumber,
+	"account.buying_power":     expr.KindNumber,
+	"account.gross_exposure":   expr.KindNumber,
+	"account.net_exposure":     expr.KindNumber,
+	"account.leverage":         expr.KindNumber,
+	"account.drawdown":         expr.KindNumber,
+	"user.capital":             expr.KindNumber,
+}
+
+// CustomRuleDef is a pre-trade rule written as an expression. An order
+// passes while the expression is true; when it is false the rule flags or
+// blocks the order with Message.
+type CustomRuleDef struct {
+	Name    string `json:"name"`
+	Expr    string `json:"expr"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+
+	expr *expr.Expr
+}
+
+// Vars returns the variables the rule's expression uses
+func (d CustomRuleDef) Vars() []string {
+	return d.expr.Vars()
+}
+
+// LoadCustomRules reads and checks the custom rules in a JSON file, a list
+// of rule definitions. An empty path means no custom rules. Every
+// expression is parsed and type-checked here, so a bad rule is refused when
+// the configuration loads rather than on the first order.
+func LoadCustomRules(path string) ([]CustomRuleDef, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	var defs []CustomRuleDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range defs {
+		d := &defs[i]
+		if d.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("rule %s is defined twice", d.Name)
+		}
+		seen[d.Name] = true
+
+		switch d.Action {
+		case "":
+			d.Action = ActionBlock
+		case ActionFlag, ActionBlock:
+		default:
+			return nil, fmt.Errorf("rule %s: invalid action %q (want flag or block)", d.Name, d.Action)
+		}
+		if d.expr, err = expr.Parse(d.Expr, CustomRuleVars); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", d.Name, err)
+		}
+		if d.expr.Kind() != expr.KindBool {
+			return nil, fmt.Errorf("rule %s: expression is a %s, not a condition", d.Name, d.expr.Kind())
+		}
+	}
+	return defs, nil
+}
+
+// Volumes supplies symbols' average daily volume in shares and dollars
+type Volumes interface {
+	AverageVolume(symbol string) (decimal.Decimal, decimal.Decimal, error)
+}
+
+// RuleHits stores custom rule hits
+type RuleHits interface {
+	RecordRuleHit(h database.RuleHit) error
+}
+
+// CustomSources is where custom rules look up the values of their variables
+// and record their hits
+type CustomSources struct {
+	Snapshots *Snapshotter
+	Prices    Prices
+	Volumes   Volumes
+	Capital   func(userID string) (decimal.Decimal, error)
+	Hits      RuleHits
+}
+
+// CustomRule evaluates a CustomRuleDef against each order. Variables are
+// looked up only when the expression reaches them, so a rule that checks
+// order.opens first never prices an order that only reduces. Every hit is
+// logged and recorded with the values the expression saw.
+type CustomRule struct {
+	def     CustomRuleDef
+	sources CustomSources
+}
+
+func NewCustomRule(def CustomRuleDef, sources CustomSources) *CustomRule {
+	return &CustomRule{
+		def:     def,
+		sources: sources,
+	}
+}
+
+func (r *CustomRule) Name() string {
+	return r.def.Name
+}
+
+func (r *CustomRule) Check(o Order) (*Finding, error) {
+	env := &customEnv{order: o, sources: r.sources, values: make(map[string]expr.Value)}
+	v, err := r.def.expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if v.Bool() {
+		return nil, nil
+	}
+
+	reason := r.def.Message
+	if reason == "" {
+		reason = "order fails " + r.def.Expr
+	}
+	var seen []string
+	for _, name := range r.def.Vars() {
+		if value, ok := env.values[name]; ok {
+			seen = append(seen, name+" = "+value.String())
+		}
+	}
+	if len(seen) > 0 {
+		reason += " (" + strings.Join(seen, ", ") + ")"
+	}
+
+	log.Printf("Risk rule %s hit (%s): user=%s %s %s %s: %s", r.def.Name, r.def.Action, o.UserID, o.Side, o.Qty, o.Symbol, reason)
+	if r.sources.Hits != nil {
+		if err := r.sources.Hits.RecordRuleHit(database.RuleHit{
+			Rule:       r.def.Name,
+			Action:     r.def.Action,
+			UserID:     o.UserID,
+			StrategyID: o.StrategyID,
+			Symbol:     o.Symbol,
+			Side:       o.Side,
+			Qty:        o.Qty,
+			Reason:     reason,
+			HitAt:      o.Time,
+		}); err != nil {
+			log.Printf("Failed to record hit of risk rule %s: %v", r.def.Name, err)
+		}
+	}
+
+	return &Finding{
+		Rule:   r.def.Name,
+		Action: r.def.Action,
+		Reason: reason,
+	}, nil
+}
+
+// customEnv looks up an order's variables, remembering each value so it is
+// fetched at most once and can be reported with a hit
+type customEnv struct {
+	order   Order
+	sources CustomSources
+	values  map[string]expr.Value
+}
+
+func (e *customEnv) Lookup(name string) (expr.Value, error) {
+	if v, ok := e.values[name]; ok {
+		return v, nil
+	}
+	v, err := e.lookup(name)
+	if err != nil {
+		return expr.Value{}, err
+	}
+	e.values[name] = v
+	return v, nil
+}
+
+func (e *customEnv) number(name string) (decimal.Decimal, error) {
+	v, err := e.Lookup(name)
+	return v.Number(), err
+}
+
+func (e *customEnv) lookup(name string) (expr.Value, error) {
+	o := e.order
+	switch name {
+	case "order.symbol":
+		return expr.String(o.Symbol), nil
+	case "order.side":
+		return expr.String(o.Side), nil
+	case "order.asset_class":
+		return expr.String(orders.AssetClassOf(o.Symbol)), nil
+	case "order.user":
+		return expr.String(o.UserID), nil
+	case "order.source":
+		return expr.String(o.Source), nil
+	case "order.strategy_id":
+		var id int64
+		if o.StrategyID != nil {
+			id = *o.StrategyID
+		}
+		return expr.Number(decimal.NewFromInt(id)), nil
+	case "order.qty":
+		return expr.Number(o.Qty), nil
+	case "order.opens":
+		return expr.Bool(o.Opens()), nil
+	case "order.price":
+		if o.LimitPrice != nil {
+			return expr.Number(*o.LimitPrice), nil
+		}
+		price, err := e.number("symbol.price")
+		return expr.Number(price), err
+	case "order.notional":
+		price, err := e.number("order.price")
+		return expr.Number(o.Qty.Mul(price)), err
+	case "position.qty":
+		return expr.Number(o.PositionQty), nil
+	case "position.value":
+		price, err := e.number("symbol.price")
+		return expr.Number(o.PositionQty.Mul(price)), err
+	case "symbol.price":
+		price, err := e.sources.Prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return expr.Value{}, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		return expr.Number(price), nil
+	case "symbol.avg_volume", "symbol.avg_dollar_volume":
+		if e.sources.Volumes == nil {
+			return expr.Value{}, errors.New("no daily bars are available")
+		}
+		shares, dollars, err := e.sources.Volumes.AverageVolume(o.Symbol)
+		if err != nil {
+			return expr.Value{}, fmt.Errorf("failed to get average volume of %s: %w", o.Symbol, err)
+		}
+		if name == "symbol.avg_volume" {
+			return expr.Number(shares), nil
+		}
+		return expr.Number(dollars), nil
+	case "user.capital":
+		capital, err := e.sources.Capital(o.UserID)
+		return expr.Number(capital), err
+	}
+
+	if field, ok := strings.CutPrefix(name, "account."); ok {
+		snap := e.sources.Snapshots.Latest()
+		if snap == nil {
+			return expr.Value{}, errors.New("no risk snapshot has been taken yet")
+		}
+		switch field {
+		case "equity":
+			return expr.Number(snap.Equity), nil
+		case "cash":
+			return expr.Number(snap.Cash), nil
+		case "buying_power":
+			return expr.Number(snap.BuyingPower), nil
+		case "gross_exposure":
+			return expr.Number(snap.GrossExposure), nil
+		case "net_exposure":
+			return expr.Number(snap.NetExposure), nil
+		case "leverage":
+			return expr.Number(snap.Leverage), nil
+		case "drawdown":
+			return expr.Number(snap.Drawdown), nil
+		}
+	}
+	return expr.Value{}, fmt.Errorf("unknown variable")
+}
@@ -0,0 +1,76 @@
+package risk
+
+import "fmt"
+
+// Deletions looks up whether users and strategies have been deleted, and
+// whether strategies have been killed
+type Deletions interface {
+	IsUserDeleted(userID string) (bool, error)
+	IsStrategyDeleted(id int64) (bool, error)
+	IsStrategyKilled(id int64) (bool, error)
+}
+
+// DeletedRule blocks orders from deactivated users and orders attributed to
+// deleted strategies, such as a strategy process still running elsewhere.
+// Orders of a killed strategy are blocked unless they only close a
+// position, so the strategy can still be flattened.
+type DeletedRule struct {
+	deletions Deletions
+}
+
+func NewDeletedRule(deletions Deletions) *DeletedRule {
+	return &DeletedRule{
+		deletions: deletions,
+	}
+}
+
+func (r *DeletedRule) Name() string {
+	return "deleted"
+}
+
+func (r *DeletedRule) Check(o Order) (*Finding, error) {
+	deleted, err := r.deletions.IsUserDeleted(o.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "USER_DEACTIVATED",
+			Reason: fmt.Sprintf("user %s has been deactivated", o.UserID),
+		}, nil
+	}
+
+	if o.StrategyID == nil {
+		return nil, nil
+	}
+	if deleted, err = r.deletions.IsStrategyDeleted(*o.StrategyID); err != nil {
+		return nil, err
+	}
+	if deleted {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "STRATEGY_DELETED",
+			Reason: fmt.Sprintf("strategy %d has been deleted", *o.StrategyID),
+		}, nil
+	}
+
+	if !o.Opens() {
+		return nil, nil
+	}
+	killed, err := r.deletions.IsStrategyKilled(*o.StrategyID)
+	if err != nil {
+		return nil, err
+	}
+	if killed {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "STRATEGY_KILLED",
+			Reason: fmt.Sprintf("strategy %d has been killed", *o.StrategyID),
+		}, nil
+	}
+	return nil, nil
+}
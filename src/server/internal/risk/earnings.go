@@ -0,0 +1,57 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// EarningsCalendar looks up scheduled earnings reports
+type EarningsCalendar interface {
+	GetEarningsEvents(from, to time.Time, symbols []string) ([]database.EarningsEvent, error)
+}
+
+// EarningsRule flags or blocks orders that open positions in a symbol
+// reporting earnings within the window. Orders that only reduce a position
+// are always allowed.
+type EarningsRule struct {
+	calendar EarningsCalendar
+	window   time.Duration
+	action   string
+}
+
+func NewEarningsRule(calendar EarningsCalendar, window time.Duration, action string) *EarningsRule {
+	return &EarningsRule{
+		calendar: calendar,
+		window:   window,
+		action:   action,
+	}
+}
+
+func (r *EarningsRule) Name() string {
+	return "earnings"
+}
+
+func (r *EarningsRule) Check(o Order) (*Finding, error) {
+	if !o.Opens() {
+		return nil, nil
+	}
+
+	events, err := r.calendar.GetEarningsEvents(o.Time, o.Time.Add(r.window), []string{o.Symbol})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	next := events[0]
+	return &Finding{
+		Rule:   r.Name(),
+		Action: r.action,
+		Reason: fmt.Sprintf("%s reports earnings around %s, within %s",
+			o.Symbol, market.ExchangeTime(next.ReportAt).Format("2006-01-02 15:04 MST"), r.window),
+	}, nil
+}
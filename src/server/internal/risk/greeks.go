@@ -0,0 +1,347 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/options"
+)
+
+// Quotes supplies the current prices greeks are computed from
+type Quotes interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+	OptionMid(symbol string) (decimal.Decimal, error)
+}
+
+// PositionGreeks are one position's sensitivities. Delta is in shares of the
+// underlying; the dollar figures are what the portfolio totals add up.
+type PositionGreeks struct {
+	Symbol     string            `json:"symbol"`
+	Qty        decimal.Decimal   `json:"qty"`
+	Contract   *options.Contract `json:"contract,omitempty"`
+	Spot       decimal.Decimal   `json:"spot"`
+	Price      decimal.Decimal   `json:"price"`
+	ImpliedVol *decimal.Decimal  `json:"implied_vol,omitempty"`
+	Delta      decimal.Decimal   `json:"delta"`
+	Gamma      decimal.Decimal   `json:"gamma"`
+	// DeltaDollars is delta times the underlying price
+	DeltaDollars decimal.Decimal `json:"delta_dollars"`
+	// GammaDollars is the change in DeltaDollars for a 1% move in the
+	// underlying
+	GammaDollars decimal.Decimal `json:"gamma_dollars"`
+	// Theta is the dollar change per calendar day
+	Theta decimal.Decimal `json:"theta"`
+	// Vega is the dollar change per volatility point
+	Vega  decimal.Decimal `json:"vega"`
+	Error string          `json:"error,omitempty"`
+}
+
+// PortfolioGreeks are the dollar greeks of the whole portfolio
+type PortfolioGreeks struct {
+	Delta decimal.Decimal `json:"delta"`
+	Gamma decimal.Decimal `json:"gamma"`
+	Theta decimal.Decimal `json:"theta"`
+	Vega  decimal.Decimal `json:"vega"`
+}
+
+// GreekLimits cap the absolute portfolio greeks, in the units of
+// PortfolioGreeks. A zero limit is not enforced.
+type GreekLimits struct {
+	Delta decimal.Decimal `json:"delta"`
+	Gamma decimal.Decimal `json:"gamma"`
+	Theta decimal.Decimal `json:"theta"`
+	Vega  decimal.Decimal `json:"vega"`
+}
+
+// Enabled reports whether any limit is set
+func (l GreekLimits) Enabled() bool {
+	return l.Delta.IsPositive() || l.Gamma.IsPositive() || l.Theta.IsPositive() || l.Vega.IsPositive()
+}
+
+// breaches lists the greeks of g beyond their limits
+func (l GreekLimits) breaches(g PortfolioGreeks) []string {
+	var out []string
+	check := func(name string, value, limit decimal.Decimal) {
+		if limit.IsPositive() && value.Abs().GreaterThan(limit) {
+			out = append(out, fmt.Sprintf("%s %s exceeds %s", name, value.Round(2), limit))
+		}
+	}
+	check("delta", g.Delta, l.Delta)
+	check("gamma", g.Gamma, l.Gamma)
+	check("theta", g.Theta, l.Theta)
+	check("vega", g.Vega, l.Vega)
+	return out
+}
+
+// GreeksReport is the greeks of every open position and their total
+type GreeksReport struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Positions []PositionGreeks `json:"positions"`
+	Portfolio PortfolioGreeks  `json:"portfolio"`
+	Limits    GreekLimits      `json:"limits"`
+	Breaches  []string         `json:"breaches"`
+	// Unpriced counts positions left out of the totals because they couldn't
+	// be priced
+	Unpriced int `json:"unpriced"`
+}
+
+// GreeksMonitor periodically prices the desk's positions with the
+// Black-Scholes model, using implied volatilities backed out of current
+// option quotes. Equity and crypto positions only carry delta.
+type GreeksMonitor struct {
+	source   AccountSource
+	quotes   Quotes
+	interval time.Duration
+	rate     float64
+
+	mu     sync.RWMutex
+	latest *GreeksReport
+	limits GreekLimits
+}
+
+// NewGreeksMonitor creates a monitor. rate is the annual risk-free rate used
+// by the pricing model.
+func NewGreeksMonitor(source AccountSource, quotes Quotes, interval time.Duration, rate float64) *GreeksMonitor {
+	return &GreeksMonitor{
+		source:   source,
+		quotes:   quotes,
+		interval: interval,
+		rate:     rate,
+	}
+}
+
+// Run computes greeks every interval until ctx is cancelled
+func (m *GreeksMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Refresh(); err != nil {
+			log.Printf("Failed to compute greeks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the most recent report, or nil if none has been computed yet
+func (m *GreeksMonitor) Latest() *GreeksReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest
+}
+
+// Limits returns the greek limits
+func (m *GreeksMonitor) Limits() GreekLimits {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.limits
+}
+
+// SetLimits changes the greek limits from the next check on
+func (m *GreeksMonitor) SetLimits(limits GreekLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits = limits
+}
+
+// Refresh prices the current positions and stores the report
+func (m *GreeksMonitor) Refresh() (*GreeksReport, error) {
+	positions, err := m.source.Positions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &GreeksReport{
+		Timestamp: now,
+		Positions: []PositionGreeks{},
+		Breaches:  []string{},
+	}
+	for _, p := range positions {
+		pg := m.positionGreeks(p, now)
+		if pg.Error != "" {
+			report.Unpriced++
+		} else {
+			report.Portfolio.Delta = report.Portfolio.Delta.Add(pg.DeltaDollars)
+			report.Portfolio.Gamma = report.Portfolio.Gamma.Add(pg.GammaDollars)
+			report.Portfolio.Theta = report.Portfolio.Theta.Add(pg.Theta)
+			report.Portfolio.Vega = report.Portfolio.Vega.Add(pg.Vega)
+		}
+		report.Positions = append(report.Positions, pg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report.Limits = m.limits
+	if b := m.limits.breaches(report.Portfolio); b != nil {
+		report.Breaches = b
+	}
+	m.latest = report
+	return report, nil
+}
+
+func (m *GreeksMonitor) positionGreeks(p alpaca.Position, now time.Time) PositionGreeks {
+	pg := PositionGreeks{Symbol: p.Symbol, Qty: p.Qty}
+	if p.CurrentPrice != nil {
+		pg.Price = *p.CurrentPrice
+	}
+
+	unit, err := m.unitGreeks(p.Symbol, now)
+	if err != nil {
+		pg.Error = err.Error()
+		return pg
+	}
+	pg.Contract = unit.Contract
+	pg.Spot = unit.Spot
+	pg.Price = unit.Price
+	pg.ImpliedVol = unit.ImpliedVol
+	pg.Delta = unit.Delta.Mul(p.Qty)
+	pg.Gamma = unit.Gamma.Mul(p.Qty)
+	pg.DeltaDollars = unit.DeltaDollars.Mul(p.Qty).Round(2)
+	pg.GammaDollars = unit.GammaDollars.Mul(p.Qty).Round(2)
+	pg.Theta = unit.Theta.Mul(p.Qty).Round(2)
+	pg.Vega = unit.Vega.Mul(p.Qty).Round(2)
+	return pg
+}
+
+// unitGreeks prices one share of symbol, or one contract if it is an option
+func (m *GreeksMonitor) unitGreeks(symbol string, now time.Time) (*PositionGreeks, error) {
+	contract, err := options.ParseOCC(symbol)
+	if err != nil {
+		spot, err := m.quotes.LatestPrice(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("no price for %s: %w", symbol, err)
+		}
+		return &PositionGreeks{
+			Symbol:       symbol,
+			Spot:         spot,
+			Price:        spot,
+			Delta:        decimal.NewFromInt(1),
+			DeltaDollars: spot,
+		}, nil
+	}
+
+	spot, err := m.quotes.LatestPrice(contract.Underlying)
+	if err != nil {
+		return nil, fmt.Errorf("no price for %s: %w", contract.Underlying, err)
+	}
+	price, err := m.quotes.OptionMid(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("no quote for %s: %w", symbol, err)
+	}
+	years, err := contract.YearsToExpiry(now)
+	if err != nil {
+		return nil, err
+	}
+
+	in := options.Inputs{
+		Type:   contract.Type,
+		Spot:   spot.InexactFloat64(),
+		Strike: contract.Strike.InexactFloat64(),
+		Years:  years,
+		Rate:   m.rate,
+	}
+	var iv *decimal.Decimal
+	if years > 0 {
+		if in.Vol, err = options.ImpliedVol(in, price.InexactFloat64()); err != nil {
+			return nil, fmt.Errorf("%s at %s: %w", symbol, price, err)
+		}
+		v := decimal.NewFromFloat(in.Vol).Round(4)
+		iv = &v
+	}
+	g := options.Price(in)
+
+	contractSize := float64(options.Multiplier)
+	return &PositionGreeks{
+		Symbol:       symbol,
+		Contract:     contract,
+		Spot:         spot,
+		Price:        price,
+		ImpliedVol:   iv,
+		Delta:        decimal.NewFromFloat(g.Delta * contractSize).Round(4),
+		Gamma:        decimal.NewFromFloat(g.Gamma * contractSize).Round(6),
+		DeltaDollars: decimal.NewFromFloat(g.Delta * contractSize * in.Spot),
+		GammaDollars: decimal.NewFromFloat(g.Gamma * contractSize * in.Spot * in.Spot / 100),
+		Theta:        decimal.NewFromFloat(g.Theta * contractSize),
+		Vega:         decimal.NewFromFloat(g.Vega * contractSize),
+	}, nil
+}
+
+// GreekRule blocks orders that would take a portfolio greek beyond its limit,
+// or further beyond it. Orders that bring the portfolio back toward its
+// limits are allowed.
+type GreekRule struct {
+	monitor *GreeksMonitor
+}
+
+func NewGreekRule(monitor *GreeksMonitor) *GreekRule {
+	return &GreekRule{
+		monitor: monitor,
+	}
+}
+
+func (r *GreekRule) Name() string {
+	return "greeks"
+}
+
+func (r *GreekRule) Check(o Order) (*Finding, error) {
+	limits := r.monitor.Limits()
+	if !limits.Enabled() {
+		return nil, nil
+	}
+	report := r.monitor.Latest()
+	if report == nil {
+		return nil, fmt.Errorf("portfolio greeks have not been computed yet")
+	}
+
+	unit, err := r.monitor.unitGreeks(o.Symbol, o.Time)
+	if err != nil {
+		return nil, err
+	}
+	qty := o.Qty
+	if o.Side == "sell" {
+		qty = qty.Neg()
+	}
+
+	current := report.Portfolio
+	projected := PortfolioGreeks{
+		Delta: current.Delta.Add(unit.DeltaDollars.Mul(qty)),
+		Gamma: current.Gamma.Add(unit.GammaDollars.Mul(qty)),
+		Theta: current.Theta.Add(unit.Theta.Mul(qty)),
+		Vega:  current.Vega.Add(unit.Vega.Mul(qty)),
+	}
+
+	// Only a greek the order moves further from zero counts against it
+	for _, g := range []struct {
+		before, after decimal.Decimal
+		limits        GreekLimits
+	}{
+		{current.Delta, projected.Delta, GreekLimits{Delta: limits.Delta}},
+		{current.Gamma, projected.Gamma, GreekLimits{Gamma: limits.Gamma}},
+		{current.Theta, projected.Theta, GreekLimits{Theta: limits.Theta}},
+		{current.Vega, projected.Vega, GreekLimits{Vega: limits.Vega}},
+	} {
+		if !g.after.Abs().GreaterThan(g.before.Abs()) {
+			continue
+		}
+		if b := g.limits.breaches(projected); len(b) > 0 {
+			return &Finding{
+				Rule:   r.Name(),
+				Action: ActionBlock,
+				Reason: fmt.Sprintf("portfolio %s after this order", b[0]),
+			}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,48 @@
+package risk
+
+import (
+	"fmt"
+
+	"desk/internal/halts"
+	"desk/internal/market"
+)
+
+// Halts reports which symbols are halted
+type Halts interface {
+	Halted(symbol string) (halts.Halt, bool)
+}
+
+// HaltRule blocks orders in symbols the market has halted or paused. The
+// finding carries the halt's rejection code so clients can tell a halt from
+// other blocks.
+type HaltRule struct {
+	halts Halts
+}
+
+func NewHaltRule(halts Halts) *HaltRule {
+	return &HaltRule{
+		halts: halts,
+	}
+}
+
+func (r *HaltRule) Name() string {
+	return "halt"
+}
+
+func (r *HaltRule) Check(o Order) (*Finding, error) {
+	halt, ok := r.halts.Halted(o.Symbol)
+	if !ok {
+		return nil, nil
+	}
+
+	reason := fmt.Sprintf("%s is halted since %s", o.Symbol, market.ExchangeTime(halt.Since).Format("15:04:05 MST"))
+	if halt.Reason != "" {
+		reason += " (" + halt.Reason + ")"
+	}
+	return &Finding{
+		Rule:   r.Name(),
+		Action: ActionBlock,
+		Code:   halt.Code,
+		Reason: reason,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package risk
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// CodeLeverageLimit is the rejection code of an order blocked by the
+// leverage limit
+const CodeLeverageLimit = "LEVERAGE_LIMIT"
+
+// LeverageRule blocks orders that would take the account's leverage, gross
+// exposure over equity as of the latest risk snapshot, beyond its limit.
+// The order's whole notional is counted against it, as if the desk held no
+// offsetting position. Orders that only reduce a position are never held to
+// the limit, so a levered account can always be brought back down. Orders
+// of users whose chapter trades in its own account, which the snapshots don't
+// cover, are left to the chapter's limits.
+type LeverageRule struct {
+	snapshots  *Snapshotter
+	prices     Prices
+	ownAccount func(userID string) bool
+}
+
+func NewLeverageRule(snapshots *Snapshotter, prices Prices, ownAccount func(userID string) bool) *LeverageRule {
+	return &LeverageRule{
+		snapshots:  snapshots,
+		prices:     prices,
+		ownAccount: ownAccount,
+	}
+}
+
+func (r *LeverageRule) Name() string {
+	return "leverage"
+}
+
+func (r *LeverageRule) Check(o Order) (*Finding, error) {
+	limit := r.snapshots.LeverageLimit()
+	if !limit.IsPositive() || !o.Opens() || r.ownAccount(o.UserID) {
+		return nil, nil
+	}
+	snap := r.snapshots.Latest()
+	if snap == nil {
+		return nil, fmt.Errorf("no risk snapshot has been taken yet")
+	}
+
+	var price decimal.Decimal
+	if o.LimitPrice != nil {
+		price = *o.LimitPrice
+	} else {
+		p, err := r.prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		price = p
+	}
+	gross := snap.GrossExposure.Add(o.Qty.Mul(price))
+
+	if !snap.Equity.IsPositive() {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   CodeLeverageLimit,
+			Reason: fmt.Sprintf("account equity is %s; only orders that reduce positions are allowed", snap.Equity.StringFixed(2)),
+		}, nil
+	}
+	leverage := gross.Div(snap.Equity)
+	if leverage.LessThanOrEqual(limit) {
+		return nil, nil
+	}
+	return &Finding{
+		Rule:   r.Name(),
+		Action: ActionBlock,
+		Code:   CodeLeverageLimit,
+		Reason: fmt.Sprintf("order would take leverage from %sx to %sx, over the limit of %sx",
+			snap.Leverage.StringFixed(2), leverage.StringFixed(2), limit.String()),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package risk
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+)
+
+// Members looks up the limits onboarded members were given, and the cash
+// their paper trades have spent
+type Members interface {
+	GetMember(userID string) (*database.Member, error)
+	GetPaperSpent(userID string) (decimal.Decimal, error)
+}
+
+// MemberRule blocks orders that exceed the limits their user was onboarded
+// with: an order's notional, the gross market value of the user's
+// positions once the order fills, and, while the user trades on paper, buys
+// costing more than is left of their allocation. Users who weren't
+// onboarded have no limits of their own.
+type MemberRule struct {
+	members   Members
+	prices    Prices
+	positions Positions
+}
+
+func NewMemberRule(members Members, prices Prices, positions Positions) *MemberRule {
+	return &MemberRule{
+		members:   members,
+		prices:    prices,
+		positions: positions,
+	}
+}
+
+func (r *MemberRule) Name() string {
+	return "member_limits"
+}
+
+func (r *MemberRule) Check(o Order) (*Finding, error) {
+	member, err := r.members.GetMember(o.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil || (member.MaxOrderNotional.IsZero() && member.MaxGrossExposure.IsZero() && !member.Paper()) {
+		return nil, nil
+	}
+
+	var price decimal.Decimal
+	if o.LimitPrice != nil {
+		price = *o.LimitPrice
+	} else {
+		p, err := r.prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		price = p
+	}
+	notional := o.Qty.Mul(price)
+
+	if member.MaxOrderNotional.IsPositive() && notional.GreaterThan(member.MaxOrderNotional) {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "USER_ORDER_LIMIT",
+			Reason: fmt.Sprintf("order notional %s exceeds %s's limit of %s",
+				notional.StringFixed(2), o.UserID, member.MaxOrderNotional.StringFixed(2)),
+		}, nil
+	}
+
+	if member.Paper() && o.Side == "buy" {
+		spent, err := r.members.GetPaperSpent(o.UserID)
+		if err != nil {
+			return nil, err
+		}
+		left := member.PaperAllocation.Sub(spent)
+		if notional.GreaterThan(left) {
+			return &Finding{
+				Rule:   r.Name(),
+				Action: ActionBlock,
+				Code:   "PAPER_FUNDS",
+				Reason: fmt.Sprintf("order notional %s exceeds the %s left of %s's paper allocation of %s",
+					notional.StringFixed(2), left.StringFixed(2), o.UserID, member.PaperAllocation.StringFixed(2)),
+			}, nil
+		}
+	}
+
+	if !member.MaxGrossExposure.IsPositive() || !o.Opens() {
+		return nil, nil
+	}
+	gross := notional
+	for _, p := range r.positions.Positions(o.UserID) {
+		gross = gross.Add(p.MarketValue.Abs())
+	}
+	if gross.GreaterThan(member.MaxGrossExposure) {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: ActionBlock,
+			Code:   "USER_EXPOSURE_LIMIT",
+			Reason: fmt.Sprintf("order would take %s's gross exposure to %s, over their limit of %s",
+				o.UserID, gross.StringFixed(2), member.MaxGrossExposure.StringFixed(2)),
+		}, nil
+	}
+	return nil, nil
+}
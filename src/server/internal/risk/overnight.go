@@ -0,0 +1,182 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/orders"
+)
+
+// What the end-of-session check does about gross exposure over the
+// overnight limits
+const (
+	OvernightFlag   = "flag"
+	OvernightReduce = "reduce"
+)
+
+// CodeOvernightLimit is the rejection code of an order blocked by the
+// overnight limits
+const CodeOvernightLimit = "OVERNIGHT_LIMIT"
+
+// OvernightLimits caps the gross exposure the desk may carry out of the
+// session, in dollars and as leverage (gross exposure over equity). They
+// are usually tighter than the intraday limits; zero disables a limit.
+type OvernightLimits struct {
+	MaxGross    decimal.Decimal `json:"max_gross"`
+	MaxLeverage decimal.Decimal `json:"max_leverage"`
+}
+
+// Enabled reports whether any overnight limit is set
+func (l OvernightLimits) Enabled() bool {
+	return l.MaxGross.IsPositive() || l.MaxLeverage.IsPositive()
+}
+
+// Allowed returns the gross exposure the tighter of the limits allows at
+// equity. An account without positive equity is allowed none under a
+// leverage limit.
+func (l OvernightLimits) Allowed(equity decimal.Decimal) decimal.Decimal {
+	allowed := l.MaxGross
+	if l.MaxLeverage.IsPositive() {
+		byLeverage := decimal.Max(l.MaxLeverage.Mul(equity), decimal.Zero)
+		if !allowed.IsPositive() || byLeverage.LessThan(allowed) {
+			allowed = byLeverage
+		}
+	}
+	return allowed
+}
+
+// OvernightCheck compares a snapshot's gross exposure with the overnight
+// limits
+type OvernightCheck struct {
+	Equity        decimal.Decimal `json:"equity"`
+	GrossExposure decimal.Decimal `json:"gross_exposure"`
+	Allowed       decimal.Decimal `json:"allowed"`
+	// Excess is the gross exposure over Allowed, zero if within it
+	Excess decimal.Decimal `json:"excess"`
+}
+
+// CheckOvernight compares snap with the limits
+func CheckOvernight(snap *Snapshot, limits OvernightLimits) OvernightCheck {
+	c := OvernightCheck{
+		Equity:        snap.Equity,
+		GrossExposure: snap.GrossExposure,
+		Allowed:       limits.Allowed(snap.Equity),
+	}
+	c.Excess = decimal.Max(snap.GrossExposure.Sub(c.Allowed), decimal.Zero)
+	return c
+}
+
+// Reduction is an order that cuts a book's position for the overnight
+// limits
+type Reduction struct {
+	UserID     string          `json:"user_id"`
+	StrategyID int64           `json:"strategy_id,omitempty"`
+	Symbol     string          `json:"symbol"`
+	Side       string          `json:"side"`
+	Qty        decimal.Decimal `json:"qty"`
+}
+
+// OvernightReductions cuts every position by the same fraction of itself,
+// enough to remove excess from gross: positions shrink in proportion, so
+// no book's or symbol's share of the desk changes. Equity quantities are
+// rounded up to whole shares (or the whole position) so the cut is never
+// short of the excess.
+func OvernightReductions(positions []database.PositionMark, gross, excess decimal.Decimal) []Reduction {
+	if !gross.IsPositive() || !excess.IsPositive() {
+		return nil
+	}
+	fraction := decimal.Min(excess.Div(gross), decimal.NewFromInt(1))
+
+	var cuts []Reduction
+	for _, p := range positions {
+		held := p.Qty.Abs()
+		if held.IsZero() {
+			continue
+		}
+		qty := held.Mul(fraction)
+		if orders.AssetClassOf(p.Symbol) != orders.AssetClassCrypto {
+			qty = qty.RoundCeil(0)
+		} else {
+			qty = qty.RoundCeil(9)
+		}
+		qty = decimal.Min(qty, held)
+
+		side := "sell"
+		if p.Qty.IsNegative() {
+			side = "buy"
+		}
+		cuts = append(cuts, Reduction{
+			UserID:     p.UserID,
+			StrategyID: p.StrategyID,
+			Symbol:     p.Symbol,
+			Side:       side,
+			Qty:        qty,
+		})
+	}
+	return cuts
+}
+
+// OvernightRule holds orders placed from lead before the close until lead
+// before the next open to the overnight limits, so positions cut at the
+// end-of-session check aren't rebuilt before the close or in extended
+// hours. Like the leverage rule, it counts an opening order's whole notional
+// and never blocks orders that only reduce a position, and leaves users
+// whose chapter trades in its own account to the chapter's limits.
+type OvernightRule struct {
+	snapshots  *Snapshotter
+	prices     Prices
+	limits     OvernightLimits
+	lead       time.Duration
+	ownAccount func(userID string) bool
+}
+
+func NewOvernightRule(snapshots *Snapshotter, prices Prices, limits OvernightLimits, lead time.Duration, ownAccount func(userID string) bool) *OvernightRule {
+	return &OvernightRule{
+		snapshots:  snapshots,
+		prices:     prices,
+		limits:     limits,
+		lead:       lead,
+		ownAccount: ownAccount,
+	}
+}
+
+func (r *OvernightRule) Name() string {
+	return "overnight"
+}
+
+func (r *OvernightRule) Check(o Order) (*Finding, error) {
+	if market.InSession(o.Time.Add(r.lead)) || !o.Opens() || r.ownAccount(o.UserID) {
+		return nil, nil
+	}
+	snap := r.snapshots.Latest()
+	if snap == nil {
+		return nil, fmt.Errorf("no risk snapshot has been taken yet")
+	}
+
+	var price decimal.Decimal
+	if o.LimitPrice != nil {
+		price = *o.LimitPrice
+	} else {
+		p, err := r.prices.LatestPrice(o.Symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", o.Symbol, err)
+		}
+		price = p
+	}
+	gross := snap.GrossExposure.Add(o.Qty.Mul(price))
+	allowed := r.limits.Allowed(snap.Equity)
+	if gross.LessThanOrEqual(allowed) {
+		return nil, nil
+	}
+	return &Finding{
+		Rule:   r.Name(),
+		Action: ActionBlock,
+		Code:   CodeOvernightLimit,
+		Reason: fmt.Sprintf("order would take gross exposure to %s, over the %s allowed overnight",
+			gross.StringFixed(2), allowed.StringFixed(2)),
+	}, nil
+}
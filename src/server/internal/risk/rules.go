@@ -0,0 +1,185 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// What a pre-trade rule does with an order it objects to
+const (
+	ActionFlag  = "flag"
+	ActionBlock = "block"
+	// ActionTrim cuts the order to the finding's Qty
+	ActionTrim = "trim"
+)
+
+// Order is what pre-trade rules see about an order about to be placed
+type Order struct {
+	UserID     string
+	StrategyID *int64
+	Symbol     string
+	Side       string
+	Qty        decimal.Decimal
+	// LimitPrice is the order's limit, if it has one
+	LimitPrice *decimal.Decimal
+	// PositionQty is the net position in Symbol before the order; shorts are
+	// negative
+	PositionQty decimal.Decimal
+	Time        time.Time
+	// ClientTime is when the client says it generated the order and Nonce
+	// its unique ID for it, if it sent them
+	ClientTime *time.Time
+	Nonce      string
+	// Source is the channel the order came in through, such as manual or
+	// webhook
+	Source string
+}
+
+// Opens reports whether the order opens or adds to a position, as opposed to
+// only reducing one. An order that flips a position counts as opening.
+func (o Order) Opens() bool {
+	if o.Side == "buy" {
+		return !o.PositionQty.IsNegative() || o.Qty.GreaterThan(o.PositionQty.Neg())
+	}
+	return !o.PositionQty.IsPositive() || o.Qty.GreaterThan(o.PositionQty)
+}
+
+// Finding is a rule's objection to an order
+type Finding struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	// Code is a machine-readable rejection code, set by rules whose blocks
+	// clients are expected to handle specifically
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason"`
+	// Qty is what a trim cuts the order to
+	Qty *decimal.Decimal `json:"qty,omitempty"`
+}
+
+// TrimmedQty returns the smallest quantity findings trim an order to, and
+// whether any of them trims it
+func TrimmedQty(findings []Finding) (decimal.Decimal, bool) {
+	var qty decimal.Decimal
+	trimmed := false
+	for _, f := range findings {
+		if f.Action != ActionTrim || f.Qty == nil {
+			continue
+		}
+		if !trimmed || f.Qty.LessThan(qty) {
+			qty = *f.Qty
+		}
+		trimmed = true
+	}
+	return qty, trimmed
+}
+
+// Rule checks an order before it is placed, returning nil if it has no
+// objection
+type Rule interface {
+	Name() string
+	Check(o Order) (*Finding, error)
+}
+
+// BlockedError is returned for an order a rule blocked
+type BlockedError struct {
+	Findings []Finding
+}
+
+func (e *BlockedError) Error() string {
+	reasons := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		if f.Code != "" {
+			reasons[i] = fmt.Sprintf("%s [%s]: %s", f.Rule, f.Code, f.Reason)
+		} else {
+			reasons[i] = fmt.Sprintf("%s: %s", f.Rule, f.Reason)
+		}
+	}
+	return "blocked by risk rules (" + strings.Join(reasons, "; ") + ")"
+}
+
+// Code returns the rejection code of the first finding that has one
+func (e *BlockedError) Code() string {
+	for _, f := range e.Findings {
+		if f.Code != "" {
+			return f.Code
+		}
+	}
+	return ""
+}
+
+// Rules evaluates pre-trade rules in order
+type Rules struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+func NewRules(rules ...Rule) *Rules {
+	return &Rules{
+		rules: rules,
+	}
+}
+
+// Add appends a rule
+func (r *Rules) Add(rule Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+}
+
+// Replace swaps in a new set of rules, e.g. when configuration is reloaded
+func (r *Rules) Replace(rules ...Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = rules
+}
+
+// Names returns the names of the rules in force, in order
+func (r *Rules) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		names[i] = rule.Name()
+	}
+	return names
+}
+
+// Check runs every rule against the order and returns the flags and trims
+// raised; the caller applies the trims (see TrimmedQty). If any rule blocks
+// the order, or cannot be evaluated, a *BlockedError is returned instead:
+// pre-trade checks fail closed.
+func (r *Rules) Check(o Order) ([]Finding, error) {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+
+	var flags, blocks []Finding
+	for _, rule := range rules {
+		f, err := rule.Check(o)
+		if err != nil {
+			blocks = append(blocks, Finding{
+				Rule:   rule.Name(),
+				Action: ActionBlock,
+				Reason: "rule could not be evaluated: " + err.Error(),
+			})
+			continue
+		}
+		if f == nil {
+			continue
+		}
+		if f.Action == ActionBlock {
+			blocks = append(blocks, *f)
+		} else {
+			flags = append(flags, *f)
+		}
+	}
+
+	if len(blocks) > 0 {
+		return flags, &BlockedError{Findings: blocks}
+	}
+	return flags, nil
+}
@@ -0,0 +1,134 @@
+package risk
+
+import (
+	"sort"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// Shock is a hypothetical move in the price of a set of symbols
+type Shock struct {
+	Name string
+	// Symbols the shock applies to; nil applies it to every position
+	Symbols []string
+	// PricePct is the move in percent (-5 is a 5% drop)
+	PricePct decimal.Decimal
+}
+
+func (s Shock) applies(symbol string) bool {
+	if s.Symbols == nil {
+		return true
+	}
+	for _, sym := range s.Symbols {
+		if sym == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// PositionImpact is the estimated effect of a scenario on one position
+type PositionImpact struct {
+	Symbol       string          `json:"symbol"`
+	Qty          decimal.Decimal `json:"qty"`
+	Price        decimal.Decimal `json:"price"`
+	MarketValue  decimal.Decimal `json:"market_value"`
+	Shocks       []string        `json:"shocks"`
+	PricePct     decimal.Decimal `json:"price_pct"`
+	ShockedPrice decimal.Decimal `json:"shocked_price"`
+	ShockedValue decimal.Decimal `json:"shocked_value"`
+	PL           decimal.Decimal `json:"pl"`
+}
+
+// UnmodeledPosition is a position a scenario can't price, such as an option
+type UnmodeledPosition struct {
+	Symbol      string          `json:"symbol"`
+	AssetClass  string          `json:"asset_class"`
+	MarketValue decimal.Decimal `json:"market_value"`
+}
+
+// Scenario is the estimated P&L of a set of shocks on current positions
+type Scenario struct {
+	Timestamp    time.Time           `json:"timestamp"`
+	Equity       decimal.Decimal     `json:"equity"`
+	Positions    []PositionImpact    `json:"positions"`
+	Unmodeled    []UnmodeledPosition `json:"unmodeled"`
+	MarketValue  decimal.Decimal     `json:"market_value"`
+	ShockedValue decimal.Decimal     `json:"shocked_value"`
+	PL           decimal.Decimal     `json:"pl"`
+	// PLPct is PL as a percentage of equity
+	PLPct decimal.Decimal `json:"pl_pct"`
+}
+
+// RunScenario applies shocks to positions at their current prices. Every
+// shock matching a position applies, compounding, so "all -3%" followed by
+// a sector's "-5%" moves that sector 7.85%. Only equity and crypto
+// positions are modeled; anything else is listed as unmodeled. Positions
+// are ordered by P&L, worst first.
+func RunScenario(equity decimal.Decimal, positions []alpaca.Position, shocks []Shock) *Scenario {
+	s := &Scenario{
+		Timestamp: time.Now(),
+		Equity:    equity,
+		Positions: []PositionImpact{},
+		Unmodeled: []UnmodeledPosition{},
+	}
+
+	for _, p := range positions {
+		value := decimal.Zero
+		if p.MarketValue != nil {
+			value = *p.MarketValue
+		}
+		if p.AssetClass != alpaca.USEquity && p.AssetClass != alpaca.Crypto {
+			s.Unmodeled = append(s.Unmodeled, UnmodeledPosition{
+				Symbol:      p.Symbol,
+				AssetClass:  string(p.AssetClass),
+				MarketValue: value,
+			})
+			continue
+		}
+
+		price := p.AvgEntryPrice
+		if p.CurrentPrice != nil {
+			price = *p.CurrentPrice
+		}
+		if p.MarketValue == nil {
+			value = p.Qty.Mul(price)
+		}
+
+		impact := PositionImpact{
+			Symbol:      p.Symbol,
+			Qty:         p.Qty,
+			Price:       price,
+			MarketValue: value,
+			Shocks:      []string{},
+		}
+		factor := decimal.NewFromInt(1)
+		for _, shock := range shocks {
+			if shock.applies(p.Symbol) {
+				impact.Shocks = append(impact.Shocks, shock.Name)
+				factor = factor.Mul(hundred.Add(shock.PricePct).Div(hundred))
+			}
+		}
+		impact.PricePct = factor.Sub(decimal.NewFromInt(1)).Mul(hundred).Round(4)
+		impact.ShockedPrice = price.Mul(factor).Round(4)
+		impact.ShockedValue = value.Mul(factor).Round(2)
+		impact.PL = impact.ShockedValue.Sub(value)
+
+		s.Positions = append(s.Positions, impact)
+		s.MarketValue = s.MarketValue.Add(value)
+		s.ShockedValue = s.ShockedValue.Add(impact.ShockedValue)
+		s.PL = s.PL.Add(impact.PL)
+	}
+
+	sort.SliceStable(s.Positions, func(i, j int) bool {
+		return s.Positions[i].PL.LessThan(s.Positions[j].PL)
+	})
+	if equity.IsPositive() {
+		s.PLPct = s.PL.Div(equity).Mul(hundred).Round(4)
+	}
+	return s
+}
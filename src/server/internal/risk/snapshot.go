@@ -0,0 +1,256 @@
+package risk
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/stream"
+)
+
+// AccountSource provides the broker-side state a risk snapshot is built from
+type AccountSource interface {
+	Account() (*alpaca.Account, error)
+	Positions() ([]alpaca.Position, error)
+	OpenOrders() ([]alpaca.Order, error)
+}
+
+// Marks supplies the desk's current position marks
+type Marks interface {
+	MarkPrice(symbol string) (decimal.Decimal, bool)
+}
+
+// LeverageHistory stores the leverage of snapshots
+type LeverageHistory interface {
+	RecordLeverage(p database.LeveragePoint) error
+	DeleteLeverageBefore(cutoff time.Time) (int64, error)
+}
+
+// Snapshot is a point-in-time view of desk-wide risk
+type Snapshot struct {
+	Timestamp        time.Time       `json:"timestamp"`
+	Equity           decimal.Decimal `json:"equity"`
+	BuyingPower      decimal.Decimal `json:"buying_power"`
+	Cash             decimal.Decimal `json:"cash"`
+	LongExposure     decimal.Decimal `json:"long_exposure"`
+	ShortExposure    decimal.Decimal `json:"short_exposure"`
+	GrossExposure    decimal.Decimal `json:"gross_exposure"`
+	NetExposure      decimal.Decimal `json:"net_exposure"`
+	OpenOrders       int             `json:"open_orders"`
+	PeakEquity       decimal.Decimal `json:"peak_equity"`
+	Drawdown         decimal.Decimal `json:"drawdown"`
+	DrawdownLimit    decimal.Decimal `json:"drawdown_limit"`
+	DrawdownBreached bool            `json:"drawdown_breached"`
+	// Leverage is gross exposure over equity
+	Leverage         decimal.Decimal `json:"leverage"`
+	LeverageLimit    decimal.Decimal `json:"leverage_limit"`
+	LeverageBreached bool            `json:"leverage_breached"`
+}
+
+// Snapshotter periodically builds risk snapshots and publishes them to
+// subscribers. The intraday equity peak is tracked in memory and reset at the
+// start of each exchange session day, so drawdown never requires scanning
+// trade history. Positions with a current mark are valued at it, and equity
+// is adjusted by the difference from the broker's valuation, so exposure and
+// drawdown move with the same prices as unrealized P&L.
+type Snapshotter struct {
+	source        AccountSource
+	marks         Marks
+	interval      time.Duration
+	drawdownLimit decimal.Decimal
+	leverageLimit decimal.Decimal
+	hub           *stream.Hub[Snapshot]
+
+	history          LeverageHistory
+	historyEvery     time.Duration
+	historyRetention time.Duration
+	lastHistory      time.Time
+
+	mu         sync.RWMutex
+	latest     *Snapshot
+	peakEquity decimal.Decimal
+	peakDay    string
+}
+
+// NewSnapshotter creates a snapshotter. drawdownLimit is a fraction of peak
+// equity (e.g. 0.05 for 5%).
+func NewSnapshotter(source AccountSource, marks Marks, interval time.Duration, drawdownLimit decimal.Decimal) *Snapshotter {
+	return &Snapshotter{
+		source:        source,
+		marks:         marks,
+		interval:      interval,
+		drawdownLimit: drawdownLimit,
+		hub:           stream.NewHub[Snapshot](4),
+	}
+}
+
+// RecordLeverage persists the leverage of a snapshot to history every
+// every, keeping it for retention (0 for forever). It must be called before
+// Run.
+func (s *Snapshotter) RecordLeverage(history LeverageHistory, every, retention time.Duration) {
+	s.history = history
+	s.historyEvery = every
+	s.historyRetention = retention
+}
+
+// Run takes a snapshot every interval until ctx is cancelled
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if snap, err := s.take(); err != nil {
+			log.Printf("Failed to take risk snapshot: %v", err)
+		} else {
+			s.hub.Publish(*snap)
+			s.recordLeverage(snap)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the most recent snapshot, or nil if none has been taken yet
+func (s *Snapshotter) Latest() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latest
+}
+
+// Subscribe returns a channel receiving every new snapshot
+func (s *Snapshotter) Subscribe() (<-chan Snapshot, func()) {
+	return s.hub.Subscribe()
+}
+
+// SetDrawdownLimit changes the drawdown limit from the next snapshot on
+func (s *Snapshotter) SetDrawdownLimit(limit decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drawdownLimit = limit
+}
+
+// DrawdownLimit returns the drawdown limit in force
+func (s *Snapshotter) DrawdownLimit() decimal.Decimal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.drawdownLimit
+}
+
+// SetLeverageLimit changes the leverage limit (gross exposure over equity, 0
+// for none) from the next snapshot on
+func (s *Snapshotter) SetLeverageLimit(limit decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leverageLimit = limit
+}
+
+// LeverageLimit returns the leverage limit in force
+func (s *Snapshotter) LeverageLimit() decimal.Decimal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leverageLimit
+}
+
+// StreamStats describes the snapshot stream's subscribers
+func (s *Snapshotter) StreamStats() stream.Stats {
+	return s.hub.Stats()
+}
+
+// recordLeverage persists snap's leverage if historyEvery has passed since
+// the last point was recorded, pruning points older than the retention
+func (s *Snapshotter) recordLeverage(snap *Snapshot) {
+	if s.history == nil || snap.Timestamp.Sub(s.lastHistory) < s.historyEvery {
+		return
+	}
+	s.lastHistory = snap.Timestamp
+
+	if err := s.history.RecordLeverage(database.LeveragePoint{
+		RecordedAt:    snap.Timestamp,
+		Equity:        snap.Equity,
+		GrossExposure: snap.GrossExposure,
+		NetExposure:   snap.NetExposure,
+		Leverage:      snap.Leverage,
+	}); err != nil {
+		log.Printf("Failed to record leverage: %v", err)
+	}
+	if s.historyRetention > 0 {
+		if _, err := s.history.DeleteLeverageBefore(snap.Timestamp.Add(-s.historyRetention)); err != nil {
+			log.Printf("Failed to prune leverage history: %v", err)
+		}
+	}
+}
+
+func (s *Snapshotter) take() (*Snapshot, error) {
+	account, err := s.source.Account()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := s.source.Positions()
+	if err != nil {
+		return nil, err
+	}
+	orders, err := s.source.OpenOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snap := &Snapshot{
+		Timestamp:   now,
+		Equity:      account.Equity,
+		BuyingPower: account.BuyingPower,
+		Cash:        account.Cash,
+		OpenOrders:  len(orders),
+	}
+	for _, p := range positions {
+		if p.MarketValue == nil {
+			continue
+		}
+		value := *p.MarketValue
+		if mark, ok := s.marks.MarkPrice(p.Symbol); ok {
+			value = p.Qty.Mul(mark)
+			snap.Equity = snap.Equity.Add(value.Sub(*p.MarketValue))
+		}
+		if value.IsNegative() {
+			snap.ShortExposure = snap.ShortExposure.Add(value.Abs())
+		} else {
+			snap.LongExposure = snap.LongExposure.Add(value)
+		}
+	}
+	snap.GrossExposure = snap.LongExposure.Add(snap.ShortExposure)
+	snap.NetExposure = snap.LongExposure.Sub(snap.ShortExposure)
+	if snap.Equity.IsPositive() {
+		snap.Leverage = snap.GrossExposure.Div(snap.Equity)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := market.SessionDate(now)
+	if day != s.peakDay || snap.Equity.GreaterThan(s.peakEquity) {
+		s.peakEquity = snap.Equity
+		s.peakDay = day
+	}
+	snap.PeakEquity = s.peakEquity
+	snap.DrawdownLimit = s.drawdownLimit
+	if s.peakEquity.IsPositive() {
+		snap.Drawdown = s.peakEquity.Sub(snap.Equity).Div(s.peakEquity)
+	}
+	snap.DrawdownBreached = s.drawdownLimit.IsPositive() && snap.Drawdown.GreaterThanOrEqual(s.drawdownLimit)
+	snap.LeverageLimit = s.leverageLimit
+	snap.LeverageBreached = s.leverageLimit.IsPositive() &&
+		(snap.Leverage.GreaterThan(s.leverageLimit) || !snap.Equity.IsPositive() && snap.GrossExposure.IsPositive())
+
+	s.latest = snap
+	return snap, nil
+}
@@ -0,0 +1,52 @@
+package risk
+
+import (
+	"fmt"
+	"time"
+)
+
+// PriceAges reports how old the price of a symbol is
+type PriceAges interface {
+	// PriceAge returns how long ago symbol last traded and whether its price
+	// is stale
+	PriceAge(symbol string, now time.Time) (time.Duration, bool, error)
+}
+
+// StalePriceRule flags or blocks orders in symbols whose last trade is stale,
+// e.g. because the symbol is halted or the data feed has a gap, since the
+// order was likely sized off a price the market has moved away from
+type StalePriceRule struct {
+	prices PriceAges
+	action string
+}
+
+func NewStalePriceRule(prices PriceAges, action string) *StalePriceRule {
+	return &StalePriceRule{
+		prices: prices,
+		action: action,
+	}
+}
+
+func (r *StalePriceRule) Name() string {
+	return "stale_price"
+}
+
+func (r *StalePriceRule) Check(o Order) (*Finding, error) {
+	age, stale, err := r.prices.PriceAge(o.Symbol, o.Time)
+	if err != nil {
+		return &Finding{
+			Rule:   r.Name(),
+			Action: r.action,
+			Reason: fmt.Sprintf("no current price for %s: %v", o.Symbol, err),
+		}, nil
+	}
+	if !stale {
+		return nil, nil
+	}
+
+	return &Finding{
+		Rule:   r.Name(),
+		Action: r.action,
+		Reason: fmt.Sprintf("%s last traded %s ago", o.Symbol, age.Round(time.Second)),
+	}, nil
+}
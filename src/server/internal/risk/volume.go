@@ -0,0 +1,89 @@
+package risk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/market"
+)
+
+// BarSource supplies daily bars
+type BarSource interface {
+	DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error)
+}
+
+// AverageVolumes computes symbols' average daily volume over completed
+// sessions. Averages are fetched once per symbol per session day.
+type AverageVolumes struct {
+	bars BarSource
+	days int
+
+	mu    sync.Mutex
+	cache map[string]averageVolume
+}
+
+type averageVolume struct {
+	date    string
+	shares  decimal.Decimal
+	dollars decimal.Decimal
+}
+
+func NewAverageVolumes(bars BarSource, days int) *AverageVolumes {
+	return &AverageVolumes{
+		bars:  bars,
+		days:  days,
+		cache: make(map[string]averageVolume),
+	}
+}
+
+// AverageVolume returns the symbol's average daily volume in shares and in
+// dollars (volume times close) over the last days completed sessions. A
+// symbol with no bars averages zero.
+func (v *AverageVolumes) AverageVolume(symbol string) (decimal.Decimal, decimal.Decimal, error) {
+	now := time.Now()
+	today := market.SessionDate(now)
+
+	v.mu.Lock()
+	cached, ok := v.cache[symbol]
+	v.mu.Unlock()
+	if ok && cached.date == today {
+		return cached.shares, cached.dollars, nil
+	}
+
+	// Enough calendar days to cover the sessions through weekends and holidays
+	since := now.AddDate(0, 0, -(v.days*7/5 + 10))
+	bars, err := v.bars.DailyBars([]string{symbol}, since)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	var completed []marketdata.Bar
+	for _, b := range bars[symbol] {
+		if market.SessionDate(b.Timestamp) != today {
+			completed = append(completed, b)
+		}
+	}
+	if len(completed) > v.days {
+		completed = completed[len(completed)-v.days:]
+	}
+
+	avg := averageVolume{date: today}
+	if len(completed) > 0 {
+		for _, b := range completed {
+			shares := decimal.NewFromInt(int64(b.Volume))
+			avg.shares = avg.shares.Add(shares)
+			avg.dollars = avg.dollars.Add(shares.Mul(decimal.NewFromFloat(b.Close)))
+		}
+		n := decimal.NewFromInt(int64(len(completed)))
+		avg.shares = avg.shares.Div(n)
+		avg.dollars = avg.dollars.Div(n)
+	}
+
+	v.mu.Lock()
+	v.cache[symbol] = avg
+	v.mu.Unlock()
+	return avg.shares, avg.dollars, nil
+}
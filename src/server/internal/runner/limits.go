@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// watchInterval is how often a strategy's resource usage is sampled
+	watchInterval = 2 * time.Second
+
+	// clockTicks is the kernel's USER_HZ, which is 100 on every platform Linux
+	// supports
+	clockTicks = 100
+)
+
+// Limits bound the resources a strategy process may use. Zero disables a
+// limit. Usage is read from /proc, so CPU and memory limits only apply on
+// Linux.
+type Limits struct {
+	// MaxMemoryBytes is the largest resident set size allowed
+	MaxMemoryBytes int64
+	// MaxCPUPercent is the highest CPU use allowed, averaged over CPUWindow;
+	// 100 is one full core
+	MaxCPUPercent float64
+	CPUWindow     time.Duration
+	// MaxRuntime is how long a strategy may run before it is killed
+	MaxRuntime time.Duration
+}
+
+type usageSample struct {
+	at  time.Time
+	cpu time.Duration
+}
+
+// usage reads a process's total CPU time and resident set size from /proc
+func usage(pid int) (time.Duration, int64, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces, so fields are counted from the
+	// closing parenthesis: state is field 3, utime 14 and stime 15
+	i := strings.LastIndexByte(string(stat), ')')
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	statm, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	mem := strings.Fields(string(statm))
+	if len(mem) < 2 {
+		return 0, 0, fmt.Errorf("unexpected /proc/%d/statm format", pid)
+	}
+	pages, err := strconv.ParseInt(mem[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cpu := time.Duration(utime+stime) * time.Second / clockTicks
+	return cpu, pages * int64(os.Getpagesize()), nil
+}
+
+// violation checks the latest usage against the limits and returns why the
+// process must be killed, or "" if it is within them. samples holds recent
+// CPU readings, oldest first.
+func (l Limits) violation(started time.Time, now time.Time, rss int64, samples []usageSample) string {
+	if l.MaxRuntime > 0 && now.Sub(started) > l.MaxRuntime {
+		return fmt.Sprintf("max runtime of %s exceeded", l.MaxRuntime)
+	}
+	if l.MaxMemoryBytes > 0 && rss > l.MaxMemoryBytes {
+		return fmt.Sprintf("memory limit exceeded: %d MB resident > %d MB", rss>>20, l.MaxMemoryBytes>>20)
+	}
+	if l.MaxCPUPercent > 0 && len(samples) > 1 {
+		first, last := samples[0], samples[len(samples)-1]
+		if elapsed := last.at.Sub(first.at); elapsed >= l.CPUWindow {
+			pct := 100 * float64(last.cpu-first.cpu) / float64(elapsed)
+			if pct > l.MaxCPUPercent {
+				return fmt.Sprintf("CPU limit exceeded: %.0f%% over %s > %.0f%%", pct, l.CPUWindow, l.MaxCPUPercent)
+			}
+		}
+	}
+	return ""
+}
+
+// watch samples a process's usage until it exits, killing it on the first
+// limit it breaks
+func (r *Runner) watch(id int64, p *process) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	pid := p.cmd.Process.Pid
+	var samples []usageSample
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			cpu, rss, err := usage(pid)
+			if err != nil {
+				// Without /proc only the runtime limit applies
+				rss = 0
+				samples = nil
+			} else {
+				samples = append(samples, usageSample{at: now, cpu: cpu})
+				// Keep just enough history to span the CPU window
+				for len(samples) > 2 && now.Sub(samples[1].at) >= r.cfg.Limits.CPUWindow {
+					samples = samples[1:]
+				}
+			}
+
+			if reason := r.cfg.Limits.violation(started, now, rss, samples); reason != "" {
+				r.kill(id, p, reason)
+				return
+			}
+		}
+	}
+}
+
+// kill stops a process that broke a resource limit immediately, recording
+// the reason
+func (r *Runner) kill(id int64, p *process, reason string) {
+	r.mu.Lock()
+	p.killReason = reason
+	r.mu.Unlock()
+
+	p.sink.note("killing process: " + reason)
+	if err := p.cmd.Process.Kill(); err != nil {
+		r.mu.Lock()
+		p.killReason = ""
+		r.mu.Unlock()
+	}
+	log.Printf("Killed strategy %d: %s", id, reason)
+}
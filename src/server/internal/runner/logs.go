@@ -0,0 +1,228 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"desk/internal/database"
+	"desk/internal/stream"
+)
+
+const (
+	// maxLineBytes truncates very long output lines
+	maxLineBytes = 8 * 1024
+
+	// flushInterval bounds how long captured lines wait before being stored
+	// and published
+	flushInterval = time.Second
+	flushLines    = 100
+)
+
+// LogEvent is a captured line published to followers
+type LogEvent struct {
+	StrategyID int64
+	database.LogLine
+}
+
+// rotatingFile appends lines to path, rotating it to path.1 ... path.N when it
+// would exceed maxBytes
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	keep     int
+	f        *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxBytes int64, keep int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxBytes: maxBytes, keep: keep, f: f, size: info.Size()}, nil
+}
+
+func (r *rotatingFile) WriteLine(line string) error {
+	if r.size > 0 && r.size+int64(len(line))+1 > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fmt.Fprintln(r.f, line)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	for i := r.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.keep > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
+
+// sink captures a strategy process's stdout and stderr. Every line goes to
+// the strategy's log file immediately, and is stored in the database ring and
+// published to followers in batches.
+type sink struct {
+	strategyID int64
+	db         *database.DB
+	hub        *stream.Hub[LogEvent]
+	ringSize   int
+	file       *rotatingFile
+	redact     []string
+
+	mu      sync.Mutex
+	seq     int64
+	pending []database.LogLine
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSink(strategyID int64, db *database.DB, hub *stream.Hub[LogEvent], cfg Config, redact []string) (*sink, error) {
+	seq, err := db.LastStrategyLogSeq(strategyID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openRotatingFile(
+		filepath.Join(cfg.LogDir, fmt.Sprintf("strategy-%d.log", strategyID)),
+		cfg.LogMaxBytes, cfg.LogFiles,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open strategy log file: %w", err)
+	}
+
+	s := &sink{
+		strategyID: strategyID,
+		db:         db,
+		hub:        hub,
+		ringSize:   cfg.LogLines,
+		file:       file,
+		redact:     redact,
+		seq:        seq,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go s.flushLoop()
+	return s, nil
+}
+
+// capture reads lines from r until EOF
+func (s *sink) capture(r io.Reader, streamName string) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			s.add(streamName, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// note records a line written by the runner itself, such as why a process
+// exited
+func (s *sink) note(line string) {
+	s.add("stderr", "[runner] "+line)
+}
+
+func (s *sink) add(streamName, line string) {
+	// Never let a strategy's secrets reach its logs
+	for _, v := range s.redact {
+		line = strings.ReplaceAll(line, v, "[redacted]")
+	}
+	if len(line) > maxLineBytes {
+		line = line[:maxLineBytes] + "...(truncated)"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	l := database.LogLine{Seq: s.seq, Stream: streamName, Line: line, LoggedAt: time.Now()}
+	if err := s.file.WriteLine(fmt.Sprintf("%s %s %s", l.LoggedAt.UTC().Format(time.RFC3339Nano), streamName, line)); err != nil {
+		log.Printf("Failed to write strategy %d log file: %v", s.strategyID, err)
+	}
+	s.pending = append(s.pending, l)
+	if len(s.pending) >= flushLines {
+		s.flushLocked()
+	}
+}
+
+func (s *sink) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			s.mu.Lock()
+			s.flushLocked()
+			s.file.Close()
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flushLocked()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked stores pending lines, then publishes them, so a follower that
+// reads the stored tail and then the stream sees every line
+func (s *sink) flushLocked() {
+	if len(s.pending) == 0 {
+		return
+	}
+	if err := s.db.AppendStrategyLogs(s.strategyID, s.pending, s.ringSize); err != nil {
+		log.Printf("Failed to store strategy %d logs: %v", s.strategyID, err)
+	}
+	for _, l := range s.pending {
+		s.hub.Publish(LogEvent{StrategyID: s.strategyID, LogLine: l})
+	}
+	s.pending = nil
+}
+
+// Close flushes remaining lines and closes the log file
+func (s *sink) Close() {
+	close(s.stop)
+	<-s.done
+}
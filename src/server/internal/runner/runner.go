@@ -0,0 +1,372 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"desk/internal/artifacts"
+	"desk/internal/database"
+	"desk/internal/secrets"
+	"desk/internal/stream"
+)
+
+// stopGrace is how long a strategy has to exit after SIGTERM before it is
+// killed
+const stopGrace = 10 * time.Second
+
+var (
+	ErrRunning    = errors.New("strategy is already running")
+	ErrNotRunning = errors.New("strategy is not running")
+	ErrKilled     = errors.New("strategy has been killed; an admin must clear it before it can start")
+)
+
+// Config controls how strategies are launched and how their output is kept
+type Config struct {
+	// Python is the interpreter strategies run under
+	Python string
+	// ServerURL is the desk URL strategies are given as DESK_SERVER_URL
+	ServerURL string
+	// EventsAddr, if set, is the strategy event service strategies are given
+	// as DESK_EVENTS_ADDR
+	EventsAddr string
+	// Token, if set, returns the token a strategy's owner authenticates to
+	// the desk with, given as DESK_TOKEN
+	Token func(userID string) string
+	// Sandbox is the user strategies run as; without one they aren't
+	// started
+	Sandbox *Sandbox
+
+	LogDir      string
+	LogMaxBytes int64
+	LogFiles    int
+	LogLines    int
+
+	Limits Limits
+}
+
+type process struct {
+	cmd        *exec.Cmd
+	sink       *sink
+	stopping   bool
+	killReason string
+	version    *int64
+	done       chan struct{}
+}
+
+// Runner starts registered strategies as child processes of the desk,
+// running as the sandbox user, captures their output and records when and
+// why they exit
+type Runner struct {
+	db        *database.DB
+	cfg       Config
+	artifacts *artifacts.Manager
+	secrets   *secrets.Box
+	hub       *stream.Hub[LogEvent]
+
+	mu    sync.Mutex
+	procs map[int64]*process
+}
+
+func NewRunner(db *database.DB, cfg Config, artifacts *artifacts.Manager, secrets *secrets.Box) *Runner {
+	return &Runner{
+		db:        db,
+		cfg:       cfg,
+		artifacts: artifacts,
+		secrets:   secrets,
+		hub:       stream.NewHub[LogEvent](256),
+		procs:     make(map[int64]*process),
+	}
+}
+
+// Run stops every running strategy once ctx is cancelled. Strategies left
+// running by a previous server process are marked stopped first.
+func (r *Runner) Run(ctx context.Context) {
+	if err := r.db.ResetRunningStrategies("desk restarted", time.Now()); err != nil {
+		log.Printf("Failed to reset strategy run states: %v", err)
+	}
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	ids := make([]int64, 0, len(r.procs))
+	for id := range r.procs {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	for _, id := range ids {
+		if err := r.Stop(id); err != nil && !errors.Is(err, ErrNotRunning) {
+			log.Printf("Failed to stop strategy %d: %v", id, err)
+		}
+	}
+}
+
+// Subscribe registers for captured output lines of every strategy. The
+// returned function must be called to unsubscribe.
+func (r *Runner) Subscribe() (<-chan LogEvent, func()) {
+	return r.hub.Subscribe()
+}
+
+// StreamStats describes the log stream's subscribers
+func (r *Runner) StreamStats() stream.Stats {
+	return r.hub.Stats()
+}
+
+// Processes returns the number of live strategy processes and the captured
+// log lines waiting to be stored
+func (r *Runner) Processes() (running, pendingLines int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.procs {
+		p.sink.mu.Lock()
+		pendingLines += len(p.sink.pending)
+		p.sink.mu.Unlock()
+	}
+	return len(r.procs), pendingLines
+}
+
+// Running reports whether the strategy has a live process
+func (r *Runner) Running(id int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.procs[id]
+	return ok
+}
+
+// RunningVersion returns the artifact version of a strategy's live process,
+// or nil when it is not running or runs from its registered file path
+func (r *Runner) RunningVersion(id int64) *int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.procs[id]; ok {
+		return p.version
+	}
+	return nil
+}
+
+// Exited returns a channel closed once the strategy's current process has
+// exited, or nil when it is not running
+func (r *Runner) Exited(id int64) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.procs[id]; ok {
+		return p.done
+	}
+	return nil
+}
+
+// Start launches a strategy's active version, or its registered script when
+// no version has been uploaded. A killed strategy isn't started; the check
+// is made under the same lock Stop takes, so a strategy killed while it is
+// starting is either refused or stopped by the kill.
+func (r *Runner) Start(s *database.Strategy) error {
+	if r.Running(s.ID) {
+		return ErrRunning
+	}
+	if r.cfg.Sandbox == nil {
+		return ErrNoSandbox
+	}
+
+	script := s.FilePath
+	if s.ActiveVersion != nil {
+		v, err := r.db.GetStrategyVersion(s.ID, *s.ActiveVersion)
+		if err != nil {
+			return err
+		}
+		if script, err = r.artifacts.Checkout(context.Background(), v); err != nil {
+			return fmt.Errorf("failed to check out version %d: %w", v.Version, err)
+		}
+	}
+
+	env, redact, err := r.env(s)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.procs[s.ID]; ok {
+		return ErrRunning
+	}
+	if killed, err := r.db.IsStrategyKilled(s.ID); err != nil {
+		return err
+	} else if killed {
+		return ErrKilled
+	}
+
+	cmd := exec.Command(r.cfg.Python, "-u", script)
+	cmd.Dir = filepath.Dir(script)
+	cmd.Env = env
+	cmd.SysProcAttr = r.cfg.Sandbox.attr()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	sink, err := newSink(s.ID, r.db, r.hub, r.cfg, redact)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		sink.note(fmt.Sprintf("failed to start: %v", err))
+		sink.Close()
+		return fmt.Errorf("failed to start strategy: %w", err)
+	}
+
+	if err := r.db.SetStrategyRunState(s.ID, database.RunRunning, nil, time.Now()); err != nil {
+		log.Printf("Failed to record strategy %d start: %v", s.ID, err)
+	}
+	if err := r.db.SetStrategyRunningVersion(s.ID, s.ActiveVersion); err != nil {
+		log.Printf("Failed to record strategy %d running version: %v", s.ID, err)
+	}
+	if s.ActiveVersion != nil {
+		sink.note(fmt.Sprintf("started version %d (pid %d)", *s.ActiveVersion, cmd.Process.Pid))
+	} else {
+		sink.note(fmt.Sprintf("started %s (pid %d)", script, cmd.Process.Pid))
+	}
+
+	p := &process{cmd: cmd, sink: sink, version: s.ActiveVersion, done: make(chan struct{})}
+	r.procs[s.ID] = p
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); sink.capture(stdout, "stdout") }()
+	go func() { defer wg.Done(); sink.capture(stderr, "stderr") }()
+	go r.wait(s.ID, p, &wg)
+	go r.watch(s.ID, p)
+
+	return nil
+}
+
+// wait records how a strategy's process exited once its output is drained
+func (r *Runner) wait(id int64, p *process, wg *sync.WaitGroup) {
+	wg.Wait()
+	err := p.cmd.Wait()
+
+	r.mu.Lock()
+	stopping, killReason := p.stopping, p.killReason
+	delete(r.procs, id)
+	r.mu.Unlock()
+
+	state := database.RunExited
+	var message *string
+	switch {
+	case killReason != "":
+		state = database.RunKilled
+		message = &killReason
+	case stopping:
+		state = database.RunStopped
+	case err != nil:
+		state = database.RunFailed
+		msg := err.Error()
+		message = &msg
+	}
+
+	p.sink.note("process " + state + exitDetail(err))
+	p.sink.Close()
+	if err := r.db.SetStrategyRunState(id, state, message, time.Now()); err != nil {
+		log.Printf("Failed to record strategy %d exit: %v", id, err)
+	}
+	if err := r.db.SetStrategyRunningVersion(id, nil); err != nil {
+		log.Printf("Failed to clear strategy %d running version: %v", id, err)
+	}
+	close(p.done)
+}
+
+// Stop terminates a running strategy, killing it if it has not exited
+// within the grace period
+func (r *Runner) Stop(id int64) error {
+	r.mu.Lock()
+	p, ok := r.procs[id]
+	if ok {
+		p.stopping = true
+	}
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotRunning
+	}
+
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to signal strategy: %w", err)
+	}
+
+	select {
+	case <-p.done:
+	case <-time.After(stopGrace):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	return nil
+}
+
+// env is the environment a strategy runs with, followed by the strategy's
+// decrypted secrets. The desk's own environment holds broker credentials, so
+// it is not inherited. The secret values are also returned so they can be
+// redacted from captured output.
+func (r *Runner) env(s *database.Strategy) ([]string, []string, error) {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"PYTHONUNBUFFERED=1",
+		"DESK_SERVER_URL=" + r.cfg.ServerURL,
+		"USER_ID=" + s.UserID,
+		"STRATEGY_ID=" + strconv.FormatInt(s.ID, 10),
+	}
+	if r.cfg.EventsAddr != "" {
+		env = append(env, "DESK_EVENTS_ADDR="+r.cfg.EventsAddr)
+	}
+
+	stored, err := r.db.GetStrategySecrets(s.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(stored) > 0 && r.secrets == nil {
+		return nil, nil, errors.New("strategy has secrets but no secrets key is configured")
+	}
+
+	var values []string
+	if r.cfg.Token != nil {
+		if token := r.cfg.Token(s.UserID); token != "" {
+			env = append(env, "DESK_TOKEN="+token)
+			values = append(values, token)
+		}
+	}
+	for _, secret := range stored {
+		// A secret stored before its name was reserved can't override the
+		// runner's own variables
+		if !secrets.ValidName(secret.Name) {
+			continue
+		}
+		value, err := r.secrets.Open(secret.Value, secrets.StrategyAAD(s.ID, secret.Name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("secret %s: %w", secret.Name, err)
+		}
+		env = append(env, secret.Name+"="+string(value))
+		if len(value) > 0 {
+			values = append(values, string(value))
+		}
+	}
+	return env, values, nil
+}
+
+func exitDetail(err error) string {
+	if err == nil {
+		return ""
+	}
+	return ": " + err.Error()
+}
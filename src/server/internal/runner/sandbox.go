@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// ErrNoSandbox is returned by Start when no sandbox user is configured
+var ErrNoSandbox = errors.New("no sandbox user is configured for strategies")
+
+// Sandbox is the unprivileged user and group strategies run as. The desk's
+// database and the strategies' captured logs are readable only by the
+// desk's own user, so a strategy reaches the desk only through its API.
+type Sandbox struct {
+	UID uint32
+	GID uint32
+}
+
+// LookupSandbox resolves a user name, or numeric user ID, to a sandbox
+// running as that user and its primary group. Neither root nor the desk's
+// own user can be the sandbox.
+func LookupSandbox(name string) (*Sandbox, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("unknown user %q", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric ID", name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric group ID", name)
+	}
+	switch {
+	case uid == 0:
+		return nil, fmt.Errorf("user %q is root", name)
+	case int(uid) == os.Getuid():
+		return nil, fmt.Errorf("user %q is the desk's own user", name)
+	}
+	return &Sandbox{UID: uint32(uid), GID: uint32(gid)}, nil
+}
+
+// attr starts a process as the sandbox user
+func (s *Sandbox) attr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: s.UID, Gid: s.GID}}
+}
+
+// Restrict makes a SQLite database, and the journal files beside it,
+// readable and writable only by the desk's own user
+func Restrict(dbPath string) error {
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm", dbPath + "-journal"} {
+		if err := os.Chmod(path, 0o600); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"desk/internal/clock"
+	"desk/internal/market"
+)
+
+// SessionJob runs once for a session date
+type SessionJob func(ctx context.Context, sessionDate string)
+
+// EverySession runs job once per weekday session at the time at returns for
+// that session's date on clk, until ctx is cancelled. Exchange holidays are
+// not modelled; jobs must tolerate running on a day the market was closed.
+func EverySession(ctx context.Context, clk clock.Clock, name string, at func(date string) (time.Time, error), job SessionJob) {
+	for {
+		now := clk.Now()
+		date, runAt, err := nextRun(now, at)
+		if err != nil {
+			log.Printf("Failed to schedule %s: %v", name, err)
+			return
+		}
+
+		log.Printf("Scheduled %s for session %s at %s", name, date, runAt.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(runAt.Sub(now)):
+		}
+
+		job(ctx, date)
+	}
+}
+
+// nextRun finds the first weekday session whose run time is after now
+func nextRun(now time.Time, at func(date string) (time.Time, error)) (string, time.Time, error) {
+	day := market.ExchangeTime(now)
+	for {
+		if wd := day.Weekday(); wd != time.Saturday && wd != time.Sunday {
+			date := day.Format("2006-01-02")
+			runAt, err := at(date)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			if runAt.After(now) {
+				return date, runAt, nil
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Timers runs one-off callbacks at specific times. Each callback is keyed so
+// it can be replaced or cancelled before it fires. Callbacks run on their own
+// goroutine.
+type Timers[K comparable] struct {
+	mu     sync.Mutex
+	timers map[K]*time.Timer
+}
+
+func NewTimers[K comparable]() *Timers[K] {
+	return &Timers[K]{
+		timers: make(map[K]*time.Timer),
+	}
+}
+
+// At schedules fn to run at the given time, replacing anything already
+// scheduled under key. A time in the past runs fn immediately.
+func (t *Timers[K]) At(key K, at time.Time, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if existing, ok := t.timers[key]; ok {
+		existing.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		t.mu.Lock()
+		// Only forget the key if it has not been rescheduled meanwhile
+		if t.timers[key] == timer {
+			delete(t.timers, key)
+		}
+		t.mu.Unlock()
+
+		fn()
+	})
+	t.timers[key] = timer
+}
+
+// Cancel stops the callback scheduled under key, reporting whether one was
+// pending
+func (t *Timers[K]) Cancel(key K) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+	delete(t.timers, key)
+	return timer.Stop()
+}
+
+// Len returns the number of pending callbacks
+func (t *Timers[K]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.timers)
+}
+
+// Stop cancels every pending callback
+func (t *Timers[K]) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+}
@@ -0,0 +1,252 @@
+package screener
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/indicators"
+)
+
+// Fields a filter can test
+const (
+	FieldPrice     = "price"
+	FieldAvgVolume = "avg_volume"
+	FieldChangePct = "change_pct"
+	FieldRSI       = "rsi"
+)
+
+const (
+	rsiPeriod    = 14
+	volumeWindow = 20
+
+	// HistoryBars is how many daily bars are kept per symbol, enough for
+	// RSI's Wilder smoothing to settle
+	HistoryBars = 120
+
+	// historySpan is how far back bars are requested to cover HistoryBars
+	// sessions
+	historySpan = 190 * 24 * time.Hour
+)
+
+// operators are checked longest first so ">=" isn't read as ">"
+var operators = []string{">=", "<=", ">", "<"}
+
+// Filter is a single comparison such as rsi<30 or price>=10
+type Filter struct {
+	Field string
+	Op    string
+	Value decimal.Decimal
+}
+
+// ParseFilter parses a filter expression of the form <field><op><value>
+func ParseFilter(expr string) (Filter, error) {
+	expr = strings.ReplaceAll(expr, " ", "")
+	for _, op := range operators {
+		field, value, ok := strings.Cut(expr, op)
+		if !ok {
+			continue
+		}
+		switch field {
+		case FieldPrice, FieldAvgVolume, FieldChangePct, FieldRSI:
+		default:
+			return Filter{}, fmt.Errorf("unknown filter field %q (want price, avg_volume, change_pct or rsi)", field)
+		}
+		v, err := decimal.NewFromString(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid value in filter %q", expr)
+		}
+		return Filter{Field: field, Op: op, Value: v}, nil
+	}
+	return Filter{}, fmt.Errorf("filter %q needs one of >, >=, < or <=", expr)
+}
+
+// Match reports whether m passes the filter. A symbol without enough history
+// for RSI never passes an RSI filter.
+func (f Filter) Match(m Metrics) bool {
+	var v decimal.Decimal
+	switch f.Field {
+	case FieldPrice:
+		v = m.Price
+	case FieldAvgVolume:
+		v = m.AvgVolume
+	case FieldChangePct:
+		v = m.ChangePct
+	case FieldRSI:
+		if m.RSI == nil {
+			return false
+		}
+		v = *m.RSI
+	}
+
+	switch f.Op {
+	case ">":
+		return v.GreaterThan(f.Value)
+	case ">=":
+		return v.GreaterThanOrEqual(f.Value)
+	case "<":
+		return v.LessThan(f.Value)
+	case "<=":
+		return v.LessThanOrEqual(f.Value)
+	}
+	return false
+}
+
+// Metrics are the values a symbol is screened on, from its daily bars:
+// the last close, average volume over the last 20 sessions, the last
+// session's percent change and 14-period RSI
+type Metrics struct {
+	Symbol    string           `json:"symbol"`
+	Price     decimal.Decimal  `json:"price"`
+	AvgVolume decimal.Decimal  `json:"avg_volume"`
+	ChangePct decimal.Decimal  `json:"change_pct"`
+	RSI       *decimal.Decimal `json:"rsi,omitempty"`
+	AsOf      time.Time        `json:"as_of"`
+}
+
+// Compute derives screening metrics from daily bars, oldest first. It needs
+// at least two bars.
+func Compute(symbol string, bars []marketdata.Bar) (Metrics, error) {
+	if len(bars) < 2 {
+		return Metrics{}, fmt.Errorf("%s has %d daily bars, need at least 2", symbol, len(bars))
+	}
+
+	last := bars[len(bars)-1]
+	prev := decimal.NewFromFloat(bars[len(bars)-2].Close)
+	m := Metrics{
+		Symbol: symbol,
+		Price:  decimal.NewFromFloat(last.Close),
+		AsOf:   last.Timestamp,
+	}
+	if !prev.IsZero() {
+		m.ChangePct = m.Price.Sub(prev).Div(prev).Mul(decimal.NewFromInt(100)).Round(2)
+	}
+
+	window := bars[max(0, len(bars)-volumeWindow):]
+	var volume decimal.Decimal
+	for _, b := range window {
+		volume = volume.Add(decimal.NewFromUint64(b.Volume))
+	}
+	m.AvgVolume = volume.Div(decimal.NewFromInt(int64(len(window)))).Round(0)
+
+	closes := make([]decimal.Decimal, len(bars))
+	for i, b := range bars {
+		closes[i] = decimal.NewFromFloat(b.Close)
+	}
+	if rsi, err := indicators.RSI(closes, rsiPeriod); err == nil {
+		rsi = rsi.Round(2)
+		m.RSI = &rsi
+	}
+
+	return m, nil
+}
+
+// BarSource fetches daily bars for many symbols at once
+type BarSource interface {
+	DailyBars(symbols []string, since time.Time) (map[string][]marketdata.Bar, error)
+}
+
+type cachedBars struct {
+	bars    []marketdata.Bar
+	fetched time.Time
+}
+
+// Screener evaluates filters over cached daily bars. Bars are refetched once
+// they are older than the cache TTL, so repeated screens over the same
+// universe cost one market data request per TTL.
+type Screener struct {
+	source BarSource
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedBars
+}
+
+func NewScreener(source BarSource, ttl time.Duration) *Screener {
+	return &Screener{
+		source: source,
+		ttl:    ttl,
+		cache:  make(map[string]cachedBars),
+	}
+}
+
+// Result lists the symbols that passed every filter and those that could not
+// be evaluated for lack of data
+type Result struct {
+	Matches []Metrics `json:"matches"`
+	Skipped []string  `json:"skipped"`
+}
+
+// Screen returns the symbols passing every filter, in universe order
+func (s *Screener) Screen(symbols []string, filters []Filter) (*Result, error) {
+	bars, err := s.bars(symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Matches: []Metrics{}, Skipped: []string{}}
+	for _, symbol := range symbols {
+		m, err := Compute(symbol, bars[symbol])
+		if err != nil {
+			result.Skipped = append(result.Skipped, symbol)
+			continue
+		}
+
+		matched := true
+		for _, f := range filters {
+			if !f.Match(m) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result.Matches = append(result.Matches, m)
+		}
+	}
+	return result, nil
+}
+
+// Bars returns the cached daily bars of symbols, up to HistoryBars of each,
+// so other analytics share the screener's cache
+func (s *Screener) Bars(symbols []string) (map[string][]marketdata.Bar, error) {
+	return s.bars(symbols)
+}
+
+// bars returns cached bars for symbols, fetching any that are missing or
+// stale in a single request
+func (s *Screener) bars(symbols []string) (map[string][]marketdata.Bar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var stale []string
+	for _, symbol := range symbols {
+		if c, ok := s.cache[symbol]; !ok || now.Sub(c.fetched) > s.ttl {
+			stale = append(stale, symbol)
+		}
+	}
+
+	if len(stale) > 0 {
+		fetched, err := s.source.DailyBars(stale, now.Add(-historySpan))
+		if err != nil {
+			return nil, err
+		}
+		for _, symbol := range stale {
+			b := fetched[symbol]
+			s.cache[symbol] = cachedBars{
+				bars:    b[max(0, len(b)-HistoryBars):],
+				fetched: now,
+			}
+		}
+	}
+
+	out := make(map[string][]marketdata.Bar, len(symbols))
+	for _, symbol := range symbols {
+		out[symbol] = s.cache[symbol].bars
+	}
+	return out, nil
+}
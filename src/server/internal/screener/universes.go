@@ -0,0 +1,40 @@
+package screener
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// builtinUniverses are index constituent lists shipped with the desk. They
+// are snapshots and should be refreshed when an index changes.
+//
+//go:embed universes.json
+var builtinUniverses []byte
+
+// LoadUniverses returns the built-in index universes, plus any named symbol
+// lists in the JSON file at path (an object of name to symbols), which take
+// precedence. path may be empty.
+func LoadUniverses(path string) (map[string][]string, error) {
+	universes := make(map[string][]string)
+	if err := json.Unmarshal(builtinUniverses, &universes); err != nil {
+		return nil, fmt.Errorf("failed to parse built-in universes: %w", err)
+	}
+	if path == "" {
+		return universes, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read universes file: %w", err)
+	}
+	var extra map[string][]string
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return nil, fmt.Errorf("failed to parse universes file: %w", err)
+	}
+	for name, symbols := range extra {
+		universes[name] = symbols
+	}
+	return universes, nil
+}
@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// KeySize is the length of the master key (AES-256)
+const KeySize = 32
+
+var ErrDecrypt = errors.New("failed to decrypt secret")
+
+// namePattern matches names usable as environment variables
+var namePattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// reserved names are set by the runner itself and can't be overridden
+var reserved = map[string]bool{
+	"PATH":             true,
+	"PYTHONUNBUFFERED": true,
+	"DESK_SERVER_URL":  true,
+	"USER_ID":          true,
+	"STRATEGY_ID":      true,
+	"DESK_EVENTS_ADDR": true,
+	"DESK_TOKEN":       true,
+}
+
+// ValidName reports whether name can be used for a secret
+func ValidName(name string) bool {
+	return len(name) <= 128 && namePattern.MatchString(name) && !reserved[name]
+}
+
+// ParseKey decodes a master key given as base64 or hex
+func ParseKey(s string) ([]byte, error) {
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key must be %d bytes, base64 or hex encoded", KeySize)
+}
+
+// Box encrypts secret values with AES-GCM under a master key. Each value is
+// bound to additional data (its owner and name) so a stored ciphertext can't
+// be moved to another secret.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext, returning the nonce followed by the ciphertext
+func (b *Box) Seal(plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Open decrypts a value produced by Seal with the same additional data
+func (b *Box) Open(sealed, aad []byte) ([]byte, error) {
+	n := b.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := b.aead.Open(nil, sealed[:n], sealed[n:], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// StrategyAAD is the additional data a strategy's secret is sealed with
+func StrategyAAD(strategyID int64, name string) []byte {
+	return []byte(fmt.Sprintf("strategy/%d/%s", strategyID, name))
+}
@@ -0,0 +1,33 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"POLYGON_API_KEY", true},
+		{"_PRIVATE", true},
+		{"lower_case", false},
+		{"1ST_KEY", false},
+		{"HAS-DASH", false},
+		{"", false},
+		{strings.Repeat("A", 129), false},
+		{"PATH", false},
+		{"PYTHONUNBUFFERED", false},
+		{"DESK_SERVER_URL", false},
+		{"USER_ID", false},
+		{"STRATEGY_ID", false},
+		{"DESK_EVENTS_ADDR", false},
+		{"DESK_TOKEN", false},
+	}
+	for _, tt := range tests {
+		if got := ValidName(tt.name); got != tt.valid {
+			t.Errorf("ValidName(%q) = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/orders"
+)
+
+// PriceSource provides the reference price used to fill simulated orders
+type PriceSource interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// Simulator is a paper broker that fills orders against live market prices
+// without ever sending them to Alpaca. Orders that are not immediately
+// marketable are acknowledged as "new" and never fill.
+type Simulator struct {
+	prices PriceSource
+	clock  clock.Clock
+}
+
+// New creates a simulator whose orders are timestamped by clk
+func New(prices PriceSource, clk clock.Clock) *Simulator {
+	return &Simulator{
+		prices: prices,
+		clock:  clk,
+	}
+}
+
+// PlaceOrder simulates an order and returns it in Alpaca's order shape so
+// callers can treat both venues the same way
+func (s *Simulator) PlaceOrder(order *orders.Order) (*alpaca.Order, error) {
+	price, err := s.prices.LatestPrice(order.Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price for %s: %w", order.Symbol, err)
+	}
+
+	now := s.clock.Now()
+	qty := order.Qty
+	placed := &alpaca.Order{
+		ID:            newOrderID(),
+		ClientOrderID: order.ClientOrderID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		SubmittedAt:   now,
+		Symbol:        order.Symbol,
+		Type:          alpaca.OrderType(order.Type),
+		Side:          alpaca.Side(order.Side),
+		TimeInForce:   alpaca.TimeInForce(order.TimeInForce),
+		Status:        "new",
+		Qty:           &qty,
+		FilledQty:     decimal.Zero,
+		LimitPrice:    order.LimitPrice,
+		StopPrice:     order.StopPrice,
+	}
+
+	if fillPrice, ok := marketable(placed.Type, placed.Side, price, order.LimitPrice, order.StopPrice); ok {
+		placed.Status = "filled"
+		placed.FilledQty = qty
+		placed.FilledAvgPrice = &fillPrice
+		placed.FilledAt = &now
+	}
+
+	return placed, nil
+}
+
+// marketable decides whether an order fills immediately at price and at what
+// fill price
+func marketable(orderType alpaca.OrderType, side alpaca.Side, price decimal.Decimal, limitPrice, stopPrice *decimal.Decimal) (decimal.Decimal, bool) {
+	crosses := func(level decimal.Decimal, buyAbove bool) bool {
+		if side == alpaca.Buy {
+			if buyAbove {
+				return price.GreaterThanOrEqual(level)
+			}
+			return price.LessThanOrEqual(level)
+		}
+		if buyAbove {
+			return price.LessThanOrEqual(level)
+		}
+		return price.GreaterThanOrEqual(level)
+	}
+
+	switch orderType {
+	case alpaca.Market:
+		return price, true
+	case alpaca.Limit:
+		if limitPrice != nil && crosses(*limitPrice, false) {
+			return price, true
+		}
+	case alpaca.Stop:
+		if stopPrice != nil && crosses(*stopPrice, true) {
+			return price, true
+		}
+	case alpaca.StopLimit:
+		if stopPrice != nil && limitPrice != nil && crosses(*stopPrice, true) && crosses(*limitPrice, false) {
+			return price, true
+		}
+	}
+
+	return decimal.Zero, false
+}
+
+func newOrderID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "sim-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that isn't stored
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps blobs by slash-separated key, on local disk or in an
+// S3-compatible bucket. Strategy artifacts, database backups, exports and
+// archived data all go through one, so the desk can run on a machine whose
+// disk is disposable.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys that start with prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// prefixed stores keys under a fixed prefix of another store
+type prefixed struct {
+	store  Store
+	prefix string
+}
+
+// WithPrefix returns a view of store whose keys are stored under prefix, so
+// users of a shared store can't see or overwrite each other's keys
+func WithPrefix(store Store, prefix string) Store {
+	return &prefixed{store: store, prefix: strings.TrimRight(prefix, "/") + "/"}
+}
+
+func (p *prefixed) Put(ctx context.Context, key string, data []byte) error {
+	return p.store.Put(ctx, p.prefix+key, data)
+}
+
+func (p *prefixed) Get(ctx context.Context, key string) ([]byte, error) {
+	return p.store.Get(ctx, p.prefix+key)
+}
+
+func (p *prefixed) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := p.store.List(ctx, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, p.prefix)
+	}
+	return keys, nil
+}
+
+func (p *prefixed) Delete(ctx context.Context, key string) error {
+	return p.store.Delete(ctx, p.prefix+key)
+}
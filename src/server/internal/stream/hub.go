@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"sync"
+)
+
+// Hub fans published messages out to any number of subscribers. Subscribers
+// that fall behind have messages dropped rather than blocking publishers.
+type Hub[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+	buffer      int
+
+	published uint64
+	dropped   uint64
+}
+
+// Stats describes a hub's subscribers and how far behind they are
+type Stats struct {
+	Subscribers int `json:"subscribers"`
+	Buffer      int `json:"buffer"`
+	// MaxLag is the most messages any subscriber has yet to read
+	MaxLag int `json:"max_lag"`
+	// Published counts messages published; Dropped counts deliveries
+	// skipped because a subscriber's buffer was full
+	Published uint64 `json:"published"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+func NewHub[T any](buffer int) *Hub[T] {
+	return &Hub[T]{
+		subscribers: make(map[chan T]struct{}),
+		buffer:      buffer,
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function must be called
+// to unsubscribe once the caller stops reading.
+func (h *Hub[T]) Subscribe() (<-chan T, func()) {
+	ch := make(chan T, h.buffer)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Publish delivers msg to every subscriber with room in its buffer
+func (h *Hub[T]) Publish(msg T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.published++
+	for ch := range h.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			h.dropped++
+		}
+	}
+}
+
+// Len returns the number of active subscribers
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Stats returns the hub's current subscriber count, lag and counters
+func (h *Hub[T]) Stats() Stats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := Stats{
+		Subscribers: len(h.subscribers),
+		Buffer:      h.buffer,
+		Published:   h.published,
+		Dropped:     h.dropped,
+	}
+	for ch := range h.subscribers {
+		stats.MaxLag = max(stats.MaxLag, len(ch))
+	}
+	return stats
+}
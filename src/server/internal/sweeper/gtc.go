@@ -0,0 +1,391 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/clock"
+	"desk/internal/database"
+	"desk/internal/instruments"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/pnl"
+	"desk/internal/scheduler"
+)
+
+// Actions a GTC policy can take on a stale order
+const (
+	ActionNone    = "none"
+	ActionCancel  = "cancel"
+	ActionReprice = "reprice"
+)
+
+// GTCPolicy decides when a resting GTC limit order is stale and what to do
+// about it. An order is stale once its limit has been more than MaxDrift (a
+// fraction, e.g. 0.05) away from the market for StaleDays days. A repriced
+// order's limit is set RepriceOffset (a fraction) behind the market, below it
+// for a buy and above it for a sell, so it rests rather than trading at once.
+type GTCPolicy struct {
+	Action        string
+	MaxDrift      decimal.Decimal
+	StaleDays     int
+	RepriceOffset decimal.Decimal
+}
+
+// PriceSource provides the market price resting orders are compared against
+type PriceSource interface {
+	LatestPrice(symbol string) (decimal.Decimal, error)
+}
+
+// GTCBroker manages resting orders at the broker
+type GTCBroker interface {
+	Broker
+	CancelOrder(orderID string) error
+	ReplaceOrder(orderID string, req alpaca.ReplaceOrderRequest) (*alpaca.Order, error)
+}
+
+// GTCOrder is an open GTC order with its age and distance from the market.
+// MarketPrice and Drift are nil when no price is available.
+type GTCOrder struct {
+	TradeID     int64            `json:"trade_id"`
+	OrderID     string           `json:"order_id"`
+	StrategyID  *int64           `json:"strategy_id,omitempty"`
+	Symbol      string           `json:"symbol"`
+	Side        string           `json:"side"`
+	OrderType   string           `json:"order_type"`
+	Qty         decimal.Decimal  `json:"qty"`
+	FilledQty   decimal.Decimal  `json:"filled_qty"`
+	LimitPrice  *decimal.Decimal `json:"limit_price,omitempty"`
+	StopPrice   *decimal.Decimal `json:"stop_price,omitempty"`
+	Status      string           `json:"status"`
+	Venue       string           `json:"venue"`
+	SubmittedAt time.Time        `json:"submitted_at"`
+	AgeDays     int              `json:"age_days"`
+	MarketPrice *decimal.Decimal `json:"market_price,omitempty"`
+	Drift       *decimal.Decimal `json:"drift,omitempty"`
+	// DriftSince is when a check first found the drift beyond the policy's
+	// threshold, for as long as it stays there
+	DriftSince *time.Time `json:"drift_since,omitempty"`
+	Stale      bool       `json:"stale"`
+}
+
+// GTCResult summarizes one enforcement run
+type GTCResult struct {
+	Checked  int `json:"checked"`
+	Settled  int `json:"settled"`
+	Stale    int `json:"stale"`
+	Canceled int `json:"canceled"`
+	Repriced int `json:"repriced"`
+	Failed   int `json:"failed"`
+}
+
+// GTCManager tracks resting GTC orders and applies the stale-order policy
+type GTCManager struct {
+	broker   GTCBroker
+	prices   PriceSource
+	db       *database.DB
+	fills    *pnl.DailyRecorder
+	notifier notify.Notifier
+	// instruments rounds repriced limits to each symbol's tick
+	instruments *instruments.Registry
+
+	mu     sync.Mutex
+	policy GTCPolicy
+}
+
+func NewGTCManager(broker GTCBroker, prices PriceSource, db *database.DB, fills *pnl.DailyRecorder, notifier notify.Notifier, reg *instruments.Registry, policy GTCPolicy) *GTCManager {
+	return &GTCManager{
+		broker:      broker,
+		prices:      prices,
+		db:          db,
+		fills:       fills,
+		notifier:    notifier,
+		instruments: reg,
+		policy:      policy,
+	}
+}
+
+// Policy returns the current stale-order policy
+func (m *GTCManager) Policy() GTCPolicy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.policy
+}
+
+// SetPolicy changes the stale-order policy for subsequent checks
+func (m *GTCManager) SetPolicy(policy GTCPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+}
+
+// Orders returns the user's open GTC orders, oldest first
+func (m *GTCManager) Orders(userID string) ([]GTCOrder, error) {
+	trades, err := m.db.GetOpenTrades("gtc", time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	drifts, err := m.db.GetGTCDrifts()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	views := []GTCOrder{}
+	for _, t := range trades {
+		if t.UserID == userID {
+			v := m.view(t)
+			if since, ok := drifts[t.ID]; ok && m.drifting(v) {
+				v.DriftSince = &since
+			}
+			v.Stale = m.stale(v, now)
+			views = append(views, v)
+		}
+	}
+	return views, nil
+}
+
+// view is an order with its age and drift as of now
+func (m *GTCManager) view(t database.Trade) GTCOrder {
+	now := time.Now()
+	v := GTCOrder{
+		TradeID:     t.ID,
+		OrderID:     t.OrderID,
+		StrategyID:  t.StrategyID,
+		Symbol:      t.Symbol,
+		Side:        t.Side,
+		OrderType:   t.OrderType,
+		Qty:         t.Qty,
+		FilledQty:   t.FilledQty,
+		LimitPrice:  t.LimitPrice,
+		StopPrice:   t.StopPrice,
+		Status:      t.OrderStatus,
+		Venue:       t.Venue,
+		SubmittedAt: t.SubmittedAt,
+		AgeDays:     int(now.Sub(t.SubmittedAt) / (24 * time.Hour)),
+	}
+
+	ref := t.LimitPrice
+	if ref == nil {
+		ref = t.StopPrice
+	}
+	if ref == nil {
+		return v
+	}
+
+	price, err := m.prices.LatestPrice(t.Symbol)
+	if err != nil || !price.IsPositive() {
+		log.Printf("Failed to price GTC order %s: %v", t.OrderID, err)
+		return v
+	}
+	drift := price.Sub(*ref).Abs().Div(price)
+	v.MarketPrice = &price
+	v.Drift = &drift
+	return v
+}
+
+// drifting reports whether an order's limit is beyond the policy's drift
+// threshold
+func (m *GTCManager) drifting(v GTCOrder) bool {
+	maxDrift := m.Policy().MaxDrift
+	return maxDrift.IsPositive() && v.Drift != nil && v.Drift.GreaterThan(maxDrift)
+}
+
+// stale reports whether an order has been drifting for the policy's number
+// of days, counted in session dates
+func (m *GTCManager) stale(v GTCOrder, now time.Time) bool {
+	if !m.drifting(v) || v.DriftSince == nil {
+		return false
+	}
+	from, _ := time.Parse("2006-01-02", market.SessionDate(*v.DriftSince))
+	to, _ := time.Parse("2006-01-02", market.SessionDate(now))
+	return int(to.Sub(from)/(24*time.Hour)) >= m.Policy().StaleDays
+}
+
+// Enforce refreshes every open GTC order from the broker and applies the
+// policy to stale limit orders. Simulator orders are reported but left alone.
+func (m *GTCManager) Enforce(ctx context.Context) (*GTCResult, error) {
+	trades, err := m.db.GetOpenTrades("gtc", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := m.db.PruneGTCDrift(); err != nil {
+		log.Printf("Failed to prune GTC drift: %v", err)
+	}
+
+	now := time.Now()
+	result := &GTCResult{Checked: len(trades)}
+	for _, t := range trades {
+		if t.Venue == database.VenueSimulator {
+			continue
+		}
+
+		o, err := m.broker.GetOrder(t.OrderID)
+		if err != nil {
+			log.Printf("Failed to look up order %s: %v", t.OrderID, err)
+			result.Failed++
+			continue
+		}
+		if string(o.Status) != t.OrderStatus || !o.FilledQty.Equal(t.FilledQty) {
+			if err := settle(m.db, m.fills, t, o); err != nil {
+				log.Printf("Failed to settle order %s: %v", t.OrderID, err)
+				result.Failed++
+				continue
+			}
+			t.OrderStatus = string(o.Status)
+			t.FilledQty = o.FilledQty
+			result.Settled++
+		}
+		if orders.IsTerminal(t.OrderStatus) || t.OrderStatus == orders.StatusPendingCancel {
+			continue
+		}
+
+		// The drift is tracked from the first check that finds it, and
+		// forgotten once a check finds the order back within the threshold
+		v := m.view(t)
+		if m.drifting(v) {
+			since, err := m.db.MarkGTCDrift(t.ID, now)
+			if err != nil {
+				log.Printf("Failed to track drift of order %s: %v", t.OrderID, err)
+				result.Failed++
+				continue
+			}
+			v.DriftSince = &since
+		} else if err := m.db.ClearGTCDrift(t.ID); err != nil {
+			log.Printf("Failed to clear drift of order %s: %v", t.OrderID, err)
+		}
+		v.Stale = m.stale(v, now)
+		if !v.Stale || t.OrderType != "limit" {
+			continue
+		}
+		result.Stale++
+
+		switch m.Policy().Action {
+		case ActionCancel:
+			if err := m.cancel(t); err != nil {
+				log.Printf("Failed to cancel stale order %s: %v", t.OrderID, err)
+				result.Failed++
+				continue
+			}
+			result.Canceled++
+			notify.SendUser(ctx, m.notifier, t.UserID, notify.LevelInfo, "Canceled stale GTC order",
+				fmt.Sprintf("Order %s (%s %s %s @ %s, user %s) was %s from the market, drifting since %s",
+					t.OrderID, t.Side, t.Qty, t.Symbol, t.LimitPrice, t.UserID, v.Drift.StringFixed(4), market.SessionDate(*v.DriftSince)))
+		case ActionReprice:
+			newLimit, err := m.reprice(t, *v.MarketPrice)
+			if err != nil {
+				log.Printf("Failed to reprice stale order %s: %v", t.OrderID, err)
+				result.Failed++
+				continue
+			}
+			result.Repriced++
+			notify.SendUser(ctx, m.notifier, t.UserID, notify.LevelInfo, "Repriced stale GTC order",
+				fmt.Sprintf("Order %s (%s %s %s, user %s) moved from %s to %s, drifting since %s",
+					t.OrderID, t.Side, t.Qty, t.Symbol, t.UserID, t.LimitPrice, newLimit, market.SessionDate(*v.DriftSince)))
+		}
+	}
+
+	log.Printf("Checked GTC orders: checked=%d settled=%d stale=%d canceled=%d repriced=%d failed=%d",
+		result.Checked, result.Settled, result.Stale, result.Canceled, result.Repriced, result.Failed)
+	return result, nil
+}
+
+// Run enforces the policy once per session, delay after the open, until ctx
+// is cancelled
+func (m *GTCManager) Run(ctx context.Context, delay time.Duration) {
+	at := func(date string) (time.Time, error) {
+		openAt, err := market.SessionOpen(date)
+		return openAt.Add(delay), err
+	}
+
+	scheduler.EverySession(ctx, clock.System, "GTC order check", at, func(ctx context.Context, date string) {
+		if _, err := m.Enforce(ctx); err != nil {
+			log.Printf("Failed to check GTC orders: %v", err)
+		}
+	})
+}
+
+// cancel asks the broker to cancel an order. The cancel is asynchronous, so
+// the trade is marked pending_cancel until the next check settles it.
+func (m *GTCManager) cancel(t database.Trade) error {
+	if err := m.broker.CancelOrder(t.OrderID); err != nil {
+		return err
+	}
+	return m.db.UpdateTradeStatus(t.OrderID, orders.StatusPendingCancel, t.FilledQty, t.FilledAvgPrice, t.FilledAt)
+}
+
+// reprice moves a limit order to the policy's offset behind the current
+// market price. The broker replaces the order with a new one, which is
+// logged as a new trade.
+func (m *GTCManager) reprice(t database.Trade, price decimal.Decimal) (decimal.Decimal, error) {
+	offset := m.Policy().RepriceOffset
+	if t.Side == "buy" {
+		offset = offset.Neg()
+	}
+	newLimit := m.instruments.Lookup(t.Symbol).RoundPrice(price.Mul(decimal.NewFromInt(1).Add(offset)))
+	sentAt := clock.Now()
+	clientOrderID := orders.NewID(sentAt)
+	replaced, err := m.broker.ReplaceOrder(t.OrderID, alpaca.ReplaceOrderRequest{
+		LimitPrice:    &newLimit,
+		ClientOrderID: clientOrderID,
+	})
+	if err != nil {
+		return decimal.Zero, err
+	}
+	ackedAt := clock.Now()
+
+	detail := fmt.Sprintf("limit price %s replaced by %s as order %s", t.LimitPrice, newLimit, replaced.ID)
+	if err := m.db.RecordOrderEvent(&database.OrderEvent{
+		TradeID:           t.ID,
+		EventType:         database.EventModified,
+		PreviousStatus:    t.OrderStatus,
+		PreviousFilledQty: t.FilledQty,
+		OrderStatus:       t.OrderStatus,
+		FilledQty:         t.FilledQty,
+		FilledAvgPrice:    t.FilledAvgPrice,
+		Detail:            &detail,
+		OccurredAt:        ackedAt,
+	}); err != nil {
+		log.Printf("Failed to record modification of order %s: %v", t.OrderID, err)
+	}
+
+	if err := m.db.UpdateTradeStatus(t.OrderID, orders.StatusReplaced, t.FilledQty, t.FilledAvgPrice, t.FilledAt); err != nil {
+		return decimal.Zero, err
+	}
+
+	qty := t.Qty
+	if replaced.Qty != nil {
+		qty = *replaced.Qty
+	}
+	_, err = m.db.LogTrade(&database.Trade{
+		StrategyID:      t.StrategyID,
+		StrategyVersion: t.StrategyVersion,
+		UserID:          t.UserID,
+		OrderID:         replaced.ID,
+		Symbol:          t.Symbol,
+		Qty:             qty,
+		Side:            t.Side,
+		OrderType:       t.OrderType,
+		TimeInForce:     t.TimeInForce,
+		LimitPrice:      &newLimit,
+		FilledQty:       replaced.FilledQty,
+		FilledAvgPrice:  replaced.FilledAvgPrice,
+		OrderStatus:     string(replaced.Status),
+		SubmittedAt:     time.Now(),
+		FilledAt:        replaced.FilledAt,
+		Venue:           t.Venue,
+		SentAt:          &sentAt,
+		AckedAt:         &ackedAt,
+		ClientOrderID:   clientOrderID,
+		Source:          t.Source,
+	})
+	return newLimit, err
+}
@@ -0,0 +1,145 @@
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/notify"
+	"desk/internal/orders"
+	"desk/internal/pnl"
+)
+
+// Broker looks up the current state of an order
+type Broker interface {
+	GetOrder(orderID string) (*alpaca.Order, error)
+}
+
+// Result summarizes one sweep
+type Result struct {
+	SessionDate string `json:"session_date"`
+	Checked     int    `json:"checked"`
+	Updated     int    `json:"updated"`
+	Expired     int    `json:"expired"`
+	StillOpen   int    `json:"still_open"`
+	Failed      int    `json:"failed"`
+}
+
+// DaySweeper reconciles DAY orders after the session close. Every DAY order
+// should have reached a terminal state by then; the sweeper records the
+// broker's final status (including fills the desk never saw), expires
+// simulator orders, and raises a notification for anything still open.
+type DaySweeper struct {
+	broker   Broker
+	db       *database.DB
+	fills    *pnl.DailyRecorder
+	notifier notify.Notifier
+}
+
+func NewDaySweeper(broker Broker, db *database.DB, fills *pnl.DailyRecorder, notifier notify.Notifier) *DaySweeper {
+	return &DaySweeper{
+		broker:   broker,
+		db:       db,
+		fills:    fills,
+		notifier: notifier,
+	}
+}
+
+// Sweep reconciles every open DAY order submitted before the close of the
+// given session
+func (s *DaySweeper) Sweep(ctx context.Context, sessionDate string) (*Result, error) {
+	closeAt, err := market.SessionClose(sessionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	trades, err := s.db.GetOpenTrades("day", closeAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{SessionDate: sessionDate, Checked: len(trades)}
+	for _, t := range trades {
+		if t.Venue == database.VenueSimulator {
+			// The simulator has no session; unfilled orders simply lapse
+			if err := s.db.UpdateTradeStatus(t.OrderID, orders.StatusExpired, t.FilledQty, t.FilledAvgPrice, t.FilledAt); err != nil {
+				log.Printf("Failed to expire simulated order %s: %v", t.OrderID, err)
+				result.Failed++
+				continue
+			}
+			result.Expired++
+			continue
+		}
+
+		o, err := s.broker.GetOrder(t.OrderID)
+		if err != nil {
+			log.Printf("Failed to look up order %s: %v", t.OrderID, err)
+			result.Failed++
+			continue
+		}
+
+		status := string(o.Status)
+		if !orders.IsTerminal(status) {
+			result.StillOpen++
+			notify.SendUser(ctx, s.notifier, t.UserID, notify.LevelWarning, "DAY order still open after close",
+				fmt.Sprintf("Order %s (%s %s %s, user %s) is %s at Alpaca after the %s close",
+					t.OrderID, t.Side, t.Qty, t.Symbol, t.UserID, status, sessionDate))
+			continue
+		}
+
+		if err := settle(s.db, s.fills, t, o); err != nil {
+			log.Printf("Failed to settle order %s: %v", t.OrderID, err)
+			result.Failed++
+			continue
+		}
+		if status == orders.StatusExpired {
+			result.Expired++
+		} else {
+			result.Updated++
+		}
+	}
+
+	if result.Failed > 0 {
+		notify.Send(ctx, s.notifier, notify.LevelError, "DAY order sweep incomplete",
+			fmt.Sprintf("%d of %d DAY orders for %s could not be reconciled", result.Failed, result.Checked, sessionDate))
+	}
+
+	log.Printf("Swept DAY orders for %s: checked=%d updated=%d expired=%d still_open=%d failed=%d",
+		sessionDate, result.Checked, result.Updated, result.Expired, result.StillOpen, result.Failed)
+	return result, nil
+}
+
+// settle records the broker's state for a trade, aggregating any quantity
+// that filled since the desk last saw the order
+func settle(db *database.DB, fills *pnl.DailyRecorder, t database.Trade, o *alpaca.Order) error {
+	if err := db.UpdateTradeStatus(t.OrderID, string(o.Status), o.FilledQty, o.FilledAvgPrice, o.FilledAt); err != nil {
+		return err
+	}
+
+	missed := o.FilledQty.Sub(t.FilledQty)
+	if !missed.IsPositive() || o.FilledAvgPrice == nil {
+		return nil
+	}
+	at := time.Now()
+	if o.FilledAt != nil {
+		at = *o.FilledAt
+	}
+	return fills.RecordFill(t, missed, missedPrice(t, o, missed), at)
+}
+
+// missedPrice is the average price of the missed quantity, backed out of
+// the order's average over every fill and the trade's over those the desk
+// already recorded
+func missedPrice(t database.Trade, o *alpaca.Order, missed decimal.Decimal) decimal.Decimal {
+	if t.FilledAvgPrice == nil || !t.FilledQty.IsPositive() {
+		return *o.FilledAvgPrice
+	}
+	seen := t.FilledAvgPrice.Mul(t.FilledQty)
+	return o.FilledAvgPrice.Mul(o.FilledQty).Sub(seen).Div(missed)
+}
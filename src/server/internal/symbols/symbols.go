@@ -0,0 +1,117 @@
+package symbols
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// cryptoQuotes are the quote currencies of the crypto pairs Alpaca lists
+var cryptoQuotes = map[string]bool{"USD": true, "USDT": true, "USDC": true, "BTC": true}
+
+// separators split a class share suffix or a crypto pair
+const separators = "/-_. "
+
+// Normalize converts a symbol to the form Alpaca uses, so the same
+// instrument is always recorded under one symbol: upper case, class shares
+// with a dot (BRK-B, BRK/B and brk b become BRK.B) and crypto pairs with a
+// slash (BTC-USD and btc_usd become BTC/USD). Symbols it doesn't recognize
+// are only trimmed and upper-cased.
+func Normalize(symbol string) string {
+	symbol = strings.ToUpper(strings.Join(strings.Fields(symbol), " "))
+
+	i := strings.LastIndexAny(symbol, separators)
+	if i <= 0 || i == len(symbol)-1 || strings.ContainsAny(symbol[:i], separators) {
+		return symbol
+	}
+	base, suffix := symbol[:i], symbol[i+1:]
+	switch {
+	case cryptoQuotes[suffix] && len(base) >= 2:
+		return base + "/" + suffix
+	case len(suffix) <= 2 && isLetters(suffix):
+		return base + "." + suffix
+	}
+	return symbol
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Aliases maps alternative symbols, such as a ticker from before a rename or
+// another venue's name for a pair, to the symbol the desk trades. It is safe
+// for concurrent use.
+type Aliases struct {
+	mu      sync.RWMutex
+	aliases map[string]string
+}
+
+// NewAliases returns aliases resolving each key to its value. Both are
+// expected to be normalized.
+func NewAliases(aliases map[string]string) *Aliases {
+	if aliases == nil {
+		aliases = make(map[string]string)
+	}
+	return &Aliases{aliases: aliases}
+}
+
+// Resolve normalizes symbol and replaces it if it is an alias
+func (a *Aliases) Resolve(symbol string) string {
+	symbol = Normalize(symbol)
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if target, ok := a.aliases[symbol]; ok {
+		return target
+	}
+	return symbol
+}
+
+// ResolveAll resolves symbols, dropping blanks and duplicates
+func (a *Aliases) ResolveAll(symbols []string) []string {
+	out := []string{}
+	for _, s := range symbols {
+		if s = a.Resolve(s); s != "" && !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Target returns the symbol an alias resolves to
+func (a *Aliases) Target(alias string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	target, ok := a.aliases[alias]
+	return target, ok
+}
+
+// IsTarget reports whether any alias resolves to symbol
+func (a *Aliases) IsTarget(symbol string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, target := range a.aliases {
+		if target == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// Set adds or replaces an alias
+func (a *Aliases) Set(alias, symbol string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aliases[alias] = symbol
+}
+
+// Delete removes an alias
+func (a *Aliases) Delete(alias string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.aliases, alias)
+}
@@ -0,0 +1,388 @@
+// Package taxlots matches a user's fills into tax lots, first in, first out,
+// and flags wash sales: a loss on shares sold within 30 days before or after
+// shares of the same symbol were bought. The disallowed part of the loss is
+// added to the cost basis of the replacement shares, and the time the sold
+// shares were held is added to theirs, so a later sale of them reports it.
+package taxlots
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/orders"
+)
+
+// WashWindowDays is how many days before and after a loss a purchase of the
+// same symbol makes it a wash sale
+const WashWindowDays = 30
+
+// Terms of a closed lot's gain
+const (
+	TermShort = "short"
+	TermLong  = "long"
+)
+
+// Lot is shares still held, or still short, from one opening fill. Cost
+// includes any wash sale loss carried into it.
+type Lot struct {
+	Symbol      string          `json:"symbol"`
+	OpenTradeID int64           `json:"open_trade_id"`
+	OpenedAt    time.Time       `json:"opened_at"`
+	Short       bool            `json:"short,omitempty"`
+	Qty         decimal.Decimal `json:"qty"`
+	Cost        decimal.Decimal `json:"cost"`
+	// WashAdjustment is the disallowed loss of an earlier wash sale added to
+	// Cost, and HeldFrom the start of the holding period carried with it
+	WashAdjustment decimal.Decimal `json:"wash_adjustment"`
+	HeldFrom       time.Time       `json:"held_from"`
+}
+
+// Closed is shares of one lot closed by one fill. For a short lot Proceeds
+// are from the opening sale and Cost is the cover.
+type Closed struct {
+	Symbol       string          `json:"symbol"`
+	OpenTradeID  int64           `json:"open_trade_id"`
+	CloseTradeID int64           `json:"close_trade_id"`
+	OpenedAt     time.Time       `json:"opened_at"`
+	ClosedAt     time.Time       `json:"closed_at"`
+	Short        bool            `json:"short,omitempty"`
+	Qty          decimal.Decimal `json:"qty"`
+	Proceeds     decimal.Decimal `json:"proceeds"`
+	Cost         decimal.Decimal `json:"cost"`
+	// WashAdjustment is the part of Cost carried in from an earlier wash
+	// sale
+	WashAdjustment decimal.Decimal `json:"wash_adjustment"`
+	// Gain is Proceeds less Cost, plus any loss a wash sale disallowed
+	Gain decimal.Decimal `json:"gain"`
+	// Term is long when the shares, with any holding period carried in,
+	// were held for more than a year; short sales are always short
+	Term     string    `json:"term"`
+	WashSale *WashSale `json:"wash_sale,omitempty"`
+	// WashWindowEnds is set on a loss whose window is still open: buying
+	// the symbol on or before this date would disallow what remains of it
+	WashWindowEnds string `json:"wash_window_ends,omitempty"`
+}
+
+// WashSale is the part of a closed lot's loss disallowed by purchases within
+// the window
+type WashSale struct {
+	Disallowed   decimal.Decimal `json:"disallowed"`
+	Qty          decimal.Decimal `json:"qty"`
+	Replacements []Replacement   `json:"replacements"`
+}
+
+// Replacement is shares of a purchase that a wash sale's loss was carried
+// into
+type Replacement struct {
+	TradeID  int64           `json:"trade_id"`
+	FilledAt time.Time       `json:"filled_at"`
+	Qty      decimal.Decimal `json:"qty"`
+}
+
+// Report is a user's lots closed in a tax year, with totals, and the lots
+// still open
+type Report struct {
+	UserID     string          `json:"user_id"`
+	Year       int             `json:"year"`
+	Closed     []Closed        `json:"closed"`
+	Open       []Lot           `json:"open"`
+	Proceeds   decimal.Decimal `json:"proceeds"`
+	Cost       decimal.Decimal `json:"cost"`
+	Disallowed decimal.Decimal `json:"disallowed"`
+	ShortTerm  decimal.Decimal `json:"short_term_gain"`
+	LongTerm   decimal.Decimal `json:"long_term_gain"`
+	// WashSales counts the year's closed lots with a disallowed loss, and
+	// OpenWindows its losses that a purchase could still make wash sales
+	WashSales   int `json:"wash_sales"`
+	OpenWindows int `json:"open_windows"`
+}
+
+// tranche is a run of a purchase's shares, by position in the purchase,
+// carrying a wash sale's disallowed loss per share and holding period
+type tranche struct {
+	from, to decimal.Decimal
+	perShare decimal.Decimal
+	heldFrom time.Time
+}
+
+// purchase is a fill that opened long shares, and how many of them have
+// been sold or taken as replacements
+type purchase struct {
+	trade    database.Trade
+	opened   decimal.Decimal
+	sold     decimal.Decimal
+	replaced decimal.Decimal
+	tranches []tranche
+}
+
+// adjustment returns the tranches covering shares [from, to) of p, with
+// shares outside every tranche as a tranche of their own
+func (p *purchase) adjustment(from, to decimal.Decimal) []tranche {
+	var out []tranche
+	at := from
+	for _, t := range p.tranches {
+		if !t.to.GreaterThan(at) || !t.from.LessThan(to) {
+			continue
+		}
+		if t.from.GreaterThan(at) {
+			out = append(out, tranche{from: at, to: t.from, heldFrom: *p.trade.FilledAt})
+			at = t.from
+		}
+		end := decimal.Min(t.to, to)
+		out = append(out, tranche{from: at, to: end, perShare: t.perShare, heldFrom: t.heldFrom})
+		at = end
+	}
+	if at.LessThan(to) {
+		out = append(out, tranche{from: at, to: to, heldFrom: *p.trade.FilledAt})
+	}
+	return out
+}
+
+// opening is shares of a fill not yet closed, long or short, at the back of
+// a symbol's queue
+type opening struct {
+	trade database.Trade
+	qty   decimal.Decimal
+	// offset is the position of the first remaining share in a purchase
+	offset decimal.Decimal
+}
+
+// closing is shares of an opening closed by a later fill
+type closing struct {
+	open, close database.Trade
+	qty         decimal.Decimal
+	offset      decimal.Decimal
+	short       bool
+}
+
+// Build matches trades, a user's fills oldest first, into lots and reports
+// those closed in year, flagging wash sales. Wash windows still open at now
+// are flagged too. Simulator trades aren't real and are skipped.
+func Build(userID string, trades []database.Trade, year int, now time.Time) *Report {
+	purchases := make(map[int64]*purchase)
+	bySymbol := make(map[string][]*purchase)
+	var closings []closing
+	longs := make(map[string][]*opening)
+	shorts := make(map[string][]*opening)
+
+	for _, t := range trades {
+		if t.Venue == database.VenueSimulator || t.FilledAt == nil || t.FilledAvgPrice == nil || !t.FilledQty.IsPositive() {
+			continue
+		}
+		remaining := t.FilledQty
+		// A fill closes the opposite side first, oldest lot first
+		selling := t.Side == "sell"
+		closes, opens := shorts, longs
+		if selling {
+			closes, opens = longs, shorts
+		}
+		queue := closes[t.Symbol]
+		for len(queue) > 0 && remaining.IsPositive() {
+			o := queue[0]
+			n := decimal.Min(o.qty, remaining)
+			closings = append(closings, closing{open: o.trade, close: t, qty: n, offset: o.offset, short: !selling})
+			o.qty, o.offset, remaining = o.qty.Sub(n), o.offset.Add(n), remaining.Sub(n)
+			if o.qty.IsZero() {
+				queue = queue[1:]
+			}
+		}
+		closes[t.Symbol] = queue
+		if remaining.IsPositive() {
+			opens[t.Symbol] = append(opens[t.Symbol], &opening{trade: t, qty: remaining})
+			if !selling {
+				p := &purchase{trade: t, opened: remaining}
+				purchases[t.ID] = p
+				bySymbol[t.Symbol] = append(bySymbol[t.Symbol], p)
+			}
+		}
+	}
+
+	r := &Report{UserID: userID, Year: year, Closed: []Closed{}, Open: []Lot{}}
+	today := market.SessionDate(now)
+	for _, c := range closings {
+		if c.short {
+			r.add(shortClosed(c))
+			continue
+		}
+		p := purchases[c.open.ID]
+		for _, t := range p.adjustment(c.offset, c.offset.Add(c.qty)) {
+			lot := longClosed(c, t)
+			if lot.Gain.IsNegative() && washable(c.close.Symbol) {
+				washSale(&lot, c, p, t, bySymbol[c.close.Symbol], today)
+			}
+			p.sold = t.to
+			r.add(lot)
+		}
+	}
+
+	for symbol, queue := range longs {
+		for _, o := range queue {
+			p := purchases[o.trade.ID]
+			for _, t := range p.adjustment(o.offset, o.offset.Add(o.qty)) {
+				qty := t.to.Sub(t.from)
+				adj := t.perShare.Mul(qty).Round(2)
+				r.Open = append(r.Open, Lot{
+					Symbol:         symbol,
+					OpenTradeID:    o.trade.ID,
+					OpenedAt:       *o.trade.FilledAt,
+					Qty:            qty,
+					Cost:           o.trade.FilledAvgPrice.Mul(qty).Round(2).Add(adj),
+					WashAdjustment: adj,
+					HeldFrom:       t.heldFrom,
+				})
+			}
+		}
+	}
+	for symbol, queue := range shorts {
+		for _, o := range queue {
+			r.Open = append(r.Open, Lot{
+				Symbol:      symbol,
+				OpenTradeID: o.trade.ID,
+				OpenedAt:    *o.trade.FilledAt,
+				Short:       true,
+				Qty:         o.qty,
+				Cost:        o.trade.FilledAvgPrice.Mul(o.qty).Round(2),
+				HeldFrom:    *o.trade.FilledAt,
+			})
+		}
+	}
+	sort.SliceStable(r.Open, func(i, j int) bool {
+		a, b := r.Open[i], r.Open[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.OpenedAt.Before(b.OpenedAt)
+	})
+	return r
+}
+
+// add totals a closed lot into the report if it closed in the report's year
+func (r *Report) add(lot Closed) {
+	if lot.ClosedAt.In(market.Exchange).Year() != r.Year {
+		return
+	}
+	r.Closed = append(r.Closed, lot)
+	r.Proceeds = r.Proceeds.Add(lot.Proceeds)
+	r.Cost = r.Cost.Add(lot.Cost)
+	if lot.Term == TermLong {
+		r.LongTerm = r.LongTerm.Add(lot.Gain)
+	} else {
+		r.ShortTerm = r.ShortTerm.Add(lot.Gain)
+	}
+	if lot.WashSale != nil {
+		r.WashSales++
+		r.Disallowed = r.Disallowed.Add(lot.WashSale.Disallowed)
+	}
+	if lot.WashWindowEnds != "" {
+		r.OpenWindows++
+	}
+}
+
+// longClosed is shares [t.from, t.to) of a purchase sold by c
+func longClosed(c closing, t tranche) Closed {
+	qty := t.to.Sub(t.from)
+	adj := t.perShare.Mul(qty).Round(2)
+	lot := Closed{
+		Symbol:         c.close.Symbol,
+		OpenTradeID:    c.open.ID,
+		CloseTradeID:   c.close.ID,
+		OpenedAt:       *c.open.FilledAt,
+		ClosedAt:       *c.close.FilledAt,
+		Qty:            qty,
+		Proceeds:       c.close.FilledAvgPrice.Mul(qty).Round(2),
+		Cost:           c.open.FilledAvgPrice.Mul(qty).Round(2).Add(adj),
+		WashAdjustment: adj,
+		Term:           TermShort,
+	}
+	lot.Gain = lot.Proceeds.Sub(lot.Cost)
+	if c.close.FilledAt.After(t.heldFrom.AddDate(1, 0, 0)) {
+		lot.Term = TermLong
+	}
+	return lot
+}
+
+// shortClosed is shares of a short sale covered by c
+func shortClosed(c closing) Closed {
+	lot := Closed{
+		Symbol:       c.close.Symbol,
+		OpenTradeID:  c.open.ID,
+		CloseTradeID: c.close.ID,
+		OpenedAt:     *c.open.FilledAt,
+		ClosedAt:     *c.close.FilledAt,
+		Short:        true,
+		Qty:          c.qty,
+		Proceeds:     c.open.FilledAvgPrice.Mul(c.qty).Round(2),
+		Cost:         c.close.FilledAvgPrice.Mul(c.qty).Round(2),
+		Term:         TermShort,
+	}
+	lot.Gain = lot.Proceeds.Sub(lot.Cost)
+	return lot
+}
+
+// heldDays counts the calendar days on the exchange's clock from from to
+// to. Holding periods run in days, so carrying one over as a duration would
+// be an hour off across a daylight saving change.
+func heldDays(from, to time.Time) int {
+	a, _ := time.Parse("2006-01-02", market.SessionDate(from))
+	b, _ := time.Parse("2006-01-02", market.SessionDate(to))
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// washSale disallows lot's loss against purchases of the symbol within the
+// window around its sale, earliest first, that are neither the sold shares'
+// own purchase nor sold or taken as replacements already. The loss carried
+// into each replacement is added to its basis as a tranche, whose holding
+// period is extended by the days the sold shares were held.
+func washSale(lot *Closed, c closing, sold *purchase, t tranche, candidates []*purchase, today string) {
+	saleDate := market.SessionDate(*c.close.FilledAt)
+	day, _ := time.Parse("2006-01-02", saleDate)
+	first := day.AddDate(0, 0, -WashWindowDays).Format("2006-01-02")
+	last := day.AddDate(0, 0, WashWindowDays).Format("2006-01-02")
+
+	perShare := lot.Gain.Neg().Div(lot.Qty)
+	need := lot.Qty
+	for _, p := range candidates {
+		if !need.IsPositive() {
+			break
+		}
+		date := market.SessionDate(*p.trade.FilledAt)
+		if p == sold || date < first || date > last {
+			continue
+		}
+		from := decimal.Max(p.sold, p.replaced)
+		n := decimal.Min(p.opened.Sub(from), need)
+		if !n.IsPositive() {
+			continue
+		}
+		heldFrom := market.ExchangeTime(*p.trade.FilledAt).AddDate(0, 0, -heldDays(t.heldFrom, *c.close.FilledAt))
+		p.tranches = append(p.tranches, tranche{from: from, to: from.Add(n), perShare: perShare, heldFrom: heldFrom})
+		sort.Slice(p.tranches, func(i, j int) bool { return p.tranches[i].from.LessThan(p.tranches[j].from) })
+		p.replaced = from.Add(n)
+		need = need.Sub(n)
+
+		if lot.WashSale == nil {
+			lot.WashSale = &WashSale{}
+		}
+		lot.WashSale.Qty = lot.WashSale.Qty.Add(n)
+		lot.WashSale.Replacements = append(lot.WashSale.Replacements, Replacement{TradeID: p.trade.ID, FilledAt: *p.trade.FilledAt, Qty: n})
+	}
+
+	if lot.WashSale != nil {
+		disallowed := perShare.Mul(lot.WashSale.Qty).Round(2)
+		lot.WashSale.Disallowed = disallowed
+		lot.Gain = lot.Gain.Add(disallowed)
+	}
+	if need.IsPositive() && last >= today {
+		lot.WashWindowEnds = last
+	}
+}
+
+// washable reports whether the wash sale rule applies to symbol. It covers
+// stock and securities, which crypto pairs aren't.
+func washable(symbol string) bool {
+	return orders.AssetClassOf(symbol) != orders.AssetClassCrypto
+}
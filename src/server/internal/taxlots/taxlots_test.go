@@ -0,0 +1,146 @@
+package taxlots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+)
+
+// fill is a filled AAPL order at 11:00 ET on date
+func fill(id int64, side, qty, price, date string) database.Trade {
+	filledAt, err := time.ParseInLocation("2006-01-02 15:04", date+" 11:00", market.Exchange)
+	if err != nil {
+		panic(err)
+	}
+	avg := decimal.RequireFromString(price)
+	return database.Trade{
+		ID:             id,
+		UserID:         "alice",
+		Symbol:         "AAPL",
+		Side:           side,
+		Qty:            decimal.RequireFromString(qty),
+		FilledQty:      decimal.RequireFromString(qty),
+		FilledAvgPrice: &avg,
+		FilledAt:       &filledAt,
+		Venue:          database.VenueAlpaca,
+	}
+}
+
+func day(date string) time.Time {
+	return fill(0, "buy", "1", "1", date).FilledAt.UTC()
+}
+
+func TestBuildWashSales(t *testing.T) {
+	type openLot struct {
+		tradeID   int64
+		qty, cost string
+		adj       string
+		heldFrom  string
+	}
+	tests := []struct {
+		name   string
+		trades []database.Trade
+		now    string
+		// gain is the closed lot's gain after any disallowed loss
+		gain, disallowed string
+		washSales        int
+		windowEnds       string
+		open             []openLot
+	}{
+		{
+			name: "replacement after the sale",
+			trades: []database.Trade{
+				fill(1, "buy", "100", "50", "2025-03-03"),
+				fill(2, "sell", "100", "40", "2025-06-02"),
+				fill(3, "buy", "100", "42", "2025-06-16"),
+			},
+			now:        "2025-12-31",
+			gain:       "0",
+			disallowed: "1000",
+			washSales:  1,
+			// The 91 days the sold shares were held carry over
+			open: []openLot{{tradeID: 3, qty: "100", cost: "5200", adj: "1000", heldFrom: "2025-03-17"}},
+		},
+		{
+			name: "replacement before the sale",
+			trades: []database.Trade{
+				fill(1, "buy", "100", "50", "2025-03-03"),
+				fill(2, "buy", "100", "45", "2025-05-20"),
+				fill(3, "sell", "100", "40", "2025-06-02"),
+			},
+			now:        "2025-12-31",
+			gain:       "0",
+			disallowed: "1000",
+			washSales:  1,
+			open:       []openLot{{tradeID: 2, qty: "100", cost: "5500", adj: "1000", heldFrom: "2025-02-18"}},
+		},
+		{
+			name: "partial replacement",
+			trades: []database.Trade{
+				fill(1, "buy", "100", "50", "2025-03-03"),
+				fill(2, "sell", "100", "40", "2025-06-02"),
+				fill(3, "buy", "40", "41", "2025-06-10"),
+			},
+			now:        "2025-06-20",
+			gain:       "-600",
+			disallowed: "400",
+			washSales:  1,
+			// The rest of the loss can still be washed until the window ends
+			windowEnds: "2025-07-02",
+			open:       []openLot{{tradeID: 3, qty: "40", cost: "2040", adj: "400", heldFrom: "2025-03-11"}},
+		},
+		{
+			name: "buy outside the window",
+			trades: []database.Trade{
+				fill(1, "buy", "100", "50", "2025-03-03"),
+				fill(2, "sell", "100", "40", "2025-06-02"),
+				fill(3, "buy", "100", "42", "2025-07-15"),
+			},
+			now:        "2025-12-31",
+			gain:       "-1000",
+			disallowed: "0",
+			open:       []openLot{{tradeID: 3, qty: "100", cost: "4200", adj: "0", heldFrom: "2025-07-15"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Build("alice", tt.trades, 2025, day(tt.now))
+
+			if len(r.Closed) != 1 {
+				t.Fatalf("closed %d lots, want 1: %+v", len(r.Closed), r.Closed)
+			}
+			lot := r.Closed[0]
+			if !lot.Gain.Equal(decimal.RequireFromString(tt.gain)) {
+				t.Errorf("gain = %s, want %s", lot.Gain, tt.gain)
+			}
+			if !r.Disallowed.Equal(decimal.RequireFromString(tt.disallowed)) || r.WashSales != tt.washSales {
+				t.Errorf("disallowed %s in %d wash sales, want %s in %d", r.Disallowed, r.WashSales, tt.disallowed, tt.washSales)
+			}
+			if (lot.WashSale != nil) != (tt.washSales > 0) {
+				t.Errorf("wash sale = %+v", lot.WashSale)
+			}
+			if lot.WashWindowEnds != tt.windowEnds {
+				t.Errorf("wash window ends %q, want %q", lot.WashWindowEnds, tt.windowEnds)
+			}
+
+			if len(r.Open) != len(tt.open) {
+				t.Fatalf("open lots = %+v, want %d", r.Open, len(tt.open))
+			}
+			for i, want := range tt.open {
+				got := r.Open[i]
+				if got.OpenTradeID != want.tradeID ||
+					!got.Qty.Equal(decimal.RequireFromString(want.qty)) ||
+					!got.Cost.Equal(decimal.RequireFromString(want.cost)) ||
+					!got.WashAdjustment.Equal(decimal.RequireFromString(want.adj)) ||
+					!got.HeldFrom.Equal(day(want.heldFrom)) {
+					t.Errorf("open lot %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+// Package tca measures how well orders were executed against the market's
+// volume-weighted average price over the time they were working: from
+// submission to their last fill. Minute bars are cached in the database once
+// a session is over, so an order is measured against the same bars however
+// often it is analysed.
+package tca
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/market"
+	"desk/internal/mktdata"
+	"desk/internal/orders"
+)
+
+// ErrSessionOpen is returned by Warm for a session still trading, whose
+// bars aren't final
+var ErrSessionOpen = errors.New("after-hours trading isn't over")
+
+// maxSessions is the most sessions an order's interval may span; a GTC order
+// that worked for weeks has no meaningful interval VWAP
+const maxSessions = 5
+
+var (
+	bps   = decimal.NewFromInt(10000)
+	three = decimal.NewFromInt(3)
+)
+
+// Execution is one filled order measured against its interval VWAP
+type Execution struct {
+	TradeID    int64           `json:"trade_id"`
+	OrderID    string          `json:"order_id"`
+	UserID     string          `json:"user_id"`
+	StrategyID *int64          `json:"strategy_id,omitempty"`
+	Symbol     string          `json:"symbol"`
+	Side       string          `json:"side"`
+	OrderType  string          `json:"order_type"`
+	Source     string          `json:"source,omitempty"`
+	Qty        decimal.Decimal `json:"qty"`
+	FillPrice  decimal.Decimal `json:"fill_price"`
+	Notional   decimal.Decimal `json:"notional"`
+	// SubmittedAt and FilledAt bound the interval the VWAP is taken over
+	SubmittedAt time.Time        `json:"submitted_at"`
+	FilledAt    time.Time        `json:"filled_at"`
+	VWAP        *decimal.Decimal `json:"vwap,omitempty"`
+	Bars        int              `json:"bars"`
+	Volume      int64            `json:"volume"`
+	// SlippageBps is how much worse than VWAP the order filled, in basis
+	// points: positive when a buy paid more or a sell received less, and
+	// Cost the same in dollars
+	SlippageBps decimal.Decimal `json:"slippage_bps"`
+	Cost        decimal.Decimal `json:"cost"`
+	// Error says why the order couldn't be measured
+	Error string `json:"error,omitempty"`
+}
+
+// Measured reports whether the order was measured against a VWAP
+func (e *Execution) Measured() bool {
+	return e.VWAP != nil
+}
+
+// Summary is the execution quality of one strategy's orders, or of manual
+// orders when StrategyID is nil
+type Summary struct {
+	StrategyID *int64 `json:"strategy_id"`
+	Orders     int    `json:"orders"`
+	// Measured is how many of the orders had bars to measure them against;
+	// the rest are left out of every figure below
+	Measured int             `json:"measured"`
+	Notional decimal.Decimal `json:"notional"`
+	Cost     decimal.Decimal `json:"cost"`
+	// SlippageBps is the notional-weighted slippage, Cost over Notional
+	SlippageBps decimal.Decimal `json:"slippage_bps"`
+	// Beat is how many orders filled at or better than VWAP
+	Beat int `json:"beat"`
+}
+
+// Analyzer measures filled orders against interval VWAPs from bars it
+// fetches from a market data provider and caches
+type Analyzer struct {
+	db   *database.DB
+	bars mktdata.Provider
+	now  func() time.Time
+	// mu guards fetches, the sessions being fetched by symbol and date, so
+	// two analyses of the same session share one fetch
+	mu      sync.Mutex
+	fetches map[string]*barsFetch
+}
+
+// barsFetch is a session's bars being fetched; done is closed when bars
+// and err are set
+type barsFetch struct {
+	done chan struct{}
+	bars []database.MinuteBar
+	err  error
+}
+
+// New creates an analyzer caching bars served by provider in db
+func New(db *database.DB, provider mktdata.Provider) *Analyzer {
+	return &Analyzer{db: db, bars: provider, now: time.Now, fetches: make(map[string]*barsFetch)}
+}
+
+// Analyze measures each trade against the VWAP over the minutes from its
+// submission to its last fill. An order that can't be measured, such as an
+// option or one with no bars in its interval, is returned with an Error.
+func (a *Analyzer) Analyze(ctx context.Context, trades []database.Trade) []Execution {
+	execs := make([]Execution, 0, len(trades))
+	for _, t := range trades {
+		if t.FilledAvgPrice == nil || t.FilledAt == nil {
+			continue
+		}
+		e := Execution{
+			TradeID:     t.ID,
+			OrderID:     t.OrderID,
+			UserID:      t.UserID,
+			StrategyID:  t.StrategyID,
+			Symbol:      t.Symbol,
+			Side:        t.Side,
+			OrderType:   t.OrderType,
+			Source:      t.Source,
+			Qty:         t.FilledQty,
+			FillPrice:   *t.FilledAvgPrice,
+			Notional:    t.FilledQty.Mul(*t.FilledAvgPrice).Round(2),
+			SubmittedAt: t.SubmittedAt,
+			FilledAt:    *t.FilledAt,
+		}
+		if ctx.Err() != nil {
+			e.Error = ctx.Err().Error()
+		} else if err := a.measure(&e); err != nil {
+			e.Error = err.Error()
+		}
+		execs = append(execs, e)
+	}
+	return execs
+}
+
+// measure fills in e's VWAP and slippage
+func (a *Analyzer) measure(e *Execution) error {
+	if orders.AssetClassOf(e.Symbol) != orders.AssetClassEquity {
+		return fmt.Errorf("no minute bars for %s", orders.AssetClassOf(e.Symbol))
+	}
+	dates := sessionDates(e.SubmittedAt, e.FilledAt)
+	if len(dates) > maxSessions {
+		return fmt.Errorf("worked over %d sessions, more than %d", len(dates), maxSessions)
+	}
+
+	var bars []database.MinuteBar
+	for _, date := range dates {
+		b, err := a.Bars(e.Symbol, date)
+		if err != nil {
+			return err
+		}
+		bars = append(bars, b...)
+	}
+	vwap, volume, n := IntervalVWAP(bars, e.SubmittedAt, e.FilledAt)
+	if n == 0 {
+		return fmt.Errorf("no bars with volume between submission and fill")
+	}
+
+	e.VWAP, e.Volume, e.Bars = &vwap, volume, n
+	diff := e.FillPrice.Sub(vwap)
+	if e.Side == "sell" {
+		diff = diff.Neg()
+	}
+	e.SlippageBps = diff.Div(vwap).Mul(bps).Round(2)
+	e.Cost = diff.Mul(e.Qty).Round(2)
+	return nil
+}
+
+// Bars returns a symbol's minute bars for a session, from the cache if it
+// has them. A session's bars are fetched in full, pre-market to after-hours,
+// and cached once after-hours trading is over; until then they are fetched
+// again.
+func (a *Analyzer) Bars(symbol, date string) ([]database.MinuteBar, error) {
+	key := symbol + " " + date
+	a.mu.Lock()
+	if f, ok := a.fetches[key]; ok {
+		a.mu.Unlock()
+		<-f.done
+		return f.bars, f.err
+	}
+	f := &barsFetch{done: make(chan struct{})}
+	a.fetches[key] = f
+	a.mu.Unlock()
+
+	f.bars, f.err = a.loadBars(symbol, date)
+	a.mu.Lock()
+	delete(a.fetches, key)
+	a.mu.Unlock()
+	close(f.done)
+	return f.bars, f.err
+}
+
+// loadBars reads a session's bars from the cache, or fetches them and
+// caches them if the session is over
+func (a *Analyzer) loadBars(symbol, date string) ([]database.MinuteBar, error) {
+	bars, cached, err := a.db.GetMinuteBars(symbol, date)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		return bars, nil
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", date, market.Exchange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session date %q: %w", date, err)
+	}
+	fetched, err := a.bars.Bars(symbol, "1Min", start, start.AddDate(0, 0, 1), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minute bars of %s for %s: %w", symbol, date, err)
+	}
+	bars = make([]database.MinuteBar, len(fetched))
+	for i, b := range fetched {
+		bars[i] = database.MinuteBar{
+			Timestamp: b.Timestamp,
+			High:      decimal.NewFromFloat(b.High),
+			Low:       decimal.NewFromFloat(b.Low),
+			Close:     decimal.NewFromFloat(b.Close),
+			Volume:    int64(b.Volume),
+			VWAP:      decimal.NewFromFloat(b.VWAP),
+		}
+	}
+	if sessionOver(date, a.now()) {
+		if err := a.db.CacheMinuteBars(symbol, date, bars); err != nil {
+			log.Printf("Failed to cache minute bars of %s for %s: %v", symbol, date, err)
+		}
+	}
+	return bars, nil
+}
+
+// Warm caches the minute bars of every equity filled in a session, so the
+// session's orders are measured from the cache with bars adjusted as they
+// were that day. It returns how many symbols were cached, or ErrSessionOpen
+// before after-hours trading is over.
+func (a *Analyzer) Warm(ctx context.Context, date string) (int, error) {
+	from, err := time.ParseInLocation("2006-01-02", date, market.Exchange)
+	if err != nil {
+		return 0, fmt.Errorf("invalid session date %q: %w", date, err)
+	}
+	if !sessionOver(date, a.now()) {
+		return 0, ErrSessionOpen
+	}
+	trades, err := a.db.GetFilledTradesBetween("", nil, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return 0, err
+	}
+
+	symbols := make(map[string]bool)
+	for _, t := range trades {
+		if orders.AssetClassOf(t.Symbol) == orders.AssetClassEquity {
+			symbols[t.Symbol] = true
+		}
+	}
+	n := 0
+	for symbol := range symbols {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if _, err := a.Bars(symbol, date); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// IntervalVWAP returns the volume-weighted average price of the bars whose
+// minute overlaps [start, end], with their volume and how many there were.
+// A bar without a VWAP of its own is priced at its typical price, the mean
+// of its high, low and close.
+func IntervalVWAP(bars []database.MinuteBar, start, end time.Time) (decimal.Decimal, int64, int) {
+	var value decimal.Decimal
+	var volume int64
+	n := 0
+	for _, b := range bars {
+		if !b.Timestamp.Add(time.Minute).After(start) || b.Timestamp.After(end) || b.Volume <= 0 {
+			continue
+		}
+		price := b.VWAP
+		if !price.IsPositive() {
+			price = b.High.Add(b.Low).Add(b.Close).Div(three)
+		}
+		value = value.Add(price.Mul(decimal.NewFromInt(b.Volume)))
+		volume += b.Volume
+		n++
+	}
+	if volume == 0 {
+		return decimal.Zero, 0, 0
+	}
+	return value.Div(decimal.NewFromInt(volume)).Round(6), volume, n
+}
+
+// Summarize totals executions by strategy, manual orders first and then by
+// strategy ID
+func Summarize(execs []Execution) []Summary {
+	byStrategy := make(map[int64]*Summary)
+	var manual *Summary
+	for _, e := range execs {
+		var s *Summary
+		if e.StrategyID == nil {
+			if manual == nil {
+				manual = &Summary{}
+			}
+			s = manual
+		} else {
+			if byStrategy[*e.StrategyID] == nil {
+				id := *e.StrategyID
+				byStrategy[id] = &Summary{StrategyID: &id}
+			}
+			s = byStrategy[*e.StrategyID]
+		}
+		s.Orders++
+		if !e.Measured() {
+			continue
+		}
+		s.Measured++
+		s.Notional = s.Notional.Add(e.Notional)
+		s.Cost = s.Cost.Add(e.Cost)
+		if !e.SlippageBps.IsPositive() {
+			s.Beat++
+		}
+	}
+
+	summaries := make([]Summary, 0, len(byStrategy)+1)
+	if manual != nil {
+		summaries = append(summaries, *manual)
+	}
+	for _, s := range byStrategy {
+		summaries = append(summaries, *s)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i].StrategyID, summaries[j].StrategyID
+		return a == nil && b != nil || a != nil && b != nil && *a < *b
+	})
+	for i := range summaries {
+		if summaries[i].Notional.IsPositive() {
+			summaries[i].SlippageBps = summaries[i].Cost.Div(summaries[i].Notional).Mul(bps).Round(2)
+		}
+	}
+	return summaries
+}
+
+// sessionOver reports whether trading in a session, after-hours included,
+// was over at now
+func sessionOver(date string, now time.Time) bool {
+	if date < market.SessionDate(now) {
+		return true
+	}
+	closeAt, err := market.SessionClose(date)
+	return err == nil && now.After(closeAt) && market.SessionOf(now) == market.SessionClosed
+}
+
+// sessionDates returns the session dates from start's to end's
+func sessionDates(start, end time.Time) []string {
+	first, last := market.SessionDate(start), market.SessionDate(end)
+	var dates []string
+	for d, _ := time.Parse("2006-01-02", first); ; d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		if date > last || len(dates) > maxSessions {
+			break
+		}
+		if wd := d.Weekday(); wd != time.Saturday && wd != time.Sunday {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
@@ -0,0 +1,196 @@
+// Package tenants lets several clubs ("chapters") share one desk without
+// seeing each other's books. Chapters are listed in a JSON file; each has a
+// token its members' clients authenticate with, and may have its own Alpaca
+// account, notional limits and notification webhook.
+//
+// A chapter's users are namespaced by prefixing their IDs with the chapter
+// ID ("osu:alice"), so every per-user table and query is isolated without a
+// tenant column. The host chapter, the club that ran the desk before there
+// were chapters, keeps plain IDs, so its existing trades stay its own.
+package tenants
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// separator joins a chapter ID and a user ID
+const separator = ":"
+
+var chapterIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Credentials are a chapter's own Alpaca API key
+type Credentials struct {
+	KeyID     string `json:"key_id"`
+	SecretKey string `json:"secret_key"`
+	BaseURL   string `json:"base_url"`
+}
+
+// Limits cap a chapter's orders: each order's notional, and the gross market
+// value of the chapter's positions an order may take it to. Zero is no limit.
+type Limits struct {
+	MaxOrderNotional decimal.Decimal `json:"max_order_notional"`
+	MaxGrossExposure decimal.Decimal `json:"max_gross_exposure"`
+}
+
+// Chapter is one club sharing the desk
+type Chapter struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// Host marks the chapter whose users keep unprefixed IDs
+	Host bool `json:"host"`
+	// Alpaca is the chapter's own account; without one, its orders go to
+	// the desk's account
+	Alpaca           *Credentials `json:"alpaca,omitempty"`
+	Limits           Limits       `json:"limits"`
+	NotifyWebhookURL string       `json:"notify_webhook_url"`
+}
+
+// UserID returns the desk-wide ID of one of the chapter's users
+func (c *Chapter) UserID(user string) string {
+	if c.Host {
+		return user
+	}
+	return c.ID + separator + user
+}
+
+// Owns reports whether userID is one of the chapter's users
+func (c *Chapter) Owns(userID string) bool {
+	return ChapterID(userID) == c.key()
+}
+
+// key is the prefix of the chapter's user IDs: empty for the host
+func (c *Chapter) key() string {
+	if c.Host {
+		return ""
+	}
+	return c.ID
+}
+
+// ChapterID returns the chapter prefix of a user ID, or "" for the host
+// chapter's users (and every user when there are no chapters)
+func ChapterID(userID string) string {
+	id, _, ok := strings.Cut(userID, separator)
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// SameChapter reports whether two users belong to the same chapter
+func SameChapter(a, b string) bool {
+	return ChapterID(a) == ChapterID(b)
+}
+
+// Registry is the configured chapters
+type Registry struct {
+	chapters []*Chapter
+}
+
+// Load reads chapters from a JSON file of the form {"chapters": [...]}
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chapters: %w", err)
+	}
+	var file struct {
+		Chapters []*Chapter `json:"chapters"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse chapters: %w", err)
+	}
+
+	r := &Registry{chapters: file.Chapters}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate requires unique IDs and tokens, exactly one host, complete
+// credentials and non-negative limits
+func (r *Registry) validate() error {
+	ids := make(map[string]bool)
+	tokens := make(map[string]bool)
+	hosts := 0
+	for _, c := range r.chapters {
+		if !chapterIDPattern.MatchString(c.ID) {
+			return fmt.Errorf("invalid chapter ID %q: want up to 32 lowercase letters, digits and dashes", c.ID)
+		}
+		if ids[c.ID] {
+			return fmt.Errorf("duplicate chapter ID %q", c.ID)
+		}
+		ids[c.ID] = true
+		if len(c.Token) < 16 {
+			return fmt.Errorf("chapter %s: token must be at least 16 characters", c.ID)
+		}
+		if tokens[c.Token] {
+			return fmt.Errorf("chapter %s: token is used by another chapter", c.ID)
+		}
+		tokens[c.Token] = true
+		if c.Host {
+			hosts++
+		}
+		if a := c.Alpaca; a != nil && (a.KeyID == "" || a.SecretKey == "") {
+			return fmt.Errorf("chapter %s: alpaca needs key_id and secret_key", c.ID)
+		}
+		if c.Limits.MaxOrderNotional.IsNegative() || c.Limits.MaxGrossExposure.IsNegative() {
+			return fmt.Errorf("chapter %s: limits must not be negative", c.ID)
+		}
+	}
+	if hosts != 1 {
+		return fmt.Errorf("exactly one chapter must be the host, found %d", hosts)
+	}
+	return nil
+}
+
+// Chapters returns every chapter, in the order configured
+func (r *Registry) Chapters() []*Chapter {
+	return r.chapters
+}
+
+// Authenticate returns the chapter a token belongs to
+func (r *Registry) Authenticate(token string) (*Chapter, bool) {
+	var found *Chapter
+	for _, c := range r.chapters {
+		// Compare every token so timing doesn't tell which one matched
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1 {
+			found = c
+		}
+	}
+	return found, found != nil
+}
+
+// ChapterOf returns the chapter a user belongs to, or nil if their prefix
+// names no chapter
+func (r *Registry) ChapterOf(userID string) *Chapter {
+	key := ChapterID(userID)
+	for _, c := range r.chapters {
+		if c.key() == key {
+			return c
+		}
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// WithChapter returns a context carrying the chapter a request belongs to
+func WithChapter(ctx context.Context, c *Chapter) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the chapter a request belongs to, or nil when there
+// are no chapters
+func FromContext(ctx context.Context) *Chapter {
+	c, _ := ctx.Value(contextKey{}).(*Chapter)
+	return c
+}
@@ -0,0 +1,308 @@
+package tradeupdates
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/shopspring/decimal"
+
+	"desk/internal/database"
+	"desk/internal/pnl"
+)
+
+// retryDelay is how long an account's stream waits before reconnecting
+const retryDelay = 30 * time.Second
+
+// maxBatch is the most orders one batch updates; a burst past it is written
+// without waiting for the window to end
+const maxBatch = 500
+
+// retryFor is how long an update is retried when its order has no trade
+// yet, as when a fill arrives before the order's trade is logged, or when
+// its batch failed
+const retryFor = 10 * time.Second
+
+// Source streams an account's order events, and looks up its orders to
+// recover what the stream had while the desk was down
+type Source interface {
+	StreamTradeUpdates(ctx context.Context, since time.Time, handler func(alpaca.TradeUpdate)) error
+	OrdersSince(after time.Time) ([]alpaca.Order, error)
+	GetOrder(orderID string) (*alpaca.Order, error)
+}
+
+// Stats counts what the consumer has done since it started
+type Stats struct {
+	Updates   int64 `json:"updates"`
+	Coalesced int64 `json:"coalesced"`
+	Batches   int64 `json:"batches"`
+	Changed   int64 `json:"changed"`
+	Fills     int64 `json:"fills"`
+	Unmatched int64 `json:"unmatched"`
+	Failed    int64 `json:"failed"`
+	// Illegal counts updates refused because the order can't make the
+	// change, such as a fill reported for a canceled order
+	Illegal int64 `json:"illegal"`
+	// Recovered counts trades brought up to date at startup with what the
+	// broker did while the desk was down, and Backfilled the trades logged
+	// then for orders the desk had none for
+	Recovered  int64 `json:"recovered"`
+	Backfilled int64 `json:"backfilled"`
+}
+
+// pending is the latest update for an order not yet written
+type pending struct {
+	update database.TradeStatusUpdate
+	at     time.Time
+	first  time.Time
+}
+
+// Consumer follows every account's trade updates and records them on the
+// desk's trades. Updates are coalesced per order over a short window and
+// written in one transaction, so a burst of partial fills costs one write
+// per order rather than one per fill. How far each account is recorded is
+// kept in the database, so after a restart what happened meanwhile is
+// recovered from the broker's orders before the stream resumes.
+type Consumer struct {
+	sources map[string]Source
+	db      *database.DB
+	fills   *pnl.DailyRecorder
+	window  time.Duration
+	updates chan alpaca.TradeUpdate
+	// accountOf returns the chapter whose account a user trades in, and
+	// recoveryUser who an account's orders the desk has no trade for are
+	// booked to
+	accountOf    func(userID string) string
+	recoveryUser func(chapter string) string
+	// started is when the consumer was created; orders placed since are
+	// this process's
+	started time.Time
+
+	mu    sync.Mutex
+	stats Stats
+	live  map[string]bool
+}
+
+// NewConsumer creates a consumer of the trade updates of each account,
+// keyed by chapter, writing a batch every window
+func NewConsumer(sources map[string]Source, db *database.DB, fills *pnl.DailyRecorder, window time.Duration,
+	accountOf, recoveryUser func(string) string) *Consumer {
+	return &Consumer{
+		sources:      sources,
+		db:           db,
+		fills:        fills,
+		window:       window,
+		updates:      make(chan alpaca.TradeUpdate, maxBatch),
+		accountOf:    accountOf,
+		recoveryUser: recoveryUser,
+		started:      time.Now(),
+		live:         make(map[string]bool),
+	}
+}
+
+// Run recovers and then consumes every account's stream until ctx is
+// cancelled
+func (c *Consumer) Run(ctx context.Context) {
+	for chapter, source := range c.sources {
+		go c.follow(ctx, chapter, source)
+	}
+	c.write(ctx)
+}
+
+// Stats returns the consumer's counters
+func (c *Consumer) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// follow recovers one account and streams it from when it was recovered,
+// resuming after the last update it saw when the stream reconnects
+func (c *Consumer) follow(ctx context.Context, chapter string, source Source) {
+	since, err := c.recover(chapter, source)
+	for err != nil {
+		log.Printf("Failed to recover trade updates for account %q: %v", chapter, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		since, err = c.recover(chapter, source)
+	}
+
+	for {
+		c.setLive(chapter, true)
+		err := source.StreamTradeUpdates(ctx, since, func(u alpaca.TradeUpdate) {
+			since = u.At.Add(time.Nanosecond)
+			select {
+			case c.updates <- u:
+			case <-ctx.Done():
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		c.setLive(chapter, false)
+		if err != nil {
+			log.Printf("Trade update stream for account %q failed: %v", chapter, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// write coalesces updates and flushes them every window, recording how far
+// the accounts are recorded every syncInterval and when it stops
+func (c *Consumer) write(ctx context.Context) {
+	ticker := time.NewTicker(c.window)
+	defer ticker.Stop()
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+
+	batch := make(map[string]*pending)
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush(batch)
+			c.sync(batch)
+			return
+		case u := <-c.updates:
+			c.add(batch, u)
+			if len(batch) >= maxBatch {
+				c.flush(batch)
+			}
+		case <-ticker.C:
+			c.flush(batch)
+		case <-syncTicker.C:
+			c.sync(batch)
+		}
+	}
+}
+
+// add keeps u if it is the latest update for its order
+func (c *Consumer) add(batch map[string]*pending, u alpaca.TradeUpdate) {
+	c.mu.Lock()
+	c.stats.Updates++
+	c.mu.Unlock()
+
+	update := database.TradeStatusUpdate{
+		OrderID:        u.Order.ID,
+		Status:         string(u.Order.Status),
+		FilledQty:      u.Order.FilledQty,
+		FilledAvgPrice: u.Order.FilledAvgPrice,
+		FilledAt:       u.Order.FilledAt,
+	}
+	p, ok := batch[update.OrderID]
+	if !ok {
+		batch[update.OrderID] = &pending{update: update, at: u.At, first: time.Now()}
+		return
+	}
+
+	c.mu.Lock()
+	c.stats.Coalesced++
+	c.mu.Unlock()
+	if !u.At.Before(p.at) {
+		p.update, p.at = update, u.At
+	}
+}
+
+// flush writes the batch, aggregating what filled since the desk last saw
+// each order. Updates that couldn't be written stay in the batch until
+// they are retryFor old.
+func (c *Consumer) flush(batch map[string]*pending) {
+	if len(batch) == 0 {
+		return
+	}
+	updates := make([]database.TradeStatusUpdate, 0, len(batch))
+	for _, p := range batch {
+		updates = append(updates, p.update)
+	}
+
+	result, err := c.db.UpdateTradeStatusBatch(updates)
+	if err != nil {
+		log.Printf("Failed to write %d trade updates: %v", len(updates), err)
+		c.mu.Lock()
+		c.stats.Failed += c.expire(batch, nil)
+		c.mu.Unlock()
+		return
+	}
+
+	var fills int64
+	for _, change := range result.Changed {
+		if c.recordFill(change) {
+			fills++
+		}
+	}
+
+	unknown := make(map[string]bool, len(result.Unknown))
+	for _, orderID := range result.Unknown {
+		unknown[orderID] = true
+	}
+	for orderID := range batch {
+		if !unknown[orderID] {
+			delete(batch, orderID)
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Batches++
+	c.stats.Changed += int64(len(result.Changed))
+	c.stats.Fills += fills
+	c.stats.Unmatched += c.expire(batch, unknown)
+	c.stats.Illegal += int64(len(result.Illegal))
+	c.mu.Unlock()
+}
+
+// expire drops the updates in batch that are retryFor old, of only the
+// given orders unless orders is nil, and returns how many it dropped
+func (c *Consumer) expire(batch map[string]*pending, orders map[string]bool) int64 {
+	var dropped int64
+	for orderID, p := range batch {
+		if orders != nil && !orders[orderID] {
+			continue
+		}
+		if time.Since(p.first) >= retryFor {
+			log.Printf("Dropped trade update for order %s (%s) after %s", orderID, p.update.Status, retryFor)
+			delete(batch, orderID)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// recordFill aggregates the quantity a change filled, at the price the
+// change's fills averaged, and reports whether there was any
+func (c *Consumer) recordFill(change database.TradeStatusChange) bool {
+	t := change.Trade
+	filled := t.FilledQty.Sub(change.PreviousFilledQty)
+	if !filled.IsPositive() || t.FilledAvgPrice == nil {
+		return false
+	}
+
+	at := time.Now()
+	if t.FilledAt != nil {
+		at = *t.FilledAt
+	}
+	if err := c.fills.RecordFill(t, filled, fillPrice(change, filled), at); err != nil {
+		log.Printf("Failed to aggregate fill on order %s: %v", t.OrderID, err)
+		return false
+	}
+	return true
+}
+
+// fillPrice is the average price of the filled quantity a change added,
+// backed out of the order's average before and after
+func fillPrice(change database.TradeStatusChange, filled decimal.Decimal) decimal.Decimal {
+	avg := *change.Trade.FilledAvgPrice
+	if change.PreviousAvgPrice == nil || !change.PreviousFilledQty.IsPositive() {
+		return avg
+	}
+	before := change.PreviousAvgPrice.Mul(change.PreviousFilledQty)
+	return avg.Mul(change.Trade.FilledQty).Sub(before).Div(filled)
+}
@@ -0,0 +1,231 @@
+package tradeupdates
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+
+	"desk/internal/database"
+)
+
+// syncInterval is how often the consumer records how far each live account
+// is recorded
+const syncInterval = time.Minute
+
+// recoveryOverlap is how far before its cursor an account's orders are
+// listed on recovery, so an order placed just before the cursor was written
+// whose trade was never logged is still found
+const recoveryOverlap = 2 * syncInterval
+
+// recoveredDetail notes an update the desk missed while it was down
+const recoveredDetail = "recovered after downtime"
+
+// recover brings the desk's trades in an account up to date with what the
+// broker did while the desk wasn't following it, and returns when the
+// broker was asked, from which the account's stream resumes. The orders
+// submitted since the account's cursor and every trade still open in the
+// book are looked up; trades that changed are updated, with an order event
+// and their fills aggregated, and orders the desk has no trade for are
+// logged as trades of the account's recovery user, unless this process
+// placed them. An account without a
+// cursor has never been followed, and has nothing to recover. Either way
+// the cursor is moved to when the broker was asked.
+func (c *Consumer) recover(chapter string, source Source) (time.Time, error) {
+	asked := time.Now()
+	cursor, err := c.db.GetTradeUpdatesSyncedAt(chapter)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cursor == nil {
+		return asked, c.db.SetTradeUpdatesSyncedAt(chapter, asked)
+	}
+
+	placed, err := source.OrdersSince(cursor.Add(-recoveryOverlap))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to list orders since %s: %w", cursor.Format(time.RFC3339), err)
+	}
+	atBroker := make(map[string]alpaca.Order, len(placed))
+	for _, o := range placed {
+		atBroker[o.ID] = o
+	}
+
+	// Orders submitted before the cursor but still open in the book may
+	// have filled or been canceled meanwhile
+	open, err := c.db.GetOpenTrades("", asked)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, t := range open {
+		if t.OrderID == "" || t.Venue == database.VenueSimulator || c.accountOf(t.UserID) != chapter {
+			continue
+		}
+		if _, ok := atBroker[t.OrderID]; ok {
+			continue
+		}
+		o, err := source.GetOrder(t.OrderID)
+		if err != nil {
+			log.Printf("Failed to recover order %s in account %q: %v", t.OrderID, chapter, err)
+			continue
+		}
+		atBroker[o.ID] = *o
+	}
+
+	orderIDs := make([]string, 0, len(atBroker))
+	for id, o := range atBroker {
+		orderIDs = append(orderIDs, id)
+		if o.Replaces != nil {
+			orderIDs = append(orderIDs, *o.Replaces)
+		}
+	}
+	trades, err := c.db.GetTradesByOrderIDs(orderIDs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	known := make(map[string]database.Trade, len(trades))
+	for _, t := range trades {
+		known[t.OrderID] = t
+	}
+
+	detail := recoveredDetail
+	var updates []database.TradeStatusUpdate
+	var backfilled int64
+	for id, o := range atBroker {
+		if _, ok := known[id]; ok {
+			updates = append(updates, database.TradeStatusUpdate{
+				OrderID:        id,
+				Status:         string(o.Status),
+				FilledQty:      o.FilledQty,
+				FilledAvgPrice: o.FilledAvgPrice,
+				FilledAt:       o.FilledAt,
+				Detail:         &detail,
+			})
+			continue
+		}
+		// This process logs the trades of orders it placed itself
+		if o.SubmittedAt.After(c.started) {
+			continue
+		}
+		if c.backfill(chapter, &o, known) {
+			backfilled++
+		}
+	}
+
+	result, err := c.db.UpdateTradeStatusBatch(updates)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var fills int64
+	for _, change := range result.Changed {
+		if c.recordFill(change) {
+			fills++
+		}
+	}
+
+	log.Printf("Recovered account %q after downtime since %s: orders=%d changed=%d backfilled=%d",
+		chapter, cursor.Format(time.RFC3339), len(atBroker), len(result.Changed), backfilled)
+	c.mu.Lock()
+	c.stats.Recovered += int64(len(result.Changed))
+	c.stats.Backfilled += backfilled
+	c.stats.Fills += fills
+	c.stats.Illegal += int64(len(result.Illegal))
+	c.mu.Unlock()
+	return asked, c.db.SetTradeUpdatesSyncedAt(chapter, asked)
+}
+
+// backfill logs a trade for an order the desk has none for, with its
+// aggregates and an order event saying where it came from, and reports
+// whether it did. A replacement of a known order is booked to the original
+// order's user and strategy; any other order to the account's recovery
+// user.
+func (c *Consumer) backfill(chapter string, o *alpaca.Order, known map[string]database.Trade) bool {
+	qty := o.FilledQty
+	if o.Qty != nil {
+		qty = *o.Qty
+	}
+	trade := &database.Trade{
+		UserID:         c.recoveryUser(chapter),
+		OrderID:        o.ID,
+		Symbol:         o.Symbol,
+		Qty:            qty,
+		Side:           string(o.Side),
+		OrderType:      string(o.Type),
+		TimeInForce:    string(o.TimeInForce),
+		LimitPrice:     o.LimitPrice,
+		StopPrice:      o.StopPrice,
+		FilledQty:      o.FilledQty,
+		FilledAvgPrice: o.FilledAvgPrice,
+		OrderStatus:    string(o.Status),
+		SubmittedAt:    o.SubmittedAt,
+		FilledAt:       o.FilledAt,
+		Venue:          database.VenueAlpaca,
+		ClientOrderID:  o.ClientOrderID,
+		ExtendedHours:  o.ExtendedHours,
+	}
+	if o.Replaces != nil {
+		if original, ok := known[*o.Replaces]; ok {
+			trade.UserID = original.UserID
+			trade.StrategyID = original.StrategyID
+			trade.StrategyVersion = original.StrategyVersion
+			trade.Source = original.Source
+		}
+	}
+
+	id, err := c.db.LogTrade(trade)
+	if err != nil {
+		log.Printf("Failed to backfill order %s in account %q: %v", o.ID, chapter, err)
+		return false
+	}
+	trade.ID = id
+	detail := fmt.Sprintf("%s: placed at the broker but never logged", recoveredDetail)
+	if err := c.db.RecordOrderEvent(&database.OrderEvent{
+		TradeID:           id,
+		EventType:         database.EventRecovered,
+		PreviousStatus:    trade.OrderStatus,
+		PreviousFilledQty: trade.FilledQty,
+		OrderStatus:       trade.OrderStatus,
+		FilledQty:         trade.FilledQty,
+		FilledAvgPrice:    trade.FilledAvgPrice,
+		Detail:            &detail,
+	}); err != nil {
+		log.Printf("Failed to record recovery of order %s: %v", o.ID, err)
+	}
+	if err := c.fills.RecordTrade(*trade); err != nil {
+		log.Printf("Failed to aggregate backfilled order %s: %v", o.ID, err)
+	}
+	log.Printf("Backfilled order %s (%s %s %s, %s) for user=%s", o.ID, trade.Side, trade.Qty, trade.Symbol, trade.OrderStatus, trade.UserID)
+	return true
+}
+
+// sync records that the accounts whose streams are live are recorded up to
+// now, or to the oldest update still waiting to be written
+func (c *Consumer) sync(batch map[string]*pending) {
+	at := time.Now()
+	for _, p := range batch {
+		if p.at.Before(at) {
+			at = p.at
+		}
+	}
+
+	c.mu.Lock()
+	var live []string
+	for chapter, ok := range c.live {
+		if ok {
+			live = append(live, chapter)
+		}
+	}
+	c.mu.Unlock()
+	for _, chapter := range live {
+		if err := c.db.SetTradeUpdatesSyncedAt(chapter, at); err != nil {
+			log.Printf("Failed to record trade update cursor for account %q: %v", chapter, err)
+		}
+	}
+}
+
+// setLive records whether an account's stream is being followed
+func (c *Consumer) setLive(chapter string, live bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live[chapter] = live
+}
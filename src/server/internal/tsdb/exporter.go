@@ -0,0 +1,176 @@
+package tsdb
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+
+	"desk/internal/database"
+)
+
+const (
+	// bufferSize is how many points wait for the next flush before new ones
+	// are dropped, so a slow or down database never holds up trading
+	bufferSize = 50000
+	// maxBatch is the most points sent in one write
+	maxBatch = 5000
+	// retryDelay is how long Stream waits before reconnecting a dropped
+	// market data stream
+	retryDelay = 30 * time.Second
+)
+
+// Writer stores points in a time-series database
+type Writer interface {
+	Write(ctx context.Context, points []Point) error
+}
+
+// Source streams market data
+type Source interface {
+	StreamBarsAndQuotes(ctx context.Context, feed string, symbols []string, onBar func(stream.Bar), onQuote func(stream.Quote)) error
+}
+
+// Exporter copies bars, quotes and position marks to a time-series database
+// in the background. Points are buffered and written in batches; when the
+// buffer is full new points are dropped rather than blocking the caller.
+type Exporter struct {
+	writer     Writer
+	flushEvery time.Duration
+	points     chan Point
+	dropped    atomic.Int64
+}
+
+func NewExporter(writer Writer, flushEvery time.Duration) *Exporter {
+	return &Exporter{
+		writer:     writer,
+		flushEvery: flushEvery,
+		points:     make(chan Point, bufferSize),
+	}
+}
+
+// Add queues points for the next flush
+func (e *Exporter) Add(points ...Point) {
+	for _, p := range points {
+		select {
+		case e.points <- p:
+		default:
+			e.dropped.Add(1)
+		}
+	}
+}
+
+// Run writes queued points every flushEvery, or as soon as a full batch is
+// waiting, until ctx is cancelled. A failed batch is logged and dropped.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]Point, 0, maxBatch)
+	flush := func() {
+		if n := e.dropped.Swap(0); n > 0 {
+			log.Printf("Time-series export buffer full: dropped %d points", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := e.writer.Write(writeCtx, batch); err != nil {
+			log.Printf("Failed to export %d points: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case p := <-e.points:
+			batch = append(batch, p)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Stream exports bars, and quotes if quotes is set, of symbols on feed until
+// ctx is cancelled, reconnecting if the stream ends
+func (e *Exporter) Stream(ctx context.Context, source Source, feed string, symbols []string, quotes bool) {
+	var onQuote func(stream.Quote)
+	if quotes {
+		onQuote = e.Quote
+	}
+	for {
+		if err := source.StreamBarsAndQuotes(ctx, feed, symbols, e.Bar, onQuote); err != nil {
+			log.Printf("Time-series export stream failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Bar queues a minute bar
+func (e *Exporter) Bar(b stream.Bar) {
+	e.Add(Point{
+		Measurement: "bars",
+		Tags:        map[string]string{"symbol": b.Symbol},
+		Fields: map[string]any{
+			"open":        b.Open,
+			"high":        b.High,
+			"low":         b.Low,
+			"close":       b.Close,
+			"volume":      b.Volume,
+			"trade_count": b.TradeCount,
+			"vwap":        b.VWAP,
+		},
+		Time: b.Timestamp,
+	})
+}
+
+// Quote queues a top-of-book quote
+func (e *Exporter) Quote(q stream.Quote) {
+	e.Add(Point{
+		Measurement: "quotes",
+		Tags:        map[string]string{"symbol": q.Symbol},
+		Fields: map[string]any{
+			"bid":      q.BidPrice,
+			"bid_size": uint64(q.BidSize),
+			"ask":      q.AskPrice,
+			"ask_size": uint64(q.AskSize),
+		},
+		Time: q.Timestamp,
+	})
+}
+
+// Marks queues a batch of persisted position marks
+func (e *Exporter) Marks(marks []database.PositionMark) {
+	for _, m := range marks {
+		e.Add(Point{
+			Measurement: "position_marks",
+			Tags: map[string]string{
+				"user_id":     m.UserID,
+				"strategy_id": strconv.FormatInt(m.StrategyID, 10),
+				"symbol":      m.Symbol,
+			},
+			Fields: map[string]any{
+				"qty":           m.Qty,
+				"avg_cost":      m.AvgCost,
+				"price":         m.Price,
+				"market_value":  m.MarketValue,
+				"unrealized_pl": m.UnrealizedPL,
+			},
+			Time: m.MarkedAt,
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package tsdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InfluxConfig locates an InfluxDB bucket. Any database that accepts
+// InfluxDB v2 line protocol writes works, including InfluxDB 1.8+ (bucket
+// "db/retention", token "user:password"), QuestDB and VictoriaMetrics, and
+// Telegraf can forward the points to TimescaleDB.
+type InfluxConfig struct {
+	URL    string
+	Org    string
+	Bucket string
+	Token  string
+}
+
+// Influx writes points with the InfluxDB v2 write API
+type Influx struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func NewInflux(cfg InfluxConfig) *Influx {
+	query := url.Values{"bucket": {cfg.Bucket}, "precision": {"ns"}}
+	if cfg.Org != "" {
+		query.Set("org", cfg.Org)
+	}
+	return &Influx{
+		endpoint: strings.TrimRight(cfg.URL, "/") + "/api/v2/write?" + query.Encode(),
+		token:    cfg.Token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Write sends points in one request. Points that can't be encoded are
+// skipped and reported in the error after the rest are written.
+func (i *Influx) Write(ctx context.Context, points []Point) error {
+	var body []byte
+	var encodeErr error
+	for _, p := range points {
+		line, err := appendLine(body, p)
+		if err != nil {
+			encodeErr = err
+			continue
+		}
+		body = line
+	}
+	if len(body) == 0 {
+		return encodeErr
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write points: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to write points: %s: %s", resp.Status, msg)
+	}
+	return encodeErr
+}
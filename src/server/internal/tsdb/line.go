@@ -0,0 +1,89 @@
+package tsdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Point is one row of a time-series measurement
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// Fields hold float64, int64, uint64, bool, string or decimal.Decimal
+	// values; decimals are written as floats
+	Fields map[string]any
+	Time   time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// appendLine appends p to b in InfluxDB line protocol with a nanosecond
+// timestamp. Tags and fields are sorted, as InfluxDB recommends.
+func appendLine(b []byte, p Point) ([]byte, error) {
+	if len(p.Fields) == 0 {
+		return b, fmt.Errorf("point %s has no fields", p.Measurement)
+	}
+	b = append(b, measurementEscaper.Replace(p.Measurement)...)
+
+	keys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = append(b, ',')
+		b = append(b, tagEscaper.Replace(k)...)
+		b = append(b, '=')
+		b = append(b, tagEscaper.Replace(p.Tags[k])...)
+	}
+
+	keys = keys[:0]
+	for k := range p.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			b = append(b, ' ')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, tagEscaper.Replace(k)...)
+		b = append(b, '=')
+		switch v := p.Fields[k].(type) {
+		case float64:
+			b = strconv.AppendFloat(b, v, 'f', -1, 64)
+		case decimal.Decimal:
+			b = append(b, v.String()...)
+		case int64:
+			b = strconv.AppendInt(b, v, 10)
+			b = append(b, 'i')
+		case uint64:
+			b = strconv.AppendUint(b, v, 10)
+			b = append(b, 'i')
+		case bool:
+			b = strconv.AppendBool(b, v)
+		case string:
+			b = append(b, '"')
+			b = append(b, stringEscaper.Replace(v)...)
+			b = append(b, '"')
+		default:
+			return b, fmt.Errorf("unsupported field %s of type %T", k, v)
+		}
+	}
+
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, p.Time.UnixNano(), 10)
+	return append(b, '\n'), nil
+}
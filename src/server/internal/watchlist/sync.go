@@ -0,0 +1,77 @@
+package watchlist
+
+import (
+	"fmt"
+	"log"
+
+	"desk/internal/database"
+	"desk/internal/tenants"
+)
+
+// Broker is the subset of the Alpaca client used to mirror watchlists
+type Broker interface {
+	CreateWatchlist(name string, symbols []string) (string, error)
+	UpdateWatchlist(watchlistID, name string, symbols []string) error
+	DeleteWatchlist(watchlistID string) error
+}
+
+// Syncer mirrors the desk's watchlists to Alpaca watchlists on the desk's
+// account. The database is the source of truth; Alpaca is overwritten.
+// Lists of other chapters' users are never mirrored to the desk's account.
+type Syncer struct {
+	broker Broker
+	db     *database.DB
+}
+
+func NewSyncer(broker Broker, db *database.DB) *Syncer {
+	return &Syncer{
+		broker: broker,
+		db:     db,
+	}
+}
+
+// AlpacaName is the name a watchlist is mirrored under. Alpaca names must be
+// unique per account, so the owner is included.
+func AlpacaName(wl *database.Watchlist) string {
+	return fmt.Sprintf("%s/%s", wl.UserID, wl.Name)
+}
+
+// Push creates or updates the Alpaca watchlist mirroring wl
+func (s *Syncer) Push(wl *database.Watchlist) error {
+	if tenants.ChapterID(wl.UserID) != "" {
+		return nil
+	}
+	if wl.AlpacaID != nil {
+		return s.broker.UpdateWatchlist(*wl.AlpacaID, AlpacaName(wl), wl.Symbols)
+	}
+
+	alpacaID, err := s.broker.CreateWatchlist(AlpacaName(wl), wl.Symbols)
+	if err != nil {
+		return err
+	}
+	wl.AlpacaID = &alpacaID
+	return s.db.SetWatchlistAlpacaID(wl.ID, &alpacaID)
+}
+
+// Delete removes the Alpaca watchlist mirroring wl, if there is one
+func (s *Syncer) Delete(wl *database.Watchlist) error {
+	if wl.AlpacaID == nil {
+		return nil
+	}
+	return s.broker.DeleteWatchlist(*wl.AlpacaID)
+}
+
+// PushAll mirrors every watchlist, repairing any drift on the Alpaca side
+func (s *Syncer) PushAll() error {
+	lists, err := s.db.GetAllWatchlists()
+	if err != nil {
+		return err
+	}
+
+	for i := range lists {
+		if err := s.Push(&lists[i]); err != nil {
+			log.Printf("Failed to sync watchlist ID=%d to Alpaca: %v", lists[i].ID, err)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@
 Desk Client Library - Helper library for Quant Club Trading Desk strategies
 """
 
-from .client import place_order, get_server_url, set_user_id
+from .client import place_order, suggest_size, get_server_url, set_user_id, set_token, set_api_key
+from .events import Strategy
 
-__all__ = ['place_order', 'get_server_url', 'set_user_id']
+__all__ = ['place_order', 'suggest_size', 'get_server_url', 'set_user_id', 'set_token', 'set_api_key', 'Strategy']
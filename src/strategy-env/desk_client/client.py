@@ -4,6 +4,8 @@ Handles protobuf serialization and HTTP requests.
 """
 
 import os
+import time
+import uuid
 import requests
 from typing import Optional
 
@@ -13,6 +15,12 @@ from .order_pb2 import OrderRequest, OrderResponse
 # Global configuration
 _server_url = os.getenv("DESK_SERVER_URL", "http://localhost:8080")
 _user_id = os.getenv("USER_ID", "default_user")
+# Set by the desk's strategy runner so orders are attributed to the strategy
+_strategy_id = os.getenv("STRATEGY_ID")
+# The chapter token, when the desk is shared between chapters
+_token = os.getenv("DESK_TOKEN")
+# The API key the desk issued when the user was onboarded
+_api_key = os.getenv("DESK_API_KEY")
 
 
 def set_user_id(user_id: str) -> None:
@@ -21,6 +29,29 @@ def set_user_id(user_id: str) -> None:
     _user_id = user_id
 
 
+def set_token(token: str) -> None:
+    """Set the chapter token sent with all subsequent requests."""
+    global _token
+    _token = token
+
+
+def set_api_key(api_key: str) -> None:
+    """Set the API key sent with all subsequent requests, in place of the user ID."""
+    global _api_key
+    _api_key = api_key
+
+
+def _headers() -> dict:
+    """Headers identifying the caller on every request."""
+    if _api_key:
+        headers = {"X-API-Key": _api_key}
+    else:
+        headers = {"X-User-ID": _user_id}
+    if _token:
+        headers["Authorization"] = f"Bearer {_token}"
+    return headers
+
+
 def get_server_url() -> str:
     """Get the current server URL."""
     return _server_url
@@ -28,26 +59,47 @@ def get_server_url() -> str:
 
 def place_order(
     symbol: str,
-    qty: str,
+    qty: Optional[str],
     side: str,
     order_type: str = "market",
     time_in_force: str = "day",
     limit_price: Optional[str] = None,
     stop_price: Optional[str] = None,
-    timeout: int = 10
+    risk_per_trade: Optional[str] = None,
+    stop_distance: Optional[str] = None,
+    equity_fraction: Optional[str] = None,
+    extended_hours: bool = False,
+    timeout: int = 10,
+    generated_at: Optional[float] = None,
+    nonce: Optional[str] = None,
+    source: Optional[str] = None
 ) -> OrderResponse:
     """
     Place a trading order with the Desk server.
 
     Args:
         symbol: Stock symbol (e.g., "AAPL")
-        qty: Quantity as string (e.g., "10" or "10.5")
+        qty: Quantity as string (e.g., "10" or "10.5"), or None to have the
+            desk size the order with risk_per_trade or equity_fraction
         side: "buy" or "sell"
         order_type: "market", "limit", "stop", or "stop_limit"
         time_in_force: "day", "gtc", "ioc", or "fok"
         limit_price: Optional limit price for limit orders
         stop_price: Optional stop price for stop orders
+        risk_per_trade: Fraction of equity to lose if the stop is hit (e.g. "0.01")
+        stop_distance: Price distance to the stop for risk_per_trade; defaults
+            to the distance to stop_price
+        equity_fraction: Fraction of equity to put into the position (e.g. "0.05")
+        extended_hours: Also trade in the pre-market and after-hours sessions;
+            the order must be a "limit" order with time_in_force "day"
         timeout: Request timeout in seconds
+        generated_at: When the strategy decided to trade, as a Unix timestamp
+            in seconds; defaults to now. The desk rejects orders older than
+            its CLIENT_MAX_AGE.
+        nonce: Unique ID of the order; defaults to a random one. Pass the
+            same nonce when resending an order so it can't be placed twice.
+        source: Where the order came from: "manual", "api" or "webhook";
+            defaults to "api" for strategies and "manual" otherwise
 
     Returns:
         OrderResponse: Protobuf response from the server
@@ -59,7 +111,7 @@ def place_order(
     # Create protobuf request
     order_req = OrderRequest(
         symbol=symbol,
-        qty=qty,
+        qty=qty or "",
         side=side,
         order_type=order_type,
         time_in_force=time_in_force
@@ -69,15 +121,29 @@ def place_order(
         order_req.limit_price = limit_price
     if stop_price:
         order_req.stop_price = stop_price
+    if risk_per_trade:
+        order_req.risk_per_trade = risk_per_trade
+    if stop_distance:
+        order_req.stop_distance = stop_distance
+    if equity_fraction:
+        order_req.equity_fraction = equity_fraction
+    if extended_hours:
+        order_req.extended_hours = True
 
     # Serialize to protobuf
     request_data = order_req.SerializeToString()
 
     # Make HTTP POST request
-    headers = {
-        "Content-Type": "application/x-protobuf",
-        "X-User-ID": _user_id
-    }
+    headers = _headers()
+    headers["Content-Type"] = "application/x-protobuf"
+    if _strategy_id:
+        headers["X-Strategy-ID"] = _strategy_id
+    if generated_at is None:
+        generated_at = time.time()
+    headers["X-Client-Timestamp"] = str(int(generated_at * 1000))
+    headers["X-Client-Nonce"] = nonce or uuid.uuid4().hex
+    if source:
+        headers["X-Order-Source"] = source
 
     response = requests.post(
         f"{_server_url}/order",
@@ -97,3 +163,53 @@ def place_order(
         print(f"✗ Order failed: {order_resp.message}")
 
     return order_resp
+
+
+def suggest_size(
+    symbol: str,
+    target_vol: str,
+    window: Optional[int] = None,
+    atr_period: Optional[int] = None,
+    allocation: Optional[str] = None,
+    timeout: int = 10
+) -> dict:
+    """
+    Ask the desk for a volatility-targeted position size.
+
+    Args:
+        symbol: Stock symbol (e.g., "AAPL")
+        target_vol: Annualized volatility target as a fraction of the
+            allocation (e.g., "0.15")
+        window: Daily returns realized volatility is measured over (default 20)
+        atr_period: ATR period in days (default 14)
+        allocation: Capital to size against instead of your configured
+            allocation
+        timeout: Request timeout in seconds
+        generated_at: When the strategy decided to trade, as a Unix timestamp
+            in seconds; defaults to now. The desk rejects orders older than
+            its CLIENT_MAX_AGE.
+        nonce: Unique ID of the order; defaults to a random one. Pass the
+            same nonce when resending an order so it can't be placed twice.
+
+    Returns:
+        dict: The suggestion; "qty" is the suggested quantity
+
+    Raises:
+        requests.exceptions.HTTPError: If the desk can't size the symbol
+    """
+    params = {"target_vol": target_vol}
+    if window:
+        params["window"] = window
+    if atr_period:
+        params["atr_period"] = atr_period
+    if allocation:
+        params["allocation"] = allocation
+
+    response = requests.get(
+        f"{_server_url}/sizing/{symbol}",
+        params=params,
+        headers=_headers(),
+        timeout=timeout
+    )
+    response.raise_for_status()
+    return response.json()
@@ -0,0 +1,95 @@
+"""
+Event-driven strategies fed by the Trading Desk.
+
+Subclass Strategy, override the callbacks you need and call run(). The desk
+streams bars, quotes, the strategy's own fills and timer ticks over gRPC, so
+the strategy never polls.
+"""
+
+import os
+import time
+from typing import Iterable, Optional
+
+import grpc
+
+from . import client
+from .strategy_pb2 import Bar, Fill, Quote, SubscribeRequest, Timer
+from .strategy_pb2_grpc import StrategyEventsStub
+
+
+# Set by the desk's strategy runner when the event service is enabled
+_events_addr = os.getenv("DESK_EVENTS_ADDR", "localhost:9090")
+
+
+class Strategy:
+    """
+    Base class of an event-driven strategy. Every callback does nothing
+    unless overridden; place orders from them with desk_client.place_order.
+    """
+
+    def on_bar(self, bar: Bar) -> None:
+        """Called with each one-minute bar of a subscribed symbol."""
+
+    def on_quote(self, quote: Quote) -> None:
+        """Called with each quote of a subscribed symbol, if quotes were asked for."""
+
+    def on_fill(self, fill: Fill) -> None:
+        """Called when one of this strategy's orders fills."""
+
+    def on_timer(self, timer: Timer) -> None:
+        """Called every timer_interval seconds, if an interval was given."""
+
+    def run(
+        self,
+        symbols: Iterable[str],
+        quotes: bool = False,
+        timer_interval: int = 0,
+        addr: Optional[str] = None,
+        reconnect_delay: float = 5.0,
+    ) -> None:
+        """
+        Subscribe to the desk's events and dispatch them to the callbacks
+        until interrupted, reconnecting when the stream drops.
+
+        Args:
+            symbols: Symbols to receive bars (and quotes) of
+            quotes: Also receive quotes
+            timer_interval: Seconds between on_timer calls; 0 for none
+            addr: The desk's event service; defaults to DESK_EVENTS_ADDR
+            reconnect_delay: Seconds to wait before reconnecting
+        """
+        request = SubscribeRequest(
+            symbols=list(symbols),
+            quotes=quotes,
+            timer_interval_seconds=timer_interval,
+        )
+        while True:
+            try:
+                with grpc.insecure_channel(addr or _events_addr) as channel:
+                    stub = StrategyEventsStub(channel)
+                    for event in stub.Subscribe(request, metadata=_metadata()):
+                        self._dispatch(event)
+            except grpc.RpcError as e:
+                if e.code() in (grpc.StatusCode.UNAUTHENTICATED, grpc.StatusCode.INVALID_ARGUMENT):
+                    raise
+                print(f"✗ Event stream dropped: {e.code().name} {e.details()}")
+            time.sleep(reconnect_delay)
+
+    def _dispatch(self, event) -> None:
+        kind = event.WhichOneof("event")
+        if kind == "bar":
+            self.on_bar(event.bar)
+        elif kind == "quote":
+            self.on_quote(event.quote)
+        elif kind == "fill":
+            self.on_fill(event.fill)
+        elif kind == "timer":
+            self.on_timer(event.timer)
+
+
+def _metadata() -> list:
+    """Metadata identifying the strategy, like the HTTP client's headers."""
+    metadata = [(k.lower(), v) for k, v in client._headers().items()]
+    if client._strategy_id:
+        metadata.append(("x-strategy-id", client._strategy_id))
+    return metadata
@@ -7,6 +7,7 @@ setup(
     packages=find_packages(),
     install_requires=[
         "protobuf>=5.29.2",
+        "grpcio>=1.68.1",
         "requests>=2.32.3",
     ],
     python_requires=">=3.8",